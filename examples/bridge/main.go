@@ -0,0 +1,365 @@
+// Package main implements mcp-flow-bridge, a stdio MCP server that forwards
+// everything to a remote MCP-Flow server.
+//
+// Editors and agents that only speak stdio MCP launch the bridge as their
+// server command. The bridge connects when the client sends initialize,
+// relays each newline-delimited JSON-RPC message over MCP-Flow (falling back
+// through WebSocket, TCP+TLS, and Streamable HTTP like the mcpflow CLI), and
+// if the connection drops it reconnects with backoff, replays the client's
+// initialize, and retries the message that failed. tools/call requests are
+// tagged with an idempotency key first, so a retried call is not executed
+// twice by the server.
+//
+// The bearer token from -token or $MCPFLOW_TOKEN is sent on every transport
+// that carries HTTP headers.
+//
+// Usage:
+//
+//	go run . -addr flow.example.com:4433 [-token TOKEN] [-ca ca.pem] [-tcp-addr host:4434]
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+const (
+	maxMessageSize = 16 * 1024 * 1024
+
+	errCodeParseError     = -32700
+	errCodeInvalidRequest = -32600
+
+	initialBackoff = 250 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+)
+
+// =============================================================================
+// Bridge
+// =============================================================================
+
+// bridge relays one stdio MCP client to a remote MCP-Flow server. Messages
+// are handled in order, matching the server's sequential session loop.
+type bridge struct {
+	opts             mcpflowclient.Options
+	reconnectTimeout time.Duration
+	logger           *slog.Logger
+	out              io.Writer
+
+	client *mcpflowclient.Client
+}
+
+// message is the part of a JSON-RPC message the bridge inspects.
+type message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type errorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// run serves messages from in until EOF.
+func (b *bridge) run(ctx context.Context, in io.Reader) error {
+	defer func() {
+		if b.client != nil {
+			b.client.Close()
+		}
+	}()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		b.handle(ctx, line)
+	}
+	return scanner.Err()
+}
+
+func (b *bridge) handle(ctx context.Context, line []byte) {
+	var msg message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		b.replyError(nil, errCodeParseError, "Parse error: "+err.Error())
+		return
+	}
+
+	switch {
+	case msg.Method == "initialize":
+		b.initialize(ctx, &msg)
+	case msg.Method == "notifications/initialized":
+		// Already sent upstream as part of the bridge's own handshake.
+	case b.client == nil:
+		if msg.ID != nil {
+			b.replyError(msg.ID, errCodeInvalidRequest, "bridge not connected: send initialize first")
+		}
+	default:
+		b.forward(ctx, &msg, line)
+	}
+}
+
+// initialize connects upstream using the client's own initialize params, so
+// protocol version and capabilities are negotiated end to end, and answers
+// with the server's result.
+func (b *bridge) initialize(ctx context.Context, msg *message) {
+	params := map[string]interface{}{}
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			b.replyError(msg.ID, mcpflowerr.CodeInvalidParams, "Invalid params: "+err.Error())
+			return
+		}
+	}
+	// The transport block describes the MCP-Flow leg, which the bridge owns.
+	delete(params, "transport")
+
+	if b.client != nil {
+		b.client.Close()
+		b.client = nil
+	}
+
+	opts := b.opts
+	opts.InitializeParams = params
+	err := b.retry(ctx, func(ctx context.Context) error {
+		client, err := mcpflowclient.Connect(ctx, opts)
+		if err != nil {
+			return err
+		}
+		b.client = client
+		return nil
+	})
+	if err != nil {
+		// A refusal from the server itself, such as a rejected token or
+		// protocol version, keeps its code.
+		var rpcErr *mcpflowerr.Error
+		if errors.As(err, &rpcErr) {
+			b.replyError(msg.ID, rpcErr.Code, rpcErr.Message)
+			return
+		}
+		b.replyError(msg.ID, mcpflowerr.CodeInternal, "remote server unavailable: "+err.Error())
+		return
+	}
+
+	b.reply(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      msg.ID,
+		"result":  b.client.InitializeResult(),
+	})
+}
+
+// forward relays a message, reconnecting and retrying once if the
+// connection has failed.
+func (b *bridge) forward(ctx context.Context, msg *message, raw []byte) {
+	if msg.Method == "tools/call" && msg.ID != nil {
+		raw = withIdempotencyKey(raw)
+	}
+
+	resp, err := b.client.Forward(ctx, raw)
+	if err != nil {
+		b.logger.Warn("forward failed, reconnecting", "method", msg.Method, "error", err)
+		if err = b.retry(ctx, b.client.Reconnect); err == nil {
+			resp, err = b.client.Forward(ctx, raw)
+		}
+	}
+	if err != nil {
+		b.logger.Error("forward failed", "method", msg.Method, "error", err)
+		if msg.ID != nil {
+			b.replyError(msg.ID, mcpflowerr.CodeInternal, "remote server unavailable: "+err.Error())
+		}
+		return
+	}
+
+	if resp != nil {
+		b.write(resp)
+	}
+}
+
+// retry runs op with exponential backoff until it succeeds or the
+// reconnect timeout expires.
+func (b *bridge) retry(ctx context.Context, op func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, b.reconnectTimeout)
+	defer cancel()
+
+	delay := initialBackoff
+	for {
+		err := op(ctx)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, mcpflowclient.ErrClosed) {
+			return err
+		}
+		var rpcErr *mcpflowerr.Error
+		if errors.As(err, &rpcErr) {
+			// The server answered and refused; retrying will not help.
+			return err
+		}
+
+		b.logger.Warn("connect failed", "error", err, "retry_in", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %s: %w", b.reconnectTimeout, err)
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+func (b *bridge) reply(v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		b.logger.Error("encode failed", "error", err)
+		return
+	}
+	b.write(data)
+}
+
+func (b *bridge) replyError(id json.RawMessage, code int, message string) {
+	resp := errorResponse{JSONRPC: "2.0", ID: id}
+	resp.Error.Code = code
+	resp.Error.Message = message
+	b.reply(&resp)
+}
+
+func (b *bridge) write(data []byte) {
+	line := make([]byte, 0, len(data)+1)
+	line = append(append(line, data...), '\n')
+	if _, err := b.out.Write(line); err != nil {
+		b.logger.Error("write failed", "error", err)
+	}
+}
+
+// withIdempotencyKey tags a tools/call request with _meta.idempotencyKey
+// unless the client already supplied one. Malformed messages are returned
+// unchanged for the server to reject.
+func withIdempotencyKey(raw []byte) []byte {
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(raw, &msg) != nil {
+		return raw
+	}
+	params := map[string]json.RawMessage{}
+	if p, ok := msg["params"]; ok && json.Unmarshal(p, &params) != nil {
+		return raw
+	}
+	meta := map[string]json.RawMessage{}
+	if m, ok := params["_meta"]; ok && json.Unmarshal(m, &meta) != nil {
+		return raw
+	}
+	if _, ok := meta["idempotencyKey"]; ok {
+		return raw
+	}
+
+	key := make([]byte, 16)
+	rand.Read(key)
+	meta["idempotencyKey"], _ = json.Marshal("bridge-" + hex.EncodeToString(key))
+
+	var err error
+	if params["_meta"], err = json.Marshal(meta); err != nil {
+		return raw
+	}
+	if msg["params"], err = json.Marshal(params); err != nil {
+		return raw
+	}
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// =============================================================================
+// Main
+// =============================================================================
+
+func main() {
+	addr := flag.String("addr", "", "MCP-Flow server WebTransport address, e.g. flow.example.com:4433")
+	wsURL := flag.String("ws-url", "", "WebSocket fallback URL, e.g. wss://flow.example.com:4435/mcp-flow-ws")
+	tcpAddr := flag.String("tcp-addr", "", "TCP+TLS fallback address, e.g. flow.example.com:4434")
+	service := flag.String("srv", "", "Discover servers from the _mcpflow._udp and _mcpflow._tcp SRV records of this domain")
+	httpURL := flag.String("http-url", "", "Streamable HTTP fallback URL, e.g. https://flow.example.com:4435/mcp")
+	transports := flag.String("transports", "webtransport,websocket,tcp,http", "Transport fallback order; entries without an address are skipped")
+	token := flag.String("token", os.Getenv("MCPFLOW_TOKEN"), "Bearer token sent to the server (default $MCPFLOW_TOKEN)")
+	caFile := flag.String("ca", "", "PEM file of CA certificates to trust instead of the system roots")
+	insecure := flag.Bool("insecure", false, "Skip TLS verification (for self-signed certs)")
+	attemptTimeout := flag.Duration("attempt-timeout", 5*time.Second, "Timeout for each transport attempt, including initialize")
+	reconnectTimeout := flag.Duration("reconnect-timeout", time.Minute, "How long to keep retrying a lost connection before failing requests")
+	verbose := flag.Bool("v", false, "Verbose logging")
+	flag.Parse()
+
+	// stdout carries the protocol, so logs go to stderr.
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	if *addr == "" && *wsURL == "" && *tcpAddr == "" && *httpURL == "" && *service == "" {
+		logger.Error("no server address: set -addr, -srv, or a fallback endpoint")
+		os.Exit(2)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: *insecure}
+	if *caFile != "" {
+		pem, err := os.ReadFile(*caFile)
+		if err != nil {
+			logger.Error("failed to read CA file", "error", err)
+			os.Exit(1)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			logger.Error("no certificates found in CA file", "path", *caFile)
+			os.Exit(1)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	var order []string
+	for _, name := range strings.Split(*transports, ",") {
+		order = append(order, strings.TrimSpace(name))
+	}
+
+	b := &bridge{
+		opts: mcpflowclient.Options{
+			Addr:           *addr,
+			WebSocketURL:   *wsURL,
+			TCPAddr:        *tcpAddr,
+			Service:        *service,
+			HTTPURL:        *httpURL,
+			Order:          order,
+			TLSConfig:      tlsConfig,
+			Token:          *token,
+			AttemptTimeout: *attemptTimeout,
+			Logger:         logger,
+		},
+		reconnectTimeout: *reconnectTimeout,
+		logger:           logger,
+		out:              os.Stdout,
+	}
+
+	if err := b.run(context.Background(), os.Stdin); err != nil {
+		logger.Error("bridge stopped", "error", err)
+		os.Exit(1)
+	}
+}
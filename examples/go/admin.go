@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Admin Endpoint
+// =============================================================================
+
+// adminMux serves operational endpoints on the admin listener. It is plain
+// HTTP and should be bound to a loopback or otherwise private address.
+// Endpoints that act on the server or report on tenants are only served
+// behind AuthToken, so without one, reaching the listener is not enough to
+// drain the server.
+func (s *Server) adminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		s.handler.metrics.WritePrometheus(w)
+		s.handler.toolPool.writePrometheus(w)
+	})
+
+	// /readyz turns unready once draining or while shedding load, so load
+	// balancers and Kubernetes stop sending new sessions.
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if s.handler.drain.isDraining() {
+			http.Error(w, "draining", http.StatusServiceUnavailable)
+			return
+		}
+		if s.handler.load.overloaded() {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+
+	if s.cfg.AuthToken != "" {
+		s.mountAdminAuthed(mux)
+	}
+
+	// /stats is a JSON snapshot of sessions, request and error counts, and
+	// tool latency, polled by mcpflow top.
+	mux.Handle("/stats", s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Stats())
+	})))
+
+	mux.HandleFunc("/error-codes", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mcpflowerr.Codes())
+	})
+
+	return mux
+}
+
+// mountAdminAuthed adds the admin endpoints that require AuthToken.
+func (s *Server) mountAdminAuthed(mux *http.ServeMux) {
+	// /drain reports DrainStatus. POST starts draining and, with
+	// ?wait=<duration>, holds the response until the server is idle or the
+	// wait runs out, for preStop hooks; 202 means it is not idle yet.
+	mux.Handle("/drain", s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			s.Drain()
+			if wait := r.URL.Query().Get("wait"); wait != "" {
+				d, err := time.ParseDuration(wait)
+				if err != nil {
+					http.Error(w, "invalid wait: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				ctx, cancel := context.WithTimeout(r.Context(), d)
+				s.WaitIdle(ctx)
+				cancel()
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		status := s.DrainStatus()
+		w.Header().Set("Content-Type", "application/json")
+		if status.Draining && !status.Idle {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		json.NewEncoder(w).Encode(status)
+	})))
+
+	// /usage reports each tenant's usage and limits in the current quota
+	// window; ?tenant=<name> selects one.
+	mux.Handle("/usage", s.requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v interface{} = s.Usage()
+		if name := r.URL.Query().Get("tenant"); name != "" {
+			usage, ok := s.TenantUsage(name)
+			if !ok {
+				http.Error(w, "unknown tenant", http.StatusNotFound)
+				return
+			}
+			v = usage
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	})))
+
+	// /usage/report rolls up tool calls by tool, tenant, and client over
+	// time; see parseUsageQuery for its parameters.
+	mux.Handle("/usage/report", s.requireAuth(http.HandlerFunc(s.usageReportHandler)))
+}
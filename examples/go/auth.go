@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Bearer Token Authentication
+// =============================================================================
+
+// authMetaKey names the initialize _meta field carrying the bearer token on
+// transports without request headers.
+const authMetaKey = "authorization"
+
+// tokenValid reports whether an Authorization value ("Bearer <token>")
+// carries the configured token.
+func (c Config) tokenValid(authorization string) bool {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(c.AuthToken)) == 1
+}
+
+// requireAuth rejects HTTP requests that lack the configured bearer token.
+// It is a no-op when no token is configured.
+func (s *Server) requireAuth(next http.Handler) http.Handler {
+	if s.cfg.AuthToken == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.tokenValid(r.Header.Get("Authorization")) {
+			s.httpAuthFailed(r)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-flow"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize admits req on a session still waiting for its token. Such a
+// session only accepts an initialize whose _meta.authorization carries the
+// token; every other message is refused. A tenant's token moves the session
+// to that tenant's Handler; without a server token, other sessions stay on
+// the default registry.
+func (h *Handler) authorize(sess *Session, req *RPCRequest) bool {
+	if !sess.authPending() {
+		return true
+	}
+
+	if req.Method == "initialize" {
+		var params InitializeParams
+		if err := decodeParams(req, &params); err != nil {
+			return false
+		}
+		value := params.Meta.Authorization
+		if tenant := h.tenantByToken(value); tenant != nil {
+			// Only the serve loop reads sess.handler, and this runs on it.
+			sess.handler = tenant
+			sess.setAuthenticated()
+			return true
+		}
+		if h.cfg.AuthToken == "" || h.cfg.tokenValid(value) {
+			sess.setAuthenticated()
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) unauthorizedResponse(req *RPCRequest) *RPCResponse {
+	if req.ID.IsZero() {
+		return nil
+	}
+	return h.toolErrorResponse(req.ID, mcpflowerr.Unauthorized("missing or invalid bearer token"))
+}
+
+// withoutAuthMeta returns params minus the bearer token, so it is never
+// stored or relayed.
+func withoutAuthMeta(params map[string]interface{}) map[string]interface{} {
+	meta, ok := params["_meta"].(map[string]interface{})
+	if !ok {
+		return params
+	}
+	if _, ok := meta[authMetaKey]; !ok {
+		return params
+	}
+
+	out := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		out[k] = v
+	}
+	stripped := make(map[string]interface{}, len(meta))
+	for k, v := range meta {
+		if k != authMetaKey {
+			stripped[k] = v
+		}
+	}
+	if len(stripped) > 0 {
+		out["_meta"] = stripped
+	} else {
+		delete(out, "_meta")
+	}
+	return out
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Response Cache
+// =============================================================================
+
+// CacheBackend stores encoded results for the response cache. Implementations
+// must be safe for concurrent use; a shared backend lets several server
+// instances absorb the same reconnect storm.
+type CacheBackend interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// cacheableMethods lists the read-only methods whose results may be cached.
+// tools/call is handled separately, per tool, by its read-only annotation.
+var cacheableMethods = map[string]bool{
+	"tools/list":     true,
+	"resources/list": true,
+}
+
+// responseCache wraps a CacheBackend with key derivation and TTL policy.
+type responseCache struct {
+	backend CacheBackend
+	ttl     time.Duration
+
+	// generations counts the list changes of each capability ("tools",
+	// "resources", "prompts"). It is part of the key, so a change strands
+	// the entries cached before it, which a shared backend cannot be asked
+	// to find, until they expire.
+	mu          sync.Mutex
+	generations map[string]uint64
+}
+
+// invalidate makes cached results of capability's methods, such as
+// tools/list and read-only tools/call for "tools", miss from now on.
+func (c *responseCache) invalidate(capability string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations == nil {
+		c.generations = make(map[string]uint64)
+	}
+	c.generations[capability]++
+}
+
+func (c *responseCache) generation(capability string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[capability]
+}
+
+// key derives the cache key from the method, the generation of its
+// capability, and a hash of its params. The _meta block carries
+// per-request data such as progress tokens and is excluded so it does not
+// defeat caching.
+func (c *responseCache) key(method string, params json.RawMessage) (string, bool) {
+	// Decode the params to drop _meta and so that encoding/json, which
+	// sorts map keys, writes equal params identically whatever order they
+	// were sent in. Numbers are kept as sent.
+	var stripped map[string]interface{}
+	if len(params) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(params))
+		dec.UseNumber()
+		if err := dec.Decode(&stripped); err != nil {
+			return "", false
+		}
+		delete(stripped, "_meta")
+	}
+	if stripped == nil {
+		stripped = map[string]interface{}{}
+	}
+
+	body, err := json.Marshal(stripped)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(body)
+	capability, _, _ := strings.Cut(method, "/")
+	gen := strconv.FormatUint(c.generation(capability), 10)
+	return method + ":" + gen + ":" + hex.EncodeToString(sum[:]), true
+}
+
+func (c *responseCache) get(key string) (json.RawMessage, bool) {
+	value, ok := c.backend.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return json.RawMessage(value), true
+}
+
+func (c *responseCache) set(key string, result interface{}) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	c.backend.Set(key, body, c.ttl)
+}
+
+// =============================================================================
+// In-Memory LRU Backend
+// =============================================================================
+
+// LRUCache is an in-memory CacheBackend that evicts the least recently used
+// entry once capacity is reached. Expired entries are dropped on access.
+type LRUCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUCache creates an LRU cache holding at most capacity entries.
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &LRUCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached value for key if present and not expired.
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return entry.value, true
+}
+
+// Set stores value under key for ttl, evicting the oldest entry if full.
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(ttl)
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// namedTool is a tool that does nothing, for tests about catalogs.
+type namedTool string
+
+func (t namedTool) Name() string        { return string(t) }
+func (t namedTool) Description() string { return "Test tool " + string(t) + "." }
+func (t namedTool) InputSchema() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (t namedTool) Execute(map[string]interface{}) (interface{}, error) {
+	return map[string]interface{}{"content": []interface{}{}}, nil
+}
+
+// testSession returns an initialized session on h.
+func testSession(t *testing.T, h *Handler) *Session {
+	t.Helper()
+	sess := NewSession(h, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	testCall(t, h, sess, "initialize", `{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"1"}}`)
+	testCall(t, h, sess, "notifications/initialized", "")
+	return sess
+}
+
+// testCall sends a request, or a notification for a method under
+// notifications/, and returns the result.
+func testCall(t *testing.T, h *Handler, sess *Session, method, params string) json.RawMessage {
+	t.Helper()
+	raw := `{"jsonrpc":"2.0","id":1,"method":"` + method + `"`
+	if strings.HasPrefix(method, "notifications/") {
+		raw = `{"jsonrpc":"2.0","method":"` + method + `"`
+	}
+	if params != "" {
+		raw += `,"params":` + params
+	}
+	var req RPCRequest
+	if err := json.Unmarshal([]byte(raw+"}"), &req); err != nil {
+		t.Fatal(err)
+	}
+	resp := h.Handle(sess, &req)
+	if resp == nil {
+		return nil
+	}
+	if resp.Error != nil {
+		t.Fatalf("%s: %d %s", method, resp.Error.Code, resp.Error.Message)
+	}
+	result, err := json.Marshal(resp.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// listedTools returns the sorted names tools/list returns on sess.
+func listedTools(t *testing.T, h *Handler, sess *Session) string {
+	t.Helper()
+	var result struct {
+		Tools []struct{ Name string }
+	}
+	if err := json.Unmarshal(testCall(t, h, sess, "tools/list", ""), &result); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tool := range result.Tools {
+		names = append(names, tool.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// A list_changed must not leave the response cache serving the list from
+// before the change, as happens when a plugin is reloaded.
+func TestResponseCacheListChanged(t *testing.T) {
+	h := NewHandler(Config{ResponseCacheTTL: time.Hour})
+	plugin := &watchedPlugin{tools: StaticTools{namedTool("forecast")}}
+	if err := h.RegisterNamespace("weather", plugin); err != nil {
+		t.Fatal(err)
+	}
+	sess := testSession(t, h)
+
+	const before = "echo_joke,weather.forecast"
+	if got := listedTools(t, h, sess); got != before {
+		t.Fatalf("tools/list = %s, want %s", got, before)
+	}
+
+	plugin.mu.Lock()
+	plugin.tools = StaticTools{namedTool("forecast"), namedTool("alerts")}
+	plugin.mu.Unlock()
+	if got := listedTools(t, h, sess); got != before {
+		t.Fatalf("tools/list before list_changed = %s, want the cached %s", got, before)
+	}
+
+	h.NotifyToolsListChanged()
+	if got, want := listedTools(t, h, sess), "echo_joke,weather.alerts,weather.forecast"; got != want {
+		t.Fatalf("tools/list after list_changed = %s, want %s", got, want)
+	}
+}
+
+// Tenants share Config.CacheBackend, but not their catalogs.
+func TestResponseCacheTenants(t *testing.T) {
+	h := NewHandler(Config{
+		ResponseCacheTTL: time.Hour,
+		CacheBackend:     NewLRUCache(64),
+		Tenants:          []TenantConfig{{Name: "acme", Token: "acme-token"}, {Name: "globex", Token: "globex-token"}},
+	})
+	tools := map[string]string{"acme": "rockets", "globex": "doomsday"}
+	for name, tool := range tools {
+		if err := h.tenants[name].RegisterNamespace(name, StaticTools{namedTool(tool)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]string{"acme": "acme.rockets,echo_joke", "globex": "echo_joke,globex.doomsday"}
+
+	for _, name := range []string{"acme", "globex", "acme", "globex"} {
+		tenant := h.tenants[name]
+		if got := listedTools(t, tenant, testSession(t, tenant)); got != want[name] {
+			t.Errorf("tools/list for %s = %s, want %s", name, got, want[name])
+		}
+	}
+	if got, want := listedTools(t, h, testSession(t, h)), "echo_joke"; got != want {
+		t.Errorf("tools/list for the default registry = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+)
+
+// =============================================================================
+// Server Capabilities
+// =============================================================================
+
+// Capabilities are what a Handler declares in the initialize result. They
+// are derived from what is registered with it when a session initializes,
+// so they cannot promise a method the Handler would not serve; see
+// Handler.Capabilities.
+type Capabilities struct {
+	// Tools is set when any tool is served, local, namespaced, or from a
+	// gateway upstream. The list may change, so it is declared with
+	// listChanged.
+	Tools bool
+	// Resources is set when a ResourceProvider is registered or a gateway
+	// serves its upstreams' resources, and ResourceSubscribe when one of
+	// the providers is a ResourceWatcher. The list may change as well.
+	Resources         bool
+	ResourceSubscribe bool
+	// Prompts is set when a gateway serves its upstreams' prompts, whose
+	// list changes with theirs.
+	Prompts bool
+	// Experimental holds the entries added with RegisterExperimental.
+	Experimental map[string]interface{}
+}
+
+// ResourceWatcher is a ResourceProvider that reports changes to its
+// resources, such as FileResourceProvider. Registering one makes initialize
+// offer resources/subscribe; Watch is passed the Handler to report to.
+type ResourceWatcher interface {
+	ResourceProvider
+	Watch(ctx context.Context, notify ResourceNotifier, logger *slog.Logger) error
+}
+
+// ResourceNotifier is told about changes to resources. Handler implements
+// it, telling the sessions that asked to know.
+type ResourceNotifier interface {
+	// NotifyResourceUpdated reports that the resource at uri changed.
+	NotifyResourceUpdated(uri string)
+	// NotifyResourcesListChanged reports that resources were added or
+	// removed.
+	NotifyResourcesListChanged()
+}
+
+// Capabilities returns the capabilities of what is registered with h now.
+func (h *Handler) Capabilities() Capabilities {
+	caps := Capabilities{
+		Tools:        len(h.tools) > 0 || h.servesNamespaces() || h.gateway != nil,
+		Resources:    h.servesResources(),
+		Prompts:      h.gateway != nil,
+		Experimental: h.experimentalCapabilities(),
+	}
+	for _, p := range h.localResourceProviders() {
+		if _, ok := p.(ResourceWatcher); ok {
+			caps.ResourceSubscribe = true
+		}
+	}
+	return caps
+}
+
+// sessionCapabilities returns h's capabilities with those that depend on
+// the session's transport.
+func (h *Handler) sessionCapabilities(sess *Session) Capabilities {
+	caps := h.Capabilities()
+	if sess.offersAcks() {
+		caps.Experimental[ackCapability] = map[string]interface{}{}
+	}
+	return caps
+}
+
+// Map returns c as the capabilities member of an initialize result.
+func (c Capabilities) Map() map[string]interface{} {
+	m := make(map[string]interface{})
+	if c.Tools {
+		m["tools"] = map[string]interface{}{"listChanged": true}
+	}
+	if c.Resources {
+		m["resources"] = map[string]interface{}{"subscribe": c.ResourceSubscribe, "listChanged": true}
+	}
+	if c.Prompts {
+		m["prompts"] = map[string]interface{}{"listChanged": true}
+	}
+	if len(c.Experimental) > 0 {
+		m["experimental"] = c.Experimental
+	}
+	return m
+}
+
+// declaresListChanged reports whether the session was told at initialize
+// that the list of capability ("tools", "resources", or "prompts") may
+// change, and so wants notifications/<capability>/list_changed.
+func (s *Session) declaresListChanged(capability string) bool {
+	options, _ := s.ServerCapabilities()[capability].(map[string]interface{})
+	listChanged, _ := options["listChanged"].(bool)
+	return listChanged
+}
+
+// relayListChanged passes on an upstream's list_changed notification to
+// the sessions of h, whose lists include the upstream's.
+func (h *Handler) relayListChanged(method string) {
+	switch method {
+	case "notifications/tools/list_changed":
+		h.NotifyToolsListChanged()
+	case "notifications/resources/list_changed":
+		h.NotifyResourcesListChanged()
+	case "notifications/prompts/list_changed":
+		h.NotifyPromptsListChanged()
+	}
+}
+
+// servesNamespaces reports whether any namespace has a provider.
+func (h *Handler) servesNamespaces() bool {
+	h.namespacesMu.RLock()
+	defer h.namespacesMu.RUnlock()
+	for _, ns := range h.namespaces {
+		if ns.provider != nil {
+			return true
+		}
+	}
+	return false
+}
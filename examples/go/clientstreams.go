@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+
+	"github.com/quic-go/webtransport-go"
+)
+
+// =============================================================================
+// Client Streams
+// =============================================================================
+
+// A WebTransport session's first bidirectional stream is its control
+// stream. Streams the client opens after it count, with the control stream,
+// against maxConcurrentStreams, the limit initialize advertises; one past
+// the limit is reset with streamLimitCode. No mode that reads client
+// streams besides the control stream exists yet, so the rest are reset
+// with streamRefusedCode, rather than left waiting in the session's accept
+// queue, holding the client's stream credit.
+const (
+	// streamRefusedCode resets a client stream the session has no use for.
+	streamRefusedCode webtransport.StreamErrorCode = 2
+	// streamLimitCode resets a client stream opened while
+	// maxConcurrentStreams of them were already open.
+	streamLimitCode webtransport.StreamErrorCode = 3
+)
+
+// acceptClientStreams resets the streams the client opens after the
+// control stream until the session ends.
+func (s *Session) acceptClientStreams(ctx context.Context, wt *webtransport.Session) {
+	go func() {
+		for {
+			str, err := wt.AcceptStream(ctx)
+			if err != nil {
+				return
+			}
+			code := s.refuseClientStream()
+			str.CancelRead(code)
+			str.CancelWrite(code)
+		}
+	}()
+	go func() {
+		for {
+			str, err := wt.AcceptUniStream(ctx)
+			if err != nil {
+				return
+			}
+			str.CancelRead(s.refuseClientStream())
+		}
+	}()
+}
+
+// openClientStream counts a stream the client opened, and reports whether
+// it fits under maxConcurrentStreams.
+func (s *Session) openClientStream() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clientStreams >= maxConcurrentStreams {
+		return false
+	}
+	s.clientStreams++
+	return true
+}
+
+// clientStreamDone releases a stream openClientStream counted.
+func (s *Session) clientStreamDone() {
+	s.mu.Lock()
+	s.clientStreams--
+	s.mu.Unlock()
+}
+
+// refuseClientStream returns the code a client stream after the control
+// stream is reset with, and counts it.
+func (s *Session) refuseClientStream() webtransport.StreamErrorCode {
+	if !s.openClientStream() {
+		s.logger.Debug("client stream over the limit, resetting", "limit", maxConcurrentStreams)
+		s.handler.metrics.ObserveStreamRefused(streamRefusedLimit)
+		return streamLimitCode
+	}
+	s.clientStreamDone()
+	s.handler.metrics.ObserveStreamRefused(streamRefusedUnused)
+	return streamRefusedCode
+}
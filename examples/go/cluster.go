@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Cluster Broadcast
+// =============================================================================
+
+// Instances behind a load balancer each hold their own clients' sessions,
+// so a notification sent on one reaches only the clients connected to it.
+// With Config.ClusterBus set, Server.Broadcast, Handler.Broadcast, and the
+// list_changed notifications sent by NotifyToolsListChanged and its
+// siblings are also published on the bus under ClusterChannel, and every
+// other instance subscribed to it delivers them to its own sessions. A
+// tools list_changed also drops the receiving instance's cached tool
+// results, as it does locally.
+//
+// Instances that watch the same change, such as a shared -tools-dir,
+// each notify their clients and publish; a list_changed received within
+// clusterCoalesce of one sent locally for the same capability and tenant
+// is not delivered again. Messages are published in order from one
+// goroutine, with one retry: clients that miss one still see the change on
+// their next list. mcpflow_cluster_messages_total counts
+// messages by outcome.
+
+const (
+	defaultClusterChannel = "mcpflow.cluster"
+	clusterQueueSize      = 256
+	// clusterPublishTimeout bounds each publish.
+	clusterPublishTimeout = 5 * time.Second
+	// clusterCoalesce is how long after sending a list_changed locally an
+	// instance ignores the same one from other instances.
+	clusterCoalesce = time.Second
+	// clusterBackoff is the wait before resubscribing after the bus
+	// connection fails; it doubles with each failure in a row, up to
+	// clusterMaxBackoff.
+	clusterBackoff    = time.Second
+	clusterMaxBackoff = 30 * time.Second
+)
+
+// Outcomes of a cluster message, for ObserveClusterMessage.
+const (
+	clusterPublished = "published"
+	clusterFailed    = "failed"
+	clusterDropped   = "dropped"
+	clusterReceived  = "received"
+	clusterInvalid   = "invalid"
+)
+
+// Kinds of cluster message.
+const (
+	clusterNotification = "notification"
+	clusterListChanged  = "list_changed"
+)
+
+// ClusterBus is a publish/subscribe channel shared by the instances of a
+// cluster.
+type ClusterBus interface {
+	// Publish sends msg to every subscriber of channel, including the
+	// publisher's own. It is only called from one goroutine at a time.
+	Publish(ctx context.Context, channel string, msg []byte) error
+	// Subscribe calls handle with each message published to channel until
+	// ctx is done, returning ctx's error, or the subscription fails. It
+	// uses its own connection.
+	Subscribe(ctx context.Context, channel string, handle func(msg []byte)) error
+	// Close releases the publishing connection.
+	Close() error
+}
+
+// NewClusterBus returns the ClusterBus for a URL:
+// redis[s]://[[user]:password@]host:6379 for Redis pub/sub, or
+// nats://[user:password@]host:4222, or nats://token@host:4222, for NATS.
+func NewClusterBus(rawURL string) (ClusterBus, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("cluster url: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("cluster url %q: want redis://host:port or nats://host:port", rawURL)
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		conn, err := newRedisConn(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		return &redisBus{pub: conn}, nil
+	case "nats":
+		pub, err := newNATSPublisher(u)
+		if err != nil {
+			return nil, err
+		}
+		return &natsBus{pub: pub}, nil
+	}
+	return nil, fmt.Errorf("cluster url %q: unsupported scheme %q", rawURL, u.Scheme)
+}
+
+// clusterMessage is what instances exchange over the bus.
+type clusterMessage struct {
+	// Origin identifies the sending instance, which ignores its own
+	// messages.
+	Origin string `json:"origin"`
+	// Tenant names the Handler whose sessions the message is for, "" for
+	// the default registry, unless All sends it to every Handler.
+	Tenant string `json:"tenant,omitempty"`
+	All    bool   `json:"all,omitempty"`
+	Kind   string `json:"kind"`
+	// Method and Params are a notification's; Capability is what a
+	// list_changed is about.
+	Method     string                 `json:"method,omitempty"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	Capability string                 `json:"capability,omitempty"`
+}
+
+// cluster publishes this instance's broadcasts. Every tenant's Handler
+// shares the root's.
+type cluster struct {
+	bus     ClusterBus
+	channel string
+	origin  string
+	metrics *Metrics
+	logger  *slog.Logger
+
+	mu     sync.RWMutex
+	queue  chan []byte
+	closed bool
+	done   chan struct{}
+
+	// sent records when each tenant last sent a list_changed of each
+	// capability locally, keyed "<tenant>/<capability>".
+	sentMu sync.Mutex
+	sent   map[string]time.Time
+}
+
+func newCluster(cfg Config, metrics *Metrics) *cluster {
+	if cfg.ClusterBus == nil {
+		return nil
+	}
+	channel := cfg.ClusterChannel
+	if channel == "" {
+		channel = defaultClusterChannel
+	}
+	c := &cluster{
+		bus:     cfg.ClusterBus,
+		channel: channel,
+		origin:  newCorrelationID(),
+		metrics: metrics,
+		logger:  slog.Default().With("component", "cluster"),
+		queue:   make(chan []byte, clusterQueueSize),
+		done:    make(chan struct{}),
+		sent:    make(map[string]time.Time),
+	}
+	go c.run()
+	return c
+}
+
+// publish queues msg for the other instances, or drops it if the queue is
+// full or closed.
+func (c *cluster) publish(msg clusterMessage) {
+	msg.Origin = c.origin
+	data, err := json.Marshal(msg)
+	if err != nil {
+		c.logger.Warn("cluster message not encodable", "kind", msg.Kind, "method", msg.Method, "error", err)
+		c.metrics.ObserveClusterMessage(clusterFailed)
+		return
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.closed {
+		select {
+		case c.queue <- data:
+			return
+		default:
+		}
+	}
+	c.metrics.ObserveClusterMessage(clusterDropped)
+}
+
+func (c *cluster) run() {
+	defer close(c.done)
+	for data := range c.queue {
+		if err := c.send(data); err != nil {
+			c.logger.Warn("cluster publish failed", "error", err)
+			c.metrics.ObserveClusterMessage(clusterFailed)
+			continue
+		}
+		c.metrics.ObserveClusterMessage(clusterPublished)
+	}
+}
+
+// send publishes data, trying once more on a failure, which a bus with a
+// broken connection answers by reconnecting.
+func (c *cluster) send(data []byte) error {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), clusterPublishTimeout)
+		err := c.bus.Publish(ctx, c.channel, data)
+		cancel()
+		if err == nil || attempt == 1 {
+			return err
+		}
+	}
+}
+
+// close stops queueing messages, waits until the queued ones are
+// published or ctx expires, and closes the bus. It is a ShutdownHook.
+func (c *cluster) close(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.bus.Close()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sentListChanged records that tenant sent a list_changed of capability
+// locally.
+func (c *cluster) sentListChanged(tenant, capability string) {
+	c.sentMu.Lock()
+	defer c.sentMu.Unlock()
+	now := time.Now()
+	for key, at := range c.sent {
+		if now.Sub(at) > clusterCoalesce {
+			delete(c.sent, key)
+		}
+	}
+	c.sent[tenant+"/"+capability] = now
+}
+
+// recentlySent reports whether tenant sent a list_changed of capability
+// locally within clusterCoalesce.
+func (c *cluster) recentlySent(tenant, capability string) bool {
+	c.sentMu.Lock()
+	defer c.sentMu.Unlock()
+	at, ok := c.sent[tenant+"/"+capability]
+	return ok && time.Since(at) <= clusterCoalesce
+}
+
+// Broadcast sends a notification to every initialized session of h, on
+// this instance and, with a ClusterBus, on every other.
+func (h *Handler) Broadcast(method string, params map[string]interface{}) {
+	h.deliverNotification(method, params)
+	if h.cluster != nil {
+		h.cluster.publish(clusterMessage{Tenant: h.tenant.name, Kind: clusterNotification, Method: method, Params: params})
+	}
+}
+
+// Broadcast sends a notification to every initialized session of every
+// tenant, on this instance and, with a ClusterBus, on every other.
+func (s *Server) Broadcast(method string, params map[string]interface{}) {
+	for _, h := range s.handler.all() {
+		h.deliverNotification(method, params)
+	}
+	if s.handler.cluster != nil {
+		s.handler.cluster.publish(clusterMessage{All: true, Kind: clusterNotification, Method: method, Params: params})
+	}
+}
+
+// all returns h and its tenants' Handlers.
+func (h *Handler) all() []*Handler {
+	handlers := []*Handler{h}
+	for _, t := range h.tenants {
+		handlers = append(handlers, t)
+	}
+	return handlers
+}
+
+// deliverNotification sends a notification to every initialized session
+// of h on this instance.
+func (h *Handler) deliverNotification(method string, params map[string]interface{}) {
+	h.sessionsMu.Lock()
+	sessions := make([]*Session, 0, len(h.sessions))
+	for sess := range h.sessions {
+		sessions = append(sessions, sess)
+	}
+	h.sessionsMu.Unlock()
+
+	for _, sess := range sessions {
+		if err := sess.Notify(method, params); err != nil {
+			sess.logger.Debug("notification not delivered", "method", method, "error", err)
+		}
+	}
+}
+
+// runCluster delivers the other instances' broadcasts to this instance's
+// sessions until ctx is done, resubscribing with backoff when the bus
+// connection fails.
+func (s *Server) runCluster(ctx context.Context) {
+	c := s.handler.cluster
+	backoff := clusterBackoff
+	for {
+		subscribed := time.Now()
+		err := c.bus.Subscribe(ctx, c.channel, func(data []byte) { s.receiveCluster(data) })
+		if ctx.Err() != nil {
+			return
+		}
+		// A subscription that lasted a while was healthy; start over.
+		if time.Since(subscribed) > clusterMaxBackoff {
+			backoff = clusterBackoff
+		}
+		c.logger.Warn("cluster subscription failed", "error", err, "retry_in", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, clusterMaxBackoff)
+	}
+}
+
+// receiveCluster delivers a message from the bus.
+func (s *Server) receiveCluster(data []byte) {
+	c := s.handler.cluster
+	var msg clusterMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.logger.Debug("invalid cluster message", "error", err)
+		c.metrics.ObserveClusterMessage(clusterInvalid)
+		return
+	}
+	if msg.Origin == c.origin {
+		return
+	}
+	c.metrics.ObserveClusterMessage(clusterReceived)
+
+	var handlers []*Handler
+	switch {
+	case msg.All:
+		handlers = s.handler.all()
+	case msg.Tenant == "":
+		handlers = []*Handler{s.handler}
+	case s.handler.tenants[msg.Tenant] != nil:
+		handlers = []*Handler{s.handler.tenants[msg.Tenant]}
+	}
+	for _, h := range handlers {
+		switch msg.Kind {
+		case clusterNotification:
+			h.deliverNotification(msg.Method, msg.Params)
+		case clusterListChanged:
+			if msg.Capability == "tools" {
+				h.toolCache.InvalidateAll()
+			}
+			h.cache.invalidate(msg.Capability)
+			if !c.recentlySent(h.tenant.name, msg.Capability) {
+				h.deliverListChanged(msg.Capability)
+			}
+		}
+	}
+}
+
+// =============================================================================
+// Redis Bus
+// =============================================================================
+
+// redisBus publishes with PUBLISH on a shared connection and subscribes
+// with SUBSCRIBE on a connection of its own, as Redis requires.
+type redisBus struct {
+	pub *redisConn
+}
+
+// Publish implements ClusterBus.
+func (b *redisBus) Publish(ctx context.Context, channel string, msg []byte) error {
+	_, err := b.pub.do("PUBLISH", channel, string(msg))
+	return err
+}
+
+// Subscribe implements ClusterBus.
+func (b *redisBus) Subscribe(ctx context.Context, channel string, handle func(msg []byte)) error {
+	// Channels are shared by every database, so there is nothing to SELECT.
+	c := b.pub.clone()
+	c.db = 0
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.dialLocked(ctx); err != nil {
+		return err
+	}
+	conn := c.conn
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if _, err := c.exchangeLocked(ctx, [][]string{{"SUBSCRIBE", channel}}); err != nil {
+		return err
+	}
+	for {
+		reply, err := readRESP(c.r)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		// A message arrives as ["message", channel, payload].
+		if items, ok := reply.([]interface{}); ok && len(items) == 3 {
+			if kind, _ := items[0].([]byte); string(kind) == "message" {
+				payload, _ := items[2].([]byte)
+				handle(payload)
+			}
+		}
+	}
+}
+
+// Close implements ClusterBus.
+func (b *redisBus) Close() error {
+	b.pub.mu.Lock()
+	defer b.pub.mu.Unlock()
+	if b.pub.conn == nil {
+		return nil
+	}
+	err := b.pub.conn.Close()
+	b.pub.conn = nil
+	return err
+}
+
+// =============================================================================
+// NATS Bus
+// =============================================================================
+
+// natsBus publishes through a natsPublisher and subscribes with SUB on a
+// connection of its own.
+type natsBus struct {
+	pub *natsPublisher
+}
+
+// Publish implements ClusterBus.
+func (b *natsBus) Publish(ctx context.Context, channel string, msg []byte) error {
+	return b.pub.Publish(ctx, channel, "", msg)
+}
+
+// Subscribe implements ClusterBus.
+func (b *natsBus) Subscribe(ctx context.Context, channel string, handle func(msg []byte)) error {
+	if strings.ContainsAny(channel, " \t\r\n") {
+		return fmt.Errorf("nats: invalid subject %q", channel)
+	}
+	p := &natsPublisher{addr: b.pub.addr, user: b.pub.user, password: b.pub.password, token: b.pub.token}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.dialLocked(); err != nil {
+		return err
+	}
+	conn := p.conn
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := p.exchangeLocked(ctx, []byte("SUB "+channel+" 1\r\nPING\r\n")); err != nil {
+		return err
+	}
+	for {
+		line, err := p.r.ReadString('\n')
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			if _, err := io.WriteString(conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || n < 0 {
+				return fmt.Errorf("nats: malformed %q", line)
+			}
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(p.r, payload); err != nil {
+				return err
+			}
+			handle(payload[:n])
+		case strings.HasPrefix(line, "-ERR"):
+			return natsError(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+	}
+}
+
+// Close implements ClusterBus.
+func (b *natsBus) Close() error {
+	return b.pub.Close()
+}
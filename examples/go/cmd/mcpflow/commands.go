@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+)
+
+// =============================================================================
+// Client Commands
+// =============================================================================
+
+// Each client command connects, makes its requests, prints the result as
+// JSON on stdout, and fails with a non-zero exit status on any error, so
+// the output can be piped straight into jq.
+
+// clientCommand is the setup the client commands share: the connection
+// flags and, once parsed, the positional arguments and stdio command.
+type clientCommand struct {
+	fs      *flag.FlagSet
+	conn    *connFlags
+	timeout *time.Duration
+	args    []string
+	command []string
+}
+
+func newClientCommand(name, usage string) *clientCommand {
+	fs := flag.NewFlagSet("mcpflow "+name, flag.ExitOnError)
+	cmd := &clientCommand{
+		fs:      fs,
+		conn:    addConnFlags(fs),
+		timeout: fs.Duration("timeout", 30*time.Second, "Timeout for the whole command"),
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: mcpflow %s [flags] [-- stdio server command]\n", strings.TrimSpace(name+" "+usage))
+		fs.PrintDefaults()
+	}
+	return cmd
+}
+
+// parse parses args and checks that exactly nargs positional arguments
+// were given.
+func (cmd *clientCommand) parse(args []string, nargs int) error {
+	cmd.args, cmd.command = parseArgs(cmd.fs, args)
+	if len(cmd.args) != nargs {
+		cmd.fs.Usage()
+		return fmt.Errorf("want %d argument(s), got %d", nargs, len(cmd.args))
+	}
+	return nil
+}
+
+// run connects and calls fn with the client.
+func (cmd *clientCommand) run(fn func(ctx context.Context, c *mcpflowclient.Client) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *cmd.timeout)
+	defer cancel()
+	c, err := cmd.conn.connect(ctx, cmd.command)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return fn(ctx, c)
+}
+
+// initCommand runs "mcpflow init": it performs the initialize handshake and
+// prints the server's initialize result.
+func initCommand(args []string, stdout io.Writer) error {
+	cmd := newClientCommand("init", "")
+	if err := cmd.parse(args, 0); err != nil {
+		return err
+	}
+	return cmd.run(func(ctx context.Context, c *mcpflowclient.Client) error {
+		return printJSON(stdout, c.InitializeResult())
+	})
+}
+
+// pingCommand runs "mcpflow ping" and prints the round trip time.
+func pingCommand(args []string, stdout io.Writer) error {
+	cmd := newClientCommand("ping", "")
+	if err := cmd.parse(args, 0); err != nil {
+		return err
+	}
+	return cmd.run(func(ctx context.Context, c *mcpflowclient.Client) error {
+		start := time.Now()
+		if err := c.Call(ctx, "ping", nil, nil); err != nil {
+			return fmt.Errorf("ping: %w", err)
+		}
+		rtt := time.Since(start)
+		return printJSON(stdout, map[string]interface{}{
+			"transport": c.Transport(),
+			"rttMs":     float64(rtt.Microseconds()) / 1000,
+		})
+	})
+}
+
+// toolsCommand runs "mcpflow tools list" and "mcpflow tools call".
+func toolsCommand(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usageError("tools list|call")
+	}
+	switch args[0] {
+	case "list":
+		cmd := newClientCommand("tools list", "")
+		if err := cmd.parse(args[1:], 0); err != nil {
+			return err
+		}
+		return cmd.run(func(ctx context.Context, c *mcpflowclient.Client) error {
+			tools, err := listAll(ctx, c, "tools/list", "tools")
+			if err != nil {
+				return fmt.Errorf("tools/list: %w", err)
+			}
+			return printJSON(stdout, map[string]interface{}{"tools": tools})
+		})
+	case "call":
+		cmd := newClientCommand("tools call", "NAME")
+		argsJSON := cmd.fs.String("args", "{}", `Tool arguments as a JSON object, or "-" to read them from stdin`)
+		if err := cmd.parse(args[1:], 1); err != nil {
+			return err
+		}
+		name := cmd.args[0]
+		arguments, err := readArgs(*argsJSON)
+		if err != nil {
+			return err
+		}
+		return cmd.run(func(ctx context.Context, c *mcpflowclient.Client) error {
+			var result struct {
+				IsError bool `json:"isError"`
+			}
+			var raw json.RawMessage
+			params := map[string]interface{}{"name": name, "arguments": arguments}
+			if err := c.Call(ctx, "tools/call", params, &raw); err != nil {
+				return fmt.Errorf("tools/call %s: %w", name, err)
+			}
+			if err := printJSON(stdout, raw); err != nil {
+				return err
+			}
+			if json.Unmarshal(raw, &result) == nil && result.IsError {
+				return fmt.Errorf("tool %s reported an error", name)
+			}
+			return nil
+		})
+	}
+	return usageError("tools list|call")
+}
+
+// resourcesCommand runs "mcpflow resources list" and "mcpflow resources
+// read".
+func resourcesCommand(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return usageError("resources list|read")
+	}
+	switch args[0] {
+	case "list":
+		cmd := newClientCommand("resources list", "")
+		if err := cmd.parse(args[1:], 0); err != nil {
+			return err
+		}
+		return cmd.run(func(ctx context.Context, c *mcpflowclient.Client) error {
+			resources, err := listAll(ctx, c, "resources/list", "resources")
+			if err != nil {
+				return fmt.Errorf("resources/list: %w", err)
+			}
+			return printJSON(stdout, map[string]interface{}{"resources": resources})
+		})
+	case "read":
+		cmd := newClientCommand("resources read", "URI")
+		if err := cmd.parse(args[1:], 1); err != nil {
+			return err
+		}
+		uri := cmd.args[0]
+		return cmd.run(func(ctx context.Context, c *mcpflowclient.Client) error {
+			var raw json.RawMessage
+			if err := c.Call(ctx, "resources/read", map[string]interface{}{"uri": uri}, &raw); err != nil {
+				return fmt.Errorf("resources/read %s: %w", uri, err)
+			}
+			return printJSON(stdout, raw)
+		})
+	}
+	return usageError("resources list|read")
+}
+
+// listAll fetches every page of a paginated list method and returns the
+// items under key.
+func listAll(ctx context.Context, c *mcpflowclient.Client, method, key string) ([]json.RawMessage, error) {
+	var items []json.RawMessage
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page map[string]json.RawMessage
+		if err := c.Call(ctx, method, params, &page); err != nil {
+			return nil, err
+		}
+		var pageItems []json.RawMessage
+		if err := json.Unmarshal(page[key], &pageItems); err != nil && page[key] != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		items = append(items, pageItems...)
+		cursor = ""
+		if next, ok := page["nextCursor"]; ok {
+			json.Unmarshal(next, &cursor)
+		}
+		if cursor == "" {
+			if items == nil {
+				items = []json.RawMessage{}
+			}
+			return items, nil
+		}
+	}
+}
+
+// readArgs checks -args, reading stdin for "-". Arguments must be a JSON
+// object; they are passed on verbatim, so large numbers keep their
+// precision.
+func readArgs(s string) (json.RawMessage, error) {
+	data := []byte(s)
+	if s == "-" {
+		var err error
+		if data, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, err
+		}
+	}
+	var arguments map[string]json.RawMessage
+	if err := json.Unmarshal(data, &arguments); err != nil || arguments == nil {
+		return nil, fmt.Errorf("-args: want a JSON object, got %s", strings.TrimSpace(string(data)))
+	}
+	return json.RawMessage(data), nil
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(stdout io.Writer, v interface{}) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func usageError(subcommands string) error {
+	return fmt.Errorf("usage: mcpflow %s [flags]", subcommands)
+}
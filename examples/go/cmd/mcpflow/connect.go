@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Connecting
+// =============================================================================
+
+// connFlags are the flags every command that talks to a server shares.
+// Arguments after "--" name a stdio server to run instead.
+type connFlags struct {
+	addr           *string
+	tcpAddr        *string
+	wsURL          *string
+	httpURL        *string
+	service        *string
+	mdns           *bool
+	token          *string
+	insecure       *bool
+	postQuantum    *bool
+	echConfig      *string
+	attemptTimeout *time.Duration
+	transports     *string
+	race           *bool
+	verbose        *bool
+
+	// onNotification, when set, receives the server's notifications.
+	onNotification func(method string, params json.RawMessage)
+}
+
+func addConnFlags(fs *flag.FlagSet) *connFlags {
+	return &connFlags{
+		addr:           fs.String("addr", "", "Server WebTransport address, e.g. localhost:4433"),
+		tcpAddr:        fs.String("tcp-addr", "", "TCP+TLS address, e.g. localhost:4434"),
+		wsURL:          fs.String("ws-url", "", "WebSocket URL, e.g. wss://localhost:4435/mcp-flow-ws"),
+		httpURL:        fs.String("http-url", "", "Streamable HTTP URL, e.g. https://localhost:4435/mcp"),
+		service:        fs.String("srv", "", "Discover servers from the _mcpflow._udp and _mcpflow._tcp SRV records of this domain"),
+		mdns:           fs.Bool("mdns", false, "Connect to the first server advertised on the local network over mDNS (replaces -addr and -tcp-addr)"),
+		token:          fs.String("token", os.Getenv("MCPFLOW_TOKEN"), "Bearer token sent to the server (default $MCPFLOW_TOKEN)"),
+		insecure:       fs.Bool("insecure", false, "Skip TLS verification (for self-signed certs)"),
+		postQuantum:    fs.Bool("pq", false, "Allow only hybrid X25519+ML-KEM TLS key exchange (needs Go 1.24)"),
+		echConfig:      fs.String("ech-config", "", "Encrypt the ClientHello to this base64 ECHConfigList, as printed by mcpflow gen ech-key"),
+		attemptTimeout: fs.Duration("attempt-timeout", 5*time.Second, "Timeout for each transport attempt, including initialize"),
+		transports:     fs.String("transports", strings.Join(mcpflowclient.DefaultOrder, ","), "Transport fallback order; entries without an address are skipped"),
+		race:           fs.Bool("race", false, "Race transports happy-eyeballs style instead of trying them one at a time"),
+		verbose:        fs.Bool("v", false, "Log connection attempts to stderr"),
+	}
+}
+
+// connect dials the server the flags describe, or runs command as a stdio
+// server when it is non-empty.
+func (f *connFlags) connect(ctx context.Context, command []string) (*mcpflowclient.Client, error) {
+	var order []string
+	for _, name := range strings.Split(*f.transports, ",") {
+		order = append(order, strings.TrimSpace(name))
+	}
+	echConfig, err := base64.StdEncoding.DecodeString(*f.echConfig)
+	if err != nil {
+		return nil, fmt.Errorf("-ech-config: %w", err)
+	}
+	opts := mcpflowclient.Options{
+		Addr:           *f.addr,
+		TCPAddr:        *f.tcpAddr,
+		WebSocketURL:   *f.wsURL,
+		HTTPURL:        *f.httpURL,
+		Service:        *f.service,
+		Command:        command,
+		Token:          *f.token,
+		TLSConfig:      &tls.Config{InsecureSkipVerify: *f.insecure},
+		PostQuantum:    *f.postQuantum,
+		ECHConfigList:  echConfig,
+		AttemptTimeout: *f.attemptTimeout,
+		Order:          order,
+		Race:           *f.race,
+		OnNotification: f.onNotification,
+		InitializeParams: map[string]interface{}{
+			"protocolVersion": latestProtocolVersion,
+			"clientInfo":      map[string]interface{}{"name": "mcpflow", "version": version},
+		},
+	}
+	if *f.verbose {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
+	if len(command) > 0 {
+		opts.Stderr = os.Stderr
+	}
+
+	if *f.mdns {
+		discoverCtx, cancel := context.WithTimeout(ctx, mcpflowclient.DefaultDiscoverTimeout)
+		servers, err := mcpflowclient.Discover(discoverCtx)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("mdns: %w", err)
+		}
+		if len(servers) == 0 {
+			return nil, errors.New("mdns: no server found")
+		}
+		opts.Addr, opts.TCPAddr = servers[0].Addr, servers[0].TCPAddr
+	}
+
+	if len(command) == 0 && opts.Addr == "" && opts.TCPAddr == "" && opts.WebSocketURL == "" && opts.HTTPURL == "" && opts.Service == "" {
+		return nil, errors.New("no server: set -addr, -tcp-addr, -ws-url, -http-url, -srv, or -mdns, or name a stdio server command after --")
+	}
+	return mcpflowclient.Connect(ctx, opts)
+}
+
+// endpoint describes the server the flags name, for messages and generated
+// comments.
+func (f *connFlags) endpoint(command []string) string {
+	if len(command) > 0 {
+		return "the stdio server " + strings.Join(command, " ")
+	}
+	if *f.mdns {
+		return "the server found over mDNS"
+	}
+	return "the server at " + firstNonEmpty(*f.addr, *f.tcpAddr, *f.wsURL, *f.httpURL, *f.service)
+}
+
+// parseArgs parses flags interleaved with positional arguments, so both
+// "tools call -addr x search" and "tools call search -addr x" work.
+// Everything after "--" is returned as command.
+func parseArgs(fs *flag.FlagSet, args []string) (positional, command []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			args, command = args[:i], args[i+1:]
+			break
+		}
+	}
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional, command
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// describeError formats an RPC failure with the hints carried in error.data.
+func describeError(err error) string {
+	msg := err.Error()
+	var rpcErr *mcpflowerr.Error
+	if errors.As(err, &rpcErr) {
+		msg = fmt.Sprintf("rpc error %d (%s): %s", rpcErr.Code, mcpflowerr.NameOf(rpcErr.Code), msg)
+	}
+	data := mcpflowerr.DataOf(err)
+	if data == nil {
+		return msg
+	}
+	if d := data.RetryAfterDuration(); d > 0 {
+		msg += fmt.Sprintf(" (retry after %s)", d)
+	}
+	for _, o := range data.Offenders {
+		msg += fmt.Sprintf("\n  %s: %s", o.Path, o.Message)
+	}
+	if data.DocsURL != "" {
+		msg += "\n  see " + data.DocsURL
+	}
+	if data.CorrelationID != "" {
+		msg += "\n  correlation id " + data.CorrelationID
+	}
+	return msg
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/term"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Doctor
+// =============================================================================
+
+// doctorCommand runs "mcpflow doctor": it checks each layer between the
+// client and a server in turn, from DNS up to the initialize handshake, and
+// says what to fix for any that fail. Checks that depend on a failed one
+// are skipped rather than reported as more failures.
+func doctorCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcpflow doctor", flag.ExitOnError)
+	addr := fs.String("addr", "", "Server WebTransport address, e.g. localhost:4433 (or give it as an argument)")
+	tcpAddr := fs.String("tcp-addr", "", "Also check the TCP+TLS listener at this address")
+	token := fs.String("token", os.Getenv("MCPFLOW_TOKEN"), "Bearer token sent to the server (default $MCPFLOW_TOKEN)")
+	caFile := fs.String("ca", "", "PEM file of CA certificates to verify the server with instead of the system roots")
+	insecure := fs.Bool("insecure", false, "Accept a certificate that does not verify (for self-signed certs); it is still reported")
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout for each check")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mcpflow doctor [flags] [HOST:PORT]")
+		fs.PrintDefaults()
+	}
+	positional, _ := parseArgs(fs, args)
+	switch {
+	case len(positional) == 1 && *addr == "":
+		*addr = positional[0]
+	case len(positional) > 0:
+		fs.Usage()
+		return fmt.Errorf("want at most 1 argument, got %d", len(positional))
+	}
+	if *addr == "" {
+		fs.Usage()
+		return errors.New("no server: give its WebTransport address as an argument or with -addr")
+	}
+	host, port, err := net.SplitHostPort(*addr)
+	if err != nil {
+		return fmt.Errorf("address %q: %w", *addr, err)
+	}
+
+	d := &doctor{
+		out:      stdout,
+		color:    term.IsTerminal(int(os.Stdout.Fd())),
+		addr:     *addr,
+		host:     host,
+		port:     port,
+		tcpAddr:  *tcpAddr,
+		token:    *token,
+		insecure: *insecure,
+		timeout:  *timeout,
+	}
+	if *caFile != "" {
+		pem, err := os.ReadFile(*caFile)
+		if err != nil {
+			return fmt.Errorf("-ca: %w", err)
+		}
+		d.roots = x509.NewCertPool()
+		if !d.roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("-ca: no certificates in %s", *caFile)
+		}
+	}
+	return d.run()
+}
+
+// checkStatus is the outcome of one check.
+type checkStatus int
+
+const (
+	checkOK checkStatus = iota
+	checkWarn
+	checkFail
+	checkSkip
+)
+
+// doctor runs the checks against one server and tallies the results.
+type doctor struct {
+	out   io.Writer
+	color bool
+
+	addr, host, port string
+	tcpAddr          string
+	token            string
+	roots            *x509.CertPool
+	insecure         bool
+	timeout          time.Duration
+
+	failed, warned int
+}
+
+func (d *doctor) run() error {
+	fmt.Fprintf(d.out, "mcpflow doctor %s\n\n", d.addr)
+
+	if !d.checkDNS() {
+		d.skip("the address does not resolve", "udp", "quic", "certificate", "alpn", "clock", "mtu", "datagrams", "initialize")
+	} else if versions, ok := d.checkUDP(); !ok {
+		d.skip("no reply over UDP", "quic", "certificate", "alpn", "clock", "mtu", "datagrams", "initialize")
+	} else if conn := d.checkQUIC(versions); conn == nil {
+		d.skip("no QUIC connection", "certificate", "alpn", "clock", "mtu", "datagrams", "initialize")
+	} else {
+		state := conn.ConnectionState()
+		d.checkCertificate(state.TLS)
+		d.checkALPN(state.TLS.NegotiatedProtocol, "h3", "-addr")
+		d.checkClock()
+		pathMax := d.checkMTU()
+		d.checkDatagrams(conn, pathMax)
+		conn.CloseWithError(0, "")
+		d.checkInitialize(mcpflowclient.TransportWebTransport)
+	}
+	if d.tcpAddr != "" {
+		if d.checkTCP() {
+			d.checkInitialize(mcpflowclient.TransportTCP)
+		} else {
+			d.skip("no TCP+TLS connection", "initialize")
+		}
+	}
+
+	fmt.Fprintln(d.out)
+	switch {
+	case d.failed > 0:
+		return fmt.Errorf("%d check(s) failed", d.failed)
+	case d.warned > 0:
+		fmt.Fprintf(d.out, "All checks passed with %d warning(s).\n", d.warned)
+	default:
+		fmt.Fprintln(d.out, "All checks passed.")
+	}
+	return nil
+}
+
+// report prints one check's outcome and, for warnings and failures, the hint
+// saying what to do about it.
+func (d *doctor) report(name string, status checkStatus, msg, hint string) {
+	mark := map[checkStatus]string{
+		checkOK:   d.style(ansiGreen, "✓"),
+		checkWarn: d.style(ansiYellow, "!"),
+		checkFail: d.style(ansiRed, "✗"),
+		checkSkip: d.style(ansiDim, "-"),
+	}[status]
+	switch status {
+	case checkWarn:
+		d.warned++
+	case checkFail:
+		d.failed++
+	case checkSkip:
+		msg = d.style(ansiDim, msg)
+	}
+	fmt.Fprintf(d.out, "  %s %-16s %s\n", mark, name, msg)
+	if hint != "" {
+		fmt.Fprintf(d.out, "    %-16s → %s\n", "", hint)
+	}
+}
+
+func (d *doctor) skip(reason string, names ...string) {
+	for _, name := range names {
+		d.report(name, checkSkip, "skipped: "+reason, "")
+	}
+}
+
+func (d *doctor) style(code, s string) string {
+	if !d.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// tlsConfig is the client TLS config for the checks after the certificate
+// one: the certificate has been verified, or its failure reported, by then,
+// so verification is skipped to let them look further.
+func (d *doctor) tlsConfig(alpn string) *tls.Config {
+	return &tls.Config{ServerName: d.host, InsecureSkipVerify: true, NextProtos: []string{alpn}}
+}
+
+// =============================================================================
+// Checks
+// =============================================================================
+
+func (d *doctor) checkDNS() bool {
+	if net.ParseIP(d.host) != nil {
+		d.report("dns", checkOK, d.host+" is an IP address", "")
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, d.host)
+	if err != nil {
+		d.report("dns", checkFail, err.Error(), "check the host name, or try the server's IP address")
+		return false
+	}
+	d.report("dns", checkOK, fmt.Sprintf("%s → %s", d.host, strings.Join(addrs, ", ")), "")
+	return true
+}
+
+// checkUDP sends the smallest packet a QUIC server must answer, a
+// Version Negotiation probe, and returns the versions the server offers.
+func (d *doctor) checkUDP() ([]quic.VersionNumber, bool) {
+	conn, err := d.dialUDP()
+	if err != nil {
+		d.report("udp", checkFail, err.Error(), "")
+		return nil, false
+	}
+	defer conn.Close()
+
+	versions, rtt, err := probeVersions(conn, minQUICPacketSize, d.timeout)
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		d.report("udp", checkFail, fmt.Sprintf("nothing is listening on UDP %s", conn.RemoteAddr()),
+			"check the server is running with -addr on this port")
+		return nil, false
+	case err != nil:
+		d.report("udp", checkFail, fmt.Sprintf("no reply from UDP %s: %v", conn.RemoteAddr(), err),
+			fmt.Sprintf("check the server is running, and that firewalls allow UDP port %s; "+
+				"networks that block UDP need the TCP+TLS (-tcp-addr) or WebSocket transport", d.port))
+		return nil, false
+	}
+	d.report("udp", checkOK, fmt.Sprintf("%s answered in %s", conn.RemoteAddr(), formatRTT(rtt)), "")
+	return versions, true
+}
+
+// checkQUIC completes a QUIC handshake and returns the connection, or nil.
+func (d *doctor) checkQUIC(offered []quic.VersionNumber) quic.Connection {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, d.addr, d.tlsConfig("h3"), &quic.Config{EnableDatagrams: true, HandshakeIdleTimeout: d.timeout})
+	if err != nil {
+		var vnErr *quic.VersionNegotiationError
+		var transportErr *quic.TransportError
+		switch {
+		case errors.As(err, &vnErr):
+			d.report("quic", checkFail, fmt.Sprintf("no common version: the server offers %s, this client %s",
+				formatVersions(vnErr.Theirs), formatVersions(vnErr.Ours)), "upgrade whichever side is older")
+		case errors.As(err, &transportErr) && transportErr.ErrorCode == quic.TransportErrorCode(0x100+120):
+			d.report("quic", checkFail, "the server does not speak HTTP/3 (ALPN h3)",
+				"point -addr at the server's WebTransport listener, not another QUIC service")
+		default:
+			d.report("quic", checkFail, err.Error(),
+				"the server answers version negotiation but the handshake failed; "+
+					"if it timed out, the path may drop large UDP packets")
+		}
+		return nil
+	}
+	d.report("quic", checkOK, fmt.Sprintf("negotiated QUIC %s (server offers %s)",
+		formatVersion(conn.ConnectionState().Version), formatVersions(offered)), "")
+	return conn
+}
+
+// checkCertificate verifies the chain the server sent against the system
+// roots or -ca, and the host name, and warns of upcoming expiry.
+func (d *doctor) checkCertificate(state tls.ConnectionState) {
+	certs := state.PeerCertificates
+	if len(certs) == 0 {
+		d.report("certificate", checkFail, "the server sent no certificate", "")
+		return
+	}
+	leaf := certs[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{DNSName: d.host, Roots: d.roots, Intermediates: intermediates})
+
+	subject := leaf.Subject.CommonName
+	if subject == "" && len(leaf.DNSNames) > 0 {
+		subject = leaf.DNSNames[0]
+	}
+	left := time.Until(leaf.NotAfter)
+	desc := fmt.Sprintf("%s, expires %s", subject, leaf.NotAfter.Format("2006-01-02"))
+
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	status := checkFail
+	if d.insecure {
+		status = checkWarn
+	}
+	switch {
+	case errors.As(err, &hostErr) && len(leaf.DNSNames) == 0 && len(leaf.IPAddresses) == 0:
+		d.report("certificate", status, fmt.Sprintf("%s names its host only in the legacy Common Name field", subject),
+			"reissue the certificate with a subjectAltName for "+d.host)
+	case errors.As(err, &hostErr):
+		d.report("certificate", status, fmt.Sprintf("%s is not valid for %s (it names %s)", subject, d.host, certNames(leaf)),
+			"connect using one of the names the certificate lists, or reissue it for this one")
+	case errors.As(err, &authErr):
+		d.report("certificate", status, desc+", signed by an unknown authority",
+			"pass -ca with the issuing CA certificate, or -insecure for a self-signed development certificate")
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		d.report("certificate", status, invalidErr.Error(),
+			"renew the server's certificate; if it looks current, check this machine's clock")
+	case err != nil:
+		d.report("certificate", status, err.Error(), "")
+	case left < 14*24*time.Hour:
+		d.report("certificate", checkWarn, fmt.Sprintf("%s, expires in %s", subject, formatAge(left)),
+			"renew the server's certificate soon")
+	default:
+		d.report("certificate", checkOK, desc, "")
+	}
+}
+
+func (d *doctor) checkALPN(got, want, flagName string) {
+	if got != want {
+		d.report("alpn", checkFail, fmt.Sprintf("negotiated %q, want %q", got, want),
+			fmt.Sprintf("point %s at an MCP-Flow listener", flagName))
+		return
+	}
+	d.report("alpn", checkOK, want, "")
+}
+
+// checkClock compares the server's HTTP Date header, which has a one
+// second resolution, with the local clock. Skew breaks certificate and
+// token validity checks in ways that are hard to tell apart from others.
+func (d *doctor) checkClock() {
+	rt := &http3.RoundTripper{TLSClientConfig: d.tlsConfig("h3")}
+	defer rt.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+d.addr+"/", nil)
+	if err != nil {
+		d.report("clock", checkFail, err.Error(), "")
+		return
+	}
+	start := time.Now()
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		d.report("clock", checkWarn, "could not read the server's time: "+err.Error(), "")
+		return
+	}
+	resp.Body.Close()
+	end := time.Now()
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		d.report("clock", checkWarn, "the server sent no Date header", "")
+		return
+	}
+	local := start.Add(end.Sub(start) / 2).Truncate(time.Second)
+	skew := serverTime.Sub(local)
+	ahead := "ahead of"
+	if skew < 0 {
+		skew, ahead = -skew, "behind"
+	}
+	switch {
+	case skew > 5*time.Minute:
+		d.report("clock", checkFail, fmt.Sprintf("the server's clock is %s %s this one", formatAge(skew), ahead),
+			"enable NTP on whichever machine is wrong; certificates and tokens fail validation")
+	case skew > time.Minute:
+		d.report("clock", checkWarn, fmt.Sprintf("the server's clock is %s %s this one", formatAge(skew), ahead),
+			"enable NTP on whichever machine is wrong")
+	default:
+		d.report("clock", checkOK, "within a minute of the server's", "")
+	}
+}
+
+// mtuProbeSizes are the UDP payload sizes checkMTU tries: the QUIC
+// minimum, then the usual limits of tunnels, IPv6, and IPv4 Ethernet.
+var mtuProbeSizes = []int{minQUICPacketSize, 1280, 1350, 1452, 1472}
+
+// checkMTU sends Version Negotiation probes of increasing size with
+// fragmentation disabled and returns the largest UDP payload that reached
+// the server.
+func (d *doctor) checkMTU() int {
+	conn, err := d.dialUDP()
+	if err != nil {
+		d.report("mtu", checkFail, err.Error(), "")
+		return 0
+	}
+	defer conn.Close()
+	exact := setDontFragment(conn)
+
+	largest := 0
+	for _, size := range mtuProbeSizes {
+		if _, _, err := probeVersions(conn, size, d.timeout/2); err != nil {
+			break
+		}
+		largest = size
+	}
+	note := ""
+	if !exact {
+		note = " (may have been fragmented)"
+	}
+	switch {
+	case largest == 0:
+		d.report("mtu", checkFail, fmt.Sprintf("%d-byte UDP packets no longer reach the server", minQUICPacketSize),
+			"the path MTU is below QUIC's minimum; check VPN or tunnel MTU settings, or use -tcp-addr")
+	case largest == mtuProbeSizes[len(mtuProbeSizes)-1]:
+		d.report("mtu", checkOK, fmt.Sprintf("%d-byte UDP packets reach the server%s", largest, note), "")
+	default:
+		d.report("mtu", checkWarn, fmt.Sprintf("%d-byte UDP packets reach the server, %d-byte ones do not", largest, nextProbeSize(largest)),
+			"a tunnel on the path lowers the MTU; QUIC copes, but with smaller packets")
+	}
+	return largest
+}
+
+// checkDatagrams reports whether the server accepts QUIC DATAGRAM frames
+// and how large. The peer's limit is learned by offering a datagram too
+// large for any peer, which quic-go rejects locally without sending it.
+func (d *doctor) checkDatagrams(conn quic.Connection, pathMax int) {
+	if !conn.ConnectionState().SupportsDatagrams {
+		d.report("datagrams", checkWarn, "the server does not accept QUIC datagrams",
+			"unreliable WebTransport datagrams are unavailable; streams still work")
+		return
+	}
+	var tooLarge *quic.DatagramTooLargeError
+	if err := conn.SendDatagram(make([]byte, 1<<16)); !errors.As(err, &tooLarge) {
+		d.report("datagrams", checkOK, "supported", "")
+		return
+	}
+	msg := fmt.Sprintf("supported, frames up to %d bytes", tooLarge.PeerMaxDatagramFrameSize)
+	if pathMax > 0 && int64(pathMax) < tooLarge.PeerMaxDatagramFrameSize {
+		msg += fmt.Sprintf(", about %d on this path", pathMax-datagramOverhead)
+	}
+	d.report("datagrams", checkOK, msg, "")
+}
+
+// checkTCP connects to -tcp-addr and checks its TLS handshake and ALPN.
+func (d *doctor) checkTCP() bool {
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: d.timeout}, Config: d.tlsConfig("mcp-flow")}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", d.tcpAddr)
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		d.report("tcp", checkFail, fmt.Sprintf("nothing is listening on TCP %s", d.tcpAddr),
+			"check the server is running with -tcp-addr on this port")
+		return false
+	case err != nil:
+		d.report("tcp", checkFail, err.Error(), "check that firewalls allow the TCP port")
+		return false
+	}
+	defer conn.Close()
+	if got := conn.(*tls.Conn).ConnectionState().NegotiatedProtocol; got != "mcp-flow" {
+		d.report("tcp", checkFail, fmt.Sprintf("%s negotiated ALPN %q, want %q", d.tcpAddr, got, "mcp-flow"),
+			"point -tcp-addr at the server's TCP+TLS listener")
+		return false
+	}
+	d.report("tcp", checkOK, fmt.Sprintf("TLS handshake with %s in %s, ALPN mcp-flow", d.tcpAddr, formatRTT(time.Since(start))), "")
+	return true
+}
+
+// checkInitialize connects over transport, which includes the initialize
+// handshake, and pings.
+func (d *doctor) checkInitialize(transport string) {
+	name := "initialize"
+	if transport != mcpflowclient.TransportWebTransport {
+		name += " (" + transport + ")"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	start := time.Now()
+	c, err := mcpflowclient.Connect(ctx, mcpflowclient.Options{
+		Addr:      d.addr,
+		TCPAddr:   d.tcpAddr,
+		Order:     []string{transport},
+		Token:     d.token,
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+		InitializeParams: map[string]interface{}{
+			"protocolVersion": latestProtocolVersion,
+			"clientInfo":      map[string]interface{}{"name": "mcpflow doctor", "version": version},
+		},
+	})
+	if err != nil {
+		// WebTransport rejects the token with an HTTP status before any
+		// JSON-RPC, the framed transports with an unauthorized error.
+		hint := ""
+		var rpcErr *mcpflowerr.Error
+		if strings.Contains(err.Error(), "status 401") || errors.As(err, &rpcErr) && rpcErr.Code == mcpflowerr.CodeUnauthorized {
+			hint = "the server wants a bearer token: pass -token or set $MCPFLOW_TOKEN"
+		}
+		d.report(name, checkFail, describeError(err), hint)
+		return
+	}
+	defer c.Close()
+	connected := time.Since(start)
+
+	start = time.Now()
+	if err := c.Call(ctx, "ping", nil, nil); err != nil {
+		d.report(name, checkFail, "ping: "+describeError(err), "")
+		return
+	}
+	rtt := time.Since(start)
+
+	info := c.ServerInfo()
+	d.report(name, checkOK, fmt.Sprintf("connected and initialized in %s, ping %s (%s %s, protocol %s)",
+		formatRTT(connected), formatRTT(rtt), info.Name, info.Version, c.ProtocolVersion()), "")
+}
+
+// =============================================================================
+// Version Negotiation Probes
+// =============================================================================
+
+const (
+	// minQUICPacketSize is the smallest UDP payload a QUIC server must
+	// answer when the version is unknown (RFC 9000, section 14.1).
+	minQUICPacketSize = 1200
+	// probeVersion is a reserved version no server speaks, so servers
+	// answer with Version Negotiation (RFC 9000, section 15).
+	probeVersion = 0x1a2a3a4a
+	// datagramOverhead approximates the short header, frame header, and
+	// AEAD tag around a datagram's payload.
+	datagramOverhead = 1 + 20 + 3 + 16
+)
+
+func (d *doctor) dialUDP() (*net.UDPConn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	return net.DialUDP("udp", nil, raddr)
+}
+
+// probeVersions sends a long-header packet of size bytes with probeVersion
+// on conn, which must be connected, and waits for the server's Version
+// Negotiation. A lost probe is resent twice. The connected socket turns an
+// ICMP port unreachable into ECONNREFUSED.
+func probeVersions(conn *net.UDPConn, size int, timeout time.Duration) ([]quic.VersionNumber, time.Duration, error) {
+	const tries = 3
+	buf := make([]byte, 2048)
+	for try := 0; ; try++ {
+		packet := make([]byte, size)
+		connID := packet[6:14]
+		rand.Read(connID)
+		packet[0] = 0xc0
+		binary.BigEndian.PutUint32(packet[1:], probeVersion)
+		packet[5] = 8
+		packet[14] = 8
+		rand.Read(packet[15:23])
+
+		start := time.Now()
+		if _, err := conn.Write(packet); err != nil {
+			return nil, 0, err
+		}
+		conn.SetReadDeadline(start.Add(timeout / tries))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() && try < tries-1 {
+					break
+				}
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					return nil, 0, fmt.Errorf("timed out after %s", timeout)
+				}
+				return nil, 0, err
+			}
+			if versions, ok := parseVersionNegotiation(buf[:n], connID); ok {
+				return versions, time.Since(start), nil
+			}
+		}
+	}
+}
+
+// parseVersionNegotiation parses a Version Negotiation packet answering a
+// probe sent with destination connection ID connID, which the server
+// echoes as its source connection ID. Greased versions are dropped.
+func parseVersionNegotiation(b, connID []byte) ([]quic.VersionNumber, bool) {
+	if len(b) < 7 || b[0]&0x80 == 0 || binary.BigEndian.Uint32(b[1:]) != 0 {
+		return nil, false
+	}
+	b = b[5:]
+	dcidLen := int(b[0])
+	if len(b) < 1+dcidLen+1 {
+		return nil, false
+	}
+	b = b[1+dcidLen:]
+	scidLen := int(b[0])
+	if len(b) < 1+scidLen || string(b[1:1+scidLen]) != string(connID) {
+		return nil, false
+	}
+	var versions []quic.VersionNumber
+	for b = b[1+scidLen:]; len(b) >= 4; b = b[4:] {
+		if v := binary.BigEndian.Uint32(b); v&0x0f0f0f0f != 0x0a0a0a0a {
+			versions = append(versions, quic.VersionNumber(v))
+		}
+	}
+	return versions, true
+}
+
+func nextProbeSize(size int) int {
+	for _, s := range mtuProbeSizes {
+		if s > size {
+			return s
+		}
+	}
+	return size
+}
+
+// =============================================================================
+// Formatting
+// =============================================================================
+
+func formatVersion(v quic.VersionNumber) string {
+	switch v {
+	case quic.Version1:
+		return "v1"
+	case quic.Version2:
+		return "v2"
+	}
+	return fmt.Sprintf("0x%08x", uint32(v))
+}
+
+func formatVersions(versions []quic.VersionNumber) string {
+	if len(versions) == 0 {
+		return "none"
+	}
+	names := make([]string, len(versions))
+	for i, v := range versions {
+		names[i] = formatVersion(v)
+	}
+	return strings.Join(names, ", ")
+}
+
+func formatRTT(d time.Duration) string {
+	if d < 10*time.Millisecond {
+		return d.Round(10 * time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// certNames lists the names a certificate is valid for.
+func certNames(cert *x509.Certificate) string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 {
+		return "no names"
+	}
+	return strings.Join(names, ", ")
+}
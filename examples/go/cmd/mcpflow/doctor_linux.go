@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// setDontFragment sets the Don't Fragment bit on conn's packets, so MTU
+// probes that are too large are dropped instead of fragmented.
+func setDontFragment(conn *net.UDPConn) bool {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if conn.RemoteAddr().(*net.UDPAddr).IP.To4() != nil {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+		} else {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_DO)
+		}
+	})
+	return err == nil && sockErr == nil
+}
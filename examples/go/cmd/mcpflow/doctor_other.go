@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "net"
+
+// setDontFragment is only implemented on Linux; elsewhere MTU probes may
+// be fragmented, so they only show what reaches the server at all.
+func setDontFragment(conn *net.UDPConn) bool {
+	return false
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+)
+
+// =============================================================================
+// Client Bindings
+// =============================================================================
+
+// toolInfo is one entry of tools/list.
+type toolInfo struct {
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	InputSchema  json.RawMessage `json:"inputSchema,omitempty"`
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+}
+
+// listTools fetches every page of tools/list.
+func listTools(ctx context.Context, c *mcpflowclient.Client) ([]toolInfo, error) {
+	raw, err := listAll(ctx, c, "tools/list", "tools")
+	if err != nil {
+		return nil, err
+	}
+	tools := make([]toolInfo, len(raw))
+	for i, r := range raw {
+		if err := json.Unmarshal(r, &tools[i]); err != nil {
+			return nil, err
+		}
+	}
+	return tools, nil
+}
+
+// genClientCommand runs "mcpflow gen client".
+func genClientCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcpflow gen client", flag.ExitOnError)
+	conn := addConnFlags(fs)
+	pkg := fs.String("package", "", "Package of the generated file (default: the -o directory's name, else mcpclient)")
+	out := fs.String("o", "", "Write the generated code to this file instead of stdout")
+	force := fs.Bool("force", false, "Overwrite -o if it exists")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mcpflow gen client [flags] [-- stdio server command]")
+		fs.PrintDefaults()
+	}
+	positional, command := parseArgs(fs, args)
+	if len(positional) > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q; put a stdio server command after --", positional[0])
+	}
+
+	if *pkg == "" {
+		*pkg = "mcpclient"
+		if *out != "" {
+			if abs, err := filepath.Abs(*out); err == nil {
+				if name := filepath.Base(filepath.Dir(abs)); token.IsIdentifier(name) && !token.IsKeyword(name) {
+					*pkg = strings.ToLower(name)
+				}
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	c, err := conn.connect(ctx, command)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	tools, err := listTools(ctx, c)
+	if err != nil {
+		return fmt.Errorf("tools/list: %w", err)
+	}
+
+	src, err := generateClient(tools, *pkg, conn.endpoint(command))
+	if err != nil {
+		return err
+	}
+	return writeOutput(src, *out, *force, stdout)
+}
+
+// generateClient returns a formatted Go package with one typed method per
+// tool. A tool whose input schema cannot be typed takes its arguments as a
+// map instead.
+func generateClient(tools []toolInfo, pkg, source string) ([]byte, error) {
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name < tools[j].Name })
+
+	var b, types bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by mcpflow gen client from %s; DO NOT EDIT.\n\n", source)
+	writeComment(&b, "", fmt.Sprintf("Package %s is a typed client for the tools of %s. Regenerate it when the server's tools change.", pkg, source))
+	fmt.Fprintf(&b, `package %s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+)
+
+`, pkg)
+	b.WriteString(clientPreamble)
+
+	methods := make(map[string]string)
+	for _, tool := range tools {
+		ident := exportName(tool.Name)
+		if other, ok := methods[ident]; ok {
+			return nil, fmt.Errorf("tools %q and %q both become method %s", other, tool.Name, ident)
+		}
+		methods[ident] = tool.Name
+
+		params, err := clientStructs(&types, tool.Name, ident, "Params", "input schema", tool.InputSchema)
+		if err != nil {
+			params = "map[string]interface{}"
+			tool.Description += fmt.Sprintf("\n\nIts input schema could not be typed (%v), so arguments are passed as a map.", err)
+		}
+		result, err := clientStructs(&types, tool.Name, ident, "Result", "output schema", tool.OutputSchema)
+		if err != nil || result == "" {
+			result = "Result"
+		}
+
+		doc := fmt.Sprintf("%s calls the %s tool.", ident, tool.Name)
+		if tool.Description != "" {
+			doc += "\n\n" + tool.Description
+		}
+		writeComment(&b, "", doc)
+		fmt.Fprintf(&b, "func (c *Client) %s(ctx context.Context", ident)
+		args := "struct{}{}"
+		if params != "" {
+			fmt.Fprintf(&b, ", params %s", params)
+			args = "params"
+		}
+		fmt.Fprintf(&b, ") (*%s, error) {\n", result)
+		fmt.Fprintf(&b, "\tres, err := c.call(ctx, %q, %s)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n", tool.Name, args)
+		if result == "Result" {
+			b.WriteString("\treturn res, nil\n}\n\n")
+		} else {
+			fmt.Fprintf(&b, "\tvar out %s\n\tif err := res.decode(%q, &out); err != nil {\n\t\treturn nil, err\n\t}\n\treturn &out, nil\n}\n\n", result, tool.Name)
+		}
+	}
+	b.Write(types.Bytes())
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w\n%s", err, b.Bytes())
+	}
+	return src, nil
+}
+
+// clientStructs writes the structs for one of a tool's schemas and returns
+// the top-level type, or "" if the schema is absent or has no properties.
+func clientStructs(b *bytes.Buffer, name, ident, suffix, schemaName string, data json.RawMessage) (string, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return "", nil
+	}
+	var root jsonSchema
+	if err := json.Unmarshal(data, &root); err != nil {
+		return "", err
+	}
+	if root.kind() != "object" {
+		return "", fmt.Errorf("%s is not an object", schemaName)
+	}
+	if len(root.Properties) == 0 {
+		return "", nil
+	}
+
+	g := &generator{
+		root:       &root,
+		name:       name,
+		schemaName: schemaName,
+		typesOnly:  true,
+		ident:      ident + suffix,
+		byRef:      make(map[string]string),
+	}
+	doc := fmt.Sprintf("%s%s are the arguments of the %s tool.", ident, suffix, name)
+	if suffix == "Result" {
+		doc = fmt.Sprintf("%s%s is the structured result of the %s tool.", ident, suffix, name)
+	}
+	if _, err := g.object(&root, ident+suffix, doc); err != nil {
+		return "", err
+	}
+	for _, s := range g.structs {
+		g.writeStruct(b, s)
+	}
+	return ident + suffix, nil
+}
+
+// clientPreamble is the part of every generated client that does not
+// depend on the tools.
+const clientPreamble = `// Client calls the server's tools through a connected mcpflowclient.Client.
+type Client struct {
+	conn *mcpflowclient.Client
+}
+
+// New returns a Client that calls tools over conn.
+func New(conn *mcpflowclient.Client) *Client {
+	return &Client{conn: conn}
+}
+
+// Result is the result of a tool without an output schema.
+type Result struct {
+	Content           []Content       ` + "`json:\"content\"`" + `
+	StructuredContent json.RawMessage ` + "`json:\"structuredContent,omitempty\"`" + `
+}
+
+// Text joins the text items of the result's content.
+func (r *Result) Text() string {
+	return contentText(r.Content)
+}
+
+func (r *Result) decode(tool string, out interface{}) error {
+	if len(r.StructuredContent) == 0 {
+		return fmt.Errorf("%s returned no structuredContent", tool)
+	}
+	if err := json.Unmarshal(r.StructuredContent, out); err != nil {
+		return fmt.Errorf("%s structuredContent: %w", tool, err)
+	}
+	return nil
+}
+
+// Content is one item of a tool result's content.
+type Content struct {
+	Type     string ` + "`json:\"type\"`" + `
+	Text     string ` + "`json:\"text,omitempty\"`" + `
+	Data     string ` + "`json:\"data,omitempty\"`" + `
+	MimeType string ` + "`json:\"mimeType,omitempty\"`" + `
+}
+
+// ToolError is returned when a tool reports that a call failed. Protocol
+// failures, such as unknown tools or invalid arguments, are returned by
+// mcpflowclient as *mcpflowerr.Error instead.
+type ToolError struct {
+	Tool    string
+	Content []Content
+}
+
+func (e *ToolError) Error() string {
+	return e.Tool + ": " + contentText(e.Content)
+}
+
+func (c *Client) call(ctx context.Context, name string, args interface{}) (*Result, error) {
+	var res struct {
+		Result
+		IsError bool ` + "`json:\"isError\"`" + `
+	}
+	params := map[string]interface{}{"name": name, "arguments": args}
+	if err := c.conn.Call(ctx, "tools/call", params, &res); err != nil {
+		return nil, err
+	}
+	if res.IsError {
+		return nil, &ToolError{Tool: name, Content: res.Content}
+	}
+	return &res.Result, nil
+}
+
+func contentText(content []Content) string {
+	var texts []string
+	for _, c := range content {
+		if c.Type == "text" {
+			texts = append(texts, c.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+`
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
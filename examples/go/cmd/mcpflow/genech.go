@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+)
+
+// genECHKeyCommand runs "mcpflow gen ech-key": it writes a new Encrypted
+// Client Hello key for the server's -ech-key and prints the ECHConfigList
+// to give clients, for their -ech-config or the ech parameter of a DNS
+// HTTPS record.
+func genECHKeyCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcpflow gen ech-key", flag.ExitOnError)
+	publicName := fs.String("public-name", "", "Server name clients show the network in place of the real one (required)")
+	out := fs.String("o", "", "Write the key to this PEM file (required)")
+	force := fs.Bool("force", false, "Overwrite -o if it exists")
+	fs.Parse(args)
+
+	if *publicName == "" || *out == "" {
+		fs.Usage()
+		return errors.New("-public-name and -o are required")
+	}
+	key, err := mcpflow.NewECHKey(*publicName)
+	if err != nil {
+		return err
+	}
+	data, err := key.MarshalPEM()
+	if err != nil {
+		return err
+	}
+	if err := writeFile(*out, data, *force, 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(mcpflow.ECHConfigList([]mcpflow.ECHKey{key})))
+	return nil
+}
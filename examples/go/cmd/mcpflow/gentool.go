@@ -0,0 +1,859 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// =============================================================================
+// JSON Schema
+// =============================================================================
+
+// jsonSchema is the part of JSON Schema the generator turns into Go.
+// Anything else is kept in the schema constant but not enforced.
+type jsonSchema struct {
+	Ref         string
+	Title       string
+	Description string
+	Types       []string
+	Properties  []schemaProperty
+	Required    []string
+	// Closed is set by additionalProperties: false.
+	Closed     bool
+	Items      *jsonSchema
+	Enum       []interface{}
+	Default    interface{}
+	HasDefault bool
+
+	Minimum, Maximum                   *float64
+	ExclusiveMinimum, ExclusiveMaximum *float64
+	MinLength, MaxLength               *int
+	MinItems, MaxItems                 *int
+	Pattern                            string
+
+	Defs map[string]*jsonSchema
+}
+
+// schemaProperty keeps properties in the order the schema lists them, which
+// becomes the order of the struct fields.
+type schemaProperty struct {
+	name   string
+	schema *jsonSchema
+}
+
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		// true and false are schemas too, allowing anything or nothing.
+		var b bool
+		if json.Unmarshal(data, &b) == nil {
+			return nil
+		}
+		return err
+	}
+	decode := func(key string, v interface{}) error {
+		if r, ok := raw[key]; ok {
+			if err := json.Unmarshal(r, v); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		return nil
+	}
+
+	var typ interface{}
+	var exclusiveMin, exclusiveMax interface{}
+	var additional interface{}
+	var defs, definitions map[string]*jsonSchema
+	err := errors.Join(
+		decode("$ref", &s.Ref),
+		decode("title", &s.Title),
+		decode("description", &s.Description),
+		decode("type", &typ),
+		decode("required", &s.Required),
+		decode("additionalProperties", &additional),
+		decode("enum", &s.Enum),
+		decode("default", &s.Default),
+		decode("minimum", &s.Minimum),
+		decode("maximum", &s.Maximum),
+		decode("exclusiveMinimum", &exclusiveMin),
+		decode("exclusiveMaximum", &exclusiveMax),
+		decode("minLength", &s.MinLength),
+		decode("maxLength", &s.MaxLength),
+		decode("minItems", &s.MinItems),
+		decode("maxItems", &s.MaxItems),
+		decode("pattern", &s.Pattern),
+		decode("$defs", &defs),
+		decode("definitions", &definitions),
+	)
+	if err != nil {
+		return err
+	}
+	_, s.HasDefault = raw["default"]
+	s.Closed = additional == false
+
+	switch t := typ.(type) {
+	case string:
+		s.Types = []string{t}
+	case []interface{}:
+		for _, v := range t {
+			if name, ok := v.(string); ok {
+				s.Types = append(s.Types, name)
+			}
+		}
+	}
+
+	// Draft 4 spells exclusive bounds as booleans beside minimum and
+	// maximum; later drafts give the bound itself.
+	exclusive := func(v interface{}, bound **float64, inclusive **float64) {
+		switch v := v.(type) {
+		case float64:
+			*bound = &v
+		case bool:
+			if v {
+				*bound, *inclusive = *inclusive, nil
+			}
+		}
+	}
+	exclusive(exclusiveMin, &s.ExclusiveMinimum, &s.Minimum)
+	exclusive(exclusiveMax, &s.ExclusiveMaximum, &s.Maximum)
+
+	// Tuple-form items are left untyped.
+	if items := bytes.TrimSpace(raw["items"]); len(items) > 0 && items[0] != '[' {
+		if err := json.Unmarshal(items, &s.Items); err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+	}
+	if props, ok := raw["properties"]; ok {
+		if s.Properties, err = decodeProperties(props); err != nil {
+			return fmt.Errorf("properties: %w", err)
+		}
+	}
+
+	s.Defs = defs
+	for name, def := range definitions {
+		if s.Defs == nil {
+			s.Defs = make(map[string]*jsonSchema)
+		}
+		s.Defs[name] = def
+	}
+	return nil
+}
+
+func decodeProperties(data []byte) ([]schemaProperty, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, errors.New("must be an object")
+	}
+	var props []schemaProperty
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name, _ := tok.(string)
+		var s jsonSchema
+		if err := dec.Decode(&s); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		props = append(props, schemaProperty{name: name, schema: &s})
+	}
+	return props, nil
+}
+
+// kind is the single JSON type a schema allows, ignoring "null", or "" if
+// it allows several or does not say.
+func (s *jsonSchema) kind() string {
+	var kinds []string
+	for _, t := range s.Types {
+		if t != "null" {
+			kinds = append(kinds, t)
+		}
+	}
+	switch {
+	case len(kinds) == 1:
+		return kinds[0]
+	case len(kinds) == 0 && len(s.Properties) > 0:
+		return "object"
+	case len(kinds) == 0 && len(s.Enum) > 0:
+		for _, v := range s.Enum {
+			if _, ok := v.(string); !ok {
+				return ""
+			}
+		}
+		return "string"
+	}
+	return ""
+}
+
+// =============================================================================
+// Generator
+// =============================================================================
+
+// genOptions configures generateTool.
+type genOptions struct {
+	// Name is the tool's name. It defaults to the schema's title, then to
+	// Source without its extension.
+	Name string
+	// Description defaults to the schema's description.
+	Description string
+	Package     string
+	// Source names the schema file in the generated header.
+	Source string
+}
+
+type generator struct {
+	root *jsonSchema
+	name string
+	// schemaName says which of the tool's schemas root is, for docs.
+	schemaName string
+	// typesOnly generates plain structs, without decoding and validation,
+	// for code that only sends or receives the values.
+	typesOnly bool
+	// ident is the tool's exported Go name, such as SearchDocs, and
+	// prefix its unexported form, which names the file's helpers.
+	ident, prefix string
+
+	structs  []*genStruct
+	byRef    map[string]string
+	patterns []string
+	imports  map[string]bool
+}
+
+type genStruct struct {
+	name   string
+	doc    string
+	closed bool
+	fields []*genField
+}
+
+type genField struct {
+	goName, jsonName, doc string
+	goType                string // the field's type, without the pointer
+	schema                *jsonSchema
+	required, pointer     bool
+	defaultLit            string
+}
+
+// generateTool returns a formatted Go file implementing a tool whose
+// arguments are described by the JSON Schema in data.
+func generateTool(data []byte, opts genOptions) ([]byte, error) {
+	var root jsonSchema
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if root.kind() != "object" {
+		return nil, errors.New(`a tool's input schema must have "type": "object"`)
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = snakeName(root.Title)
+	}
+	if name == "" {
+		name = strings.TrimSuffix(opts.Source, ".json")
+	}
+	if name == "" {
+		return nil, errors.New("tool name is required")
+	}
+	description := opts.Description
+	if description == "" {
+		description = root.Description
+	}
+
+	g := &generator{
+		root:       &root,
+		name:       name,
+		schemaName: "input schema",
+		ident:      exportName(name),
+		byRef:      make(map[string]string),
+		imports:    map[string]bool{"encoding/json": true, "errors": true},
+	}
+	g.prefix = unexportName(g.ident)
+	if _, err := g.object(&root, g.ident+"Params", fmt.Sprintf("%s are the arguments of the %s tool.", g.ident+"Params", name)); err != nil {
+		return nil, err
+	}
+
+	var schemaConst bytes.Buffer
+	if err := json.Indent(&schemaConst, data, "", "\t"); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Generated by mcpflow gen tool from %s; fill in run.\n\n", opts.Source)
+	fmt.Fprintf(&b, "package %s\n\n", opts.Package)
+	g.writeImports(&b)
+
+	fmt.Fprintf(&b, "// %sSchema is the input schema of the %s tool.\n", g.prefix, name)
+	fmt.Fprintf(&b, "const %sSchema = %s\n\n", g.prefix, goString(schemaConst.String()))
+	for i, pattern := range g.patterns {
+		fmt.Fprintf(&b, "var %sPattern%d = regexp.MustCompile(%s)\n", g.prefix, i+1, goString(pattern))
+	}
+	if len(g.patterns) > 0 {
+		b.WriteString("\n")
+	}
+
+	g.writeTool(&b, name, description)
+	for _, s := range g.structs {
+		g.writeStruct(&b, s)
+	}
+	g.writeHelpers(&b)
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w\n%s", err, b.Bytes())
+	}
+	return src, nil
+}
+
+// resolve follows a local $ref into $defs or definitions.
+func (g *generator) resolve(s *jsonSchema) (*jsonSchema, string, error) {
+	if s.Ref == "" {
+		return s, "", nil
+	}
+	for _, prefix := range []string{"#/$defs/", "#/definitions/"} {
+		if name, ok := strings.CutPrefix(s.Ref, prefix); ok {
+			if def := g.root.Defs[name]; def != nil {
+				return def, name, nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("unsupported $ref %q: only #/$defs/ and #/definitions/ are resolved", s.Ref)
+}
+
+// goType maps a schema to a Go type, generating structs for objects with
+// properties. hint names an inline object's struct.
+func (g *generator) goType(s *jsonSchema, hint string) (string, error) {
+	s, ref, err := g.resolve(s)
+	if err != nil {
+		return "", err
+	}
+	switch s.kind() {
+	case "string":
+		return "string", nil
+	case "integer":
+		return "int64", nil
+	case "number":
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		if s.Items == nil {
+			return "[]interface{}", nil
+		}
+		elem, err := g.goType(s.Items, hint+"Item")
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	case "object":
+		if len(s.Properties) == 0 {
+			return "map[string]interface{}", nil
+		}
+		if ref != "" {
+			if name, ok := g.byRef[ref]; ok {
+				return name, nil
+			}
+			hint = g.ident + exportName(ref)
+			g.byRef[ref] = hint
+		}
+		doc := fmt.Sprintf("%s is an object in the %s tool's %s.", hint, g.name, g.schemaName)
+		if ref != "" {
+			doc = fmt.Sprintf("%s is the %q definition in the %s tool's %s.", hint, ref, g.name, g.schemaName)
+		}
+		if s.Description != "" {
+			doc += "\n\n" + s.Description
+		}
+		return g.object(s, hint, doc)
+	}
+	return "interface{}", nil
+}
+
+// object generates the struct for an object schema.
+func (g *generator) object(s *jsonSchema, name, doc string) (string, error) {
+	st := &genStruct{name: name, doc: doc, closed: s.Closed}
+	g.structs = append(g.structs, st)
+
+	required := make(map[string]bool)
+	for _, r := range s.Required {
+		required[r] = true
+	}
+	seen := make(map[string]string)
+	for _, prop := range s.Properties {
+		f := &genField{
+			goName:   exportName(prop.name),
+			jsonName: prop.name,
+			required: required[prop.name],
+		}
+		if other, ok := seen[f.goName]; ok {
+			return "", fmt.Errorf("properties %q and %q both become field %s", other, prop.name, f.goName)
+		}
+		seen[f.goName] = prop.name
+
+		typ, err := g.goType(prop.schema, name+f.goName)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", prop.name, err)
+		}
+		if f.schema, _, err = g.resolve(prop.schema); err != nil {
+			return "", err
+		}
+		f.goType, f.doc = typ, prop.schema.Description
+		if f.doc == "" {
+			f.doc = f.schema.Description
+		}
+		if f.schema.Pattern != "" && !g.typesOnly {
+			if _, err := regexp.Compile(f.schema.Pattern); err != nil {
+				return "", fmt.Errorf("%s: pattern is not supported by Go's regexp: %w", prop.name, err)
+			}
+		}
+		if !f.required && f.schema.HasDefault && !g.typesOnly {
+			f.defaultLit = goLiteral(f.schema.Default, typ)
+		}
+		// Optional values without a default are pointers, so "absent" and
+		// "zero" stay distinct; slices and maps are nil when absent.
+		f.pointer = !f.required && f.defaultLit == "" && !strings.HasPrefix(typ, "[]") &&
+			!strings.HasPrefix(typ, "map[") && typ != "interface{}"
+		st.fields = append(st.fields, f)
+	}
+	return name, nil
+}
+
+func (g *generator) writeImports(b *bytes.Buffer) {
+	// The checks decide which imports are needed, so generate the structs
+	// once into a scratch buffer to collect them.
+	var scratch bytes.Buffer
+	for _, s := range g.structs {
+		g.writeStruct(&scratch, s)
+	}
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+
+	b.WriteString("import (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(b, "\t%q\n", imp)
+	}
+	b.WriteString("\n\t\"github.com/mcp-flow/examples/go/mcpflowerr\"\n)\n\n")
+}
+
+func (g *generator) writeTool(b *bytes.Buffer, name, description string) {
+	tool, params := g.ident+"Tool", g.ident+"Params"
+	fmt.Fprintf(b, "// %s is the %s tool.\n", tool, name)
+	fmt.Fprintf(b, "type %s struct{}\n\n", tool)
+	fmt.Fprintf(b, "func (%s) Name() string { return %q }\n", tool, name)
+	fmt.Fprintf(b, "func (%s) Description() string { return %s }\n\n", tool, strconv.Quote(description))
+	fmt.Fprintf(b, `// InputSchema decodes %[2]sSchema afresh, so callers may modify it.
+func (%[1]s) InputSchema() map[string]interface{} {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(%[2]sSchema), &schema); err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// Execute decodes and validates args, then calls run.
+func (t %[1]s) Execute(args map[string]interface{}) (interface{}, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	var params %[3]s
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+	if err := params.validate(""); err != nil {
+		return nil, err
+	}
+	return t.run(&params)
+}
+
+// run carries out a call with validated params. It returns the tool result,
+// such as
+//
+//	map[string]interface{}{
+//		"content": []map[string]interface{}{{"type": "text", "text": "..."}},
+//	}
+//
+// Errors from mcpflowerr become JSON-RPC errors; any other error is
+// reported to the model as a failed call.
+func (t %[1]s) run(params *%[3]s) (interface{}, error) {
+	return nil, errors.New(%[4]q)
+}
+
+`, tool, g.prefix, params, name+" is not implemented")
+}
+
+func (g *generator) writeStruct(b *bytes.Buffer, s *genStruct) {
+	if s.doc != "" {
+		writeComment(b, "", s.doc)
+	}
+	fmt.Fprintf(b, "type %s struct {\n", s.name)
+	for _, f := range s.fields {
+		if f.doc != "" {
+			writeComment(b, "\t", f.doc)
+		}
+		typ := f.goType
+		if f.pointer {
+			typ = "*" + typ
+		}
+		tag := f.jsonName
+		if !f.required {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%q`\n", f.goName, typ, tag)
+	}
+	b.WriteString("}\n\n")
+	if g.typesOnly {
+		return
+	}
+
+	// UnmarshalJSON: presence, unknown arguments, and types.
+	rejects := "missing required arguments and values of the wrong type"
+	if s.closed {
+		rejects = "missing required arguments, unknown arguments, and values of the wrong type"
+	}
+	writeComment(b, "", fmt.Sprintf("UnmarshalJSON decodes %s, rejecting %s.", s.name, rejects))
+	fmt.Fprintf(b, "func (p *%s) UnmarshalJSON(data []byte) error {\n", s.name)
+	b.WriteString("\tvar raw map[string]json.RawMessage\n")
+	fmt.Fprintf(b, "\tif err := json.Unmarshal(data, &raw); err != nil {\n\t\treturn %sArgError(\"\", \"must be an object\", nil)\n\t}\n", g.prefix)
+
+	var required []string
+	for _, f := range s.fields {
+		if f.required {
+			required = append(required, strconv.Quote(f.jsonName))
+		}
+	}
+	if len(required) > 0 {
+		fmt.Fprintf(b, "\tfor _, name := range []string{%s} {\n", strings.Join(required, ", "))
+		fmt.Fprintf(b, "\t\tif v, ok := raw[name]; !ok || string(v) == \"null\" {\n\t\t\treturn %sArgError(name, \"is required\", nil)\n\t\t}\n\t}\n", g.prefix)
+	}
+	if s.closed {
+		known := make([]string, len(s.fields))
+		for i, f := range s.fields {
+			known[i] = strconv.Quote(f.jsonName)
+		}
+		b.WriteString("\tfor name := range raw {\n\t\tswitch name {\n")
+		if len(known) > 0 {
+			fmt.Fprintf(b, "\t\tcase %s:\n", strings.Join(known, ", "))
+		}
+		fmt.Fprintf(b, "\t\tdefault:\n\t\t\treturn %sArgError(name, \"is not a known argument\", nil)\n\t\t}\n\t}\n", g.prefix)
+	}
+
+	var defaults []string
+	for _, f := range s.fields {
+		if f.defaultLit != "" {
+			defaults = append(defaults, fmt.Sprintf("%s: %s", f.goName, f.defaultLit))
+		}
+	}
+	fmt.Fprintf(b, "\t*p = %s{%s}\n", s.name, strings.Join(defaults, ", "))
+	for _, f := range s.fields {
+		fmt.Fprintf(b, "\tif v, ok := raw[%q]; ok {\n", f.jsonName)
+		fmt.Fprintf(b, "\t\tif err := json.Unmarshal(v, &p.%s); err != nil {\n", f.goName)
+		fmt.Fprintf(b, "\t\t\treturn %sArgError(%q, %q, err)\n\t\t}\n\t}\n", g.prefix, f.jsonName, "must be "+typeNoun(f.schema))
+	}
+	b.WriteString("\treturn nil\n}\n\n")
+
+	// validate: the constraints.
+	fmt.Fprintf(b, "// validate checks the constraints of the schema, naming the argument that\n// breaks one by its path below path.\n")
+	fmt.Fprintf(b, "func (p *%s) validate(path string) error {\n", s.name)
+	for _, f := range s.fields {
+		pathExpr := fmt.Sprintf("%sPath(path, %q)", g.prefix, f.jsonName)
+		expr := "p." + f.goName
+		var checks bytes.Buffer
+		if f.pointer && !g.isStruct(f.goType) {
+			g.writeChecks(&checks, f.schema, f.goType, "*"+expr, pathExpr, 1)
+		} else {
+			g.writeChecks(&checks, f.schema, f.goType, expr, pathExpr, 1)
+		}
+		if checks.Len() == 0 {
+			continue
+		}
+		if f.pointer {
+			fmt.Fprintf(b, "\tif %s != nil {\n%s\t}\n", expr, checks.String())
+		} else {
+			b.Write(checks.Bytes())
+		}
+	}
+	b.WriteString("\treturn nil\n}\n\n")
+}
+
+func (g *generator) isStruct(typ string) bool {
+	for _, s := range g.structs {
+		if s.name == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// writeChecks writes the statements that check the value expr, of Go type
+// typ, against s, returning an error at the path pathExpr evaluates to.
+func (g *generator) writeChecks(b *bytes.Buffer, s *jsonSchema, typ, expr, pathExpr string, depth int) {
+	s, _, err := g.resolve(s)
+	if err != nil {
+		return
+	}
+	fail := func(reason string) string {
+		return fmt.Sprintf("return %sArgError(%s, %s, nil)", g.prefix, pathExpr, strconv.Quote(reason))
+	}
+
+	switch {
+	case g.isStruct(typ):
+		fmt.Fprintf(b, "if err := %s.validate(%s); err != nil {\nreturn err\n}\n", expr, pathExpr)
+		return
+
+	case strings.HasPrefix(typ, "[]"):
+		if s.MinItems != nil {
+			fmt.Fprintf(b, "if len(%s) < %d {\n%s\n}\n", expr, *s.MinItems, fail("must have at least "+plural(*s.MinItems, "item")))
+		}
+		if s.MaxItems != nil {
+			fmt.Fprintf(b, "if len(%s) > %d {\n%s\n}\n", expr, *s.MaxItems, fail("must have at most "+plural(*s.MaxItems, "item")))
+		}
+		if s.Items == nil {
+			return
+		}
+		i, v := fmt.Sprintf("i%d", depth), fmt.Sprintf("v%d", depth)
+		var item bytes.Buffer
+		itemPath := fmt.Sprintf("%sPath(%s, fmt.Sprintf(\"[%%d]\", %s))", g.prefix, pathExpr, i)
+		g.writeChecks(&item, s.Items, strings.TrimPrefix(typ, "[]"), v, itemPath, depth+1)
+		if item.Len() > 0 {
+			g.imports["fmt"] = true
+			fmt.Fprintf(b, "for %s, %s := range %s {\n%s}\n", i, v, expr, item.String())
+		}
+		return
+
+	case typ == "string":
+		if s.MinLength != nil {
+			g.imports["unicode/utf8"] = true
+			fmt.Fprintf(b, "if utf8.RuneCountInString(%s) < %d {\n%s\n}\n", expr, *s.MinLength, fail("must be at least "+plural(*s.MinLength, "character")))
+		}
+		if s.MaxLength != nil {
+			g.imports["unicode/utf8"] = true
+			fmt.Fprintf(b, "if utf8.RuneCountInString(%s) > %d {\n%s\n}\n", expr, *s.MaxLength, fail("must be at most "+plural(*s.MaxLength, "character")))
+		}
+		if s.Pattern != "" {
+			g.imports["regexp"] = true
+			n := g.pattern(s.Pattern)
+			fmt.Fprintf(b, "if !%sPattern%d.MatchString(%s) {\n%s\n}\n", g.prefix, n, expr, fail("must match "+s.Pattern))
+		}
+
+	case typ == "int64" || typ == "float64":
+		bound := func(limit *float64, op, reason string) {
+			if limit == nil {
+				return
+			}
+			lit, lhs := formatNumber(*limit), expr
+			if typ == "int64" && *limit != math.Trunc(*limit) {
+				lhs = "float64(" + expr + ")"
+			}
+			fmt.Fprintf(b, "if %s %s %s {\n%s\n}\n", lhs, op, lit, fail(reason+" "+lit))
+		}
+		bound(s.Minimum, "<", "must be at least")
+		bound(s.ExclusiveMinimum, "<=", "must be greater than")
+		bound(s.Maximum, ">", "must be at most")
+		bound(s.ExclusiveMaximum, ">=", "must be less than")
+
+	default:
+		return
+	}
+
+	// Enums apply to strings and numbers alike.
+	var cases, shown []string
+	for _, v := range s.Enum {
+		if lit := goLiteral(v, typ); lit != "" {
+			cases = append(cases, lit)
+			raw, _ := json.Marshal(v)
+			shown = append(shown, string(raw))
+		}
+	}
+	if len(cases) > 0 {
+		fmt.Fprintf(b, "switch %s {\ncase %s:\ndefault:\n%s\n}\n", expr, strings.Join(cases, ", "), fail("must be one of "+strings.Join(shown, ", ")))
+	}
+}
+
+// pattern returns the number of the regexp variable for pattern.
+func (g *generator) pattern(pattern string) int {
+	for i, p := range g.patterns {
+		if p == pattern {
+			return i + 1
+		}
+	}
+	g.patterns = append(g.patterns, pattern)
+	return len(g.patterns)
+}
+
+func (g *generator) writeHelpers(b *bytes.Buffer) {
+	fmt.Fprintf(b, `// %[1]sArgError reports an invalid argument at path, extending the
+// path with that of an error from a nested object.
+func %[1]sArgError(path, reason string, err error) error {
+	if data := mcpflowerr.DataOf(err); data != nil && len(data.Offenders) == 1 {
+		inner := data.Offenders[0]
+		path, reason = %[1]sPath(path, inner.Path), inner.Message
+	}
+	return mcpflowerr.InvalidParams("argument %%q %%s", path, reason).WithOffender(path, reason)
+}
+
+// %[1]sPath names a nested argument: filter.field, or tags[0].
+func %[1]sPath(path, name string) string {
+	switch {
+	case path == "":
+		return name
+	case name == "" || name[0] == '[':
+		return path + name
+	}
+	return path + "." + name
+}
+`, g.prefix)
+}
+
+// =============================================================================
+// Names and Literals
+// =============================================================================
+
+// initialisms are written in upper case in Go names.
+var initialisms = map[string]bool{
+	"api": true, "cpu": true, "dns": true, "html": true, "http": true, "https": true,
+	"id": true, "ip": true, "json": true, "sql": true, "tls": true, "ttl": true,
+	"uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// exportName turns a JSON name such as "max_results" or "user-id" into an
+// exported Go name: MaxResults, UserID.
+func exportName(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	var b strings.Builder
+	for _, part := range parts {
+		if initialisms[strings.ToLower(part)] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	name := b.String()
+	if name == "" {
+		return "Field"
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		return "X" + name
+	}
+	return name
+}
+
+// unexportName lowers the leading capitals of an exported name: SearchDocs
+// becomes searchDocs and URLFetch urlFetch.
+func unexportName(s string) string {
+	runes := []rune(s)
+	n := 0
+	for n < len(runes) && unicode.IsUpper(runes[n]) {
+		n++
+	}
+	if n > 1 && n < len(runes) && unicode.IsLower(runes[n]) {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// snakeName turns a schema title such as "Search Docs" into a tool name.
+func snakeName(s string) string {
+	parts := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	return strings.Join(parts, "_")
+}
+
+// typeNoun describes the JSON type a schema expects, for errors.
+func typeNoun(s *jsonSchema) string {
+	switch s.kind() {
+	case "string":
+		return "a string"
+	case "integer":
+		return "an integer"
+	case "number":
+		return "a number"
+	case "boolean":
+		return "a boolean"
+	case "array":
+		return "an array"
+	case "object":
+		return "an object"
+	}
+	return "valid JSON"
+}
+
+// goLiteral writes v as a Go literal of type typ, or returns "" if it is
+// not one.
+func goLiteral(v interface{}, typ string) string {
+	switch v := v.(type) {
+	case string:
+		if typ == "string" {
+			return strconv.Quote(v)
+		}
+	case float64:
+		if typ == "float64" || (typ == "int64" && v == math.Trunc(v)) {
+			return formatNumber(v)
+		}
+	case bool:
+		if typ == "bool" {
+			return strconv.FormatBool(v)
+		}
+	}
+	return ""
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// goString quotes s as a raw string literal when it can be one.
+func goString(s string) string {
+	if strings.Contains(s, "`") || strings.Contains(s, "\r") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// writeComment writes text as a comment, rewrapping each paragraph to fit
+// 80 columns.
+func writeComment(b *bytes.Buffer, indent, text string) {
+	width := 77 - len(indent)*4
+	for i, para := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		if i > 0 {
+			fmt.Fprintf(b, "%s//\n", indent)
+		}
+		line := ""
+		for _, word := range strings.Fields(para) {
+			if line != "" && len(line)+1+len(word) > width {
+				fmt.Fprintf(b, "%s// %s\n", indent, line)
+				line = ""
+			}
+			if line != "" {
+				line += " "
+			}
+			line += word
+		}
+		if line != "" {
+			fmt.Fprintf(b, "%s// %s\n", indent, line)
+		}
+	}
+}
+
+// plural writes n with a noun, such as "1 item" or "5 items".
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
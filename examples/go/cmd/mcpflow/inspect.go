@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// =============================================================================
+// Trace Inspector
+// =============================================================================
+
+// inspectCommand runs "mcpflow inspect": it reads a trace recorded by
+// "mcpflow proxy -record" and prints its frames, each request paired with
+// its response, per-method timing, or the responses that differ from a
+// second trace of the same requests.
+func inspectCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcpflow inspect", flag.ExitOnError)
+	method := fs.String("method", "", "Only frames of these methods, comma-separated; a trailing * matches a prefix, as in tools/*")
+	id := fs.String("id", "", "Only the request with this ID and its response")
+	direction := fs.String("direction", "", `Only frames sent this way: "c2s" (client to server) or "s2c"`)
+	session := fs.Int64("session", 0, "Only frames of this proxy session")
+	pairs := fs.Bool("pairs", false, "Print each request with its response and latency")
+	stats := fs.Bool("stats", false, "Print call counts, errors, and latency per method")
+	diff := fs.String("diff", "", "Compare responses with those to the same requests in this second trace")
+	compact := fs.Bool("compact", false, "Print messages on one line instead of indented")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mcpflow inspect [flags] TRACE.jsonl")
+		fs.PrintDefaults()
+	}
+	positional, _ := parseArgs(fs, args)
+	if len(positional) != 1 {
+		fs.Usage()
+		return fmt.Errorf("want 1 argument, got %d", len(positional))
+	}
+	if *direction != "" && *direction != "c2s" && *direction != "s2c" {
+		return fmt.Errorf(`-direction: want "c2s" or "s2c", got %q`, *direction)
+	}
+
+	trace, err := readTrace(positional[0])
+	if err != nil {
+		return err
+	}
+	f := traceFilter{methods: splitList(*method), id: *id, direction: *direction, session: *session}
+	out := &traceWriter{w: stdout, compact: *compact}
+
+	switch {
+	case *diff != "":
+		other, err := readTrace(*diff)
+		if err != nil {
+			return err
+		}
+		return out.diff(f, trace, other, positional[0], *diff)
+	case *stats:
+		return out.stats(f.apply(trace))
+	case *pairs:
+		return out.pairs(f.apply(trace))
+	}
+	return out.frames(f.apply(trace))
+}
+
+// traceEntry is one line of a trace with what matching requests to
+// responses learned about it.
+type traceEntry struct {
+	proxyRecord
+	line int
+
+	// id is the message's JSON-RPC ID, empty for notifications. method is
+	// the request's method, also for its response.
+	id     string
+	method string
+	isErr  bool
+
+	request  *traceEntry // for a response
+	response *traceEntry // for a request, once answered
+}
+
+// readTrace reads a -record file, or stdin for "-", and links each
+// response to its request.
+func readTrace(path string) ([]*traceEntry, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var trace []*traceEntry
+	pending := map[string]*traceEntry{}
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			e := &traceEntry{line: line}
+			if err := json.Unmarshal(data, &e.proxyRecord); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			linkEntry(e, pending)
+			trace = append(trace, e)
+		}
+		if errors.Is(err, io.EOF) {
+			return trace, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// linkEntry fills in e's ID and method, pairing a response with the
+// pending request of the same session, ID, and opposite direction.
+func linkEntry(e *traceEntry, pending map[string]*traceEntry) {
+	if e.Message == nil {
+		return
+	}
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(e.Message, &msg) != nil {
+		return
+	}
+	if msg.ID != nil && string(msg.ID) != "null" {
+		e.id = string(msg.ID)
+	}
+	e.method = msg.Method
+	e.isErr = msg.Error != nil
+	if e.id == "" {
+		return
+	}
+	if msg.Method != "" {
+		pending[fmt.Sprintf("%d %s %s", e.Session, e.Direction, e.id)] = e
+		return
+	}
+	requestDirection := "c2s"
+	if e.Direction == "c2s" {
+		requestDirection = "s2c"
+	}
+	key := fmt.Sprintf("%d %s %s", e.Session, requestDirection, e.id)
+	if req, ok := pending[key]; ok {
+		delete(pending, key)
+		req.response, e.request = e, req
+		e.method = req.method
+	}
+}
+
+// traceFilter selects entries by the -method, -id, -direction, and -session
+// flags. Responses match by their request's method.
+type traceFilter struct {
+	methods   []string
+	id        string
+	direction string
+	session   int64
+}
+
+func (f traceFilter) match(e *traceEntry) bool {
+	if f.session != 0 && e.Session != f.session {
+		return false
+	}
+	if e.Event != "" {
+		return len(f.methods) == 0 && f.id == "" && f.direction == ""
+	}
+	if f.id != "" && strings.Trim(e.id, `"`) != strings.Trim(f.id, `"`) {
+		return false
+	}
+	if f.direction != "" && e.Direction != f.direction {
+		return false
+	}
+	if len(f.methods) == 0 {
+		return true
+	}
+	for _, m := range f.methods {
+		if prefix, ok := strings.CutSuffix(m, "*"); ok && strings.HasPrefix(e.method, prefix) || m == e.method {
+			return true
+		}
+	}
+	return false
+}
+
+func (f traceFilter) apply(trace []*traceEntry) []*traceEntry {
+	var out []*traceEntry
+	for _, e := range trace {
+		if f.match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// =============================================================================
+// Output
+// =============================================================================
+
+type traceWriter struct {
+	w       io.Writer
+	compact bool
+}
+
+// frames prints each entry with a summary line and its message.
+func (t *traceWriter) frames(trace []*traceEntry) error {
+	for _, e := range trace {
+		fmt.Fprintln(t.w, t.summary(e))
+		if e.Event == "" {
+			t.message(e, "  ")
+		}
+	}
+	return nil
+}
+
+// summary is the one-line description of an entry.
+func (t *traceWriter) summary(e *traceEntry) string {
+	prefix := fmt.Sprintf("%s #%d", e.Time.Local().Format("15:04:05.000"), e.Session)
+	switch {
+	case e.Event == "open" && e.Error != "":
+		return fmt.Sprintf("%s %s session from %s failed: %s", prefix, e.Transport, e.Remote, e.Error)
+	case e.Event == "open":
+		return fmt.Sprintf("%s %s session from %s, upstream over %s", prefix, e.Transport, e.Remote, e.Upstream)
+	case e.Event != "" && e.Error != "":
+		return fmt.Sprintf("%s %s: %s", prefix, e.Event, e.Error)
+	case e.Event != "":
+		return fmt.Sprintf("%s %s", prefix, e.Event)
+	}
+
+	arrow := "→"
+	if e.Direction == "s2c" {
+		arrow = "←"
+	}
+	var desc string
+	switch {
+	case e.Message == nil:
+		desc = "invalid JSON"
+	case e.request != nil:
+		desc = fmt.Sprintf("%s response id=%s after %s", e.method, e.id, formatLatency(e.Time.Sub(e.request.Time).Seconds()))
+		if e.isErr {
+			desc += " (error)"
+		}
+	case e.id != "" && e.method != "":
+		desc = fmt.Sprintf("%s id=%s", e.method, e.id)
+		if e.response == nil {
+			desc += " (no response)"
+		}
+	case e.id != "":
+		desc = fmt.Sprintf("response id=%s (no request)", e.id)
+	default:
+		desc = e.method
+	}
+	return fmt.Sprintf("%s %s %s (%d bytes)", prefix, arrow, desc, e.Size)
+}
+
+// message prints an entry's message, indented unless -compact.
+func (t *traceWriter) message(e *traceEntry, indent string) {
+	if e.Message == nil {
+		fmt.Fprintf(t.w, "%s%s\n", indent, e.Raw)
+		return
+	}
+	var buf bytes.Buffer
+	if t.compact {
+		json.Compact(&buf, e.Message)
+	} else {
+		json.Indent(&buf, e.Message, indent, "  ")
+	}
+	fmt.Fprintf(t.w, "%s%s\n", indent, buf.String())
+}
+
+// pairs prints each request together with its response, and
+// notifications and unanswered requests on their own.
+func (t *traceWriter) pairs(trace []*traceEntry) error {
+	for _, e := range trace {
+		if e.Event != "" || e.request != nil {
+			continue
+		}
+		fmt.Fprintln(t.w, t.summary(e))
+		t.message(e, "  ")
+		if e.response != nil {
+			fmt.Fprintln(t.w, t.summary(e.response))
+			t.message(e.response, "  ")
+		}
+		fmt.Fprintln(t.w)
+	}
+	return nil
+}
+
+// methodTiming accumulates the latencies of one method's requests.
+type methodTiming struct {
+	method     string
+	calls      int
+	errors     int
+	unanswered int
+	latencies  []time.Duration
+}
+
+// stats prints a table of call counts and latencies per method, slowest
+// total time first.
+func (t *traceWriter) stats(trace []*traceEntry) error {
+	byMethod := map[string]*methodTiming{}
+	for _, e := range trace {
+		if e.Event != "" || e.id == "" || e.request != nil || e.method == "" {
+			continue
+		}
+		m := byMethod[e.method]
+		if m == nil {
+			m = &methodTiming{method: e.method}
+			byMethod[e.method] = m
+		}
+		m.calls++
+		switch {
+		case e.response == nil:
+			m.unanswered++
+			continue
+		case e.response.isErr:
+			m.errors++
+		}
+		m.latencies = append(m.latencies, e.response.Time.Sub(e.Time))
+	}
+
+	timings := make([]*methodTiming, 0, len(byMethod))
+	for _, m := range byMethod {
+		sort.Slice(m.latencies, func(i, j int) bool { return m.latencies[i] < m.latencies[j] })
+		timings = append(timings, m)
+	}
+	total := func(m *methodTiming) (sum time.Duration) {
+		for _, d := range m.latencies {
+			sum += d
+		}
+		return sum
+	}
+	sort.Slice(timings, func(i, j int) bool {
+		if ti, tj := total(timings[i]), total(timings[j]); ti != tj {
+			return ti > tj
+		}
+		return timings[i].method < timings[j].method
+	})
+
+	tw := tabwriter.NewWriter(t.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tCALLS\tERRORS\tNO REPLY\tMIN\tAVG\tP50\tP95\tMAX\tTOTAL")
+	for _, m := range timings {
+		row := []string{m.method, fmt.Sprint(m.calls), fmt.Sprint(m.errors), fmt.Sprint(m.unanswered)}
+		if n := len(m.latencies); n > 0 {
+			sum := total(m)
+			row = append(row,
+				formatLatency(m.latencies[0].Seconds()),
+				formatLatency((sum / time.Duration(n)).Seconds()),
+				formatLatency(tracePercentile(m.latencies, 0.5).Seconds()),
+				formatLatency(tracePercentile(m.latencies, 0.95).Seconds()),
+				formatLatency(m.latencies[n-1].Seconds()),
+				formatLatency(sum.Seconds()))
+		} else {
+			row = append(row, "-", "-", "-", "-", "-", "-")
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// tracePercentile returns the nearest-rank q quantile of sorted.
+func tracePercentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(q*float64(len(sorted))+0.5) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
+
+// =============================================================================
+// Trace Diff
+// =============================================================================
+
+// diff matches the requests of two traces and prints the pairs whose
+// responses differ. Requests match on method and params, the nth such
+// request in one trace with the nth in the other, so the IDs and sessions
+// may differ, as they do between two runs of the same client.
+func (t *traceWriter) diff(f traceFilter, a, b []*traceEntry, nameA, nameB string) error {
+	keyed := func(trace []*traceEntry) (keys []string, byKey map[string][]*traceEntry) {
+		byKey = map[string][]*traceEntry{}
+		for _, e := range f.apply(trace) {
+			if e.Event != "" || e.id == "" || e.request != nil || e.method == "" {
+				continue
+			}
+			key := e.method + " " + canonicalParams(e.Message)
+			if byKey[key] == nil {
+				keys = append(keys, key)
+			}
+			byKey[key] = append(byKey[key], e)
+		}
+		return keys, byKey
+	}
+	keysA, byKeyA := keyed(a)
+	keysB, byKeyB := keyed(b)
+
+	var same, changed, onlyA, onlyB int
+	report := func(e *traceEntry, what string) {
+		fmt.Fprintf(t.w, "%s %s\n", what, t.requestLine(e))
+	}
+	for _, key := range keysA {
+		as, bs := byKeyA[key], byKeyB[key]
+		for i, ea := range as {
+			if i >= len(bs) {
+				report(ea, "only in "+nameA+":")
+				onlyA++
+				continue
+			}
+			ra, rb := responseBody(ea), responseBody(bs[i])
+			if ra == rb {
+				same++
+				continue
+			}
+			changed++
+			fmt.Fprintf(t.w, "changed: %s\n", t.requestLine(ea))
+			fmt.Fprintf(t.w, "--- %s:%d\n+++ %s:%d\n", nameA, lineOf(ea.response), nameB, lineOf(bs[i].response))
+			for _, l := range diffLines(strings.Split(ra, "\n"), strings.Split(rb, "\n")) {
+				fmt.Fprintln(t.w, l)
+			}
+			fmt.Fprintln(t.w)
+		}
+	}
+	for _, key := range keysB {
+		as, bs := byKeyA[key], byKeyB[key]
+		for _, eb := range bs[min(len(as), len(bs)):] {
+			report(eb, "only in "+nameB+":")
+			onlyB++
+		}
+	}
+	fmt.Fprintf(t.w, "%d same, %d changed, %d only in %s, %d only in %s\n", same, changed, onlyA, nameA, onlyB, nameB)
+	return nil
+}
+
+// requestLine names a request by method and params.
+func (t *traceWriter) requestLine(e *traceEntry) string {
+	return clip(fmt.Sprintf("%s %s", e.method, canonicalParams(e.Message)), 160)
+}
+
+// canonicalParams is a request's params as compact JSON with sorted keys,
+// minus _meta, which carries per-run values such as progress tokens.
+func canonicalParams(message json.RawMessage) string {
+	var msg struct {
+		Params map[string]interface{} `json:"params"`
+	}
+	json.Unmarshal(message, &msg)
+	delete(msg.Params, "_meta")
+	if len(msg.Params) == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(msg.Params)
+	return string(data)
+}
+
+// responseBody is a response's result or error as indented JSON, or a note
+// that there was none.
+func responseBody(req *traceEntry) string {
+	if req.response == nil {
+		return "(no response)"
+	}
+	var msg struct {
+		Result interface{} `json:"result,omitempty"`
+		Error  interface{} `json:"error,omitempty"`
+	}
+	json.Unmarshal(req.response.Message, &msg)
+	data, _ := json.MarshalIndent(msg, "", "  ")
+	return string(data)
+}
+
+func lineOf(e *traceEntry) int {
+	if e == nil {
+		return 0
+	}
+	return e.line
+}
+
+// diffLines is a line diff of a and b from their longest common
+// subsequence, with unchanged lines indented by a space.
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	return out
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,187 @@
+// Command mcpflow is a command-line client and developer tooling for
+// MCP-Flow servers.
+//
+//	mcpflow init -addr localhost:4433
+//	mcpflow tools list -addr localhost:4433
+//	mcpflow tools call search -args '{"query":"quic"}' -addr localhost:4433
+//	mcpflow resources read file:///README.md -addr localhost:4433
+//	mcpflow ping -- ./my-stdio-server
+//	mcpflow repl -addr localhost:4433
+//	mcpflow top -admin 127.0.0.1:9090
+//	mcpflow doctor localhost:4433
+//	mcpflow proxy -listen :4434 -upstream localhost:4433 -record out.jsonl
+//	mcpflow inspect -stats out.jsonl
+//	mcpflow gen tool -schema search.json [-name search] [-o search_tool.go]
+//	mcpflow gen client -addr localhost:4433 [-o mcpclient/client.go]
+//	mcpflow gen ech-key -public-name example.com -o ech.pem
+//
+// The client commands connect over any transport mcpflowclient supports,
+// or run a stdio server named after "--", and print the server's result as
+// JSON for scripting. Errors go to stderr with a non-zero exit status.
+// repl is the same client for exploring a server by hand, with completion
+// of tool names and arguments from each tool's input schema. top watches a
+// server through its admin listener's /stats endpoint. doctor checks the
+// network path to a server layer by layer and says what to fix. proxy sits
+// between a client and server, relaying sessions and printing and recording
+// every frame, and inspect reads those recordings back.
+//
+// gen tool turns a tool's JSON Schema into Go: a typed params struct, the
+// schema as a constant, and a Tool skeleton whose Execute decodes and
+// validates the arguments before calling the run method left to fill in.
+//
+// gen client lists a running server's tools and writes a Go package with a
+// typed method per tool, built from each tool's input and output schemas.
+//
+// gen ech-key writes an Encrypted Client Hello key for a server's -ech-key
+// and prints the config clients pass as -ech-config.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// version is reported as clientInfo.version.
+	version = "1.0.0"
+	// latestProtocolVersion is requested at initialize, so servers send
+	// everything they can, such as outputSchema.
+	latestProtocolVersion = "2025-06-18"
+)
+
+const usage = `usage: mcpflow <command> [flags]
+
+commands:
+  init              initialize and print the server's initialize result
+  tools list        list the server's tools
+  tools call NAME   call a tool with -args '{...}'
+  resources list    list the server's resources
+  resources read URI
+                    read a resource
+  ping              ping the server and print the round trip time
+  repl              explore a server interactively
+  top               live view of a server's sessions, tools, and errors
+  doctor HOST:PORT  diagnose problems connecting to a server
+  proxy             relay sessions to a server, printing and recording frames
+  inspect TRACE     print, filter, pair, time, or diff a proxy recording
+  gen tool          generate a Go tool from a JSON Schema
+  gen client        generate a typed Go client for a server's tools
+  gen ech-key       generate an Encrypted Client Hello key for a server
+
+Run "mcpflow <command> -h" for its flags.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "mcpflow:", describeError(err))
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) >= 1 {
+		switch args[0] {
+		case "init":
+			return initCommand(args[1:], stdout)
+		case "ping":
+			return pingCommand(args[1:], stdout)
+		case "tools":
+			return toolsCommand(args[1:], stdout)
+		case "resources":
+			return resourcesCommand(args[1:], stdout)
+		case "repl":
+			return replCommand(args[1:], stdout)
+		case "top":
+			return topCommand(args[1:], stdout)
+		case "doctor":
+			return doctorCommand(args[1:], stdout)
+		case "proxy":
+			return proxyCommand(args[1:], stdout)
+		case "inspect":
+			return inspectCommand(args[1:], stdout)
+		}
+	}
+	if len(args) >= 2 && args[0] == "gen" {
+		switch args[1] {
+		case "tool":
+			return genToolCommand(args[2:], stdout)
+		case "client":
+			return genClientCommand(args[2:], stdout)
+		case "ech-key":
+			return genECHKeyCommand(args[2:], stdout)
+		}
+	}
+	fmt.Fprint(os.Stderr, usage)
+	if len(args) == 0 || args[0] == "-h" || args[0] == "help" {
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", strings.Join(args, " "))
+}
+
+// genToolCommand runs "mcpflow gen tool".
+func genToolCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcpflow gen tool", flag.ExitOnError)
+	schemaFile := fs.String("schema", "", "JSON Schema of the tool's arguments (required)")
+	name := fs.String("name", "", "Tool name (default: the schema's title, else the schema file's base name)")
+	description := fs.String("description", "", "Tool description (default: the schema's description)")
+	pkg := fs.String("package", "main", "Package of the generated file; tool plugins use main")
+	out := fs.String("o", "", "Write the generated code to this file instead of stdout")
+	force := fs.Bool("force", false, "Overwrite -o if it exists")
+	fs.Parse(args)
+
+	if *schemaFile == "" {
+		fs.Usage()
+		return errors.New("-schema is required")
+	}
+	data, err := os.ReadFile(*schemaFile)
+	if err != nil {
+		return err
+	}
+	src, err := generateTool(data, genOptions{
+		Name:        *name,
+		Description: *description,
+		Package:     *pkg,
+		Source:      filepath.Base(*schemaFile),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", *schemaFile, err)
+	}
+	return writeOutput(src, *out, *force, stdout)
+}
+
+// writeOutput writes generated code to path, or to stdout if path is empty.
+// An existing file is only replaced with force.
+func writeOutput(src []byte, path string, force bool, stdout io.Writer) error {
+	if path == "" {
+		_, err := io.Copy(stdout, bytes.NewReader(src))
+		return err
+	}
+	return writeFile(path, src, force, 0o644)
+}
+
+// writeFile writes data to a new file at path with permissions perm,
+// replacing an existing one only if force is set.
+func writeFile(path string, data []byte, force bool, perm os.FileMode) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, perm)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s exists; pass -force to overwrite it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+)
+
+// =============================================================================
+// Recording Proxy
+// =============================================================================
+
+// proxyCommand runs "mcpflow proxy": a man-in-the-middle for debugging that
+// accepts WebTransport and TCP+TLS sessions on -listen, relays each one
+// frame by frame to its own stream on -upstream, and prints and records
+// every frame on the way through. Frames are relayed byte for byte; the
+// only change is that a client's WebTransport bearer token is carried over
+// to the upstream connection, since it travels outside the frames.
+func proxyCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcpflow proxy", flag.ExitOnError)
+	listen := fs.String("listen", ":4434", "Address to accept WebTransport (UDP) and TCP+TLS (TCP) sessions on")
+	upstream := fs.String("upstream", "", "Server to relay to: host:port for WebTransport, tcp://host:port, or wss://host:port/path")
+	record := fs.String("record", "", "Append every frame to this JSON Lines file, for mcpflow inspect")
+	certFile := fs.String("cert", "", "TLS certificate for -listen (default: a self-signed one for localhost)")
+	keyFile := fs.String("key", "", "TLS key for -cert")
+	token := fs.String("token", "", "Bearer token for the upstream (default: the one each client sent)")
+	insecure := fs.Bool("insecure", false, "Skip TLS verification of the upstream (for self-signed certs)")
+	full := fs.Bool("full", false, "Print every frame in full instead of clipping it to one line")
+	quiet := fs.Bool("quiet", false, "Print only session events, not frames")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mcpflow proxy -upstream HOST:PORT [-listen :4434] [-record out.jsonl] [flags]")
+		fs.PrintDefaults()
+	}
+	if positional, _ := parseArgs(fs, args); len(positional) > 0 {
+		fs.Usage()
+		return fmt.Errorf("want 0 arguments, got %d", len(positional))
+	}
+	if *upstream == "" {
+		fs.Usage()
+		return errors.New("no upstream: set -upstream")
+	}
+	target, err := parseProxyUpstream(*upstream)
+	if err != nil {
+		return err
+	}
+	target.TLSConfig = &tls.Config{InsecureSkipVerify: *insecure}
+
+	cert, err := proxyCertificate(*certFile, *keyFile)
+	if err != nil {
+		return err
+	}
+	if *certFile == "" {
+		fmt.Fprintf(stdout, "using a self-signed certificate for localhost (sha256 %x); connect with -insecure\n", sha256.Sum256(cert.Certificate[0]))
+	}
+
+	p := &proxy{
+		out:      stdout,
+		upstream: target,
+		token:    *token,
+		full:     *full,
+		quiet:    *quiet,
+	}
+	if *record != "" {
+		f, err := os.OpenFile(*record, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("-record: %w", err)
+		}
+		defer f.Close()
+		p.record = json.NewEncoder(f)
+		p.record.SetEscapeHTML(false)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return p.serve(ctx, *listen, cert)
+}
+
+// parseProxyUpstream parses -upstream into client options for a single
+// framed transport.
+func parseProxyUpstream(s string) (mcpflowclient.Options, error) {
+	switch {
+	case strings.HasPrefix(s, "tcp://"):
+		return mcpflowclient.Options{TCPAddr: strings.TrimPrefix(s, "tcp://"), Order: []string{mcpflowclient.TransportTCP}}, nil
+	case strings.HasPrefix(s, "wss://"), strings.HasPrefix(s, "ws://"):
+		return mcpflowclient.Options{WebSocketURL: s, Order: []string{mcpflowclient.TransportWebSocket}}, nil
+	case strings.Contains(s, "://"):
+		return mcpflowclient.Options{}, fmt.Errorf("-upstream %q: want host:port, tcp://host:port, or wss://host:port/path", s)
+	}
+	return mcpflowclient.Options{Addr: s, Order: []string{mcpflowclient.TransportWebTransport}}, nil
+}
+
+// proxyCertificate loads -cert and -key, or makes a self-signed certificate
+// for localhost, valid for a day, when neither is set.
+func proxyCertificate(certFile, keyFile string) (tls.Certificate, error) {
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("load TLS cert: %w", err)
+		}
+		return cert, nil
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "mcpflow proxy"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// proxy relays sessions to the upstream and logs their frames.
+type proxy struct {
+	out      io.Writer
+	upstream mcpflowclient.Options
+	token    string
+	full     bool
+	quiet    bool
+
+	sessions atomic.Int64
+
+	mu     sync.Mutex // serializes output and record
+	record *json.Encoder
+}
+
+// serve accepts sessions until ctx ends.
+func (p *proxy) serve(ctx context.Context, addr string, cert tls.Certificate) error {
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13}
+
+	tcpConfig := tlsConfig.Clone()
+	tcpConfig.NextProtos = []string{"mcp-flow"}
+	ln, err := tls.Listen("tcp", addr, tcpConfig)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	wtServer := &webtransport.Server{
+		H3:          http3.Server{Addr: addr, TLSConfig: tlsConfig},
+		CheckOrigin: func(*http.Request) bool { return true },
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp-flow", func(w http.ResponseWriter, r *http.Request) {
+		session, err := wtServer.Upgrade(w, r)
+		if err != nil {
+			http.Error(w, "WebTransport upgrade failed", http.StatusBadRequest)
+			return
+		}
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		go func() {
+			stream, err := session.AcceptStream(ctx)
+			if err != nil {
+				session.CloseWithError(0, "")
+				return
+			}
+			p.relay(ctx, "webtransport", r.RemoteAddr, stream, func() error {
+				stream.Close()
+				return session.CloseWithError(0, "")
+			}, token)
+		}()
+	})
+	wtServer.H3.Handler = mux
+	defer wtServer.Close()
+
+	errCh := make(chan error, 2)
+	go func() { errCh <- wtServer.ListenAndServe() }()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				errCh <- err
+				return
+			}
+			go p.relay(ctx, "tcp", conn.RemoteAddr().String(), conn, conn.Close, "")
+		}
+	}()
+
+	p.logf("proxying %s (WebTransport and TCP+TLS) to %s\n", addr, proxyUpstreamName(p.upstream))
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
+
+func proxyUpstreamName(o mcpflowclient.Options) string {
+	if o.TCPAddr != "" {
+		return "tcp://" + o.TCPAddr
+	}
+	return firstNonEmpty(o.Addr, o.WebSocketURL)
+}
+
+// proxyRecord is one line of a -record file: a session event or a frame.
+type proxyRecord struct {
+	Time      time.Time `json:"time"`
+	Session   int64     `json:"session"`
+	Event     string    `json:"event,omitempty"`
+	Transport string    `json:"transport,omitempty"`
+	Remote    string    `json:"remote,omitempty"`
+	Upstream  string    `json:"upstream,omitempty"`
+	Error     string    `json:"error,omitempty"`
+
+	// Direction is "c2s" for frames from the client and "s2c" for frames
+	// from the server. Message holds a frame that is valid JSON, Raw one
+	// that is not.
+	Direction string          `json:"direction,omitempty"`
+	Size      int             `json:"size,omitempty"`
+	Message   json.RawMessage `json:"message,omitempty"`
+	Raw       string          `json:"raw,omitempty"`
+}
+
+// relay connects one client stream to its own upstream stream and copies
+// frames both ways until either side closes.
+func (p *proxy) relay(ctx context.Context, transport, remote string, client io.ReadWriter, closeClient func() error, clientToken string) {
+	id := p.sessions.Add(1)
+	defer closeClient()
+
+	opts := p.upstream
+	opts.Token = firstNonEmpty(p.token, clientToken)
+	upstream, upstreamTransport, err := mcpflowclient.DialStream(ctx, opts)
+	if err != nil {
+		p.event(proxyRecord{Session: id, Event: "open", Transport: transport, Remote: remote, Error: err.Error()})
+		return
+	}
+	defer upstream.Close()
+	p.event(proxyRecord{Session: id, Event: "open", Transport: transport, Remote: remote, Upstream: upstreamTransport})
+
+	pending := &proxyPending{started: map[string]time.Time{}}
+	errCh := make(chan error, 2)
+	go func() { errCh <- p.copyFrames(id, "c2s", upstream, client, pending) }()
+	go func() { errCh <- p.copyFrames(id, "s2c", client, upstream, pending) }()
+
+	err = <-errCh
+	closeClient()
+	upstream.Close()
+	<-errCh
+
+	end := proxyRecord{Session: id, Event: "close"}
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+		end.Error = err.Error()
+	}
+	p.event(end)
+}
+
+// proxyPending remembers when each request was relayed, so responses can
+// be printed with their latency. Keys are the direction and ID of the
+// request, as either side may send requests.
+type proxyPending struct {
+	mu      sync.Mutex
+	started map[string]time.Time
+}
+
+// proxyMaxFrameSize mirrors the server's frame limit.
+const proxyMaxFrameSize = 16 * 1024 * 1024
+
+// copyFrames relays frames from src to dst, logging each one.
+func (p *proxy) copyFrames(session int64, direction string, dst io.Writer, src io.Reader, pending *proxyPending) error {
+	br := bufio.NewReader(src)
+	for {
+		var lengthBuf [4]byte
+		if _, err := io.ReadFull(br, lengthBuf[:]); err != nil {
+			return err
+		}
+		length := binary.BigEndian.Uint32(lengthBuf[:])
+		if length > proxyMaxFrameSize {
+			return fmt.Errorf("frame size %d exceeds maximum %d", length, proxyMaxFrameSize)
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(br, body); err != nil {
+			return err
+		}
+		p.frame(session, direction, body, pending)
+		if _, err := dst.Write(append(lengthBuf[:], body...)); err != nil {
+			return err
+		}
+	}
+}
+
+// =============================================================================
+// Output
+// =============================================================================
+
+func (p *proxy) logf(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.out, format, args...)
+}
+
+func (p *proxy) event(rec proxyRecord) {
+	rec.Time = time.Now().UTC()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case rec.Event == "open" && rec.Error != "":
+		fmt.Fprintf(p.out, "%s #%d %s session from %s: upstream: %s\n", rec.Time.Local().Format("15:04:05.000"), rec.Session, rec.Transport, rec.Remote, rec.Error)
+	case rec.Event == "open":
+		fmt.Fprintf(p.out, "%s #%d %s session from %s, upstream over %s\n", rec.Time.Local().Format("15:04:05.000"), rec.Session, rec.Transport, rec.Remote, rec.Upstream)
+	case rec.Error != "":
+		fmt.Fprintf(p.out, "%s #%d closed: %s\n", rec.Time.Local().Format("15:04:05.000"), rec.Session, rec.Error)
+	default:
+		fmt.Fprintf(p.out, "%s #%d closed\n", rec.Time.Local().Format("15:04:05.000"), rec.Session)
+	}
+	p.writeRecord(rec)
+}
+
+// frame prints and records one relayed frame.
+func (p *proxy) frame(session int64, direction string, body []byte, pending *proxyPending) {
+	now := time.Now()
+	rec := proxyRecord{Time: now.UTC(), Session: session, Direction: direction, Size: len(body)}
+	var msg struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	summary := "invalid JSON"
+	if json.Unmarshal(body, &msg) == nil {
+		rec.Message = body
+		summary = proxySummary(direction, msg.ID, msg.Method, now, pending)
+		if msg.Error != nil {
+			summary += fmt.Sprintf(" error %d %s", msg.Error.Code, msg.Error.Message)
+		}
+	} else {
+		rec.Raw = string(body)
+	}
+
+	arrow := "→"
+	if direction == "s2c" {
+		arrow = "←"
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.quiet {
+		fmt.Fprintf(p.out, "%s #%d %s %s (%d bytes)\n", now.Format("15:04:05.000"), session, arrow, summary, len(body))
+		text := string(body)
+		if !p.full {
+			text = clip(text, 160)
+		}
+		fmt.Fprintf(p.out, "    %s\n", text)
+	}
+	p.writeRecord(rec)
+}
+
+// proxySummary names a message: the method and ID of a request, the method
+// of a notification, or the ID and latency of a response.
+func proxySummary(direction string, id json.RawMessage, method string, now time.Time, pending *proxyPending) string {
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	switch {
+	case method != "" && id != nil:
+		pending.started[direction+string(id)] = now
+		return fmt.Sprintf("%s id=%s", method, id)
+	case method != "":
+		return method
+	case id != nil:
+		requestDirection := "c2s"
+		if direction == "c2s" {
+			requestDirection = "s2c"
+		}
+		key := requestDirection + string(id)
+		if start, ok := pending.started[key]; ok {
+			delete(pending.started, key)
+			return fmt.Sprintf("response id=%s after %s", id, formatRTT(now.Sub(start)))
+		}
+		return fmt.Sprintf("response id=%s", id)
+	}
+	return "message"
+}
+
+// writeRecord appends rec to the -record file. The caller holds p.mu.
+func (p *proxy) writeRecord(rec proxyRecord) {
+	if p.record == nil {
+		return
+	}
+	if err := p.record.Encode(rec); err != nil {
+		fmt.Fprintln(p.out, "record:", err)
+		p.record = nil
+	}
+}
@@ -0,0 +1,885 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/term"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+)
+
+// =============================================================================
+// REPL
+// =============================================================================
+
+// replHistorySize is how many lines of the history file are loaded at
+// startup; it matches the terminal's in-memory history.
+const replHistorySize = 100
+
+const replHelp = `commands:
+  tools                       list the server's tools
+  describe TOOL               show a tool's description and arguments
+  TOOL [arg=value ...]        call a tool; values are JSON, or strings
+  TOOL {"arg": ...}           call a tool with a JSON object of arguments
+  resources                   list the server's resources
+  read URI                    read a resource
+  prompts                     list the server's prompts
+  ping                        ping the server
+  rpc METHOD [JSON]           send any request
+  help                        show this help
+  exit                        leave (or Ctrl-D)
+
+Tab completes commands, tool names, argument names, and enum values.
+Ctrl-C cancels a request in flight.
+`
+
+// replCommand runs "mcpflow repl".
+func replCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcpflow repl", flag.ExitOnError)
+	conn := addConnFlags(fs)
+	timeout := fs.Duration("timeout", 30*time.Second, "Timeout for each request")
+	historyFile := fs.String("history", defaultHistoryFile(), `File the command history is kept in ("" keeps none)`)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: mcpflow repl [flags] [-- stdio server command]")
+		fs.PrintDefaults()
+	}
+	positional, command := parseArgs(fs, args)
+	if len(positional) > 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q; put a stdio server command after --", positional[0])
+	}
+
+	r := &repl{out: stdout, timeout: *timeout}
+	r.interactive = term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+	conn.onNotification = r.notification
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	c, err := conn.connect(ctx, command)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	r.c = c
+
+	r.caps = c.ServerCapabilities()
+	r.refreshTools()
+	r.refreshResources()
+	if r.interactive {
+		info := c.ServerInfo()
+		fmt.Fprintf(stdout, "Connected to %s %s over %s. Type help for commands.\n", info.Name, info.Version, c.Transport())
+		return r.runTerminal(*historyFile)
+	}
+	return r.runLines(os.Stdin)
+}
+
+// repl is an interactive session with one server.
+type repl struct {
+	c           *mcpflowclient.Client
+	out         io.Writer
+	timeout     time.Duration
+	interactive bool
+	caps        mcpflowclient.Capabilities
+
+	mu        sync.Mutex
+	term      *term.Terminal // set while a line is being read
+	tools     []toolInfo
+	schemas   map[string]*jsonSchema
+	resources []string
+}
+
+// runTerminal reads commands with line editing, completion, and history.
+// The terminal is only raw while a line is being edited, so Ctrl-C reaches
+// the request in flight as a signal.
+func (r *repl) runTerminal(historyFile string) error {
+	rw := &switchedIO{r: os.Stdin, w: os.Stdout}
+	t := term.NewTerminal(rw, "mcpflow> ")
+	t.AutoCompleteCallback = r.autoComplete
+	loadHistory(t, rw, historyFile)
+
+	for {
+		state, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.term = t
+		r.mu.Unlock()
+		line, err := t.ReadLine()
+		r.mu.Lock()
+		r.term = nil
+		r.mu.Unlock()
+		term.Restore(int(os.Stdin.Fd()), state)
+		if err == io.EOF {
+			fmt.Fprintln(r.out)
+			return nil
+		}
+		if err != nil && err != term.ErrPasteIndicator {
+			return err
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		appendHistory(historyFile, line)
+		if r.exec(line) {
+			return nil
+		}
+	}
+}
+
+// runLines reads commands from a pipe, one per line, without editing.
+func (r *repl) runLines(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		if r.exec(scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// exec runs one command line and reports whether the session should end.
+func (r *repl) exec(line string) (exit bool) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cmd, rest := cutWord(line)
+	var err error
+	switch cmd {
+	case "exit", "quit":
+		return true
+	case "help", "?":
+		fmt.Fprint(r.out, replHelp)
+	case "tools":
+		err = r.listTools(ctx)
+	case "describe":
+		err = r.describe(strings.TrimSpace(rest))
+	case "call":
+		name, args := cutWord(rest)
+		err = r.callTool(ctx, name, args)
+	case "resources":
+		err = r.listResources(ctx)
+	case "read":
+		err = r.read(ctx, strings.TrimSpace(rest))
+	case "prompts":
+		err = r.listPrompts(ctx)
+	case "ping":
+		start := time.Now()
+		if err = r.c.Call(ctx, "ping", nil, nil); err == nil {
+			fmt.Fprintf(r.out, "pong in %s\n", time.Since(start).Round(time.Microsecond))
+		}
+	case "rpc":
+		method, params := cutWord(rest)
+		err = r.rpc(ctx, method, params)
+	default:
+		if r.schema(cmd) == nil {
+			err = fmt.Errorf("unknown command or tool %q; type help for commands", cmd)
+			break
+		}
+		err = r.callTool(ctx, cmd, rest)
+	}
+	if errors.Is(err, context.Canceled) {
+		err = errors.New("canceled")
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, r.style(ansiRed, "error: ")+describeError(err))
+	}
+	return false
+}
+
+// =============================================================================
+// Commands
+// =============================================================================
+
+func (r *repl) listTools(ctx context.Context) error {
+	tools, err := listTools(ctx, r.c)
+	if err != nil {
+		return err
+	}
+	r.setTools(tools)
+	width := 0
+	for _, t := range tools {
+		width = max(width, len(t.Name))
+	}
+	for _, t := range tools {
+		fmt.Fprintf(r.out, "%s  %s\n", r.style(ansiBold, fmt.Sprintf("%-*s", width, t.Name)), firstLine(t.Description))
+	}
+	if len(tools) == 0 {
+		fmt.Fprintln(r.out, "(no tools)")
+	}
+	return nil
+}
+
+func (r *repl) describe(name string) error {
+	r.mu.Lock()
+	var tool *toolInfo
+	for i := range r.tools {
+		if r.tools[i].Name == name {
+			tool = &r.tools[i]
+		}
+	}
+	r.mu.Unlock()
+	if tool == nil {
+		return fmt.Errorf("unknown tool %q", name)
+	}
+	fmt.Fprintln(r.out, r.style(ansiBold, tool.Name))
+	if tool.Description != "" {
+		fmt.Fprintln(r.out, tool.Description)
+	}
+	schema := r.schema(name)
+	if schema == nil || len(schema.Properties) == 0 {
+		fmt.Fprintln(r.out, "\nNo arguments.")
+		return nil
+	}
+	fmt.Fprintln(r.out, "\nArguments:")
+	for _, p := range schema.Properties {
+		prop := resolveProperty(schema, p.schema)
+		typ := prop.kind()
+		if typ == "" {
+			typ = "any"
+		}
+		var notes []string
+		if contains(schema.Required, p.name) {
+			notes = append(notes, "required")
+		}
+		if len(prop.Enum) > 0 {
+			notes = append(notes, "one of "+strings.Join(enumValues(prop), ", "))
+		}
+		if prop.HasDefault {
+			def, _ := json.Marshal(prop.Default)
+			notes = append(notes, "default "+string(def))
+		}
+		line := fmt.Sprintf("  %s %s", r.style(ansiBold, p.name), typ)
+		if len(notes) > 0 {
+			line += " (" + strings.Join(notes, "; ") + ")"
+		}
+		fmt.Fprintln(r.out, line)
+		if prop.Description != "" {
+			fmt.Fprintln(r.out, "      "+prop.Description)
+		}
+	}
+	return nil
+}
+
+func (r *repl) callTool(ctx context.Context, name, args string) error {
+	if name == "" {
+		return errors.New("usage: call TOOL [arg=value ...]")
+	}
+	arguments, err := r.parseToolArgs(name, args)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Content           []json.RawMessage `json:"content"`
+		StructuredContent json.RawMessage   `json:"structuredContent"`
+		IsError           bool              `json:"isError"`
+		Meta              struct {
+			Warnings []string `json:"warnings"`
+		} `json:"_meta"`
+	}
+	start := time.Now()
+	if err := r.c.Call(ctx, "tools/call", map[string]interface{}{"name": name, "arguments": arguments}, &result); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	for _, w := range result.Meta.Warnings {
+		fmt.Fprintln(r.out, r.style(ansiYellow, "warning: ")+w)
+	}
+	if result.IsError {
+		fmt.Fprintln(r.out, r.style(ansiRed, "tool error:"))
+	}
+	for _, item := range result.Content {
+		r.printContent(item)
+	}
+	if len(result.StructuredContent) > 0 {
+		fmt.Fprintln(r.out, r.style(ansiDim, "structured content:"))
+		r.printJSON(result.StructuredContent)
+	}
+	fmt.Fprintln(r.out, r.style(ansiDim, fmt.Sprintf("(%s)", elapsed.Round(time.Millisecond))))
+	return nil
+}
+
+func (r *repl) listResources(ctx context.Context) error {
+	resources, err := listAll(ctx, r.c, "resources/list", "resources")
+	if err != nil {
+		return err
+	}
+	uris := make([]string, 0, len(resources))
+	for _, raw := range resources {
+		var res struct {
+			URI      string `json:"uri"`
+			Name     string `json:"name"`
+			MimeType string `json:"mimeType"`
+		}
+		json.Unmarshal(raw, &res)
+		uris = append(uris, res.URI)
+		fmt.Fprintf(r.out, "%s  %s %s\n", r.style(ansiBold, res.URI), res.Name, r.style(ansiDim, res.MimeType))
+	}
+	if len(resources) == 0 {
+		fmt.Fprintln(r.out, "(no resources)")
+	}
+	r.mu.Lock()
+	r.resources = uris
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *repl) read(ctx context.Context, uri string) error {
+	if uri == "" {
+		return errors.New("usage: read URI")
+	}
+	var result struct {
+		Contents []json.RawMessage `json:"contents"`
+	}
+	if err := r.c.Call(ctx, "resources/read", map[string]interface{}{"uri": uri}, &result); err != nil {
+		return err
+	}
+	for _, item := range result.Contents {
+		r.printContent(item)
+	}
+	return nil
+}
+
+func (r *repl) listPrompts(ctx context.Context) error {
+	prompts, err := listAll(ctx, r.c, "prompts/list", "prompts")
+	if err != nil {
+		return err
+	}
+	for _, raw := range prompts {
+		var p struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+		json.Unmarshal(raw, &p)
+		fmt.Fprintf(r.out, "%s  %s\n", r.style(ansiBold, p.Name), firstLine(p.Description))
+	}
+	if len(prompts) == 0 {
+		fmt.Fprintln(r.out, "(no prompts)")
+	}
+	return nil
+}
+
+func (r *repl) rpc(ctx context.Context, method, params string) error {
+	if method == "" {
+		return errors.New("usage: rpc METHOD [JSON]")
+	}
+	var p interface{}
+	if params = strings.TrimSpace(params); params != "" {
+		if !json.Valid([]byte(params)) {
+			return fmt.Errorf("params are not valid JSON: %s", params)
+		}
+		p = json.RawMessage(params)
+	}
+	var raw json.RawMessage
+	if err := r.c.Call(ctx, method, p, &raw); err != nil {
+		return err
+	}
+	r.printJSON(raw)
+	return nil
+}
+
+// notification prints what the server sends on its own and keeps the
+// completion lists current. It runs on the transport's reader, so refreshes
+// happen on their own goroutine.
+func (r *repl) notification(method string, params json.RawMessage) {
+	switch method {
+	case "notifications/tools/list_changed":
+		go r.refreshTools()
+	case "notifications/resources/list_changed":
+		go r.refreshResources()
+	}
+	line := r.style(ansiDim, "notification: "+method)
+	if len(params) > 0 && string(params) != "{}" && string(params) != "null" {
+		line += " " + string(params)
+	}
+	r.mu.Lock()
+	t := r.term
+	r.mu.Unlock()
+	if t != nil {
+		// Writing through the terminal redraws the line being edited.
+		t.Write([]byte(line + "\n"))
+		return
+	}
+	fmt.Fprintln(r.out, line)
+}
+
+func (r *repl) refreshTools() {
+	if r.caps != nil && !r.caps.Has("tools") {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	if tools, err := listTools(ctx, r.c); err == nil {
+		r.setTools(tools)
+	}
+}
+
+func (r *repl) refreshResources() {
+	if r.caps != nil && !r.caps.Has("resources") {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	resources, err := listAll(ctx, r.c, "resources/list", "resources")
+	if err != nil {
+		return
+	}
+	uris := make([]string, 0, len(resources))
+	for _, raw := range resources {
+		var res struct {
+			URI string `json:"uri"`
+		}
+		json.Unmarshal(raw, &res)
+		uris = append(uris, res.URI)
+	}
+	r.mu.Lock()
+	r.resources = uris
+	r.mu.Unlock()
+}
+
+func (r *repl) setTools(tools []toolInfo) {
+	schemas := make(map[string]*jsonSchema, len(tools))
+	for _, t := range tools {
+		var s jsonSchema
+		if json.Unmarshal(t.InputSchema, &s) == nil {
+			schemas[t.Name] = &s
+		}
+	}
+	r.mu.Lock()
+	r.tools, r.schemas = tools, schemas
+	r.mu.Unlock()
+}
+
+// schema returns a tool's parsed input schema, or nil for unknown tools.
+func (r *repl) schema(name string) *jsonSchema {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.schemas[name]
+}
+
+// =============================================================================
+// Arguments
+// =============================================================================
+
+// parseToolArgs turns what follows a tool name into its arguments: either a
+// JSON object, or arg=value words. A value is used as a string when the
+// argument is a string or when it is not valid JSON.
+func (r *repl) parseToolArgs(name, args string) (json.RawMessage, error) {
+	args = strings.TrimSpace(args)
+	if strings.HasPrefix(args, "{") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(args), &obj); err != nil {
+			return nil, fmt.Errorf("arguments: %w", err)
+		}
+		return json.RawMessage(args), nil
+	}
+	words, err := splitWords(args)
+	if err != nil {
+		return nil, err
+	}
+	schema := r.schema(name)
+	arguments := make(map[string]json.RawMessage, len(words))
+	for _, word := range words {
+		key, value, ok := strings.Cut(word, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%q: want arg=value", word)
+		}
+		prop := &jsonSchema{}
+		if schema != nil {
+			for _, p := range schema.Properties {
+				if p.name == key {
+					prop = resolveProperty(schema, p.schema)
+				}
+			}
+		}
+		kind := prop.kind()
+		if kind != "string" && json.Valid([]byte(value)) {
+			arguments[key] = json.RawMessage(value)
+			continue
+		}
+		if kind != "string" && kind != "" {
+			return nil, fmt.Errorf("%s: want %s, got %s", key, typeNoun(prop), value)
+		}
+		arguments[key], _ = json.Marshal(value)
+	}
+	return json.Marshal(arguments)
+}
+
+// splitWords splits a line into words at unquoted spaces. Single quotes
+// keep everything literally; double quotes and backslashes escape like a
+// shell's.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, escaped := false, false
+	var quote rune
+	for _, c := range s {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			word.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == '\\':
+			escaped, inWord = true, true
+		case unicode.IsSpace(c):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// cutWord splits off the first space-separated word of s.
+func cutWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexFunc(s, unicode.IsSpace); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// resolveProperty follows a property's local $ref into the root schema's
+// definitions, if it has one.
+func resolveProperty(root, s *jsonSchema) *jsonSchema {
+	for _, prefix := range []string{"#/$defs/", "#/definitions/"} {
+		if name, ok := strings.CutPrefix(s.Ref, prefix); ok && root.Defs[name] != nil {
+			return root.Defs[name]
+		}
+	}
+	return s
+}
+
+// enumValues are the values an argument allows, as they are typed.
+func enumValues(s *jsonSchema) []string {
+	values := make([]string, 0, len(s.Enum))
+	for _, v := range s.Enum {
+		if str, ok := v.(string); ok {
+			if strings.ContainsAny(str, " \t\"'\\") {
+				str = strconv.Quote(str)
+			}
+			values = append(values, str)
+			continue
+		}
+		b, _ := json.Marshal(v)
+		values = append(values, string(b))
+	}
+	return values
+}
+
+// =============================================================================
+// Completion
+// =============================================================================
+
+var replCommands = []string{"call", "describe", "exit", "help", "ping", "prompts", "read", "resources", "rpc", "tools"}
+
+// autoComplete completes the word before the cursor when Tab is pressed.
+// With several candidates it extends the word to their common prefix, and
+// lists them when it cannot.
+func (r *repl) autoComplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	start := strings.LastIndexFunc(line[:pos], unicode.IsSpace) + 1
+	cur := line[start:pos]
+	words, err := splitWords(line[:start])
+	if err != nil {
+		return "", 0, false
+	}
+
+	var matches []string
+	for _, c := range r.candidates(words, cur) {
+		if strings.HasPrefix(c, cur) {
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	sort.Strings(matches)
+	completion := matches[0]
+	if len(matches) == 1 {
+		if !strings.HasSuffix(completion, "=") {
+			completion += " "
+		}
+	} else {
+		for _, m := range matches[1:] {
+			completion = completion[:commonPrefix(completion, m)]
+		}
+		if completion == cur {
+			r.mu.Lock()
+			t := r.term
+			r.mu.Unlock()
+			if t != nil {
+				t.Write([]byte(strings.Join(matches, "  ") + "\n"))
+			}
+			return "", 0, false
+		}
+	}
+	return line[:start] + completion + line[pos:], start + len(completion), true
+}
+
+// candidates lists the possible completions of the word after words.
+func (r *repl) candidates(words []string, cur string) []string {
+	r.mu.Lock()
+	var toolNames []string
+	for _, t := range r.tools {
+		toolNames = append(toolNames, t.Name)
+	}
+	resources := r.resources
+	r.mu.Unlock()
+
+	if len(words) == 0 {
+		return append(append([]string(nil), replCommands...), toolNames...)
+	}
+	switch {
+	case len(words) == 1 && (words[0] == "call" || words[0] == "describe"):
+		return toolNames
+	case len(words) == 1 && words[0] == "read":
+		return resources
+	case words[0] == "call":
+		words = words[1:]
+	}
+	schema := r.schema(words[0])
+	if schema == nil {
+		return nil
+	}
+
+	if name, _, ok := strings.Cut(cur, "="); ok {
+		for _, p := range schema.Properties {
+			if p.name != name {
+				continue
+			}
+			prop := resolveProperty(schema, p.schema)
+			values := enumValues(prop)
+			if prop.kind() == "boolean" {
+				values = []string{"true", "false"}
+			}
+			for i, v := range values {
+				values[i] = name + "=" + v
+			}
+			return values
+		}
+		return nil
+	}
+	given := make(map[string]bool)
+	for _, w := range words[1:] {
+		if name, _, ok := strings.Cut(w, "="); ok {
+			given[name] = true
+		}
+	}
+	var names []string
+	for _, p := range schema.Properties {
+		if !given[p.name] {
+			names = append(names, p.name+"=")
+		}
+	}
+	return names
+}
+
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// =============================================================================
+// History
+// =============================================================================
+
+// switchedIO is the terminal's input and output, which loadHistory swaps
+// while it replays old lines.
+type switchedIO struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (s *switchedIO) Read(p []byte) (int, error)  { return s.r.Read(p) }
+func (s *switchedIO) Write(p []byte) (int, error) { return s.w.Write(p) }
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".mcpflow_history")
+}
+
+// loadHistory fills the terminal's history from the end of path. The
+// terminal has no way to set its history, so the lines are typed into it
+// with its output discarded.
+func loadHistory(t *term.Terminal, rw *switchedIO, path string) {
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && len(line) < 4096 && !strings.ContainsFunc(line, unicode.IsControl) {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > replHistorySize {
+		lines = lines[len(lines)-replHistorySize:]
+	}
+	if len(lines) == 0 {
+		return
+	}
+	in, out := rw.r, rw.w
+	rw.r, rw.w = strings.NewReader(strings.Join(lines, "\r")+"\r"), io.Discard
+	for range lines {
+		if _, err := t.ReadLine(); err != nil {
+			break
+		}
+	}
+	rw.r, rw.w = in, out
+}
+
+func appendHistory(path, line string) {
+	if path == "" {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
+
+// =============================================================================
+// Output
+// =============================================================================
+
+const (
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiGreen  = "\x1b[32m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiReset  = "\x1b[0m"
+)
+
+// style wraps s in an ANSI style on a terminal.
+func (r *repl) style(code, s string) string {
+	if !r.interactive {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// printContent prints one content item of a tool result or resource: text
+// as it is, and binary data as a summary.
+func (r *repl) printContent(raw json.RawMessage) {
+	var item struct {
+		Type     string          `json:"type"`
+		Text     *string         `json:"text"`
+		Data     string          `json:"data"`
+		Blob     string          `json:"blob"`
+		MimeType string          `json:"mimeType"`
+		URI      string          `json:"uri"`
+		Resource json.RawMessage `json:"resource"`
+	}
+	if err := json.Unmarshal(raw, &item); err != nil {
+		r.printJSON(raw)
+		return
+	}
+	switch {
+	case item.Text != nil:
+		text := *item.Text
+		if item.URI != "" {
+			fmt.Fprintln(r.out, r.style(ansiDim, item.URI))
+		}
+		if json.Valid([]byte(text)) && strings.HasPrefix(strings.TrimSpace(text), "{") {
+			r.printJSON(json.RawMessage(text))
+			return
+		}
+		fmt.Fprintln(r.out, strings.TrimRight(text, "\n"))
+	case item.Data != "" || item.Blob != "":
+		size := len(item.Data+item.Blob) * 3 / 4
+		label := firstNonEmpty(item.Type, "blob")
+		fmt.Fprintln(r.out, r.style(ansiDim, fmt.Sprintf("[%s %s, %s]", label, item.MimeType, formatSize(size))))
+	case item.Type == "resource" && len(item.Resource) > 0:
+		r.printContent(item.Resource)
+	case item.Type == "resource_link":
+		fmt.Fprintln(r.out, r.style(ansiDim, "[link]")+" "+item.URI)
+	default:
+		r.printJSON(raw)
+	}
+}
+
+func (r *repl) printJSON(raw json.RawMessage) {
+	if !json.Valid(raw) {
+		fmt.Fprintln(r.out, string(raw))
+		return
+	}
+	printJSON(r.out, raw)
+}
+
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// =============================================================================
+// Top
+// =============================================================================
+
+// serverStats mirrors the server's ServerStats, served at /stats on the
+// admin listener.
+type serverStats struct {
+	Time     time.Time         `json:"time"`
+	Started  time.Time         `json:"started"`
+	Draining bool              `json:"draining"`
+	InFlight int               `json:"inFlight"`
+	Sessions []sessionStats    `json:"sessions"`
+	Requests map[string]uint64 `json:"requests"`
+	Errors   []struct {
+		Code  int    `json:"code"`
+		Name  string `json:"name"`
+		Count uint64 `json:"count"`
+	} `json:"errors"`
+	Tools          []toolStats `json:"tools"`
+	LatencyBuckets []float64   `json:"latencyBuckets"`
+}
+
+type sessionStats struct {
+	ID              uint64    `json:"id"`
+	Transport       string    `json:"transport"`
+	Remote          string    `json:"remote"`
+	Client          string    `json:"client"`
+	ProtocolVersion string    `json:"protocolVersion"`
+	Tenant          string    `json:"tenant"`
+	Started         time.Time `json:"started"`
+	LastActive      time.Time `json:"lastActive"`
+	Requests        uint64    `json:"requests"`
+	RTT             float64   `json:"rtt"`
+}
+
+type toolStats struct {
+	Name    string   `json:"name"`
+	Calls   uint64   `json:"calls"`
+	Errors  uint64   `json:"errors"`
+	Seconds float64  `json:"seconds"`
+	Buckets []uint64 `json:"buckets"`
+}
+
+// topCommand runs "mcpflow top".
+func topCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mcpflow top", flag.ExitOnError)
+	admin := fs.String("admin", "http://127.0.0.1:9090", "The server's admin listener (its -admin-addr)")
+	token := fs.String("token", os.Getenv("MCPFLOW_AUTH_TOKEN"), "The server's -auth-token, if it has one (default $MCPFLOW_AUTH_TOKEN)")
+	interval := fs.Duration("interval", time.Second, "How often to refresh")
+	window := fs.Duration("window", 10*time.Second, "Span that rates and latencies are computed over")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		*admin = fs.Arg(0)
+	}
+	if !strings.Contains(*admin, "://") {
+		*admin = "http://" + *admin
+	}
+
+	t := &top{
+		url:    strings.TrimSuffix(*admin, "/") + "/stats",
+		token:  *token,
+		window: *window,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		// One frame, with rates over a single interval.
+		if err := t.poll(); err != nil {
+			return err
+		}
+		time.Sleep(*interval)
+		if err := t.poll(); err != nil {
+			return err
+		}
+		_, err := io.WriteString(stdout, strings.Join(t.render(0, 0), "\n")+"\n")
+		return err
+	}
+	return t.run(stdout, *interval)
+}
+
+// top polls /stats and renders a full-screen view of the latest snapshot,
+// with rates taken against the oldest snapshot still inside the window.
+type top struct {
+	url     string
+	token   string
+	window  time.Duration
+	client  *http.Client
+	samples []*serverStats
+	err     error
+}
+
+// run redraws every interval until q or Ctrl-C.
+func (t *top) run(stdout io.Writer, interval time.Duration) error {
+	keys := make(chan byte, 1)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		state, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return err
+		}
+		defer term.Restore(int(os.Stdin.Fd()), state)
+		go func() {
+			buf := make([]byte, 1)
+			for {
+				if _, err := os.Stdin.Read(buf); err != nil {
+					close(keys)
+					return
+				}
+				keys <- buf[0]
+			}
+		}()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Switch to the alternate screen and hide the cursor while running.
+	fmt.Fprint(stdout, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(stdout, "\x1b[?25h\x1b[?1049l")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		t.err = t.poll()
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			width, height = 120, 40
+		}
+		var frame strings.Builder
+		frame.WriteString("\x1b[H")
+		for _, line := range t.render(width, height) {
+			frame.WriteString(line + "\x1b[K\r\n")
+		}
+		frame.WriteString("\x1b[J")
+		io.WriteString(stdout, frame.String())
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case key, ok := <-keys:
+			if !ok || key == 'q' || key == 3 {
+				return nil
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *top) poll() error {
+	req, err := http.NewRequest(http.MethodGet, t.url, nil)
+	if err != nil {
+		return err
+	}
+	if t.token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s: %s", t.url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	var stats serverStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return fmt.Errorf("%s: %w", t.url, err)
+	}
+
+	t.samples = append(t.samples, &stats)
+	// Keep the newest sample at or beyond the window as the baseline.
+	for len(t.samples) > 2 && stats.Time.Sub(t.samples[1].Time) >= t.window {
+		t.samples = t.samples[1:]
+	}
+	return nil
+}
+
+// render lays out the latest snapshot in at most height lines of width
+// columns; zero means unlimited.
+func (t *top) render(width, height int) []string {
+	var lines []string
+	if len(t.samples) == 0 {
+		lines = append(lines, "mcpflow top: "+t.url)
+		if t.err != nil {
+			lines = append(lines, "error: "+t.err.Error())
+		}
+		return lines
+	}
+	cur := t.samples[len(t.samples)-1]
+	prev := t.samples[0]
+	elapsed := cur.Time.Sub(prev.Time).Seconds()
+	rate := func(now, before uint64) float64 {
+		if elapsed <= 0 || now < before {
+			return 0
+		}
+		return float64(now-before) / elapsed
+	}
+
+	var total, totalBefore, errs, errsBefore uint64
+	for method, n := range cur.Requests {
+		total += n
+		totalBefore += prev.Requests[method]
+	}
+	prevErrors := make(map[int]uint64)
+	for _, e := range prev.Errors {
+		prevErrors[e.Code] = e.Count
+		errsBefore += e.Count
+	}
+	for _, e := range cur.Errors {
+		errs += e.Count
+	}
+	status := fmt.Sprintf("mcpflow top - %s  up %s  sessions %d  in flight %d  %.1f req/s  %.1f err/s",
+		strings.TrimSuffix(t.url, "/stats"), formatAge(cur.Time.Sub(cur.Started)), len(cur.Sessions), cur.InFlight,
+		rate(total, totalBefore), rate(errs, errsBefore))
+	if cur.Draining {
+		status += "  DRAINING"
+	}
+	lines = append(lines, status)
+	if t.err != nil {
+		lines = append(lines, "error: "+t.err.Error()+" (showing the last snapshot)")
+	}
+
+	// Tools, busiest first.
+	prevTools := make(map[string]toolStats)
+	for _, tool := range prev.Tools {
+		prevTools[tool.Name] = tool
+	}
+	type toolRow struct {
+		name          string
+		rate          float64
+		calls, errors uint64
+		avg, p95      string
+	}
+	var tools []toolRow
+	for _, tool := range cur.Tools {
+		before := prevTools[tool.Name]
+		row := toolRow{name: tool.Name, rate: rate(tool.Calls, before.Calls), calls: tool.Calls, errors: tool.Errors, avg: "-", p95: "-"}
+		// Latency over the window when the tool was called in it, else
+		// since the server started.
+		calls, seconds, buckets := tool.Calls-before.Calls, tool.Seconds-before.Seconds, diffBuckets(tool.Buckets, before.Buckets)
+		if calls == 0 || before.Calls > tool.Calls {
+			calls, seconds, buckets = tool.Calls, tool.Seconds, tool.Buckets
+		}
+		if calls > 0 {
+			row.avg = formatLatency(seconds / float64(calls))
+			row.p95 = percentile(buckets, cur.LatencyBuckets, 0.95)
+		}
+		tools = append(tools, row)
+	}
+	sort.SliceStable(tools, func(i, j int) bool {
+		if tools[i].rate != tools[j].rate {
+			return tools[i].rate > tools[j].rate
+		}
+		return tools[i].calls > tools[j].calls
+	})
+	var toolLines []string
+	for _, r := range tools {
+		errPct := "-"
+		if r.calls > 0 {
+			errPct = fmt.Sprintf("%.1f%%", 100*float64(r.errors)/float64(r.calls))
+		}
+		toolLines = append(toolLines, fmt.Sprintf("%-32s %8.1f %9d %7s %9s %9s", clip(r.name, 32), r.rate, r.calls, errPct, r.avg, r.p95))
+	}
+
+	// Methods, busiest first.
+	methods := make([]string, 0, len(cur.Requests))
+	for method := range cur.Requests {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool {
+		ri, rj := rate(cur.Requests[methods[i]], prev.Requests[methods[i]]), rate(cur.Requests[methods[j]], prev.Requests[methods[j]])
+		if ri != rj {
+			return ri > rj
+		}
+		return cur.Requests[methods[i]] > cur.Requests[methods[j]]
+	})
+	var methodLines []string
+	for _, method := range methods {
+		methodLines = append(methodLines, fmt.Sprintf("%-32s %8.1f %9d", clip(method, 32), rate(cur.Requests[method], prev.Requests[method]), cur.Requests[method]))
+	}
+
+	// Sessions, most active first.
+	prevSessions := make(map[uint64]uint64)
+	for _, s := range prev.Sessions {
+		prevSessions[s.ID] = s.Requests
+	}
+	sessions := append([]sessionStats(nil), cur.Sessions...)
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return rate(sessions[i].Requests, prevSessions[sessions[i].ID]) > rate(sessions[j].Requests, prevSessions[sessions[j].ID])
+	})
+	var sessionLines []string
+	for _, s := range sessions {
+		idle := "-"
+		if !s.LastActive.IsZero() {
+			idle = formatAge(cur.Time.Sub(s.LastActive))
+		}
+		rtt := "-"
+		if s.RTT > 0 {
+			rtt = formatLatency(s.RTT)
+		}
+		sessionLines = append(sessionLines, fmt.Sprintf("%6d %-12s %-24s %-21s %-10s %7s %7s %8s %8.1f %9d",
+			s.ID, s.Transport, clip(s.Client, 24), clip(s.Remote, 21), clip(s.Tenant, 10),
+			formatAge(cur.Time.Sub(s.Started)), idle, rtt, rate(s.Requests, prevSessions[s.ID]), s.Requests))
+	}
+
+	var errorLines []string
+	for _, e := range cur.Errors {
+		errorLines = append(errorLines, fmt.Sprintf("%6d %-25s %8.1f %9d", e.Code, clip(e.Name, 25), rate(e.Count, prevErrors[e.Code]), e.Count))
+	}
+
+	sections := []struct {
+		header string
+		rows   []string
+	}{
+		{fmt.Sprintf("%-32s %8s %9s %7s %9s %9s", "TOOL", "CALLS/S", "CALLS", "ERR%", "AVG", "P95"), toolLines},
+		{fmt.Sprintf("%-32s %8s %9s", "METHOD", "REQ/S", "REQUESTS"), methodLines},
+		{fmt.Sprintf("%6s %-12s %-24s %-21s %-10s %7s %7s %8s %8s %9s", "ID", "TRANSPORT", "CLIENT", "REMOTE", "TENANT", "AGE", "IDLE", "RTT", "REQ/S", "REQUESTS"), sessionLines},
+		{fmt.Sprintf("%6s %-25s %8s %9s", "CODE", "ERROR", "ERR/S", "COUNT"), errorLines},
+	}
+
+	// Share the remaining height between the sections that have rows,
+	// giving each a header, a blank line, and at least a few rows.
+	budget := 0
+	if height > 0 {
+		budget = height - len(lines) - 1
+		for _, s := range sections {
+			budget -= 2
+			if len(s.rows) == 0 {
+				budget--
+			}
+		}
+	}
+	for i, s := range sections {
+		lines = append(lines, "", s.header)
+		rows := s.rows
+		if len(rows) == 0 {
+			lines = append(lines, "  (none)")
+			continue
+		}
+		if height > 0 {
+			// Each section may use its fair share of what is left.
+			share := max(budget/(len(sections)-i), 1)
+			switch {
+			case len(rows) > share && share == 1:
+				rows = rows[:1]
+			case len(rows) > share:
+				more := len(rows) - share + 1
+				rows = append(rows[:share-1:share-1], fmt.Sprintf("  ... %d more", more))
+			}
+			budget -= len(rows)
+		}
+		lines = append(lines, rows...)
+	}
+
+	if width > 0 {
+		for i, line := range lines {
+			lines[i] = clip(line, width)
+		}
+	}
+	if height > 0 && len(lines) > height {
+		lines = lines[:height]
+	}
+	return lines
+}
+
+// diffBuckets subtracts an earlier histogram from a later one.
+func diffBuckets(now, before []uint64) []uint64 {
+	out := make([]uint64, len(now))
+	for i := range now {
+		out[i] = now[i]
+		if i < len(before) && before[i] <= now[i] {
+			out[i] -= before[i]
+		}
+	}
+	return out
+}
+
+// percentile returns the upper bound of the bucket holding quantile q.
+func percentile(buckets []uint64, bounds []float64, q float64) string {
+	var total uint64
+	for _, n := range buckets {
+		total += n
+	}
+	if total == 0 {
+		return "-"
+	}
+	target := q * float64(total)
+	var cumulative uint64
+	for i, n := range buckets {
+		cumulative += n
+		if float64(cumulative) >= target {
+			if i >= len(bounds) {
+				return ">" + formatLatency(bounds[len(bounds)-1])
+			}
+			return "<" + formatLatency(bounds[i])
+		}
+	}
+	return "-"
+}
+
+func formatLatency(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%dµs", d.Microseconds())
+}
+
+// formatAge is a compact duration such as 45s, 12m, 3h05m, or 2d04h.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "0s"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd%02dh", int(d.Hours())/24, int(d.Hours())%24)
+}
+
+// clip shortens s to n runes, marking the cut.
+func clip(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 1 {
+		return string(r[:n])
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Encoding responses and decoding requests are the hot path of every
+// streaming session. These benchmarks are the baseline for work on the
+// codecs and the JSON engine: each runs both built-in codecs over the same
+// payload shapes, from a ping-sized message to a 1 MiB text result.
+//
+//	go test -run '^$' -bench 'Encode|Decode' -benchmem
+
+// benchmarkShapes lists the payload shapes in the order they are reported.
+var benchmarkShapes = []string{"SmallRPC", "ToolsList", "LargeText", "NestedSchema"}
+
+// benchmarkCodecs returns the built-in codecs by name.
+func benchmarkCodecs() []struct {
+	name  string
+	codec Codec
+} {
+	return []struct {
+		name  string
+		codec Codec
+	}{
+		{"Frame", NewFrameCodec(maxFrameSize)},
+		{"Line", NewLineCodec(maxFrameSize)},
+	}
+}
+
+// nestedSchema returns an object schema nested depth levels deep, the
+// shape of a tool with deeply structured input.
+func nestedSchema(depth int) map[string]interface{} {
+	schema := map[string]interface{}{"type": "string"}
+	for i := 0; i < depth; i++ {
+		schema = map[string]interface{}{
+			"type":        "object",
+			"description": "Level of a nested input.",
+			"properties":  map[string]interface{}{"child": schema, "label": map[string]interface{}{"type": "string"}},
+			"required":    []string{"child"},
+		}
+	}
+	return schema
+}
+
+func benchmarkResponses() map[string]*RPCResponse {
+	tools := make([]map[string]interface{}, 50)
+	for i := range tools {
+		tools[i] = map[string]interface{}{
+			"name":        "tool",
+			"description": strings.Repeat("Does something useful. ", 8),
+			"inputSchema": map[string]interface{}{"type": "object", "properties": map[string]interface{}{"query": map[string]interface{}{"type": "string"}}},
+		}
+	}
+	return map[string]*RPCResponse{
+		"SmallRPC":  {JSONRPC: "2.0", ID: IntID(1), Result: map[string]interface{}{}},
+		"ToolsList": {JSONRPC: "2.0", ID: IntID(2), Result: map[string]interface{}{"tools": tools}},
+		"LargeText": {JSONRPC: "2.0", ID: IntID(3), Result: map[string]interface{}{
+			"content": []map[string]interface{}{{"type": "text", "text": strings.Repeat("x", 1<<20)}},
+		}},
+		"NestedSchema": {JSONRPC: "2.0", ID: IntID(4), Result: map[string]interface{}{
+			"tools": []map[string]interface{}{{"name": "nested", "inputSchema": nestedSchema(64)}},
+		}},
+	}
+}
+
+// benchmarkParams encodes request params as a client would send them.
+func benchmarkParams(params map[string]interface{}) json.RawMessage {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+func benchmarkRequests() map[string]*RPCRequest {
+	return map[string]*RPCRequest{
+		"SmallRPC": {JSONRPC: "2.0", ID: IntID(1), Method: "ping"},
+		"ToolsList": {JSONRPC: "2.0", ID: IntID(2), Method: "tools/list", Params: benchmarkParams(map[string]interface{}{
+			"cursor": strings.Repeat("c", 64),
+		})},
+		"LargeText": {JSONRPC: "2.0", ID: IntID(3), Method: "tools/call", Params: benchmarkParams(map[string]interface{}{
+			"name": "echo", "arguments": map[string]interface{}{"text": strings.Repeat("x", 1<<20)},
+		})},
+		"NestedSchema": {JSONRPC: "2.0", ID: IntID(4), Method: "tools/call", Params: benchmarkParams(map[string]interface{}{
+			"name": "validate", "arguments": map[string]interface{}{"schema": nestedSchema(64)},
+		})},
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	responses := benchmarkResponses()
+	for _, c := range benchmarkCodecs() {
+		for _, shape := range benchmarkShapes {
+			codec, resp := c.codec, responses[shape]
+			b.Run(c.name+"/"+shape, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					frame, err := codec.Encode(resp)
+					if err != nil {
+						b.Fatal(err)
+					}
+					b.SetBytes(int64(len(frame)))
+					io.Discard.Write(frame)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	requests := benchmarkRequests()
+	for _, c := range benchmarkCodecs() {
+		for _, shape := range benchmarkShapes {
+			codec := c.codec
+			frame, err := codec.Encode(requests[shape])
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(c.name+"/"+shape, func(b *testing.B) {
+				// Sessions decode from a long-lived *bufio.Reader; reset
+				// one over the encoded frame rather than allocating it.
+				src := bytes.NewReader(frame)
+				br := bufio.NewReader(src)
+				b.SetBytes(int64(len(frame)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					src.Reset(frame)
+					br.Reset(src)
+					if _, err := codec.Decode(br); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Command Tools
+// =============================================================================
+
+const (
+	// commandToolTimeout bounds a command when its config sets no timeout.
+	commandToolTimeout = 30 * time.Second
+	// maxCommandToolOutput bounds the output returned when a config sets
+	// no cap.
+	maxCommandToolOutput = 64 << 10
+	// commandToolPath is the PATH commands run with unless their config
+	// sets one.
+	commandToolPath = "/usr/local/bin:/usr/bin:/bin"
+)
+
+// CommandToolsFile is the document read by LoadCommandTools.
+type CommandToolsFile struct {
+	Tools []CommandToolConfig `yaml:"tools"`
+}
+
+// CommandToolConfig describes a tool that runs one program. The program is
+// started directly, never through a shell, so the file is the allowlist:
+// clients choose only the arguments, and only where Args has templates.
+//
+// Each element of Args is a text/template executed with the arguments as
+// data; elements that render empty are dropped, so optional flags can be
+// written as "{{if .all}}-a{{end}}". Besides the json, path, and query
+// helpers, templates have "file", which resolves an argument as a path
+// inside Dir and fails if it would leave it.
+//
+// A call is rejected if a client's value would make an element start with
+// "-", so values cannot pass options the file does not spell out; only
+// the template's own text may, as in "--output={{file .out}}". Elements
+// after a literal "--" are not checked, so the program takes them as
+// operands whatever they hold.
+type CommandToolConfig struct {
+	Name        string                 `yaml:"name"`
+	Description string                 `yaml:"description"`
+	InputSchema map[string]interface{} `yaml:"inputSchema"`
+
+	// Command is an absolute path or a name looked up in PATH at load time.
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// Env is the command's entire environment besides PATH; the server's
+	// own environment is not passed on.
+	Env map[string]string `yaml:"env"`
+	// Dir is the working directory that file arguments are confined to.
+	// When empty, each call runs in a fresh temporary directory.
+	Dir string `yaml:"dir"`
+
+	// Timeout bounds the run; the command's process group is killed when
+	// it expires. Zero means 30s.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxOutputBytes truncates the combined stdout and stderr returned;
+	// zero means 64 KiB.
+	MaxOutputBytes int `yaml:"maxOutputBytes"`
+	// NoNetwork runs the command in an empty network namespace. It is only
+	// supported on Linux.
+	NoNetwork bool `yaml:"noNetwork"`
+}
+
+// LoadCommandTools reads a CommandToolsFile, in YAML or JSON, and builds
+// its tools.
+func LoadCommandTools(path string) (StaticTools, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file CommandToolsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("command tools %s: %w", path, err)
+	}
+	if len(file.Tools) == 0 {
+		return nil, fmt.Errorf("command tools %s: no tools", path)
+	}
+
+	tools := make(StaticTools, 0, len(file.Tools))
+	for _, cfg := range file.Tools {
+		t, err := NewCommandTool(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("command tools %s: %w", path, err)
+		}
+		tools = append(tools, t)
+	}
+	return tools, nil
+}
+
+// NewCommandTool builds the tool cfg describes.
+func NewCommandTool(cfg CommandToolConfig) (Tool, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("tool without a name")
+	}
+	if cfg.Timeout < 0 || cfg.MaxOutputBytes < 0 {
+		return nil, fmt.Errorf("tool %q: negative limit", cfg.Name)
+	}
+	if cfg.NoNetwork && !sandboxSupportsNoNetwork {
+		return nil, fmt.Errorf("tool %q: noNetwork is not supported on this platform", cfg.Name)
+	}
+
+	t := &commandTool{cfg: cfg}
+	path := cfg.Env["PATH"]
+	if path == "" {
+		path = commandToolPath
+	}
+	var err error
+	if t.path, err = lookPathIn(cfg.Command, path); err != nil {
+		return nil, fmt.Errorf("tool %q: %w", cfg.Name, err)
+	}
+	if cfg.Dir != "" {
+		if t.dir, err = filepath.Abs(cfg.Dir); err != nil {
+			return nil, fmt.Errorf("tool %q: %w", cfg.Name, err)
+		}
+		if info, err := os.Stat(t.dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("tool %q: dir %s is not a directory", cfg.Name, cfg.Dir)
+		}
+	}
+
+	t.env = []string{"PATH=" + path}
+	for k, v := range cfg.Env {
+		if k != "PATH" {
+			t.env = append(t.env, k+"="+v)
+		}
+	}
+	if t.cfg.Timeout == 0 {
+		t.cfg.Timeout = commandToolTimeout
+	}
+	if t.cfg.MaxOutputBytes == 0 {
+		t.cfg.MaxOutputBytes = maxCommandToolOutput
+	}
+	if t.cfg.InputSchema == nil {
+		t.cfg.InputSchema = map[string]interface{}{"type": "object"}
+	}
+
+	// file is bound to the working directory per call; this stand-in only
+	// lets the templates parse.
+	funcs := template.FuncMap{"file": func(interface{}) (string, error) { return "", nil }}
+	for k, v := range httpTemplateFuncs {
+		if k != "env" {
+			funcs[k] = v
+		}
+	}
+	for i, arg := range cfg.Args {
+		tmpl, err := template.New(fmt.Sprintf("args[%d]", i)).Funcs(funcs).Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("tool %q: %w", cfg.Name, err)
+		}
+		t.args = append(t.args, tmpl)
+	}
+	return t, nil
+}
+
+// lookPathIn resolves a command name against path rather than the
+// server's PATH.
+func lookPathIn(command, path string) (string, error) {
+	if command == "" {
+		return "", errors.New("no command")
+	}
+	if strings.ContainsRune(command, filepath.Separator) {
+		if !filepath.IsAbs(command) {
+			return "", fmt.Errorf("command %s must be a bare name or an absolute path", command)
+		}
+		return exec.LookPath(command)
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if found, err := exec.LookPath(filepath.Join(dir, command)); err == nil {
+			return found, nil
+		}
+	}
+	return "", fmt.Errorf("command %s not found in %s", command, path)
+}
+
+// commandTool runs one allowlisted program.
+type commandTool struct {
+	cfg  CommandToolConfig
+	path string
+	dir  string
+	env  []string
+	args []*template.Template
+}
+
+func (t *commandTool) Name() string                        { return t.cfg.Name }
+func (t *commandTool) Description() string                 { return t.cfg.Description }
+func (t *commandTool) InputSchema() map[string]interface{} { return t.cfg.InputSchema }
+
+func (t *commandTool) Execute(args map[string]interface{}) (interface{}, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+// ExecuteContext runs the command, killing it when ctx is done or the
+// tool's timeout passes.
+func (t *commandTool) ExecuteContext(parent context.Context, args map[string]interface{}) (interface{}, error) {
+	required, _ := t.cfg.InputSchema["required"].([]interface{})
+	for _, r := range required {
+		name, _ := r.(string)
+		if v, ok := args[name]; !ok || v == nil {
+			return nil, mcpflowerr.InvalidParams("missing required argument %q", name).
+				WithOffender(name, "required")
+		}
+	}
+
+	dir := t.dir
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "mcpflow-cmd-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	argv, err := t.render(args, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(parent, t.cfg.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, t.path, argv...)
+	cmd.Dir = dir
+	cmd.Env = t.env
+	out := &cappedBuffer{limit: t.cfg.MaxOutputBytes}
+	cmd.Stdout, cmd.Stderr = out, out
+	cmd.WaitDelay = time.Second
+	sandbox(cmd, t.cfg.NoNetwork)
+
+	err = cmd.Run()
+	if parent.Err() != nil {
+		return nil, parent.Err()
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, mcpflowerr.Timeout("%s did not finish within %s", t.cfg.Name, t.cfg.Timeout)
+	}
+
+	text := out.String()
+	result := map[string]interface{}{}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		text = exitErr.Error() + "\n" + text
+		result["isError"] = true
+	case err != nil:
+		return nil, err
+	}
+	result["content"] = []map[string]interface{}{{"type": "text", "text": text}}
+	return result, nil
+}
+
+// render executes the argument templates, with file bound to dir. An
+// element that starts with "-" before any "--" is rendered again with the
+// leading dashes stripped from every value; if it then no longer starts
+// with one, the dash came from a client and the call is rejected.
+func (t *commandTool) render(args map[string]interface{}, dir string) ([]string, error) {
+	funcs := template.FuncMap{"file": func(v interface{}) (string, error) { return jailPath(dir, argString(v)) }}
+	var undashed map[string]interface{}
+	operands := false
+	argv := make([]string, 0, len(t.args))
+	for i, tmpl := range t.args {
+		arg, err := renderCommandArg(tmpl, funcs, args)
+		if err != nil {
+			return nil, err
+		}
+		if !operands && strings.HasPrefix(arg, "-") {
+			if undashed == nil {
+				undashed, _ = undash(args).(map[string]interface{})
+			}
+			literal, err := renderCommandArg(tmpl, funcs, undashed)
+			if err != nil || !strings.HasPrefix(literal, "-") {
+				return nil, mcpflowerr.InvalidParams("arguments would pass %q as an option in argument %d of %s", arg, i+1, t.cfg.Name)
+			}
+			operands = arg == "--" && literal == "--"
+		}
+		if arg != "" {
+			argv = append(argv, arg)
+		}
+	}
+	return argv, nil
+}
+
+func renderCommandArg(tmpl *template.Template, funcs template.FuncMap, args map[string]interface{}) (string, error) {
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	return renderHTTPTemplate(clone.Funcs(funcs), args)
+}
+
+// undash returns a copy of v with leading dashes stripped from its strings
+// and negative numbers made positive.
+func undash(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimLeft(v, "-")
+	case float64:
+		return math.Abs(v)
+	case json.Number:
+		return json.Number(strings.TrimLeft(string(v), "-"))
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = undash(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = undash(item)
+		}
+		return out
+	}
+	return v
+}
+
+// jailPath resolves name inside dir, rejecting paths that leave it
+// lexically or through a symlink.
+func jailPath(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	if !pathWithin(dir, path) {
+		return "", fmt.Errorf("path %q is outside the working directory", name)
+	}
+	// Check the deepest existing ancestor, so new files can be named too.
+	for p := path; ; p = filepath.Dir(p) {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			root, err := filepath.EvalSymlinks(dir)
+			if err != nil {
+				return "", err
+			}
+			if !pathWithin(root, resolved) {
+				return "", fmt.Errorf("path %q is outside the working directory", name)
+			}
+			return path, nil
+		}
+		if p == dir {
+			return "", err
+		}
+	}
+}
+
+func pathWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// cappedBuffer keeps the first limit bytes written to it and counts the
+// rest, so a chatty command is not blocked or killed by the cap.
+type cappedBuffer struct {
+	buf     bytes.Buffer
+	limit   int
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	keep := min(len(p), b.limit-b.buf.Len())
+	b.buf.Write(p[:keep])
+	b.dropped += len(p) - keep
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() string {
+	if b.dropped > 0 {
+		return b.buf.String() + fmt.Sprintf("\n[truncated at %d bytes; %d more]", b.limit, b.dropped)
+	}
+	return b.buf.String()
+}
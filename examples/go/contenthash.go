@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// =============================================================================
+// Content Hashes
+// =============================================================================
+
+// A client that sends transport.contentHashes in initialize is sent each
+// large payload once. Every content item of a tools/call or resources/read
+// result whose text, blob, or data is at least Config.ContentHashMin bytes
+// carries the payload's hash, and once the session has sent a payload in
+// full, later items with the same payload carry the hash alone:
+//
+//	{"type": "text", "hash": "sha256:9f86d081884c7d65..."}
+//
+// The client fills these in from the payloads it kept by hash. If it no
+// longer has one, it repeats the request with _meta.fullContent, which has
+// every payload sent in full. Blobs sent on Execution Streams are not
+// hashed.
+
+const (
+	contentHashPrefix = "sha256:"
+	// maxSentContent bounds the hashes a session remembers sending; the
+	// payloads of older ones are sent in full again.
+	maxSentContent = 1024
+)
+
+// payloadFields are the members of a content item that may hold a large
+// payload.
+var payloadFields = []string{"text", "blob", "data"}
+
+// acceptContentHashes turns content hashes on if the client asked for them
+// and the server hashes payloads of at least min bytes, and reports
+// whether it did.
+func (s *Session) acceptContentHashes(asked bool, min int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contentHashMin, s.sentContent, s.sentOrder = 0, nil, nil
+	if asked && min > 0 {
+		s.contentHashMin = min
+		s.sentContent = make(map[string]bool)
+	}
+	return s.contentHashMin > 0
+}
+
+func contentHash(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return contentHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// sentBefore reports whether the payload with hash has been sent in full
+// and may be left out, unless full asks for every payload. It records the
+// payload as sent when it was not.
+func (s *Session) sentBefore(hash string, full bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sentContent[hash] {
+		return !full
+	}
+	s.sentContent[hash] = true
+	s.sentOrder = append(s.sentOrder, hash)
+	if len(s.sentOrder) > maxSentContent {
+		delete(s.sentContent, s.sentOrder[0])
+		s.sentOrder = s.sentOrder[1:]
+	}
+	return false
+}
+
+// dedupContent returns a tools/call or resources/read result with its
+// large payloads hashed, and those sent before left out, if the session
+// uses content hashes. Results may be shared with the caches, so they are
+// copied rather than changed.
+func (s *Session) dedupContent(req *RPCRequest, result interface{}) interface{} {
+	s.mu.RLock()
+	min := s.contentHashMin
+	s.mu.RUnlock()
+	m, ok := result.(map[string]interface{})
+	if min == 0 || !ok {
+		return result
+	}
+	full := requestMeta(req.Params).FullContent
+
+	copied := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	for _, key := range []string{"content", "contents"} {
+		switch items := m[key].(type) {
+		case []ResourceContents:
+			copied[key] = s.dedupResources(items, min, full)
+		case []map[string]interface{}:
+			out := make([]map[string]interface{}, len(items))
+			for i, item := range items {
+				out[i] = s.dedupItem(item, min, full)
+			}
+			copied[key] = out
+		case []interface{}:
+			// Results relayed from gateway upstreams.
+			out := make([]interface{}, len(items))
+			for i, item := range items {
+				if im, ok := item.(map[string]interface{}); ok {
+					item = s.dedupItem(im, min, full)
+				}
+				out[i] = item
+			}
+			copied[key] = out
+		}
+	}
+	return copied
+}
+
+// dedupItem hashes the payload of a content item, if it is large enough.
+func (s *Session) dedupItem(item map[string]interface{}, min int, full bool) map[string]interface{} {
+	for _, field := range payloadFields {
+		payload, ok := item[field].(string)
+		if !ok || len(payload) < min {
+			continue
+		}
+		copied := make(map[string]interface{}, len(item)+1)
+		for k, v := range item {
+			copied[k] = v
+		}
+		hash := contentHash([]byte(payload))
+		copied["hash"] = hash
+		if s.sentBefore(hash, full) {
+			delete(copied, field)
+		}
+		return copied
+	}
+	return item
+}
+
+// dedupResources hashes the text or blob of resources/read items.
+func (s *Session) dedupResources(items []ResourceContents, min int, full bool) []ResourceContents {
+	items = append([]ResourceContents(nil), items...)
+	for i, c := range items {
+		payload := c.Blob
+		if payload == nil {
+			payload = []byte(c.Text)
+		}
+		if c.StreamTag != 0 || len(payload) < min {
+			continue
+		}
+		items[i].Hash = contentHash(payload)
+		if s.sentBefore(items[i].Hash, full) {
+			items[i].Text, items[i].Blob = "", nil
+		}
+	}
+	return items
+}
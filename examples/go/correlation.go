@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Correlation IDs
+// =============================================================================
+
+// newCorrelationID returns a correlation ID for a request that came
+// without one.
+func newCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withCorrelation returns resp with the request's correlation ID echoed in
+// result._meta.correlationId, or in error.data.correlationId. A result
+// that is not an object is left as it is. Results may be shared with the
+// response cache, so they are copied rather than changed.
+func withCorrelation(resp *RPCResponse, id string) *RPCResponse {
+	if resp == nil || id == "" {
+		return resp
+	}
+	out := *resp
+	if resp.Error != nil {
+		rpcErr := *resp.Error
+		switch data := rpcErr.Data.(type) {
+		case nil:
+			rpcErr.Data = &mcpflowerr.Data{CorrelationID: id}
+		case *mcpflowerr.Data:
+			d := *data
+			d.CorrelationID = id
+			rpcErr.Data = &d
+		}
+		out.Error = &rpcErr
+		return &out
+	}
+
+	result, ok := resp.Result.(map[string]interface{})
+	if !ok {
+		return resp
+	}
+	copied := make(map[string]interface{}, len(result)+1)
+	for k, v := range result {
+		copied[k] = v
+	}
+	copied["_meta"] = withMeta(result["_meta"], "correlationId", id)
+	out.Result = copied
+	return &out
+}
+
+// withMeta returns a copy of the _meta object old with key set to value.
+func withMeta(old interface{}, key string, value interface{}) map[string]interface{} {
+	meta := map[string]interface{}{}
+	if m, ok := old.(map[string]interface{}); ok {
+		for k, v := range m {
+			meta[k] = v
+		}
+	}
+	meta[key] = value
+	return meta
+}
+
+// callContext is the context a tool call from the session runs with: the
+// session's state, and the request's logger and correlation ID, with a
+// Notifier that tags notifications with it.
+func (s *Session) callContext(req *RPCRequest) context.Context {
+	ctx := mcpflow.WithLogger(s.toolContext(), req.logger())
+	ctx = mcpflow.WithCorrelationID(ctx, req.correlation)
+	return mcpflow.WithNotifier(ctx, requestNotifier{sess: s, correlation: req.correlation})
+}
+
+// requestNotifier is the mcpflow.Notifier of one tool call.
+type requestNotifier struct {
+	sess        *Session
+	correlation string
+}
+
+func (n requestNotifier) Notify(method string, params map[string]interface{}) error {
+	tagged := make(map[string]interface{}, len(params)+1)
+	for k, v := range params {
+		tagged[k] = v
+	}
+	tagged["_meta"] = withMeta(params["_meta"], "correlationId", n.correlation)
+	return n.sess.Notify(method, tagged)
+}
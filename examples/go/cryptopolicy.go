@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sort"
+)
+
+// =============================================================================
+// Crypto Policy
+// =============================================================================
+
+// A crypto policy limits the TLS of every listener to an approved set of
+// algorithms, for regulated deployments. The server refuses to start with
+// a certificate or option the policy does not allow, and a client that can
+// only agree on something else is refused at the handshake. Only "fips"
+// exists so far, the algorithms FIPS 140-3 approves, as Go's own FIPS mode
+// (GODEBUG=fips140=on) limits TLS to:
+//
+//	versions      TLS 1.3
+//	cipher suites TLS_AES_128_GCM_SHA256, TLS_AES_256_GCM_SHA384
+//	key exchanges X25519MLKEM768 (Go 1.24+), P-256, P-384, P-521
+//	certificates  RSA of 2048 bits or more, ECDSA on P-256, P-384, or P-521,
+//	              Ed25519
+//
+// The policy picks algorithms; it does not make the build use a validated
+// cryptographic module, which is GODEBUG=fips140=on's part.
+
+// cryptoPolicy is a set of approved TLS algorithms.
+type cryptoPolicy struct {
+	suites []uint16
+	curves []tls.CurveID
+	// certificate reports why a certificate's key is not approved.
+	certificate func(*x509.Certificate) error
+}
+
+// cryptoPolicies are the policies Config.CryptoPolicy may name.
+var cryptoPolicies = map[string]*cryptoPolicy{
+	"fips": {
+		suites: []uint16{tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384},
+		curves: append(append([]tls.CurveID(nil), hybridKeyExchanges...),
+			tls.CurveP256, tls.CurveP384, tls.CurveP521),
+		certificate: func(cert *x509.Certificate) error {
+			switch k := cert.PublicKey.(type) {
+			case *rsa.PublicKey:
+				if k.N.BitLen() >= 2048 {
+					return nil
+				}
+			case *ecdsa.PublicKey:
+				if k.Curve == elliptic.P256() || k.Curve == elliptic.P384() || k.Curve == elliptic.P521() {
+					return nil
+				}
+			case ed25519.PublicKey:
+				return nil
+			}
+			return fmt.Errorf("certificate key %s is not approved", describeKey(cert))
+		},
+	},
+}
+
+// applyCryptoPolicy limits cfg, the TLS config every listener derives
+// from, to the algorithms of Config.CryptoPolicy, or fails if something
+// already chosen is outside them.
+func (s *Server) applyCryptoPolicy(cfg *tls.Config) error {
+	name := s.cfg.CryptoPolicy
+	if name == "" {
+		return nil
+	}
+	policy, ok := cryptoPolicies[name]
+	if !ok {
+		return fmt.Errorf("unknown crypto policy %q", name)
+	}
+
+	for _, cert := range cfg.Certificates {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("crypto policy %s: %w", name, err)
+		}
+		if err := policy.certificate(leaf); err != nil {
+			return fmt.Errorf("crypto policy %s: %w", name, err)
+		}
+	}
+	if len(s.cfg.ECHKeys) > 0 {
+		return fmt.Errorf("crypto policy %s: Encrypted Client Hello keys use X25519, which is not approved", name)
+	}
+	if len(cfg.CurvePreferences) == 0 {
+		cfg.CurvePreferences = policy.curves
+	}
+	for _, curve := range cfg.CurvePreferences {
+		if !containsCurve(policy.curves, curve) {
+			return fmt.Errorf("crypto policy %s: key exchange %s is not approved", name, curve)
+		}
+	}
+
+	// crypto/tls does not let TLS 1.3 suites be configured, so a handshake
+	// that settled on another is refused before it completes.
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		for _, id := range policy.suites {
+			if cs.CipherSuite == id {
+				return nil
+			}
+		}
+		return fmt.Errorf("cipher suite %s is not allowed by the %s crypto policy", tls.CipherSuiteName(cs.CipherSuite), name)
+	}
+	return nil
+}
+
+// reportTLS logs the TLS parameters the listeners use.
+func (s *Server) reportTLS(cfg *tls.Config) {
+	name := s.cfg.CryptoPolicy
+	if name == "" {
+		name = "none"
+	}
+	var suites []string
+	if policy, ok := cryptoPolicies[s.cfg.CryptoPolicy]; ok {
+		for _, id := range policy.suites {
+			suites = append(suites, tls.CipherSuiteName(id))
+		}
+	} else {
+		for _, suite := range tls.CipherSuites() {
+			if len(suite.SupportedVersions) == 1 && suite.SupportedVersions[0] == tls.VersionTLS13 {
+				suites = append(suites, suite.Name)
+			}
+		}
+	}
+	curves := []string{"default"}
+	if len(cfg.CurvePreferences) > 0 {
+		curves = curves[:0]
+		for _, curve := range cfg.CurvePreferences {
+			curves = append(curves, curve.String())
+		}
+	}
+	var certs []string
+	for _, cert := range cfg.Certificates {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			certs = append(certs, describeKey(leaf))
+		}
+	}
+	sort.Strings(certs)
+
+	s.logger.Info("tls parameters",
+		"crypto_policy", name,
+		"min_version", tls.VersionName(cfg.MinVersion),
+		"cipher_suites", suites,
+		"key_exchanges", curves,
+		"certificates", certs,
+		"ech", len(s.cfg.ECHKeys) > 0,
+		"0rtt", s.cfg.EarlyData,
+	)
+}
+
+// describeKey names the type and size of a certificate's key, such as
+// "ECDSA P-256" or "RSA 2048".
+func describeKey(cert *x509.Certificate) string {
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+func containsCurve(curves []tls.CurveID, curve tls.CurveID) bool {
+	for _, c := range curves {
+		if c == curve {
+			return true
+		}
+	}
+	return false
+}
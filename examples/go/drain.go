@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// =============================================================================
+// Draining (zero-drop rollouts)
+// =============================================================================
+
+// DrainStatus reports a server's progress towards idle.
+type DrainStatus struct {
+	Draining bool `json:"draining"`
+	// Sessions counts open framed sessions (WebTransport, WebSocket,
+	// TCP+TLS, stdio).
+	Sessions int `json:"sessions"`
+	// InFlight counts HTTP transport requests being handled.
+	InFlight int `json:"inFlight"`
+	// Idle is set once a draining server has no sessions or requests left.
+	Idle bool `json:"idle"`
+}
+
+// drainState tracks the work a draining server waits out.
+type drainState struct {
+	mu       sync.Mutex
+	draining bool
+	sessions map[*Session]struct{}
+	inflight int
+	// changed is closed and replaced on every change, waking waiters.
+	changed chan struct{}
+}
+
+func (d *drainState) notifyLocked() {
+	if d.changed != nil {
+		close(d.changed)
+		d.changed = nil
+	}
+}
+
+// join counts sess as live until the returned func is called.
+func (d *drainState) join(sess *Session) func() {
+	d.mu.Lock()
+	if d.sessions == nil {
+		d.sessions = make(map[*Session]struct{})
+	}
+	d.sessions[sess] = struct{}{}
+	d.mu.Unlock()
+
+	return func() {
+		d.mu.Lock()
+		delete(d.sessions, sess)
+		d.notifyLocked()
+		d.mu.Unlock()
+	}
+}
+
+func (d *drainState) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+func (d *drainState) status() DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.statusLocked()
+}
+
+func (d *drainState) statusLocked() DrainStatus {
+	return DrainStatus{
+		Draining: d.draining,
+		Sessions: len(d.sessions),
+		InFlight: d.inflight,
+		Idle:     d.draining && len(d.sessions) == 0 && d.inflight == 0,
+	}
+}
+
+// Drain takes the server out of rotation ahead of a shutdown: readiness
+// turns false, the service registration is marked unhealthy, and every open
+// framed session is sent $/shutdown so its client finishes in-flight work
+// and reconnects elsewhere. Sessions that connect while draining are still
+// served, but get $/shutdown right after initialize. Drain does not close
+// anything; use DrainStatus or WaitIdle to learn when the server is idle.
+func (s *Server) Drain() {
+	d := s.handler.drain
+	d.mu.Lock()
+	if d.draining {
+		d.mu.Unlock()
+		return
+	}
+	d.draining = true
+	sessions := make([]*Session, 0, len(d.sessions))
+	for sess := range d.sessions {
+		sessions = append(sessions, sess)
+	}
+	d.notifyLocked()
+	d.mu.Unlock()
+
+	s.logger.Info("draining", "sessions", len(sessions))
+	s.handler.emit(ServerEvent{Type: EventDrainStarted, Data: map[string]interface{}{"sessions": len(sessions)}})
+	s.watchDrain()
+	for _, sess := range sessions {
+		sess.goAway()
+	}
+}
+
+// DrainStatus reports whether the server is draining and what it is still
+// waiting for.
+func (s *Server) DrainStatus() DrainStatus {
+	return s.handler.drain.status()
+}
+
+// WaitIdle blocks until a draining server is idle or ctx ends.
+func (s *Server) WaitIdle(ctx context.Context) error {
+	d := s.handler.drain
+	for {
+		d.mu.Lock()
+		if d.statusLocked().Idle {
+			d.mu.Unlock()
+			return nil
+		}
+		if d.changed == nil {
+			d.changed = make(chan struct{})
+		}
+		changed := d.changed
+		d.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// trackRequests counts requests that carry MCP messages as in flight.
+// Long-lived GET event streams are not counted, since they hold no work of
+// their own.
+func (s *Server) trackRequests(next http.Handler) http.Handler {
+	d := s.handler.drain
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		d.mu.Lock()
+		d.inflight++
+		d.mu.Unlock()
+		defer func() {
+			d.mu.Lock()
+			d.inflight--
+			d.notifyLocked()
+			d.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// goAway sends $/shutdown to the client. It is a no-op before Serve has
+// started writing.
+func (s *Session) goAway() {
+	s.mu.RLock()
+	out := s.out
+	s.mu.RUnlock()
+	if out == nil {
+		return
+	}
+
+	frame, err := s.codec.Encode(&RPCRequest{JSONRPC: "2.0", Method: "$/shutdown"})
+	if err != nil {
+		return
+	}
+	if _, err := out.Write(frame); err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		s.logger.Debug("goaway failed", "error", err)
+		return
+	}
+	s.logger.Info("sent $/shutdown")
+}
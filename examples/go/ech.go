@@ -0,0 +1,30 @@
+//go:build go1.24
+
+package main
+
+import (
+	"crypto/tls"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+)
+
+// setECHKeys has cfg decrypt Encrypted Client Hellos with keys. The first
+// is the current one, sent to clients whose config has no key so they can
+// retry with it.
+func setECHKeys(cfg *tls.Config, keys []mcpflow.ECHKey) error {
+	for i, k := range keys {
+		cfg.EncryptedClientHelloKeys = append(cfg.EncryptedClientHelloKeys, tls.EncryptedClientHelloKey{
+			Config:      k.Config,
+			PrivateKey:  k.PrivateKey,
+			SendAsRetry: i == 0,
+		})
+	}
+	return nil
+}
+
+// copyECHKeys gives outer, the config http3 wraps cfg in to pick the ALPN
+// per QUIC version, cfg's ECH keys. crypto/tls looks for them on the outer
+// config, before asking it for cfg.
+func copyECHKeys(outer, cfg *tls.Config) {
+	outer.EncryptedClientHelloKeys = cfg.EncryptedClientHelloKeys
+}
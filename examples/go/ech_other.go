@@ -0,0 +1,19 @@
+//go:build !go1.24
+
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+)
+
+// setECHKeys fails before Go 1.24, whose crypto/tls is the first to
+// accept Encrypted Client Hello as a server.
+func setECHKeys(cfg *tls.Config, keys []mcpflow.ECHKey) error {
+	return errors.New("Encrypted Client Hello needs a build with Go 1.24 or later")
+}
+
+// copyECHKeys does nothing, since setECHKeys gave cfg none.
+func copyECHKeys(outer, cfg *tls.Config) {}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Error Throttling
+// =============================================================================
+
+// A client that sends garbage costs the server a decode, an error
+// response, and often a log line for every message. A frame that does not
+// parse already ends a framed or stdio session, but well-formed requests
+// for unknown methods or with invalid params do not. With Config.ErrorRate
+// set, a session on a persistent stream is answered with at most that many
+// such errors a second, after a burst of ErrorBurst; past the limit they
+// are dropped unanswered, and once ErrorClose of them have been dropped
+// the session is closed.
+
+// defaultErrorClose is how many dropped error responses close a session
+// when Config.ErrorClose is zero.
+const defaultErrorClose = 100
+
+// errTooManyErrors ends a session that kept drawing error responses past
+// Config.ErrorRate.
+var errTooManyErrors = errors.New("too many error responses")
+
+// throttledCodes are the errors Config.ErrorRate limits: those that answer
+// a malformed request rather than one a tool failed.
+var throttledCodes = map[int]bool{
+	ErrCodeParseError:     true,
+	ErrCodeInvalidRequest: true,
+	ErrCodeMethodNotFound: true,
+	ErrCodeInvalidParams:  true,
+
+	mcpflowerr.CodeNotInitialized: true,
+}
+
+// tokenBucket allows rate events a second on average and up to burst at
+// once. It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket. A burst below one means rate,
+// rounded up.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow takes a token if one is left at now.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// wait returns how long, after the last call to allow, until a token is
+// left.
+func (b *tokenBucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// errorThrottle limits the error responses of one session.
+type errorThrottle struct {
+	mu      sync.Mutex
+	bucket  *tokenBucket
+	dropped int
+	limit   int
+}
+
+func newErrorThrottle(cfg Config) *errorThrottle {
+	limit := cfg.ErrorClose
+	if limit <= 0 {
+		limit = defaultErrorClose
+	}
+	return &errorThrottle{bucket: newTokenBucket(cfg.ErrorRate, cfg.ErrorBurst), limit: limit}
+}
+
+// admit reports whether an error response may be sent, and how many have
+// been dropped so far.
+func (t *errorThrottle) admit() (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bucket.allow(time.Now()) {
+		return true, t.dropped
+	}
+	t.dropped++
+	return false, t.dropped
+}
+
+// exceeded reports whether enough error responses were dropped to close
+// the session.
+func (t *errorThrottle) exceeded() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.dropped >= t.limit
+}
+
+// admitError reports whether an error response with code may be sent to
+// the session. The first one dropped is logged.
+func (s *Session) admitError(code int) bool {
+	t := s.throttle()
+	if t == nil || !throttledCodes[code] {
+		return true
+	}
+	ok, dropped := t.admit()
+	if !ok && dropped == 1 {
+		s.logger.Warn("client drawing too many errors, dropping error responses",
+			"rate", s.handler.cfg.ErrorRate)
+	}
+	return ok
+}
+
+// tooManyErrors reports whether the session should be closed for the
+// error responses it drew.
+func (s *Session) tooManyErrors() bool {
+	t := s.throttle()
+	return t != nil && t.exceeded()
+}
+
+func (s *Session) throttle() *errorThrottle {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.errThrottle
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// =============================================================================
+// Entity Tags
+// =============================================================================
+
+// The results of the list methods and resources/read carry an entity tag,
+// the hash of the result, in _meta.etag. A client polling for changes sends
+// the tag it last saw as _meta.ifNoneMatch, and while the result is the
+// same it gets back only
+//
+//	{"notModified": true, "_meta": {"etag": "sha256:9f86d081884c7d65..."}}
+//
+// instead of the whole catalog or document again.
+
+// etagMethods lists the methods whose results carry an entity tag, besides
+// resources/read, which is tagged before its blobs go to streams.
+var etagMethods = map[string]bool{
+	"tools/list":     true,
+	"resources/list": true,
+	"prompts/list":   true,
+}
+
+// withETag returns result with its entity tag in _meta.etag or, when the
+// request's _meta.ifNoneMatch is that tag, a not-modified result in its
+// place. Results may be shared with the response cache, so they are
+// copied rather than changed.
+func withETag(req *RPCRequest, result interface{}) interface{} {
+	m, ok := resultObject(result)
+	if !ok {
+		return result
+	}
+	tagged := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		if k != "_meta" {
+			tagged[k] = v
+		}
+	}
+	raw, err := json.Marshal(tagged)
+	if err != nil {
+		return result
+	}
+	etag := contentHash(raw)
+	meta := withMeta(m["_meta"], "etag", etag)
+	if requestMeta(req.Params).IfNoneMatch == etag {
+		return map[string]interface{}{"notModified": true, "_meta": meta}
+	}
+	tagged["_meta"] = meta
+	return tagged
+}
+
+// resultObject returns the members of a result object, which comes from
+// the response cache as JSON. Cached members are kept as JSON, so they
+// encode as they did before they were cached and the tag stays the same.
+func resultObject(result interface{}) (map[string]interface{}, bool) {
+	switch r := result.(type) {
+	case map[string]interface{}:
+		return r, true
+	case json.RawMessage:
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(r, &fields) != nil || fields == nil {
+			return nil, false
+		}
+		m := make(map[string]interface{}, len(fields))
+		for k, v := range fields {
+			m[k] = v
+		}
+		return m, true
+	}
+	return nil, false
+}
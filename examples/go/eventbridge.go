@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Event Bridge
+// =============================================================================
+
+// Config.EventPublisher streams every server event, including a
+// tool.called for each tools/call, to a message broker for analytics,
+// moderation, or anything else that should not slow tool traffic down.
+// Events are published as JSON ServerEvents to the topic
+// <EventTopic>.<type>, such as mcpflow.events.tool.called, keyed by
+// session so a session's events stay in order on partitioned brokers.
+// They are queued and published from one goroutine; once
+// eventBridgeQueueSize are waiting, newer ones are dropped.
+// mcpflow_bridge_events_total counts events by outcome.
+
+const (
+	eventBridgeQueueSize = 4096
+	defaultEventTopic    = "mcpflow.events"
+	// eventPublishTimeout bounds each publish.
+	eventPublishTimeout = 5 * time.Second
+)
+
+// Outcomes of a bridged event, for ObserveBridgeEvent.
+const (
+	bridgePublished = "published"
+	bridgeFailed    = "failed"
+	bridgeDropped   = "dropped"
+)
+
+// EventPublisher sends messages to a broker. Publish is only called from
+// one goroutine at a time.
+type EventPublisher interface {
+	// Publish sends value to topic, under key where the broker
+	// partitions by key.
+	Publish(ctx context.Context, topic, key string, value []byte) error
+	// Close releases the publisher's connection.
+	Close() error
+}
+
+// NewEventPublisher returns the EventPublisher for a broker URL:
+// nats://[user:password@]host:4222, or nats://token@host:4222, for a NATS
+// server, or kafka://host:8082 for a Kafka cluster through its REST Proxy
+// (the v2 API of Confluent's REST Proxy or Redpanda's HTTP Proxy).
+func NewEventPublisher(rawURL string) (EventPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("events url: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("events url %q: want nats://host:port or kafka://host:port", rawURL)
+	}
+	switch u.Scheme {
+	case "nats":
+		return newNATSPublisher(u)
+	case "kafka":
+		return &kafkaRESTPublisher{
+			base:   "http://" + u.Host,
+			client: &http.Client{Timeout: eventPublishTimeout},
+		}, nil
+	}
+	return nil, fmt.Errorf("events url %q: unsupported scheme %q", rawURL, u.Scheme)
+}
+
+// eventBridge queues events for an EventPublisher. Every tenant's Handler
+// shares the root's.
+type eventBridge struct {
+	pub     EventPublisher
+	topic   string
+	metrics *Metrics
+	logger  *slog.Logger
+
+	mu     sync.RWMutex
+	queue  chan ServerEvent
+	closed bool
+	done   chan struct{}
+}
+
+func newEventBridge(cfg Config, metrics *Metrics) *eventBridge {
+	if cfg.EventPublisher == nil {
+		return nil
+	}
+	topic := cfg.EventTopic
+	if topic == "" {
+		topic = defaultEventTopic
+	}
+	b := &eventBridge{
+		pub:     cfg.EventPublisher,
+		topic:   topic,
+		metrics: metrics,
+		logger:  slog.Default().With("component", "events"),
+		queue:   make(chan ServerEvent, eventBridgeQueueSize),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// send queues ev, or drops it if the queue is full or closed.
+func (b *eventBridge) send(ev ServerEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.closed {
+		select {
+		case b.queue <- ev:
+			return
+		default:
+		}
+	}
+	b.metrics.ObserveBridgeEvent(bridgeDropped)
+}
+
+func (b *eventBridge) run() {
+	defer close(b.done)
+	for ev := range b.queue {
+		if err := b.publish(ev); err != nil {
+			b.logger.Warn("publishing event failed", "type", ev.Type, "id", ev.ID, "error", err)
+			b.metrics.ObserveBridgeEvent(bridgeFailed)
+			continue
+		}
+		b.metrics.ObserveBridgeEvent(bridgePublished)
+	}
+}
+
+// publish sends ev, trying once more on a failure, which a publisher with
+// a broken connection answers by reconnecting.
+func (b *eventBridge) publish(ev ServerEvent) error {
+	value, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	topic, key := b.topic+"."+ev.Type, fmt.Sprint(ev.Session)
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+		err = b.pub.Publish(ctx, topic, key, value)
+		cancel()
+		if err == nil || attempt == 1 {
+			return err
+		}
+	}
+}
+
+// close stops queueing events, waits until the queued ones are published
+// or ctx expires, and closes the publisher. It is a ShutdownHook.
+func (b *eventBridge) close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.pub.Close()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// =============================================================================
+// NATS Publisher
+// =============================================================================
+
+// natsPublisher speaks enough of the NATS client protocol to publish:
+// CONNECT, PUB, and a PING after each message, whose PONG confirms the
+// server took it. It reconnects on the next publish after an error.
+type natsPublisher struct {
+	addr                  string
+	user, password, token string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newNATSPublisher connects to the server named by u, a nats:// URL,
+// failing at startup rather than on the first message.
+func newNATSPublisher(u *url.URL) (*natsPublisher, error) {
+	p := &natsPublisher{addr: u.Host}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			p.user, p.password = u.User.Username(), password
+		} else {
+			p.token = u.User.Username()
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.dialLocked(); err != nil {
+		return nil, fmt.Errorf("nats %s: %w", u.Host, err)
+	}
+	return p, nil
+}
+
+// natsError is an -ERR sent by the server.
+type natsError string
+
+func (e natsError) Error() string { return "nats: " + string(e) }
+
+// Publish implements EventPublisher. NATS has no keys; key is ignored.
+func (p *natsPublisher) Publish(ctx context.Context, topic, key string, value []byte) error {
+	if strings.ContainsAny(topic, " \t\r\n") {
+		return fmt.Errorf("nats: invalid subject %q", topic)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.dialLocked(); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "PUB %s %d\r\n", topic, len(value))
+	buf.Write(value)
+	buf.WriteString("\r\nPING\r\n")
+	err := p.exchangeLocked(ctx, buf.Bytes())
+	if err != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+	return err
+}
+
+// Close implements EventPublisher.
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+func (p *natsPublisher) dialLocked() error {
+	conn, err := net.DialTimeout("tcp", p.addr, eventPublishTimeout)
+	if err != nil {
+		return err
+	}
+	p.conn, p.r = conn, bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(eventPublishTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	line, err := p.r.ReadString('\n')
+	if err == nil && !strings.HasPrefix(line, "INFO ") {
+		err = fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if err == nil {
+		json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+		if info.TLSRequired {
+			err = errors.New("server requires TLS, which this publisher does not speak")
+		}
+	}
+	if err == nil {
+		opts := map[string]interface{}{
+			"verbose":  false,
+			"pedantic": false,
+			"name":     serverName,
+			"lang":     "go",
+			"version":  serverVersion,
+		}
+		switch {
+		case p.token != "":
+			opts["auth_token"] = p.token
+		case p.user != "":
+			opts["user"], opts["pass"] = p.user, p.password
+		}
+		connect, _ := json.Marshal(opts)
+		err = p.exchangeLocked(context.Background(), []byte("CONNECT "+string(connect)+"\r\nPING\r\n"))
+	}
+	if err != nil {
+		conn.Close()
+		p.conn = nil
+	}
+	return err
+}
+
+// exchangeLocked writes msg, which ends in PING, and reads until the PONG,
+// answering the server's own PINGs on the way.
+func (p *natsPublisher) exchangeLocked(ctx context.Context, msg []byte) error {
+	deadline := time.Now().Add(eventPublishTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	p.conn.SetDeadline(deadline)
+	defer p.conn.SetDeadline(time.Time{})
+
+	if _, err := p.conn.Write(msg); err != nil {
+		return err
+	}
+	for {
+		line, err := p.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := io.WriteString(p.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return natsError(strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+	}
+}
+
+// =============================================================================
+// Kafka REST Publisher
+// =============================================================================
+
+// kafkaRESTPublisher produces to Kafka through a REST Proxy's v2 API, one
+// record per request.
+type kafkaRESTPublisher struct {
+	base   string
+	client *http.Client
+}
+
+// Publish implements EventPublisher.
+func (p *kafkaRESTPublisher) Publish(ctx context.Context, topic, key string, value []byte) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{{"key": key, "value": json.RawMessage(value)}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.base+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka rest proxy: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var result struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("kafka rest proxy: %w", err)
+	}
+	for _, o := range result.Offsets {
+		if o.Error != "" {
+			return fmt.Errorf("kafka rest proxy: %s", o.Error)
+		}
+	}
+	return nil
+}
+
+// Close implements EventPublisher.
+func (p *kafkaRESTPublisher) Close() error { return nil }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// =============================================================================
+// Server Events
+// =============================================================================
+
+// A ServerEvent reports something an operator's alerting or SIEM may want
+// to hear about: sessions starting and ending, failed authentication, tool
+// calls that failed, and draining. Events are handed to Config.Webhooks
+// and Config.EventPublisher.
+
+// Server event types.
+const (
+	// EventSessionStarted is sent when a session's initialize succeeds,
+	// and EventSessionEnded when that session ends, with its duration and
+	// request count.
+	EventSessionStarted = "session.started"
+	EventSessionEnded   = "session.ended"
+	// EventAuthFailed is sent for every message or HTTP request refused
+	// for a missing or invalid bearer token.
+	EventAuthFailed = "auth.failed"
+	// EventToolError is sent for every tools/call answered with an error
+	// or an isError result.
+	EventToolError = "tool.error"
+	// EventToolCalled is sent for every tools/call, failed or not, with
+	// its duration. Webhooks only get it when they ask for it by name.
+	EventToolCalled = "tool.called"
+	// EventDrainStarted is sent when the server starts draining, and
+	// EventDrainIdle once a draining server has no work left.
+	EventDrainStarted = "drain.started"
+	EventDrainIdle    = "drain.idle"
+)
+
+// eventTypes are the known event types, for validating subscriptions.
+var eventTypes = map[string]bool{
+	EventSessionStarted: true,
+	EventSessionEnded:   true,
+	EventAuthFailed:     true,
+	EventToolError:      true,
+	EventToolCalled:     true,
+	EventDrainStarted:   true,
+	EventDrainIdle:      true,
+}
+
+// ServerEvent is one event, as delivered to webhooks.
+type ServerEvent struct {
+	// ID is unique to the event, so receivers can drop the duplicates
+	// retries may deliver.
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Tenant is the tenant the event happened in, "" for the default.
+	Tenant string `json:"tenant,omitempty"`
+	// Session, Transport, Remote, and Client describe the session, or
+	// the HTTP request, the event is about.
+	Session   uint64 `json:"session,omitempty"`
+	Transport string `json:"transport,omitempty"`
+	Remote    string `json:"remote,omitempty"`
+	Client    string `json:"client,omitempty"`
+	// Data holds the details of the event type.
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// emit sends ev to the event consumers, filling in its ID, time, and
+// tenant.
+func (h *Handler) emit(ev ServerEvent) {
+	if !h.emitting() {
+		return
+	}
+	ev.ID = newCorrelationID()
+	ev.Time = time.Now().UTC()
+	if ev.Tenant == "" {
+		ev.Tenant = h.tenant.name
+	}
+	if h.webhooks != nil {
+		h.webhooks.send(ev)
+	}
+	if h.events != nil {
+		h.events.send(ev)
+	}
+}
+
+// emitting reports whether any event consumer is configured.
+func (h *Handler) emitting() bool {
+	return h.webhooks != nil || h.events != nil
+}
+
+// event returns an event of type typ about the session.
+func (s *Session) event(typ string, data map[string]interface{}) ServerEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return ServerEvent{
+		Type:      typ,
+		Session:   s.id,
+		Transport: s.transport,
+		Remote:    s.remote,
+		Client:    s.clientInfo.Name,
+		Data:      data,
+	}
+}
+
+// sessionEnded emits EventSessionEnded for a session h admitted.
+func (h *Handler) sessionEnded(sess *Session) {
+	sess.mu.RLock()
+	started := sess.started
+	sess.mu.RUnlock()
+	data := map[string]interface{}{"requests": sess.requests.Load()}
+	if !started.IsZero() {
+		data["seconds"] = time.Since(started).Seconds()
+	}
+	h.emit(sess.event(EventSessionEnded, data))
+}
+
+// toolCalledData describes a call of tool for EventToolCalled.
+func toolCalledData(tool string, resp *RPCResponse, elapsed time.Duration, failed bool, replayed bool) map[string]interface{} {
+	data := map[string]interface{}{"tool": tool, "seconds": elapsed.Seconds(), "failed": failed}
+	if resp.Error != nil {
+		data["code"] = resp.Error.Code
+	}
+	if replayed {
+		data["replayed"] = true
+	}
+	return data
+}
+
+// toolErrorData describes a failed call of tool for EventToolError.
+func toolErrorData(tool string, resp *RPCResponse) map[string]interface{} {
+	data := map[string]interface{}{"tool": tool}
+	if resp.Error != nil {
+		data["code"] = resp.Error.Code
+		data["message"] = resp.Error.Message
+	} else {
+		data["isError"] = true
+	}
+	return data
+}
+
+// httpAuthFailed emits EventAuthFailed for an HTTP request refused for its
+// token.
+func (s *Server) httpAuthFailed(r *http.Request) {
+	s.handler.emit(ServerEvent{
+		Type:   EventAuthFailed,
+		Remote: r.RemoteAddr,
+		Data:   map[string]interface{}{"method": r.Method, "path": r.URL.Path},
+	})
+}
+
+// watchDrain emits EventDrainIdle once the draining server is idle.
+func (s *Server) watchDrain() {
+	if !s.handler.emitting() {
+		return
+	}
+	go func() {
+		if s.WaitIdle(context.Background()) == nil {
+			s.handler.emit(ServerEvent{Type: EventDrainIdle})
+		}
+	}()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Fault Injection
+// =============================================================================
+
+// FaultRule makes the server misbehave on purpose for one method, so that
+// client retry and timeout handling can be exercised in staging. Never set
+// it in production.
+type FaultRule struct {
+	// Method is the JSON-RPC method the rule applies to, or "*" for every
+	// method without a rule of its own.
+	Method string
+	// Tenant limits the rule to one tenant; empty applies it to the
+	// default registry and every tenant.
+	Tenant string
+	// Latency delays each message by this long plus up to Jitter more.
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate is the fraction of requests, from 0 to 1, answered with an
+	// error carrying Code (mcpflowerr.CodeOverloaded when zero) instead of
+	// being handled.
+	ErrorRate float64
+	Code      int
+}
+
+// faultInjector applies the fault rules of one Handler. Its random source
+// is seeded with Config.FaultSeed, so a run can be repeated.
+type faultInjector struct {
+	rules map[string]FaultRule
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// newFaultInjector returns the injector for the named tenant's Handler,
+// or nil if no rule applies to it.
+func newFaultInjector(cfg Config, tenant string) *faultInjector {
+	rules := make(map[string]FaultRule)
+	for _, r := range cfg.Faults {
+		if r.Tenant == "" || r.Tenant == tenant {
+			rules[r.Method] = r
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	slog.Warn("fault injection enabled", "tenant", tenant, "rules", len(rules), "seed", cfg.FaultSeed)
+	return &faultInjector{rules: rules, rng: rand.New(rand.NewSource(cfg.FaultSeed))}
+}
+
+func (f *faultInjector) rule(method string) (FaultRule, bool) {
+	r, ok := f.rules[method]
+	if !ok {
+		r, ok = f.rules["*"]
+	}
+	return r, ok
+}
+
+// strike delays req as its rule says and reports whether it should fail.
+// Only requests fail; notifications are just delayed.
+func (f *faultInjector) strike(req *RPCRequest) bool {
+	if f == nil {
+		return false
+	}
+	r, ok := f.rule(req.Method)
+	if !ok {
+		return false
+	}
+
+	f.mu.Lock()
+	delay := r.Latency
+	if r.Jitter > 0 {
+		delay += time.Duration(f.rng.Int63n(int64(r.Jitter)))
+	}
+	fail := r.ErrorRate > 0 && f.rng.Float64() < r.ErrorRate
+	f.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return fail && !req.ID.IsZero()
+}
+
+// faultError is the error a request struck by its rule fails with.
+func (f *faultInjector) faultError(req *RPCRequest) error {
+	r, _ := f.rule(req.Method)
+	code := r.Code
+	if code == 0 {
+		code = mcpflowerr.CodeOverloaded
+	}
+	return mcpflowerr.New(code, "injected fault on %s", req.Method)
+}
+
+// validateFaults rejects rules that cannot apply.
+func validateFaults(rules []FaultRule, tenants []TenantConfig) error {
+	for _, r := range rules {
+		if r.Method == "" {
+			return fmt.Errorf("fault rule without a method")
+		}
+		if r.Latency < 0 || r.Jitter < 0 || r.ErrorRate < 0 || r.ErrorRate > 1 {
+			return fmt.Errorf("fault rule for %s has an out-of-range value", r.Method)
+		}
+		if r.Tenant == "" {
+			continue
+		}
+		known := false
+		for _, t := range tenants {
+			known = known || t.Name == r.Tenant
+		}
+		if !known {
+			return fmt.Errorf("fault rule for %s names unknown tenant %q", r.Method, r.Tenant)
+		}
+	}
+	return nil
+}
+
+// faultFlags collects repeated -fault method[,option=value...] flags.
+type faultFlags []FaultRule
+
+func (f *faultFlags) String() string {
+	methods := make([]string, len(*f))
+	for i, r := range *f {
+		methods[i] = r.Method
+	}
+	return strings.Join(methods, ",")
+}
+
+func (f *faultFlags) Set(value string) error {
+	opts := strings.Split(value, ",")
+	r := FaultRule{Method: opts[0]}
+	if r.Method == "" {
+		return fmt.Errorf("want method[,option=value...], got %q", value)
+	}
+	for _, opt := range opts[1:] {
+		key, val, _ := strings.Cut(opt, "=")
+		var err error
+		switch key {
+		case "latency":
+			r.Latency, err = time.ParseDuration(val)
+		case "jitter":
+			r.Jitter, err = time.ParseDuration(val)
+		case "error-rate":
+			r.ErrorRate, err = strconv.ParseFloat(val, 64)
+		case "code":
+			r.Code, err = strconv.Atoi(val)
+		case "tenant":
+			r.Tenant = val
+		default:
+			return fmt.Errorf("unknown fault option %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid fault option %q: %w", opt, err)
+		}
+	}
+	*f = append(*f, r)
+	return nil
+}
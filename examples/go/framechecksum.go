@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// =============================================================================
+// Frame Checksums
+// =============================================================================
+
+// A client on a length-prefixed stream other than WebTransport, whose QUIC
+// packets are already authenticated end to end, may list the checksums it
+// accepts as transport.checksums in initialize. If the server supports one
+// (only "crc32c" so far), it answers with it as transport.checksum, and
+// each side ends every frame it sends after the initialize result with a
+// checksum. Such a frame sets the second bit of its length prefix and is
+// followed by the 4-byte big-endian CRC-32C (Castagnoli) of everything
+// before it, length prefix and any sequence number included:
+//
+//	┌──────────────────────┬──────────────┬──────────────┬──────────────┐
+//	│ 0x40000000|Length 4B │ Sequence 8B? │ Message Body │ CRC-32C 4B   │
+//	└──────────────────────┴──────────────┴──────────────┴──────────────┘
+//
+// TLS protects the bytes between its endpoints, but not from a proxy or
+// bridge that terminates it and writes the frames out again. A receiver
+// that gets a frame whose checksum does not match, or one without a
+// checksum after frames with one, ends the session with a
+// protocol_corrupted error, as it does for a sequence gap.
+const (
+	// frameChecksummed flags a frame with a checksum in its length
+	// prefix. No frame the server accepts is long enough to set it.
+	frameChecksummed = 1 << 30
+	// frameChecksumSize is the size of the checksum.
+	frameChecksumSize = 4
+	// checksumCRC32C names the CRC-32C checksum in initialize.
+	checksumCRC32C = "crc32c"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checksumError reports a frame from the client that arrived damaged.
+type checksumError struct {
+	want, got uint32
+	missing   bool
+}
+
+func (e *checksumError) Error() string {
+	if e.missing {
+		return "frame without a checksum after frames with one"
+	}
+	return fmt.Sprintf("frame checksum mismatch: computed %08x, frame carries %08x", e.want, e.got)
+}
+
+// readChecksum reads the checksum that ends a frame from r and checks it
+// against want, computed over the rest of the frame.
+func readChecksum(r io.Reader, want uint32) error {
+	buf := make([]byte, frameChecksumSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("read checksum: %w", err)
+	}
+	if got := binary.BigEndian.Uint32(buf); got != want {
+		return &checksumError{want: want, got: got}
+	}
+	return nil
+}
+
+// nextChecksummed checks whether a received frame had a checksum, given
+// whether an earlier one had, and returns whether the following frame
+// must have one.
+func nextChecksummed(seen, got bool) (bool, error) {
+	if seen && !got {
+		return seen, &checksumError{missing: true}
+	}
+	return seen || got, nil
+}
+
+// checksumFrame returns frame, a length-prefixed frame that may be
+// sequenced, with a checksum. It is copied, since the frame may be written
+// to other sessions too.
+func checksumFrame(frame []byte) []byte {
+	out := make([]byte, len(frame), len(frame)+frameChecksumSize)
+	copy(out, frame)
+	binary.BigEndian.PutUint32(out, binary.BigEndian.Uint32(frame)|frameChecksummed)
+	return binary.BigEndian.AppendUint32(out, crc32.Checksum(out, castagnoli))
+}
+
+// acceptChecksums picks the first of the checksums the client offered
+// that the server supports, if the session's transport is one that may
+// use them, and returns it, or "" if there is none.
+func (s *Session) acceptChecksums(offered []string) string {
+	if !s.sequenceable() {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.transport == "webtransport" {
+		return ""
+	}
+	for _, name := range offered {
+		if name == checksumCRC32C {
+			s.frameChecksums = true
+			return name
+		}
+	}
+	return ""
+}
+
+// checksumsFrames reports whether the session's frames carry checksums.
+func (s *Session) checksumsFrames() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.frameChecksums
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Frame Sequencing
+// =============================================================================
+
+// A client that sends transport.sequenceNumbers in initialize, on a
+// length-prefixed stream, has each side number the frames it sends after
+// the initialize result. A sequenced frame sets the top bit of its length
+// prefix and follows it with an 8-byte big-endian sequence number:
+//
+//	┌──────────────────────┬──────────────┬─────────────────────┐
+//	│ 0x80000000|Length 4B │ Sequence 8B  │ Message Body        │
+//	└──────────────────────┴──────────────┴─────────────────────┘
+//
+// Each direction counts from 1. A receiver that sees a number other than
+// the one after the last, or an unsequenced frame once sequencing began,
+// has lost or reordered a frame somewhere below JSON-RPC, and ends the
+// session with a protocol_corrupted error rather than risk pairing a
+// response with the wrong request.
+const (
+	// frameSequenced flags a sequenced frame in its length prefix. No
+	// frame the server accepts is long enough to set it.
+	frameSequenced = 1 << 31
+	// frameSeqSize is the size of the sequence number.
+	frameSeqSize = 8
+)
+
+// sequenceError reports a gap in a client's frame numbers.
+type sequenceError struct {
+	want, got uint64
+}
+
+func (e *sequenceError) Error() string {
+	if e.got == 0 {
+		return fmt.Sprintf("unsequenced frame where frame %d was expected", e.want)
+	}
+	return fmt.Sprintf("frame sequence gap: expected %d, got %d", e.want, e.got)
+}
+
+// nextSequence checks the number of a received frame, 0 if unsequenced,
+// against last, the number of the one before it, and returns the number
+// to check the following frame against.
+func nextSequence(last, got uint64) (uint64, error) {
+	if got == 0 && last == 0 {
+		return 0, nil
+	}
+	if got != last+1 {
+		return last, &sequenceError{want: last + 1, got: got}
+	}
+	return got, nil
+}
+
+// sequenceFrame returns frame, a length-prefixed frame, numbered seq.
+func sequenceFrame(frame []byte, seq uint64) []byte {
+	out := make([]byte, len(frame)+frameSeqSize)
+	binary.BigEndian.PutUint32(out, binary.BigEndian.Uint32(frame)|frameSequenced)
+	binary.BigEndian.PutUint64(out[4:], seq)
+	copy(out[4+frameSeqSize:], frame[4:])
+	return out
+}
+
+// sequenceable reports whether the session writes length-prefixed frames
+// to a stream of its own, the only kind of session that can number them.
+func (s *Session) sequenceable() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, framed := s.codec.(*FrameCodec)
+	return framed && s.out != nil
+}
+
+func (s *Session) setSequenceFrames(on bool) {
+	s.mu.Lock()
+	s.sequenceFrames = on
+	s.mu.Unlock()
+}
+
+// sequencesFrames reports whether the client asked for numbered frames.
+func (s *Session) sequencesFrames() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sequenceFrames
+}
+
+// corruptedResponse is the error sent before a session with a sequence gap
+// is closed.
+func (h *Handler) corruptedResponse(err error) *RPCResponse {
+	return h.toolErrorResponse(NullID, mcpflowerr.ProtocolCorrupted("%v", err))
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Filesystem Resources
+// =============================================================================
+
+const (
+	// defaultMaxResourceFile caps the size of a file that can be read
+	// when FileResourceOptions sets no cap.
+	defaultMaxResourceFile = 1 << 20
+	// maxFileResources caps how many files resources/list walks, so a
+	// huge tree does not stall every list.
+	maxFileResources = 10000
+	// fileEventCoalesce gathers the bursts of events a single save
+	// produces into one update per file.
+	fileEventCoalesce = 100 * time.Millisecond
+)
+
+// FileResourceOptions configures a FileResourceProvider.
+type FileResourceOptions struct {
+	// MaxFileSize is the largest file served; larger files are listed but
+	// fail to read. Zero means 1 MiB.
+	MaxFileSize int64
+	// IncludeHidden serves files and directories whose names start with a
+	// dot, which are skipped by default.
+	IncludeHidden bool
+}
+
+// FileResourceProvider serves the regular files under a directory as
+// file:// resources. Reads cannot leave the directory, whether by ".." or
+// by a symlink pointing out of it. Watch reports changed files, so clients
+// subscribed to them get notifications/resources/updated.
+type FileResourceProvider struct {
+	root string
+	opts FileResourceOptions
+}
+
+// NewFileResourceProvider serves the directory root.
+func NewFileResourceProvider(root string, opts FileResourceOptions) (*FileResourceProvider, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	// Resolve the root itself so symlink checks compare like with like.
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = defaultMaxResourceFile
+	}
+	return &FileResourceProvider{root: abs, opts: opts}, nil
+}
+
+func (p *FileResourceProvider) uri(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// path maps a file:// URI back to a path, if it names one under the root.
+func (p *FileResourceProvider) path(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || u.Host != "" {
+		return "", false
+	}
+	path := filepath.Clean(filepath.FromSlash(u.Path))
+	return path, pathWithin(p.root, path) && path != p.root
+}
+
+func (p *FileResourceProvider) hidden(name string) bool {
+	return !p.opts.IncludeHidden && strings.HasPrefix(name, ".") && name != "."
+}
+
+// Resources lists the regular files under the root, up to 10000.
+func (p *FileResourceProvider) Resources() []Resource {
+	var resources []Resource
+	filepath.WalkDir(p.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path != p.root && p.hidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(p.root, path)
+		resources = append(resources, Resource{
+			URI:      p.uri(path),
+			Name:     filepath.ToSlash(rel),
+			MimeType: mimeTypeByName(path),
+			Size:     info.Size(),
+		})
+		if len(resources) == maxFileResources {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return resources
+}
+
+// ReadResource returns a file's contents, as text when it is valid UTF-8
+// and as a blob otherwise. Files over MaxFileSize can only be read in
+// ranges.
+func (p *FileResourceProvider) ReadResource(uri string) ([]ResourceContents, error) {
+	f, info, err := p.open(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	path := f.Name()
+	if info.Size() > p.opts.MaxFileSize {
+		return nil, mcpflowerr.InvalidParams("%s is %d bytes, over the %d byte limit; read it in ranges", uri, info.Size(), p.opts.MaxFileSize)
+	}
+
+	data := make([]byte, info.Size())
+	if _, err := f.ReadAt(data, 0); err != nil && info.Size() > 0 {
+		return nil, err
+	}
+	contents := ResourceContents{URI: uri, MimeType: detectMimeType(path, data)}
+	if utf8.Valid(data) {
+		contents.Text = string(data)
+	} else {
+		contents.Blob = data
+	}
+	return []ResourceContents{contents}, nil
+}
+
+// ReadResourceRange implements RangedResourceReader, reading only the
+// range from the file, whatever its size.
+func (p *FileResourceProvider) ReadResourceRange(uri string, offset, length int64) (ResourceContents, int64, error) {
+	f, info, err := p.open(uri)
+	if err != nil {
+		return ResourceContents{}, 0, err
+	}
+	defer f.Close()
+
+	size := info.Size()
+	if rest := size - offset; length == 0 || length > rest {
+		length = max(rest, 0)
+	}
+	data := make([]byte, length)
+	n, err := f.ReadAt(data, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return ResourceContents{}, 0, err
+	}
+	// The file's head is sniffed when the range does not start there.
+	head := data[:n]
+	if offset > 0 {
+		head = make([]byte, 512)
+		read, _ := f.ReadAt(head, 0)
+		head = head[:read]
+	}
+	return ResourceContents{URI: uri, MimeType: detectMimeType(f.Name(), head), Blob: data[:n]}, size, nil
+}
+
+// open opens the regular file uri names, or fails with NotFound if it
+// names none the provider serves.
+func (p *FileResourceProvider) open(uri string) (*os.File, fs.FileInfo, error) {
+	path, ok := p.path(uri)
+	if !ok {
+		return nil, nil, mcpflowerr.NotFound("Unknown resource: %s", uri)
+	}
+	rel, _ := filepath.Rel(p.root, path)
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if p.hidden(part) {
+			return nil, nil, mcpflowerr.NotFound("Unknown resource: %s", uri)
+		}
+	}
+	if _, err := jailPath(p.root, rel); err != nil {
+		return nil, nil, mcpflowerr.NotFound("Unknown resource: %s", uri)
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, mcpflowerr.NotFound("Unknown resource: %s", uri)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = mcpflowerr.NotFound("Unknown resource: %s", uri)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// Watch reports to notify the URI of each file created, written, removed,
+// or renamed under the root until ctx is done, and that the list changed
+// when files were created, removed, or renamed. Bursts of events are
+// coalesced.
+func (p *FileResourceProvider) Watch(ctx context.Context, notify ResourceNotifier, logger *slog.Logger) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// fsnotify does not recurse, so every directory is watched.
+	addTree := func(dir string) {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if path != p.root && p.hidden(d.Name()) {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(path); err != nil {
+				logger.Warn("cannot watch directory", "dir", path, "error", err)
+			}
+			return nil
+		})
+	}
+	addTree(p.root)
+
+	go func() {
+		defer watcher.Close()
+		var mu sync.Mutex
+		pending := make(map[string]bool)
+		listChanged := false
+		flush := func() {
+			mu.Lock()
+			uris, listed := pending, listChanged
+			pending, listChanged = make(map[string]bool), false
+			mu.Unlock()
+			for uri := range uris {
+				notify.NotifyResourceUpdated(uri)
+			}
+			if listed {
+				notify.NotifyResourcesListChanged()
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("file watch error", "root", p.root, "error", err)
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if ev.Has(fsnotify.Chmod) && !ev.Has(fsnotify.Write) {
+					continue
+				}
+				rel, _ := filepath.Rel(p.root, ev.Name)
+				if p.hidden(filepath.Base(rel)) {
+					continue
+				}
+				if ev.Has(fsnotify.Create) {
+					if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+						addTree(ev.Name)
+						continue
+					}
+				}
+				mu.Lock()
+				if len(pending) == 0 {
+					time.AfterFunc(fileEventCoalesce, flush)
+				}
+				pending[p.uri(ev.Name)] = true
+				listChanged = listChanged || ev.Has(fsnotify.Create) || ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename)
+				mu.Unlock()
+			}
+		}
+	}()
+	return nil
+}
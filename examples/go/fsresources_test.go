@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// jailTree builds a root directory to serve next to directories it must
+// not leak: outside, and root2, whose path has root's as a prefix.
+//
+//	root/a.txt
+//	root/sub/b.txt
+//	root/.env
+//	root/.git/config
+//	root/sub/.cache/c.txt
+//	root/link      -> root/a.txt
+//	root/escape    -> outside/secret.txt
+//	root/escapedir -> outside
+//	root/sub/up    -> root/..
+//	outside/secret.txt
+//	root2/secret.txt
+func jailTree(t *testing.T) (base, root string) {
+	t.Helper()
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(base, "root")
+	files := []string{
+		"root/a.txt",
+		"root/sub/b.txt",
+		"root/.env",
+		"root/.git/config",
+		"root/sub/.cache/c.txt",
+		"outside/secret.txt",
+		"root2/secret.txt",
+	}
+	for _, name := range files {
+		path := filepath.Join(base, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"root/link":      filepath.Join(root, "a.txt"),
+		"root/escape":    filepath.Join(base, "outside", "secret.txt"),
+		"root/escapedir": filepath.Join(base, "outside"),
+		"root/sub/up":    "../..",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(base, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks unavailable: %v", err)
+		}
+	}
+	return base, root
+}
+
+func TestFileResourceJail(t *testing.T) {
+	base, root := jailTree(t)
+	p, err := NewFileResourceProvider(root, FileResourceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri := func(path string) string { return p.uri(filepath.FromSlash(path)) }
+
+	tests := []struct {
+		name string
+		uri  string
+		want string // the file's contents; "" means NotFound
+	}{
+		{"file", uri(root + "/a.txt"), "root/a.txt"},
+		{"nested file", uri(root + "/sub/b.txt"), "root/sub/b.txt"},
+		{"dot-dot that stays inside", "file://" + filepath.ToSlash(root) + "/sub/../a.txt", "root/a.txt"},
+		{"symlink inside the root", uri(root + "/link"), "root/a.txt"},
+
+		{"dot-dot out of the root", "file://" + filepath.ToSlash(root) + "/../outside/secret.txt", ""},
+		{"escaped dot-dot", "file://" + filepath.ToSlash(root) + "/sub/%2e%2e/%2e%2e/outside/secret.txt", ""},
+		{"absolute path outside", uri(base + "/outside/secret.txt"), ""},
+		{"system file", "file:///etc/passwd", ""},
+		{"sibling sharing the root's prefix", uri(base + "/root2/secret.txt"), ""},
+		{"the root itself", uri(root), ""},
+		{"directory", uri(root + "/sub"), ""},
+		{"missing file", uri(root + "/nope.txt"), ""},
+		{"remote host", "file://example.com" + filepath.ToSlash(root) + "/a.txt", ""},
+		{"other scheme", "http://localhost" + filepath.ToSlash(root) + "/a.txt", ""},
+
+		{"symlink to a file outside", uri(root + "/escape"), ""},
+		{"symlink to a directory outside", uri(root + "/escapedir/secret.txt"), ""},
+		{"symlink to the root's parent", uri(root + "/sub/up/outside/secret.txt"), ""},
+
+		{"hidden file", uri(root + "/.env"), ""},
+		{"file in a hidden directory", uri(root + "/.git/config"), ""},
+		{"file in a nested hidden directory", uri(root + "/sub/.cache/c.txt"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents, err := p.ReadResource(tt.uri)
+			if tt.want == "" {
+				if code, _ := mcpflowerr.CodeOf(err); code != mcpflowerr.CodeNotFound {
+					t.Fatalf("ReadResource(%q) = %v, %v; want NotFound", tt.uri, contents, err)
+				}
+				if _, _, err := p.ReadResourceRange(tt.uri, 0, 0); err == nil {
+					t.Fatalf("ReadResourceRange(%q) succeeded; want NotFound", tt.uri)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadResource(%q): %v", tt.uri, err)
+			}
+			if len(contents) != 1 || contents[0].Text != tt.want {
+				t.Fatalf("ReadResource(%q) = %+v, want text %q", tt.uri, contents, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileResourceHidden(t *testing.T) {
+	_, root := jailTree(t)
+	p, err := NewFileResourceProvider(root, FileResourceOptions{IncludeHidden: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{".env", ".git/config", "sub/.cache/c.txt"} {
+		uri := p.uri(filepath.Join(root, filepath.FromSlash(name)))
+		if _, err := p.ReadResource(uri); err != nil {
+			t.Errorf("ReadResource(%q) with IncludeHidden: %v", uri, err)
+		}
+	}
+}
+
+// Resources lists neither hidden files nor symlinks, which are only
+// followed on read once checked.
+func TestFileResourceList(t *testing.T) {
+	_, root := jailTree(t)
+	p, err := NewFileResourceProvider(root, FileResourceOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range p.Resources() {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	if got, want := strings.Join(names, ","), "a.txt,sub/b.txt"; got != want {
+		t.Fatalf("Resources() = %s, want %s", got, want)
+	}
+}
+
+func TestJailPath(t *testing.T) {
+	base, root := jailTree(t)
+	tests := []struct {
+		name string
+		arg  string
+		want string // "" means rejected
+	}{
+		{"file", "a.txt", root + "/a.txt"},
+		{"new file", "new.txt", root + "/new.txt"},
+		{"new file in a new directory", "new/dir/f.txt", root + "/new/dir/f.txt"},
+		{"dot-dot that stays inside", "sub/../a.txt", root + "/a.txt"},
+		{"absolute path is taken as relative", "/etc/passwd", root + "/etc/passwd"},
+		{"symlink inside", "link", root + "/link"},
+
+		{"dot-dot out", "../outside/secret.txt", ""},
+		{"dot-dot to the root's parent", "..", ""},
+		{"dot-dot into a prefixed sibling", "../root2/secret.txt", ""},
+		{"symlink to a file outside", "escape", ""},
+		{"symlink to a directory outside", "escapedir/secret.txt", ""},
+		{"new file under a symlink outside", "escapedir/new.txt", ""},
+		{"symlink to the root's parent", "sub/up/outside/secret.txt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jailPath(root, tt.arg)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("jailPath(%q) = %q; want it rejected", tt.arg, got)
+				}
+				return
+			}
+			if want := filepath.FromSlash(tt.want); err != nil || got != want {
+				t.Fatalf("jailPath(%q) = %q, %v; want %q", tt.arg, got, err, want)
+			}
+		})
+	}
+	if pathWithin(root, filepath.Join(base, "root2")) {
+		t.Error("pathWithin treats a sibling sharing the root's prefix as inside")
+	}
+}
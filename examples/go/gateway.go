@@ -0,0 +1,610 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Aggregating Gateway
+// =============================================================================
+
+const (
+	// namespaceSep joins an upstream's namespace to the names of the tools
+	// and prompts it contributes, e.g. "fs.read_file".
+	namespaceSep = "."
+
+	gatewayListTimeout = 10 * time.Second
+	gatewayCallTimeout = 2 * time.Minute
+)
+
+// UpstreamConfig names a backend MCP server merged into the gateway's
+// catalog. Its tools and prompts are listed as Name + "." + original name.
+// Several configs with the same Name form a pool of identical servers that
+// calls are balanced across in proportion to Weight (default 1).
+type UpstreamConfig struct {
+	Name    string
+	Options mcpflowclient.Options
+	Weight  int
+}
+
+// parseUpstream parses a -upstream flag value of the form name=target,
+// where target is one of:
+//
+//	flow://host:port          MCP-Flow over WebTransport
+//	tcp://host:port           MCP-Flow over TCP+TLS
+//	wss://host:port/path      MCP-Flow over WebSocket
+//	https://host:port/mcp     MCP Streamable HTTP
+//	stdio:command args...     a stdio MCP server run as a subprocess
+//
+// optionally followed by ",weight=N" for pooled upstreams.
+func parseUpstream(spec string) (UpstreamConfig, error) {
+	name, target, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || target == "" {
+		return UpstreamConfig{}, fmt.Errorf("upstream %q: want name=target", spec)
+	}
+	target, weight, err := splitWeight(target)
+	if err != nil {
+		return UpstreamConfig{}, fmt.Errorf("upstream %q: %w", spec, err)
+	}
+	if strings.Contains(name, namespaceSep) {
+		return UpstreamConfig{}, fmt.Errorf("upstream %q: name must not contain %q", spec, namespaceSep)
+	}
+
+	var opts mcpflowclient.Options
+	switch {
+	case strings.HasPrefix(target, "stdio:"):
+		opts.Command = strings.Fields(strings.TrimPrefix(target, "stdio:"))
+		opts.Order = []string{mcpflowclient.TransportStdio}
+		opts.Stderr = os.Stderr
+	case strings.HasPrefix(target, "flow://"):
+		opts.Addr = strings.TrimPrefix(target, "flow://")
+		opts.Order = []string{mcpflowclient.TransportWebTransport}
+	case strings.HasPrefix(target, "tcp://"):
+		opts.TCPAddr = strings.TrimPrefix(target, "tcp://")
+		opts.Order = []string{mcpflowclient.TransportTCP}
+	case strings.HasPrefix(target, "wss://"):
+		opts.WebSocketURL = target
+		opts.Order = []string{mcpflowclient.TransportWebSocket}
+	case strings.HasPrefix(target, "https://"):
+		opts.HTTPURL = target
+		opts.Order = []string{mcpflowclient.TransportHTTP}
+	default:
+		return UpstreamConfig{}, fmt.Errorf("upstream %q: unsupported target", spec)
+	}
+	if len(opts.Command) == 0 && opts.Order[0] == mcpflowclient.TransportStdio {
+		return UpstreamConfig{}, fmt.Errorf("upstream %q: empty command", spec)
+	}
+
+	return UpstreamConfig{Name: name, Options: opts, Weight: weight}, nil
+}
+
+// upstreamFlags collects repeated -upstream flags. Repeating a name adds a
+// backend to that upstream's pool.
+type upstreamFlags []UpstreamConfig
+
+func (f *upstreamFlags) String() string {
+	names := make([]string, len(*f))
+	for i, u := range *f {
+		names[i] = u.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *upstreamFlags) Set(spec string) error {
+	cfg, err := parseUpstream(spec)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, cfg)
+	return nil
+}
+
+// gateway merges the catalogs of several upstream servers and routes calls
+// back to their owners. Catalogs are fetched live on every list request, so
+// the merged view tracks upstream changes; an upstream that cannot be
+// reached is left out until it recovers.
+type gateway struct {
+	upstreams []*upstream
+	byName    map[string]*upstream
+	logger    *slog.Logger
+
+	mu sync.Mutex
+	// resourceRoutes maps resource URIs to the upstream that listed them.
+	// URIs are left unprefixed since clients and servers treat them as
+	// opaque identifiers; when two upstreams list the same URI the first
+	// configured wins.
+	resourceRoutes map[string]*upstream
+}
+
+// upstream is one backend connection, opened on first use, or a pool of
+// interchangeable members that calls are balanced across.
+type upstream struct {
+	name   string
+	opts   mcpflowclient.Options
+	logger *slog.Logger
+
+	// mu guards the connection, not calls on it, which run concurrently.
+	// gen counts reconnects, so calls that fail together reconnect once.
+	mu     sync.Mutex
+	client *mcpflowclient.Client
+	gen    uint64
+
+	pool    *pool
+	members []*upstream
+}
+
+// newGateway merges configs. The gateway's lists change with its
+// upstreams', so their list_changed notifications are passed to
+// listChanged, unless a config handles notifications itself.
+func newGateway(configs []UpstreamConfig, listChanged func(method string), logger *slog.Logger) *gateway {
+	g := &gateway{
+		byName:         make(map[string]*upstream, len(configs)),
+		logger:         logger.With("component", "gateway"),
+		resourceRoutes: make(map[string]*upstream),
+	}
+
+	var names []string
+	groups := make(map[string][]UpstreamConfig)
+	for _, cfg := range configs {
+		if cfg.Options.OnNotification == nil {
+			cfg.Options.OnNotification = func(method string, _ json.RawMessage) {
+				if strings.HasSuffix(method, "/list_changed") {
+					// Runs on the client's reader, so the broadcast
+					// runs separately.
+					go listChanged(method)
+				}
+			}
+		}
+		if _, ok := groups[cfg.Name]; !ok {
+			names = append(names, cfg.Name)
+		}
+		groups[cfg.Name] = append(groups[cfg.Name], cfg)
+	}
+	for _, name := range names {
+		u := newUpstreamPool(groups[name], g.logger)
+		g.upstreams = append(g.upstreams, u)
+		g.byName[name] = u
+	}
+	return g
+}
+
+// newUpstreamPool builds a single upstream, or a pool when configs holds
+// several backends for the same name.
+func newUpstreamPool(configs []UpstreamConfig, logger *slog.Logger) *upstream {
+	if len(configs) == 1 {
+		return newUpstream(configs[0], logger)
+	}
+
+	u := newUpstream(configs[0], logger)
+	labels := make([]string, len(configs))
+	weights := make([]int, len(configs))
+	for i, cfg := range configs {
+		labels[i] = endpointLabel(cfg.Options)
+		weights[i] = cfg.Weight
+		member := newUpstream(cfg, logger)
+		member.logger = member.logger.With("backend", labels[i])
+		u.members = append(u.members, member)
+	}
+	u.pool = newPool(labels, weights, u.logger)
+	return u
+}
+
+// endpointLabel names a backend in logs.
+func endpointLabel(opts mcpflowclient.Options) string {
+	for _, endpoint := range []string{opts.Addr, opts.TCPAddr, opts.WebSocketURL, opts.HTTPURL} {
+		if endpoint != "" {
+			return endpoint
+		}
+	}
+	return strings.Join(opts.Command, " ")
+}
+
+// runHealthChecks probes the members of every pooled upstream each
+// interval until ctx ends.
+func (g *gateway) runHealthChecks(ctx context.Context, interval time.Duration) {
+	for _, u := range g.upstreams {
+		if u.pool == nil {
+			continue
+		}
+		members := u.members
+		go u.pool.runHealthChecks(ctx, interval, func(ctx context.Context, i int) error {
+			return members[i].ping(ctx)
+		})
+	}
+}
+
+// ping checks the connection with a ping request. A member busy connecting
+// is skipped rather than timed out.
+func (u *upstream) ping(ctx context.Context) error {
+	if !u.mu.TryLock() {
+		return errProbeSkipped
+	}
+	u.mu.Unlock()
+	return u.call(ctx, "ping", nil, nil, false)
+}
+
+func newUpstream(cfg UpstreamConfig, logger *slog.Logger) *upstream {
+	opts := cfg.Options
+	if opts.InitializeParams == nil {
+		opts.InitializeParams = map[string]interface{}{
+			"protocolVersion": latestProtocolVersion,
+			"clientInfo":      map[string]interface{}{"name": serverName + "-gateway", "version": serverVersion},
+		}
+	}
+	ulogger := opts.Logger
+	if ulogger == nil {
+		ulogger = logger.With("upstream", cfg.Name)
+	}
+	return &upstream{name: cfg.Name, opts: opts, logger: ulogger}
+}
+
+// close drops the upstream's connection, if any.
+func (u *upstream) close() {
+	for _, m := range u.members {
+		m.close()
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.dropLocked()
+}
+
+// dropLocked closes the connection, if any, so the next call opens a new
+// one.
+func (u *upstream) dropLocked() {
+	if u.client != nil {
+		u.client.Close()
+		u.client = nil
+		u.gen++
+	}
+}
+
+// call runs one request against the upstream, connecting first if needed.
+// If retry is set, a transport failure triggers one reconnect and retry;
+// tool calls pass false so a dropped connection never runs a tool twice.
+func (u *upstream) call(ctx context.Context, method string, params, result interface{}, retry bool) error {
+	if u.pool != nil {
+		return u.callPooled(ctx, method, params, result, retry)
+	}
+
+	client, gen, err := u.connected(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = client.Call(ctx, method, params, result)
+	var rpcErr *mcpflowerr.Error
+	if err == nil || errors.As(err, &rpcErr) || ctx.Err() != nil {
+		return err
+	}
+
+	u.logger.Warn("upstream call failed, reconnecting", "method", method, "error", err)
+	client, rerr := u.reconnect(ctx, gen)
+	if rerr != nil || !retry {
+		return err
+	}
+	return client.Call(ctx, method, params, result)
+}
+
+// connected returns the connection, opening it if needed, and its
+// generation.
+func (u *upstream) connected(ctx context.Context) (*mcpflowclient.Client, uint64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.connectLocked(ctx); err != nil {
+		return nil, 0, err
+	}
+	return u.client, u.gen, nil
+}
+
+// reconnect replaces the connection of generation gen after a failed call.
+// If another call has replaced it already, that connection is used.
+func (u *upstream) reconnect(ctx context.Context, gen uint64) (*mcpflowclient.Client, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.gen != gen || u.client == nil {
+		if err := u.connectLocked(ctx); err != nil {
+			return nil, err
+		}
+		return u.client, nil
+	}
+	u.gen++
+	if err := u.client.Reconnect(ctx); err != nil {
+		u.client.Close()
+		u.client = nil
+		return nil, err
+	}
+	return u.client, nil
+}
+
+// callPooled runs the call on the next member in rotation. A call that may
+// be retried fails over to another member instead of reconnecting.
+func (u *upstream) callPooled(ctx context.Context, method string, params, result interface{}, retry bool) error {
+	i := u.pool.pick()
+	err := u.members[i].call(ctx, method, params, result, false)
+	u.pool.report(i, err)
+
+	var rpcErr *mcpflowerr.Error
+	if err == nil || !retry || errors.As(err, &rpcErr) || ctx.Err() != nil {
+		return err
+	}
+
+	j := u.pool.pick()
+	err = u.members[j].call(ctx, method, params, result, false)
+	u.pool.report(j, err)
+	return err
+}
+
+func (u *upstream) connectLocked(ctx context.Context) error {
+	if u.client != nil {
+		return nil
+	}
+	client, err := mcpflowclient.Connect(ctx, u.opts)
+	if err != nil {
+		return err
+	}
+	u.client = client
+	return nil
+}
+
+// exited returns a channel closed when a subprocess upstream's process
+// exits, or nil if it is not connected or not a subprocess.
+func (u *upstream) exited() <-chan struct{} {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.client == nil {
+		return nil
+	}
+	return u.client.Exited()
+}
+
+// restart replaces a subprocess upstream's exited process with a new one.
+// It does nothing if a call has already reconnected it.
+func (u *upstream) restart(ctx context.Context) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.client != nil {
+		select {
+		case <-u.client.Exited():
+		default:
+			return nil
+		}
+		u.dropLocked()
+	}
+	return u.connectLocked(ctx)
+}
+
+// offers reports whether the upstream advertised capability at initialize.
+func (u *upstream) offers(ctx context.Context, capability string) (bool, error) {
+	if u.pool != nil {
+		// Members are identical; ask the next one in rotation.
+		i := u.pool.pick()
+		ok, err := u.members[i].offers(ctx, capability)
+		u.pool.report(i, err)
+		return ok, err
+	}
+
+	client, _, err := u.connected(ctx)
+	if err != nil {
+		return false, err
+	}
+	return client.ServerCapabilities().Has(capability), nil
+}
+
+// listAll fetches every page of a list method from each upstream
+// concurrently. Items are returned in upstream order; failed upstreams are
+// logged and skipped.
+func (g *gateway) listAll(method, field string) [][]map[string]interface{} {
+	ctx, cancel := context.WithTimeout(context.Background(), gatewayListTimeout)
+	defer cancel()
+
+	out := make([][]map[string]interface{}, len(g.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range g.upstreams {
+		wg.Add(1)
+		go func(i int, u *upstream) {
+			defer wg.Done()
+			items, err := u.list(ctx, method, field)
+			if err != nil {
+				u.logger.Warn("upstream list failed", "method", method, "error", err)
+				return
+			}
+			out[i] = items
+		}(i, u)
+	}
+	wg.Wait()
+	return out
+}
+
+func (u *upstream) list(ctx context.Context, method, field string) ([]map[string]interface{}, error) {
+	// Skip upstreams that do not offer this kind of catalog at all.
+	capability, _, _ := strings.Cut(method, "/")
+	if ok, err := u.offers(ctx, capability); !ok || err != nil {
+		return nil, err
+	}
+
+	var items []map[string]interface{}
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+
+		var page map[string]interface{}
+		if err := u.call(ctx, method, params, &page, true); err != nil {
+			return nil, err
+		}
+		raw, _ := page[field].([]interface{})
+		for _, item := range raw {
+			if m, ok := item.(map[string]interface{}); ok {
+				items = append(items, m)
+			}
+		}
+
+		next, _ := page["nextCursor"].(string)
+		if next == "" || next == cursor {
+			return items, nil
+		}
+		cursor = next
+	}
+}
+
+// route splits a namespaced name into its upstream and original name.
+func (g *gateway) route(name string) (*upstream, string, bool) {
+	ns, rest, ok := strings.Cut(name, namespaceSep)
+	if !ok {
+		return nil, "", false
+	}
+	u, ok := g.byName[ns]
+	return u, rest, ok
+}
+
+// tools returns the merged, namespaced tool catalog.
+func (g *gateway) tools(withAnnotations bool) []map[string]interface{} {
+	var merged []map[string]interface{}
+	for i, items := range g.listAll("tools/list", "tools") {
+		ns := g.upstreams[i].name
+		for _, t := range items {
+			name, _ := t["name"].(string)
+			entry := make(map[string]interface{}, len(t))
+			for k, v := range t {
+				entry[k] = v
+			}
+			entry["name"] = ns + namespaceSep + name
+			if !withAnnotations {
+				delete(entry, "annotations")
+			}
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+// callTool forwards a namespaced tool call, with the correlation ID ctx
+// carries. The boolean reports whether name belongs to an upstream at all.
+func (g *gateway) callTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, bool, error) {
+	u, tool, ok := g.route(name)
+	if !ok {
+		return nil, false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gatewayCallTimeout)
+	defer cancel()
+
+	var result map[string]interface{}
+	err := u.call(ctx, "tools/call", map[string]interface{}{"name": tool, "arguments": args}, &result, false)
+	if err != nil {
+		return nil, true, upstreamError(u, err)
+	}
+	return result, true, nil
+}
+
+// resources returns the merged resource catalog and refreshes the URI
+// routing table.
+func (g *gateway) resources() []map[string]interface{} {
+	routes := make(map[string]*upstream)
+	merged := []map[string]interface{}{}
+	for i, items := range g.listAll("resources/list", "resources") {
+		u := g.upstreams[i]
+		for _, r := range items {
+			uri, _ := r["uri"].(string)
+			if owner, dup := routes[uri]; dup {
+				u.logger.Warn("duplicate resource URI ignored", "uri", uri, "owner", owner.name)
+				continue
+			}
+			routes[uri] = u
+			merged = append(merged, r)
+		}
+	}
+
+	g.mu.Lock()
+	g.resourceRoutes = routes
+	g.mu.Unlock()
+	return merged
+}
+
+func (g *gateway) readResource(params ResourceParams) (interface{}, error) {
+	uri := params.URI
+
+	g.mu.Lock()
+	u, ok := g.resourceRoutes[uri]
+	g.mu.Unlock()
+	if !ok {
+		// The client may have learned the URI elsewhere; refresh once.
+		g.resources()
+		g.mu.Lock()
+		u, ok = g.resourceRoutes[uri]
+		g.mu.Unlock()
+	}
+	if !ok {
+		return nil, mcpflowerr.NotFound("Unknown resource: %s", uri)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gatewayCallTimeout)
+	defer cancel()
+
+	var result map[string]interface{}
+	if err := u.call(ctx, "resources/read", params, &result, true); err != nil {
+		return nil, upstreamError(u, err)
+	}
+	return result, nil
+}
+
+// prompts returns the merged, namespaced prompt catalog.
+func (g *gateway) prompts() []map[string]interface{} {
+	merged := []map[string]interface{}{}
+	for i, items := range g.listAll("prompts/list", "prompts") {
+		ns := g.upstreams[i].name
+		for _, p := range items {
+			name, _ := p["name"].(string)
+			entry := make(map[string]interface{}, len(p))
+			for k, v := range p {
+				entry[k] = v
+			}
+			entry["name"] = ns + namespaceSep + name
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+func (g *gateway) getPrompt(params PromptsGetParams) (interface{}, error) {
+	u, prompt, ok := g.route(params.Name)
+	if !ok {
+		return nil, mcpflowerr.NotFound("Unknown prompt: %s", params.Name)
+	}
+
+	forwarded := params
+	forwarded.Name = prompt
+
+	ctx, cancel := context.WithTimeout(context.Background(), gatewayCallTimeout)
+	defer cancel()
+
+	var result map[string]interface{}
+	if err := u.call(ctx, "prompts/get", forwarded, &result, true); err != nil {
+		return nil, upstreamError(u, err)
+	}
+	return result, nil
+}
+
+// upstreamError keeps an upstream's own JSON-RPC error as is and reports
+// anything else as the upstream being unavailable.
+func upstreamError(u *upstream, err error) error {
+	if _, ok := mcpflowerr.CodeOf(err); ok {
+		return err
+	}
+	return mcpflowerr.Wrap(mcpflowerr.CodeInternal, err, "upstream "+u.name+" unavailable")
+}
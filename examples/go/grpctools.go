@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// gRPC Tools
+// =============================================================================
+
+const (
+	// grpcCallTimeout bounds each unary call a gRPC tool makes.
+	grpcCallTimeout = 30 * time.Second
+	// grpcReflectionTimeout bounds loading descriptors by reflection.
+	grpcReflectionTimeout = 30 * time.Second
+)
+
+// grpcReflectionMethods are tried in order. v1alpha carries the same
+// messages under its older name, for servers that predate v1.
+var grpcReflectionMethods = []string{
+	rpb.ServerReflection_ServerReflectionInfo_FullMethodName,
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// GRPCOptions configures LoadGRPCTools.
+type GRPCOptions struct {
+	// Descriptors is a FileDescriptorSet file, as written by protoc
+	// --include_imports --descriptor_set_out, describing the services.
+	// When empty they are loaded from the server's reflection service.
+	Descriptors string
+	// Services limits the tools to these fully-qualified services, e.g.
+	// "helloworld.Greeter". Empty means every service but reflection.
+	Services []string
+	// TLSConfig enables TLS. Nil dials in plaintext.
+	TLSConfig *tls.Config
+	// Metadata is sent with every call, e.g. to carry credentials.
+	Metadata metadata.MD
+}
+
+// GRPCToolProvider serves the unary methods of a gRPC server as tools.
+// Register it under a namespace with Handler.RegisterNamespace.
+type GRPCToolProvider struct {
+	conn  *grpc.ClientConn
+	tools StaticTools
+}
+
+// LoadGRPCTools connects to the gRPC server at target and turns each unary
+// method of its services into a tool named Service_Method. Arguments are
+// the request message in its JSON mapping, with an input schema derived
+// from the message descriptor, and the result is the response message as
+// JSON text. Streaming methods are skipped.
+func LoadGRPCTools(ctx context.Context, target string, opts GRPCOptions) (*GRPCToolProvider, error) {
+	creds := insecure.NewCredentials()
+	if opts.TLSConfig != nil {
+		creds = credentials.NewTLS(opts.TLSConfig)
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("grpc %s: %w", target, err)
+	}
+
+	var files *protoregistry.Files
+	if opts.Descriptors != "" {
+		files, err = readDescriptorSet(opts.Descriptors)
+	} else {
+		files, err = reflectFiles(ctx, conn, opts.Metadata)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("grpc %s: %w", target, err)
+	}
+
+	p := &GRPCToolProvider{conn: conn}
+	p.tools = p.buildTools(files, opts)
+	if len(p.tools) == 0 {
+		conn.Close()
+		return nil, fmt.Errorf("grpc %s: no unary methods", target)
+	}
+	return p, nil
+}
+
+// Tools returns one tool per unary method.
+func (p *GRPCToolProvider) Tools() []Tool { return p.tools }
+
+// Close disconnects from the server.
+func (p *GRPCToolProvider) Close() error { return p.conn.Close() }
+
+func (p *GRPCToolProvider) buildTools(files *protoregistry.Files, opts GRPCOptions) StaticTools {
+	wanted := make(map[string]bool, len(opts.Services))
+	for _, s := range opts.Services {
+		wanted[s] = true
+	}
+
+	var services []protoreflect.ServiceDescriptor
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			sd := fd.Services().Get(i)
+			name := string(sd.FullName())
+			if strings.HasPrefix(name, "grpc.reflection.") || len(wanted) > 0 && !wanted[name] {
+				continue
+			}
+			services = append(services, sd)
+		}
+		return true
+	})
+	sort.Slice(services, func(i, j int) bool { return services[i].FullName() < services[j].FullName() })
+
+	var tools StaticTools
+	names := make(map[string]bool)
+	for _, sd := range services {
+		for i := 0; i < sd.Methods().Len(); i++ {
+			md := sd.Methods().Get(i)
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				continue
+			}
+			t := newGRPCTool(p.conn, md, opts.Metadata)
+			for n, name := 2, t.name; names[t.name]; n++ {
+				t.name = fmt.Sprintf("%s_%d", name, n)
+			}
+			names[t.name] = true
+			tools = append(tools, t)
+		}
+	}
+	return tools
+}
+
+func readDescriptorSet(path string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("descriptor set %s: %w", path, err)
+	}
+	return protodesc.NewFiles(&set)
+}
+
+// reflectFiles loads the descriptors of every service the server lists,
+// with their imports, over the reflection service.
+func reflectFiles(ctx context.Context, conn *grpc.ClientConn, md metadata.MD) (*protoregistry.Files, error) {
+	ctx, cancel := context.WithTimeout(ctx, grpcReflectionTimeout)
+	defer cancel()
+	if md != nil {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+
+	var stream grpc.ClientStream
+	var services *rpb.ServerReflectionResponse
+	var err error
+	for _, method := range grpcReflectionMethods {
+		stream, err = conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, method)
+		if err == nil {
+			services, err = reflectionCall(stream, &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+			})
+		}
+		if status.Code(err) != codes.Unimplemented {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reflection: %w", err)
+	}
+	defer stream.CloseSend()
+
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	add := func(resp *rpb.ServerReflectionResponse) error {
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := new(descriptorpb.FileDescriptorProto)
+			if err := proto.Unmarshal(raw, fd); err != nil {
+				return fmt.Errorf("reflection: %w", err)
+			}
+			files[fd.GetName()] = fd
+		}
+		return nil
+	}
+
+	for _, svc := range services.GetListServicesResponse().GetService() {
+		resp, err := reflectionCall(stream, &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: svc.GetName()},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reflection %s: %w", svc.GetName(), err)
+		}
+		if err := add(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	// Servers usually send imports along; fetch any they left out.
+	for {
+		var missing []string
+		for _, fd := range files {
+			for _, dep := range fd.GetDependency() {
+				if files[dep] == nil {
+					missing = append(missing, dep)
+				}
+			}
+		}
+		if len(missing) == 0 {
+			break
+		}
+		for _, name := range missing {
+			if files[name] != nil {
+				continue
+			}
+			resp, err := reflectionCall(stream, &rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: name},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("reflection %s: %w", name, err)
+			}
+			if err := add(resp); err != nil {
+				return nil, err
+			}
+			if files[name] == nil {
+				return nil, fmt.Errorf("reflection: server did not return %s", name)
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range files {
+		set.File = append(set.File, fd)
+	}
+	return protodesc.NewFiles(set)
+}
+
+func reflectionCall(stream grpc.ClientStream, req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	resp := new(rpb.ServerReflectionResponse)
+	if err := stream.RecvMsg(resp); err != nil {
+		return nil, err
+	}
+	if e := resp.GetErrorResponse(); e != nil {
+		return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+	}
+	return resp, nil
+}
+
+// grpcTool calls one unary method.
+type grpcTool struct {
+	name        string
+	description string
+	schema      map[string]interface{}
+	annotations ToolAnnotations
+
+	conn       *grpc.ClientConn
+	method     protoreflect.MethodDescriptor
+	fullMethod string
+	metadata   metadata.MD
+}
+
+func newGRPCTool(conn *grpc.ClientConn, md protoreflect.MethodDescriptor, meta metadata.MD) *grpcTool {
+	sd := md.Parent().(protoreflect.ServiceDescriptor)
+	fullMethod := "/" + string(sd.FullName()) + "/" + string(md.Name())
+
+	description := strings.TrimSpace(md.ParentFile().SourceLocations().ByDescriptor(md).LeadingComments)
+	if description == "" {
+		description = "Calls " + strings.TrimPrefix(fullMethod, "/")
+	}
+
+	t := &grpcTool{
+		name:        string(sd.Name()) + "_" + string(md.Name()),
+		description: description,
+		schema:      messageSchema(md.Input(), nil),
+		conn:        conn,
+		method:      md,
+		fullMethod:  fullMethod,
+		metadata:    meta,
+	}
+	t.schema["additionalProperties"] = false
+
+	// The method's idempotency_level option is the only behavioral hint
+	// a descriptor carries.
+	opts, _ := md.Options().(*descriptorpb.MethodOptions)
+	level := opts.GetIdempotencyLevel()
+	t.annotations = ToolAnnotations{
+		ReadOnlyHint:   level == descriptorpb.MethodOptions_NO_SIDE_EFFECTS,
+		IdempotentHint: level != descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN,
+		OpenWorldHint:  true,
+	}
+	return t
+}
+
+func (t *grpcTool) Name() string                        { return t.name }
+func (t *grpcTool) Description() string                 { return t.description }
+func (t *grpcTool) InputSchema() map[string]interface{} { return t.schema }
+func (t *grpcTool) Annotations() ToolAnnotations        { return t.annotations }
+
+func (t *grpcTool) Execute(args map[string]interface{}) (interface{}, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *grpcTool) ExecuteContext(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return nil, mcpflowerr.InvalidParams("arguments: %v", err)
+	}
+	in := dynamicpb.NewMessage(t.method.Input())
+	if err := protojson.Unmarshal(raw, in); err != nil {
+		return nil, mcpflowerr.InvalidParams("arguments do not match %s: %v", t.method.Input().FullName(), err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, grpcCallTimeout)
+	defer cancel()
+	if t.metadata != nil {
+		ctx = metadata.NewOutgoingContext(ctx, t.metadata)
+	}
+
+	out := dynamicpb.NewMessage(t.method.Output())
+	if err := t.conn.Invoke(ctx, t.fullMethod, in, out); err != nil {
+		return nil, grpcError(err)
+	}
+
+	text, err := protojson.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("encode response: %w", err)
+	}
+	return map[string]interface{}{
+		"content": []map[string]interface{}{{"type": "text", "text": string(text)}},
+	}, nil
+}
+
+// grpcError maps the status codes with an mcpflowerr counterpart; others
+// become tool errors that name the status.
+func grpcError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.InvalidArgument:
+		return mcpflowerr.InvalidParams("%s", st.Message())
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return mcpflowerr.Unauthorized("%s", st.Message())
+	case codes.ResourceExhausted:
+		return mcpflowerr.RateLimited("%s", st.Message())
+	case codes.DeadlineExceeded:
+		return mcpflowerr.Timeout("%s", st.Message())
+	default:
+		return errors.New("gRPC " + st.Code().String() + ": " + st.Message())
+	}
+}
+
+// wellKnownSchemas are the JSON mappings of the well-known types that do
+// not encode as plain objects.
+var wellKnownSchemas = map[protoreflect.FullName]map[string]interface{}{
+	"google.protobuf.Timestamp":   {"type": "string", "format": "date-time"},
+	"google.protobuf.Duration":    {"type": "string", "pattern": `^-?[0-9]+(\.[0-9]+)?s$`},
+	"google.protobuf.FieldMask":   {"type": "string"},
+	"google.protobuf.Struct":      {"type": "object"},
+	"google.protobuf.Value":       {},
+	"google.protobuf.ListValue":   {"type": "array"},
+	"google.protobuf.Any":         {"type": "object", "required": []string{"@type"}},
+	"google.protobuf.Empty":       {"type": "object"},
+	"google.protobuf.BoolValue":   {"type": "boolean"},
+	"google.protobuf.StringValue": {"type": "string"},
+	"google.protobuf.BytesValue":  {"type": "string", "contentEncoding": "base64"},
+	"google.protobuf.FloatValue":  {"type": "number"},
+	"google.protobuf.DoubleValue": {"type": "number"},
+	"google.protobuf.Int32Value":  {"type": "integer"},
+	"google.protobuf.UInt32Value": {"type": "integer"},
+	"google.protobuf.Int64Value":  {"type": []string{"integer", "string"}},
+	"google.protobuf.UInt64Value": {"type": []string{"integer", "string"}},
+}
+
+// messageSchema describes a message's protobuf JSON mapping. A message
+// nested within itself becomes an open object.
+func messageSchema(md protoreflect.MessageDescriptor, inlining map[protoreflect.FullName]bool) map[string]interface{} {
+	if schema, ok := wellKnownSchemas[md.FullName()]; ok {
+		out := make(map[string]interface{}, len(schema))
+		for k, v := range schema {
+			out[k] = v
+		}
+		return out
+	}
+	if inlining[md.FullName()] {
+		return map[string]interface{}{"type": "object"}
+	}
+	if inlining == nil {
+		inlining = make(map[protoreflect.FullName]bool)
+	}
+	inlining[md.FullName()] = true
+	defer delete(inlining, md.FullName())
+
+	properties := make(map[string]interface{})
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		var schema map[string]interface{}
+		switch {
+		case fd.IsMap():
+			schema = map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": fieldSchema(fd.MapValue(), inlining),
+			}
+		case fd.IsList():
+			schema = map[string]interface{}{"type": "array", "items": fieldSchema(fd, inlining)}
+		default:
+			schema = fieldSchema(fd, inlining)
+		}
+		properties[fd.JSONName()] = schema
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// fieldSchema describes a single value of fd, ignoring its cardinality.
+func fieldSchema(fd protoreflect.FieldDescriptor, inlining map[protoreflect.FullName]bool) map[string]interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return map[string]interface{}{"type": "boolean"}
+	case protoreflect.StringKind:
+		return map[string]interface{}{"type": "string"}
+	case protoreflect.BytesKind:
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return map[string]interface{}{"type": "number"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return map[string]interface{}{"type": "integer"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// The JSON mapping writes 64-bit integers as strings.
+		return map[string]interface{}{"type": []string{"integer", "string"}}
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		names := make([]string, values.Len())
+		for i := range names {
+			names[i] = string(values.Get(i).Name())
+		}
+		return map[string]interface{}{"type": "string", "enum": names}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageSchema(fd.Message(), inlining)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// grpcFlags collects repeated -grpc name=target[,option...] flags. The
+// options are tls, descriptors=FILE, and service=NAME (repeatable).
+type grpcFlags []grpcSource
+
+type grpcSource struct {
+	name   string
+	target string
+	tls    bool
+	opts   GRPCOptions
+}
+
+func (f *grpcFlags) String() string {
+	names := make([]string, len(*f))
+	for i, s := range *f {
+		names[i] = s.name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *grpcFlags) Set(value string) error {
+	opts := strings.Split(value, ",")
+	name, target, ok := strings.Cut(opts[0], "=")
+	if !ok || name == "" || target == "" {
+		return fmt.Errorf("want name=target[,tls][,descriptors=FILE][,service=NAME], got %q", value)
+	}
+	s := grpcSource{name: name, target: target}
+	for _, opt := range opts[1:] {
+		key, val, _ := strings.Cut(opt, "=")
+		switch {
+		case key == "tls" && val == "":
+			s.tls = true
+		case key == "descriptors" && val != "":
+			s.opts.Descriptors = val
+		case key == "service" && val != "":
+			s.opts.Services = append(s.opts.Services, val)
+		default:
+			return fmt.Errorf("invalid grpc option %q", opt)
+		}
+	}
+	*f = append(*f, s)
+	return nil
+}
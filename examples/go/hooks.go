@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Lifecycle Hooks
+// =============================================================================
+
+// shutdownHookTimeout bounds how long the shutdown hooks of a server may
+// run in total.
+const shutdownHookTimeout = 10 * time.Second
+
+// InitializeHook is called for every initialize a Handler accepts, with
+// the clientInfo and capabilities the client sent and the result about to
+// be returned. The hook may add or change entries of result; the
+// transport's resumption fields are filled in after it runs. An error
+// rejects the client: it is returned as the initialize error, with the
+// code it carries, or as an invalid request if it carries none.
+type InitializeHook func(sess *Session, client ClientInfo, capabilities map[string]interface{}, result map[string]interface{}) error
+
+// ShutdownHook is called once when the server shuts down, for persisting
+// state. ctx expires when the hooks have run for too long.
+type ShutdownHook func(ctx context.Context) error
+
+// lifecycleHooks are the hooks registered on a Handler.
+type lifecycleHooks struct {
+	mu         sync.RWMutex
+	initialize []InitializeHook
+	shutdown   []ShutdownHook
+	shutOnce   sync.Once
+}
+
+// OnInitialize registers fn to run on every initialize, after the hooks
+// registered before it. Each tenant's Handler has hooks of its own.
+func (h *Handler) OnInitialize(fn InitializeHook) {
+	h.hooks.mu.Lock()
+	h.hooks.initialize = append(h.hooks.initialize, fn)
+	h.hooks.mu.Unlock()
+}
+
+// OnShutdown registers fn to run when the server shuts down. Hooks run in
+// the reverse of the order they were registered in.
+func (h *Handler) OnShutdown(fn ShutdownHook) {
+	h.hooks.mu.Lock()
+	h.hooks.shutdown = append(h.hooks.shutdown, fn)
+	h.hooks.mu.Unlock()
+}
+
+// runInitializeHooks runs the initialize hooks until one rejects the
+// client.
+func (h *Handler) runInitializeHooks(sess *Session, req *RPCRequest, params *InitializeParams, result map[string]interface{}) error {
+	h.hooks.mu.RLock()
+	hooks := h.hooks.initialize
+	h.hooks.mu.RUnlock()
+
+	for _, fn := range hooks {
+		if err := fn(sess, params.ClientInfo, params.Capabilities, result); err != nil {
+			req.logger().Info("client rejected", "client", params.ClientInfo.Name, "error", err)
+			if _, ok := mcpflowerr.CodeOf(err); !ok {
+				err = mcpflowerr.Wrap(ErrCodeInvalidRequest, err, "client rejected")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// shutdown runs the shutdown hooks of h and of its tenants, once.
+func (h *Handler) shutdown(ctx context.Context, logger *slog.Logger) {
+	h.hooks.shutOnce.Do(func() {
+		h.hooks.mu.RLock()
+		hooks := h.hooks.shutdown
+		h.hooks.mu.RUnlock()
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := hooks[i](ctx); err != nil {
+				logger.Warn("shutdown hook failed", "tenant", h.tenant.name, "error", err)
+			}
+		}
+	})
+	for _, th := range h.tenants {
+		th.shutdown(ctx, logger)
+	}
+}
+
+// runShutdownHooks runs every shutdown hook of the server, within
+// shutdownHookTimeout. It is safe to call more than once.
+func (s *Server) runShutdownHooks() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownHookTimeout)
+	defer cancel()
+	s.handler.shutdown(ctx, s.logger)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		s.logger.Warn("shutdown hooks ran out of time", "timeout", shutdownHookTimeout)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// HTTP Tools
+// =============================================================================
+
+const (
+	// httpToolTimeout bounds each attempt of an HTTP tool when its config
+	// sets no timeout.
+	httpToolTimeout = 30 * time.Second
+	// httpToolRetryBackoff is the wait before the first retry; it doubles
+	// with each further attempt.
+	httpToolRetryBackoff = 200 * time.Millisecond
+	// maxHTTPToolRetryAfter caps how long a Retry-After header can delay
+	// a retry.
+	maxHTTPToolRetryAfter = 10 * time.Second
+)
+
+// idempotentHTTPMethods are the methods an HTTP tool retries by default.
+var idempotentHTTPMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// HTTPToolsFile is the document read by LoadHTTPTools.
+type HTTPToolsFile struct {
+	Tools []HTTPToolConfig `yaml:"tools"`
+}
+
+// HTTPToolConfig describes a tool that sends one HTTP request built from
+// its arguments. URL, Headers, and Body are text/template templates
+// executed with the arguments as data, e.g. "/users/{{path .id}}", with
+// these functions:
+//
+//	path   escapes a value for a URL path segment
+//	query  escapes a value for a URL query
+//	json   encodes a value as JSON
+//	env    reads an environment variable of the server, e.g. for a token
+type HTTPToolConfig struct {
+	Name        string                 `yaml:"name"`
+	Description string                 `yaml:"description"`
+	InputSchema map[string]interface{} `yaml:"inputSchema"`
+
+	// Method defaults to GET.
+	Method  string            `yaml:"method"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	// Body is the request body. When empty, POST, PUT, and PATCH send the
+	// arguments as a JSON object.
+	Body string `yaml:"body"`
+
+	// Timeout bounds each attempt; zero means 30s.
+	Timeout time.Duration `yaml:"timeout"`
+	// Retries is how many times to retry after a network error or a 429,
+	// 502, 503, or 504 response. A request that failed may still have
+	// reached the server, so only idempotent methods (GET, HEAD, PUT,
+	// DELETE, OPTIONS) are retried unless RetryUnsafe is set.
+	Retries int `yaml:"retries"`
+	// RetryUnsafe lets POST, PATCH, and other methods be retried, for
+	// endpoints that are safe to repeat, e.g. thanks to an idempotency key.
+	RetryUnsafe bool `yaml:"retryUnsafe"`
+	// MaxResponseBytes truncates the response body returned; zero means
+	// 1 MiB.
+	MaxResponseBytes int64 `yaml:"maxResponseBytes"`
+}
+
+// httpTemplateFuncs are available to HTTP tool templates.
+var httpTemplateFuncs = template.FuncMap{
+	"path":  func(v interface{}) string { return url.PathEscape(argString(v)) },
+	"query": func(v interface{}) string { return url.QueryEscape(argString(v)) },
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"env": os.Getenv,
+}
+
+// LoadHTTPTools reads an HTTPToolsFile, in YAML or JSON, and builds its
+// tools.
+func LoadHTTPTools(path string, client *http.Client) (StaticTools, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file HTTPToolsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("http tools %s: %w", path, err)
+	}
+	if len(file.Tools) == 0 {
+		return nil, fmt.Errorf("http tools %s: no tools", path)
+	}
+
+	tools := make(StaticTools, 0, len(file.Tools))
+	for _, cfg := range file.Tools {
+		t, err := NewHTTPTool(cfg, client)
+		if err != nil {
+			return nil, fmt.Errorf("http tools %s: %w", path, err)
+		}
+		tools = append(tools, t)
+	}
+	return tools, nil
+}
+
+// NewHTTPTool builds the tool cfg describes. A nil client means
+// http.DefaultClient; each attempt is bounded by cfg.Timeout regardless.
+func NewHTTPTool(cfg HTTPToolConfig, client *http.Client) (Tool, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("tool without a name")
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("tool %q: no url", cfg.Name)
+	}
+	if cfg.Retries < 0 || cfg.Timeout < 0 || cfg.MaxResponseBytes < 0 {
+		return nil, fmt.Errorf("tool %q: negative limit", cfg.Name)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	t := &httpTool{cfg: cfg, client: client, method: strings.ToUpper(cfg.Method)}
+	if t.method == "" {
+		t.method = http.MethodGet
+	}
+	if !idempotentHTTPMethods[t.method] && !cfg.RetryUnsafe {
+		t.cfg.Retries = 0
+	}
+	if t.cfg.Timeout == 0 {
+		t.cfg.Timeout = httpToolTimeout
+	}
+	if t.cfg.MaxResponseBytes == 0 {
+		t.cfg.MaxResponseBytes = maxHTTPToolResponse
+	}
+	if t.cfg.InputSchema == nil {
+		t.cfg.InputSchema = map[string]interface{}{"type": "object"}
+	}
+
+	parse := func(field, text string) (*template.Template, error) {
+		tmpl, err := template.New(field).Funcs(httpTemplateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("tool %q: %w", cfg.Name, err)
+		}
+		return tmpl, nil
+	}
+	var err error
+	if t.url, err = parse("url", cfg.URL); err != nil {
+		return nil, err
+	}
+	if cfg.Body != "" {
+		if t.body, err = parse("body", cfg.Body); err != nil {
+			return nil, err
+		}
+	}
+	t.headers = make(map[string]*template.Template, len(cfg.Headers))
+	for name, value := range cfg.Headers {
+		if t.headers[name], err = parse(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	t.annotations = ToolAnnotations{
+		ReadOnlyHint:    t.method == http.MethodGet || t.method == http.MethodHead,
+		DestructiveHint: t.method == http.MethodDelete,
+		IdempotentHint:  t.method != http.MethodPost && t.method != http.MethodPatch,
+		OpenWorldHint:   true,
+	}
+	return t, nil
+}
+
+// httpTool sends a templated HTTP request.
+type httpTool struct {
+	cfg         HTTPToolConfig
+	method      string
+	annotations ToolAnnotations
+
+	url     *template.Template
+	headers map[string]*template.Template
+	body    *template.Template
+
+	client *http.Client
+}
+
+func (t *httpTool) Name() string                        { return t.cfg.Name }
+func (t *httpTool) Description() string                 { return t.cfg.Description }
+func (t *httpTool) InputSchema() map[string]interface{} { return t.cfg.InputSchema }
+func (t *httpTool) Annotations() ToolAnnotations        { return t.annotations }
+
+func (t *httpTool) Execute(args map[string]interface{}) (interface{}, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *httpTool) ExecuteContext(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	required, _ := t.cfg.InputSchema["required"].([]interface{})
+	for _, r := range required {
+		name, _ := r.(string)
+		if v, ok := args[name]; !ok || v == nil {
+			return nil, mcpflowerr.InvalidParams("missing required argument %q", name).
+				WithOffender(name, "required")
+		}
+	}
+
+	target, err := renderHTTPTemplate(t.url, args)
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, mcpflowerr.InvalidParams("arguments produce an invalid URL %q", target)
+	}
+
+	header := http.Header{}
+	for name, tmpl := range t.headers {
+		value, err := renderHTTPTemplate(tmpl, args)
+		if err != nil {
+			return nil, err
+		}
+		header.Set(name, value)
+	}
+
+	var body []byte
+	switch {
+	case t.body != nil:
+		text, err := renderHTTPTemplate(t.body, args)
+		if err != nil {
+			return nil, err
+		}
+		body = []byte(text)
+	case t.method == http.MethodPost || t.method == http.MethodPut || t.method == http.MethodPatch:
+		if body, err = json.Marshal(args); err != nil {
+			return nil, mcpflowerr.InvalidParams("arguments: %v", err)
+		}
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", "application/json")
+		}
+	}
+
+	backoff := httpToolRetryBackoff
+	for attempt := 0; ; attempt++ {
+		result, wait, err := t.attempt(ctx, target, header, body)
+		if wait < 0 || attempt == t.cfg.Retries {
+			return result, err
+		}
+		if wait == 0 {
+			wait = backoff
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// attempt sends the request once. A non-negative wait asks for a retry,
+// after that long if it is positive.
+func (t *httpTool) attempt(ctx context.Context, target string, header http.Header, body []byte) (result interface{}, wait time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(ctx, t.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, t.method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, -1, err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = mcpflowerr.Timeout("%s %s: no response within %s", t.method, req.URL.Redacted(), t.cfg.Timeout)
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	wait = -1
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		wait = 0
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			wait = min(time.Duration(secs)*time.Second, maxHTTPToolRetryAfter)
+		}
+	}
+	result, err = httpToolResult(resp, t.cfg.MaxResponseBytes)
+	return result, wait, err
+}
+
+// renderHTTPTemplate executes an HTTP tool template. Failures are the arguments'
+// fault, since the templates parsed at load time.
+func renderHTTPTemplate(tmpl *template.Template, args map[string]interface{}) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, args); err != nil {
+		return "", mcpflowerr.InvalidParams("%s: %v", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// namedFileFlags collects repeated name=file flags, such as -http-tools
+// and -command-tools.
+type namedFileFlags []namedFile
+
+type namedFile struct {
+	name string
+	file string
+}
+
+func (f *namedFileFlags) String() string {
+	names := make([]string, len(*f))
+	for i, s := range *f {
+		names[i] = s.name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *namedFileFlags) Set(value string) error {
+	name, file, ok := strings.Cut(value, "=")
+	if !ok || name == "" || file == "" {
+		return fmt.Errorf("want name=file, got %q", value)
+	}
+	*f = append(*f, namedFile{name: name, file: file})
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// A failed POST may already have taken effect, so it is only retried when
+// the tool opts in.
+func TestHTTPToolRetries(t *testing.T) {
+	tests := []struct {
+		method      string
+		retryUnsafe bool
+		want        int32
+	}{
+		{http.MethodGet, false, 3},
+		{http.MethodPut, false, 3},
+		{http.MethodDelete, false, 3},
+		{http.MethodPost, false, 1},
+		{http.MethodPatch, false, 1},
+		{http.MethodPost, true, 3},
+	}
+	for _, tt := range tests {
+		var hits atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		}))
+		tool, err := NewHTTPTool(HTTPToolConfig{
+			Name:        "hook",
+			Method:      tt.method,
+			URL:         srv.URL,
+			Retries:     2,
+			RetryUnsafe: tt.retryUnsafe,
+		}, srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tool.Execute(map[string]interface{}{})
+		srv.Close()
+		if got := hits.Load(); got != tt.want {
+			t.Errorf("%s with retryUnsafe %v: %d requests, want %d", tt.method, tt.retryUnsafe, got, tt.want)
+		}
+	}
+}
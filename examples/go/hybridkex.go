@@ -0,0 +1,10 @@
+//go:build go1.24
+
+package main
+
+import "crypto/tls"
+
+// hybridKeyExchanges are the key exchanges Config.PostQuantum limits TLS
+// to: X25519 combined with ML-KEM-768, which stays secure if either is
+// broken.
+var hybridKeyExchanges = []tls.CurveID{tls.X25519MLKEM768}
@@ -0,0 +1,9 @@
+//go:build !go1.24
+
+package main
+
+import "crypto/tls"
+
+// hybridKeyExchanges is empty before Go 1.24, whose crypto/tls is the
+// first with ML-KEM, so Config.PostQuantum cannot be honored.
+var hybridKeyExchanges []tls.CurveID
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Idempotency Cache
+// =============================================================================
+
+// maxIdempotencyKeys bounds the keys remembered at once. Past it, the
+// oldest finished response is forgotten early to make room; if every key
+// is still running, new keys are refused as overloaded.
+const maxIdempotencyKeys = 10000
+
+// idempotencyCache remembers tools/call responses by client-supplied
+// idempotency key so a request retried after connection loss returns the
+// original response instead of executing the tool a second time. Keys are
+// shared across sessions, since a retry usually arrives on a new one.
+type idempotencyCache struct {
+	window   time.Duration
+	capacity int
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	// finished holds the finished entries in the order they finished,
+	// which, with one window for all, is the order they expire.
+	finished *list.List
+}
+
+type idempotencyEntry struct {
+	key     string
+	tool    string
+	args    string // hash of the canonical arguments
+	done    chan struct{}
+	resp    *RPCResponse
+	expires time.Time
+	elem    *list.Element // in finished, once done
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		window:   window,
+		capacity: maxIdempotencyKeys,
+		entries:  make(map[string]*idempotencyEntry),
+		finished: list.New(),
+	}
+}
+
+// Do runs fn at most once per key within the retention window. A duplicate
+// that arrives while the first call is still executing waits for it to
+// finish. The returned bool reports whether the response was replayed.
+// Reusing a key for a different tool, or with different arguments, is
+// rejected with an error.
+func (c *idempotencyCache) Do(key, tool string, args map[string]interface{}, fn func() *RPCResponse) (*RPCResponse, bool, error) {
+	argsHash := hashArguments(args)
+	now := time.Now()
+
+	c.mu.Lock()
+	c.evictLocked(now)
+	if e, ok := c.entries[key]; ok {
+		c.mu.Unlock()
+		if e.tool != tool {
+			return nil, false, mcpflowerr.InvalidParams("idempotency key %q already used for tool %q", key, e.tool)
+		}
+		if e.args != argsHash {
+			return nil, false, mcpflowerr.InvalidParams("idempotency key %q already used with different arguments", key)
+		}
+		<-e.done
+		return e.resp, true, nil
+	}
+	if len(c.entries) >= c.capacity {
+		oldest := c.finished.Front()
+		if oldest == nil {
+			c.mu.Unlock()
+			return nil, false, mcpflowerr.Overloaded("too many idempotent calls in progress").WithRetryAfter(time.Second)
+		}
+		c.removeLocked(oldest.Value.(*idempotencyEntry))
+	}
+
+	e := &idempotencyEntry{key: key, tool: tool, args: argsHash, done: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	resp := fn()
+
+	c.mu.Lock()
+	e.resp = resp
+	e.expires = time.Now().Add(c.window)
+	e.elem = c.finished.PushBack(e)
+	c.mu.Unlock()
+	close(e.done)
+
+	return resp, false, nil
+}
+
+// holds reports whether a response is remembered, or being made, for key.
+func (c *idempotencyCache) holds(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	return ok && (e.expires.IsZero() || time.Now().Before(e.expires))
+}
+
+// evictLocked drops the finished entries whose retention window has
+// elapsed, stopping at the first that has not.
+func (c *idempotencyCache) evictLocked(now time.Time) {
+	for elem := c.finished.Front(); elem != nil; elem = c.finished.Front() {
+		e := elem.Value.(*idempotencyEntry)
+		if !now.After(e.expires) {
+			return
+		}
+		c.removeLocked(e)
+	}
+}
+
+func (c *idempotencyCache) removeLocked(e *idempotencyEntry) {
+	c.finished.Remove(e.elem)
+	if c.entries[e.key] == e {
+		delete(c.entries, e.key)
+	}
+}
+
+// hashArguments fingerprints tool arguments. encoding/json sorts map keys,
+// so equal arguments hash equally; no arguments and empty ones are the
+// same.
+func hashArguments(args map[string]interface{}) string {
+	if len(args) == 0 {
+		args = map[string]interface{}{}
+	}
+	body, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
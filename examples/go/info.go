@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// =============================================================================
+// Info Endpoint
+// =============================================================================
+
+// GET / on the main address describes the server in JSON, for load
+// balancers and operators:
+//
+//	{"name": "mcp-flow-echo-go", "version": "1.0.0", "protocol": "mcp-flow/0.1",
+//	 "status": "ready", "alternatives": [...]}
+//
+// Config.Info decides who may read it ("public", "auth", or "off") and
+// Config.InfoFields which of these fields it shows, since a name and
+// version tell a scanner which vulnerabilities to try.
+const (
+	infoPublic = "public"
+	infoAuth   = "auth"
+	infoOff    = "off"
+)
+
+// infoFields are the fields of the info endpoint, in the order
+// Config.InfoFields may name them.
+var infoFields = []string{"name", "version", "protocol", "status", "alternatives"}
+
+// infoHandler returns the handler for GET /, or nil when the endpoint is
+// off.
+func (s *Server) infoHandler() (http.Handler, error) {
+	show := make(map[string]bool, len(infoFields))
+	for _, field := range infoFields {
+		show[field] = len(s.cfg.InfoFields) == 0
+	}
+	for _, field := range s.cfg.InfoFields {
+		if _, ok := show[field]; !ok {
+			return nil, fmt.Errorf("unknown info field %q", field)
+		}
+		show[field] = true
+	}
+
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		info := map[string]interface{}{}
+		if show["name"] {
+			info["name"] = serverName
+		}
+		if show["version"] {
+			info["version"] = serverVersion
+		}
+		if show["protocol"] {
+			info["protocol"] = "mcp-flow/" + mcpFlowVersion
+		}
+		if show["status"] {
+			status := "ready"
+			if s.handler.drain.isDraining() {
+				status = "draining"
+			}
+			info["status"] = status
+		}
+		if alts := s.cfg.transportAlternatives(); show["alternatives"] && len(alts) > 0 {
+			info["alternatives"] = alts
+		}
+		json.NewEncoder(w).Encode(info)
+	})
+
+	switch s.cfg.Info {
+	case "", infoPublic:
+		return h, nil
+	case infoAuth:
+		if s.cfg.AuthToken == "" {
+			return nil, errors.New("info endpoint set to auth without an auth token")
+		}
+		return s.requireAuth(h), nil
+	case infoOff:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown info endpoint policy %q", s.cfg.Info)
+}
+
+// securityHeaders sets the response headers that keep browsers from
+// sniffing, framing, or caching responses, and from leaving HTTPS.
+// Handlers may still override them, as the SSE streams do Cache-Control.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		h.Set("Referrer-Policy", "no-referrer")
+		if r.TLS != nil {
+			h.Set("Strict-Transport-Security", "max-age=63072000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
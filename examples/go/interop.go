@@ -0,0 +1,119 @@
+package main
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// =============================================================================
+// Interop Profile
+// =============================================================================
+
+// Quirks of other MCP implementations that Config.Lenient accepts.
+const (
+	// quirkMissingVersion is a message without "jsonrpc": "2.0".
+	quirkMissingVersion = "missing jsonrpc field"
+	// quirkNumericStringID is a peer echoing a numeric ID as a string, or
+	// a string ID holding a number as that number.
+	quirkNumericStringID = "numeric string id"
+	// quirkLineFraming is NDJSON written to a length-prefixed stream.
+	quirkLineFraming = "NDJSON on a framed stream"
+)
+
+// tolerate logs that the session relied on quirk, the first time it does.
+func (s *Session) tolerate(quirk string) {
+	s.mu.Lock()
+	seen := s.quirks[quirk]
+	if !seen {
+		if s.quirks == nil {
+			s.quirks = make(map[string]bool)
+		}
+		s.quirks[quirk] = true
+	}
+	s.mu.Unlock()
+	if !seen {
+		s.logger.Warn("tolerating interop quirk", "quirk", quirk)
+	}
+}
+
+// validVersion reports whether req names JSON-RPC 2.0. Under the interop
+// profile a message that leaves the member out is taken as 2.0.
+func (h *Handler) validVersion(sess *Session, req *RPCRequest) bool {
+	if req.JSONRPC == "2.0" {
+		return true
+	}
+	if req.JSONRPC == "" && h.cfg.Lenient {
+		sess.tolerate(quirkMissingVersion)
+		return true
+	}
+	return false
+}
+
+func (h *Handler) invalidVersionResponse(req *RPCRequest) *RPCResponse {
+	if req.ID.IsZero() {
+		return nil
+	}
+	return h.errorResponse(req.ID, ErrCodeInvalidRequest, `Invalid Request: jsonrpc must be "2.0"`)
+}
+
+// correlationKey is the key id is filed under in a table that pairs
+// responses with requests. Under the interop profile a string holding an
+// integer is filed as that integer, so a peer that echoes 7 as "7", or "7"
+// as 7, still has its response matched.
+func (s *Session) correlationKey(id RequestID) RequestID {
+	if !s.handler.cfg.Lenient {
+		return id
+	}
+	if n, ok := id.numericString(); ok {
+		s.tolerate(quirkNumericStringID)
+		return n
+	}
+	return id
+}
+
+// sniffFraming returns the codec a session on a length-prefixed stream
+// should use under the interop profile: one that reads NDJSON instead if
+// that is what the client writes. Other codecs are returned as they are.
+func (s *Session) sniffFraming(codec Codec) Codec {
+	if _, framed := codec.(*FrameCodec); !framed {
+		return codec
+	}
+	line := withJSON(NewLineCodec(maxFrameSize), s.handler.jsonEngine())
+	return &sniffCodec{frame: codec, line: line, onLine: func() { s.tolerate(quirkLineFraming) }}
+}
+
+// sniffCodec decodes a length-prefixed stream that may carry NDJSON
+// instead. The stream's first byte decides: no accepted frame has a
+// length prefix that begins with '{', the first byte of every JSON-RPC
+// line. Responses are then encoded the way the client writes; anything
+// encoded before the first request is read is length-prefixed.
+type sniffCodec struct {
+	frame, line Codec
+	onLine      func()
+
+	sniffed bool // only touched by Decode, which one goroutine calls
+	lines   atomic.Bool
+}
+
+func (c *sniffCodec) Encode(v interface{}) ([]byte, error) {
+	if c.lines.Load() {
+		return c.line.Encode(v)
+	}
+	return c.frame.Encode(v)
+}
+
+func (c *sniffCodec) Decode(r io.Reader) (*RPCRequest, error) {
+	if !c.sniffed {
+		c.sniffed = true
+		if p, ok := r.(interface{ Peek(int) ([]byte, error) }); ok {
+			if first, err := p.Peek(1); err == nil && first[0] == '{' {
+				c.lines.Store(true)
+				c.onLine()
+			}
+		}
+	}
+	if c.lines.Load() {
+		return c.line.Decode(r)
+	}
+	return c.frame.Decode(r)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// =============================================================================
+// JSON Engine
+// =============================================================================
+
+// JSONEngine marshals and unmarshals the JSON-RPC messages on the wire. JSON
+// dominates the CPU profile of a chatty tool server, so deployments can set
+// Config.JSON to a faster drop-in for encoding/json, such as goccy/go-json
+// or bytedance/sonic, wrapped in a few lines:
+//
+//	type goccyJSON struct{}
+//
+//	func (goccyJSON) Marshal(v interface{}) ([]byte, error)      { return gojson.Marshal(v) }
+//	func (goccyJSON) Unmarshal(data []byte, v interface{}) error { return gojson.Unmarshal(data, v) }
+//	func (goccyJSON) NewEncoder(w io.Writer) JSONEncoder         { return gojson.NewEncoder(w) }
+//	func (goccyJSON) NewDecoder(r io.Reader) JSONDecoder         { return gojson.NewDecoder(r) }
+//
+// The engine is used by the codecs of every streaming transport and by the
+// HTTP transports for requests and responses. Tool arguments and results
+// are still built with encoding/json types such as json.RawMessage, which
+// both of those libraries honor.
+type JSONEngine interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	NewEncoder(w io.Writer) JSONEncoder
+	NewDecoder(r io.Reader) JSONDecoder
+}
+
+// JSONEncoder writes JSON values to a stream, each followed by a newline,
+// like *json.Encoder.
+type JSONEncoder interface {
+	Encode(v interface{}) error
+}
+
+// JSONDecoder reads one JSON value at a time from a stream, like
+// *json.Decoder.
+type JSONDecoder interface {
+	Decode(v interface{}) error
+	// Buffered returns the data read from the stream but not yet decoded.
+	Buffered() io.Reader
+}
+
+// StdJSON is the encoding/json engine, the default.
+type StdJSON struct{}
+
+func (StdJSON) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (StdJSON) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (StdJSON) NewEncoder(w io.Writer) JSONEncoder         { return json.NewEncoder(w) }
+func (StdJSON) NewDecoder(r io.Reader) JSONDecoder         { return json.NewDecoder(r) }
+
+// jsonEngine returns the handler's JSON engine.
+func (h *Handler) jsonEngine() JSONEngine {
+	if h.cfg.JSON == nil {
+		return StdJSON{}
+	}
+	return h.cfg.JSON
+}
+
+// withJSON returns a copy of codec that uses engine, if it is one of the
+// built-in codecs; other codecs are returned as they are.
+func withJSON(codec Codec, engine JSONEngine) Codec {
+	switch c := codec.(type) {
+	case *FrameCodec:
+		copied := *c
+		copied.json = engine
+		return &copied
+	case *LineCodec:
+		copied := *c
+		copied.json = engine
+		return &copied
+	}
+	return codec
+}
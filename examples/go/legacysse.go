@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Legacy HTTP+SSE Transport
+// =============================================================================
+
+const (
+	legacySSEPath       = "/sse"
+	legacyMessagesPath  = "/messages"
+	legacySSEKeepalive  = 30 * time.Second
+	legacySSEQueueDepth = 64
+)
+
+// legacySSE implements the 2024-11-05 MCP HTTP+SSE transport for older
+// clients: a GET opens an event stream whose first "endpoint" event names
+// the URL to POST messages to, and responses come back on the stream as
+// "message" events. Sessions share the server's Handler with MCP-Flow.
+type legacySSE struct {
+	handler *Handler
+	logger  *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*legacySSESession
+}
+
+type legacySSESession struct {
+	sess *Session
+	out  chan []byte
+	done chan struct{}
+	// cancel ends the event stream, closing the session.
+	cancel       context.CancelFunc
+	overflowOnce sync.Once
+}
+
+func newLegacySSE(handler *Handler, logger *slog.Logger) *legacySSE {
+	return &legacySSE{
+		handler:  handler,
+		logger:   logger.With("transport", "sse"),
+		sessions: make(map[string]*legacySSESession),
+	}
+}
+
+// push queues a server-initiated message on the event stream, dropping it
+// if the queue is full. A client holding more than its memory budget in
+// queued messages has stopped reading, and its stream is closed.
+func (e *legacySSESession) push(msg *RPCRequest) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if !e.sess.budget.reserve(len(data)) {
+		e.overflow()
+		return errSessionMemory
+	}
+	select {
+	case e.out <- data:
+		return nil
+	case <-e.done:
+		err = errors.New("session closed")
+	default:
+		err = errors.New("event stream queue full")
+	}
+	e.sess.budget.release(len(data))
+	return err
+}
+
+// overflow closes the session of a client holding more than its memory
+// budget in queued messages.
+func (e *legacySSESession) overflow() {
+	e.overflowOnce.Do(func() {
+		e.sess.logger.Warn("client too far behind, closing session", "limit", e.sess.budget.limit)
+		e.cancel()
+	})
+}
+
+// handleStream serves GET /sse for the lifetime of one session.
+func (t *legacySSE) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	// The stream is most likely stuck writing to the client when it is
+	// cancelled, so cut the write short too.
+	stop := context.AfterFunc(ctx, func() {
+		http.NewResponseController(w).SetWriteDeadline(time.Now())
+	})
+	defer stop()
+
+	route := routeFrom(r.Context(), t.handler)
+	id := newSessionID()
+	entry := &legacySSESession{
+		sess:   NewSession(route.handler, t.logger.With("session", id, "remote", r.RemoteAddr)),
+		out:    make(chan []byte, legacySSEQueueDepth),
+		done:   make(chan struct{}),
+		cancel: cancel,
+	}
+
+	entry.sess.push = entry.push
+	entry.sess.setPeer("sse", r.RemoteAddr)
+	t.mu.Lock()
+	t.sessions[id] = entry
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.sessions, id)
+		t.mu.Unlock()
+		close(entry.done)
+		entry.sess.Close()
+		entry.sess.logger.Info("session closed")
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "event: endpoint\ndata: %s%s?sessionId=%s\n\n", route.basePath, legacyMessagesPath, id)
+	flusher.Flush()
+	entry.sess.logger.Info("session established")
+
+	keepalive := time.NewTicker(legacySSEKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-entry.out:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+			flusher.Flush()
+			entry.sess.budget.release(len(msg))
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// handleMessage serves POST /messages?sessionId=... and queues any
+// responses onto the session's event stream.
+func (t *legacySSE) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	t.mu.Lock()
+	entry, ok := t.sessions[r.URL.Query().Get("sessionId")]
+	t.mu.Unlock()
+	if !ok || entry.sess.handler != routeFrom(r.Context(), t.handler).handler {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxFrameSize+1))
+	if err != nil || len(body) > maxFrameSize {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	reqs, _, err := decodeHTTPMessages(entry.sess.handler.jsonEngine(), body)
+	if err != nil {
+		http.Error(w, "parse error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	for _, req := range reqs {
+		resp := entry.sess.handler.Handle(entry.sess, req)
+		if resp == nil {
+			continue
+		}
+
+		data, err := entry.sess.handler.jsonEngine().Marshal(resp)
+		if err != nil {
+			entry.sess.logger.Error("encode failed", "error", err)
+			continue
+		}
+
+		// Responses wait for room in the queue rather than being dropped,
+		// but still count against the budget while they do.
+		if !entry.sess.budget.reserve(len(data)) {
+			entry.overflow()
+			return
+		}
+		select {
+		case entry.out <- data:
+		case <-entry.done:
+			entry.sess.budget.release(len(data))
+			return
+		}
+	}
+}
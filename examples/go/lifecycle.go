@@ -0,0 +1,52 @@
+package main
+
+import "github.com/mcp-flow/examples/go/mcpflowerr"
+
+// =============================================================================
+// Session Lifecycle
+// =============================================================================
+
+// A session starts uninitialized. Until initialize has succeeded the
+// server answers only initialize and ping, refusing other requests with a
+// not_initialized (-32018) error and dropping notifications, since nothing
+// about the client is known yet: not its protocol version, its
+// capabilities, or, on transports that authenticate in initialize, who it
+// is. Once initialized, a second initialize is refused as an invalid
+// request; a client that wants to start over opens a new session.
+
+// admits reports whether the session's state allows req.
+func (s *Session) admits(req *RPCRequest) bool {
+	initialized := s.isInitialized()
+	switch req.Method {
+	case "initialize":
+		return !initialized
+	case "ping":
+		return true
+	}
+	return initialized
+}
+
+// lifecycleResponse answers a request the session's state does not allow.
+func (h *Handler) lifecycleResponse(sess *Session, req *RPCRequest) *RPCResponse {
+	if req.ID.IsZero() {
+		return nil
+	}
+	if req.Method == "initialize" {
+		return h.errorResponse(req.ID, ErrCodeInvalidRequest, "Invalid Request: session already initialized")
+	}
+	return h.toolErrorResponse(req.ID, mcpflowerr.NotInitialized("%s before initialize", req.Method))
+}
+
+// setInitialized records that initialize succeeded.
+func (s *Session) setInitialized() {
+	s.mu.Lock()
+	s.initialized = true
+	s.mu.Unlock()
+}
+
+// isInitialized reports whether initialize has succeeded.
+func (s *Session) isInitialized() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.initialized
+}
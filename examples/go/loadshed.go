@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime/metrics"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Load Shedding
+// =============================================================================
+
+const (
+	// loadSampleInterval is how often the memory watermark is checked.
+	loadSampleInterval = 250 * time.Millisecond
+	// loadShedHigh and loadShedLow are the fractions of Config.MemoryLimit
+	// at which shedding starts and stops. The gap keeps the server from
+	// flapping around a single threshold.
+	loadShedHigh = 0.9
+	loadShedLow  = 0.8
+	// loadRetryAfter is the retry hint sent with an overloaded error.
+	loadRetryAfter = 2 * time.Second
+)
+
+// loadShedder turns work away while the process's memory is near
+// Config.MemoryLimit: new tool calls fail with a retryable overloaded error
+// and new sessions are refused, while the work already admitted finishes
+// and frees what it holds. A zero limit never sheds.
+type loadShedder struct {
+	limit    uint64
+	shedding atomic.Bool
+}
+
+// overloaded reports whether new work should be refused.
+func (l *loadShedder) overloaded() bool {
+	return l != nil && l.shedding.Load()
+}
+
+// admit returns an overloaded error while shedding.
+func (l *loadShedder) admit() error {
+	if !l.overloaded() {
+		return nil
+	}
+	return mcpflowerr.Overloaded("server is low on memory").WithRetryAfter(loadRetryAfter)
+}
+
+// watch samples memory use until ctx is done, switching shedding on above
+// the high watermark and off again below the low one.
+func (l *loadShedder) watch(ctx context.Context, logger *slog.Logger) {
+	if l == nil || l.limit == 0 {
+		return
+	}
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	high := uint64(float64(l.limit) * loadShedHigh)
+	low := uint64(float64(l.limit) * loadShedLow)
+
+	ticker := time.NewTicker(loadSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Memory the runtime has mapped and not handed back to the OS,
+		// which is what an OOM killer sees.
+		metrics.Read(samples)
+		used := samples[0].Value.Uint64() - samples[1].Value.Uint64()
+		switch {
+		case used >= high && !l.shedding.Load():
+			l.shedding.Store(true)
+			logger.Warn("memory high, shedding load", "used", used, "limit", l.limit)
+		case used < low && l.shedding.Load():
+			l.shedding.Store(false)
+			logger.Info("memory recovered, accepting load", "used", used, "limit", l.limit)
+		}
+	}
+}
+
+// shedUpgrades refuses requests that would open a new session while the
+// server is shedding load, with 503 and a Retry-After hint.
+func (s *Server) shedUpgrades(next http.Handler) http.Handler {
+	l := s.handler.load
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.overloaded() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(loadRetryAfter.Seconds())))
+			http.Error(w, "server overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
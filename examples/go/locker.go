@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Exclusive Tools
+// =============================================================================
+
+// Some tools must not run twice at once anywhere, such as a migration
+// that two instances behind a load balancer could otherwise start
+// together. A tool is exclusive when it implements ExclusiveTool, or when
+// Config.ExclusiveTools names it, which also covers upstream tools. Each
+// call of one first takes a lock named after the tool (and its tenant)
+// from Config.Locker, shared by every instance pointed at the same Redis
+// or etcd; without a Locker, the lock only spans this process.
+//
+// A call that finds the lock held retries for up to Config.LockWait, then
+// fails with busy (-32019). The lock is taken for lockTTL and renewed
+// while the tool runs, so a crashed instance's lock soon expires; if the
+// lock is lost anyway, the tool's context is cancelled, which the built-in
+// tools and upstream calls obey but a tool without ExecuteContext cannot
+// see. A call that cannot reach the Locker fails rather than run
+// unguarded.
+// mcpflow_tool_busy_total counts refused calls by tool.
+
+const (
+	// lockTTL is how long a lock outlives its holder's last renewal; it
+	// is renewed every third of that.
+	lockTTL = 30 * time.Second
+	// lockRetry is how often a call waiting for Config.LockWait tries the
+	// lock again.
+	lockRetry = 250 * time.Millisecond
+	// lockTimeout bounds each call to the Locker.
+	lockTimeout = 5 * time.Second
+)
+
+var (
+	// ErrLockHeld is returned by Locker.Acquire while someone else holds
+	// the lock.
+	ErrLockHeld = errors.New("lock held")
+	// ErrLockLost is returned by Lock.Refresh once the lock has expired or
+	// been taken over.
+	ErrLockLost = errors.New("lock lost")
+)
+
+// Locker hands out named locks that expire unless renewed, shared by every
+// server using the same backend.
+type Locker interface {
+	// Acquire takes the lock named key for ttl, or returns ErrLockHeld if
+	// it is held.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is a lock held from a Locker.
+type Lock interface {
+	// Refresh holds the lock for another ttl from now, returning
+	// ErrLockLost if it is no longer held.
+	Refresh(ctx context.Context) error
+	// Release gives the lock up, if it is still held.
+	Release(ctx context.Context) error
+}
+
+// NewLocker returns the Locker for a URL: redis[s]://[[user]:password@]host:port[/db]
+// for Redis or etcd://host:2379 for etcd's v3 JSON API. Locks are kept
+// under mcpflow:lock: in Redis and /mcpflow/locks/ in etcd.
+func NewLocker(rawURL string) (Locker, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("locker url: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("locker url %q: want redis://host:port or etcd://host:port", rawURL)
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		conn, err := newRedisConn(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		return &redisLocker{conn: conn, prefix: "mcpflow:lock:"}, nil
+	case "etcd":
+		client := etcdClient{base: "http://" + u.Host, client: &http.Client{Timeout: lockTimeout}}
+		return &etcdLocker{etcdClient: client, prefix: "/mcpflow/locks/"}, nil
+	}
+	return nil, fmt.Errorf("locker url %q: unsupported scheme %q", rawURL, u.Scheme)
+}
+
+// toolExclusive reports whether calls of the named tool take a lock.
+func (h *Handler) toolExclusive(name string) bool {
+	for _, exclusive := range h.cfg.ExclusiveTools {
+		if exclusive == name {
+			return true
+		}
+	}
+	tool, ok := h.lookupTool(name)
+	if !ok {
+		return false
+	}
+	et, ok := tool.(ExclusiveTool)
+	return ok && et.Exclusive()
+}
+
+// lockTool takes the lock of the named tool, waiting up to
+// Config.LockWait for it. It returns a context derived from ctx that is
+// cancelled if the lock is lost, and a func that releases it.
+func (h *Handler) lockTool(ctx context.Context, name string) (context.Context, func(), error) {
+	key := name
+	if h.tenant.name != "" {
+		key = h.tenant.name + "/" + name
+	}
+	deadline := time.Now().Add(h.cfg.LockWait)
+	var lock Lock
+	for {
+		actx, cancel := context.WithTimeout(ctx, lockTimeout)
+		var err error
+		lock, err = h.locker.Acquire(actx, key, lockTTL)
+		cancel()
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrLockHeld) {
+			return ctx, nil, mcpflowerr.Wrap(mcpflowerr.CodeInternal, err, fmt.Sprintf("locking exclusive tool %q", name))
+		}
+		if time.Now().Add(lockRetry).After(deadline) {
+			h.metrics.ObserveToolBusy(name)
+			return ctx, nil, mcpflowerr.Busy("tool %q is already running", name).WithDetail("tool", name)
+		}
+		select {
+		case <-time.After(lockRetry):
+		case <-ctx.Done():
+			return ctx, nil, ctx.Err()
+		}
+	}
+
+	logger := mcpflow.LoggerFrom(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockTTL / 3)
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			rctx, rcancel := context.WithTimeout(context.Background(), lockTimeout)
+			err := lock.Refresh(rctx)
+			rcancel()
+			if err == nil {
+				renewed = time.Now()
+				continue
+			}
+			if errors.Is(err, ErrLockLost) || time.Since(renewed) >= lockTTL {
+				logger.Error("exclusive tool lost its lock, cancelling it", "tool", name, "error", err)
+				cancel()
+				return
+			}
+			logger.Warn("renewing exclusive tool lock failed", "tool", name, "error", err)
+		}
+	}()
+
+	unlock := func() {
+		close(done)
+		cancel()
+		rctx, rcancel := context.WithTimeout(context.Background(), lockTimeout)
+		defer rcancel()
+		if err := lock.Release(rctx); err != nil {
+			logger.Warn("releasing exclusive tool lock failed", "tool", name, "error", err)
+		}
+	}
+	return ctx, unlock, nil
+}
+
+// exclusiveFlags collects repeated -exclusive flags.
+type exclusiveFlags []string
+
+func (f *exclusiveFlags) String() string {
+	names := append([]string(nil), *f...)
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (f *exclusiveFlags) Set(value string) error {
+	if value == "" {
+		return errors.New("want a tool name")
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// =============================================================================
+// Memory Locker
+// =============================================================================
+
+// memoryLocker is the Locker of a server without Config.Locker; its locks
+// only exclude calls on the same process.
+type memoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]*memoryLock
+}
+
+func newMemoryLocker() *memoryLocker {
+	return &memoryLocker{locks: make(map[string]*memoryLock)}
+}
+
+func (l *memoryLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if held := l.locks[key]; held != nil && time.Now().Before(held.expires) {
+		return nil, ErrLockHeld
+	}
+	lock := &memoryLock{locker: l, key: key, ttl: ttl, expires: time.Now().Add(ttl)}
+	l.locks[key] = lock
+	return lock, nil
+}
+
+// memoryLock is a lock from a memoryLocker; expires is guarded by the
+// locker's mutex.
+type memoryLock struct {
+	locker  *memoryLocker
+	key     string
+	ttl     time.Duration
+	expires time.Time
+}
+
+func (m *memoryLock) Refresh(ctx context.Context) error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+	if m.locker.locks[m.key] != m || time.Now().After(m.expires) {
+		return ErrLockLost
+	}
+	m.expires = time.Now().Add(m.ttl)
+	return nil
+}
+
+func (m *memoryLock) Release(ctx context.Context) error {
+	m.locker.mu.Lock()
+	defer m.locker.mu.Unlock()
+	if m.locker.locks[m.key] == m {
+		delete(m.locker.locks, m.key)
+	}
+	return nil
+}
+
+// =============================================================================
+// Redis Locker
+// =============================================================================
+
+// redisLocker takes a lock with SET NX PX under a random token, and renews
+// and releases it with scripts that first check the token, so a holder
+// whose lock expired cannot touch its successor's.
+type redisLocker struct {
+	conn   *redisConn
+	prefix string
+}
+
+const (
+	redisRefreshScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) else return 0 end`
+	redisReleaseScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) else return 0 end`
+)
+
+func (l *redisLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	lock := &redisLock{locker: l, key: l.prefix + key, token: newCorrelationID(), ttl: ttl}
+	reply, err := l.conn.doContext(ctx, "SET", lock.key, lock.token, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrLockHeld
+	}
+	return lock, nil
+}
+
+type redisLock struct {
+	locker *redisLocker
+	key    string
+	token  string
+	ttl    time.Duration
+}
+
+func (r *redisLock) Refresh(ctx context.Context) error {
+	reply, err := r.locker.conn.doContext(ctx, "EVAL", redisRefreshScript, "1", r.key, r.token, strconv.FormatInt(r.ttl.Milliseconds(), 10))
+	if err != nil {
+		return err
+	}
+	if n, _ := reply.(int64); n != 1 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (r *redisLock) Release(ctx context.Context) error {
+	_, err := r.locker.conn.doContext(ctx, "EVAL", redisReleaseScript, "1", r.key, r.token)
+	return err
+}
+
+// =============================================================================
+// etcd Locker
+// =============================================================================
+
+// etcdLocker takes a lock by creating its key, attached to a lease, in a
+// transaction that fails if the key exists. Renewing keeps the lease
+// alive; releasing revokes it, which deletes the key.
+type etcdLocker struct {
+	etcdClient
+	prefix string
+}
+
+func (l *etcdLocker) Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	var granted struct {
+		ID string `json:"ID"`
+	}
+	seconds := max(int(ttl.Seconds()), 1)
+	if err := l.post(ctx, "/v3/lease/grant", map[string]interface{}{"TTL": seconds}, &granted); err != nil {
+		return nil, err
+	}
+	lock := &etcdLock{locker: l, lease: granted.ID}
+
+	encodedKey := base64.StdEncoding.EncodeToString([]byte(l.prefix + key))
+	var txn struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	err := l.post(ctx, "/v3/kv/txn", map[string]interface{}{
+		"compare": []map[string]interface{}{{
+			"key":             encodedKey,
+			"target":          "CREATE",
+			"result":          "EQUAL",
+			"create_revision": "0",
+		}},
+		"success": []map[string]interface{}{{
+			"request_put": map[string]interface{}{
+				"key":   encodedKey,
+				"value": base64.StdEncoding.EncodeToString([]byte(newCorrelationID())),
+				"lease": granted.ID,
+			},
+		}},
+	}, &txn)
+	if err == nil && !txn.Succeeded {
+		err = ErrLockHeld
+	}
+	if err != nil {
+		lock.Release(context.Background())
+		return nil, err
+	}
+	return lock, nil
+}
+
+type etcdLock struct {
+	locker *etcdLocker
+	lease  string
+}
+
+func (e *etcdLock) Refresh(ctx context.Context) error {
+	err := e.locker.keepAlive(ctx, e.lease)
+	if errors.Is(err, errLeaseExpired) {
+		return ErrLockLost
+	}
+	return err
+}
+
+func (e *etcdLock) Release(ctx context.Context) error {
+	return e.locker.post(ctx, "/v3/lease/revoke", map[string]interface{}{"ID": e.lease}, nil)
+}
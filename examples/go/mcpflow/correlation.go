@@ -0,0 +1,38 @@
+package mcpflow
+
+import "context"
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying id, the correlation ID
+// that ties together every hop of one logical call: the client's request,
+// the server's logs and response, and any calls the server makes on to
+// other MCP servers. mcpflowclient sends it as _meta.correlationId.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationIDFrom returns the correlation ID ctx carries, or "".
+func CorrelationIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// Notifier sends notifications to the client a tool call came from,
+// tagged with the call's correlation ID, such as progress updates.
+type Notifier interface {
+	Notify(method string, params map[string]interface{}) error
+}
+
+type notifierKey struct{}
+
+// WithNotifier returns a copy of ctx carrying n.
+func WithNotifier(ctx context.Context, n Notifier) context.Context {
+	return context.WithValue(ctx, notifierKey{}, n)
+}
+
+// NotifierFrom returns the Notifier ctx carries, if any.
+func NotifierFrom(ctx context.Context) (Notifier, bool) {
+	n, ok := ctx.Value(notifierKey{}).(Notifier)
+	return n, ok
+}
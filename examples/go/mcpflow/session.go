@@ -0,0 +1,40 @@
+package mcpflow
+
+import "context"
+
+// ClientInfo names the client in initialize.
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Session describes the session a tool call came from, as negotiated at
+// initialize, so a tool can tailor its output to the calling client. The
+// capability maps are shared with the server and must not be modified.
+type Session interface {
+	// ClientInfo returns the clientInfo the client sent with initialize.
+	ClientInfo() ClientInfo
+	// ProtocolVersion returns the negotiated MCP revision.
+	ProtocolVersion() string
+	// ClientCapabilities returns the capabilities the client declared.
+	ClientCapabilities() map[string]interface{}
+	// ServerCapabilities returns the capabilities the server answered
+	// with, including any an initialize hook added.
+	ServerCapabilities() map[string]interface{}
+	// Values returns the session's key-value store, the same one
+	// SessionStateFrom returns.
+	Values() SessionState
+}
+
+type sessionKey struct{}
+
+// WithSession returns a copy of ctx carrying sess.
+func WithSession(ctx context.Context, sess Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, sess)
+}
+
+// SessionFromContext returns the Session ctx carries, if any.
+func SessionFromContext(ctx context.Context) (Session, bool) {
+	sess, ok := ctx.Value(sessionKey{}).(Session)
+	return sess, ok
+}
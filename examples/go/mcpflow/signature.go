@@ -0,0 +1,328 @@
+package mcpflow
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// A server with a signing key signs every response with a detached JWS
+// (RFC 7515, appendix F) using EdDSA over Ed25519. The payload is the
+// response itself, canonicalized as in RFC 8785 after the signature is
+// taken out, and the JWS goes in result._meta.signature, or in
+// error.data.signature for an error:
+//
+//	{"jsonrpc": "2.0", "id": 7, "result": {"content": [...],
+//	 "_meta": {"signature": "eyJhbGciOiJFZERTQSIsImtpZCI6Ii4uLiJ9..B5sU..."}}}
+//
+// The server advertises its key in initialize as transport.signingKey, a
+// JWK whose kid is its RFC 7638 thumbprint. Since anyone relaying the
+// session could swap that key too, auditors check responses against a key
+// they got from the operator.
+
+// SignatureAlgorithm is the JWS algorithm responses are signed with.
+const SignatureAlgorithm = "EdDSA"
+
+var (
+	// ErrNoSignature is returned by VerifyResponse for a response that
+	// carries no signature.
+	ErrNoSignature = errors.New("mcpflow: response is not signed")
+	// ErrBadSignature is returned by VerifyResponse for a response whose
+	// signature does not verify with the key, such as one changed on the
+	// way.
+	ErrBadSignature = errors.New("mcpflow: response signature does not verify")
+)
+
+// SigningKey is the public key a server signs its responses with, as a JWK
+// (RFC 8037).
+type SigningKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+}
+
+// NewSigningKey returns the JWK of an Ed25519 public key.
+func NewSigningKey(pub ed25519.PublicKey) SigningKey {
+	x := base64.RawURLEncoding.EncodeToString(pub)
+	thumbprint := sha256.Sum256([]byte(`{"crv":"Ed25519","kty":"OKP","x":"` + x + `"}`))
+	return SigningKey{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         x,
+		KeyID:     base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+		Algorithm: SignatureAlgorithm,
+	}
+}
+
+// PublicKey returns the Ed25519 public key of k.
+func (k SigningKey) PublicKey() (ed25519.PublicKey, error) {
+	if k.KeyType != "OKP" || k.Curve != "Ed25519" {
+		return nil, fmt.Errorf("mcpflow: unsupported signing key %s/%s", k.KeyType, k.Curve)
+	}
+	pub, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, errors.New("mcpflow: malformed Ed25519 signing key")
+	}
+	return ed25519.PublicKey(pub), nil
+}
+
+// jwsHeader is the protected header of a response signature.
+type jwsHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// SignResponse returns an encoded JSON-RPC response with its signature
+// added. The result must be an object, and an error's data an object or
+// absent.
+func SignResponse(response []byte, key ed25519.PrivateKey) ([]byte, error) {
+	resp, err := decodeResponse(response)
+	if err != nil {
+		return nil, err
+	}
+	holder, err := signatureHolder(resp, true)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := canonicalJSON(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := json.Marshal(jwsHeader{
+		Algorithm: SignatureAlgorithm,
+		KeyID:     NewSigningKey(key.Public().(ed25519.PublicKey)).KeyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	sig := ed25519.Sign(key, []byte(protected+"."+base64.RawURLEncoding.EncodeToString(payload)))
+	holder["signature"] = protected + ".." + base64.RawURLEncoding.EncodeToString(sig)
+	return json.Marshal(resp)
+}
+
+// VerifyResponse checks the signature of an encoded JSON-RPC response
+// against key, returning ErrNoSignature or ErrBadSignature if it is
+// missing or does not verify.
+func VerifyResponse(response []byte, key SigningKey) error {
+	pub, err := key.PublicKey()
+	if err != nil {
+		return err
+	}
+	resp, err := decodeResponse(response)
+	if err != nil {
+		return err
+	}
+	holder, err := signatureHolder(resp, false)
+	if err != nil {
+		return err
+	}
+	jws, _ := holder["signature"].(string)
+	if jws == "" {
+		return ErrNoSignature
+	}
+	delete(holder, "signature")
+
+	parts := bytes.Split([]byte(jws), []byte("."))
+	if len(parts) != 3 || len(parts[1]) != 0 {
+		return fmt.Errorf("%w: not a detached JWS", ErrBadSignature)
+	}
+	var header jwsHeader
+	raw, err := base64.RawURLEncoding.DecodeString(string(parts[0]))
+	if err != nil || json.Unmarshal(raw, &header) != nil {
+		return fmt.Errorf("%w: malformed header", ErrBadSignature)
+	}
+	if header.Algorithm != SignatureAlgorithm || header.KeyID != key.KeyID {
+		return fmt.Errorf("%w: signed by %s key %q", ErrBadSignature, header.Algorithm, header.KeyID)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(string(parts[2]))
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", ErrBadSignature)
+	}
+	payload, err := canonicalJSON(resp)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, []byte(string(parts[0])+"."+base64.RawURLEncoding.EncodeToString(payload)), sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// decodeResponse decodes a response keeping numbers as they were sent, so
+// re-encoding it changes none.
+func decodeResponse(response []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(response))
+	dec.UseNumber()
+	var resp map[string]interface{}
+	if err := dec.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("mcpflow: decode response: %w", err)
+	}
+	if resp == nil {
+		return nil, errors.New("mcpflow: response is not an object")
+	}
+	return resp, nil
+}
+
+// signatureHolder returns the object of resp the signature goes in,
+// result._meta or error.data, adding it if create is set.
+func signatureHolder(resp map[string]interface{}, create bool) (map[string]interface{}, error) {
+	var parent map[string]interface{}
+	var key string
+	if rpcErr, ok := resp["error"].(map[string]interface{}); ok {
+		parent, key = rpcErr, "data"
+	} else if result, ok := resp["result"].(map[string]interface{}); ok {
+		parent, key = result, "_meta"
+	} else {
+		return nil, errors.New("mcpflow: only responses with an object result or an error are signed")
+	}
+
+	switch holder := parent[key].(type) {
+	case map[string]interface{}:
+		return holder, nil
+	case nil:
+		if !create {
+			return nil, ErrNoSignature
+		}
+		created := map[string]interface{}{}
+		parent[key] = created
+		return created, nil
+	default:
+		return nil, fmt.Errorf("mcpflow: cannot sign a response whose %s is not an object", key)
+	}
+}
+
+// canonicalJSON encodes a decoded JSON value as RFC 8785 has it: object
+// members sorted by their UTF-16 names, no insignificant whitespace, and
+// numbers and strings written as ECMAScript would.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := writeCanonical(&b, v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func writeCanonical(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("mcpflow: canonicalize number %s: %w", v, err)
+		}
+		return writeNumber(b, f)
+	case float64:
+		return writeNumber(b, v)
+	case string:
+		writeString(b, v)
+	case []interface{}:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonical(b, item); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return lessUTF16(names[i], names[j]) })
+		b.WriteByte('{')
+		for i, name := range names {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeString(b, name)
+			b.WriteByte(':')
+			if err := writeCanonical(b, v[name]); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return fmt.Errorf("mcpflow: cannot canonicalize %T", v)
+	}
+	return nil
+}
+
+// writeNumber writes f as ECMAScript's Number.prototype.toString does,
+// which encoding/json matches for every finite value but negative zero.
+func writeNumber(b *bytes.Buffer, f float64) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("mcpflow: cannot canonicalize %v", f)
+	}
+	if f == 0 {
+		f = 0
+	}
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	b.Write(raw)
+	return nil
+}
+
+// writeString writes s quoted, escaping only what JSON requires.
+func writeString(b *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				b.WriteString(`\u00`)
+				b.WriteByte(hex[r>>4])
+				b.WriteByte(hex[r&0xf])
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// lessUTF16 orders strings by their UTF-16 code units, as RFC 8785 sorts
+// member names.
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
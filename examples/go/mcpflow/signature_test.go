@@ -0,0 +1,266 @@
+package mcpflow
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return v
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"members sorted, whitespace dropped",
+			`{ "b": 1, "a": { "d": [true, null, false], "c": "x" }, "": {} }`,
+			`{"":{},"a":{"c":"x","d":[true,null,false]},"b":1}`,
+		},
+		{
+			// RFC 8785 section 3.2.3: sorted by UTF-16 code units, so the
+			// emoji's surrogates come before U+FB33.
+			"members sorted by UTF-16",
+			`{"\u20ac":"Euro Sign","\r":"Carriage Return","\ufb33":"Hebrew Letter Dalet With Dagesh","1":"One","\ud83d\ude00":"Emoji: Grinning Face","\u0080":"Control","\u00f6":"Latin Small Letter O With Diaeresis"}`,
+			"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\",\"\U0001F600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{
+			"numbers written as ECMAScript does",
+			`[1.0, 1e2, 1E+2, -0, 0.0, 0.000001, 1e-7, 1e21, 1e20, 123456789012345678901234567890, -1.50, 5e-324]`,
+			`[1,100,100,0,0,0.000001,1e-7,1e+21,100000000000000000000,1.2345678901234568e+29,-1.5,5e-324]`,
+		},
+		{
+			"strings escape only what they must",
+			`"\u00e9\u20ac\/<>&\u001f\u007f\b\f\n\r\t\"\\"`,
+			"\"\u00e9\u20ac/<>&\\u001f\u007f\\b\\f\\n\\r\\t\\\"\\\\\"",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := canonicalJSON(decodeJSON(t, tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("canonicalJSON(%s)\n got %s\nwant %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// The number samples of RFC 8785 appendix B, by IEEE 754 bit pattern.
+func TestCanonicalNumbers(t *testing.T) {
+	tests := []struct {
+		bits uint64
+		want string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	}
+	for _, tt := range tests {
+		got, err := canonicalJSON(math.Float64frombits(tt.bits))
+		if err != nil {
+			t.Errorf("%#016x: %v", tt.bits, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%#016x = %s, want %s", tt.bits, got, tt.want)
+		}
+	}
+
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := canonicalJSON(f); err == nil {
+			t.Errorf("canonicalJSON(%v) succeeded; JSON has no such number", f)
+		}
+	}
+}
+
+func TestSignResponseRoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := NewSigningKey(pub)
+
+	responses := []struct {
+		name     string
+		response string
+	}{
+		{"result", `{"jsonrpc":"2.0","id":7,"result":{"content":[{"type":"text","text":"hi"}],"count":1.0}}`},
+		{"result with _meta", `{"jsonrpc":"2.0","id":"a","result":{"_meta":{"correlationId":"c1"},"n":-0}}`},
+		{"error", `{"jsonrpc":"2.0","id":7,"error":{"code":-32602,"message":"bad"}}`},
+		{"error with data", `{"jsonrpc":"2.0","id":7,"error":{"code":-32602,"message":"bad","data":{"field":"x"}}}`},
+	}
+	for _, tt := range responses {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := SignResponse([]byte(tt.response), priv)
+			if err != nil {
+				t.Fatalf("SignResponse: %v", err)
+			}
+			if err := VerifyResponse(signed, key); err != nil {
+				t.Fatalf("VerifyResponse: %v\n%s", err, signed)
+			}
+
+			// Relays may reorder members and reformat; the signature
+			// covers the canonical form, not the bytes.
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, reorder(t, signed), "", "  "); err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyResponse(indented.Bytes(), key); err != nil {
+				t.Errorf("VerifyResponse after re-encoding: %v\n%s", err, indented.Bytes())
+			}
+
+			other, _, _ := ed25519.GenerateKey(nil)
+			if err := VerifyResponse(signed, NewSigningKey(other)); !errors.Is(err, ErrBadSignature) {
+				t.Errorf("VerifyResponse with another key = %v, want ErrBadSignature", err)
+			}
+		})
+	}
+
+	if _, err := SignResponse([]byte(`{"jsonrpc":"2.0","id":1,"result":[1]}`), priv); err == nil {
+		t.Error("SignResponse signed a result that is not an object")
+	}
+	if err := VerifyResponse([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`), key); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("VerifyResponse of an unsigned response = %v, want ErrNoSignature", err)
+	}
+}
+
+// reorder re-encodes a response with its members in reverse sorted order,
+// the opposite of the canonical form.
+func reorder(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	var write func(v interface{})
+	write = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			names := make([]string, 0, len(v))
+			for name := range v {
+				names = append(names, name)
+			}
+			sort.Sort(sort.Reverse(sort.StringSlice(names)))
+			b.WriteByte('{')
+			for i, name := range names {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				raw, _ := json.Marshal(name)
+				b.Write(raw)
+				b.WriteByte(':')
+				write(v[name])
+			}
+			b.WriteByte('}')
+		case []interface{}:
+			b.WriteByte('[')
+			for i, item := range v {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				write(item)
+			}
+			b.WriteByte(']')
+		default:
+			raw, _ := json.Marshal(v)
+			b.Write(raw)
+		}
+	}
+	write(decodeJSON(t, string(data)))
+	return b.Bytes()
+}
+
+func TestVerifyResponseTampered(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := NewSigningKey(pub)
+	signed, err := SignResponse([]byte(`{"jsonrpc":"2.0","id":7,"result":{"content":[{"type":"text","text":"transfer 10"}]}}`), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(resp map[string]interface{})
+	}{
+		{"result text", func(resp map[string]interface{}) {
+			content := resp["result"].(map[string]interface{})["content"].([]interface{})
+			content[0].(map[string]interface{})["text"] = "transfer 1000"
+		}},
+		{"result member added", func(resp map[string]interface{}) {
+			resp["result"].(map[string]interface{})["isError"] = true
+		}},
+		{"id", func(resp map[string]interface{}) { resp["id"] = json.Number("8") }},
+		{"id as a string", func(resp map[string]interface{}) { resp["id"] = "7" }},
+		{"member added to _meta", func(resp map[string]interface{}) {
+			resp["result"].(map[string]interface{})["_meta"].(map[string]interface{})["extra"] = 1
+		}},
+		{"result swapped for an error", func(resp map[string]interface{}) {
+			meta := resp["result"].(map[string]interface{})["_meta"].(map[string]interface{})
+			delete(resp, "result")
+			resp["error"] = map[string]interface{}{"code": -32603, "message": "x", "data": meta}
+		}},
+		{"signature corrupted", func(resp map[string]interface{}) {
+			meta := resp["result"].(map[string]interface{})["_meta"].(map[string]interface{})
+			sig := []byte(meta["signature"].(string))
+			if sig[len(sig)-2] == 'A' {
+				sig[len(sig)-2] = 'B'
+			} else {
+				sig[len(sig)-2] = 'A'
+			}
+			meta["signature"] = string(sig)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := decodeJSON(t, string(signed)).(map[string]interface{})
+			tt.tamper(resp)
+			tampered, err := json.Marshal(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyResponse(tampered, key); !errors.Is(err, ErrBadSignature) {
+				t.Errorf("VerifyResponse = %v, want ErrBadSignature\n%s", err, tampered)
+			}
+		})
+	}
+}
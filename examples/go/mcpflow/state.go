@@ -0,0 +1,48 @@
+package mcpflow
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrStateFull is returned by SessionState.Set when the value would take
+// the session's state past the size the server allows it.
+var ErrStateFull = errors.New("session state limit exceeded")
+
+// SessionState is a key-value store scoped to the session a tool call came
+// from, for tools that keep something between calls, such as a pagination
+// cursor or the progress of an auth handshake. Values outlive the call;
+// whether they outlive the session, or the server, depends on the store the
+// server is configured with. A ttl of zero lets the store pick its default.
+type SessionState interface {
+	// Get returns the value stored under key, and false if there is none
+	// or it expired.
+	Get(key string) ([]byte, bool, error)
+	// Set stores value under key for ttl, or fails with ErrStateFull.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete removes key.
+	Delete(key string) error
+}
+
+// ContextTool is implemented by tools that want the context of the call,
+// which carries the Session and its SessionState, the call's logger (see
+// LoggerFrom) and correlation ID, and a Notifier back to the client. The
+// server calls ExecuteContext instead of Execute.
+type ContextTool interface {
+	Tool
+	ExecuteContext(ctx context.Context, args map[string]interface{}) (interface{}, error)
+}
+
+type sessionStateKey struct{}
+
+// WithSessionState returns a copy of ctx carrying state.
+func WithSessionState(ctx context.Context, state SessionState) context.Context {
+	return context.WithValue(ctx, sessionStateKey{}, state)
+}
+
+// SessionStateFrom returns the SessionState ctx carries, if any.
+func SessionStateFrom(ctx context.Context) (SessionState, bool) {
+	state, ok := ctx.Value(sessionStateKey{}).(SessionState)
+	return state, ok
+}
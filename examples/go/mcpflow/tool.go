@@ -0,0 +1,58 @@
+// Package mcpflow holds the types MCP-Flow tools implement, for code built
+// separately from the server, such as tool plugins.
+//
+// A plugin is a main package built with -buildmode=plugin that exports a
+// Tools function; the server's -tools-dir loads every .so it finds:
+//
+//	package main
+//
+//	import "github.com/mcp-flow/examples/go/mcpflow"
+//
+//	func Tools() []mcpflow.Tool { return []mcpflow.Tool{weatherTool{}} }
+//
+// Plugins must be built with the same Go toolchain and dependency versions
+// as the server that loads them.
+package mcpflow
+
+// Tool defines the interface for MCP tools.
+type Tool interface {
+	Name() string
+	Description() string
+	InputSchema() map[string]interface{}
+	Execute(args map[string]interface{}) (interface{}, error)
+}
+
+// ToolAnnotations are behavioral hints advertised alongside a tool.
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    bool   `json:"readOnlyHint,omitempty"`
+	DestructiveHint bool   `json:"destructiveHint,omitempty"`
+	IdempotentHint  bool   `json:"idempotentHint,omitempty"`
+	OpenWorldHint   bool   `json:"openWorldHint,omitempty"`
+}
+
+// AnnotatedTool is implemented by tools that advertise behavioral hints.
+// Tools marked ReadOnlyHint are eligible for the response cache.
+type AnnotatedTool interface {
+	Tool
+	Annotations() ToolAnnotations
+}
+
+// ExclusiveTool is implemented by tools that must not run more than once at
+// a time, such as a schema migration. While Exclusive reports true, the
+// server holds a lock for each call, shared by every instance of a cluster
+// configured with the same Locker.
+type ExclusiveTool interface {
+	Tool
+	Exclusive() bool
+}
+
+// VersionedTool is implemented by tools that declare a semantic version,
+// such as "2.1.0". Versions with different major numbers may be registered
+// side by side under one name. Deprecation returns a notice, such as "use
+// v2, which paginates", while the version is deprecated, and "" otherwise.
+type VersionedTool interface {
+	Tool
+	Version() string
+	Deprecation() string
+}
@@ -0,0 +1,158 @@
+package mcpflowclient
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/quic-go/webtransport-go"
+)
+
+// =============================================================================
+// Blob Streams
+// =============================================================================
+
+// ErrNoStreams is returned by Stream on a connection that does not carry
+// blob streams; see Options.BlobStreams.
+var ErrNoStreams = errors.New("mcpflowclient: connection has no blob streams")
+
+const (
+	// streamHeaderSize is the size of the Execution Stream header: the
+	// request ID and the stream tag, both big-endian uint32.
+	streamHeaderSize = 8
+	// maxPendingStreams bounds the streams held for Stream to take; any
+	// more are refused.
+	maxPendingStreams = 100
+)
+
+// uniStreams accepts the Execution Streams of a WebTransport session and
+// holds each, by tag, until Stream takes it.
+type uniStreams struct {
+	mu      sync.Mutex
+	pending map[uint32]webtransport.ReceiveStream
+	waiters map[uint32]chan webtransport.ReceiveStream
+	err     error
+}
+
+// acceptUniStreams starts accepting the Execution Streams of session. The
+// returned func stops it, and must be called before the session is closed:
+// an accept still pending then makes the close reset the request stream.
+func acceptUniStreams(session *webtransport.Session) (*uniStreams, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	u := &uniStreams{
+		pending: make(map[uint32]webtransport.ReceiveStream),
+		waiters: make(map[uint32]chan webtransport.ReceiveStream),
+	}
+	go func() {
+		for {
+			str, err := session.AcceptUniStream(ctx)
+			if err != nil {
+				u.fail(err)
+				return
+			}
+			go u.receive(str)
+		}
+	}()
+	return u, cancel
+}
+
+// receive reads a stream's header and files it under its tag.
+func (u *uniStreams) receive(str webtransport.ReceiveStream) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(str, header); err != nil {
+		str.CancelRead(0)
+		return
+	}
+	tag := binary.BigEndian.Uint32(header[4:])
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if ch, ok := u.waiters[tag]; ok {
+		delete(u.waiters, tag)
+		ch <- str
+		return
+	}
+	if len(u.pending) >= maxPendingStreams {
+		str.CancelRead(0)
+		return
+	}
+	u.pending[tag] = str
+}
+
+// fail ends every wait once the session is gone.
+func (u *uniStreams) fail(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.err = err
+	for tag, ch := range u.waiters {
+		delete(u.waiters, tag)
+		close(ch)
+	}
+}
+
+// take returns the stream tagged tag, waiting for it to arrive.
+func (u *uniStreams) take(ctx context.Context, tag uint32) (io.ReadCloser, error) {
+	u.mu.Lock()
+	if str, ok := u.pending[tag]; ok {
+		delete(u.pending, tag)
+		u.mu.Unlock()
+		return blobReader{str}, nil
+	}
+	if u.err != nil {
+		u.mu.Unlock()
+		return nil, u.err
+	}
+	ch := make(chan webtransport.ReceiveStream, 1)
+	u.waiters[tag] = ch
+	u.mu.Unlock()
+
+	select {
+	case str, ok := <-ch:
+		if !ok {
+			return nil, u.err
+		}
+		return blobReader{str}, nil
+	case <-ctx.Done():
+		u.mu.Lock()
+		delete(u.waiters, tag)
+		u.mu.Unlock()
+		// The stream may have arrived meanwhile.
+		select {
+		case str := <-ch:
+			str.CancelRead(0)
+		default:
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// blobReader reads a blob stream; closing it early stops the server
+// sending the rest.
+type blobReader struct {
+	webtransport.ReceiveStream
+}
+
+func (r blobReader) Close() error {
+	r.CancelRead(0)
+	return nil
+}
+
+// Stream returns the blob the server sent on the Execution Stream tagged
+// tag, which a resources/read result names in an item of type "ref/stream"
+// when Options.BlobStreams is set. It waits for the stream if it has not
+// arrived yet. Each stream is returned once; close it when done.
+func (c *Client) Stream(ctx context.Context, tag uint32) (io.ReadCloser, error) {
+	c.mu.Lock()
+	closed, t := c.closed, c.transport
+	c.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+	ft, ok := t.(*framedTransport)
+	if !ok || ft.uni == nil {
+		return nil, ErrNoStreams
+	}
+	return ft.uni.take(ctx, tag)
+}
@@ -0,0 +1,745 @@
+// Package mcpflowclient is a Go client for MCP-Flow servers.
+//
+// Connect dials the server over WebTransport, falling back through
+// WebSocket, TCP+TLS, and Streamable HTTP for whichever endpoints are
+// configured, and completes the initialize handshake on the first transport
+// that answers:
+//
+//	c, err := mcpflowclient.Connect(ctx, mcpflowclient.Options{
+//		Addr:    "localhost:4433",
+//		TCPAddr: "localhost:4434",
+//	})
+//	if err != nil { ... }
+//	defer c.Close()
+//
+//	var tools struct{ Tools []map[string]interface{} }
+//	err = c.Call(ctx, "tools/list", nil, &tools)
+//
+// ServerInfo, ServerCapabilities, and ProtocolVersion describe the server as
+// of the last initialize, so callers can branch on what it supports:
+//
+//	if c.ServerCapabilities().Flag("resources", "subscribe") { ... }
+//
+// RPC failures are returned as *mcpflowerr.Error, so callers can use
+// errors.Is against the mcpflowerr sentinels and mcpflowerr.DataOf for
+// error.data hints, including the correlation ID the server logged the
+// request under. To choose that ID, for example to carry one through a
+// chain of servers, put it in the context with mcpflow.WithCorrelationID.
+package mcpflowclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+const (
+	// MCPFlowVersion is the transport binding version sent at initialize.
+	MCPFlowVersion = "0.1"
+	// DefaultProtocolVersion is requested when InitializeParams names none.
+	DefaultProtocolVersion = "2024-11-05"
+
+	defaultAttemptTimeout = 5 * time.Second
+	defaultRaceDelay      = 250 * time.Millisecond
+)
+
+// ErrClosed is returned by calls on a closed Client.
+var ErrClosed = errors.New("mcpflowclient: client closed")
+
+// ErrFrameSequence is returned by calls on a connection that lost or
+// reordered a frame; see Options.SequenceFrames. Reconnect to recover.
+var ErrFrameSequence = errors.New("mcpflowclient: frames lost or reordered")
+
+// ErrFrameChecksum is returned by calls on a connection that received a
+// damaged frame; see Options.FrameChecksums. Reconnect to recover.
+var ErrFrameChecksum = errors.New("mcpflowclient: frame failed its checksum")
+
+// Options configure how a Client reaches its server.
+type Options struct {
+	// Addr is the WebTransport host:port.
+	Addr string
+	// WebSocketURL is the WebSocket fallback, e.g. wss://host:4435/mcp-flow-ws.
+	WebSocketURL string
+	// TCPAddr is the TCP+TLS fallback host:port.
+	TCPAddr string
+	// HTTPURL is the Streamable HTTP fallback, e.g. https://host:4435/mcp.
+	HTTPURL string
+	// Service is a domain whose DNS SRV records name the servers, e.g.
+	// "example.com" for _mcpflow._udp.example.com (WebTransport) and
+	// _mcpflow._tcp.example.com (TCP+TLS). It is resolved on every
+	// connect, and each record becomes its own attempt, in priority order
+	// and spread by weight within a priority. Addr and TCPAddr, when set,
+	// take the place of the corresponding records.
+	Service string
+	// Resolver looks up Service. Nil means net.DefaultResolver.
+	Resolver *net.Resolver
+	// Command runs a local stdio MCP server as a subprocess instead of
+	// dialing the network, e.g. {"npx", "-y", "some-mcp-server"}.
+	Command []string
+	// Stderr receives the subprocess's stderr. Nil discards it.
+	Stderr io.Writer
+
+	// Order lists transport names in fallback order; DefaultOrder if empty.
+	// Entries without a configured endpoint are skipped.
+	Order []string
+	// TLSConfig is cloned for each dial. Nil means the system defaults.
+	TLSConfig *tls.Config
+	// PostQuantum limits the TLS key exchange to hybrid X25519+ML-KEM, so
+	// traffic recorded now cannot be decrypted by a future quantum
+	// computer. Servers without it cannot be reached. It needs a build
+	// with Go 1.24 or later; Connect fails otherwise.
+	PostQuantum bool
+	// ECHConfigList, when set, is the server's Encrypted Client Hello
+	// configuration, as published in its DNS HTTPS record or by its
+	// operator. The ClientHello is then encrypted to it, hiding the server
+	// name from the network, and a server that cannot decrypt it is not
+	// connected to. It needs a build with Go 1.23 or later.
+	ECHConfigList []byte
+	// Token is sent as a bearer token: in the Authorization header on
+	// transports that carry HTTP headers, and as _meta.authorization in
+	// the initialize params for the rest.
+	Token string
+
+	// AttemptTimeout bounds each transport attempt, including initialize.
+	AttemptTimeout time.Duration
+	// Race starts attempts staggered by RaceDelay instead of waiting for
+	// each to fail, taking the first to succeed (happy eyeballs).
+	Race      bool
+	RaceDelay time.Duration
+
+	// SequenceFrames asks the server to number the frames each side sends
+	// on WebTransport, WebSocket, and TCP+TLS, so a frame lost or
+	// reordered below JSON-RPC fails calls with ErrFrameSequence rather
+	// than pairing a response with the wrong request. It is ignored by
+	// servers that do not offer it and on the other transports. Servers
+	// that keep sessions for resumption also let Reconnect resume the
+	// session, replaying the notifications and responses the connection
+	// lost.
+	SequenceFrames bool
+
+	// FrameChecksums asks the server to end each frame either side sends
+	// on WebSocket and TCP+TLS with a CRC-32C, so a frame damaged on the
+	// way, such as by a proxy that rewrites the stream, fails calls with
+	// ErrFrameChecksum rather than being read as something else. It is
+	// ignored by servers that do not offer it and on the other transports.
+	FrameChecksums bool
+
+	// BlobStreams asks the server to send the blobs of resources/read
+	// results raw on WebTransport Execution Streams rather than base64 in
+	// the JSON. Items sent that way have type "ref/stream" and a
+	// streamTag to pass to Stream. It is ignored by servers that do not
+	// offer it and on the other transports.
+	BlobStreams bool
+
+	// ContentHashes asks the server to send each large tool or resource
+	// payload once and refer to it by hash after that. The client keeps
+	// recent payloads to fill such references in, so results read the
+	// same either way; a call whose payload is no longer kept is repeated
+	// with every payload in full.
+	ContentHashes bool
+
+	// SigningKey, when set, is the key the server must have signed every
+	// response with; a call whose response is unsigned or does not verify
+	// fails with mcpflow.ErrNoSignature or mcpflow.ErrBadSignature. Take it
+	// from the server's operator rather than from its initialize result,
+	// which whoever tampers with responses could change as well.
+	SigningKey *mcpflow.SigningKey
+
+	// InitializeParams are sent with initialize. protocolVersion,
+	// capabilities, clientInfo, and transport are filled in when absent.
+	InitializeParams map[string]interface{}
+
+	// OnNotification receives notifications the server sends on its own,
+	// such as notifications/tools/list_changed. It runs on the transport's
+	// reader, so it must not block on calls to this Client; start a
+	// goroutine for follow-up requests. The Streamable HTTP transport does
+	// not deliver notifications.
+	OnNotification func(method string, params json.RawMessage)
+
+	// Logger receives connection events. Nil discards them.
+	Logger *slog.Logger
+}
+
+// notifier is implemented by transports that deliver server-initiated
+// messages.
+type notifier interface {
+	setNotify(fn func(msg []byte))
+}
+
+// exiter is implemented by transports backed by a local process.
+type exiter interface {
+	exited() <-chan struct{}
+}
+
+// Client is a connection to an MCP-Flow server. It is safe for concurrent
+// use: calls run side by side, each response matched to its request by ID.
+type Client struct {
+	opts   Options
+	logger *slog.Logger
+	nextID atomic.Int64
+	// nonces is set while the server checks tools/call for replays; see
+	// withNonce.
+	nonces atomic.Bool
+
+	mu         sync.Mutex
+	transport  Transport
+	name       string
+	initResult json.RawMessage
+	info       initInfo
+	closed     bool
+
+	// resumeToken, when set, is the token Reconnect resumes the session
+	// on resumeFrom with; see Options.SequenceFrames.
+	resumeToken string
+	resumeFrom  *framedTransport
+
+	// content keeps the payloads the server may refer to by hash; see
+	// Options.ContentHashes.
+	content *contentCache
+}
+
+// Connect dials the server and performs the initialize handshake.
+func Connect(ctx context.Context, opts Options) (*Client, error) {
+	if opts.PostQuantum && len(hybridKeyExchanges) == 0 {
+		return nil, errors.New("mcpflowclient: PostQuantum needs a build with Go 1.24 or later")
+	}
+	if len(opts.ECHConfigList) > 0 && !echSupported {
+		return nil, errors.New("mcpflowclient: ECHConfigList needs a build with Go 1.23 or later")
+	}
+	opts = opts.withDefaults()
+	c := &Client{opts: opts, logger: opts.Logger}
+	if opts.ContentHashes {
+		c.content = newContentCache(defaultContentCacheSize)
+	}
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Transport returns the name of the transport in use, e.g. "webtransport".
+func (c *Client) Transport() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// InitializeResult returns the raw result of the most recent initialize.
+func (c *Client) InitializeResult() json.RawMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.initResult
+}
+
+// Call sends a request and decodes its result into result, which may be nil.
+// A JSON-RPC error response is returned as an *mcpflowerr.Error.
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	params, err := withCorrelationID(ctx, params)
+	if err == nil && method == "tools/call" && c.nonces.Load() {
+		params, err = withNonce(params)
+	}
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	msg, err := json.Marshal(&request{
+		JSONRPC: "2.0",
+		ID:      c.nextID.Add(1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	t, err := c.current()
+	if err != nil {
+		return err
+	}
+	err = c.call(ctx, t, msg, result)
+	if errors.Is(err, errContentMissing) {
+		err = c.callFullContent(ctx, t, method, params, result)
+	}
+	return err
+}
+
+// Notify sends a notification.
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	params, err := withCorrelationID(ctx, params)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	msg, err := json.Marshal(&request{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+
+	t, err := c.current()
+	if err != nil {
+		return err
+	}
+	return t.Send(ctx, msg)
+}
+
+// Forward relays a raw JSON-RPC message unchanged and returns the raw
+// response, or nil for a notification. Errors report transport failures
+// only; JSON-RPC errors come back inside the response.
+func (c *Client) Forward(ctx context.Context, msg []byte) ([]byte, error) {
+	t, err := c.current()
+	if err != nil {
+		return nil, err
+	}
+
+	if messageID(msg) == "" {
+		return nil, t.Send(ctx, msg)
+	}
+	return t.RoundTrip(ctx, msg)
+}
+
+// current returns the transport to send on. c.mu is held only to read it,
+// not for the round trip, so a slow call does not hold up the others.
+func (c *Client) current() (Transport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClosed
+	}
+	return c.transport, nil
+}
+
+// Reconnect drops the current transport and walks the fallback chain
+// again, repeating the initialize handshake with the original parameters.
+// A session with numbered frames is resumed if the server still keeps it:
+// the messages sent after the last one this client read arrive on the new
+// transport, responses to calls that already gave up among them, so
+// OnNotification sees every notification once.
+func (c *Client) Reconnect(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	old := c.transport
+	c.mu.Unlock()
+
+	old.Close()
+	return c.connect(ctx)
+}
+
+// Exited returns a channel that is closed when the subprocess of a Command
+// connection exits. It is nil for network transports. After Reconnect, call
+// it again for the new process.
+func (c *Client) Exited() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.transport.(exiter); ok {
+		return e.exited()
+	}
+	return nil
+}
+
+// Close shuts down the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.transport.Close()
+}
+
+// =============================================================================
+// Connection Setup
+// =============================================================================
+
+type request struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int64       `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data,omitempty"`
+	} `json:"error,omitempty"`
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	attempts, err := c.opts.attempts(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	var resume *resumeParams
+	if c.resumeToken != "" {
+		resume = &resumeParams{Token: c.resumeToken, LastSeq: c.resumeFrom.received.Load()}
+	}
+	c.mu.Unlock()
+
+	initMsg, err := json.Marshal(&request{
+		JSONRPC: "2.0",
+		ID:      c.nextID.Add(1),
+		Method:  "initialize",
+		Params:  c.initializeParams(resume),
+	})
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	initializedMsg, _ := json.Marshal(&request{JSONRPC: "2.0", Method: "notifications/initialized"})
+
+	// The initialize exchange is part of each attempt, so a transport only
+	// wins once the server has actually answered on it.
+	// Raced attempts may each complete initialize; keep the winner's result.
+	initResults := make(map[Transport]json.RawMessage)
+	var resultMu sync.Mutex
+	t, name, err := connectWithFallback(ctx, attempts, fallbackOptions{
+		attemptTimeout: c.opts.AttemptTimeout,
+		race:           c.opts.Race,
+		raceDelay:      c.opts.RaceDelay,
+	}, func(ctx context.Context, t Transport) error {
+		if n, ok := t.(notifier); ok {
+			n.setNotify(func(msg []byte) { c.dispatchServerMessage(t, msg) })
+		}
+		ft, framed := t.(*framedTransport)
+		if framed && resume != nil {
+			ft.resumeFrom = resume.LastSeq
+		}
+		var result json.RawMessage
+		if err := c.call(ctx, t, initMsg, &result); err != nil {
+			return err
+		}
+		if framed {
+			tr := transportResult(result)
+			if tr.SequenceNumbers {
+				ft.startSequencing()
+			}
+			if tr.Checksum == checksumCRC32C {
+				ft.startChecksums()
+			}
+		}
+		if err := t.Send(ctx, initializedMsg); err != nil {
+			return err
+		}
+		resultMu.Lock()
+		initResults[t] = result
+		resultMu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	resultMu.Lock()
+	initResult := initResults[t]
+	resultMu.Unlock()
+
+	tr := transportResult(initResult)
+	c.mu.Lock()
+	c.transport, c.name, c.initResult = t, name, initResult
+	c.info = parseInitInfo(initResult)
+	c.resumeToken, c.resumeFrom = "", nil
+	if ft, ok := t.(*framedTransport); ok && tr.SequenceNumbers && tr.ResumeToken != "" {
+		c.resumeToken, c.resumeFrom = tr.ResumeToken, ft
+	}
+	c.mu.Unlock()
+	c.nonces.Store(tr.ReplayWindow > 0)
+
+	c.logger.Info("connected", "transport", name, "resumed", tr.Resumed)
+	return nil
+}
+
+// dispatchServerMessage answers the server's pings on t and hands other
+// server-initiated notifications to OnNotification.
+// Server requests are dropped, since this client serves no methods.
+func (c *Client) dispatchServerMessage(t Transport, msg []byte) {
+	var n struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	err := json.Unmarshal(msg, &n)
+	switch {
+	case err == nil && n.ID != nil && n.Method == "ping":
+		// The server measures its round trip to this client.
+		pong, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": n.ID, "result": map[string]interface{}{}})
+		if err := t.Send(context.Background(), pong); err != nil {
+			c.logger.Debug("ping reply failed", "error", err)
+		}
+	case err != nil || n.ID != nil || c.opts.OnNotification == nil:
+		c.logger.Debug("dropped server message", "method", n.Method)
+	default:
+		c.opts.OnNotification(n.Method, n.Params)
+	}
+}
+
+// withCorrelationID returns params with the correlation ID ctx carries, if
+// any, added as _meta.correlationId. Params that are not an object are
+// sent as they are.
+func withCorrelationID(ctx context.Context, params interface{}) (interface{}, error) {
+	id := mcpflow.CorrelationIDFrom(ctx)
+	if id == "" {
+		return params, nil
+	}
+	return withMeta(params, "correlationId", id)
+}
+
+// withNonce returns params with a fresh _meta.nonce and the time it was
+// issued, so a server accepting 0-RTT data can tell a tools/call sent
+// again by someone who captured it from a new one.
+func withNonce(params interface{}) (interface{}, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	params, err := withMeta(params, "nonce", hex.EncodeToString(nonce))
+	if err != nil {
+		return nil, err
+	}
+	return withMeta(params, "issuedAt", time.Now().UnixMilli())
+}
+
+// withMeta returns params with key set to value in their _meta object.
+// Params that are not an object are returned as they are.
+func withMeta(params interface{}, key string, value interface{}) (interface{}, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]json.RawMessage)
+	if string(raw) != "null" && json.Unmarshal(raw, &fields) != nil {
+		return params, nil
+	}
+	meta := make(map[string]interface{})
+	if old, ok := fields["_meta"]; ok {
+		json.Unmarshal(old, &meta)
+	}
+	meta[key] = value
+	if fields["_meta"], err = json.Marshal(meta); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// call round-trips msg on t and decodes the response.
+func (c *Client) call(ctx context.Context, t Transport, msg []byte, result interface{}) error {
+	raw, err := t.RoundTrip(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if c.opts.SigningKey != nil {
+		if err := mcpflow.VerifyResponse(raw, *c.opts.SigningKey); err != nil {
+			return err
+		}
+	}
+
+	var resp response
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	if resp.Error != nil {
+		return mcpflowerr.FromWire(resp.Error.Code, resp.Error.Message, resp.Error.Data)
+	}
+	if c.content != nil {
+		if resp.Result, err = c.content.resolve(resp.Result); err != nil {
+			return err
+		}
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+func (o Options) withDefaults() Options {
+	if o.AttemptTimeout <= 0 {
+		o.AttemptTimeout = defaultAttemptTimeout
+	}
+	if o.RaceDelay <= 0 {
+		o.RaceDelay = defaultRaceDelay
+	}
+	if o.TLSConfig == nil {
+		o.TLSConfig = &tls.Config{}
+	}
+	if o.PostQuantum {
+		o.TLSConfig = o.TLSConfig.Clone()
+		o.TLSConfig.CurvePreferences = hybridKeyExchanges
+	}
+	if len(o.ECHConfigList) > 0 {
+		o.TLSConfig = o.TLSConfig.Clone()
+		setECHConfigList(o.TLSConfig, o.ECHConfigList)
+	}
+	if len(o.Order) == 0 {
+		o.Order = DefaultOrder
+	}
+	if o.Logger == nil {
+		o.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return o
+}
+
+// attempts builds the fallback chain from the configured endpoints,
+// resolving Service first when set.
+func (o Options) attempts(ctx context.Context) ([]transportAttempt, error) {
+	endpoints := map[string][]string{
+		TransportWebTransport: nonEmpty(o.Addr),
+		TransportWebSocket:    nonEmpty(o.WebSocketURL),
+		TransportTCP:          nonEmpty(o.TCPAddr),
+		TransportHTTP:         nonEmpty(o.HTTPURL),
+		TransportStdio:        nonEmpty(strings.Join(o.Command, " ")),
+	}
+	if o.Service != "" && (o.Addr == "" || o.TCPAddr == "") {
+		discovered, err := o.discover(ctx)
+		switch {
+		case err == nil:
+			for name, eps := range discovered {
+				if len(endpoints[name]) == 0 {
+					endpoints[name] = eps
+				}
+			}
+		case o.Addr == "" && o.WebSocketURL == "" && o.TCPAddr == "" && o.HTTPURL == "" && len(o.Command) == 0:
+			return nil, err
+		default:
+			// Carry on with the endpoints configured explicitly.
+			o.Logger.Warn("discovery failed", "error", err)
+		}
+	}
+
+	header := http.Header{}
+	if o.Token != "" {
+		header.Set("Authorization", "Bearer "+o.Token)
+	}
+
+	var attempts []transportAttempt
+	for _, entry := range o.Order {
+		name := entry
+		dial, ok := dialers[name]
+		if name == TransportStdio {
+			dial, ok = o.dialStdio, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown transport %q", name)
+		}
+		for _, ep := range endpoints[name] {
+			endpoint := ep
+			attempts = append(attempts, transportAttempt{
+				name: name,
+				dial: func(ctx context.Context) (Transport, error) {
+					o.Logger.Info("connecting", "transport", name, "endpoint", endpoint)
+					return dial(ctx, endpoint, o.TLSConfig, header)
+				},
+			})
+		}
+	}
+	return attempts, nil
+}
+
+func nonEmpty(endpoint string) []string {
+	if endpoint == "" {
+		return nil
+	}
+	return []string{endpoint}
+}
+
+func (o Options) dialStdio(ctx context.Context, _ string, _ *tls.Config, _ http.Header) (Transport, error) {
+	return dialStdio(ctx, o.Command, o.Stderr)
+}
+
+// initializeParams fills the handshake fields the caller left out, asking
+// to resume a session when resume is set.
+func (c *Client) initializeParams(resume *resumeParams) map[string]interface{} {
+	params := make(map[string]interface{}, len(c.opts.InitializeParams)+4)
+	for k, v := range c.opts.InitializeParams {
+		params[k] = v
+	}
+	if _, ok := params["protocolVersion"]; !ok {
+		params["protocolVersion"] = DefaultProtocolVersion
+	}
+	if _, ok := params["capabilities"]; !ok {
+		params["capabilities"] = map[string]interface{}{}
+	}
+	if _, ok := params["clientInfo"]; !ok {
+		params["clientInfo"] = map[string]interface{}{
+			"name":    "mcpflowclient",
+			"version": "1.0.0",
+		}
+	}
+	if c.opts.Token != "" {
+		meta, _ := params["_meta"].(map[string]interface{})
+		withAuth := make(map[string]interface{}, len(meta)+1)
+		for k, v := range meta {
+			withAuth[k] = v
+		}
+		withAuth["authorization"] = "Bearer " + c.opts.Token
+		params["_meta"] = withAuth
+	}
+	if _, ok := params["transport"]; !ok {
+		transport := map[string]interface{}{
+			"type":      "mcp-flow",
+			"version":   MCPFlowVersion,
+			"encodings": []string{"json"},
+		}
+		if c.opts.SequenceFrames {
+			transport["sequenceNumbers"] = true
+			if resume != nil {
+				transport["resume"] = resume
+			}
+		}
+		if c.opts.FrameChecksums {
+			transport["checksums"] = []string{checksumCRC32C}
+		}
+		if c.opts.BlobStreams {
+			transport["blobStreams"] = true
+		}
+		if c.opts.ContentHashes {
+			transport["contentHashes"] = true
+		}
+		params["transport"] = transport
+	}
+	return params
+}
+
+// resumeParams ask initialize to resume the session with Token, the last
+// frame of which this client read was LastSeq.
+type resumeParams struct {
+	Token   string `json:"token"`
+	LastSeq uint64 `json:"lastSeq"`
+}
+
+// initTransport is the transport member of an initialize result.
+type initTransport struct {
+	SequenceNumbers bool   `json:"sequenceNumbers"`
+	ResumeToken     string `json:"resumeToken"`
+	Resumed         bool   `json:"resumed"`
+	Checksum        string `json:"checksum"`
+	ReplayWindow    int64  `json:"replayWindow"`
+}
+
+// transportResult returns the transport member of an initialize result,
+// zero if it has none.
+func transportResult(result json.RawMessage) initTransport {
+	var r struct {
+		Transport initTransport `json:"transport"`
+	}
+	json.Unmarshal(result, &r)
+	return r.Transport
+}
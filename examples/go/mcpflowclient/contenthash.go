@@ -0,0 +1,149 @@
+package mcpflowclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// =============================================================================
+// Content Hashes
+// =============================================================================
+
+// defaultContentCacheSize bounds the payloads kept for Options.ContentHashes.
+const defaultContentCacheSize = 64 << 20 // 64MB
+
+// errContentMissing is returned by resolve for a payload sent by hash that
+// is no longer kept; Call repeats the request with every payload in full.
+var errContentMissing = errors.New("mcpflowclient: content hash not in cache")
+
+// payloadFields are the members of a content item that may hold a payload
+// the server refers to by hash.
+var payloadFields = []string{"text", "blob", "data"}
+
+// contentCache keeps the payloads of the content items the server hashed,
+// evicting the oldest past size bytes.
+type contentCache struct {
+	mu      sync.Mutex
+	size    int
+	used    int
+	entries map[string]cachedPayload
+	order   []string
+}
+
+// cachedPayload is the member of a content item that held a payload.
+type cachedPayload struct {
+	field string
+	value json.RawMessage
+}
+
+func newContentCache(size int) *contentCache {
+	return &contentCache{size: size, entries: make(map[string]cachedPayload)}
+}
+
+func (c *contentCache) put(hash string, p cachedPayload) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[hash]; ok || len(p.value) > c.size {
+		return
+	}
+	c.entries[hash] = p
+	c.order = append(c.order, hash)
+	c.used += len(p.value)
+	for c.used > c.size {
+		c.used -= len(c.entries[c.order[0]].value)
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+func (c *contentCache) get(hash string) (cachedPayload, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.entries[hash]
+	return p, ok
+}
+
+// resolve keeps the hashed payloads of a result's content or contents
+// items and fills in the items that carry only a hash.
+func (c *contentCache) resolve(result json.RawMessage) (json.RawMessage, error) {
+	if !bytes.Contains(result, []byte(`"hash"`)) {
+		return result, nil
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(result, &fields) != nil {
+		return result, nil
+	}
+
+	changed := false
+	for _, key := range []string{"content", "contents"} {
+		var items []map[string]json.RawMessage
+		if fields[key] == nil || json.Unmarshal(fields[key], &items) != nil {
+			continue
+		}
+		filled := false
+		for _, item := range items {
+			var hash string
+			if json.Unmarshal(item["hash"], &hash) != nil || hash == "" {
+				continue
+			}
+			if p, ok := payloadOf(item); ok {
+				c.put(hash, p)
+				continue
+			}
+			p, ok := c.get(hash)
+			if !ok {
+				return nil, errContentMissing
+			}
+			item[p.field] = p.value
+			filled = true
+		}
+		if filled {
+			raw, err := json.Marshal(items)
+			if err != nil {
+				return nil, fmt.Errorf("decode: %w", err)
+			}
+			fields[key], changed = raw, true
+		}
+	}
+	if !changed {
+		return result, nil
+	}
+	return json.Marshal(fields)
+}
+
+func payloadOf(item map[string]json.RawMessage) (cachedPayload, bool) {
+	for _, field := range payloadFields {
+		if value, ok := item[field]; ok {
+			return cachedPayload{field: field, value: value}, true
+		}
+	}
+	return cachedPayload{}, false
+}
+
+// callFullContent repeats a call whose result referred to a payload this
+// client no longer keeps, asking for every payload in full, on the same
+// transport t.
+func (c *Client) callFullContent(ctx context.Context, t Transport, method string, params, result interface{}) error {
+	c.logger.Debug("content hash not cached, repeating call in full", "method", method)
+	params, err := withMeta(params, "fullContent", true)
+	if err == nil && method == "tools/call" && c.nonces.Load() {
+		params, err = withNonce(params)
+	}
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	msg, err := json.Marshal(&request{
+		JSONRPC: "2.0",
+		ID:      c.nextID.Add(1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
+	}
+	return c.call(ctx, t, msg, result)
+}
@@ -0,0 +1,95 @@
+package mcpflowclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// DNS SRV Discovery
+// =============================================================================
+
+// SRVService is the service label MCP-Flow servers are published under:
+// _mcpflow._udp.<domain> for WebTransport and _mcpflow._tcp.<domain> for
+// TCP+TLS.
+const SRVService = "mcpflow"
+
+// srvProtocols maps the transports that can be discovered to the SRV
+// protocol label their endpoints are published under.
+var srvProtocols = []struct {
+	transport string
+	proto     string
+}{
+	{TransportWebTransport, "udp"},
+	{TransportTCP, "tcp"},
+}
+
+// discover resolves o.Service into host:port endpoints per transport. The
+// resolver returns each record set sorted by priority and shuffled by weight
+// within a priority (RFC 2782), so trying the endpoints in order fails over
+// from preferred servers to backups while spreading load among peers.
+//
+// A missing record set is not an error, since a domain may publish only one
+// transport; discovery fails only if it finds no endpoints at all.
+func (o Options) discover(ctx context.Context) (map[string][]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.AttemptTimeout)
+	defer cancel()
+
+	resolver := o.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	// Only look up transports that are in the chain and not configured
+	// explicitly.
+	wanted := make(map[string]bool)
+	for _, name := range o.Order {
+		wanted[name] = true
+	}
+	wanted[TransportWebTransport] = wanted[TransportWebTransport] && o.Addr == ""
+	wanted[TransportTCP] = wanted[TransportTCP] && o.TCPAddr == ""
+
+	endpoints := make(map[string][]string)
+	var errs []error
+	for _, p := range srvProtocols {
+		if !wanted[p.transport] {
+			continue
+		}
+		_, records, err := resolver.LookupSRV(ctx, SRVService, p.proto, o.Service)
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				o.Logger.Debug("no srv records", "transport", p.transport, "service", o.Service)
+				continue
+			}
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, r := range records {
+			// A lone "." target means the service is decidedly not
+			// available at this domain.
+			host := strings.TrimSuffix(r.Target, ".")
+			if host == "" {
+				continue
+			}
+			endpoints[p.transport] = append(endpoints[p.transport], net.JoinHostPort(host, strconv.Itoa(int(r.Port))))
+		}
+		o.Logger.Info("discovered endpoints", "transport", p.transport, "service", o.Service, "endpoints", endpoints[p.transport])
+	}
+
+	if len(endpoints) == 0 {
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("discover %s: %w", o.Service, errors.Join(errs...))
+		}
+		return nil, fmt.Errorf("discover %s: no _%s SRV records", o.Service, SRVService)
+	}
+	for _, err := range errs {
+		o.Logger.Warn("srv lookup failed", "service", o.Service, "error", err)
+	}
+	return endpoints, nil
+}
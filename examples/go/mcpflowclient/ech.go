@@ -0,0 +1,14 @@
+//go:build go1.23
+
+package mcpflowclient
+
+import "crypto/tls"
+
+// echSupported reports whether Options.ECHConfigList can be honored.
+const echSupported = true
+
+// setECHConfigList has cfg encrypt its ClientHello to one of the configs
+// of list.
+func setECHConfigList(cfg *tls.Config, list []byte) {
+	cfg.EncryptedClientHelloConfigList = list
+}
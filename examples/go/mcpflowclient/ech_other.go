@@ -0,0 +1,11 @@
+//go:build !go1.23
+
+package mcpflowclient
+
+import "crypto/tls"
+
+// echSupported is false before Go 1.23, whose crypto/tls is the first
+// with Encrypted Client Hello.
+const echSupported = false
+
+func setECHConfigList(cfg *tls.Config, list []byte) {}
@@ -0,0 +1,116 @@
+package mcpflowclient
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// =============================================================================
+// Inbox (incoming message demultiplexing)
+// =============================================================================
+
+// inbox reads a stream transport's incoming messages on a background
+// goroutine, handing each response to the round trip waiting for its id and
+// everything else the server sends on its own (notifications, and requests
+// this client does not serve) to the notify hook.
+type inbox struct {
+	mu      sync.Mutex
+	waiting map[string]chan []byte
+	notify  func(msg []byte)
+	err     error
+	done    chan struct{}
+}
+
+// newInbox starts reading with read until it fails, which happens when the
+// transport is closed.
+func newInbox(read func() ([]byte, error)) *inbox {
+	b := &inbox{
+		waiting: make(map[string]chan []byte),
+		done:    make(chan struct{}),
+	}
+	go b.run(read)
+	return b
+}
+
+func (b *inbox) run(read func() ([]byte, error)) {
+	for {
+		msg, err := read()
+		if err != nil {
+			b.mu.Lock()
+			b.err = err
+			b.mu.Unlock()
+			close(b.done)
+			return
+		}
+
+		var envelope struct {
+			Method string `json:"method"`
+		}
+		json.Unmarshal(msg, &envelope)
+
+		b.mu.Lock()
+		var ch chan []byte
+		if envelope.Method == "" {
+			id := messageID(msg)
+			if ch = b.waiting[id]; ch != nil {
+				delete(b.waiting, id)
+			}
+		}
+		notify := b.notify
+		b.mu.Unlock()
+
+		switch {
+		case ch != nil:
+			ch <- msg
+		case envelope.Method != "" && notify != nil:
+			notify(msg)
+		}
+	}
+}
+
+// setNotify installs the hook for server-initiated messages. It runs on the
+// reader goroutine, so it must not wait on a round trip.
+func (b *inbox) setNotify(fn func(msg []byte)) {
+	b.mu.Lock()
+	b.notify = fn
+	b.mu.Unlock()
+}
+
+// expect registers for the response to id. Call it before writing the
+// request so a fast response is not missed.
+func (b *inbox) expect(id string) chan []byte {
+	ch := make(chan []byte, 1)
+	b.mu.Lock()
+	b.waiting[id] = ch
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *inbox) forget(id string) {
+	b.mu.Lock()
+	delete(b.waiting, id)
+	b.mu.Unlock()
+}
+
+// wait returns the response delivered on ch, or fails when ctx ends or the
+// stream does. A response arriving after ctx ends is dropped.
+func (b *inbox) wait(ctx context.Context, id string, ch chan []byte) ([]byte, error) {
+	select {
+	case msg := <-ch:
+		return msg, nil
+	case <-ctx.Done():
+		b.forget(id)
+		return nil, ctx.Err()
+	case <-b.done:
+		b.forget(id)
+		select {
+		case msg := <-ch:
+			return msg, nil
+		default:
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return nil, b.err
+	}
+}
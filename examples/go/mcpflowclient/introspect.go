@@ -0,0 +1,73 @@
+package mcpflowclient
+
+import "encoding/json"
+
+// ServerInfo names the server, as its initialize result does.
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Capabilities are the capabilities a server declared at initialize, by
+// name, e.g. "tools" or "resources".
+type Capabilities map[string]json.RawMessage
+
+// Has reports whether the server declared capability name.
+func (c Capabilities) Has(name string) bool {
+	_, ok := c[name]
+	return ok
+}
+
+// Flag reports whether capability name has the boolean option set, as in
+// Flag("resources", "subscribe").
+func (c Capabilities) Flag(name, option string) bool {
+	var options map[string]interface{}
+	json.Unmarshal(c[name], &options)
+	set, _ := options[option].(bool)
+	return set
+}
+
+// Experimental reports whether the server declared the experimental
+// capability name.
+func (c Capabilities) Experimental(name string) bool {
+	var experimental map[string]json.RawMessage
+	json.Unmarshal(c["experimental"], &experimental)
+	_, ok := experimental[name]
+	return ok
+}
+
+// initInfo is what the client keeps of an initialize result.
+type initInfo struct {
+	ProtocolVersion string       `json:"protocolVersion"`
+	ServerInfo      ServerInfo   `json:"serverInfo"`
+	Capabilities    Capabilities `json:"capabilities"`
+}
+
+func parseInitInfo(result json.RawMessage) initInfo {
+	var info initInfo
+	json.Unmarshal(result, &info)
+	return info
+}
+
+// ServerInfo returns the serverInfo of the most recent initialize.
+func (c *Client) ServerInfo() ServerInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.info.ServerInfo
+}
+
+// ServerCapabilities returns the capabilities the server declared at the
+// most recent initialize, which a reconnect may change.
+func (c *Client) ServerCapabilities() Capabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.info.Capabilities
+}
+
+// ProtocolVersion returns the MCP revision the server chose at the most
+// recent initialize.
+func (c *Client) ProtocolVersion() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.info.ProtocolVersion
+}
@@ -0,0 +1,185 @@
+package mcpflowclient
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// =============================================================================
+// mDNS Discovery (local network)
+// =============================================================================
+
+// MDNSService is the DNS-SD service type MCP-Flow servers advertise over
+// multicast DNS.
+const MDNSService = "_mcpflow._udp.local."
+
+// DefaultDiscoverTimeout is how long Discover listens when ctx has no
+// deadline.
+const DefaultDiscoverTimeout = 2 * time.Second
+
+// MDNSGroup is the IPv4 multicast address and port mDNS runs on.
+var MDNSGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsRequery is how often Discover repeats its query, in case the first
+// was lost.
+const mdnsRequery = time.Second
+
+// LocalServer is an MCP-Flow server found on the local network.
+type LocalServer struct {
+	// Instance is the advertised instance name, usually the host name.
+	Instance string
+	// Addr is the WebTransport host:port.
+	Addr string
+	// TCPAddr is the TCP+TLS host:port, if the server advertises one.
+	TCPAddr string
+	// Text holds the advertised TXT key/value pairs, such as "version".
+	Text map[string]string
+}
+
+// Options returns Options that connect to s.
+func (s LocalServer) Options() Options {
+	return Options{Addr: s.Addr, TCPAddr: s.TCPAddr}
+}
+
+// Discover finds MCP-Flow servers advertising themselves over mDNS on the
+// local network. It queries for MDNSService and collects answers until ctx
+// ends, or for DefaultDiscoverTimeout if ctx has no deadline, then returns
+// the servers sorted by instance name. An empty result is not an error.
+func Discover(ctx context.Context) ([]LocalServer, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultDiscoverTimeout)
+		defer cancel()
+	}
+
+	service := dnsmessage.MustNewName(MDNSService)
+	query, err := (&dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: service, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	// Querying from an ephemeral port asks responders to answer directly
+	// (legacy unicast), so there is no need to join the group.
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	go func() {
+		ticker := time.NewTicker(mdnsRequery)
+		defer ticker.Stop()
+		for {
+			if _, err := conn.WriteTo(query, MDNSGroup); err != nil {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	var found mdnsRecords
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+		var msg dnsmessage.Message
+		if msg.Unpack(buf[:n]) != nil || !msg.Response {
+			continue
+		}
+		found.add(msg.Answers)
+		found.add(msg.Additionals)
+	}
+	return found.servers(service.String()), nil
+}
+
+// mdnsRecords accumulates the records of every response.
+type mdnsRecords struct {
+	ptr map[string]map[string]mdnsInstance
+	srv map[string]dnsmessage.SRVResource
+	txt map[string][]string
+	a   map[string]net.IP
+}
+
+type mdnsInstance struct {
+	name string
+	live bool
+}
+
+func (m *mdnsRecords) add(rrs []dnsmessage.Resource) {
+	if m.ptr == nil {
+		m.ptr = make(map[string]map[string]mdnsInstance)
+		m.srv = make(map[string]dnsmessage.SRVResource)
+		m.txt = make(map[string][]string)
+		m.a = make(map[string]net.IP)
+	}
+	for _, rr := range rrs {
+		name := strings.ToLower(rr.Header.Name.String())
+		switch body := rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if m.ptr[name] == nil {
+				m.ptr[name] = make(map[string]mdnsInstance)
+			}
+			// A zero TTL is a goodbye from a server shutting down.
+			m.ptr[name][strings.ToLower(body.PTR.String())] = mdnsInstance{
+				name: body.PTR.String(),
+				live: rr.Header.TTL > 0,
+			}
+		case *dnsmessage.SRVResource:
+			m.srv[name] = *body
+		case *dnsmessage.TXTResource:
+			m.txt[name] = body.TXT
+		case *dnsmessage.AResource:
+			m.a[name] = net.IP(body.A[:])
+		}
+	}
+}
+
+func (m *mdnsRecords) servers(service string) []LocalServer {
+	var servers []LocalServer
+	for key, instance := range m.ptr[strings.ToLower(service)] {
+		srv, ok := m.srv[key]
+		if !instance.live || !ok {
+			continue
+		}
+
+		host := strings.TrimSuffix(srv.Target.String(), ".")
+		if ip := m.a[strings.ToLower(srv.Target.String())]; ip != nil {
+			host = ip.String()
+		}
+		label, _, _ := strings.Cut(instance.name, ".")
+		s := LocalServer{
+			Instance: label,
+			Addr:     net.JoinHostPort(host, strconv.Itoa(int(srv.Port))),
+			Text:     make(map[string]string),
+		}
+		for _, kv := range m.txt[key] {
+			k, v, _ := strings.Cut(kv, "=")
+			s.Text[k] = v
+		}
+		if port := s.Text["tcp"]; port != "" {
+			s.TCPAddr = net.JoinHostPort(host, port)
+		}
+		servers = append(servers, s)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Instance < servers[j].Instance })
+	return servers
+}
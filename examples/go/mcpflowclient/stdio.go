@@ -0,0 +1,174 @@
+package mcpflowclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// stdioStopGrace is how long a subprocess gets to exit after its stdin is
+// closed before it is killed.
+const stdioStopGrace = 2 * time.Second
+
+// =============================================================================
+// stdio Transport (subprocess)
+// =============================================================================
+
+// stdioTransport runs a classic stdio MCP server as a subprocess and speaks
+// newline-delimited JSON over its stdin and stdout. The context deadline,
+// if any, bounds each round trip.
+type stdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stdout *os.File
+	r      *bufio.Reader
+	inbox  *inbox
+	done   chan struct{}
+
+	// mu makes writers take turns, so lines do not interleave and each
+	// keeps its own deadline.
+	mu sync.Mutex
+}
+
+// dialStdio starts command. The process outlives ctx; Close stops it.
+func dialStdio(_ context.Context, command []string, stderr io.Writer) (Transport, error) {
+	if len(command) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, err
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = inR
+	cmd.Stdout = outW
+	cmd.Stderr = stderr
+
+	err = cmd.Start()
+	// The child holds its own copies of these ends.
+	inR.Close()
+	outW.Close()
+	if err != nil {
+		inW.Close()
+		outR.Close()
+		return nil, err
+	}
+
+	t := &stdioTransport{
+		cmd:    cmd,
+		stdin:  inW,
+		stdout: outR,
+		r:      bufio.NewReaderSize(outR, 64*1024),
+		done:   make(chan struct{}),
+	}
+	t.inbox = newInbox(t.readLine)
+	go func() {
+		cmd.Wait()
+		close(t.done)
+	}()
+	return t, nil
+}
+
+func (t *stdioTransport) setNotify(fn func(msg []byte)) { t.inbox.setNotify(fn) }
+
+func (t *stdioTransport) exited() <-chan struct{} { return t.done }
+
+func (t *stdioTransport) RoundTrip(ctx context.Context, msg []byte) ([]byte, error) {
+	id := messageID(msg)
+	ch := t.inbox.expect(id)
+
+	if err := t.write(ctx, msg); err != nil {
+		t.inbox.forget(id)
+		return nil, err
+	}
+
+	// Log notifications the subprocess emits while working go to the
+	// notify hook, not here.
+	resp, err := t.inbox.wait(ctx, id, ch)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	return resp, nil
+}
+
+func (t *stdioTransport) Send(ctx context.Context, msg []byte) error {
+	return t.write(ctx, msg)
+}
+
+// Close closes the subprocess's stdin, which asks a well-behaved stdio
+// server to exit, and kills it if it has not done so within the grace
+// period.
+func (t *stdioTransport) Close() error {
+	t.stdin.Close()
+	select {
+	case <-t.done:
+	case <-time.After(stdioStopGrace):
+		t.cmd.Process.Kill()
+		<-t.done
+	}
+	return t.stdout.Close()
+}
+
+func (t *stdioTransport) write(ctx context.Context, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.bound(ctx)()
+
+	line := make([]byte, 0, len(msg)+1)
+	line = append(append(line, msg...), '\n')
+	if _, err := t.stdin.Write(line); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+// readLine returns the next non-empty line, enforcing maxFrameSize.
+func (t *stdioTransport) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := t.r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxFrameSize {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxFrameSize)
+		}
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			return trimmed, nil
+		}
+		line = line[:0]
+	}
+}
+
+// bound applies ctx's deadline to writes on stdin and interrupts a blocked
+// write if ctx is cancelled. The returned func clears both.
+func (t *stdioTransport) bound(ctx context.Context) func() {
+	deadline, _ := ctx.Deadline()
+	t.stdin.SetWriteDeadline(deadline)
+
+	stop := context.AfterFunc(ctx, func() { t.stdin.SetWriteDeadline(time.Now()) })
+	return func() {
+		stop()
+		t.stdin.SetWriteDeadline(time.Time{})
+	}
+}
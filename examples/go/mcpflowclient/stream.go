@@ -0,0 +1,64 @@
+package mcpflowclient
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// =============================================================================
+// Raw Streams
+// =============================================================================
+
+// framedTransports are the transports that carry a plain stream of
+// length-prefixed frames.
+var framedTransports = map[string]bool{
+	TransportWebTransport: true,
+	TransportWebSocket:    true,
+	TransportTCP:          true,
+}
+
+// DialStream opens a raw MCP-Flow byte stream without performing
+// initialize, for callers such as proxies that relay length-prefixed frames
+// themselves. It walks opts.Order like Connect but only over WebTransport,
+// WebSocket, and TCP+TLS, and returns the stream with the name of the
+// transport that answered.
+func DialStream(ctx context.Context, opts Options) (io.ReadWriteCloser, string, error) {
+	opts = opts.withDefaults()
+
+	var order []string
+	for _, name := range opts.Order {
+		if framedTransports[name] {
+			order = append(order, name)
+		}
+	}
+	opts.Order = order
+
+	attempts, err := opts.attempts(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	t, name, err := connectWithFallback(ctx, attempts, fallbackOptions{
+		attemptTimeout: opts.AttemptTimeout,
+		race:           opts.Race,
+		raceDelay:      opts.RaceDelay,
+	}, func(context.Context, Transport) error { return nil })
+	if err != nil {
+		return nil, "", err
+	}
+
+	ft, ok := t.(*framedTransport)
+	if !ok {
+		t.Close()
+		return nil, "", errors.New("transport is not framed")
+	}
+	return &rawStream{ReadWriter: ft.conn, close: ft.closer}, name, nil
+}
+
+type rawStream struct {
+	io.ReadWriter
+	close func() error
+}
+
+func (s *rawStream) Close() error { return s.close() }
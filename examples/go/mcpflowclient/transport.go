@@ -0,0 +1,592 @@
+package mcpflowclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+	"golang.org/x/net/websocket"
+)
+
+// Transport names accepted in Options.Order.
+const (
+	TransportWebTransport = "webtransport"
+	TransportWebSocket    = "websocket"
+	TransportTCP          = "tcp"
+	TransportHTTP         = "http"
+	TransportStdio        = "stdio"
+)
+
+// DefaultOrder is the fallback order used when Options.Order is empty.
+var DefaultOrder = []string{TransportWebTransport, TransportWebSocket, TransportTCP, TransportHTTP, TransportStdio}
+
+// maxFrameSize mirrors the server's frame limit.
+const maxFrameSize = 16 * 1024 * 1024
+
+// frameSequenced flags a numbered frame in its length prefix, and
+// frameSeqSize is the size of the number that follows; see
+// Options.SequenceFrames.
+const (
+	frameSequenced = 1 << 31
+	frameSeqSize   = 8
+)
+
+// frameChecksummed flags a frame that ends with the CRC-32C of the rest of
+// it, and frameChecksumSize is the size of that; see
+// Options.FrameChecksums.
+const (
+	frameChecksummed  = 1 << 30
+	frameChecksumSize = 4
+	checksumCRC32C    = "crc32c"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Transport exchanges raw JSON-RPC messages with an MCP-Flow server. It is
+// safe for concurrent use, with several round trips in flight at once.
+type Transport interface {
+	// RoundTrip sends a request and waits for its response.
+	RoundTrip(ctx context.Context, msg []byte) ([]byte, error)
+	// Send sends a notification, which has no response.
+	Send(ctx context.Context, msg []byte) error
+	Close() error
+}
+
+// dialFunc opens a transport to endpoint.
+type dialFunc func(ctx context.Context, endpoint string, tlsConfig *tls.Config, header http.Header) (Transport, error)
+
+var dialers = map[string]dialFunc{
+	TransportWebTransport: dialWebTransport,
+	TransportWebSocket:    dialWebSocket,
+	TransportTCP:          dialTCP,
+	TransportHTTP:         dialHTTP,
+}
+
+// =============================================================================
+// Framed Transport (WebTransport, WebSocket, TCP+TLS)
+// =============================================================================
+
+// deadlineConn is a byte stream whose blocking writes can be bounded.
+type deadlineConn interface {
+	io.ReadWriter
+	SetWriteDeadline(t time.Time) error
+}
+
+// framedTransport speaks length-prefixed frames over a byte stream. The
+// context deadline, if any, bounds each round trip. Frames are read by an
+// inbox started on the first round trip, so the raw stream can still be
+// handed out untouched (see DialStream).
+//
+// Once startSequencing is called, each frame written carries the next
+// number in a header extension: the top bit of the length prefix is set
+// and an 8-byte big-endian sequence number follows it. Numbered frames
+// from the server are checked the same way on read. Once startChecksums
+// is, each frame also sets the next bit and ends with a CRC-32C of the
+// rest of it; frames from the server with one are checked on read.
+type framedTransport struct {
+	conn   deadlineConn
+	closer func() error
+	// uni holds the Execution Streams of a WebTransport connection.
+	uni *uniStreams
+
+	mu          sync.Mutex
+	sequenced   bool
+	checksummed bool
+	sent        uint64
+
+	// resumeFrom is the last frame number seen on the connection whose
+	// session this one resumes, so numbering may carry on from it; it is
+	// set before the first round trip. received is the last number read.
+	resumeFrom uint64
+	received   atomic.Uint64
+
+	once  sync.Once
+	inbox *inbox
+}
+
+func (t *framedTransport) messages() *inbox {
+	t.once.Do(func() {
+		var last uint64
+		var checksummed bool
+		t.inbox = newInbox(func() ([]byte, error) {
+			body, seq, summed, err := readFrame(t.conn)
+			if err != nil {
+				return nil, err
+			}
+			if checksummed && !summed {
+				return nil, fmt.Errorf("%w: frame without a checksum after frames with one", ErrFrameChecksum)
+			}
+			checksummed = checksummed || summed
+			switch {
+			case seq == 0 && last == 0:
+			case seq == last+1, last == 0 && seq == t.resumeFrom+1:
+				last = seq
+				t.received.Store(seq)
+			default:
+				return nil, fmt.Errorf("%w: expected frame %d, got %d", ErrFrameSequence, last+1, seq)
+			}
+			return body, nil
+		})
+	})
+	return t.inbox
+}
+
+// startSequencing numbers every frame written from now on, starting at 1.
+func (t *framedTransport) startSequencing() {
+	t.mu.Lock()
+	t.sequenced = true
+	t.mu.Unlock()
+}
+
+// startChecksums ends every frame written from now on with a checksum.
+func (t *framedTransport) startChecksums() {
+	t.mu.Lock()
+	t.checksummed = true
+	t.mu.Unlock()
+}
+
+func (t *framedTransport) setNotify(fn func(msg []byte)) { t.messages().setNotify(fn) }
+
+func (t *framedTransport) RoundTrip(ctx context.Context, msg []byte) ([]byte, error) {
+	in := t.messages()
+	id := messageID(msg)
+	ch := in.expect(id)
+
+	if err := t.write(ctx, msg); err != nil {
+		in.forget(id)
+		return nil, err
+	}
+
+	resp, err := in.wait(ctx, id, ch)
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	return resp, nil
+}
+
+func (t *framedTransport) Send(ctx context.Context, msg []byte) error {
+	return t.write(ctx, msg)
+}
+
+func (t *framedTransport) Close() error { return t.closer() }
+
+// write writes msg as one frame, bounded by ctx. Writers take turns, so
+// frames do not interleave and each keeps its own deadline.
+func (t *framedTransport) write(ctx context.Context, msg []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.bound(ctx)()
+
+	header, flags := 4, uint32(0)
+	if t.sequenced {
+		header, flags = header+frameSeqSize, flags|frameSequenced
+	}
+	if t.checksummed {
+		flags |= frameChecksummed
+	}
+	frame := make([]byte, header, header+len(msg)+frameChecksumSize)
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(msg))|flags)
+	if t.sequenced {
+		t.sent++
+		binary.BigEndian.PutUint64(frame[4:], t.sent)
+	}
+	frame = append(frame, msg...)
+	if t.checksummed {
+		frame = binary.BigEndian.AppendUint32(frame, crc32.Checksum(frame, castagnoli))
+	}
+	if _, err := t.conn.Write(frame); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+// bound applies ctx's deadline to writes on the connection and interrupts
+// a blocked write if ctx is cancelled. The returned func clears both.
+func (t *framedTransport) bound(ctx context.Context) func() {
+	deadline, _ := ctx.Deadline()
+	t.conn.SetWriteDeadline(deadline)
+
+	stop := context.AfterFunc(ctx, func() { t.conn.SetWriteDeadline(time.Now()) })
+	return func() {
+		stop()
+		t.conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// readFrame reads a frame and its sequence number, 0 if the frame is not
+// numbered, and reports whether it had a checksum, which it checks.
+func readFrame(r io.Reader) ([]byte, uint64, bool, error) {
+	lengthBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, lengthBuf); err != nil {
+		return nil, 0, false, err
+	}
+	length := binary.BigEndian.Uint32(lengthBuf)
+	checksummed := length&frameChecksummed != 0
+	length &^= frameChecksummed
+	var seqBuf []byte
+	var seq uint64
+	if length&frameSequenced != 0 {
+		length &^= frameSequenced
+		seqBuf = make([]byte, frameSeqSize)
+		if _, err := io.ReadFull(r, seqBuf); err != nil {
+			return nil, 0, false, err
+		}
+		seq = binary.BigEndian.Uint64(seqBuf)
+	}
+	if length > maxFrameSize {
+		return nil, 0, false, fmt.Errorf("frame too large: %d bytes", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, false, err
+	}
+	if checksummed {
+		sumBuf := make([]byte, frameChecksumSize)
+		if _, err := io.ReadFull(r, sumBuf); err != nil {
+			return nil, 0, false, err
+		}
+		sum := crc32.Update(crc32.Update(crc32.Checksum(lengthBuf, castagnoli), castagnoli, seqBuf), castagnoli, body)
+		if got := binary.BigEndian.Uint32(sumBuf); got != sum {
+			return nil, 0, false, fmt.Errorf("%w: computed %08x, frame carries %08x", ErrFrameChecksum, sum, got)
+		}
+	}
+	return body, seq, checksummed, nil
+}
+
+func dialWebTransport(ctx context.Context, addr string, tlsConfig *tls.Config, header http.Header) (Transport, error) {
+	cfg := tlsConfig.Clone()
+	cfg.NextProtos = []string{"h3"}
+
+	dialer := webtransport.Dialer{
+		RoundTripper: &http3.RoundTripper{TLSClientConfig: cfg},
+	}
+
+	_, session, err := dialer.Dial(ctx, fmt.Sprintf("https://%s/mcp-flow", addr), header)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := session.OpenStreamSync(ctx)
+	if err != nil {
+		session.CloseWithError(0, "open stream failed")
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+
+	uni, stopAccept := acceptUniStreams(session)
+	return &framedTransport{
+		conn: stream,
+		closer: func() error {
+			stopAccept()
+			stream.Close()
+			return session.CloseWithError(0, "done")
+		},
+		uni: uni,
+	}, nil
+}
+
+func dialWebSocket(ctx context.Context, rawURL string, tlsConfig *tls.Config, header http.Header) (Transport, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := "https://" + u.Host
+	cfg, err := websocket.NewConfig(rawURL, origin)
+	if err != nil {
+		return nil, err
+	}
+	cfg.TlsConfig = tlsConfig
+	for k, v := range header {
+		cfg.Header[k] = v
+	}
+	cfg.Dialer = &net.Dialer{}
+	if deadline, ok := ctx.Deadline(); ok {
+		cfg.Dialer.Deadline = deadline
+	}
+
+	ws, err := websocket.DialConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ws.PayloadType = websocket.BinaryFrame
+
+	return &framedTransport{conn: ws, closer: ws.Close}, nil
+}
+
+// dialTCP connects over TCP+TLS. Raw TCP has no request headers, so header
+// is not sent.
+func dialTCP(ctx context.Context, addr string, tlsConfig *tls.Config, _ http.Header) (Transport, error) {
+	cfg := tlsConfig.Clone()
+	cfg.NextProtos = []string{"mcp-flow"}
+	cfg.MinVersion = tls.VersionTLS13
+
+	dialer := &tls.Dialer{Config: cfg}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &framedTransport{conn: conn.(*tls.Conn), closer: conn.Close}, nil
+}
+
+// =============================================================================
+// Streamable HTTP Transport
+// =============================================================================
+
+// httpTransport speaks the MCP Streamable HTTP transport: one POST per
+// message, with the session ID from initialize echoed on later requests.
+type httpTransport struct {
+	url    string
+	client *http.Client
+	header http.Header
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+func dialHTTP(_ context.Context, rawURL string, tlsConfig *tls.Config, header http.Header) (Transport, error) {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &httpTransport{
+		url:    rawURL,
+		client: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, ForceAttemptHTTP2: true}},
+		header: header,
+	}, nil
+}
+
+func (t *httpTransport) RoundTrip(ctx context.Context, msg []byte) ([]byte, error) {
+	httpResp, err := t.post(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http status %s", httpResp.Status)
+	}
+
+	if strings.HasPrefix(httpResp.Header.Get("Content-Type"), "text/event-stream") {
+		return readSSEResponse(httpResp.Body, messageID(msg))
+	}
+
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxFrameSize))
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	return bytes.TrimSpace(body), nil
+}
+
+func (t *httpTransport) Send(ctx context.Context, msg []byte) error {
+	httpResp, err := t.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusAccepted && httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http status %s", httpResp.Status)
+	}
+	return nil
+}
+
+func (t *httpTransport) Close() error {
+	sessionID := t.session()
+	if sessionID == "" {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = t.header.Clone()
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) post(ctx context.Context, msg []byte) (*http.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header = t.header.Clone()
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	if sessionID := t.session(); sessionID != "" {
+		httpReq.Header.Set("Mcp-Session-Id", sessionID)
+	}
+
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if id := httpResp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	return httpResp, nil
+}
+
+func (t *httpTransport) session() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID
+}
+
+// readSSEResponse scans an SSE body for the message answering id.
+func readSSEResponse(r io.Reader, id string) ([]byte, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxFrameSize)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if messageID([]byte(data)) == id {
+			return []byte(data), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// messageID returns the compacted JSON of a message's id, or "" when the
+// message has none.
+func messageID(msg []byte) string {
+	var envelope struct {
+		ID json.RawMessage `json:"id"`
+	}
+	if json.Unmarshal(msg, &envelope) != nil || len(envelope.ID) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	if json.Compact(&buf, envelope.ID) != nil {
+		return string(envelope.ID)
+	}
+	return buf.String()
+}
+
+// =============================================================================
+// Fallback Chain
+// =============================================================================
+
+// transportAttempt is one entry in the fallback chain.
+type transportAttempt struct {
+	name string
+	dial func(ctx context.Context) (Transport, error)
+}
+
+// fallbackOptions tune how the chain is walked.
+type fallbackOptions struct {
+	// attemptTimeout bounds each attempt, including the handshake.
+	attemptTimeout time.Duration
+	// race starts attempts staggered by raceDelay instead of waiting for
+	// each to fail, taking the first to succeed (happy eyeballs).
+	race      bool
+	raceDelay time.Duration
+}
+
+// connectWithFallback dials the attempts in order and runs handshake on each
+// new transport, returning the first that completes along with its name.
+func connectWithFallback(ctx context.Context, attempts []transportAttempt, opts fallbackOptions, handshake func(context.Context, Transport) error) (Transport, string, error) {
+	if len(attempts) == 0 {
+		return nil, "", errors.New("no transports configured")
+	}
+	if opts.race {
+		return raceTransports(ctx, attempts, opts, handshake)
+	}
+
+	var errs []error
+	for _, a := range attempts {
+		t, err := tryTransport(ctx, a, opts.attemptTimeout, handshake)
+		if err == nil {
+			return t, a.name, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", a.name, err))
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+func raceTransports(ctx context.Context, attempts []transportAttempt, opts fallbackOptions, handshake func(context.Context, Transport) error) (Transport, string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		name string
+		t    Transport
+		err  error
+	}
+	results := make(chan result, len(attempts))
+
+	for i, a := range attempts {
+		go func(i int, a transportAttempt) {
+			select {
+			case <-time.After(time.Duration(i) * opts.raceDelay):
+			case <-ctx.Done():
+				results <- result{name: a.name, err: ctx.Err()}
+				return
+			}
+			t, err := tryTransport(ctx, a, opts.attemptTimeout, handshake)
+			results <- result{name: a.name, t: t, err: err}
+		}(i, a)
+	}
+
+	var winner *result
+	var errs []error
+	for range attempts {
+		r := <-results
+		switch {
+		case r.err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", r.name, r.err))
+		case winner == nil:
+			winner = &r
+			cancel()
+		default:
+			r.t.Close()
+		}
+	}
+
+	if winner == nil {
+		return nil, "", errors.Join(errs...)
+	}
+	return winner.t, winner.name, nil
+}
+
+func tryTransport(ctx context.Context, a transportAttempt, timeout time.Duration, handshake func(context.Context, Transport) error) (Transport, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	t, err := a.dial(attemptCtx)
+	if err != nil {
+		return nil, err
+	}
+	if err := handshake(attemptCtx, t); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
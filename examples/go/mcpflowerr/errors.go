@@ -0,0 +1,283 @@
+// Package mcpflowerr defines the typed errors MCP-Flow tools and middleware
+// return to signal protocol-level failures.
+//
+// Errors created here carry a JSON-RPC error code. When a tool returns one
+// (directly or wrapped), the server replies with a JSON-RPC error using that
+// code instead of flattening the message into tool result text.
+//
+//	if _, ok := args["path"].(string); !ok {
+//		return nil, mcpflowerr.InvalidParams("path must be a string")
+//	}
+//
+// Machine-readable details travel as JSON-RPC error.data:
+//
+//	return nil, mcpflowerr.RateLimited("search quota exhausted").
+//		WithRetryAfter(2 * time.Second)
+//
+// Callers test for a category with errors.Is against the sentinels:
+//
+//	if errors.Is(err, mcpflowerr.ErrNotFound) { ... }
+package mcpflowerr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JSON-RPC error codes used by the taxonomy. InvalidParams and Internal are
+// the standard JSON-RPC codes; Cancelled matches the MCP-Flow cancellation
+// example; the rest are implementation-defined server errors.
+const (
+	CodeInvalidParams  = -32602
+	CodeInternal       = -32603
+	CodeCancelled      = -32000
+	CodeNotFound       = -32010
+	CodeUnauthorized   = -32011
+	CodeRateLimited    = -32012
+	CodeTimeout        = -32013
+	CodeQuotaExceeded  = -32014
+	CodeOverloaded     = -32015
+	CodeCorrupted      = -32016
+	CodeReplayed       = -32017
+	CodeNotInitialized = -32018
+	CodeBusy           = -32019
+)
+
+// Error is an error with an associated JSON-RPC code.
+type Error struct {
+	Code    int
+	Message string
+	Data    *Data
+	Err     error
+}
+
+// Data is the machine-readable payload carried in JSON-RPC error.data.
+type Data struct {
+	// RetryAfter is the number of seconds the caller should wait before
+	// retrying.
+	RetryAfter float64 `json:"retryAfter,omitempty"`
+
+	// Offenders lists the individual validation failures.
+	Offenders []Offender `json:"offenders,omitempty"`
+
+	// DocsURL links to documentation for the error.
+	DocsURL string `json:"docsUrl,omitempty"`
+
+	// Details holds any additional application-specific fields.
+	Details map[string]interface{} `json:"details,omitempty"`
+
+	// CorrelationID is the correlation ID of the failed request, set by
+	// the server; see mcpflow.WithCorrelationID.
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
+// Offender identifies one invalid input, by JSON pointer into the params.
+type Offender struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// RetryAfterDuration returns RetryAfter as a time.Duration.
+func (d *Data) RetryAfterDuration() time.Duration {
+	if d == nil {
+		return 0
+	}
+	return time.Duration(d.RetryAfter * float64(time.Second))
+}
+
+// Error returns the message, followed by the wrapped cause if any.
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the wrapped cause.
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether target is an *Error with the same code, so any error in
+// a category matches that category's sentinel.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithRetryAfter sets the retry hint and returns e for chaining.
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	e.data().RetryAfter = d.Seconds()
+	return e
+}
+
+// WithOffender appends a validation failure and returns e for chaining.
+func (e *Error) WithOffender(path, message string) *Error {
+	e.data().Offenders = append(e.data().Offenders, Offender{Path: path, Message: message})
+	return e
+}
+
+// WithDocsURL sets the documentation link and returns e for chaining.
+func (e *Error) WithDocsURL(url string) *Error {
+	e.data().DocsURL = url
+	return e
+}
+
+// WithDetail sets an application-specific field and returns e for chaining.
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	d := e.data()
+	if d.Details == nil {
+		d.Details = make(map[string]interface{})
+	}
+	d.Details[key] = value
+	return e
+}
+
+func (e *Error) data() *Data {
+	if e.Data == nil {
+		e.Data = &Data{}
+	}
+	return e.Data
+}
+
+// Sentinels for errors.Is comparisons.
+var (
+	ErrNotFound       = &Error{Code: CodeNotFound, Message: "not found"}
+	ErrInvalidParams  = &Error{Code: CodeInvalidParams, Message: "invalid params"}
+	ErrUnauthorized   = &Error{Code: CodeUnauthorized, Message: "unauthorized"}
+	ErrRateLimited    = &Error{Code: CodeRateLimited, Message: "rate limited"}
+	ErrTimeout        = &Error{Code: CodeTimeout, Message: "timeout"}
+	ErrQuotaExceeded  = &Error{Code: CodeQuotaExceeded, Message: "quota exceeded"}
+	ErrOverloaded     = &Error{Code: CodeOverloaded, Message: "overloaded"}
+	ErrCorrupted      = &Error{Code: CodeCorrupted, Message: "protocol corrupted"}
+	ErrReplayed       = &Error{Code: CodeReplayed, Message: "replayed"}
+	ErrNotInitialized = &Error{Code: CodeNotInitialized, Message: "not initialized"}
+	ErrBusy           = &Error{Code: CodeBusy, Message: "busy"}
+	ErrCancelled      = &Error{Code: CodeCancelled, Message: "Cancelled"}
+	ErrInternal       = &Error{Code: CodeInternal, Message: "internal error"}
+)
+
+// New returns an error with the given code and formatted message.
+func New(code int, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap annotates cause with a code and message. It returns nil if cause is nil.
+func Wrap(code int, cause error, message string) error {
+	if cause == nil {
+		return nil
+	}
+	return &Error{Code: code, Message: message, Err: cause}
+}
+
+// NotFound reports that a named entity (tool, resource, prompt) does not exist.
+func NotFound(format string, args ...interface{}) *Error {
+	return New(CodeNotFound, format, args...)
+}
+
+// InvalidParams reports malformed or out-of-range arguments.
+func InvalidParams(format string, args ...interface{}) *Error {
+	return New(CodeInvalidParams, format, args...)
+}
+
+// Unauthorized reports that the caller may not perform the operation.
+func Unauthorized(format string, args ...interface{}) *Error {
+	return New(CodeUnauthorized, format, args...)
+}
+
+// RateLimited reports that the caller exceeded a rate limit.
+func RateLimited(format string, args ...interface{}) *Error {
+	return New(CodeRateLimited, format, args...)
+}
+
+// Timeout reports that the operation exceeded its deadline.
+func Timeout(format string, args ...interface{}) *Error {
+	return New(CodeTimeout, format, args...)
+}
+
+// QuotaExceeded reports that the caller has used up an allowance that
+// resets later, unlike a rate limit that clears within moments.
+func QuotaExceeded(format string, args ...interface{}) *Error {
+	return New(CodeQuotaExceeded, format, args...)
+}
+
+// Overloaded reports that the server is shedding load and the caller should
+// retry later, on this server or another.
+func Overloaded(format string, args ...interface{}) *Error {
+	return New(CodeOverloaded, format, args...)
+}
+
+// ProtocolCorrupted reports that messages were lost or reordered below
+// JSON-RPC, so the connection can no longer be trusted to pair responses
+// with requests.
+func ProtocolCorrupted(format string, args ...interface{}) *Error {
+	return New(CodeCorrupted, format, args...)
+}
+
+// Replayed reports a request that may be a copy of one already handled,
+// such as 0-RTT data sent again by someone who captured it. The caller
+// should resend it with a fresh nonce.
+func Replayed(format string, args ...interface{}) *Error {
+	return New(CodeReplayed, format, args...)
+}
+
+// NotInitialized reports a request sent before the session's initialize
+// succeeded.
+func NotInitialized(format string, args ...interface{}) *Error {
+	return New(CodeNotInitialized, format, args...)
+}
+
+// Busy reports that the operation cannot run while another one holds what
+// it needs, such as an exclusive tool already running on some instance.
+// The caller should retry once that finishes.
+func Busy(format string, args ...interface{}) *Error {
+	return New(CodeBusy, format, args...)
+}
+
+// Cancelled reports that the operation was cancelled by the caller.
+func Cancelled(format string, args ...interface{}) *Error {
+	return New(CodeCancelled, format, args...)
+}
+
+// CodeOf returns the JSON-RPC code carried by err. Context cancellation and
+// deadline errors map to Cancelled and Timeout. The boolean is false for
+// errors outside the taxonomy.
+func CodeOf(err error) (int, bool) {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e.Code, true
+	case errors.Is(err, context.Canceled):
+		return CodeCancelled, true
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout, true
+	}
+	return 0, false
+}
+
+// DataOf returns the error.data payload carried by err, or nil.
+func DataOf(err error) *Data {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Data
+	}
+	return nil
+}
+
+// FromWire rebuilds a typed error from a decoded JSON-RPC error object so
+// clients can use errors.Is and DataOf on server failures. A data payload
+// that does not match Data is preserved under Details["raw"].
+func FromWire(code int, message string, data json.RawMessage) *Error {
+	e := &Error{Code: code, Message: message}
+	if len(data) == 0 || string(data) == "null" {
+		return e
+	}
+
+	var d Data
+	if err := json.Unmarshal(data, &d); err != nil {
+		return e.WithDetail("raw", data)
+	}
+	e.Data = &d
+	return e
+}
@@ -0,0 +1,124 @@
+package mcpflowerr
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Application-defined codes must fall in this slice of the JSON-RPC
+// implementation-defined server error range. The rest of the range is used
+// by the MCP-Flow specification and this package's taxonomy.
+const (
+	MinApplicationCode = -32099
+	MaxApplicationCode = -32050
+)
+
+// CodeInfo describes a JSON-RPC error code. Name is a snake_case identifier
+// suitable for metric labels and log fields.
+type CodeInfo struct {
+	Code        int    `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[int]CodeInfo{}
+
+	validName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+)
+
+func init() {
+	for _, info := range []CodeInfo{
+		{-32700, "parse_error", "Malformed JSON or CBOR"},
+		{-32600, "invalid_request", "Missing required fields or unknown transport type"},
+		{-32601, "method_not_found", "Unknown method"},
+		{CodeInvalidParams, "invalid_params", "Bad parameter types or values"},
+		{CodeInternal, "internal_error", "Server-side failure"},
+		{CodeCancelled, "cancelled", "Request was cancelled"},
+		{-32001, "invalid_stream_reference", "streamTag does not match any open stream"},
+		{-32002, "stream_injection", "Stream header request ID does not match an in-flight request"},
+		{-32003, "encoding_mismatch", "Message not in negotiated encoding"},
+		{-32004, "datagram_not_supported", "Server indicated datagramsSupported: false"},
+		{CodeNotFound, "not_found", "Named tool, resource, or prompt does not exist"},
+		{CodeUnauthorized, "unauthorized", "Caller may not perform the operation"},
+		{CodeRateLimited, "rate_limited", "Caller exceeded a rate limit"},
+		{CodeTimeout, "timeout", "Operation exceeded its deadline"},
+		{CodeQuotaExceeded, "quota_exceeded", "Caller used up its quota for the current window"},
+		{CodeOverloaded, "overloaded", "Server is shedding load; retry later"},
+		{CodeCorrupted, "protocol_corrupted", "Frames were lost or reordered; reconnect"},
+		{CodeReplayed, "replayed", "Request repeats a nonce or falls outside the replay window; resend with a fresh one"},
+		{CodeNotInitialized, "not_initialized", "Request sent before initialize succeeded"},
+		{CodeBusy, "busy", "An exclusive operation is already running; retry once it finishes"},
+	} {
+		registry[info.Code] = info
+	}
+}
+
+// Register adds an application-defined error code. The code must lie within
+// [MinApplicationCode, MaxApplicationCode] and neither the code nor the name
+// may already be registered.
+func Register(code int, name, description string) error {
+	if code < MinApplicationCode || code > MaxApplicationCode {
+		return fmt.Errorf("error code %d outside application range [%d, %d]", code, MinApplicationCode, MaxApplicationCode)
+	}
+	if !validName.MatchString(name) {
+		return fmt.Errorf("error code name %q must be snake_case", name)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if existing, ok := registry[code]; ok {
+		return fmt.Errorf("error code %d already registered as %q", code, existing.Name)
+	}
+	for _, info := range registry {
+		if info.Name == name {
+			return fmt.Errorf("error code name %q already registered for %d", name, info.Code)
+		}
+	}
+
+	registry[code] = CodeInfo{Code: code, Name: name, Description: description}
+	return nil
+}
+
+// MustRegister is like Register but panics on error. It is intended for
+// package-level variable initialization.
+func MustRegister(code int, name, description string) int {
+	if err := Register(code, name, description); err != nil {
+		panic(err)
+	}
+	return code
+}
+
+// Lookup returns the registration for code.
+func Lookup(code int) (CodeInfo, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	info, ok := registry[code]
+	return info, ok
+}
+
+// NameOf returns the registered name for code, or "unknown".
+func NameOf(code int) string {
+	if info, ok := Lookup(code); ok {
+		return info.Name
+	}
+	return "unknown"
+}
+
+// Codes returns every registered code, ordered by code.
+func Codes() []CodeInfo {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	infos := make([]CodeInfo, 0, len(registry))
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Code < infos[j].Code })
+	return infos
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+)
+
+// =============================================================================
+// mDNS Advertisement (local network)
+// =============================================================================
+
+const (
+	// mdnsTTL is the lifetime of advertised records.
+	mdnsTTL = 120
+	// mdnsLegacyTTL caps TTLs in answers to one-shot queriers (RFC 6762 §6.7).
+	mdnsLegacyTTL = 10
+	// mdnsCacheFlush marks records this responder owns outright.
+	mdnsCacheFlush = 1 << 15
+	// mdnsUnicastResponse is the QU bit a querier sets to ask for a direct
+	// answer.
+	mdnsUnicastResponse = 1 << 15
+)
+
+// mdnsAdvertiser answers mDNS queries for this server's DNS-SD records, so
+// clients on the LAN find it with mcpflowclient.Discover:
+//
+//	_mcpflow._udp.local.           PTR  <instance>._mcpflow._udp.local.
+//	<instance>._mcpflow._udp.local. SRV  <host>.local. :<WebTransport port>
+//	<instance>._mcpflow._udp.local. TXT  version=… [tcp=<TCP+TLS port>]
+//	<host>.local.                   A    <interface addresses>
+type mdnsAdvertiser struct {
+	conn   *net.UDPConn
+	logger *slog.Logger
+
+	service  dnsmessage.Name
+	instance dnsmessage.Name
+	host     dnsmessage.Name
+	port     uint16
+	txt      []string
+	ips      [][4]byte
+}
+
+// advertiseMDNS announces the server listening on addr (and tcpAddr, if
+// set) until ctx ends, then withdraws the announcement. The instance name
+// is the machine's host name.
+func advertiseMDNS(ctx context.Context, addr, tcpAddr string, logger *slog.Logger) error {
+	port, ok := listenPort(addr)
+	if !ok || port <= 0 || port > 65535 {
+		return fmt.Errorf("mdns needs a fixed port, got %q", addr)
+	}
+	txt := []string{"version=" + mcpflowclient.MCPFlowVersion}
+	if tcpPort, ok := listenPort(tcpAddr); ok {
+		txt = append(txt, "tcp="+strconv.Itoa(tcpPort))
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	label, _, _ := strings.Cut(hostname, ".")
+
+	a := &mdnsAdvertiser{
+		logger: logger,
+		port:   uint16(port),
+		txt:    txt,
+		ips:    localIPv4s(),
+	}
+	if a.service, err = dnsmessage.NewName(mcpflowclient.MDNSService); err != nil {
+		return err
+	}
+	if a.instance, err = dnsmessage.NewName(label + "." + mcpflowclient.MDNSService); err != nil {
+		return fmt.Errorf("mdns instance name: %w", err)
+	}
+	if a.host, err = dnsmessage.NewName(label + ".local."); err != nil {
+		return fmt.Errorf("mdns host name: %w", err)
+	}
+
+	if a.conn, err = net.ListenMulticastUDP("udp4", nil, mcpflowclient.MDNSGroup); err != nil {
+		return fmt.Errorf("mdns: %w", err)
+	}
+
+	go a.serve()
+	go func() {
+		// Announce twice, a second apart, as RFC 6762 §8.3 asks.
+		a.announce(mdnsTTL)
+		select {
+		case <-time.After(time.Second):
+			a.announce(mdnsTTL)
+		case <-ctx.Done():
+		}
+		<-ctx.Done()
+		a.announce(0)
+		a.conn.Close()
+	}()
+
+	logger.Info("advertising over mdns", "instance", a.instance.String(), "port", port)
+	return nil
+}
+
+func (a *mdnsAdvertiser) serve() {
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := a.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var query dnsmessage.Message
+		if query.Unpack(buf[:n]) != nil || query.Response {
+			continue
+		}
+		a.answer(&query, src)
+	}
+}
+
+// answer replies to the questions about our records, directly to queriers
+// that ask for it or use a one-shot port and to the group otherwise.
+func (a *mdnsAdvertiser) answer(query *dnsmessage.Message, src *net.UDPAddr) {
+	legacy := src.Port != mcpflowclient.MDNSGroup.Port
+
+	var answers []dnsmessage.Resource
+	unicast := legacy
+	for _, q := range query.Questions {
+		matched := a.records(q.Name, q.Type, mdnsTTL)
+		if len(matched) > 0 && q.Class&mdnsUnicastResponse != 0 {
+			unicast = true
+		}
+		answers = append(answers, matched...)
+	}
+	if len(answers) == 0 {
+		return
+	}
+
+	resp := &dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: a.additionals(answers),
+	}
+	if legacy {
+		// One-shot queriers expect a conventional DNS reply.
+		resp.Header.ID = query.Header.ID
+		resp.Questions = query.Questions
+		for _, rrs := range [][]dnsmessage.Resource{resp.Answers, resp.Additionals} {
+			for i := range rrs {
+				rrs[i].Header.Class &^= mdnsCacheFlush
+				rrs[i].Header.TTL = min(rrs[i].Header.TTL, mdnsLegacyTTL)
+			}
+		}
+	}
+
+	dst := mcpflowclient.MDNSGroup
+	if unicast {
+		dst = src
+	}
+	a.send(resp, dst)
+}
+
+// announce multicasts every record unprompted; a zero ttl says goodbye.
+func (a *mdnsAdvertiser) announce(ttl uint32) {
+	answers := a.records(a.service, dnsmessage.TypePTR, ttl)
+	resp := &dnsmessage.Message{
+		Header:      dnsmessage.Header{Response: true, Authoritative: true},
+		Answers:     answers,
+		Additionals: a.additionals(answers),
+	}
+	for i := range resp.Additionals {
+		resp.Additionals[i].Header.TTL = ttl
+	}
+	a.send(resp, mcpflowclient.MDNSGroup)
+}
+
+func (a *mdnsAdvertiser) send(msg *dnsmessage.Message, dst *net.UDPAddr) {
+	packed, err := msg.Pack()
+	if err != nil {
+		a.logger.Warn("mdns pack failed", "error", err)
+		return
+	}
+	if _, err := a.conn.WriteToUDP(packed, dst); err != nil {
+		a.logger.Debug("mdns send failed", "to", dst, "error", err)
+	}
+}
+
+// records returns our records answering a question for name and typ.
+func (a *mdnsAdvertiser) records(name dnsmessage.Name, typ dnsmessage.Type, ttl uint32) []dnsmessage.Resource {
+	all := typ == dnsmessage.TypeALL
+	var rrs []dnsmessage.Resource
+	switch {
+	case sameName(name, a.service) && (all || typ == dnsmessage.TypePTR):
+		// Shared record: other servers answer for the same name.
+		rrs = append(rrs, a.rr(a.service, ttl, false, &dnsmessage.PTRResource{PTR: a.instance}))
+	case sameName(name, a.instance):
+		if all || typ == dnsmessage.TypeSRV {
+			rrs = append(rrs, a.rr(a.instance, ttl, true, &dnsmessage.SRVResource{Target: a.host, Port: a.port}))
+		}
+		if all || typ == dnsmessage.TypeTXT {
+			rrs = append(rrs, a.rr(a.instance, ttl, true, &dnsmessage.TXTResource{TXT: a.txt}))
+		}
+	case sameName(name, a.host) && (all || typ == dnsmessage.TypeA):
+		for _, ip := range a.ips {
+			rrs = append(rrs, a.rr(a.host, ttl, true, &dnsmessage.AResource{A: ip}))
+		}
+	}
+	return rrs
+}
+
+// additionals returns the records a querier will want next after answers,
+// so one round trip is enough to connect.
+func (a *mdnsAdvertiser) additionals(answers []dnsmessage.Resource) []dnsmessage.Resource {
+	var extra []dnsmessage.Resource
+	for _, rr := range answers {
+		switch rr.Body.(type) {
+		case *dnsmessage.PTRResource:
+			extra = append(extra, a.records(a.instance, dnsmessage.TypeALL, mdnsTTL)...)
+			extra = append(extra, a.records(a.host, dnsmessage.TypeA, mdnsTTL)...)
+		case *dnsmessage.SRVResource:
+			extra = append(extra, a.records(a.host, dnsmessage.TypeA, mdnsTTL)...)
+		}
+	}
+	return extra
+}
+
+func (a *mdnsAdvertiser) rr(name dnsmessage.Name, ttl uint32, unique bool, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	class := dnsmessage.ClassINET
+	if unique {
+		class |= mdnsCacheFlush
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: name, Class: class, TTL: ttl},
+		Body:   body,
+	}
+}
+
+func sameName(a, b dnsmessage.Name) bool {
+	return strings.EqualFold(a.String(), b.String())
+}
+
+// localIPv4s returns the machine's IPv4 addresses, preferring non-loopback
+// ones.
+func localIPv4s() [][4]byte {
+	addrs, _ := net.InterfaceAddrs()
+	var ips, loopback [][4]byte
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip4 := ipnet.IP.To4()
+		if ip4 == nil {
+			continue
+		}
+		if ip4.IsLoopback() {
+			loopback = append(loopback, [4]byte(ip4))
+		} else {
+			ips = append(ips, [4]byte(ip4))
+		}
+	}
+	if len(ips) == 0 {
+		return loopback
+	}
+	return ips
+}
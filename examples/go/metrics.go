@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Metrics
+// =============================================================================
+
+// maxMetricMethods bounds the method label set so clients sending arbitrary
+// method names cannot grow the metrics without limit.
+const maxMetricMethods = 256
+
+// toolLatencyBuckets are the upper bounds, in seconds, of the tools/call
+// latency histogram. Calls slower than the last one land in +Inf.
+var toolLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics aggregates server-wide counters exposed on the admin endpoint.
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[string]uint64
+	errors   map[int]uint64
+	tools    map[string]*toolMetrics
+	// dropped counts error responses Config.ErrorRate held back, and
+	// closed the sessions ended by the server, by reason.
+	dropped uint64
+	closed  map[string]uint64
+	// refused counts the client streams reset, by reason.
+	refused map[string]uint64
+	// limited counts the calls refused by a tool's rate, by tool.
+	limited map[string]uint64
+	// busy counts the calls refused because an exclusive tool was running,
+	// by tool.
+	busy map[string]uint64
+	// usage counts the records handed to Config.UsageSink, by outcome.
+	usage map[string]uint64
+	// webhooks counts the events queued for webhooks, by outcome.
+	webhooks map[string]uint64
+	// bridged counts the events queued for Config.EventPublisher, by
+	// outcome.
+	bridged map[string]uint64
+	// cluster counts the messages exchanged over Config.ClusterBus, by
+	// outcome.
+	cluster map[string]uint64
+}
+
+// toolMetrics counts one tool's calls. buckets holds the calls that fell
+// in each latency bucket, with +Inf last; it is not cumulative.
+type toolMetrics struct {
+	calls   uint64
+	errors  uint64
+	seconds float64
+	buckets []uint64
+}
+
+// NewMetrics creates an empty metrics set.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: make(map[string]uint64),
+		errors:   make(map[int]uint64),
+		tools:    make(map[string]*toolMetrics),
+		closed:   make(map[string]uint64),
+		refused:  make(map[string]uint64),
+		limited:  make(map[string]uint64),
+		usage:    make(map[string]uint64),
+		webhooks: make(map[string]uint64),
+		bridged:  make(map[string]uint64),
+		cluster:  make(map[string]uint64),
+		busy:     make(map[string]uint64),
+	}
+}
+
+// ObserveRequest counts a handled request or notification by method.
+func (m *Metrics) ObserveRequest(method string) {
+	m.mu.Lock()
+	if _, ok := m.requests[method]; !ok && len(m.requests) >= maxMetricMethods {
+		method = "other"
+	}
+	m.requests[method]++
+	m.mu.Unlock()
+}
+
+// ObserveError counts a JSON-RPC error response by code.
+func (m *Metrics) ObserveError(code int) {
+	m.mu.Lock()
+	m.errors[code]++
+	m.mu.Unlock()
+}
+
+// ObserveDroppedError counts an error response dropped by the session's
+// error limit.
+func (m *Metrics) ObserveDroppedError() {
+	m.mu.Lock()
+	m.dropped++
+	m.mu.Unlock()
+}
+
+// Reasons the server closes a session, for ObserveSessionClosed.
+const (
+	closedForErrors        = "errors"
+	closedHandshakeTimeout = "handshake_timeout"
+	closedUpgradeTimeout   = "upgrade_timeout"
+	closedStreamTimeout    = "stream_timeout"
+	closedInitTimeout      = "init_timeout"
+)
+
+// ObserveSessionClosed counts a session the server closed for reason.
+func (m *Metrics) ObserveSessionClosed(reason string) {
+	m.mu.Lock()
+	m.closed[reason]++
+	m.mu.Unlock()
+}
+
+// Reasons a client stream is reset, for ObserveStreamRefused.
+const (
+	streamRefusedUnused = "unused"
+	streamRefusedLimit  = "limit"
+)
+
+// ObserveStreamRefused counts a client stream reset for reason.
+func (m *Metrics) ObserveStreamRefused(reason string) {
+	m.mu.Lock()
+	m.refused[reason]++
+	m.mu.Unlock()
+}
+
+// ObserveToolRateLimited counts a call refused by the tool's rate limit.
+func (m *Metrics) ObserveToolRateLimited(tool string) {
+	m.mu.Lock()
+	m.limited[tool]++
+	m.mu.Unlock()
+}
+
+// ObserveToolBusy counts a call refused because the exclusive tool was
+// already running.
+func (m *Metrics) ObserveToolBusy(tool string) {
+	m.mu.Lock()
+	m.busy[tool]++
+	m.mu.Unlock()
+}
+
+// ObserveUsageRecord counts a usage record by what became of it.
+func (m *Metrics) ObserveUsageRecord(outcome string) {
+	m.mu.Lock()
+	m.usage[outcome]++
+	m.mu.Unlock()
+}
+
+// ObserveWebhookEvent counts an event sent to a webhook by what became of
+// it.
+func (m *Metrics) ObserveWebhookEvent(outcome string) {
+	m.mu.Lock()
+	m.webhooks[outcome]++
+	m.mu.Unlock()
+}
+
+// ObserveBridgeEvent counts an event sent to the event publisher by what
+// became of it.
+func (m *Metrics) ObserveBridgeEvent(outcome string) {
+	m.mu.Lock()
+	m.bridged[outcome]++
+	m.mu.Unlock()
+}
+
+// ObserveClusterMessage counts a message published to or received from
+// the cluster bus by what became of it.
+func (m *Metrics) ObserveClusterMessage(outcome string) {
+	m.mu.Lock()
+	m.cluster[outcome]++
+	m.mu.Unlock()
+}
+
+// ObserveToolCall records a tools/call and how long it took. failed is set
+// for error responses and results flagged with isError.
+func (m *Metrics) ObserveToolCall(tool string, elapsed time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tools[tool]; !ok && len(m.tools) >= maxMetricMethods {
+		tool = "other"
+	}
+	t := m.tools[tool]
+	if t == nil {
+		t = &toolMetrics{buckets: make([]uint64, len(toolLatencyBuckets)+1)}
+		m.tools[tool] = t
+	}
+	t.calls++
+	if failed {
+		t.errors++
+	}
+	t.seconds += elapsed.Seconds()
+	t.buckets[sort.SearchFloat64s(toolLatencyBuckets, elapsed.Seconds())]++
+}
+
+// WritePrometheus renders the counters in Prometheus text exposition format.
+// Error codes are labelled with their registered mcpflowerr name.
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP mcpflow_requests_total Requests handled, by method.")
+	fmt.Fprintln(w, "# TYPE mcpflow_requests_total counter")
+	for _, method := range sortedKeys(m.requests) {
+		fmt.Fprintf(w, "mcpflow_requests_total{method=%q} %d\n", method, m.requests[method])
+	}
+
+	codes := make([]int, 0, len(m.errors))
+	for code := range m.errors {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+
+	fmt.Fprintln(w, "# HELP mcpflow_errors_total Error responses sent, by JSON-RPC code.")
+	fmt.Fprintln(w, "# TYPE mcpflow_errors_total counter")
+	for _, code := range codes {
+		fmt.Fprintf(w, "mcpflow_errors_total{code=\"%d\",name=%q} %d\n", code, mcpflowerr.NameOf(code), m.errors[code])
+	}
+
+	fmt.Fprintln(w, "# HELP mcpflow_errors_dropped_total Error responses held back by the per-session error limit.")
+	fmt.Fprintln(w, "# TYPE mcpflow_errors_dropped_total counter")
+	fmt.Fprintf(w, "mcpflow_errors_dropped_total %d\n", m.dropped)
+
+	fmt.Fprintln(w, "# HELP mcpflow_sessions_closed_total Sessions the server closed, by reason.")
+	fmt.Fprintln(w, "# TYPE mcpflow_sessions_closed_total counter")
+	for _, reason := range sortedKeys(m.closed) {
+		fmt.Fprintf(w, "mcpflow_sessions_closed_total{reason=%q} %d\n", reason, m.closed[reason])
+	}
+
+	fmt.Fprintln(w, "# HELP mcpflow_streams_refused_total WebTransport streams opened by clients and reset, by reason.")
+	fmt.Fprintln(w, "# TYPE mcpflow_streams_refused_total counter")
+	for _, reason := range sortedKeys(m.refused) {
+		fmt.Fprintf(w, "mcpflow_streams_refused_total{reason=%q} %d\n", reason, m.refused[reason])
+	}
+
+	fmt.Fprintln(w, "# HELP mcpflow_usage_records_total Usage records for the usage sink, by outcome.")
+	fmt.Fprintln(w, "# TYPE mcpflow_usage_records_total counter")
+	for _, outcome := range sortedKeys(m.usage) {
+		fmt.Fprintf(w, "mcpflow_usage_records_total{outcome=%q} %d\n", outcome, m.usage[outcome])
+	}
+
+	fmt.Fprintln(w, "# HELP mcpflow_webhook_events_total Server events sent to webhooks, by outcome.")
+	fmt.Fprintln(w, "# TYPE mcpflow_webhook_events_total counter")
+	for _, outcome := range sortedKeys(m.webhooks) {
+		fmt.Fprintf(w, "mcpflow_webhook_events_total{outcome=%q} %d\n", outcome, m.webhooks[outcome])
+	}
+
+	fmt.Fprintln(w, "# HELP mcpflow_bridge_events_total Server events sent to the event publisher, by outcome.")
+	fmt.Fprintln(w, "# TYPE mcpflow_bridge_events_total counter")
+	for _, outcome := range sortedKeys(m.bridged) {
+		fmt.Fprintf(w, "mcpflow_bridge_events_total{outcome=%q} %d\n", outcome, m.bridged[outcome])
+	}
+
+	fmt.Fprintln(w, "# HELP mcpflow_cluster_messages_total Messages exchanged with other instances over the cluster bus, by outcome.")
+	fmt.Fprintln(w, "# TYPE mcpflow_cluster_messages_total counter")
+	for _, outcome := range sortedKeys(m.cluster) {
+		fmt.Fprintf(w, "mcpflow_cluster_messages_total{outcome=%q} %d\n", outcome, m.cluster[outcome])
+	}
+
+	tools := make([]string, 0, len(m.tools))
+	for name := range m.tools {
+		tools = append(tools, name)
+	}
+	sort.Strings(tools)
+
+	fmt.Fprintln(w, "# HELP mcpflow_tool_errors_total Tool calls that failed or returned isError, by tool.")
+	fmt.Fprintln(w, "# TYPE mcpflow_tool_errors_total counter")
+	for _, name := range tools {
+		fmt.Fprintf(w, "mcpflow_tool_errors_total{tool=%q} %d\n", name, m.tools[name].errors)
+	}
+
+	fmt.Fprintln(w, "# HELP mcpflow_tool_rate_limited_total Tool calls refused by the tool's per-session rate limit, by tool.")
+	fmt.Fprintln(w, "# TYPE mcpflow_tool_rate_limited_total counter")
+	for _, name := range sortedKeys(m.limited) {
+		fmt.Fprintf(w, "mcpflow_tool_rate_limited_total{tool=%q} %d\n", name, m.limited[name])
+	}
+
+	fmt.Fprintln(w, "# HELP mcpflow_tool_busy_total Calls of exclusive tools refused because the tool was already running, by tool.")
+	fmt.Fprintln(w, "# TYPE mcpflow_tool_busy_total counter")
+	for _, name := range sortedKeys(m.busy) {
+		fmt.Fprintf(w, "mcpflow_tool_busy_total{tool=%q} %d\n", name, m.busy[name])
+	}
+
+	fmt.Fprintln(w, "# HELP mcpflow_tool_duration_seconds Time spent in tools/call, by tool.")
+	fmt.Fprintln(w, "# TYPE mcpflow_tool_duration_seconds histogram")
+	for _, name := range tools {
+		t := m.tools[name]
+		var cumulative uint64
+		for i, n := range t.buckets {
+			cumulative += n
+			le := "+Inf"
+			if i < len(toolLatencyBuckets) {
+				le = strconv.FormatFloat(toolLatencyBuckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "mcpflow_tool_duration_seconds_bucket{tool=%q,le=%q} %d\n", name, le, cumulative)
+		}
+		fmt.Fprintf(w, "mcpflow_tool_duration_seconds_sum{tool=%q} %g\n", name, t.seconds)
+		fmt.Fprintf(w, "mcpflow_tool_duration_seconds_count{tool=%q} %d\n", name, t.calls)
+	}
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// =============================================================================
+// MIME Types
+// =============================================================================
+
+// Resources whose provider gives no mimeType get one from the extension of
+// their URI's path and, when the content is at hand, by sniffing it the way
+// browsers do, so clients can render them. Lists only go by extension,
+// since sniffing would mean reading every resource.
+
+// mimeTypes is consulted before mime.TypeByExtension, whose built-in table
+// leaves out common text formats and whose system tables vary by host.
+var mimeTypes = map[string]string{
+	".txt":      "text/plain; charset=utf-8",
+	".log":      "text/plain; charset=utf-8",
+	".md":       "text/markdown; charset=utf-8",
+	".markdown": "text/markdown; charset=utf-8",
+	".csv":      "text/csv; charset=utf-8",
+	".tsv":      "text/tab-separated-values; charset=utf-8",
+	".json":     "application/json",
+	".jsonl":    "application/jsonl",
+	".ndjson":   "application/x-ndjson",
+	".yaml":     "application/yaml",
+	".yml":      "application/yaml",
+	".toml":     "application/toml",
+	".go":       "text/x-go; charset=utf-8",
+	".py":       "text/x-python; charset=utf-8",
+	".rs":       "text/x-rust; charset=utf-8",
+	".sh":       "application/x-sh",
+	".sql":      "application/sql",
+	".proto":    "text/x-protobuf; charset=utf-8",
+}
+
+// mimeTypeByName returns the MIME type of a file name, path, or URI by its
+// extension, or "" if the extension is unknown.
+func mimeTypeByName(name string) string {
+	if u, err := url.Parse(name); err == nil && u.Path != "" {
+		name = u.Path
+	}
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return ""
+	}
+	if t, ok := mimeTypes[ext]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// detectMimeType returns the MIME type of a resource named name whose
+// content starts with data: by extension, or else by sniffing data. It
+// returns "" for an unknown extension when there is no data to sniff.
+func detectMimeType(name string, data []byte) string {
+	if t := mimeTypeByName(name); t != "" {
+		return t
+	}
+	if len(data) == 0 {
+		return ""
+	}
+	return http.DetectContentType(data)
+}
+
+// withMimeType fills in the MIME type of a listed resource without one.
+func withMimeType(r Resource) Resource {
+	if r.MimeType == "" {
+		r.MimeType = mimeTypeByName(r.URI)
+	}
+	return r
+}
+
+// withMimeTypes fills in the MIME type of read contents without one.
+func withMimeTypes(items []ResourceContents) []ResourceContents {
+	for i, c := range items {
+		if c.MimeType != "" {
+			continue
+		}
+		data := c.Blob
+		if data == nil {
+			data = []byte(c.Text)
+		}
+		items[i].MimeType = detectMimeType(c.URI, data)
+	}
+	return items
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// =============================================================================
+// Tool Namespaces
+// =============================================================================
+
+// ToolProvider supplies a set of tools served under a namespace. Tools is
+// consulted on every list and call, so a provider may change its set at
+// runtime.
+type ToolProvider interface {
+	Tools() []Tool
+}
+
+// StaticTools is a ToolProvider over a fixed list of tools.
+type StaticTools []Tool
+
+// Tools returns the list itself.
+func (s StaticTools) Tools() []Tool { return s }
+
+// ToolFunc runs a tool call by its qualified name, such as "fs.read_file".
+type ToolFunc func(name string, args map[string]interface{}) (interface{}, error)
+
+// ToolMiddleware wraps the calls routed to one namespace, for concerns such
+// as logging, authorization, or rate limiting that apply to a single
+// provider.
+type ToolMiddleware func(next ToolFunc) ToolFunc
+
+// namespace is a registered provider, or the middleware attached to a
+// gateway upstream, which is its own namespace and has no provider here.
+type namespace struct {
+	provider   ToolProvider
+	middleware []ToolMiddleware
+}
+
+// RegisterNamespace serves provider's tools as name.tool and routes
+// tools/call by that prefix, running the call through middleware (the first
+// is outermost). It fails if name is taken by another namespace or a
+// gateway upstream, or if a qualified name would shadow a local tool.
+func (h *Handler) RegisterNamespace(name string, provider ToolProvider, middleware ...ToolMiddleware) error {
+	if name == "" || strings.Contains(name, namespaceSep) {
+		return fmt.Errorf("namespace %q: must be non-empty and must not contain %q", name, namespaceSep)
+	}
+
+	h.namespacesMu.Lock()
+	defer h.namespacesMu.Unlock()
+
+	if _, ok := h.namespaces[name]; ok {
+		return fmt.Errorf("namespace %q already registered", name)
+	}
+	if h.gateway != nil && h.gateway.byName[name] != nil {
+		return fmt.Errorf("namespace %q is used by an upstream", name)
+	}
+
+	tools := provider.Tools()
+	if err := checkToolVersions(tools); err != nil {
+		return fmt.Errorf("namespace %q: %w", name, err)
+	}
+	for _, st := range serveVersions(tools) {
+		if qualified := name + namespaceSep + st.name; h.tools[qualified] != nil {
+			return fmt.Errorf("namespace %q: tool %q collides with a local tool", name, qualified)
+		}
+	}
+
+	h.namespaces[name] = &namespace{provider: provider, middleware: middleware}
+	return nil
+}
+
+// UnregisterNamespace stops serving a namespace registered with
+// RegisterNamespace, along with its middleware, and reports whether it was
+// registered. Calls already routed to it finish.
+func (h *Handler) UnregisterNamespace(name string) bool {
+	h.namespacesMu.Lock()
+	defer h.namespacesMu.Unlock()
+
+	ns, ok := h.namespaces[name]
+	if !ok || ns.provider == nil {
+		return false
+	}
+	delete(h.namespaces, name)
+	return true
+}
+
+// UseNamespace adds middleware to a registered namespace or gateway
+// upstream.
+func (h *Handler) UseNamespace(name string, middleware ...ToolMiddleware) error {
+	h.namespacesMu.Lock()
+	defer h.namespacesMu.Unlock()
+
+	ns, ok := h.namespaces[name]
+	if !ok {
+		if h.gateway == nil || h.gateway.byName[name] == nil {
+			return fmt.Errorf("unknown namespace %q", name)
+		}
+		ns = &namespace{}
+		h.namespaces[name] = ns
+	}
+	ns.middleware = append(ns.middleware, middleware...)
+	return nil
+}
+
+// namespacedTools lists the tools of every registered provider under their
+// qualified names, in namespace order.
+func (h *Handler) namespacedTools(withAnnotations bool) []map[string]interface{} {
+	h.namespacesMu.RLock()
+	names := make([]string, 0, len(h.namespaces))
+	for name, ns := range h.namespaces {
+		if ns.provider != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	providers := make([]ToolProvider, len(names))
+	for i, name := range names {
+		providers[i] = h.namespaces[name].provider
+	}
+	h.namespacesMu.RUnlock()
+
+	var tools []map[string]interface{}
+	for i, provider := range providers {
+		for _, st := range serveVersions(provider.Tools()) {
+			tools = append(tools, toolEntry(names[i]+namespaceSep+st.name, st.tool, withAnnotations))
+		}
+	}
+	return tools
+}
+
+// lookupTool finds a local or namespaced tool by its qualified name.
+func (h *Handler) lookupTool(name string) (Tool, bool) {
+	if tool, ok := h.tools[name]; ok {
+		return tool, true
+	}
+
+	prefix, rest, ok := strings.Cut(name, namespaceSep)
+	if !ok {
+		return nil, false
+	}
+	h.namespacesMu.RLock()
+	ns := h.namespaces[prefix]
+	h.namespacesMu.RUnlock()
+	if ns == nil || ns.provider == nil {
+		return nil, false
+	}
+
+	for _, st := range serveVersions(ns.provider.Tools()) {
+		if st.name == rest || st.alias == rest {
+			return st.tool, true
+		}
+	}
+	return nil, false
+}
+
+// routeTool returns the call path for a namespaced tool, wrapped in its
+// namespace's middleware, or false if no provider or upstream owns name.
+func (h *Handler) routeTool(ctx context.Context, name string) (ToolFunc, bool) {
+	prefix, _, ok := strings.Cut(name, namespaceSep)
+	if !ok {
+		return nil, false
+	}
+
+	var call ToolFunc
+	if tool, ok := h.lookupTool(name); ok {
+		call = func(name string, args map[string]interface{}) (interface{}, error) {
+			return h.executeTool(ctx, name, tool, args)
+		}
+	} else if h.gateway != nil {
+		if _, _, ok := h.gateway.route(name); ok {
+			call = func(name string, args map[string]interface{}) (interface{}, error) {
+				result, _, err := h.gateway.callTool(ctx, name, args)
+				return result, err
+			}
+		}
+	}
+	if call == nil {
+		return nil, false
+	}
+
+	h.namespacesMu.RLock()
+	var middleware []ToolMiddleware
+	if ns := h.namespaces[prefix]; ns != nil {
+		middleware = ns.middleware
+	}
+	h.namespacesMu.RUnlock()
+
+	for i := len(middleware) - 1; i >= 0; i-- {
+		call = middleware[i](call)
+	}
+	return call, true
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// =============================================================================
+// Acknowledged Notifications
+// =============================================================================
+
+// ackCapability is the experimental capability under which a Streamable
+// HTTP client asks for acknowledged notifications, and the server offers
+// them when Config.AckNotifications is set.
+//
+// Each notification queued for such a session carries a sequence number
+// in params._meta.seq. The client acknowledges with a $/ack notification
+// whose seq is the highest number it has processed, which also covers
+// every lower one. Until then the notification stays in the SessionStore
+// and rides along again on each event stream the session opens, on any
+// instance, so one lost with a dropped connection is not lost for good.
+// Clients drop numbers they have already seen.
+const ackCapability = "notificationAcks"
+
+// offersAcks reports whether the session's transport can deliver
+// acknowledged notifications, so initialize advertises them.
+func (s *Session) offersAcks() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ack != nil
+}
+
+// acksNotifications reports whether the session gets acknowledged
+// notifications: they are offered and the client asked for them.
+func (s *Session) acksNotifications() bool {
+	_, asked := s.ClientExperimental()[ackCapability]
+	return asked && s.offersAcks()
+}
+
+// handleAck drops the notifications a $/ack covers.
+func (h *Handler) handleAck(sess *Session, req *RPCRequest) {
+	var params AckParams
+	if err := decodeParams(req, &params); err != nil || params.Seq == 0 {
+		req.logger().Warn("ignoring malformed ack", "error", err)
+		return
+	}
+	sess.mu.RLock()
+	ack := sess.ack
+	sess.mu.RUnlock()
+	if ack == nil {
+		return
+	}
+	if err := ack(params.Seq); err != nil {
+		req.logger().Error("session store ack failed", "seq", params.Seq, "error", err)
+	}
+}
+
+// withSeq returns msg encoded with seq added to its params._meta.
+func withSeq(msg *RPCRequest, seq uint64) ([]byte, error) {
+	params := map[string]json.RawMessage{}
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+	}
+	meta := map[string]interface{}{}
+	if raw, ok := params["_meta"]; ok {
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, err
+		}
+	}
+	meta["seq"] = seq
+	encodedMeta, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	params["_meta"] = encodedMeta
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	sequenced := *msg
+	sequenced.Params = encodedParams
+	return json.Marshal(&sequenced)
+}
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// OpenAPI Tools
+// =============================================================================
+
+const (
+	// openAPICallTimeout bounds each HTTP call an OpenAPI tool makes.
+	openAPICallTimeout = 30 * time.Second
+	// maxOpenAPISpec bounds the size of a spec document.
+	maxOpenAPISpec = 16 << 20
+	// maxHTTPToolResponse bounds the response body returned as tool
+	// content; longer bodies are truncated.
+	maxHTTPToolResponse = 1 << 20
+	// openAPIRefDepth bounds $ref chains, in case they loop.
+	openAPIRefDepth = 8
+)
+
+// openAPIMethods are the operations of a path item, in listing order.
+var openAPIMethods = []string{"get", "put", "post", "delete", "patch", "head", "options"}
+
+// invalidToolNameChars matches runs to replace with one underscore.
+var invalidToolNameChars = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// OpenAPIOptions configures LoadOpenAPITools.
+type OpenAPIOptions struct {
+	// BaseURL is where operations are sent, overriding the spec's first
+	// servers entry.
+	BaseURL string
+	// Header is sent with every call, e.g. to carry an API key.
+	Header http.Header
+	// Client sends the calls. Nil means a client with a 30s timeout.
+	Client *http.Client
+}
+
+// LoadOpenAPITools reads an OpenAPI 3 document, in JSON or YAML, from a
+// file or an http(s) URL and turns each operation into a tool. A tool is
+// named after its operationId (or method and path), takes the operation's
+// path, query, and header parameters as arguments, plus "body" for a JSON
+// request body, and returns the response body as text. Responses with an
+// error status are flagged isError.
+func LoadOpenAPITools(ctx context.Context, source string, opts OpenAPIOptions) (StaticTools, error) {
+	data, err := readOpenAPISource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("openapi %s: %w", source, err)
+	}
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("openapi %s: only OpenAPI 3 documents are supported", source)
+	}
+
+	base := opts.BaseURL
+	if base == "" {
+		if base, err = openAPIServer(doc, source); err != nil {
+			return nil, fmt.Errorf("openapi %s: %w", source, err)
+		}
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: openAPICallTimeout}
+	}
+
+	spec := &openAPISpec{doc: doc}
+	paths, _ := doc["paths"].(map[string]interface{})
+	pathKeys := make([]string, 0, len(paths))
+	for path := range paths {
+		pathKeys = append(pathKeys, path)
+	}
+	sort.Strings(pathKeys)
+
+	var tools StaticTools
+	names := make(map[string]bool)
+	for _, path := range pathKeys {
+		item := spec.resolve(paths[path])
+		for _, method := range openAPIMethods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			t := spec.tool(method, path, item, op)
+			t.base, t.header, t.client = strings.TrimSuffix(base, "/"), opts.Header, client
+			for n, name := 2, t.name; names[t.name]; n++ {
+				t.name = fmt.Sprintf("%s_%d", name, n)
+			}
+			names[t.name] = true
+			tools = append(tools, t)
+		}
+	}
+	if len(tools) == 0 {
+		return nil, fmt.Errorf("openapi %s: no operations", source)
+	}
+	return tools, nil
+}
+
+func readOpenAPISource(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("openapi %s: %s", source, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxOpenAPISpec+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxOpenAPISpec {
+		return nil, fmt.Errorf("openapi %s: document exceeds %d bytes", source, maxOpenAPISpec)
+	}
+	return data, nil
+}
+
+// openAPIServer returns the spec's first server URL with its variables at
+// their defaults, resolved against source when it is relative.
+func openAPIServer(doc map[string]interface{}, source string) (string, error) {
+	servers, _ := doc["servers"].([]interface{})
+	if len(servers) == 0 {
+		return "", fmt.Errorf("no servers entry; set a base URL")
+	}
+	server, _ := servers[0].(map[string]interface{})
+	raw, _ := server["url"].(string)
+	vars, _ := server["variables"].(map[string]interface{})
+	for name, v := range vars {
+		def, _ := v.(map[string]interface{})["default"].(string)
+		raw = strings.ReplaceAll(raw, "{"+name+"}", def)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("server url: %w", err)
+	}
+	if !u.IsAbs() {
+		src, err := url.Parse(source)
+		if err != nil || !src.IsAbs() {
+			return "", fmt.Errorf("server url %q is relative; set a base URL", raw)
+		}
+		u = src.ResolveReference(u)
+	}
+	return u.String(), nil
+}
+
+// openAPISpec resolves references within a parsed document.
+type openAPISpec struct {
+	doc map[string]interface{}
+}
+
+// lookup follows a local JSON pointer reference such as
+// "#/components/schemas/Pet".
+func (s *openAPISpec) lookup(ref string) interface{} {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+	var cur interface{} = s.doc
+	for _, part := range strings.Split(pointer, "/") {
+		part = strings.NewReplacer("~1", "/", "~0", "~").Replace(part)
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+// resolve follows $ref chains to the object they name.
+func (s *openAPISpec) resolve(v interface{}) map[string]interface{} {
+	for depth := 0; depth < openAPIRefDepth; depth++ {
+		m, _ := v.(map[string]interface{})
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		v = s.lookup(ref)
+	}
+	return nil
+}
+
+// schema returns v with $refs inlined, since tool input schemas must stand
+// alone. A reference back into a schema being inlined, as in a recursive
+// type, becomes an open schema.
+func (s *openAPISpec) schema(v interface{}, inlining map[string]bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			if inlining[ref] {
+				return map[string]interface{}{}
+			}
+			if inlining == nil {
+				inlining = make(map[string]bool)
+			}
+			inlining[ref] = true
+			defer delete(inlining, ref)
+			return s.schema(s.lookup(ref), inlining)
+		}
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			out[k] = s.schema(child, inlining)
+		}
+		return out
+	case map[interface{}]interface{}:
+		// YAML mappings with non-string keys, such as enum values.
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			out[fmt.Sprint(k)] = s.schema(child, inlining)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = s.schema(child, inlining)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// tool describes one operation. Parameters declared on the path item apply
+// unless the operation overrides them.
+func (s *openAPISpec) tool(method, path string, item, op map[string]interface{}) *openAPITool {
+	t := &openAPITool{method: strings.ToUpper(method), path: path}
+
+	t.name, _ = op["operationId"].(string)
+	if t.name == "" {
+		t.name = method + "_" + path
+	}
+	t.name = strings.Trim(invalidToolNameChars.ReplaceAllString(t.name, "_"), "_")
+
+	summary, _ := op["summary"].(string)
+	description, _ := op["description"].(string)
+	t.description = strings.TrimSpace(summary + "\n\n" + description)
+	if t.description == "" {
+		t.description = t.method + " " + path
+	}
+
+	properties := make(map[string]interface{})
+	var required []string
+	params := make(map[string]openAPIParam)
+	for _, list := range []interface{}{item["parameters"], op["parameters"]} {
+		entries, _ := list.([]interface{})
+		for _, entry := range entries {
+			p := s.resolve(entry)
+			name, _ := p["name"].(string)
+			in, _ := p["in"].(string)
+			if name == "" || (in != "path" && in != "query" && in != "header") {
+				continue
+			}
+			req, _ := p["required"].(bool)
+			params[name] = openAPIParam{name: name, in: in, required: req || in == "path"}
+
+			schema, _ := s.schema(p["schema"], nil).(map[string]interface{})
+			if schema == nil {
+				schema = map[string]interface{}{"type": "string"}
+			}
+			if desc, ok := p["description"].(string); ok {
+				schema["description"] = desc
+			}
+			properties[name] = schema
+		}
+	}
+	for _, p := range params {
+		t.params = append(t.params, p)
+		if p.required {
+			required = append(required, p.name)
+		}
+	}
+	sort.Slice(t.params, func(i, j int) bool { return t.params[i].name < t.params[j].name })
+
+	if body := s.resolve(op["requestBody"]); body != nil {
+		content, _ := body["content"].(map[string]interface{})
+		if media, ok := content["application/json"].(map[string]interface{}); ok {
+			t.hasBody = true
+			schema, _ := s.schema(media["schema"], nil).(map[string]interface{})
+			if schema == nil {
+				schema = map[string]interface{}{}
+			}
+			properties["body"] = schema
+			if req, _ := body["required"].(bool); req {
+				required = append(required, "body")
+			}
+		}
+	}
+
+	sort.Strings(required)
+	t.schema = map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		t.schema["required"] = required
+	}
+
+	t.annotations = ToolAnnotations{
+		Title:           summary,
+		ReadOnlyHint:    t.method == http.MethodGet || t.method == http.MethodHead,
+		DestructiveHint: t.method == http.MethodDelete,
+		IdempotentHint:  t.method != http.MethodPost && t.method != http.MethodPatch,
+		OpenWorldHint:   true,
+	}
+	return t
+}
+
+type openAPIParam struct {
+	name     string
+	in       string
+	required bool
+}
+
+// openAPITool calls one operation of an HTTP API.
+type openAPITool struct {
+	name        string
+	description string
+	schema      map[string]interface{}
+	annotations ToolAnnotations
+
+	method  string
+	path    string
+	params  []openAPIParam
+	hasBody bool
+
+	base   string
+	header http.Header
+	client *http.Client
+}
+
+func (t *openAPITool) Name() string                        { return t.name }
+func (t *openAPITool) Description() string                 { return t.description }
+func (t *openAPITool) InputSchema() map[string]interface{} { return t.schema }
+func (t *openAPITool) Annotations() ToolAnnotations        { return t.annotations }
+
+func (t *openAPITool) Execute(args map[string]interface{}) (interface{}, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *openAPITool) ExecuteContext(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	path := t.path
+	query := url.Values{}
+	header := http.Header{}
+	for _, p := range t.params {
+		v, ok := args[p.name]
+		if !ok || v == nil {
+			if p.required {
+				return nil, mcpflowerr.InvalidParams("missing required argument %q", p.name).
+					WithOffender(p.name, "required")
+			}
+			continue
+		}
+		switch p.in {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.name+"}", url.PathEscape(argString(v)))
+		case "query":
+			if list, ok := v.([]interface{}); ok {
+				for _, item := range list {
+					query.Add(p.name, argString(item))
+				}
+			} else {
+				query.Set(p.name, argString(v))
+			}
+		case "header":
+			header.Set(p.name, argString(v))
+		}
+	}
+
+	target := t.base + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if v, ok := args["body"]; ok && t.hasBody {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, mcpflowerr.InvalidParams("body: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, openAPICallTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, t.method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range t.header {
+		req.Header[k] = vs
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json, */*;q=0.5")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return httpToolResult(resp, maxHTTPToolResponse)
+}
+
+// argString formats a scalar argument for a URL or header.
+func argString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// httpToolResult returns an HTTP response body, up to limit bytes, as tool
+// content. Error statuses are flagged isError and prefixed with the status.
+func httpToolResult(resp *http.Response, limit int64) (interface{}, error) {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	text := string(data)
+	if int64(len(data)) > limit {
+		text = string(data[:limit]) + fmt.Sprintf("\n[truncated at %d bytes]", limit)
+	}
+
+	result := map[string]interface{}{}
+	if resp.StatusCode >= 400 {
+		text = "HTTP " + resp.Status + "\n" + text
+		result["isError"] = true
+	}
+	result["content"] = []map[string]interface{}{{"type": "text", "text": text}}
+	return result, nil
+}
+
+// openAPIFlags collects repeated -openapi name=source[,base=URL] flags.
+type openAPIFlags []openAPISource
+
+type openAPISource struct {
+	name   string
+	source string
+	base   string
+}
+
+func (f *openAPIFlags) String() string {
+	names := make([]string, len(*f))
+	for i, s := range *f {
+		names[i] = s.name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *openAPIFlags) Set(value string) error {
+	spec, opts, _ := strings.Cut(value, ",")
+	name, source, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || source == "" {
+		return fmt.Errorf("want name=source[,base=URL], got %q", value)
+	}
+	s := openAPISource{name: name, source: source}
+	if opts != "" {
+		base, ok := strings.CutPrefix(opts, "base=")
+		if !ok || base == "" {
+			return fmt.Errorf("invalid openapi option %q", opts)
+		}
+		s.base = base
+	}
+	*f = append(*f, s)
+	return nil
+}
+
+// headerFlags collects repeated "Name: value" flags.
+type headerFlags http.Header
+
+func (f headerFlags) String() string { return fmt.Sprint(http.Header(f)) }
+
+func (f headerFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("want Name: value, got %q", value)
+	}
+	http.Header(f).Add(strings.TrimSpace(name), strings.TrimSpace(val))
+	return nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Notification Outbox
+// =============================================================================
+
+// defaultOutboxTTL is how long an outbox keeps a client's notifications
+// when Config.OutboxTTL is zero.
+const defaultOutboxTTL = 24 * time.Hour
+
+// Outbox keeps critical notifications, sent with Session.NotifyCritical,
+// somewhere that outlives the process, until the client acknowledges them.
+// Each resumable session (see resumeSession) files its notifications under
+// its resume token; a client that resumes with the token, even after the
+// server restarted, gets the ones it has not acknowledged again.
+// Implementations must be safe for concurrent use.
+type Outbox interface {
+	// Put stores the notification encode builds from the next sequence
+	// number for key, counting from 1, and keeps key's notifications for
+	// ttl after the last Put.
+	Put(key string, encode func(seq uint64) ([]byte, error), ttl time.Duration) error
+	// Pending returns the notifications stored for key, oldest first.
+	Pending(key string) ([][]byte, error)
+	// Ack drops the notifications for key numbered seq and lower.
+	Ack(key string, seq uint64) error
+	Close() error
+}
+
+// NotifyCritical sends a notification that must reach the client even if
+// the connection drops or the server restarts first. With Config.Outbox
+// set, on a session that can be resumed and whose client asked for
+// acknowledged notifications (see ackCapability), it is numbered in
+// params._meta.seq and stored in the outbox until the client acknowledges
+// it with $/ack; otherwise it is sent like Notify.
+func (s *Session) NotifyCritical(method string, params map[string]interface{}) error {
+	outbox := s.handler.cfg.Outbox
+	s.mu.RLock()
+	token, out := s.resumeToken, s.out
+	s.mu.RUnlock()
+	if outbox == nil || token == "" || out == nil || !s.acksNotifications() {
+		return s.Notify(method, params)
+	}
+
+	msg, err := newNotification(method, params)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	err = outbox.Put(token, func(seq uint64) ([]byte, error) {
+		data, err = withSeq(msg, seq)
+		return data, err
+	}, s.handler.outboxTTL())
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	return s.writeStored(out, data)
+}
+
+// writeStored writes a notification kept as JSON to out.
+func (s *Session) writeStored(out *sessionWriter, data []byte) error {
+	frame, err := s.codec.Encode(json.RawMessage(data))
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(frame)
+	return err
+}
+
+// deliverOutbox writes the notifications the outbox holds for a session
+// that was not resumed from memory, such as one a restart cut off.
+func (s *Session) deliverOutbox(out *sessionWriter, token string) error {
+	outbox := s.handler.cfg.Outbox
+	if outbox == nil {
+		return nil
+	}
+	pending, err := outbox.Pending(token)
+	if err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+	for _, data := range pending {
+		if err := s.writeStored(out, data); err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		s.logger.Info("delivered stored notifications", "count", len(pending))
+	}
+	return nil
+}
+
+// outboxAcker returns the ack hook of a session whose critical
+// notifications are filed under token.
+func (h *Handler) outboxAcker(token string) func(seq uint64) error {
+	return func(seq uint64) error { return h.cfg.Outbox.Ack(token, seq) }
+}
+
+// outboxHolds reports whether the outbox has notifications for token.
+func (h *Handler) outboxHolds(token string) bool {
+	if h.cfg.Outbox == nil {
+		return false
+	}
+	pending, err := h.cfg.Outbox.Pending(token)
+	return err == nil && len(pending) > 0
+}
+
+func (h *Handler) outboxTTL() time.Duration {
+	if h.cfg.OutboxTTL > 0 {
+		return h.cfg.OutboxTTL
+	}
+	return defaultOutboxTTL
+}
+
+// =============================================================================
+// File Backend
+// =============================================================================
+
+// fileOutboxCompactAfter is how many records FileOutbox appends before it
+// considers rewriting its file.
+const fileOutboxCompactAfter = 1024
+
+// FileOutbox is an Outbox kept in a single append-only file, with no
+// database to run. Every Put and Ack appends a JSON record and syncs it to
+// disk before returning; the file is read back into memory on open and
+// rewritten without acknowledged and expired notifications on open and as
+// it grows. A record torn by a crash ends the file and is dropped.
+type FileOutbox struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	queues   map[string]*outboxQueue
+	appended int
+}
+
+// outboxQueue is one key's notifications and the last number handed out.
+type outboxQueue struct {
+	last    uint64
+	expires time.Time
+	msgs    []outboxMsg
+}
+
+type outboxMsg struct {
+	seq  uint64
+	data []byte
+}
+
+// outboxRecord is a line of the file: a notification numbered Seq, a
+// marker keeping a key's last number when Msg is empty, or an Ack.
+type outboxRecord struct {
+	Key     string          `json:"key"`
+	Seq     uint64          `json:"seq,omitempty"`
+	Msg     json.RawMessage `json:"msg,omitempty"`
+	Ack     uint64          `json:"ack,omitempty"`
+	Expires int64           `json:"expires,omitempty"`
+}
+
+// OpenFileOutbox opens the outbox at path, creating it if needed.
+func OpenFileOutbox(path string) (*FileOutbox, error) {
+	o := &FileOutbox{path: path, queues: make(map[string]*outboxQueue)}
+	if err := o.load(); err != nil {
+		return nil, fmt.Errorf("outbox %s: %w", path, err)
+	}
+	if err := o.compact(); err != nil {
+		return nil, fmt.Errorf("outbox %s: %w", path, err)
+	}
+	return o, nil
+}
+
+func (o *FileOutbox) load() error {
+	f, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxFrameSize)
+	for sc.Scan() {
+		var rec outboxRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			break
+		}
+		o.apply(rec)
+	}
+	return sc.Err()
+}
+
+// apply replays a record into memory.
+func (o *FileOutbox) apply(rec outboxRecord) {
+	q := o.queues[rec.Key]
+	if q == nil {
+		q = &outboxQueue{}
+		o.queues[rec.Key] = q
+	}
+	if rec.Ack > 0 {
+		q.ack(rec.Ack)
+		return
+	}
+	if rec.Seq > q.last {
+		q.last = rec.Seq
+	}
+	q.expires = time.Unix(rec.Expires, 0)
+	if len(rec.Msg) > 0 {
+		q.msgs = append(q.msgs, outboxMsg{seq: rec.Seq, data: rec.Msg})
+	}
+}
+
+func (q *outboxQueue) ack(seq uint64) {
+	i := 0
+	for i < len(q.msgs) && q.msgs[i].seq <= seq {
+		i++
+	}
+	q.msgs = q.msgs[i:]
+}
+
+// compact rewrites the file with the live notifications and opens it for
+// appending. The caller holds o.mu, or has the outbox to itself.
+func (o *FileOutbox) compact() error {
+	now := time.Now()
+	tmp := o.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for key, q := range o.queues {
+		if now.After(q.expires) {
+			delete(o.queues, key)
+			continue
+		}
+		expires := q.expires.Unix()
+		if len(q.msgs) == 0 {
+			enc.Encode(outboxRecord{Key: key, Seq: q.last, Expires: expires})
+		}
+		for _, m := range q.msgs {
+			enc.Encode(outboxRecord{Key: key, Seq: m.seq, Msg: m.data, Expires: expires})
+		}
+	}
+	if err := w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		return err
+	}
+
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file, err = os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	o.appended = 0
+	return err
+}
+
+// append writes rec to the file and syncs it. The caller holds o.mu.
+func (o *FileOutbox) append(rec outboxRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := o.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := o.file.Sync(); err != nil {
+		return err
+	}
+	o.appended++
+	if o.appended >= fileOutboxCompactAfter {
+		live := 0
+		for _, q := range o.queues {
+			live += len(q.msgs) + 1
+		}
+		if o.appended > 2*live {
+			return o.compact()
+		}
+	}
+	return nil
+}
+
+// queue returns key's queue, dropping it first if it expired.
+func (o *FileOutbox) queue(key string) *outboxQueue {
+	q := o.queues[key]
+	if q != nil && time.Now().After(q.expires) {
+		delete(o.queues, key)
+		return nil
+	}
+	return q
+}
+
+// Put implements Outbox.
+func (o *FileOutbox) Put(key string, encode func(seq uint64) ([]byte, error), ttl time.Duration) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var last uint64
+	if q := o.queue(key); q != nil {
+		last = q.last
+	}
+	msg, err := encode(last + 1)
+	if err != nil {
+		return err
+	}
+	rec := outboxRecord{Key: key, Seq: last + 1, Msg: msg, Expires: time.Now().Add(ttl).Unix()}
+	if err := o.append(rec); err != nil {
+		return err
+	}
+	o.apply(rec)
+	return nil
+}
+
+// Pending implements Outbox.
+func (o *FileOutbox) Pending(key string) ([][]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	q := o.queue(key)
+	if q == nil {
+		return nil, nil
+	}
+	pending := make([][]byte, len(q.msgs))
+	for i, m := range q.msgs {
+		pending[i] = m.data
+	}
+	return pending, nil
+}
+
+// Ack implements Outbox.
+func (o *FileOutbox) Ack(key string, seq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	q := o.queue(key)
+	if q == nil || len(q.msgs) == 0 || q.msgs[0].seq > seq {
+		return nil
+	}
+	rec := outboxRecord{Key: key, Ack: seq}
+	if err := o.append(rec); err != nil {
+		return err
+	}
+	o.apply(rec)
+	return nil
+}
+
+// Close closes the file.
+func (o *FileOutbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.file.Close()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Request Parameters
+// =============================================================================
+
+// InitializeParams are the params of initialize.
+type InitializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities,omitempty"`
+	ClientInfo      ClientInfo             `json:"clientInfo"`
+	Transport       TransportParams        `json:"transport"`
+	Meta            RequestMeta            `json:"_meta"`
+}
+
+// ClientInfo names the client in initialize.
+type ClientInfo = mcpflow.ClientInfo
+
+// TransportParams carries the MCP-Flow transport preferences in initialize.
+// Encodings lists the Control Stream encodings the client accepts, most
+// preferred first; nil leaves the choice to the server.
+//
+// SequenceNumbers asks for numbered frames on a length-prefixed stream; see
+// frameSequenced. Resume picks up an earlier session; see resumeSession.
+// BlobStreams asks for resource blobs on Execution Streams; see
+// streamBlobs. ContentHashes asks for repeated payloads by hash; see
+// dedupContent. Checksums lists the frame checksums the client accepts,
+// most preferred first; see frameChecksummed.
+type TransportParams struct {
+	Encodings       []string      `json:"encodings"`
+	SequenceNumbers bool          `json:"sequenceNumbers"`
+	Resume          *ResumeParams `json:"resume"`
+	BlobStreams     bool          `json:"blobStreams"`
+	ContentHashes   bool          `json:"contentHashes"`
+	Checksums       []string      `json:"checksums"`
+}
+
+// ResumeParams name the session to resume and the last frame the client
+// saw from it.
+type ResumeParams struct {
+	Token   string `json:"token"`
+	LastSeq uint64 `json:"lastSeq"`
+}
+
+// RequestMeta is the _meta object a request may carry.
+type RequestMeta struct {
+	// Authorization is the bearer token of a session that could not send
+	// it as a header; see authorize.
+	Authorization string `json:"authorization"`
+	// IdempotencyKey makes a tools/call safe to retry; see idempotencyCache.
+	IdempotencyKey string `json:"idempotencyKey"`
+	// CorrelationID ties the request to the rest of a multi-hop call; one
+	// is generated when it is absent. See requestLogger.
+	CorrelationID string `json:"correlationId"`
+	// Traceparent is W3C trace context, logged by trace ID.
+	Traceparent string `json:"traceparent"`
+	// FullContent has every payload of the result sent in full, for a
+	// client missing one it was sent by hash; see dedupContent.
+	FullContent bool `json:"fullContent"`
+	// IfNoneMatch is the entity tag of a result the client has; the same
+	// result is not sent again. See withETag.
+	IfNoneMatch string `json:"ifNoneMatch"`
+	// Nonce and IssuedAt, in Unix milliseconds, let the server refuse a
+	// tools/call sent again from captured 0-RTT data; see nonceCache.
+	Nonce    string `json:"nonce"`
+	IssuedAt int64  `json:"issuedAt"`
+}
+
+// ToolsCallParams are the params of tools/call.
+type ToolsCallParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	Meta      RequestMeta            `json:"_meta"`
+}
+
+// ResourceParams are the params of resources/read, resources/subscribe,
+// and resources/unsubscribe. Range asks resources/read for part of the
+// resource; see RangedResourceReader.
+type ResourceParams struct {
+	URI   string         `json:"uri"`
+	Range *ResourceRange `json:"range,omitempty"`
+}
+
+// ResourceRange is a byte range of a resource.
+type ResourceRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// PromptsGetParams are the params of prompts/get.
+type PromptsGetParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// CancelParams are the params of $/cancel.
+type CancelParams struct {
+	RequestID RequestID `json:"requestId"`
+	Reason    string    `json:"reason"`
+}
+
+// AckParams are the params of $/ack.
+type AckParams struct {
+	Seq uint64 `json:"seq"`
+}
+
+// decodeParams decodes req's params into v, which points to one of the
+// structs above. The params are decoded once, straight from the bytes the
+// client sent, so large tool arguments are not built as maps only to be
+// read again. A field of the wrong JSON type fails with an invalid params
+// error naming the field, rather than being read as its zero value. Absent
+// or null params leave v as it is.
+func decodeParams(req *RPCRequest, v interface{}) error {
+	if len(req.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.Params, v); err != nil {
+		return paramsError(err)
+	}
+	return nil
+}
+
+// newNotification builds a notification carrying params.
+func newNotification(method string, params map[string]interface{}) (*RPCRequest, error) {
+	msg := &RPCRequest{JSONRPC: "2.0", Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		msg.Params = raw
+	}
+	return msg, nil
+}
+
+// paramsError converts a decoding failure into an invalid params error,
+// with the offending field as a JSON pointer when it is known.
+func paramsError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		return mcpflowerr.InvalidParams("params: %v", err)
+	}
+	field, want := typeErr.Field, jsonKind(typeErr.Type)
+	if field == "" {
+		return mcpflowerr.InvalidParams("params must be %s, not %s", want, typeErr.Value)
+	}
+	return mcpflowerr.InvalidParams("%s must be %s, not %s", field, want, typeErr.Value).
+		WithOffender("/"+strings.ReplaceAll(field, ".", "/"), "expected "+want)
+}
+
+// jsonKind names the JSON type that decodes into t.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a " + t.String()
+}
+
+// toolCallName returns the tool a tools/call names, or "" if its params do
+// not decode; handleToolsCall reports why.
+func toolCallName(req *RPCRequest) string {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if decodeParams(req, &params) != nil {
+		return ""
+	}
+	return params.Name
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Passthrough (fronting another MCP server)
+// =============================================================================
+
+// passthroughConnectTimeout bounds opening a session's upstream, including
+// its initialize. Subprocess servers launched through a package runner can
+// take a while to start.
+const passthroughConnectTimeout = 30 * time.Second
+
+// relay serves req from the session's upstream server. The upstream is
+// opened when the client initializes, with the client's own parameters, so
+// protocol version and capabilities are negotiated end to end; the
+// MCP-Flow transport block is answered locally. Other messages are
+// forwarded unchanged and keep their request IDs.
+func (h *Handler) relay(sess *Session, req *RPCRequest) *RPCResponse {
+	switch req.Method {
+	case "initialize":
+		return h.relayInitialize(sess, req)
+	case "notifications/initialized":
+		// Already sent upstream as part of the connect handshake.
+		return nil
+	}
+
+	upstream := sess.upstreamClient()
+	if upstream == nil {
+		if req.ID.IsZero() {
+			return nil
+		}
+		return h.errorResponse(req.ID, ErrCodeInvalidRequest, "Session not initialized")
+	}
+
+	msg, err := json.Marshal(req)
+	if err != nil {
+		return h.errorResponse(req.ID, ErrCodeInternalError, "Encode failed: "+err.Error())
+	}
+
+	raw, err := upstream.Forward(context.Background(), msg)
+	if err != nil {
+		req.logger().Error("upstream failed", "error", err)
+		if req.ID.IsZero() {
+			return nil
+		}
+		return h.errorResponse(req.ID, ErrCodeInternalError, "Upstream unavailable: "+err.Error())
+	}
+	if raw == nil {
+		return nil
+	}
+
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return h.errorResponse(req.ID, ErrCodeInternalError, "Invalid upstream response: "+err.Error())
+	}
+
+	out := &RPCResponse{JSONRPC: "2.0", ID: req.ID, Error: resp.Error}
+	if resp.Error == nil {
+		out.Result = resp.Result
+	}
+	return out
+}
+
+func (h *Handler) relayInitialize(sess *Session, req *RPCRequest) *RPCResponse {
+	var init InitializeParams
+	if err := decodeParams(req, &init); err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+	encoding, err := selectEncoding(init.Transport.Encodings)
+	if err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+
+	var sent map[string]interface{}
+	if err := decodeParams(req, &sent); err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+	params := make(map[string]interface{}, len(sent))
+	for k, v := range withoutAuthMeta(sent) {
+		if k != "transport" {
+			params[k] = v
+		}
+	}
+
+	var opts mcpflowclient.Options
+	report := func(error) {}
+	if h.proxyPool != nil {
+		opts, report = h.proxyTarget()
+	} else {
+		opts = *h.cfg.Passthrough
+	}
+	opts.InitializeParams = params
+
+	ctx, cancel := context.WithTimeout(context.Background(), passthroughConnectTimeout)
+	defer cancel()
+
+	upstream, err := mcpflowclient.Connect(ctx, opts)
+	report(err)
+	if err != nil {
+		sess.logger.Error("upstream connect failed", "error", err)
+		// The upstream's own refusal (say, an unsupported version) is
+		// passed back as is.
+		if _, ok := mcpflowerr.CodeOf(err); ok {
+			return h.toolErrorResponse(req.ID, err)
+		}
+		return h.errorResponse(req.ID, ErrCodeInternalError, "Upstream unavailable: "+err.Error())
+	}
+	sess.setUpstream(upstream)
+	sess.setEncoding(encoding)
+
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(upstream.InitializeResult(), &result); err != nil {
+		return h.errorResponse(req.ID, ErrCodeInternalError, "Invalid upstream initialize result: "+err.Error())
+	}
+	if version, ok := result["protocolVersion"].(string); ok {
+		sess.setProtocolVersion(version)
+	}
+	result["transport"] = h.transportInfo(encoding)
+
+	return &RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// =============================================================================
+// Server Pings
+// =============================================================================
+
+// With Config.PingInterval set, a framed session whose client has sent
+// nothing for the interval is sent a ping request, and the time until the
+// client's reply is its round-trip time. Unlike the QUIC RTT, it includes
+// the client's own handling, and it is measured on TCP+TLS, WebSocket, and
+// stdio sessions too. Server.Stats reports it per session, smoothed the way
+// TCP smooths its RTT estimate. An idle client is pinged once per interval,
+// and only once it has answered the previous ping.
+
+// rttGain weighs a new sample into the smoothed RTT.
+const rttGain = 0.125
+
+// pingIdle pings the client each time it has been idle for the interval,
+// until stop is closed.
+func (s *Session) pingIdle(out *sessionWriter, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if last := s.lastActive.Load(); last == 0 || time.Since(time.Unix(0, last)) < interval {
+			continue
+		}
+		if err := s.ping(out, interval); err != nil {
+			s.logger.Debug("ping failed", "error", err)
+			return
+		}
+	}
+}
+
+// ping sends a ping request unless one is awaiting its reply or was sent
+// within the interval.
+func (s *Session) ping(out *sessionWriter, interval time.Duration) error {
+	s.mu.Lock()
+	if !s.pingID.IsZero() || time.Since(s.pingSent) < interval {
+		s.mu.Unlock()
+		return nil
+	}
+	s.pings++
+	id := StringID(fmt.Sprintf("$ping-%d", s.pings))
+	s.pingID, s.pingSent = id, time.Now()
+	s.mu.Unlock()
+
+	frame, err := s.codec.Encode(&RPCRequest{JSONRPC: "2.0", ID: id, Method: "ping"})
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(frame); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// handleReply takes a response from the client, which can only answer a
+// ping, and records the round trip. Anything else is logged and dropped.
+func (s *Session) handleReply(req *RPCRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pingID.IsZero() || req.ID != s.pingID {
+		s.logger.Debug("dropped unexpected response", "id", req.ID)
+		return
+	}
+	sample := time.Since(s.pingSent)
+	s.pingID = ""
+	if s.rtt == 0 {
+		s.rtt = sample
+	} else {
+		s.rtt += time.Duration(rttGain * float64(sample-s.rtt))
+	}
+}
+
+// isReply reports whether req is a response rather than a request.
+func isReply(req *RPCRequest) bool {
+	return req.Method == "" && !req.ID.IsZero()
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+)
+
+// =============================================================================
+// Tool Plugins
+// =============================================================================
+
+const (
+	// pluginToolsSymbol is the function a tool plugin exports.
+	pluginToolsSymbol = "Tools"
+	// toolsDirPollInterval is how often WatchToolsDir looks for changed
+	// plugins.
+	toolsDirPollInterval = time.Second
+)
+
+// loadPlugin opens a Go plugin and returns the tools its Tools function
+// provides.
+func loadPlugin(path string) (StaticTools, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(pluginToolsSymbol)
+	if err != nil {
+		return nil, err
+	}
+	tools, ok := sym.(func() []mcpflow.Tool)
+	if !ok {
+		return nil, fmt.Errorf("%s is %T, want func() []mcpflow.Tool", pluginToolsSymbol, sym)
+	}
+	return StaticTools(tools()), nil
+}
+
+// loadPluginCopy loads a private copy of the plugin at path. plugin.Open
+// returns the plugin it already opened for a path, so a rebuilt file must
+// be opened under a new name; the copy also keeps the loaded code safe from
+// a build that rewrites the file in place. The copy is removed once open,
+// which the mapping outlives.
+func loadPluginCopy(path string) (StaticTools, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp("", "mcpflow-plugin-*.so")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dst.Name())
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return loadPlugin(dst.Name())
+}
+
+// loadToolFile returns the tools of a Go plugin (.so) or WASM tool module
+// (.wasm).
+func (h *Handler) loadToolFile(path string) (StaticTools, error) {
+	if filepath.Ext(path) == ".wasm" {
+		return loadWASMTools(path, h.cfg.WASMMaxMemory, h.cfg.WASMTimeout)
+	}
+	return loadPlugin(path)
+}
+
+// LoadToolsDir registers the tools of every Go plugin (*.so) and WASM tool
+// module (*.wasm) in dir, each under a namespace named after its file:
+// weather.so or weather.wasm serves weather.forecast and so on. Plugins
+// cannot be unloaded, so a plugin already registered must not be loaded
+// again; WatchToolsDir handles reloading.
+func (h *Handler) LoadToolsDir(dir string, logger *slog.Logger) error {
+	var paths []string
+	for _, pattern := range []string{"*.so", "*.wasm"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		tools, err := h.loadToolFile(path)
+		if err != nil {
+			return fmt.Errorf("plugin %s: %w", path, err)
+		}
+		if err := h.RegisterNamespace(name, tools); err != nil {
+			return fmt.Errorf("plugin %s: %w", path, err)
+		}
+		logger.Info("loaded tool plugin", "namespace", name, "tools", len(tools))
+	}
+	return nil
+}
+
+// WatchToolsDir loads dir like LoadToolsDir, then polls it until ctx is
+// done: a plugin or WASM module added to the directory is registered, a
+// removed one is unregistered, and a rebuilt one replaces its namespace's
+// tools, after which sessions are sent notifications/tools/list_changed. A
+// file that fails to load keeps serving its previous build. The code of
+// replaced and removed Go plugins stays in memory, since Go cannot unload
+// it.
+func (h *Handler) WatchToolsDir(ctx context.Context, dir string, logger *slog.Logger) error {
+	w := &toolsDirWatcher{handler: h, dir: dir, logger: logger, plugins: make(map[string]*watchedPlugin), tried: make(map[string]fileStamp)}
+	if _, err := w.reload(true); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(toolsDirPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			changed, err := w.reload(false)
+			if err != nil {
+				logger.Warn("tool plugins reload failed", "dir", dir, "error", err)
+			}
+			if changed {
+				h.NotifyToolsListChanged()
+			}
+		}
+	}()
+	return nil
+}
+
+type toolsDirWatcher struct {
+	handler *Handler
+	dir     string
+	logger  *slog.Logger
+	plugins map[string]*watchedPlugin
+	// tried records the last version of each file loaded or attempted, so
+	// a broken build is not retried until it changes.
+	tried map[string]fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchedPlugin is one plugin file's namespace. Replacing the tools in
+// place, rather than re-registering, means the namespace never goes missing
+// while a rebuild is loaded.
+type watchedPlugin struct {
+	mu    sync.RWMutex
+	tools StaticTools
+}
+
+// Tools returns the tools of the plugin's latest good build.
+func (p *watchedPlugin) Tools() []Tool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.tools
+}
+
+// reload brings the registered namespaces in line with the directory and
+// reports whether any changed. With strict, any plugin that fails to load
+// or register fails the reload; otherwise it is logged and skipped.
+func (w *toolsDirWatcher) reload(strict bool) (bool, error) {
+	var paths []string
+	for _, pattern := range []string{"*.so", "*.wasm"} {
+		matches, err := filepath.Glob(filepath.Join(w.dir, pattern))
+		if err != nil {
+			return false, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	changed := false
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		seen[path] = true
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+		if w.tried[path] == stamp {
+			continue
+		}
+		w.tried[path] = stamp
+
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		var tools StaticTools
+		if filepath.Ext(path) == ".wasm" {
+			tools, err = w.handler.loadToolFile(path)
+		} else {
+			tools, err = loadPluginCopy(path)
+		}
+		p := w.plugins[path]
+		if err == nil && p == nil {
+			p = &watchedPlugin{tools: tools}
+			if err = w.handler.RegisterNamespace(name, p); err == nil {
+				w.plugins[path] = p
+			}
+		}
+		if err != nil {
+			if strict {
+				return false, fmt.Errorf("plugin %s: %w", path, err)
+			}
+			// A rebuild whose package path is unchanged cannot be loaded
+			// into the same process. Plugins built from a file list get a
+			// path hashed from their contents, which avoids that.
+			w.logger.Warn("tool plugin not loaded", "file", path, "error", err)
+			continue
+		}
+
+		p.mu.Lock()
+		p.tools = tools
+		p.mu.Unlock()
+		changed = true
+		w.logger.Info("loaded tool plugin", "namespace", name, "tools", len(tools))
+	}
+
+	for path := range w.tried {
+		if seen[path] {
+			continue
+		}
+		delete(w.tried, path)
+		if w.plugins[path] == nil {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		w.handler.UnregisterNamespace(name)
+		delete(w.plugins, path)
+		changed = true
+		w.logger.Info("unloaded tool plugin", "namespace", name)
+	}
+	return changed, nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Backend Pools (load balancing)
+// =============================================================================
+
+const (
+	// defaultHealthInterval is how often pooled backends are probed.
+	defaultHealthInterval = 10 * time.Second
+	// healthCheckTimeout bounds one probe.
+	healthCheckTimeout = 5 * time.Second
+	// ejectAfterFailures consecutive failures, from calls or probes, take a
+	// backend out of rotation.
+	ejectAfterFailures = 3
+	// ejectDuration is how long an ejected backend sits out before it is
+	// given traffic again, unless a probe readmits it sooner.
+	ejectDuration = 30 * time.Second
+)
+
+// errProbeSkipped is returned by a health probe that did not run, for
+// instance because the backend was busy; it leaves the backend's health
+// unchanged.
+var errProbeSkipped = errors.New("probe skipped: backend busy")
+
+// pool spreads work over interchangeable backends by smooth weighted
+// round-robin. Callers own the backends and refer to them by index; the
+// pool only tracks weights and health.
+type pool struct {
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	members []*poolMember
+}
+
+type poolMember struct {
+	label        string
+	weight       int
+	current      int
+	failures     int
+	ejectedUntil time.Time
+}
+
+func newPool(labels []string, weights []int, logger *slog.Logger) *pool {
+	p := &pool{logger: logger}
+	for i, label := range labels {
+		weight := weights[i]
+		if weight < 1 {
+			weight = 1
+		}
+		p.members = append(p.members, &poolMember{label: label, weight: weight})
+	}
+	return p
+}
+
+// pick returns the index of the next backend to use, skipping ejected
+// ones. If every backend is ejected it picks among all of them rather than
+// failing outright, since ejection may be a false alarm.
+func (p *pool) pick() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	candidates := make([]int, 0, len(p.members))
+	for i, m := range p.members {
+		if now.After(m.ejectedUntil) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		for i := range p.members {
+			candidates = append(candidates, i)
+		}
+	}
+
+	best, total := -1, 0
+	for _, i := range candidates {
+		m := p.members[i]
+		m.current += m.weight
+		total += m.weight
+		if best < 0 || m.current > p.members[best].current {
+			best = i
+		}
+	}
+	p.members[best].current -= total
+	return best
+}
+
+// report records the outcome of using backend i. JSON-RPC errors mean the
+// backend answered and count as success.
+func (p *pool) report(i int, err error) {
+	var rpcErr *mcpflowerr.Error
+	healthy := err == nil || errors.As(err, &rpcErr)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m := p.members[i]
+	now := time.Now()
+	ejected := now.Before(m.ejectedUntil)
+
+	if healthy {
+		m.failures = 0
+		if ejected {
+			m.ejectedUntil = time.Time{}
+			p.logger.Info("backend readmitted", "backend", m.label)
+		}
+		return
+	}
+
+	m.failures++
+	if !ejected && m.failures >= ejectAfterFailures {
+		m.ejectedUntil = now.Add(ejectDuration)
+		p.logger.Warn("backend ejected", "backend", m.label, "failures", m.failures, "error", err)
+	}
+}
+
+// runHealthChecks probes every backend each interval until ctx ends,
+// feeding the results into report.
+func (p *pool) runHealthChecks(ctx context.Context, interval time.Duration, probe func(ctx context.Context, i int) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var wg sync.WaitGroup
+		for i := range p.members {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				pctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+				defer cancel()
+				err := probe(pctx, i)
+				if ctx.Err() == nil && !errors.Is(err, errProbeSkipped) {
+					p.report(i, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+	}
+}
+
+// splitWeight parses an optional ",weight=N" suffix on a backend target.
+func splitWeight(target string) (string, int, error) {
+	i := strings.LastIndex(target, ",weight=")
+	if i < 0 {
+		return target, 1, nil
+	}
+	weight, err := strconv.Atoi(target[i+len(",weight="):])
+	if err != nil || weight < 1 {
+		return "", 0, fmt.Errorf("invalid weight in %q", target)
+	}
+	return target[:i], weight, nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+)
+
+// =============================================================================
+// Reverse Proxy (forwarding frames to a backend)
+// =============================================================================
+
+// proxyFrame is the part of a relayed message the proxy looks at. Everything
+// else is forwarded as the original bytes.
+type proxyFrame struct {
+	ID     RequestID `json:"id"`
+	Method string    `json:"method"`
+	Error  *RPCError `json:"error"`
+}
+
+// proxy connects the session to its own stream on the configured backend
+// and copies frames both ways until either side closes. Requests,
+// cancellations, and server-initiated messages pass through with their IDs
+// untouched; the proxy only gates the session on the bearer token, swaps
+// the client's token for the backend's in initialize, and rewrites the
+// transport alternatives in the initialize result to its own.
+func (s *Session) proxy(ctx context.Context, r io.Reader, w *sessionWriter) error {
+	br := bufio.NewReader(r)
+
+	first, err := s.proxyAdmit(br, w)
+	if err != nil || first == nil {
+		return err
+	}
+
+	// Try a second backend before giving up on the session.
+	h := s.handler
+	var (
+		target    UpstreamConfig
+		backend   io.ReadWriteCloser
+		transport string
+	)
+	for attempt := 0; attempt < min(2, len(h.cfg.ProxyBackends)); attempt++ {
+		i := h.proxyPool.pick()
+		target = h.cfg.ProxyBackends[i]
+		backend, transport, err = mcpflowclient.DialStream(ctx, target.Options)
+		h.proxyPool.report(i, err)
+		if err == nil {
+			break
+		}
+		s.logger.Warn("backend connect failed", "backend", target.Name, "error", err)
+	}
+	if err != nil {
+		var msg proxyFrame
+		if json.Unmarshal(first, &msg) == nil && !msg.ID.IsZero() {
+			s.writeProxyResponse(w, s.handler.errorResponse(msg.ID, ErrCodeInternalError, "Backend unavailable: "+err.Error()))
+		}
+		return nil
+	}
+	defer backend.Close()
+	s.logger.Info("backend connected", "backend", target.Name, "transport", transport)
+
+	var (
+		initMu  sync.Mutex
+		initIDs = map[RequestID]bool{}
+	)
+
+	errCh := make(chan error, 2)
+
+	go func() {
+		frame := first
+		for {
+			var msg proxyFrame
+			if err := json.Unmarshal(frame, &msg); err == nil && msg.Method != "" {
+				s.logger.Debug("received", "method", msg.Method, "id", msg.ID)
+				s.handler.metrics.ObserveRequest(msg.Method)
+				if msg.Method == "initialize" {
+					frame = proxyInitialize(frame, target.Options.Token)
+					initMu.Lock()
+					initIDs[s.correlationKey(msg.ID)] = true
+					initMu.Unlock()
+				}
+			}
+
+			if err := writeRawFrame(backend, frame); err != nil {
+				errCh <- fmt.Errorf("backend write: %w", err)
+				return
+			}
+
+			var err error
+			if frame, err = readRawFrame(br); err != nil {
+				errCh <- err
+				return
+			}
+		}
+	}()
+
+	go func() {
+		bbr := bufio.NewReader(backend)
+		for {
+			frame, err := readRawFrame(bbr)
+			if err != nil {
+				errCh <- fmt.Errorf("backend read: %w", err)
+				return
+			}
+
+			var msg proxyFrame
+			if err := json.Unmarshal(frame, &msg); err == nil && msg.Method == "" && !msg.ID.IsZero() {
+				if msg.Error != nil {
+					s.handler.metrics.ObserveError(msg.Error.Code)
+				}
+				initMu.Lock()
+				key := s.correlationKey(msg.ID)
+				isInit := initIDs[key]
+				delete(initIDs, key)
+				initMu.Unlock()
+				if isInit && msg.Error == nil {
+					frame = s.handler.proxyInitializeResult(frame)
+				}
+			}
+
+			err = writeRawFrame(w, frame)
+			if err == nil && bbr.Buffered() == 0 {
+				err = w.Flush()
+			}
+			if err != nil {
+				errCh <- fmt.Errorf("write: %w", err)
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errCh:
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+}
+
+// proxyAdmit returns the first frame to forward. A session waiting for its
+// bearer token is answered locally until an initialize carries it, so
+// unauthenticated clients never reach the backend.
+func (s *Session) proxyAdmit(br *bufio.Reader, w *sessionWriter) ([]byte, error) {
+	for {
+		frame, err := readRawFrame(br)
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if !s.authPending() {
+			return frame, nil
+		}
+
+		var req RPCRequest
+		if err := json.Unmarshal(frame, &req); err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+		if s.handler.authorize(s, &req) {
+			return frame, nil
+		}
+
+		s.handler.metrics.ObserveRequest(req.Method)
+		if resp := s.handler.unauthorizedResponse(&req); resp != nil {
+			s.handler.metrics.ObserveError(resp.Error.Code)
+			if err := s.writeProxyResponse(w, resp); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (s *Session) writeProxyResponse(w *sessionWriter, resp *RPCResponse) error {
+	frame, err := s.codec.Encode(resp)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(frame); err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+// proxyInitialize replaces the client's bearer token in an initialize with
+// the backend's, for backends that take it from _meta, and drops any ask
+// for sequenced frames, which the proxy relays without reading. Frames
+// that cannot be rewritten are forwarded as they are.
+func proxyInitialize(frame []byte, token string) []byte {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		return frame
+	}
+	params, _ := msg["params"].(map[string]interface{})
+	if params == nil {
+		return frame
+	}
+
+	params = withoutAuthMeta(params)
+	if transport, ok := params["transport"].(map[string]interface{}); ok {
+		delete(transport, "sequenceNumbers")
+	}
+	if token != "" {
+		meta := map[string]interface{}{}
+		if existing, ok := params["_meta"].(map[string]interface{}); ok {
+			for k, v := range existing {
+				meta[k] = v
+			}
+		}
+		meta[authMetaKey] = "Bearer " + token
+		params["_meta"] = meta
+	}
+	msg["params"] = params
+
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return frame
+	}
+	return out
+}
+
+// proxyInitializeResult advertises the proxy's own fallback listeners in
+// place of the backend's, which clients cannot reach directly.
+func (h *Handler) proxyInitializeResult(frame []byte) []byte {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		return frame
+	}
+	result, _ := msg["result"].(map[string]interface{})
+	transport, _ := result["transport"].(map[string]interface{})
+	if transport == nil {
+		return frame
+	}
+
+	delete(transport, "alternatives")
+	if alts := h.cfg.transportAlternatives(); len(alts) > 0 {
+		transport["alternatives"] = alts
+	}
+
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return frame
+	}
+	return out
+}
+
+// readRawFrame reads one length-prefixed frame body without decoding it.
+func readRawFrame(r io.Reader) ([]byte, error) {
+	var lengthBuf [4]byte
+	if _, err := io.ReadFull(r, lengthBuf[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(lengthBuf[:])
+	if length > maxFrameSize {
+		return nil, fmt.Errorf("frame size %d exceeds maximum %d", length, maxFrameSize)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	return body, nil
+}
+
+func writeRawFrame(w io.Writer, body []byte) error {
+	frame := make([]byte, 4+len(body))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(body)))
+	copy(frame[4:], body)
+	_, err := w.Write(frame)
+	return err
+}
+
+// parseProxyBackend parses a -proxy target: flow://host:port,
+// tcp://host:port, or wss://host:port/path, the framed transports that can
+// carry a spliced session, with an optional ",weight=N".
+func parseProxyBackend(target string) (UpstreamConfig, error) {
+	u, err := parseUpstream("backend=" + target)
+	if err != nil {
+		return UpstreamConfig{}, fmt.Errorf("proxy %q: unsupported target", target)
+	}
+	switch u.Options.Order[0] {
+	case mcpflowclient.TransportWebTransport, mcpflowclient.TransportTCP, mcpflowclient.TransportWebSocket:
+		u.Name = endpointLabel(u.Options)
+		return u, nil
+	}
+	return UpstreamConfig{}, fmt.Errorf("proxy %q: backend must be flow://, tcp://, or wss://", target)
+}
+
+// proxyFlags collects repeated -proxy flags into a backend pool.
+type proxyFlags []UpstreamConfig
+
+func (f *proxyFlags) String() string {
+	names := make([]string, len(*f))
+	for i, b := range *f {
+		names[i] = b.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *proxyFlags) Set(target string) error {
+	b, err := parseProxyBackend(target)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, b)
+	return nil
+}
+
+// proxyTarget picks the backend for a relayed session and returns a func
+// to report how connecting to it went.
+func (h *Handler) proxyTarget() (mcpflowclient.Options, func(error)) {
+	i := h.proxyPool.pick()
+	return h.cfg.ProxyBackends[i].Options, func(err error) { h.proxyPool.report(i, err) }
+}
+
+// runHealthChecks probes pooled gateway upstreams and proxy backends each
+// interval until ctx ends. A proxy backend is probed with a short session
+// that initializes and pings.
+func (h *Handler) runHealthChecks(ctx context.Context, interval time.Duration) {
+	if h.gateway != nil {
+		h.gateway.runHealthChecks(ctx, interval)
+	}
+	if h.proxyPool == nil || len(h.cfg.ProxyBackends) < 2 {
+		return
+	}
+	go h.proxyPool.runHealthChecks(ctx, interval, func(ctx context.Context, i int) error {
+		c, err := mcpflowclient.Connect(ctx, h.cfg.ProxyBackends[i].Options)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return c.Call(ctx, "ping", nil, nil)
+	})
+}
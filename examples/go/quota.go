@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Tenant Quotas and Usage
+// =============================================================================
+
+// defaultQuotaWindow is the accounting period when a quota sets none.
+const defaultQuotaWindow = 24 * time.Hour
+
+// TenantQuota caps what a tenant may use in each accounting window. Zero
+// limits are unlimited.
+type TenantQuota struct {
+	// Window is the accounting period. Windows are aligned to multiples of
+	// it (a 24h window resets at midnight UTC); zero means 24h.
+	Window time.Duration
+	// Requests caps the messages handled.
+	Requests int64
+	// ToolTime caps the total time spent in tools/call.
+	ToolTime time.Duration
+	// Bytes caps the JSON-encoded size of messages in and out.
+	Bytes int64
+}
+
+func (q TenantQuota) window() time.Duration {
+	if q.Window <= 0 {
+		return defaultQuotaWindow
+	}
+	return q.Window
+}
+
+// UsageLimits is a TenantQuota as reported by the admin API.
+type UsageLimits struct {
+	Requests    int64   `json:"requests,omitempty"`
+	ToolSeconds float64 `json:"toolSeconds,omitempty"`
+	Bytes       int64   `json:"bytes,omitempty"`
+}
+
+// TenantUsage is a tenant's consumption in the current window.
+type TenantUsage struct {
+	Tenant      string    `json:"tenant"`
+	WindowStart time.Time `json:"windowStart"`
+	WindowEnd   time.Time `json:"windowEnd"`
+	Sessions    int       `json:"sessions"`
+	Requests    int64     `json:"requests"`
+	ToolCalls   int64     `json:"toolCalls"`
+	ToolSeconds float64   `json:"toolSeconds"`
+	BytesIn     int64     `json:"bytesIn"`
+	BytesOut    int64     `json:"bytesOut"`
+	// Rejected counts requests refused because a quota was used up.
+	Rejected int64       `json:"rejected"`
+	Limits   UsageLimits `json:"limits"`
+}
+
+// tenantUsage holds the counters of the current window. The tenantState
+// mutex guards it.
+type tenantUsage struct {
+	windowStart time.Time
+	requests    int64
+	toolCalls   int64
+	toolTime    time.Duration
+	bytesIn     int64
+	bytesOut    int64
+	rejected    int64
+}
+
+// rollLocked starts a new window once the current one has ended.
+func (t *tenantState) rollLocked(now time.Time) {
+	window := t.quota.window()
+	if start := now.Truncate(window); !start.Equal(t.usage.windowStart) {
+		t.usage = tenantUsage{windowStart: start}
+	}
+}
+
+// checkQuota returns a quota-exceeded error, retryable when the window
+// resets, if any of the tenant's limits is used up.
+func (t *tenantState) checkQuota(now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollLocked(now)
+
+	q, u := t.quota, &t.usage
+	var exhausted string
+	switch {
+	case q.Requests > 0 && u.requests >= q.Requests:
+		exhausted = fmt.Sprintf("request quota of %d", q.Requests)
+	case q.ToolTime > 0 && u.toolTime >= q.ToolTime:
+		exhausted = fmt.Sprintf("tool time quota of %s", q.ToolTime)
+	case q.Bytes > 0 && u.bytesIn+u.bytesOut >= q.Bytes:
+		exhausted = fmt.Sprintf("transfer quota of %d bytes", q.Bytes)
+	default:
+		return nil
+	}
+
+	u.rejected++
+	reset := u.windowStart.Add(q.window())
+	return mcpflowerr.QuotaExceeded("tenant %q used its %s", t.name, exhausted).
+		WithRetryAfter(reset.Sub(now)).
+		WithDetail("resetAt", reset.UTC().Format(time.RFC3339))
+}
+
+// account charges a handled message to the tenant.
+func (t *tenantState) account(req *RPCRequest, resp *RPCResponse, elapsed time.Duration) {
+	in, out := jsonSize(req), 0
+	if resp != nil {
+		out = jsonSize(resp)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollLocked(time.Now())
+	t.usage.requests++
+	t.usage.bytesIn += int64(in)
+	t.usage.bytesOut += int64(out)
+	if req.Method == "tools/call" {
+		t.usage.toolCalls++
+		t.usage.toolTime += elapsed
+	}
+}
+
+func (t *tenantState) snapshot() TenantUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rollLocked(time.Now())
+
+	u := t.usage
+	return TenantUsage{
+		Tenant:      t.name,
+		WindowStart: u.windowStart.UTC(),
+		WindowEnd:   u.windowStart.Add(t.quota.window()).UTC(),
+		Sessions:    t.sessions,
+		Requests:    u.requests,
+		ToolCalls:   u.toolCalls,
+		ToolSeconds: u.toolTime.Seconds(),
+		BytesIn:     u.bytesIn,
+		BytesOut:    u.bytesOut,
+		Rejected:    u.rejected,
+		Limits: UsageLimits{
+			Requests:    t.quota.Requests,
+			ToolSeconds: t.quota.ToolTime.Seconds(),
+			Bytes:       t.quota.Bytes,
+		},
+	}
+}
+
+func jsonSize(v interface{}) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// handleMetered serves req for a tenant, charging it to the tenant's usage
+// and refusing requests once a quota is used up. initialize is always
+// admitted so clients learn about the quota from the error on their first
+// real call.
+func (h *Handler) handleMetered(sess *Session, req *RPCRequest) *RPCResponse {
+	t := h.tenant
+	if !req.ID.IsZero() && req.Method != "initialize" {
+		if err := t.checkQuota(time.Now()); err != nil {
+			return h.toolErrorResponse(req.ID, err)
+		}
+	}
+
+	start := time.Now()
+	resp := h.handleCached(sess, req)
+	t.account(req, resp, time.Since(start))
+	return resp
+}
+
+// TenantUsage reports the named tenant's usage in the current window.
+func (s *Server) TenantUsage(name string) (TenantUsage, bool) {
+	h := s.Tenant(name)
+	if h == nil {
+		return TenantUsage{}, false
+	}
+	return h.tenant.snapshot(), true
+}
+
+// Usage reports every tenant's usage in the current window, by name.
+func (s *Server) Usage() []TenantUsage {
+	usage := make([]TenantUsage, 0, len(s.handler.tenants))
+	for _, h := range s.handler.tenants {
+		usage = append(usage, h.tenant.snapshot())
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Tenant < usage[j].Tenant })
+	return usage
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Redis Session Store
+// =============================================================================
+
+// redisTimeout bounds each exchange with the Redis server.
+const redisTimeout = 5 * time.Second
+
+// RedisSessionStore is a SessionStore shared through a Redis server, so any
+// instance behind a load balancer can serve any session. State is stored as
+// JSON under <prefix>session:<id> and queued notifications in the list
+// <prefix>pending:<id>, both expiring with the session. Sequenced
+// notifications are kept in the sorted set <prefix>outbox:<id>, scored by
+// their number, with the last number handed out in <prefix>seq:<id>.
+type RedisSessionStore struct {
+	conn   *redisConn
+	prefix string
+}
+
+// NewRedisSessionStore connects to the server named by rawURL, of the form
+// redis[s]://[[user]:password@]host:port[/db]. Keys are prefixed with
+// prefix.
+func NewRedisSessionStore(rawURL, prefix string) (*RedisSessionStore, error) {
+	c, err := newRedisConn(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisSessionStore{conn: c, prefix: prefix}, nil
+}
+
+func (s *RedisSessionStore) stateKey(id string) string   { return s.prefix + "session:" + id }
+func (s *RedisSessionStore) pendingKey(id string) string { return s.prefix + "pending:" + id }
+func (s *RedisSessionStore) outboxKey(id string) string  { return s.prefix + "outbox:" + id }
+func (s *RedisSessionStore) seqKey(id string) string     { return s.prefix + "seq:" + id }
+
+// Load implements SessionStore.
+func (s *RedisSessionStore) Load(id string) (*SessionState, error) {
+	reply, err := s.conn.do("GET", s.stateKey(id))
+	if err != nil {
+		return nil, err
+	}
+	body, ok := reply.([]byte)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	var state SessionState
+	if err := json.Unmarshal(body, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Save implements SessionStore.
+func (s *RedisSessionStore) Save(id string, state *SessionState, ttl time.Duration) error {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	px := strconv.FormatInt(ttl.Milliseconds(), 10)
+	_, err = s.conn.pipeline(
+		[]string{"SET", s.stateKey(id), string(body), "PX", px},
+		[]string{"PEXPIRE", s.pendingKey(id), px},
+		[]string{"PEXPIRE", s.outboxKey(id), px},
+		[]string{"PEXPIRE", s.seqKey(id), px},
+	)
+	return err
+}
+
+// Delete implements SessionStore.
+func (s *RedisSessionStore) Delete(id string) error {
+	_, err := s.conn.do("DEL", s.stateKey(id), s.pendingKey(id), s.outboxKey(id), s.seqKey(id))
+	return err
+}
+
+// Push implements SessionStore.
+func (s *RedisSessionStore) Push(id string, msg []byte, ttl time.Duration) error {
+	_, err := s.conn.pipeline(
+		[]string{"RPUSH", s.pendingKey(id), string(msg)},
+		[]string{"PEXPIRE", s.pendingKey(id), strconv.FormatInt(ttl.Milliseconds(), 10)},
+	)
+	return err
+}
+
+// Drain implements SessionStore. The read and delete run in one
+// transaction, so two instances never deliver the same notification.
+func (s *RedisSessionStore) Drain(id string) ([][]byte, error) {
+	replies, err := s.conn.pipeline(
+		[]string{"MULTI"},
+		[]string{"LRANGE", s.pendingKey(id), "0", "-1"},
+		[]string{"ZRANGE", s.outboxKey(id), "0", "-1"},
+		[]string{"DEL", s.pendingKey(id), s.outboxKey(id)},
+		[]string{"EXEC"},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	exec, _ := replies[len(replies)-1].([]interface{})
+	if len(exec) < 2 {
+		return nil, nil
+	}
+	for _, reply := range exec {
+		if err, ok := reply.(redisError); ok {
+			return nil, err
+		}
+	}
+	return append(redisMessages(exec[0]), redisMessages(exec[1])...), nil
+}
+
+// PushSeq implements AckSessionStore.
+func (s *RedisSessionStore) PushSeq(id string, encode func(seq uint64) ([]byte, error), ttl time.Duration) error {
+	reply, err := s.conn.do("INCR", s.seqKey(id))
+	if err != nil {
+		return err
+	}
+	seq, _ := reply.(int64)
+	msg, err := encode(uint64(seq))
+	if err != nil {
+		return err
+	}
+	px := strconv.FormatInt(ttl.Milliseconds(), 10)
+	_, err = s.conn.pipeline(
+		[]string{"ZADD", s.outboxKey(id), strconv.FormatInt(seq, 10), string(msg)},
+		[]string{"PEXPIRE", s.outboxKey(id), px},
+		[]string{"PEXPIRE", s.seqKey(id), px},
+	)
+	return err
+}
+
+// Unacked implements AckSessionStore.
+func (s *RedisSessionStore) Unacked(id string) ([][]byte, error) {
+	reply, err := s.conn.do("ZRANGE", s.outboxKey(id), "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+	return redisMessages(reply), nil
+}
+
+// Ack implements AckSessionStore.
+func (s *RedisSessionStore) Ack(id string, seq uint64) error {
+	_, err := s.conn.do("ZREMRANGEBYSCORE", s.outboxKey(id), "-inf", strconv.FormatUint(seq, 10))
+	return err
+}
+
+// StateStore returns a StateStore sharing the store's connection, so
+// session state follows Streamable HTTP sessions across instances.
+func (s *RedisSessionStore) StateStore() *RedisStateStore {
+	return &RedisStateStore{conn: s.conn, prefix: s.prefix}
+}
+
+// RedisStateStore is a StateStore in Redis. Each value is stored under
+// <prefix>state:<scope>:<key> with its own expiry, and the set
+// <prefix>statekeys:<scope> indexes a scope's keys for Clear.
+type RedisStateStore struct {
+	conn   *redisConn
+	prefix string
+}
+
+func (s *RedisStateStore) valueKey(scope, key string) string {
+	return s.prefix + "state:" + scope + ":" + key
+}
+func (s *RedisStateStore) indexKey(scope string) string { return s.prefix + "statekeys:" + scope }
+
+// Get implements StateStore.
+func (s *RedisStateStore) Get(scope, key string) ([]byte, bool, error) {
+	reply, err := s.conn.do("GET", s.valueKey(scope, key))
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	return value, ok, nil
+}
+
+// Set implements StateStore.
+func (s *RedisStateStore) Set(scope, key string, value []byte, ttl time.Duration) error {
+	px := strconv.FormatInt(ttl.Milliseconds(), 10)
+	_, err := s.conn.pipeline(
+		[]string{"SET", s.valueKey(scope, key), string(value), "PX", px},
+		[]string{"SADD", s.indexKey(scope), key},
+		[]string{"PEXPIRE", s.indexKey(scope), px},
+	)
+	return err
+}
+
+// Delete implements StateStore.
+func (s *RedisStateStore) Delete(scope, key string) error {
+	_, err := s.conn.pipeline(
+		[]string{"DEL", s.valueKey(scope, key)},
+		[]string{"SREM", s.indexKey(scope), key},
+	)
+	return err
+}
+
+// Clear implements StateStore. A key whose value outlives the index, set
+// with a longer ttl than the last one, is left to expire on its own.
+func (s *RedisStateStore) Clear(scope string) error {
+	reply, err := s.conn.do("SMEMBERS", s.indexKey(scope))
+	if err != nil {
+		return err
+	}
+	keys := []string{"DEL", s.indexKey(scope)}
+	for _, key := range redisMessages(reply) {
+		keys = append(keys, s.valueKey(scope, string(key)))
+	}
+	_, err = s.conn.do(keys...)
+	return err
+}
+
+// Size implements StateStore, adding up the lengths of the indexed keys
+// and their values.
+func (s *RedisStateStore) Size(scope string) (int, error) {
+	reply, err := s.conn.do("SMEMBERS", s.indexKey(scope))
+	if err != nil {
+		return 0, err
+	}
+	keys := redisMessages(reply)
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	cmds := make([][]string, len(keys))
+	for i, key := range keys {
+		cmds[i] = []string{"STRLEN", s.valueKey(scope, string(key))}
+	}
+	lengths, err := s.conn.pipeline(cmds...)
+	if err != nil {
+		return 0, err
+	}
+	size := 0
+	for i, reply := range lengths {
+		// An expired value's key lingers in the index with length 0.
+		if n, ok := reply.(int64); ok && n > 0 {
+			size += len(keys[i]) + int(n)
+		}
+	}
+	return size, nil
+}
+
+// redisMessages returns the bulk strings in an array reply.
+func redisMessages(reply interface{}) [][]byte {
+	items, _ := reply.([]interface{})
+	msgs := make([][]byte, 0, len(items))
+	for _, item := range items {
+		if msg, ok := item.([]byte); ok {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// =============================================================================
+// RESP Client
+// =============================================================================
+
+// redisError is an error reply from the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// redisConn is a minimal RESP2 client over one connection, redialed after
+// any I/O or protocol failure. Commands are serialized. It authenticates
+// with AUTH, naming the user for Redis 6 ACLs when the URL has one, and
+// speaks TLS for rediss:// URLs, verifying the server against the system
+// roots; it does not support client certificates, RESP3, or Sentinel and
+// Cluster topologies.
+type redisConn struct {
+	addr     string
+	user     string
+	password string
+	db       int
+	tls      bool
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newRedisConn returns a connection to the server named by rawURL, of the
+// form redis[s]://[[user]:password@]host:port[/db], checking that it
+// answers.
+func newRedisConn(rawURL string) (*redisConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis url: %w", err)
+	}
+	if (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("redis url %q: want redis://host:port or rediss://host:port", rawURL)
+	}
+
+	c := &redisConn{addr: u.Host, tls: u.Scheme == "rediss"}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis url %q: invalid database %q", rawURL, db)
+		}
+	}
+
+	// Fail at startup rather than on first use.
+	if _, err := c.do("PING"); err != nil {
+		return nil, fmt.Errorf("redis %s: %w", u.Host, err)
+	}
+	return c, nil
+}
+
+// clone returns an unconnected redisConn to the same server, for a
+// connection of its own such as a subscription.
+func (c *redisConn) clone() *redisConn {
+	return &redisConn{addr: c.addr, user: c.user, password: c.password, db: c.db, tls: c.tls}
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	return c.doContext(context.Background(), args...)
+}
+
+// doContext is do, giving up when ctx is done.
+func (c *redisConn) doContext(ctx context.Context, args ...string) (interface{}, error) {
+	replies, err := c.pipelineContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// pipeline sends cmds in one write and reads their replies in order. An
+// error reply to any command fails the whole pipeline; an error inside an
+// array reply, such as one command of an EXEC, is left to the caller.
+func (c *redisConn) pipeline(cmds ...[]string) ([]interface{}, error) {
+	return c.pipelineContext(context.Background(), cmds...)
+}
+
+// pipelineContext is pipeline, giving up when ctx is done. A pipeline cut
+// short drops the connection, since its replies may still arrive.
+func (c *redisConn) pipelineContext(ctx context.Context, cmds ...[]string) ([]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.conn == nil {
+		if err := c.dialLocked(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	replies, err := c.exchangeLocked(ctx, cmds)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		c.conn = nil
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}
+	return replies, err
+}
+
+func (c *redisConn) dialLocked(ctx context.Context) error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	if c.tls {
+		host, _, _ := net.SplitHostPort(c.addr)
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", c.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	switch {
+	case c.user != "":
+		setup = append(setup, []string{"AUTH", c.user, c.password})
+	case c.password != "":
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) == 0 {
+		return nil
+	}
+	if _, err := c.exchangeLocked(ctx, setup); err != nil {
+		conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+// exchangeLocked writes cmds and reads their replies, within redisTimeout
+// and until ctx is done.
+func (c *redisConn) exchangeLocked(ctx context.Context, cmds [][]string) ([]interface{}, error) {
+	deadline := time.Now().Add(redisTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn := c.conn
+	conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	var buf strings.Builder
+	for _, args := range cmds {
+		fmt.Fprintf(&buf, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := io.WriteString(c.conn, buf.String()); err != nil {
+		return nil, err
+	}
+
+	// Read every reply even after an error reply, to keep the connection
+	// in step.
+	replies := make([]interface{}, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		reply, err := readRESP(c.r)
+		var replyErr redisError
+		if err != nil && !errors.As(err, &replyErr) {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// readRESP reads one reply: simple strings as string, integers as int64,
+// bulk strings as []byte, arrays as []interface{}, and nil for null. An
+// error reply is returned as a redisError error, except inside an array,
+// where it is kept as a redisError element so the whole array is read.
+// Any other error means the stream is out of step and the connection
+// must be dropped.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		body := make([]byte, n+2)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, err
+		}
+		if body[n] != '\r' || body[n+1] != '\n' {
+			return nil, fmt.Errorf("redis: bulk string of %d bytes not terminated by CRLF", n)
+		}
+		return body[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readRESP(r)
+			var replyErr redisError
+			if errors.As(err, &replyErr) {
+				items[i] = replyErr
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
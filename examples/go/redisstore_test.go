@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRESP(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    interface{}
+		wantErr string // substring; "" means no error
+	}{
+		{"simple string", "+OK\r\n", "OK", ""},
+		{"integer", ":42\r\n", int64(42), ""},
+		{"negative integer", ":-7\r\n", int64(-7), ""},
+		{"bulk string", "$5\r\nhello\r\n", []byte("hello"), ""},
+		{"empty bulk string", "$0\r\n\r\n", []byte{}, ""},
+		{"bulk string with CRLF inside", "$4\r\na\r\nb\r\n", []byte("a\r\nb"), ""},
+		{"null bulk string", "$-1\r\n", nil, ""},
+		{"null array", "*-1\r\n", nil, ""},
+		{"empty array", "*0\r\n", []interface{}{}, ""},
+		{"array", "*3\r\n$3\r\nfoo\r\n:1\r\n+bar\r\n", []interface{}{[]byte("foo"), int64(1), "bar"}, ""},
+		{"nested array", "*2\r\n*1\r\n:1\r\n$-1\r\n", []interface{}{[]interface{}{int64(1)}, nil}, ""},
+		{
+			"error inside array",
+			"*3\r\n+OK\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n:2\r\n",
+			[]interface{}{"OK", redisError("WRONGTYPE Operation against a key holding the wrong kind of value"), int64(2)},
+			"",
+		},
+		{"error reply", "-ERR unknown command\r\n", nil, "ERR unknown command"},
+		{"empty line", "\r\n", nil, "empty reply"},
+		{"unknown type", "%2\r\n", nil, "unexpected reply"},
+		{"malformed integer", ":x\r\n", nil, "malformed"},
+		{"malformed bulk length", "$x\r\n", nil, "malformed"},
+		{"malformed array length", "*x\r\n", nil, "malformed"},
+		{"short bulk string", "$5\r\nhi\r\n", nil, "EOF"},
+		{"unterminated bulk string", "$2\r\nhiXY", nil, "not terminated"},
+		{"truncated array", "*2\r\n:1\r\n", nil, "EOF"},
+		{"truncated line", "+OK", nil, "EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readRESP(bufio.NewReader(strings.NewReader(tt.input)))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readRESP(%q) error = %v, want one containing %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readRESP(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readRESP(%q) = %#v, want %#v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// An error reply, at the top level or inside an array, must leave the
+// reader at the start of the next reply, since the connection is kept.
+func TestReadRESPStaysInStep(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader(
+		"-ERR first\r\n" +
+			"*2\r\n-WRONGTYPE second\r\n$4\r\nnext\r\n" +
+			"+PONG\r\n"))
+
+	_, err := readRESP(r)
+	var replyErr redisError
+	if !errors.As(err, &replyErr) {
+		t.Fatalf("first reply: error = %v, want a redisError", err)
+	}
+	exec, err := readRESP(r)
+	if err != nil {
+		t.Fatalf("second reply: %v", err)
+	}
+	want := []interface{}{redisError("WRONGTYPE second"), []byte("next")}
+	if !reflect.DeepEqual(exec, want) {
+		t.Fatalf("second reply = %#v, want %#v", exec, want)
+	}
+	pong, err := readRESP(r)
+	if err != nil || pong != "PONG" {
+		t.Fatalf("third reply = %#v, %v; want \"PONG\"", pong, err)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Service Registry (self-registration)
+// =============================================================================
+
+const (
+	// registryTTL is how long a registration outlives the last refresh, so
+	// a crashed server drops out of the registry on its own.
+	registryTTL = 30 * time.Second
+	// registryRefresh is how often the registration is renewed and the
+	// record rebuilt.
+	registryRefresh = 10 * time.Second
+	// registryTimeout bounds each call to the registry.
+	registryTimeout = 5 * time.Second
+	// registryServiceName is the service name servers register under.
+	registryServiceName = "mcp-flow"
+)
+
+// ServiceRecord describes a running server to a service registry, with
+// enough for a gateway to pick compatible backends and notice catalog
+// changes without connecting.
+type ServiceRecord struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Addr is the WebTransport host:port; TCPAddr the TCP+TLS fallback.
+	Addr    string `json:"addr"`
+	TCPAddr string `json:"tcpAddr,omitempty"`
+	// MCPFlowVersion is the transport binding version and ProtocolVersions
+	// the MCP revisions the server negotiates.
+	MCPFlowVersion   string   `json:"mcpflowVersion"`
+	ProtocolVersions []string `json:"protocolVersions"`
+	// CatalogHash changes whenever the tool catalog does.
+	CatalogHash string `json:"catalogHash"`
+	Healthy     bool   `json:"healthy"`
+}
+
+// Registrar publishes ServiceRecords in a service registry. Implementations
+// must expire a record that is not refreshed within its TTL.
+type Registrar interface {
+	// Register publishes rec, replacing any earlier record with the same ID.
+	Register(ctx context.Context, rec ServiceRecord, ttl time.Duration) error
+	// Refresh keeps rec registered for another TTL. An error makes the
+	// caller register it again.
+	Refresh(ctx context.Context, rec ServiceRecord) error
+	// Deregister removes the record with the given ID.
+	Deregister(ctx context.Context, id string) error
+}
+
+// NewRegistrar returns the Registrar for a registry URL:
+// consul://host:8500 for a Consul agent (token from $CONSUL_HTTP_TOKEN) or
+// etcd://host:2379 for etcd's v3 JSON API. Records are kept under prefix in
+// etcd.
+func NewRegistrar(rawURL, prefix string) (Registrar, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("registry url: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("registry url %q: want consul://host:port or etcd://host:port", rawURL)
+	}
+	client := &http.Client{Timeout: registryTimeout}
+	switch u.Scheme {
+	case "consul":
+		return &consulRegistrar{base: "http://" + u.Host, token: os.Getenv("CONSUL_HTTP_TOKEN"), client: client}, nil
+	case "etcd":
+		return &etcdRegistrar{etcdClient: etcdClient{base: "http://" + u.Host, client: client}, prefix: prefix, leases: make(map[string]string)}, nil
+	}
+	return nil, fmt.Errorf("registry url %q: unsupported scheme %q", rawURL, u.Scheme)
+}
+
+// serviceRecord describes this server as it is now.
+func (s *Server) serviceRecord() ServiceRecord {
+	host, port, _ := net.SplitHostPort(s.addr)
+	advertise := s.cfg.AdvertiseHost
+	if advertise == "" {
+		advertise = host
+	}
+	if advertise == "" {
+		advertise, _ = os.Hostname()
+	}
+
+	rec := ServiceRecord{
+		ID:               advertise + ":" + port,
+		Name:             registryServiceName,
+		Addr:             net.JoinHostPort(advertise, port),
+		MCPFlowVersion:   mcpFlowVersion,
+		ProtocolVersions: supportedProtocolVersions,
+		CatalogHash:      s.handler.catalogHash(),
+		Healthy:          !s.handler.drain.isDraining(),
+	}
+	if tcpPort, ok := listenPort(s.cfg.TCPAddr); ok {
+		rec.TCPAddr = net.JoinHostPort(advertise, strconv.Itoa(tcpPort))
+	}
+	return rec
+}
+
+// catalogHash fingerprints the tool catalog, ignoring listing order.
+func (h *Handler) catalogHash() string {
+	tools := h.toolCatalog(true)
+	sort.Slice(tools, func(i, j int) bool {
+		return fmt.Sprint(tools[i]["name"]) < fmt.Sprint(tools[j]["name"])
+	})
+	body, _ := json.Marshal(tools)
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// runRegistration keeps this server registered until ctx ends, then
+// deregisters it. The record is rebuilt on every refresh and registered
+// again when it changes, such as after a catalog update.
+func (s *Server) runRegistration(ctx context.Context) {
+	logger := s.logger.With("component", "registry")
+	reg := s.cfg.Registrar
+
+	var current ServiceRecord
+	registered := false
+	update := func() {
+		rec := s.serviceRecord()
+		rctx, cancel := context.WithTimeout(ctx, registryTimeout)
+		defer cancel()
+
+		if registered && recordsEqual(rec, current) {
+			err := reg.Refresh(rctx, rec)
+			if err == nil {
+				return
+			}
+			logger.Warn("registration refresh failed", "error", err)
+		}
+		if err := reg.Register(rctx, rec, registryTTL); err != nil {
+			logger.Warn("registration failed", "error", err)
+			registered = false
+			return
+		}
+		if !registered {
+			logger.Info("registered", "id", rec.ID, "addr", rec.Addr)
+		}
+		current, registered = rec, true
+	}
+
+	update()
+	ticker := time.NewTicker(registryRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			update()
+		case <-ctx.Done():
+			if registered {
+				dctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+				if err := reg.Deregister(dctx, current.ID); err != nil {
+					logger.Warn("deregistration failed", "error", err)
+				}
+				cancel()
+			}
+			return
+		}
+	}
+}
+
+func recordsEqual(a, b ServiceRecord) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
+
+// =============================================================================
+// Consul
+// =============================================================================
+
+// consulRegistrar registers with the local Consul agent's HTTP API. The
+// service carries a TTL check that Refresh passes, and Consul removes it
+// if the check stays critical.
+type consulRegistrar struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+func (c *consulRegistrar) Register(ctx context.Context, rec ServiceRecord, ttl time.Duration) error {
+	host, portStr, _ := net.SplitHostPort(rec.Addr)
+	port, _ := strconv.Atoi(portStr)
+	protocols, _ := json.Marshal(rec.ProtocolVersions)
+
+	meta := map[string]string{
+		"mcpflow_version":   rec.MCPFlowVersion,
+		"protocol_versions": string(protocols),
+		"catalog_hash":      rec.CatalogHash,
+	}
+	if rec.TCPAddr != "" {
+		meta["tcp_addr"] = rec.TCPAddr
+	}
+	body := map[string]interface{}{
+		"ID":      rec.ID,
+		"Name":    rec.Name,
+		"Address": host,
+		"Port":    port,
+		"Tags":    []string{"mcp-flow", "mcpflow-" + rec.MCPFlowVersion},
+		"Meta":    meta,
+		"Check": map[string]interface{}{
+			"CheckID":                        c.checkID(rec.ID),
+			"TTL":                            ttl.String(),
+			"DeregisterCriticalServiceAfter": (2 * ttl).String(),
+		},
+	}
+	if err := c.put(ctx, "/v1/agent/service/register", body); err != nil {
+		return err
+	}
+	return c.Refresh(ctx, rec)
+}
+
+func (c *consulRegistrar) Refresh(ctx context.Context, rec ServiceRecord) error {
+	status := "passing"
+	if !rec.Healthy {
+		status = "critical"
+	}
+	return c.put(ctx, "/v1/agent/check/update/"+url.PathEscape(c.checkID(rec.ID)), map[string]string{"Status": status})
+}
+
+func (c *consulRegistrar) Deregister(ctx context.Context, id string) error {
+	return c.put(ctx, "/v1/agent/service/deregister/"+url.PathEscape(id), nil)
+}
+
+func (c *consulRegistrar) checkID(id string) string { return "service:" + id + ":ttl" }
+
+func (c *consulRegistrar) put(ctx context.Context, path string, body interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.base+path, payload)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	_, err = registryDo(c.client, req)
+	return err
+}
+
+// =============================================================================
+// etcd
+// =============================================================================
+
+// etcdRegistrar stores each record as JSON under <prefix><id> through etcd's
+// v3 JSON gateway, attached to a lease that Refresh keeps alive.
+type etcdRegistrar struct {
+	etcdClient
+	prefix string
+
+	mu     sync.Mutex
+	leases map[string]string // record ID → lease ID
+}
+
+func (e *etcdRegistrar) Register(ctx context.Context, rec ServiceRecord, ttl time.Duration) error {
+	e.mu.Lock()
+	lease := e.leases[rec.ID]
+	e.mu.Unlock()
+
+	// Reuse a live lease so an updated record replaces the old one in
+	// place; grant a new one on first registration or after expiry.
+	if lease == "" || e.keepAlive(ctx, lease) != nil {
+		var granted struct {
+			ID string `json:"ID"`
+		}
+		if err := e.post(ctx, "/v3/lease/grant", map[string]interface{}{"TTL": int(ttl.Seconds())}, &granted); err != nil {
+			return err
+		}
+		lease = granted.ID
+		e.mu.Lock()
+		e.leases[rec.ID] = lease
+		e.mu.Unlock()
+	}
+
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return e.post(ctx, "/v3/kv/put", map[string]interface{}{
+		"key":   base64.StdEncoding.EncodeToString([]byte(e.prefix + rec.ID)),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": lease,
+	}, nil)
+}
+
+func (e *etcdRegistrar) Refresh(ctx context.Context, rec ServiceRecord) error {
+	e.mu.Lock()
+	lease := e.leases[rec.ID]
+	e.mu.Unlock()
+	if lease == "" {
+		return fmt.Errorf("etcd: %s not registered", rec.ID)
+	}
+	return e.keepAlive(ctx, lease)
+}
+
+func (e *etcdRegistrar) Deregister(ctx context.Context, id string) error {
+	e.mu.Lock()
+	lease := e.leases[id]
+	delete(e.leases, id)
+	e.mu.Unlock()
+	if lease == "" {
+		return nil
+	}
+	// Revoking the lease deletes the key with it.
+	return e.post(ctx, "/v3/lease/revoke", map[string]interface{}{"ID": lease}, nil)
+}
+
+// errLeaseExpired reports an etcd lease that ran out before it was renewed.
+var errLeaseExpired = errors.New("expired")
+
+// etcdClient calls etcd's v3 JSON gateway.
+type etcdClient struct {
+	base   string
+	client *http.Client
+}
+
+// keepAlive renews lease, failing if it has already expired.
+func (e *etcdClient) keepAlive(ctx context.Context, lease string) error {
+	var resp struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	if err := e.post(ctx, "/v3/lease/keepalive", map[string]interface{}{"ID": lease}, &resp); err != nil {
+		return err
+	}
+	if ttl, _ := strconv.Atoi(resp.Result.TTL); ttl <= 0 {
+		return fmt.Errorf("etcd: lease %s: %w", lease, errLeaseExpired)
+	}
+	return nil
+}
+
+func (e *etcdClient) post(ctx context.Context, path string, body, result interface{}) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.base+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	respBody, err := registryDo(e.client, req)
+	if err != nil || result == nil {
+		return err
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+// registryDo sends req and returns the response body, failing on non-2xx
+// statuses.
+func registryDo(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
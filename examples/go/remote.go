@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+)
+
+// =============================================================================
+// Remote Tool Provider (federated tools)
+// =============================================================================
+
+// RemoteToolProvider imports the tools of another MCP server through the
+// client SDK and serves them as its own, proxying each call back to that
+// server. The catalog is fetched when the provider is created and again
+// whenever the server sends notifications/tools/list_changed. Register it
+// under a namespace with Handler.RegisterNamespace.
+type RemoteToolProvider struct {
+	upstream *upstream
+
+	mu    sync.RWMutex
+	tools []Tool
+}
+
+// NewRemoteToolProvider connects to the server described by cfg and
+// imports its tools.
+func NewRemoteToolProvider(ctx context.Context, cfg UpstreamConfig, logger *slog.Logger) (*RemoteToolProvider, error) {
+	p := &RemoteToolProvider{}
+	cfg.Options.OnNotification = p.handleNotification
+	p.upstream = newUpstream(cfg, logger)
+
+	if err := p.Refresh(ctx); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Tools returns the most recently imported catalog.
+func (p *RemoteToolProvider) Tools() []Tool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.tools
+}
+
+// Refresh re-imports the remote catalog.
+func (p *RemoteToolProvider) Refresh(ctx context.Context) error {
+	items, err := p.upstream.list(ctx, "tools/list", "tools")
+	if err != nil {
+		return upstreamError(p.upstream, err)
+	}
+
+	tools := make([]Tool, 0, len(items))
+	for _, item := range items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		t := &remoteTool{provider: p}
+		if err := json.Unmarshal(raw, &t.def); err != nil || t.def.Name == "" {
+			p.upstream.logger.Warn("skipping malformed remote tool", "tool", item["name"])
+			continue
+		}
+		if t.def.Annotations != nil {
+			tools = append(tools, &annotatedRemoteTool{t})
+		} else {
+			tools = append(tools, t)
+		}
+	}
+
+	p.mu.Lock()
+	p.tools = tools
+	p.mu.Unlock()
+
+	p.upstream.logger.Info("imported remote tools", "count", len(tools))
+	return nil
+}
+
+// Close disconnects from the remote server.
+func (p *RemoteToolProvider) Close() error {
+	p.upstream.close()
+	return nil
+}
+
+// handleNotification runs on the client's reader, so the refresh it
+// triggers runs separately.
+func (p *RemoteToolProvider) handleNotification(method string, _ json.RawMessage) {
+	if method != "notifications/tools/list_changed" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), gatewayListTimeout)
+		defer cancel()
+		if err := p.Refresh(ctx); err != nil {
+			p.upstream.logger.Warn("remote tool refresh failed", "error", err)
+		}
+	}()
+}
+
+// remoteTool is one imported tool.
+type remoteTool struct {
+	provider *RemoteToolProvider
+	def      struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description"`
+		InputSchema map[string]interface{} `json:"inputSchema"`
+		Annotations *ToolAnnotations       `json:"annotations"`
+	}
+}
+
+func (t *remoteTool) Name() string                        { return t.def.Name }
+func (t *remoteTool) Description() string                 { return t.def.Description }
+func (t *remoteTool) InputSchema() map[string]interface{} { return t.def.InputSchema }
+
+// annotatedRemoteTool is an imported tool that came with annotations.
+type annotatedRemoteTool struct{ *remoteTool }
+
+func (t *annotatedRemoteTool) Annotations() ToolAnnotations { return *t.def.Annotations }
+
+func (t *remoteTool) Execute(args map[string]interface{}) (interface{}, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+// ExecuteContext forwards the call. It is not retried on a dropped
+// connection, so a tool never runs twice.
+func (t *remoteTool) ExecuteContext(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, gatewayCallTimeout)
+	defer cancel()
+
+	u := t.provider.upstream
+	var result map[string]interface{}
+	err := u.call(ctx, "tools/call", map[string]interface{}{"name": t.def.Name, "arguments": args}, &result, false)
+	if err != nil {
+		return nil, upstreamError(u, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+	"github.com/quic-go/quic-go"
+)
+
+// =============================================================================
+// Replay Protection
+// =============================================================================
+
+// With Config.EarlyData set, a returning WebTransport client may send its
+// first requests in QUIC 0-RTT data, which an attacker who captured them
+// can send again on a connection of their own. Reads are safe to repeat;
+// tools/call is not. So each tools/call may carry a nonce and the time it
+// was issued, in Unix milliseconds:
+//
+//	{"name": "deploy", "arguments": {...},
+//	 "_meta": {"nonce": "4f1c9a0b7e2d...", "issuedAt": 1760623915123}}
+//
+// The server remembers every nonce for ReplayWindow after it was issued
+// and refuses, with a replayed (-32017) error, a call that repeats one or
+// whose issuedAt is further than the window from the server's clock, so
+// it cannot have been remembered. On a session opened in early data the
+// nonce is required. initialize advertises the window, in milliseconds,
+// as transport.replayWindow.
+
+// quicConnKey is the context key of the QUIC connection an HTTP/3
+// request arrived on.
+type quicConnKey struct{}
+
+// withQUICConn is the HTTP/3 ConnContext that records the connection.
+func withQUICConn(ctx context.Context, conn quic.Connection) context.Context {
+	return context.WithValue(ctx, quicConnKey{}, conn)
+}
+
+// usedEarlyData reports whether r arrived on a QUIC connection that was
+// resumed with 0-RTT.
+func usedEarlyData(r *http.Request) bool {
+	conn, ok := r.Context().Value(quicConnKey{}).(quic.Connection)
+	return ok && conn.ConnectionState().Used0RTT
+}
+
+// nonceCache remembers the nonces of tools/call requests until they
+// expire. Nonces are shared across sessions, since a replay arrives on a
+// connection of its own.
+type nonceCache struct {
+	window time.Duration
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	swept time.Time
+}
+
+func newNonceCache(window time.Duration) *nonceCache {
+	return &nonceCache{
+		window: window,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// check records nonce, issued at issuedAt, or returns a replayed error if
+// it was seen before or is too old or new to tell.
+func (c *nonceCache) check(nonce string, issuedAt time.Time) error {
+	now := time.Now()
+	if skew := now.Sub(issuedAt); skew > c.window || skew < -c.window {
+		return mcpflowerr.Replayed("request issued at %s is outside the %s replay window",
+			issuedAt.UTC().Format(time.RFC3339Nano), c.window)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.swept) > c.window/2 {
+		for n, expires := range c.seen {
+			if now.After(expires) {
+				delete(c.seen, n)
+			}
+		}
+		c.swept = now
+	}
+	if _, ok := c.seen[nonce]; ok {
+		return mcpflowerr.Replayed("nonce %q already used", nonce)
+	}
+	c.seen[nonce] = issuedAt.Add(c.window)
+	return nil
+}
+
+// checkReplay refuses a tools/call whose nonce was seen before, or one
+// without a nonce on a session opened in early data.
+func (h *Handler) checkReplay(sess *Session, meta RequestMeta) error {
+	if h.nonces == nil {
+		return nil
+	}
+	if meta.Nonce == "" {
+		if sess.openedEarly() {
+			return mcpflowerr.InvalidParams("tools/call on a 0-RTT session requires _meta.nonce and _meta.issuedAt").
+				WithOffender("/_meta/nonce", "required")
+		}
+		return nil
+	}
+	return h.nonces.check(meta.Nonce, time.UnixMilli(meta.IssuedAt))
+}
+
+// setEarlyData records that the session's connection was resumed with
+// 0-RTT.
+func (s *Session) setEarlyData(early bool) {
+	s.mu.Lock()
+	s.earlyData = early
+	s.mu.Unlock()
+}
+
+// openedEarly reports whether the session's connection was resumed with
+// 0-RTT.
+func (s *Session) openedEarly() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.earlyData
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// =============================================================================
+// Request IDs
+// =============================================================================
+
+// RequestID is a JSON-RPC request identifier: a string, a number, or null.
+// It holds the ID's JSON encoding in canonical form, so an ID is echoed as
+// the client sent it, a large integer is never rounded through float64,
+// and two IDs compare equal under == when they are the same string or the
+// same number literal. That makes RequestID usable as a map key in the
+// tables that pair responses with requests.
+//
+// The zero value is an absent ID, the mark of a notification; it is
+// omitted from messages. Build IDs with StringID and IntID rather than
+// converting a string, which would be taken as the encoding itself.
+type RequestID string
+
+// NullID is the null ID, sent with a response to a request whose ID could
+// not be read.
+const NullID RequestID = "null"
+
+// errRequestID rejects an ID that is not a string, number, or null.
+var errRequestID = errors.New("request id must be a string, number, or null")
+
+// StringID returns the ID for s.
+func StringID(s string) RequestID {
+	data, _ := json.Marshal(s)
+	return RequestID(data)
+}
+
+// IntID returns the ID for n.
+func IntID(n int64) RequestID {
+	return RequestID(strconv.FormatInt(n, 10))
+}
+
+// IsZero reports whether the ID is absent.
+func (id RequestID) IsZero() bool {
+	return id == ""
+}
+
+// String returns the ID as JSON, with strings quoted, for logs.
+func (id RequestID) String() string {
+	if id == "" {
+		return "none"
+	}
+	return string(id)
+}
+
+// numericString returns the number a string ID spells, such as 7 for "7",
+// if it spells a decimal integer.
+func (id RequestID) numericString() (RequestID, bool) {
+	if len(id) < 3 || id[0] != '"' {
+		return id, false
+	}
+	digits := string(id[1 : len(id)-1])
+	if digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if digits == "" || digits[0] == '0' && len(digits) > 1 {
+		return id, false
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return id, false
+		}
+	}
+	return id[1 : len(id)-1], true
+}
+
+func (id RequestID) MarshalJSON() ([]byte, error) {
+	if id == "" {
+		return []byte("null"), nil
+	}
+	return []byte(id), nil
+}
+
+func (id *RequestID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return errRequestID
+	}
+	switch c := data[0]; {
+	case c == 'n' && string(data) == "null":
+		*id = NullID
+	case c == '"':
+		// Re-encode so that escapes spelling the same string compare equal.
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = StringID(s)
+	case c == '-' || c >= '0' && c <= '9':
+		// Kept as written: an integer of any size round-trips.
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		*id = RequestID(n)
+	default:
+		return errRequestID
+	}
+	return nil
+}
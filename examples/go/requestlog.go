@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// Request Logging
+// =============================================================================
+
+// Every request Handle serves gets a logger of its own, derived from the
+// session's and tagged with the request ID, the method, the correlation ID
+// from _meta.correlationId (generated when the client sent none), and,
+// when the client sent W3C trace context as _meta.traceparent, the trace
+// ID. Handlers log through req.logger(), and tools that implement
+// mcpflow.ContextTool get it from mcpflow.LoggerFrom, so every line about
+// one call can be grepped together. The correlation ID is also echoed in
+// the response and passed on to upstream servers; see withCorrelation.
+
+// requestLogger derives the logger for req from the session's, and sets
+// req.correlation.
+func (s *Session) requestLogger(req *RPCRequest) *slog.Logger {
+	meta := requestMeta(req.Params)
+	req.correlation = meta.CorrelationID
+	if req.correlation == "" {
+		req.correlation = newCorrelationID()
+	}
+
+	attrs := make([]any, 0, 8)
+	if !req.ID.IsZero() {
+		id := req.ID.String()
+		if unquoted, err := strconv.Unquote(id); err == nil {
+			// Logged bare, so "a" and 7 grep the same way.
+			id = unquoted
+		}
+		attrs = append(attrs, "requestId", id)
+	}
+	attrs = append(attrs, "method", req.Method, "correlationId", req.correlation)
+	if trace := traceID(meta.Traceparent); trace != "" {
+		attrs = append(attrs, "traceId", trace)
+	}
+	return s.logger.With(attrs...)
+}
+
+// logger returns the logger Handle gave req, or the default logger for a
+// request that has not been through Handle.
+func (req *RPCRequest) logger() *slog.Logger {
+	if req.log != nil {
+		return req.log
+	}
+	return slog.Default()
+}
+
+// requestMeta returns params._meta. Params are only decoded when they
+// have one.
+func requestMeta(params json.RawMessage) RequestMeta {
+	var p struct {
+		Meta RequestMeta `json:"_meta"`
+	}
+	if bytes.Contains(params, []byte(`"_meta"`)) {
+		json.Unmarshal(params, &p)
+	}
+	return p.Meta
+}
+
+// traceID returns the trace ID of a traceparent, or "" if it is malformed.
+func traceID(traceparent string) string {
+	// version-traceid-parentid-flags, e.g.
+	// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || strings.Trim(parts[1], "0123456789abcdef") != "" {
+		return ""
+	}
+	return parts[1]
+}
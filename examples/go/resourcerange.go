@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Ranged Resource Reads
+// =============================================================================
+
+// A resources/read with a range param returns up to range.length bytes of
+// the resource from range.offset, so a client can page through a resource
+// too large for one frame. The server caps each read at
+// Config.ResourceChunk, whatever length was asked for (zero asks for as
+// much as allowed). The bytes are returned as a blob, since a range may
+// split a character of text, and the result's range member says which
+// bytes they are and how many the resource has in all:
+//
+//	{"contents": [{"uri": ..., "blob": ...}],
+//	 "range": {"offset": 0, "length": 4194304, "total": 734003200}}
+
+// RangedResourceReader is a ResourceProvider that can read part of a
+// resource without loading all of it, such as FileResourceProvider. The
+// whole resource is read and sliced for providers that are not.
+type RangedResourceReader interface {
+	ResourceProvider
+	// ReadResourceRange returns up to length bytes of the resource at uri
+	// from offset, as a blob, and the size of the whole resource. An
+	// offset at or past the end returns an empty blob.
+	ReadResourceRange(uri string, offset, length int64) (ResourceContents, int64, error)
+}
+
+// checkRange validates a requested range and caps its length at the
+// server's chunk size.
+func (h *Handler) checkRange(r *ResourceRange) error {
+	if r.Offset < 0 {
+		return mcpflowerr.InvalidParams("range offset must not be negative").WithOffender("/range/offset", "minimum")
+	}
+	if r.Length < 0 {
+		return mcpflowerr.InvalidParams("range length must not be negative").WithOffender("/range/length", "minimum")
+	}
+	if chunk := int64(h.cfg.ResourceChunk); chunk > 0 && (r.Length == 0 || r.Length > chunk) {
+		r.Length = chunk
+	}
+	return nil
+}
+
+// readRange reads the range of params.URI from provider p.
+func readRange(p ResourceProvider, params ResourceParams) (interface{}, error) {
+	r := *params.Range
+	var (
+		contents ResourceContents
+		total    int64
+		err      error
+	)
+	if ranged, ok := p.(RangedResourceReader); ok {
+		contents, total, err = ranged.ReadResourceRange(params.URI, r.Offset, r.Length)
+	} else {
+		contents, total, err = sliceResource(p, params.URI, r.Offset, r.Length)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if contents.MimeType == "" {
+		// Only the start of a resource says what it is.
+		var head []byte
+		if r.Offset == 0 {
+			head = contents.Blob
+		}
+		contents.MimeType = detectMimeType(contents.URI, head)
+	}
+	r.Length = int64(len(contents.Blob))
+	return map[string]interface{}{
+		"contents": []ResourceContents{contents},
+		"range":    rangeResult{ResourceRange: r, Total: total},
+	}, nil
+}
+
+// sliceResource reads the whole of a resource, whose first contents item
+// is taken as the resource, and returns the range of it.
+func sliceResource(p ResourceProvider, uri string, offset, length int64) (ResourceContents, int64, error) {
+	items, err := p.ReadResource(uri)
+	if err != nil {
+		return ResourceContents{}, 0, err
+	}
+	if len(items) == 0 {
+		return ResourceContents{URI: uri, Blob: []byte{}}, 0, nil
+	}
+	data := items[0].Blob
+	if data == nil {
+		data = []byte(items[0].Text)
+	}
+	mimeType := items[0].MimeType
+	if mimeType == "" {
+		mimeType = detectMimeType(uri, data)
+	}
+	total := int64(len(data))
+	return ResourceContents{URI: uri, MimeType: mimeType, Blob: byteRange(data, offset, length)}, total, nil
+}
+
+// byteRange returns up to length bytes of data from offset, all the rest
+// when length is zero.
+func byteRange(data []byte, offset, length int64) []byte {
+	if offset >= int64(len(data)) {
+		return []byte{}
+	}
+	data = data[offset:]
+	if length > 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return data
+}
+
+// rangeResult is the range member of a ranged read's result.
+type rangeResult struct {
+	ResourceRange
+	Total int64 `json:"total"`
+}
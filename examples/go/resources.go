@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Resources
+// =============================================================================
+
+// Resource describes one entry of resources/list.
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// ResourceContents is one item of a resources/read result. Blob is sent
+// base64-encoded when set; otherwise Text is sent. StreamTag, when set,
+// says the blob was sent on that Execution Stream instead; see
+// streamBlobs. Hash, when set, is the hash of the text or blob, which is
+// left out when both are empty because the client was sent it before; see
+// dedupContent.
+type ResourceContents struct {
+	URI       string
+	MimeType  string
+	Text      string
+	Blob      []byte
+	StreamTag uint32
+	Hash      string
+}
+
+// MarshalJSON writes exactly one of text, blob, and a stream reference, so
+// empty text is still text, unless the item refers to its payload by hash.
+func (c ResourceContents) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{"uri": c.URI}
+	if c.MimeType != "" {
+		m["mimeType"] = c.MimeType
+	}
+	if c.Hash != "" {
+		m["hash"] = c.Hash
+	}
+	if c.StreamTag != 0 {
+		m["type"] = "ref/stream"
+		m["streamTag"] = c.StreamTag
+	} else if c.Blob != nil {
+		m["blob"] = c.Blob
+	} else if c.Text != "" || c.Hash == "" {
+		m["text"] = c.Text
+	}
+	return json.Marshal(m)
+}
+
+// ResourceProvider serves resources from this server, alongside those of
+// gateway upstreams. Resources is consulted on every list, so the set may
+// change at runtime. ReadResource returns an mcpflowerr.NotFound error for
+// URIs the provider does not serve, letting the next provider try.
+type ResourceProvider interface {
+	Resources() []Resource
+	ReadResource(uri string) ([]ResourceContents, error)
+}
+
+// RegisterResources serves provider's resources. Providers are consulted in
+// registration order, before gateway upstreams. Sessions already serving
+// resources are told their list changed.
+func (h *Handler) RegisterResources(provider ResourceProvider) {
+	h.resourcesMu.Lock()
+	h.resourceProviders = append(h.resourceProviders, provider)
+	h.resourcesMu.Unlock()
+	h.NotifyResourcesListChanged()
+}
+
+func (h *Handler) localResourceProviders() []ResourceProvider {
+	h.resourcesMu.RLock()
+	defer h.resourcesMu.RUnlock()
+	return h.resourceProviders
+}
+
+// servesResources reports whether resources/list and resources/read are
+// available, for dispatch and the initialize capabilities.
+func (h *Handler) servesResources() bool {
+	return h.gateway != nil || len(h.localResourceProviders()) > 0
+}
+
+// handleResources serves the resource methods from the local providers and
+// the gateway.
+func (h *Handler) handleResources(sess *Session, req *RPCRequest) *RPCResponse {
+	if req.Method == "resources/list" {
+		return &RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]interface{}{"resources": h.listResources()}}
+	}
+
+	var params ResourceParams
+	err := decodeParams(req, &params)
+	if err == nil && params.URI == "" {
+		err = mcpflowerr.InvalidParams("uri is required").WithOffender("/uri", "required")
+	}
+	var result interface{}
+	if err == nil {
+		switch req.Method {
+		case "resources/read":
+			result, err = h.readResource(params)
+			result = sess.streamBlobs(req.ID, withETag(req, result))
+			result = sess.dedupContent(req, result)
+		case "resources/subscribe", "resources/unsubscribe":
+			h.subscribe(sess, params.URI, req.Method == "resources/subscribe")
+			result = map[string]interface{}{}
+		}
+	}
+	if err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+	return &RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func (h *Handler) listResources() []interface{} {
+	resources := []interface{}{}
+	for _, p := range h.localResourceProviders() {
+		for _, r := range p.Resources() {
+			resources = append(resources, withMimeType(r))
+		}
+	}
+	if h.gateway != nil {
+		for _, r := range h.gateway.resources() {
+			resources = append(resources, r)
+		}
+	}
+	return resources
+}
+
+func (h *Handler) readResource(params ResourceParams) (interface{}, error) {
+	uri := params.URI
+	if params.Range != nil {
+		if err := h.checkRange(params.Range); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range h.localResourceProviders() {
+		if params.Range != nil {
+			result, err := readRange(p, params)
+			if code, _ := mcpflowerr.CodeOf(err); code == mcpflowerr.CodeNotFound {
+				continue
+			}
+			return result, err
+		}
+		contents, err := p.ReadResource(uri)
+		if code, _ := mcpflowerr.CodeOf(err); code == mcpflowerr.CodeNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"contents": withMimeTypes(contents)}, nil
+	}
+	if h.gateway != nil {
+		return h.gateway.readResource(params)
+	}
+	return nil, mcpflowerr.NotFound("Unknown resource: %s", uri)
+}
+
+// =============================================================================
+// Subscriptions
+// =============================================================================
+
+func (h *Handler) subscribe(sess *Session, uri string, on bool) {
+	h.resourcesMu.Lock()
+	defer h.resourcesMu.Unlock()
+	if !on {
+		delete(h.subscriptions[uri], sess)
+		if len(h.subscriptions[uri]) == 0 {
+			delete(h.subscriptions, uri)
+		}
+		return
+	}
+	if h.subscriptions == nil {
+		h.subscriptions = make(map[string]map[*Session]struct{})
+	}
+	if h.subscriptions[uri] == nil {
+		h.subscriptions[uri] = make(map[*Session]struct{})
+	}
+	h.subscriptions[uri][sess] = struct{}{}
+}
+
+// unsubscribeAll drops a closing session's subscriptions.
+func (h *Handler) unsubscribeAll(sess *Session) {
+	h.resourcesMu.Lock()
+	defer h.resourcesMu.Unlock()
+	for uri, sessions := range h.subscriptions {
+		delete(sessions, sess)
+		if len(sessions) == 0 {
+			delete(h.subscriptions, uri)
+		}
+	}
+}
+
+// notifySubscribers sends notifications/resources/updated for uri to the
+// sessions subscribed to it.
+func (h *Handler) notifySubscribers(uri string) {
+	h.resourcesMu.RLock()
+	sessions := make([]*Session, 0, len(h.subscriptions[uri]))
+	for sess := range h.subscriptions[uri] {
+		sessions = append(sessions, sess)
+	}
+	h.resourcesMu.RUnlock()
+
+	for _, sess := range sessions {
+		if err := sess.Notify("notifications/resources/updated", map[string]interface{}{"uri": uri}); err != nil {
+			sess.logger.Debug("resource update not delivered", "uri", uri, "error", err)
+		}
+	}
+}
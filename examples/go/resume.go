@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// =============================================================================
+// Session Resumption
+// =============================================================================
+
+// With Config.ResumeWindow set, a session that sequences its frames (see
+// frameSequenced) is given a resumeToken in the initialize result, and the
+// server keeps every frame it numbers for the window. When the connection
+// drops, the session lives on without it for the window: frames written
+// meanwhile, such as progress from a tool call still running, are numbered
+// and kept. A client that reconnects and sends
+//
+//	"transport": {"sequenceNumbers": true, "resume": {"token": T, "lastSeq": N}}
+//
+// in initialize gets "resumed": true back, followed by every frame after N
+// under its original number, and the old session's output continues on the
+// new connection. A token that is unknown or expired, or whose frames after
+// N are no longer all kept, starts a fresh session with a new token, or
+// with the same token when Config.Outbox still holds notifications for it;
+// see NotifyCritical.
+
+// errReplayGap reports that the frames a resuming client missed are no
+// longer all kept.
+var errReplayGap = errors.New("missed frames are no longer retained")
+
+// replayLog keeps the numbered frames a resumable session wrote within the
+// resume window, and no more than limit bytes of them when limit is set.
+type replayLog struct {
+	window time.Duration
+	limit  int
+
+	frames []replayFrame
+	size   int
+}
+
+type replayFrame struct {
+	seq  uint64
+	data []byte
+	at   time.Time
+}
+
+func newReplayLog(cfg Config) *replayLog {
+	return &replayLog{window: cfg.ResumeWindow, limit: cfg.SessionMemory}
+}
+
+// add keeps frame, numbered seq, and drops frames that have aged out or
+// no longer fit. The newest frame is always kept.
+func (l *replayLog) add(seq uint64, frame []byte) {
+	now := time.Now()
+	l.frames = append(l.frames, replayFrame{seq: seq, data: frame, at: now})
+	l.size += len(frame)
+
+	drop := 0
+	for drop < len(l.frames)-1 {
+		oldest := l.frames[drop]
+		if now.Sub(oldest.at) <= l.window && (l.limit <= 0 || l.size <= l.limit) {
+			break
+		}
+		l.size -= len(oldest.data)
+		l.frames[drop] = replayFrame{}
+		drop++
+	}
+	l.frames = l.frames[drop:]
+}
+
+// since returns the frames numbered after last, where sent is the number
+// of the newest frame, or errReplayGap if some of them were dropped.
+func (l *replayLog) since(last, sent uint64) ([][]byte, error) {
+	if last > sent {
+		return nil, fmt.Errorf("last seen frame %d was never sent", last)
+	}
+	if last == sent {
+		return nil, nil
+	}
+	i := len(l.frames)
+	for i > 0 && l.frames[i-1].seq > last {
+		i--
+	}
+	if i == len(l.frames) || l.frames[i].seq != last+1 {
+		return nil, errReplayGap
+	}
+	frames := make([][]byte, 0, len(l.frames)-i)
+	for _, f := range l.frames[i:] {
+		frames = append(frames, f.data)
+	}
+	return frames, nil
+}
+
+// resumeEntry is the output of a resumable session, filed under its token
+// while the session runs and for the resume window after it ends.
+type resumeEntry struct {
+	out    *sessionWriter
+	expiry *time.Timer // set once the session has ended
+}
+
+// resumePoint is where a resuming session picks up: the old session's
+// output and the last frame the client saw on it.
+type resumePoint struct {
+	out     *sessionWriter
+	lastSeq uint64
+}
+
+// resumeSession handles the resumption part of initialize for a session
+// that sequences its frames. It returns the token the session can later
+// resume with, "" when resumption is off, and whether this initialize
+// resumed an earlier session.
+func (h *Handler) resumeSession(sess *Session, params *ResumeParams) (string, bool) {
+	if h.cfg.ResumeWindow <= 0 {
+		return "", false
+	}
+	if params != nil && params.Token != "" {
+		if old := h.takeResumable(params.Token); old != nil {
+			old.mu.Lock()
+			_, err := old.replay.since(params.LastSeq, old.sent)
+			old.mu.Unlock()
+			if err == nil {
+				sess.setResume(params.Token, &resumePoint{out: old, lastSeq: params.LastSeq})
+				sess.logger.Info("session resumed", "lastSeq", params.LastSeq)
+				return params.Token, true
+			}
+			sess.logger.Warn("cannot resume session", "lastSeq", params.LastSeq, "error", err)
+		} else {
+			sess.logger.Info("resume token unknown or expired")
+		}
+	}
+	token := newSessionID()
+	if params != nil && h.outboxHolds(params.Token) {
+		// A restart or an expired window lost the session, but not the
+		// notifications stored for it.
+		token = params.Token
+	}
+	sess.setResume(token, nil)
+	return token, false
+}
+
+func (s *Session) setResume(token string, from *resumePoint) {
+	s.mu.Lock()
+	s.resumeToken, s.resumeFrom = token, from
+	if s.handler.cfg.Outbox != nil {
+		s.ack = s.handler.outboxAcker(token)
+	}
+	s.mu.Unlock()
+}
+
+// startSequencing numbers the frames out writes from now on, called once
+// the initialize result is written. A resumable session also keeps them,
+// and a resuming one first replays what its client missed.
+func (s *Session) startSequencing(out *sessionWriter) error {
+	s.mu.Lock()
+	token, from := s.resumeToken, s.resumeFrom
+	s.resumeFrom = nil
+	s.mu.Unlock()
+
+	switch {
+	case token == "":
+		out.startSequencing(nil)
+	case from != nil:
+		if err := out.resume(from.out, from.lastSeq); err != nil {
+			return err
+		}
+	default:
+		out.startSequencing(newReplayLog(s.handler.cfg))
+		if err := s.deliverOutbox(out, token); err != nil {
+			return err
+		}
+	}
+	s.handler.fileResumable(token, out)
+	return nil
+}
+
+// parkResumable keeps a resumable session's output for the resume window
+// after its connection ends.
+func (s *Session) parkResumable(out *sessionWriter) {
+	s.mu.RLock()
+	token := s.resumeToken
+	s.mu.RUnlock()
+	if token == "" {
+		return
+	}
+
+	h := s.handler
+	h.resumeMu.Lock()
+	defer h.resumeMu.Unlock()
+	entry := h.resumable[token]
+	if entry == nil || entry.out != out {
+		// Already resumed on another connection.
+		return
+	}
+	entry.expiry = time.AfterFunc(h.cfg.ResumeWindow, func() {
+		h.resumeMu.Lock()
+		expired := h.resumable[token] == entry
+		if expired {
+			delete(h.resumable, token)
+		}
+		h.resumeMu.Unlock()
+		if !expired {
+			return
+		}
+		// The client can no longer resume, so its state goes too.
+		if err := h.stateStore().Clear(s.stateScope()); err != nil {
+			s.logger.Warn("clearing session state failed", "error", err)
+		}
+	})
+}
+
+func (h *Handler) fileResumable(token string, out *sessionWriter) {
+	h.resumeMu.Lock()
+	defer h.resumeMu.Unlock()
+	if h.resumable == nil {
+		h.resumable = make(map[string]*resumeEntry)
+	}
+	h.resumable[token] = &resumeEntry{out: out}
+}
+
+// takeResumable removes and returns the output filed under token, whether
+// its session has ended or its client gave up on a connection the server
+// still thinks is open.
+func (h *Handler) takeResumable(token string) *sessionWriter {
+	h.resumeMu.Lock()
+	defer h.resumeMu.Unlock()
+	entry := h.resumable[token]
+	if entry == nil {
+		return nil
+	}
+	delete(h.resumable, token)
+	if entry.expiry != nil {
+		entry.expiry.Stop()
+	}
+	return entry.out
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// sandboxSupportsNoNetwork reports whether sandbox can cut off networking.
+const sandboxSupportsNoNetwork = true
+
+// sandbox runs cmd in its own process group, killed as a whole when its
+// context ends, and with noNetwork in new user and network namespaces,
+// which leave it only a loopback interface that is down.
+func sandbox(cmd *exec.Cmd, noNetwork bool) {
+	attr := &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+	if noNetwork {
+		attr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	}
+	cmd.SysProcAttr = attr
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+}
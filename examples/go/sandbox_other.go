@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "os/exec"
+
+// sandboxSupportsNoNetwork reports whether sandbox can cut off networking.
+const sandboxSupportsNoNetwork = false
+
+// sandbox is a no-op off Linux: commands still get their timeout, output
+// cap, and working directory, but a timeout kills only the command itself.
+func sandbox(cmd *exec.Cmd, noNetwork bool) {}
@@ -4,28 +4,49 @@
 //
 // Usage:
 //
-//	go run server.go -cert cert.pem -key key.pem [-addr :4433]
+//	go run . -cert cert.pem -key key.pem [-addr :4433]
+//
+// To expose an existing stdio MCP server over MCP-Flow instead of the
+// built-in tools, name it after the flags:
+//
+//	go run . -cert cert.pem -key key.pem -auth-token s3cret -- npx -y @modelcontextprotocol/server-everything
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"log/slog"
 	"math/big"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/mcp-flow/examples/go/mcpflow"
+	"github.com/mcp-flow/examples/go/mcpflowclient"
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
 	"github.com/quic-go/webtransport-go"
+	"google.golang.org/grpc/metadata"
 )
 
 // =============================================================================
@@ -34,13 +55,305 @@ import (
 
 const (
 	mcpFlowVersion       = "0.1"
-	protocolVersion      = "2024-11-05"
 	serverName           = "mcp-flow-echo-go"
 	serverVersion        = "1.0.0"
 	maxFrameSize         = 16 * 1024 * 1024 // 16MB
 	maxConcurrentStreams = 100
+
+	defaultEncoding          = "json"
+	defaultIdempotencyWindow = 5 * time.Minute
+	defaultResponseCacheSize = 1024
+	defaultFlushDelay        = time.Millisecond
+	defaultSessionMemory     = 64 << 20 // 64MB
+	defaultStateLimit        = 1 << 20  // 1MB
+	defaultResourceChunk     = 4 << 20  // 4MB
+	defaultContentHashMin    = 4 << 10  // 4KB
+	defaultReplayWindow      = 10 * time.Second
+
+	// sessionPipelineDepth is how many decoded requests a framed session
+	// holds while an earlier one is being handled.
+	sessionPipelineDepth = 8
 )
 
+// Config holds tunable server behavior. The zero value disables every
+// optional feature.
+type Config struct {
+	// IdempotencyWindow is how long tools/call responses are retained for
+	// replay to retried requests carrying the same _meta.idempotencyKey.
+	// Zero disables duplicate suppression.
+	IdempotencyWindow time.Duration
+
+	// ResponseCacheTTL enables caching of read-only method results (tools/list,
+	// resources/list, and tools annotated read-only) for the given duration.
+	// Zero disables the response cache.
+	ResponseCacheTTL time.Duration
+
+	// ResponseCacheSize bounds the default in-memory LRU backend.
+	ResponseCacheSize int
+
+	// CacheBackend overrides the in-memory LRU backend, e.g. with a store
+	// shared between instances.
+	CacheBackend CacheBackend
+
+	// TCPAddr is the address of the TCP+TLS fallback listener, which speaks
+	// the same length-prefixed frames for clients that cannot use UDP. It is
+	// advertised in the initialize result. Empty disables it.
+	TCPAddr string
+
+	// HTTPAddr is the address of an HTTPS listener serving the MCP Streamable
+	// HTTP transport at /mcp and the legacy HTTP+SSE transport at /sse for
+	// standard MCP clients, plus MCP-Flow frames over WebSocket. The HTTP
+	// transports are also available over HTTP/3 on the main address. Empty
+	// disables the listener.
+	HTTPAddr string
+
+	// EarlyData accepts QUIC 0-RTT resumption on the main address, saving
+	// returning clients a round trip. Since early data can be replayed,
+	// tools/call nonces are then checked against ReplayWindow, zero
+	// meaning 10s; see nonceCache.
+	EarlyData    bool
+	ReplayWindow time.Duration
+
+	// ErrorRate, when positive, limits the protocol errors (invalid
+	// requests, unknown methods, invalid params) a session on a persistent
+	// stream is answered with to this many a second, after a burst of
+	// ErrorBurst (zero meaning ErrorRate). Errors past the limit go
+	// unanswered, and a session with ErrorClose of them dropped, zero
+	// meaning 100, is closed. See errorThrottle.
+	ErrorRate  float64
+	ErrorBurst int
+	ErrorClose int
+
+	// ToolRates limits how fast each session may call the named tools;
+	// see ToolRate.
+	ToolRates map[string]ToolRate
+
+	// UsageBucket, when positive, counts every tools/call in buckets this
+	// long by tool, tenant, and client, reported by Server.UsageReport.
+	// The buckets are kept in UsageStore, or in memory for UsageRetention,
+	// zero meaning 24h. See Usage Reporting.
+	UsageBucket    time.Duration
+	UsageRetention time.Duration
+	UsageStore     UsageStore
+
+	// UsageSink, when set, is handed a UsageRecord for every finished
+	// tools/call, for metering and billing; see UsageSink.
+	UsageSink UsageSink
+
+	// Webhooks are sent server events: sessions starting and ending,
+	// authentication failures, tool errors, and draining. See Webhooks.
+	Webhooks []WebhookConfig
+
+	// EventPublisher, when set, is sent every server event, including a
+	// tool.called per tools/call, under the topic EventTopic (zero
+	// meaning mcpflow.events) plus "." and the event type. See Event
+	// Bridge.
+	EventPublisher EventPublisher
+	EventTopic     string
+
+	// ClusterBus, when set, carries Broadcast and list_changed
+	// notifications between the instances of a cluster on the channel
+	// ClusterChannel, zero meaning mcpflow.cluster, so they reach clients
+	// connected to any instance. See Cluster Broadcast.
+	ClusterBus     ClusterBus
+	ClusterChannel string
+
+	// ExclusiveTools names tools, besides those implementing
+	// ExclusiveTool, that run one call at a time under a lock from Locker,
+	// shared by every instance using the same one; a nil Locker only locks
+	// within this process. A call finding the tool running waits up to
+	// LockWait, then fails with busy. See Exclusive Tools.
+	ExclusiveTools []string
+	Locker         Locker
+	LockWait       time.Duration
+
+	// HandshakeTimeout, UpgradeTimeout, StreamTimeout, and InitTimeout
+	// bound how long a new client may take over its TLS or QUIC handshake,
+	// the first HTTP request on its connection, the control stream of its
+	// WebTransport session, and its initialize request. A client that
+	// stalls is disconnected. Zero waits indefinitely; see Connection
+	// Timeouts.
+	HandshakeTimeout time.Duration
+	UpgradeTimeout   time.Duration
+	StreamTimeout    time.Duration
+	InitTimeout      time.Duration
+
+	// WriteBuffer, when positive, coalesces each framed session's outgoing
+	// frames in a buffer of this many bytes, so bursts of small responses
+	// and notifications go out in fewer QUIC packets. The buffer is flushed
+	// when it fills, FlushDelay after the first frame written to it, and
+	// whenever the session has answered every request waiting to be read.
+	// Zero is the low-latency mode: every frame is written immediately.
+	WriteBuffer int
+	// FlushDelay bounds how long a buffered frame waits; zero means 1ms.
+	FlushDelay time.Duration
+	// MemoryLimit is the process memory, in bytes, the server should stay
+	// under. Above 90% of it new tool calls fail with a retryable
+	// overloaded error and new sessions are refused, until use falls
+	// below 80%. Zero disables load shedding.
+	MemoryLimit int64
+
+	// ToolWorkers bounds how many tool calls run at once, across every
+	// session and tenant; ToolQueue is how many more may wait for a worker
+	// before calls are rejected as overloaded. Zero workers runs each call
+	// on the goroutine that received it, without a bound.
+	ToolWorkers int
+	ToolQueue   int
+
+	// SessionMemory caps the bytes held for one client. A framed or legacy
+	// SSE client with more than this in frames waiting to be written has
+	// stopped reading and is disconnected, rather than left to grow the
+	// server; a Streamable HTTP session's queued notifications are dropped
+	// beyond it. Zero means no cap.
+	SessionMemory int
+
+	// Lenient turns on the interop profile, which accepts known quirks of
+	// other MCP implementations instead of rejecting them: messages without
+	// the jsonrpc member, numeric IDs echoed as strings or the other way
+	// round, and NDJSON written to a length-prefixed stream. Each quirk is
+	// logged the first time a session shows it.
+	Lenient bool
+
+	// AdminAddr is the TCP address of the plain-HTTP admin listener serving
+	// /metrics, /readyz, and /drain. Empty disables it.
+	AdminAddr string
+
+	// AuthToken, when set, must be presented as a bearer token: in the
+	// Authorization header on WebTransport and the HTTP-based transports,
+	// or as _meta.authorization in initialize over TCP+TLS. stdio is local
+	// and not authenticated.
+	AuthToken string
+
+	// Info is who may read the server description at / on the main
+	// address: "public" (the default), "auth" for holders of AuthToken, or
+	// "off". InfoFields, when set, limits it to the fields named; see
+	// infoFields.
+	Info       string
+	InfoFields []string
+
+	// PostQuantum limits the TLS key exchange of every listener, and of
+	// the connections to upstreams, proxy backends, and gRPC servers, to
+	// hybrid X25519+ML-KEM; see hybridKeyExchanges. It needs a build with
+	// Go 1.24 or later.
+	PostQuantum bool
+
+	// CryptoPolicy, when set, names the approved TLS algorithms every
+	// listener is limited to, such as "fips"; the server refuses to start
+	// with a certificate or option outside them. See cryptoPolicies.
+	CryptoPolicy string
+
+	// ECHKeys, when set, let clients encrypt their ClientHello, so the
+	// server name they ask for is hidden from the network; the first is
+	// the current key. See mcpflow.ECHKey. It needs a build with Go 1.24
+	// or later.
+	ECHKeys []mcpflow.ECHKey
+
+	// SigningKey, when set, signs every response, so those who hold its
+	// public key can tell whether a result was changed on the way. See
+	// mcpflow.SignResponse.
+	SigningKey ed25519.PrivateKey
+
+	// Passthrough, when set, relays each session to its own upstream MCP
+	// server opened with these options (for example a stdio server run as
+	// a subprocess) instead of serving the local tools.
+	Passthrough *mcpflowclient.Options
+
+	// Upstreams turns the server into an aggregating gateway: the tools,
+	// resources, and prompts of each upstream are merged into this server's
+	// catalog, tools and prompts namespaced by upstream name, and calls are
+	// routed back to their owner.
+	Upstreams []UpstreamConfig
+
+	// ProxyBackends turns the server into a reverse proxy: each framed
+	// session (WebTransport, WebSocket, TCP+TLS) gets its own stream to a
+	// backend and frames are copied through unchanged, while sessions on
+	// the HTTP transports are relayed message by message as with
+	// Passthrough. TLS termination, auth, and metrics stay at the proxy.
+	// Sessions are balanced across several backends by Weight; Name only
+	// labels a backend in logs.
+	ProxyBackends []UpstreamConfig
+
+	// SessionStore keeps Streamable HTTP session state and queued
+	// notifications. A shared store such as RedisSessionStore lets any
+	// instance behind a load balancer serve any session; nil keeps them in
+	// memory.
+	SessionStore SessionStore
+
+	// ResumeWindow, when positive, lets a client that numbers its frames
+	// resume its session on a new connection within this long of losing
+	// the old one, and have the frames it missed replayed; see
+	// resumeSession. Frames are kept for the window, up to SessionMemory
+	// bytes per session.
+	ResumeWindow time.Duration
+
+	// PingInterval, when positive, has framed sessions send their client
+	// a ping once it has been idle this long, recording the round-trip
+	// time for Server.Stats. See pingIdle.
+	PingInterval time.Duration
+
+	// StateStore backs the mcpflow.SessionState tools get through their
+	// context; nil keeps it in memory. See StateStore.
+	StateStore StateStore
+	// StateLimit caps the bytes of keys and values one session may keep
+	// in its state; a Set past it fails with mcpflow.ErrStateFull. Zero
+	// means no limit.
+	StateLimit int
+
+	// ResourceChunk caps the bytes one ranged resources/read returns; see
+	// RangedResourceReader. Zero means no cap.
+	ResourceChunk int
+
+	// ContentHashMin is the size, in bytes, from which the tool and
+	// resource payloads of sessions that ask for transport.contentHashes
+	// are sent in full only once, and by hash after that; see
+	// dedupContent. Zero disables content hashes.
+	ContentHashMin int
+
+	// Outbox, when set, keeps the notifications sent with NotifyCritical
+	// to resumable sessions until their clients acknowledge them, for
+	// OutboxTTL (zero means 24h), so they survive dropped connections and
+	// server restarts. See Outbox; OpenFileOutbox opens the built-in one.
+	Outbox    Outbox
+	OutboxTTL time.Duration
+
+	// AckNotifications numbers the notifications queued for Streamable
+	// HTTP sessions and, for clients that opt in, keeps each one in the
+	// SessionStore until the client acknowledges it, redelivering it on
+	// every event stream until then. The store must implement
+	// AckSessionStore.
+	AckNotifications bool
+
+	// Tenants split the server into isolated registries within one
+	// process. Clients reach a tenant by presenting its token, or under
+	// /tenants/<name>/ on the HTTP-based transports; everyone else gets the
+	// default registry. Register a tenant's tools and capabilities on
+	// Server.Tenant(name).
+	Tenants []TenantConfig
+
+	// Registrar, when set, keeps the server registered in a service
+	// registry such as Consul or etcd while it runs, so gateways can find
+	// it. The record advertises AdvertiseHost, or the listen host or the
+	// machine's host name when that is empty.
+	Registrar     Registrar
+	AdvertiseHost string
+
+	// WASMMaxMemory caps the memory of each WASM tool instance, and
+	// WASMTimeout bounds each call, standing in for fuel; zero means 16 MiB
+	// and 10s.
+	WASMMaxMemory int64
+	WASMTimeout   time.Duration
+
+	// JSON encodes and decodes messages on the wire; nil uses
+	// encoding/json. See JSONEngine.
+	JSON JSONEngine
+
+	// Faults inject latency and errors for testing clients against a
+	// misbehaving server, with random draws seeded by FaultSeed so a run
+	// can be repeated. See FaultRule; for staging only.
+	Faults    []FaultRule
+	FaultSeed int64
+}
+
 // jokes contains programming humor for the echo_joke tool.
 var jokes = [...]string{
 	"There are only 10 types of people: those who understand binary and those who don't.",
@@ -58,19 +371,34 @@ var jokes = [...]string{
 	"There are only two hard things in CS: cache invalidation, naming things, and off-by-one errors.",
 }
 
+// supportedEncodings lists the Control Stream encodings this server can speak.
+var supportedEncodings = []string{defaultEncoding}
+
 // =============================================================================
 // JSON-RPC Types
 // =============================================================================
 
-// RequestID represents a JSON-RPC request identifier.
-type RequestID interface{}
-
 // RPCRequest represents an incoming JSON-RPC request or notification.
+// Params are kept as sent and decoded by the method that reads them, into
+// one of the Request Parameters structs; see decodeParams.
 type RPCRequest struct {
-	JSONRPC string                 `json:"jsonrpc"`
-	ID      RequestID              `json:"id,omitempty"`
-	Method  string                 `json:"method"`
-	Params  map[string]interface{} `json:"params,omitempty"`
+	JSONRPC string          `json:"jsonrpc"`
+	ID      RequestID       `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+
+	// seq is the number of the frame that carried the request, 0 if it
+	// was not sequenced; see frameSequenced. checksummed is set if the
+	// frame had a checksum; see frameChecksummed.
+	seq         uint64
+	checksummed bool
+	// log is the request's logger, and correlation its correlation ID,
+	// both set by Handle; see requestLogger.
+	log         *slog.Logger
+	correlation string
+	// replayed is set when a tools/call was answered from the idempotency
+	// window or the response cache, without running the tool.
+	replayed bool
 }
 
 // RPCResponse represents an outgoing JSON-RPC response.
@@ -101,35 +429,48 @@ const (
 // Frame Codec
 // =============================================================================
 
+// Codec frames RPC messages on a byte stream.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(r io.Reader) (*RPCRequest, error)
+}
+
 // FrameCodec handles length-prefixed JSON frame encoding/decoding.
 type FrameCodec struct {
 	maxSize uint32
+	json    JSONEngine
 }
 
 // NewFrameCodec creates a new codec with the specified maximum frame size.
 func NewFrameCodec(maxSize uint32) *FrameCodec {
-	return &FrameCodec{maxSize: maxSize}
+	return &FrameCodec{maxSize: maxSize, json: StdJSON{}}
 }
 
-// Encode serializes a value as a length-prefixed JSON frame.
+// Encode serializes a value as a length-prefixed JSON frame. The value is
+// encoded after four bytes reserved for the length, so the frame is built
+// in one buffer rather than marshaled and then copied behind its header,
+// and still goes out in a single Write, which sessionWriter relies on.
 func (c *FrameCodec) Encode(v interface{}) ([]byte, error) {
-	body, err := json.Marshal(v)
-	if err != nil {
+	buf := bytes.NewBuffer(make([]byte, 4, 64))
+	if err := c.json.NewEncoder(buf).Encode(v); err != nil {
 		return nil, fmt.Errorf("marshal: %w", err)
 	}
+	// Drop the newline the encoder ends every value with.
+	frame := bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
 
-	if uint32(len(body)) > c.maxSize {
-		return nil, fmt.Errorf("frame size %d exceeds maximum %d", len(body), c.maxSize)
+	length := len(frame) - 4
+	if uint32(length) > c.maxSize {
+		return nil, fmt.Errorf("frame size %d exceeds maximum %d", length, c.maxSize)
 	}
-
-	frame := make([]byte, 4+len(body))
-	binary.BigEndian.PutUint32(frame[:4], uint32(len(body)))
-	copy(frame[4:], body)
+	binary.BigEndian.PutUint32(frame[:4], uint32(length))
 
 	return frame, nil
 }
 
-// Decode reads a length-prefixed JSON frame from the reader.
+// Decode reads a length-prefixed JSON frame from the reader, and the
+// frame's sequence number if it is sequenced. A frame with a checksum is
+// checked before its body is unmarshaled, so a damaged one is reported as
+// such.
 func (c *FrameCodec) Decode(r io.Reader) (*RPCRequest, error) {
 	lengthBuf := make([]byte, 4)
 	if _, err := io.ReadFull(r, lengthBuf); err != nil {
@@ -137,34 +478,107 @@ func (c *FrameCodec) Decode(r io.Reader) (*RPCRequest, error) {
 	}
 
 	length := binary.BigEndian.Uint32(lengthBuf)
+	src := r
+	var sum hash.Hash32
+	if length&frameChecksummed != 0 {
+		length &^= frameChecksummed
+		sum = crc32.New(castagnoli)
+		sum.Write(lengthBuf)
+		r = io.TeeReader(r, sum)
+	}
+	var seq uint64
+	if length&frameSequenced != 0 {
+		length &^= frameSequenced
+		seqBuf := make([]byte, frameSeqSize)
+		if _, err := io.ReadFull(r, seqBuf); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("read sequence: %w", err)
+		}
+		seq = binary.BigEndian.Uint64(seqBuf)
+	}
 	if length > c.maxSize {
 		return nil, fmt.Errorf("frame size %d exceeds maximum %d", length, c.maxSize)
 	}
 
-	body := make([]byte, length)
-	if _, err := io.ReadFull(r, body); err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
-	}
-
+	// Decode straight from the stream rather than reading the body into a
+	// slice first. The limit keeps the decoder's read-ahead inside this
+	// frame, and whatever it leaves unread is drained so the next frame
+	// starts where it should.
+	body := &io.LimitedReader{R: r, N: int64(length)}
+	dec := c.json.NewDecoder(body)
 	var req RPCRequest
-	if err := json.Unmarshal(body, &req); err != nil {
+	err := dec.Decode(&req)
+	trailing, drainErr := drainFrame(io.MultiReader(dec.Buffered(), body))
+	if drainErr == nil && body.N > 0 {
+		drainErr = io.ErrUnexpectedEOF
+	}
+	if drainErr != nil {
+		return nil, fmt.Errorf("read body: %w", drainErr)
+	}
+	if sum != nil {
+		if err := readChecksum(src, sum.Sum32()); err != nil {
+			return nil, err
+		}
+	}
+	if err == nil && trailing {
+		// Like json.Unmarshal, reject anything after the value.
+		err = errors.New("invalid character after top-level value")
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
 		return nil, fmt.Errorf("unmarshal: %w", err)
 	}
 
+	req.seq, req.checksummed = seq, sum != nil
 	return &req, nil
 }
 
+// drainFrame reads r to the end and reports whether it held anything but
+// JSON whitespace.
+func drainFrame(r io.Reader) (trailing bool, err error) {
+	var buf [512]byte
+	for {
+		n, err := r.Read(buf[:])
+		for _, b := range buf[:n] {
+			if b != ' ' && b != '\t' && b != '\n' && b != '\r' {
+				trailing = true
+			}
+		}
+		if err == io.EOF {
+			return trailing, nil
+		}
+		if err != nil {
+			return trailing, err
+		}
+	}
+}
+
 // =============================================================================
 // Tool Interface
 // =============================================================================
 
-// Tool defines the interface for MCP tools.
-type Tool interface {
-	Name() string
-	Description() string
-	InputSchema() map[string]interface{}
-	Execute(args map[string]interface{}) (interface{}, error)
-}
+// Tool defines the interface for MCP tools. It lives in package mcpflow so
+// tool plugins can implement it.
+type Tool = mcpflow.Tool
+
+// ToolAnnotations are behavioral hints advertised alongside a tool.
+type ToolAnnotations = mcpflow.ToolAnnotations
+
+// AnnotatedTool is implemented by tools that advertise behavioral hints.
+// Tools marked ReadOnlyHint are eligible for the response cache.
+type AnnotatedTool = mcpflow.AnnotatedTool
+
+// VersionedTool is implemented by tools that declare a version and may be
+// deprecated.
+type VersionedTool = mcpflow.VersionedTool
+
+// ExclusiveTool is implemented by tools that must not run more than once at
+// a time; see Exclusive Tools.
+type ExclusiveTool = mcpflow.ExclusiveTool
 
 // =============================================================================
 // Echo Joke Tool
@@ -184,14 +598,18 @@ func (t *echoJokeTool) InputSchema() map[string]interface{} {
 	}
 }
 
-func (t *echoJokeTool) Execute(_ map[string]interface{}) (interface{}, error) {
+func (t *echoJokeTool) Execute(args map[string]interface{}) (interface{}, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *echoJokeTool) ExecuteContext(ctx context.Context, _ map[string]interface{}) (interface{}, error) {
 	idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(jokes))))
 	if err != nil {
 		return nil, err
 	}
 
 	joke := jokes[idx.Int64()]
-	slog.Info("serving joke", "joke", joke)
+	mcpflow.LoggerFrom(ctx).Info("serving joke", "joke", joke)
 
 	return map[string]interface{}{
 		"content": []map[string]interface{}{
@@ -204,129 +622,614 @@ func (t *echoJokeTool) Execute(_ map[string]interface{}) (interface{}, error) {
 // RPC Handler
 // =============================================================================
 
-// Handler processes JSON-RPC requests for MCP-Flow.
+// Handler processes JSON-RPC requests for MCP-Flow. A single Handler is
+// shared by every session on a server.
 type Handler struct {
-	tools map[string]Tool
+	cfg         Config
+	tools       map[string]Tool
+	idempotency *idempotencyCache
+	nonces      *nonceCache
+	cache       *responseCache
+	toolCache   *toolResultCache
+	metrics     *Metrics
+	gateway     *gateway
+	proxyPool   *pool
+
+	namespacesMu sync.RWMutex
+	namespaces   map[string]*namespace
+
+	resourcesMu       sync.RWMutex
+	resourceProviders []ResourceProvider
+	subscriptions     map[string]map[*Session]struct{}
+
+	sessionsMu sync.Mutex
+	sessions   map[*Session]struct{}
+
+	resumeMu  sync.Mutex
+	resumable map[string]*resumeEntry
+
+	// state is the StateStore used when Config.StateStore is nil.
+	state *MemoryStateStore
+
+	experimentalMu sync.RWMutex
+	experimental   map[string]interface{}
+
+	hooks lifecycleHooks
+
+	faults   *faultInjector
+	drain    *drainState
+	load     *loadShedder
+	toolPool *toolPool
+	tenant   *tenantState
+	tenants  map[string]*Handler
+	usage    *usageRecorder
+	webhooks *webhookEmitter
+	events   *eventBridge
+	cluster  *cluster
+	locker   Locker
 }
 
 // NewHandler creates a new RPC handler with registered tools.
-func NewHandler() *Handler {
+func NewHandler(cfg Config) *Handler {
 	h := &Handler{
-		tools: make(map[string]Tool),
+		cfg:          cfg,
+		tools:        make(map[string]Tool),
+		toolCache:    newToolResultCache(),
+		metrics:      NewMetrics(),
+		namespaces:   make(map[string]*namespace),
+		experimental: make(map[string]interface{}),
+		drain:        &drainState{},
+		load:         &loadShedder{limit: uint64(cfg.MemoryLimit)},
+		toolPool:     newToolPool(cfg.ToolWorkers, cfg.ToolQueue),
+		tenant:       &tenantState{},
+		state:        NewMemoryStateStore(),
+		faults:       newFaultInjector(cfg, ""),
+	}
+
+	if cfg.IdempotencyWindow > 0 {
+		h.idempotency = newIdempotencyCache(cfg.IdempotencyWindow)
+	}
+
+	h.usage = newUsageRecorder(cfg, h.metrics)
+	if h.usage != nil && h.usage.exporter != nil {
+		h.OnShutdown(h.usage.exporter.close)
+	}
+	h.webhooks = newWebhookEmitter(cfg.Webhooks, h.metrics)
+	if h.webhooks != nil {
+		h.OnShutdown(h.webhooks.close)
+	}
+	h.events = newEventBridge(cfg, h.metrics)
+	if h.events != nil {
+		h.OnShutdown(h.events.close)
+	}
+	h.locker = cfg.Locker
+	if h.locker == nil {
+		h.locker = newMemoryLocker()
+	}
+	h.cluster = newCluster(cfg, h.metrics)
+	if h.cluster != nil {
+		h.OnShutdown(h.cluster.close)
+	}
+
+	if cfg.EarlyData {
+		window := cfg.ReplayWindow
+		if window <= 0 {
+			window = defaultReplayWindow
+		}
+		h.nonces = newNonceCache(window)
+	}
+
+	if cfg.ResponseCacheTTL > 0 {
+		backend := cfg.CacheBackend
+		if backend == nil {
+			backend = NewLRUCache(cfg.ResponseCacheSize)
+		}
+		h.cache = &responseCache{backend: backend, ttl: cfg.ResponseCacheTTL}
+	}
+
+	if len(cfg.ProxyBackends) > 0 {
+		labels := make([]string, len(cfg.ProxyBackends))
+		weights := make([]int, len(cfg.ProxyBackends))
+		for i, b := range cfg.ProxyBackends {
+			labels[i], weights[i] = b.Name, b.Weight
+		}
+		h.proxyPool = newPool(labels, weights, slog.Default().With("component", "proxy"))
+	}
+
+	if len(cfg.Upstreams) > 0 {
+		h.gateway = newGateway(cfg.Upstreams, h.relayListChanged, slog.Default())
 	}
 
 	jokeTool := &echoJokeTool{}
 	h.tools[jokeTool.Name()] = jokeTool
 
+	if len(cfg.Tenants) > 0 {
+		h.tenants = newTenantHandlers(h, cfg)
+	}
+
 	return h
 }
 
+// RegisterExperimental advertises an experimental capability under name in
+// the initialize result, for trialing protocol extensions. Sessions that
+// initialize afterwards see the new entry.
+func (h *Handler) RegisterExperimental(name string, settings map[string]interface{}) {
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+
+	h.experimentalMu.Lock()
+	h.experimental[name] = settings
+	h.experimentalMu.Unlock()
+}
+
+func (h *Handler) experimentalCapabilities() map[string]interface{} {
+	h.experimentalMu.RLock()
+	defer h.experimentalMu.RUnlock()
+
+	out := make(map[string]interface{}, len(h.experimental))
+	for name, settings := range h.experimental {
+		out[name] = settings
+	}
+	return out
+}
+
 // Handle processes a JSON-RPC request and returns a response.
 // Returns nil for notifications (no response expected).
-func (h *Handler) Handle(req *RPCRequest) *RPCResponse {
+func (h *Handler) Handle(sess *Session, req *RPCRequest) *RPCResponse {
+	start := time.Now()
+	if req.log == nil {
+		req.log = sess.requestLogger(req)
+	}
+	if !sess.enter() {
+		if req.ID.IsZero() {
+			return nil
+		}
+		return h.signResponse(req, h.closingResponse(req))
+	}
+	defer sess.leave()
+
+	var resp *RPCResponse
+	switch {
+	case !h.validVersion(sess, req):
+		resp = h.invalidVersionResponse(req)
+	case !h.authorize(sess, req):
+		resp = h.unauthorizedResponse(req)
+		h.emit(sess.event(EventAuthFailed, map[string]interface{}{"method": req.Method}))
+	case !sess.admits(req):
+		resp = h.lifecycleResponse(sess, req)
+	case sess.handler != h:
+		// The initialize token selected a tenant.
+		return sess.handler.Handle(sess, req)
+	case h.faults.strike(req):
+		resp = h.toolErrorResponse(req.ID, h.faults.faultError(req))
+	case req.Method == "tools/call" && h.load.overloaded():
+		resp = h.toolErrorResponse(req.ID, h.load.admit())
+	case h.tenant.name != "":
+		resp = h.handleMetered(sess, req)
+	case h.cfg.Passthrough != nil || h.proxyPool != nil:
+		// HTTP transport sessions have no stream for the proxy to splice,
+		// so they are relayed per message.
+		resp = h.relay(sess, req)
+	default:
+		resp = h.handleCached(sess, req)
+	}
+	if resp != nil && resp.Result != nil {
+		// Past the caches, whose results are shared by every session.
+		out := *resp
+		switch {
+		case req.Method == "tools/call":
+			out.Result = sess.dedupContent(req, resp.Result)
+		case etagMethods[req.Method]:
+			out.Result = withETag(req, resp.Result)
+		}
+		resp = &out
+	}
+
+	if req.Method == "initialize" && resp != nil && resp.Error == nil {
+		sess.setInitialized()
+		h.emit(sess.event(EventSessionStarted, nil))
+	}
+
+	h.metrics.ObserveRequest(req.Method)
+	if resp != nil && resp.Error != nil && !sess.admitError(resp.Error.Code) {
+		h.metrics.ObserveDroppedError()
+		resp = nil
+	}
+	if resp != nil && resp.Error != nil {
+		h.metrics.ObserveError(resp.Error.Code)
+	}
+	if req.Method == "tools/call" && resp != nil {
+		tool, elapsed := toolCallName(req), time.Since(start)
+		failed := resp.Error != nil || isErrorResult(resp.Result)
+		h.metrics.ObserveToolCall(tool, elapsed, failed)
+		h.recordUsage(sess, req, resp, tool, elapsed, failed)
+		if h.emitting() {
+			h.emit(sess.event(EventToolCalled, toolCalledData(tool, resp, elapsed, failed, req.replayed)))
+		}
+		if failed {
+			h.emit(sess.event(EventToolError, toolErrorData(tool, resp)))
+		}
+	}
+	sess.requests.Add(1)
+	sess.lastActive.Store(time.Now().UnixNano())
+	return h.signResponse(req, withCorrelation(resp, req.correlation))
+}
+
+// handleCached serves req from the response cache when eligible.
+func (h *Handler) handleCached(sess *Session, req *RPCRequest) *RPCResponse {
+	key, ok := h.cacheKey(sess, req)
+	if !ok {
+		return h.dispatch(sess, req)
+	}
+
+	if result, ok := h.cache.get(key); ok {
+		req.replayed = true
+		return &RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+	}
+
+	resp := h.dispatch(sess, req)
+	if resp != nil && resp.Error == nil && !isErrorResult(resp.Result) {
+		h.cache.set(key, resp.Result)
+	}
+	return resp
+}
+
+// cacheKey reports whether req is eligible for the response cache and, if
+// so, the key its result is stored under. Results may differ by negotiated
+// protocol version, so the version is part of the key, and by tenant, whose
+// Handlers may share Config.CacheBackend, so the tenant's name is too.
+func (h *Handler) cacheKey(sess *Session, req *RPCRequest) (string, bool) {
+	if h.cache == nil || req.ID.IsZero() {
+		return "", false
+	}
+
+	if req.Method == "tools/call" {
+		found, _ := h.lookupTool(toolCallName(req))
+		tool, ok := found.(AnnotatedTool)
+		if !ok || !tool.Annotations().ReadOnlyHint {
+			return "", false
+		}
+	} else if !cacheableMethods[req.Method] {
+		return "", false
+	}
+
+	method := req.Method + "@" + sess.ProtocolVersion()
+	if h.tenant.name != "" {
+		method += "#" + h.tenant.name
+	}
+	return h.cache.key(method, req.Params)
+}
+
+// isErrorResult reports whether a tool result is flagged with isError.
+func isErrorResult(result interface{}) bool {
+	m, ok := result.(map[string]interface{})
+	return ok && m["isError"] == true
+}
+
+func (h *Handler) dispatch(sess *Session, req *RPCRequest) *RPCResponse {
 	switch req.Method {
 	case "initialize":
-		return h.handleInitialize(req)
+		return h.handleInitialize(sess, req)
 	case "notifications/initialized":
-		slog.Info("client initialized")
+		req.logger().Info("client initialized")
 		return nil
 	case "tools/list":
-		return h.handleToolsList(req)
+		return h.handleToolsList(sess, req)
 	case "tools/call":
-		return h.handleToolsCall(req)
+		return h.handleToolsCall(sess, req)
+	case "resources/list", "resources/read", "resources/subscribe", "resources/unsubscribe":
+		if !h.servesResources() {
+			return h.errorResponse(req.ID, ErrCodeMethodNotFound, "Method not found: "+req.Method)
+		}
+		return h.handleResources(sess, req)
+	case "prompts/list", "prompts/get":
+		if h.gateway == nil {
+			return h.errorResponse(req.ID, ErrCodeMethodNotFound, "Method not found: "+req.Method)
+		}
+		return h.handleGatewayCatalog(req)
 	case "ping":
 		return &RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]interface{}{}}
 	case "$/shutdown":
-		slog.Info("shutdown requested")
+		sess.beginShutdown()
 		return nil
 	case "$/cancel":
 		h.handleCancel(req)
 		return nil
+	case "$/ack":
+		h.handleAck(sess, req)
+		return nil
 	default:
-		if req.ID == nil {
+		if req.ID.IsZero() {
 			return nil // Unknown notification
 		}
 		return h.errorResponse(req.ID, ErrCodeMethodNotFound, "Method not found: "+req.Method)
 	}
 }
 
-func (h *Handler) handleInitialize(req *RPCRequest) *RPCResponse {
+func (h *Handler) handleInitialize(sess *Session, req *RPCRequest) *RPCResponse {
+	if err := h.admitSession(sess); err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+	h.trackSession(sess)
+
+	var params InitializeParams
+	if err := decodeParams(req, &params); err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+	encoding, err := selectEncoding(params.Transport.Encodings)
+	if err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+	sess.setEncoding(encoding)
+
+	requested := params.ProtocolVersion
+	version := negotiateProtocolVersion(requested)
+	sess.setProtocolVersion(version)
+
+	sess.setClientCapabilities(params.Capabilities)
+	sess.setClient(params.ClientInfo)
+	sequenced := params.Transport.SequenceNumbers && sess.sequenceable()
+
+	capabilities := h.sessionCapabilities(sess).Map()
+	if version != requested {
+		req.logger().Info("protocol version negotiated", "requested", requested, "using", version)
+	}
+
+	transport := h.transportInfo(encoding)
+	if sequenced {
+		transport["sequenceNumbers"] = true
+	}
+	result := map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    capabilities,
+		"serverInfo":      map[string]interface{}{"name": serverName, "version": serverVersion},
+		"transport":       transport,
+	}
+	if err := h.runInitializeHooks(sess, req, &params, result); err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+
+	// Sequence and resume only once the client is accepted, since resuming
+	// takes the earlier session's output over.
+	sess.setSequenceFrames(sequenced)
+	if sequenced {
+		resumeToken, resumed := h.resumeSession(sess, params.Transport.Resume)
+		if resumeToken != "" {
+			transport["resumeToken"] = resumeToken
+			transport["resumed"] = resumed
+		}
+	}
+	if sess.acceptBlobStreams(params.Transport.BlobStreams) {
+		transport["blobStreams"] = true
+	}
+	if sess.acceptContentHashes(params.Transport.ContentHashes, h.cfg.ContentHashMin) {
+		transport["contentHashes"] = true
+	}
+	if checksum := sess.acceptChecksums(params.Transport.Checksums); checksum != "" {
+		transport["checksum"] = checksum
+	}
+	if h.nonces != nil {
+		transport["replayWindow"] = h.nonces.window.Milliseconds()
+	}
+	if h.cfg.SigningKey != nil {
+		transport["signingKey"] = h.cfg.signingKey()
+	}
+	sess.setServerCapabilities(capabilities)
+
+	return &RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+// transportInfo describes the MCP-Flow transport in the initialize result.
+func (h *Handler) transportInfo(encoding string) map[string]interface{} {
+	info := map[string]interface{}{
+		"type":                 "mcp-flow",
+		"version":              mcpFlowVersion,
+		"encoding":             encoding,
+		"maxConcurrentStreams": maxConcurrentStreams,
+		"datagramsSupported":   false,
+	}
+	if alts := h.cfg.transportAlternatives(); len(alts) > 0 {
+		info["alternatives"] = alts
+	}
+	return info
+}
+
+// selectEncoding picks the first encoding in the client's preference list
+// that the server supports. An omitted list defaults to JSON; a list with no
+// overlap fails initialize.
+func selectEncoding(offered []string) (string, error) {
+	if offered == nil {
+		return defaultEncoding, nil
+	}
+
+	for _, name := range offered {
+		for _, supported := range supportedEncodings {
+			if name == supported {
+				return name, nil
+			}
+		}
+	}
+
+	return "", mcpflowerr.InvalidParams("no mutually supported encoding").
+		WithOffender("/transport/encodings", fmt.Sprintf("server supports %v", supportedEncodings))
+}
+
+func (h *Handler) handleToolsList(sess *Session, req *RPCRequest) *RPCResponse {
 	return &RPCResponse{
 		JSONRPC: "2.0",
 		ID:      req.ID,
-		Result: map[string]interface{}{
-			"protocolVersion": protocolVersion,
-			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{"listChanged": false}},
-			"serverInfo":      map[string]interface{}{"name": serverName, "version": serverVersion},
-			"transport": map[string]interface{}{
-				"type":                 "mcp-flow",
-				"version":              mcpFlowVersion,
-				"encoding":             "json",
-				"maxConcurrentStreams": maxConcurrentStreams,
-				"datagramsSupported":   false,
-			},
-		},
+		Result:  map[string]interface{}{"tools": h.toolCatalog(sess.Supports(FeatureToolAnnotations))},
 	}
 }
 
-func (h *Handler) handleToolsList(req *RPCRequest) *RPCResponse {
+// toolCatalog lists every tool served: local, namespaced, and from gateway
+// upstreams.
+func (h *Handler) toolCatalog(withAnnotations bool) []map[string]interface{} {
 	tools := make([]map[string]interface{}, 0, len(h.tools))
 	for _, t := range h.tools {
-		tools = append(tools, map[string]interface{}{
-			"name":        t.Name(),
-			"description": t.Description(),
-			"inputSchema": t.InputSchema(),
-		})
+		tools = append(tools, toolEntry(t.Name(), t, withAnnotations))
 	}
+	tools = append(tools, h.namespacedTools(withAnnotations)...)
+	if h.gateway != nil {
+		tools = append(tools, h.gateway.tools(withAnnotations)...)
+	}
+	return tools
+}
 
-	return &RPCResponse{
-		JSONRPC: "2.0",
-		ID:      req.ID,
-		Result:  map[string]interface{}{"tools": tools},
+// handleGatewayCatalog serves the prompt methods from the gateway's
+// upstreams.
+func (h *Handler) handleGatewayCatalog(req *RPCRequest) *RPCResponse {
+	var result interface{}
+	var err error
+	switch req.Method {
+	case "prompts/list":
+		result = map[string]interface{}{"prompts": h.gateway.prompts()}
+	case "prompts/get":
+		var params PromptsGetParams
+		if err = decodeParams(req, &params); err == nil {
+			result, err = h.gateway.getPrompt(params)
+		}
+	}
+	if err != nil {
+		return h.toolErrorResponse(req.ID, err)
 	}
+	return &RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
 }
 
-func (h *Handler) handleToolsCall(req *RPCRequest) *RPCResponse {
-	toolName, _ := req.Params["name"].(string)
-	args, _ := req.Params["arguments"].(map[string]interface{})
+func (h *Handler) handleToolsCall(sess *Session, req *RPCRequest) *RPCResponse {
+	var params ToolsCallParams
+	if err := decodeParams(req, &params); err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+	if params.Name == "" {
+		return h.toolErrorResponse(req.ID, mcpflowerr.InvalidParams("name is required").WithOffender("/name", "required"))
+	}
+	if err := h.checkReplay(sess, params.Meta); err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+	toolName, key := params.Name, params.Meta.IdempotencyKey
+	if key == "" || h.idempotency == nil || !h.idempotency.holds(key) {
+		// Before the idempotency window, which would remember the refusal.
+		if err := h.takeToolToken(sess, toolName); err != nil {
+			return h.toolErrorResponse(req.ID, err)
+		}
+	}
+	if key == "" || h.idempotency == nil {
+		return h.callTool(sess, req, params)
+	}
+
+	resp, replayed, err := h.idempotency.Do(key, toolName, params.Arguments, func() *RPCResponse {
+		return h.callTool(sess, req, params)
+	})
+	if err != nil {
+		return h.toolErrorResponse(req.ID, err)
+	}
+	if replayed {
+		req.logger().Info("replaying idempotent response", "key", key, "tool", toolName)
+		req.replayed = true
+	}
+	return &RPCResponse{JSONRPC: resp.JSONRPC, ID: req.ID, Result: resp.Result, Error: resp.Error}
+}
+
+func (h *Handler) callTool(sess *Session, req *RPCRequest, params ToolsCallParams) *RPCResponse {
+	toolName, args := params.Name, params.Arguments
 	if args == nil {
 		args = make(map[string]interface{})
 	}
 
-	tool, ok := h.tools[toolName]
-	if !ok {
-		return &RPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: map[string]interface{}{
-				"content": []map[string]interface{}{{"type": "text", "text": "Unknown tool: " + toolName}},
-				"isError": true,
-			},
+	ctx := sess.callContext(req)
+	if h.toolExclusive(toolName) {
+		var unlock func()
+		var err error
+		if ctx, unlock, err = h.lockTool(ctx, toolName); err != nil {
+			return h.toolErrorResponse(req.ID, err)
 		}
+		defer unlock()
+	}
+	var run func() (interface{}, error)
+	if tool, ok := h.tools[toolName]; ok {
+		run = func() (interface{}, error) { return h.executeTool(ctx, toolName, tool, args) }
+	} else if call, ok := h.routeTool(ctx, toolName); ok {
+		run = func() (interface{}, error) { return call(toolName, args) }
 	}
 
-	result, err := tool.Execute(args)
+	var result interface{}
+	var err error
+	if run == nil {
+		err = mcpflowerr.NotFound("Unknown tool: %s", toolName)
+	} else if poolErr := h.toolPool.do(func() { result, err = run() }); poolErr != nil {
+		err = poolErr
+	}
 	if err != nil {
-		return &RPCResponse{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-			Result: map[string]interface{}{
-				"content": []map[string]interface{}{{"type": "text", "text": "Tool error: " + err.Error()}},
-				"isError": true,
-			},
-		}
+		return h.toolErrorResponse(req.ID, err)
+	}
+	if tool, ok := h.lookupTool(toolName); ok {
+		result = deprecationWarning(req.logger(), toolName, tool, result)
 	}
 
 	return &RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
 }
 
+// toolErrorResponse converts a tool failure into a response. Errors from
+// the mcpflowerr taxonomy become JSON-RPC errors with their code and any
+// error.data payload; anything else is reported as tool result content with
+// isError set.
+func (h *Handler) toolErrorResponse(id RequestID, err error) *RPCResponse {
+	if code, ok := mcpflowerr.CodeOf(err); ok {
+		resp := h.errorResponse(id, code, err.Error())
+		if data := mcpflowerr.DataOf(err); data != nil {
+			resp.Error.Data = data
+		}
+		return resp
+	}
+
+	return &RPCResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Result: map[string]interface{}{
+			"content": []map[string]interface{}{{"type": "text", "text": "Tool error: " + err.Error()}},
+			"isError": true,
+		},
+	}
+}
+
+// executeTool runs a tool under its qualified name, consulting the per-tool
+// result cache for tools that opt in via CachingTool.
+func (h *Handler) executeTool(ctx context.Context, name string, tool Tool, args map[string]interface{}) (interface{}, error) {
+	ct, ok := tool.(CachingTool)
+	if !ok {
+		return runTool(ctx, tool, args)
+	}
+
+	ttl, deps := ct.CachePolicy(args)
+	key, ok := h.toolCache.entryKey(name, args)
+	if ttl <= 0 || !ok {
+		return runTool(ctx, tool, args)
+	}
+
+	if result, ok := h.toolCache.get(key); ok {
+		return result, nil
+	}
+
+	result, err := runTool(ctx, tool, args)
+	if err == nil && !isErrorResult(result) {
+		h.toolCache.set(key, result, ttl, append(append([]string(nil), deps...), name))
+	}
+	return result, err
+}
+
 func (h *Handler) handleCancel(req *RPCRequest) {
-	reqID := req.Params["requestId"]
-	reason, _ := req.Params["reason"].(string)
+	var params CancelParams
+	if err := decodeParams(req, &params); err != nil {
+		req.logger().Warn("ignoring malformed cancel", "error", err)
+		return
+	}
+	reason := params.Reason
 	if reason == "" {
 		reason = "no reason provided"
 	}
-	slog.Info("cancel requested", "requestId", reqID, "reason", reason)
+	req.logger().Info("cancel requested", "cancelledId", params.RequestID, "reason", reason)
 }
 
 func (h *Handler) errorResponse(id RequestID, code int, message string) *RPCResponse {
@@ -343,48 +1246,503 @@ func (h *Handler) errorResponse(id RequestID, code int, message string) *RPCResp
 
 // Session manages a single MCP-Flow WebTransport session.
 type Session struct {
-	codec   *FrameCodec
+	codec   Codec
 	handler *Handler
 	logger  *slog.Logger
+
+	mu                 sync.RWMutex
+	protocolVersion    string
+	encoding           string
+	clientCapabilities map[string]interface{}
+	serverCapabilities map[string]interface{}
+	clientInfo         ClientInfo
+	awaitingAuth       bool
+	upstream           *mcpflowclient.Client
+	out                *sessionWriter
+	admittedBy         *Handler
+
+	// budget counts the bytes held for the client; see Config.SessionMemory.
+	budget *sessionBudget
+
+	// frameChecksums is set once the client has asked for frame checksums;
+	// see frameChecksummed.
+	frameChecksums bool
+
+	// initialized is set once initialize has succeeded; see admits.
+	initialized bool
+
+	// toolBuckets holds the session's token bucket for each tool in
+	// Config.ToolRates it has called; see takeToolToken.
+	toolBuckets map[string]*tokenBucket
+
+	// earlyData is set when the session's connection was resumed with
+	// 0-RTT; see checkReplay.
+	earlyData bool
+
+	// errThrottle limits the session's error responses, when the server
+	// sets Config.ErrorRate; see admitError.
+	errThrottle *errorThrottle
+
+	// sequenceFrames is set once the client has asked for numbered frames
+	// at initialize; see frameSequenced.
+	sequenceFrames bool
+	// resumeToken names a resumable session, and resumeFrom is the session
+	// it resumes until Serve has replayed it; see resumeSession.
+	resumeToken string
+	resumeFrom  *resumePoint
+
+	// scope is where the session's state is kept, and clearState is set
+	// when it ends with the session; see stateScope.
+	scope      string
+	clearState bool
+
+	// closing is set once the client sent $/shutdown; active counts the
+	// requests being handled, and idle is closed when it drops to zero.
+	// See finishShutdown.
+	closing bool
+	active  int
+	idle    chan struct{}
+
+	// pingID is the server's ping awaiting a reply, sent at pingSent;
+	// pings counts them and rtt is the smoothed round trip. See pingIdle.
+	pingID   RequestID
+	pingSent time.Time
+	pings    uint64
+	rtt      time.Duration
+
+	// streams opens Execution Streams on WebTransport, and blobStreams is
+	// set once the client has asked for blobs on them; streamTags numbers
+	// the streams and openStreams counts those being written. See
+	// streamBlobs.
+	streams     streamOpener
+	blobStreams bool
+	streamTags  uint32
+	openStreams int
+
+	// clientStreams counts the WebTransport streams the client has open,
+	// the control stream included; see acceptClientStreams.
+	clientStreams int
+
+	// contentHashMin is the smallest payload hashed, zero unless the
+	// client asked for content hashes; sentContent holds the hashes of
+	// the payloads sent in full, oldest first in sentOrder. See
+	// dedupContent.
+	contentHashMin int
+	sentContent    map[string]bool
+	sentOrder      []string
+
+	// quirks records the interop quirks already logged; see tolerate.
+	quirks map[string]bool
+
+	// push queues a notification on transports without a persistent
+	// output, such as the HTTP ones.
+	push func(*RPCRequest) error
+	// ack drops queued notifications the client has acknowledged, on
+	// transports that offer acknowledged notifications; see ackCapability.
+	ack func(seq uint64) error
+
+	// Reported by Server.Stats.
+	id         uint64
+	transport  string
+	remote     string
+	client     string
+	started    time.Time
+	requests   atomic.Uint64
+	lastActive atomic.Int64
 }
 
-// NewSession creates a new session handler.
-func NewSession(logger *slog.Logger) *Session {
+// sessionSeq numbers sessions for Server.Stats.
+var sessionSeq atomic.Uint64
+
+// NewSession creates a new session bound to the server's shared handler.
+func NewSession(handler *Handler, logger *slog.Logger) *Session {
 	return &Session{
-		codec:   NewFrameCodec(maxFrameSize),
-		handler: NewHandler(),
+		codec:   withJSON(NewFrameCodec(maxFrameSize), handler.jsonEngine()),
+		handler: handler,
 		logger:  logger,
+		budget:  &sessionBudget{limit: int64(handler.cfg.SessionMemory)},
+		id:      sessionSeq.Add(1),
+	}
+}
+
+// setPeer records the transport a session arrived on and the client's
+// address, for Server.Stats.
+func (s *Session) setPeer(transport, remote string) {
+	s.mu.Lock()
+	s.transport, s.remote = transport, remote
+	s.mu.Unlock()
+}
+
+// ProtocolVersion returns the MCP revision negotiated at initialize, or the
+// oldest supported revision before initialization.
+func (s *Session) ProtocolVersion() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.protocolVersion == "" {
+		return supportedProtocolVersions[0]
+	}
+	return s.protocolVersion
+}
+
+// Supports reports whether the negotiated revision includes feature.
+func (s *Session) Supports(feature string) bool {
+	return versionSupports(s.ProtocolVersion(), feature)
+}
+
+// ClientExperimental returns the experimental capability block the client
+// sent at initialize, or nil if it sent none.
+func (s *Session) ClientExperimental() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	experimental, _ := s.clientCapabilities["experimental"].(map[string]interface{})
+	return experimental
+}
+
+// ClientInfo returns the clientInfo the client sent at initialize.
+func (s *Session) ClientInfo() ClientInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientInfo
+}
+
+// ClientCapabilities returns the capabilities the client sent at
+// initialize, or nil before initialization.
+func (s *Session) ClientCapabilities() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientCapabilities
+}
+
+// ServerCapabilities returns the capabilities the server answered
+// initialize with, or nil before initialization.
+func (s *Session) ServerCapabilities() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.serverCapabilities
+}
+
+func (s *Session) setServerCapabilities(caps map[string]interface{}) {
+	s.mu.Lock()
+	s.serverCapabilities = caps
+	s.mu.Unlock()
+}
+
+func (s *Session) setClientCapabilities(caps map[string]interface{}) {
+	s.mu.Lock()
+	s.clientCapabilities = caps
+	s.mu.Unlock()
+}
+
+// setClient records the clientInfo sent with initialize.
+func (s *Session) setClient(info ClientInfo) {
+	name := info.Name
+	if info.Version != "" {
+		name += "/" + info.Version
+	}
+	s.mu.Lock()
+	s.clientInfo, s.client = info, name
+	s.started = time.Now()
+	s.mu.Unlock()
+}
+
+// Encoding returns the Control Stream encoding selected at initialize.
+func (s *Session) Encoding() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.encoding == "" {
+		return defaultEncoding
+	}
+	return s.encoding
+}
+
+func (s *Session) setEncoding(encoding string) {
+	s.mu.Lock()
+	s.encoding = encoding
+	s.mu.Unlock()
+}
+
+func (s *Session) setProtocolVersion(version string) {
+	s.mu.Lock()
+	s.protocolVersion = version
+	s.mu.Unlock()
+}
+
+// requireInitializeAuth makes the session refuse everything until an
+// initialize presents the bearer token, for transports without headers.
+func (s *Session) requireInitializeAuth() {
+	s.mu.Lock()
+	s.awaitingAuth = true
+	s.mu.Unlock()
+}
+
+func (s *Session) authPending() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.awaitingAuth
+}
+
+func (s *Session) setAuthenticated() {
+	s.mu.Lock()
+	s.awaitingAuth = false
+	s.mu.Unlock()
+}
+
+func (s *Session) upstreamClient() *mcpflowclient.Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.upstream
+}
+
+// setUpstream attaches the session's passthrough connection, closing any
+// previous one left by a repeated initialize.
+func (s *Session) setUpstream(c *mcpflowclient.Client) {
+	s.mu.Lock()
+	old := s.upstream
+	s.upstream = c
+	s.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+}
+
+// State returns the session's portable state for a SessionStore.
+func (s *Session) State() *SessionState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &SessionState{
+		Tenant:             s.handler.tenant.name,
+		ProtocolVersion:    s.protocolVersion,
+		Encoding:           s.encoding,
+		ClientCapabilities: s.clientCapabilities,
+		ServerCapabilities: s.serverCapabilities,
+		ClientInfo:         s.clientInfo,
+	}
+}
+
+// restore adopts state saved by another instance.
+func (s *Session) restore(state *SessionState) {
+	s.mu.Lock()
+	s.protocolVersion = state.ProtocolVersion
+	s.encoding = state.Encoding
+	s.clientCapabilities = state.ClientCapabilities
+	s.serverCapabilities = state.ServerCapabilities
+	s.clientInfo = state.ClientInfo
+	// Only initialize creates stored state.
+	s.initialized = true
+	s.mu.Unlock()
+}
+
+// Close releases resources held for the session, such as its passthrough
+// upstream. Serve calls it on return; transports that do not use Serve call
+// it when the session ends.
+func (s *Session) Close() {
+	s.setUpstream(nil)
+	s.handler.unsubscribeAll(s)
+	s.dropState()
+
+	s.mu.Lock()
+	admittedBy := s.admittedBy
+	s.admittedBy = nil
+	s.mu.Unlock()
+	if admittedBy != nil {
+		admittedBy.releaseSession()
+		admittedBy.untrackSession(s)
+		admittedBy.sessionEnded(s)
+	}
+}
+
+// Notify sends a notification to the client: written to framed sessions,
+// where a write buffer flushes it within Config.FlushDelay, and queued for
+// the next event stream on HTTP ones.
+func (s *Session) Notify(method string, params map[string]interface{}) error {
+	msg, err := newNotification(method, params)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	out, push := s.out, s.push
+	s.mu.RUnlock()
+
+	switch {
+	case out != nil:
+		frame, err := s.codec.Encode(msg)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(frame)
+		return err
+	case push != nil:
+		return push(msg)
+	default:
+		return errors.New("session cannot receive notifications")
+	}
+}
+
+// trackSession adds an initialized session to those broadcast sends to.
+func (h *Handler) trackSession(sess *Session) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	if h.sessions == nil {
+		h.sessions = make(map[*Session]struct{})
+	}
+	h.sessions[sess] = struct{}{}
+}
+
+func (h *Handler) untrackSession(sess *Session) {
+	h.sessionsMu.Lock()
+	defer h.sessionsMu.Unlock()
+	delete(h.sessions, sess)
+}
+
+// broadcastListChanged sends notifications/<capability>/list_changed to
+// every initialized session of this Handler that can receive one and was
+// told the list may change, on this instance and, with a ClusterBus, on
+// every other.
+func (h *Handler) broadcastListChanged(capability string) {
+	h.deliverListChanged(capability)
+	if h.cluster != nil {
+		h.cluster.sentListChanged(h.tenant.name, capability)
+		h.cluster.publish(clusterMessage{Tenant: h.tenant.name, Kind: clusterListChanged, Capability: capability})
+	}
+}
+
+// deliverListChanged is broadcastListChanged for this instance's sessions.
+func (h *Handler) deliverListChanged(capability string) {
+	h.sessionsMu.Lock()
+	sessions := make([]*Session, 0, len(h.sessions))
+	for sess := range h.sessions {
+		if sess.declaresListChanged(capability) {
+			sessions = append(sessions, sess)
+		}
+	}
+	h.sessionsMu.Unlock()
+
+	method := "notifications/" + capability + "/list_changed"
+	for _, sess := range sessions {
+		if err := sess.Notify(method, nil); err != nil {
+			sess.logger.Debug("notification not delivered", "method", method, "error", err)
+		}
 	}
 }
 
 // Run processes the WebTransport session until completion.
 func (s *Session) Run(ctx context.Context, wt *webtransport.Session) error {
-	stream, err := wt.AcceptStream(ctx)
+	stream, err := s.acceptControlStream(ctx, wt)
+	if errors.Is(err, errStreamTimeout) {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("accept stream: %w", err)
 	}
 	defer stream.Close()
+	s.openClientStream()
+	defer s.clientStreamDone()
 
 	s.logger.Info("control stream opened")
+	s.setStreamOpener(wt)
+	s.acceptClientStreams(ctx, wt)
+
+	err = s.Serve(ctx, stream, stream)
+	if errors.Is(err, errInitTimeout) || errors.Is(err, errTooManyErrors) {
+		// Closing the control stream alone would leave the client holding
+		// the session.
+		wt.CloseWithError(0, err.Error())
+	}
+	return err
+}
+
+// Serve reads requests from r and writes responses to w using the session
+// codec until r reaches EOF or ctx is cancelled. It is the transport-neutral
+// core shared by WebTransport and stdio.
+//
+// Decoding runs on its own goroutine, up to sessionPipelineDepth requests
+// ahead, so parsing the next frame overlaps with handling the current one.
+// Requests are still handled, and answered, one at a time in order.
+func (s *Session) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	defer s.Close()
+	if s.handler.cfg.Lenient && s.handler.proxyPool == nil {
+		s.codec = s.sniffFraming(s.codec)
+	}
+	out := newSessionWriter(w, s.handler.cfg, s.budget)
+	out.overflow = func() {
+		s.logger.Warn("client too far behind, closing session", "limit", s.budget.limit)
+		abortStreams(r, w)
+	}
+	s.mu.Lock()
+	s.out = out
+	if s.handler.cfg.ErrorRate > 0 {
+		s.errThrottle = newErrorThrottle(s.handler.cfg)
+	}
+	s.mu.Unlock()
+	defer s.parkResumable(out)
+	defer s.handler.drain.join(s)()
+	defer out.Flush()
+
+	if _, framed := s.codec.(*FrameCodec); framed && s.handler.proxyPool != nil {
+		return s.proxy(ctx, r, out)
+	}
+	reqs := make(chan decodedRequest, sessionPipelineDepth)
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.decode(bufio.NewReader(r), reqs, stop)
+	if interval := s.handler.cfg.PingInterval; interval > 0 {
+		go s.pingIdle(out, interval, stop)
+	}
+
+	initTimeout, stopInit := s.initDeadline()
+	defer stopInit()
 
 	for {
+		var next decodedRequest
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		default:
+		case <-initTimeout:
+			s.logger.Warn("no initialize in time, closing session", "timeout", s.handler.cfg.InitTimeout)
+			s.handler.metrics.ObserveSessionClosed(closedInitTimeout)
+			return errInitTimeout
+		case next = <-reqs:
 		}
 
-		req, err := s.codec.Decode(stream)
+		req, err := next.req, next.err
 		if err != nil {
+			if out.failed.Load() {
+				return errSessionMemory
+			}
+			var gap *sequenceError
+			var damaged *checksumError
+			if errors.As(err, &gap) || errors.As(err, &damaged) {
+				s.logger.Error("frame lost, reordered, or damaged, closing session", "error", err)
+				if frame, encErr := s.codec.Encode(s.handler.corruptedResponse(err)); encErr == nil {
+					out.Write(frame)
+				}
+				return err
+			}
 			if errors.Is(err, io.EOF) {
 				return nil
 			}
 			return fmt.Errorf("decode: %w", err)
 		}
 
+		if isReply(req) {
+			s.handleReply(req)
+			continue
+		}
 		s.logger.Debug("received", "method", req.Method, "id", req.ID)
 
-		resp := s.handler.Handle(req)
+		resp := s.handler.Handle(s, req)
+		if s.isClosing() {
+			return s.finishShutdown(reqs, out)
+		}
+		if s.tooManyErrors() {
+			s.logger.Warn("client drew too many errors, closing session")
+			s.handler.metrics.ObserveSessionClosed(closedForErrors)
+			return errTooManyErrors
+		}
 		if resp == nil {
 			continue
 		}
@@ -395,11 +1753,70 @@ func (s *Session) Run(ctx context.Context, wt *webtransport.Session) error {
 			continue
 		}
 
-		if _, err := stream.Write(frame); err != nil {
+		if _, err := out.Write(frame); err != nil {
 			return fmt.Errorf("write: %w", err)
 		}
+		// Hold the response back while more requests are already waiting,
+		// so their responses can share packets with it.
+		if len(reqs) == 0 {
+			if err := out.Flush(); err != nil {
+				return fmt.Errorf("write: %w", err)
+			}
+		}
 
 		s.logger.Debug("sent", "id", resp.ID, "hasError", resp.Error != nil)
+
+		if req.Method == "initialize" && s.sequencesFrames() {
+			if err := s.startSequencing(out); err != nil {
+				s.logger.Error("resume failed, closing session", "error", err)
+				if frame, encErr := s.codec.Encode(s.handler.corruptedResponse(err)); encErr == nil {
+					out.Write(frame)
+				}
+				return err
+			}
+		}
+		if req.Method == "initialize" {
+			initTimeout = nil
+		}
+		if req.Method == "initialize" && s.checksumsFrames() {
+			out.startChecksums()
+		}
+		if req.Method == "initialize" && s.handler.drain.isDraining() {
+			s.goAway()
+		}
+	}
+}
+
+// decodedRequest is a request, or the error that ended the stream, passed
+// from a session's decoder to its serve loop.
+type decodedRequest struct {
+	req *RPCRequest
+	err error
+}
+
+// decode feeds Serve the requests read from br until a decode error, which
+// it passes on last, or until stop is closed. A gap in the numbers of
+// sequenced frames is such an error, as is a frame that fails its
+// checksum.
+func (s *Session) decode(br *bufio.Reader, reqs chan<- decodedRequest, stop <-chan struct{}) {
+	var seq uint64
+	var checksummed bool
+	for {
+		req, err := s.codec.Decode(br)
+		if err == nil {
+			seq, err = nextSequence(seq, req.seq)
+		}
+		if err == nil {
+			checksummed, err = nextChecksummed(checksummed, req.checksummed)
+		}
+		select {
+		case reqs <- decodedRequest{req, err}:
+		case <-stop:
+			return
+		}
+		if err != nil {
+			return
+		}
 	}
 }
 
@@ -409,22 +1826,57 @@ func (s *Session) Run(ctx context.Context, wt *webtransport.Session) error {
 
 // Server is an MCP-Flow WebTransport server.
 type Server struct {
-	addr     string
-	certFile string
-	keyFile  string
-	logger   *slog.Logger
+	addr       string
+	certFile   string
+	keyFile    string
+	cfg        Config
+	handler    *Handler
+	streamable *streamableHTTP
+	legacySSE  *legacySSE
+	logger     *slog.Logger
+	started    time.Time
+
+	// awaiting holds the upgrade deadline of each QUIC connection yet to
+	// send a request; see serveQUICConn.
+	awaiting sync.Map
 }
 
 // NewServer creates a new MCP-Flow server.
-func NewServer(addr, certFile, keyFile string, logger *slog.Logger) *Server {
+func NewServer(addr, certFile, keyFile string, cfg Config, logger *slog.Logger) *Server {
+	handler := NewHandler(cfg)
 	return &Server{
-		addr:     addr,
-		certFile: certFile,
-		keyFile:  keyFile,
-		logger:   logger,
+		addr:       addr,
+		certFile:   certFile,
+		keyFile:    keyFile,
+		cfg:        cfg,
+		handler:    handler,
+		streamable: newStreamableHTTP(handler, cfg.SessionStore, logger),
+		legacySSE:  newLegacySSE(handler, logger),
+		logger:     logger,
+		started:    time.Now(),
 	}
 }
 
+// Handler returns the request handler shared by all sessions, for
+// registering tools and capabilities before or while serving.
+func (s *Server) Handler() *Handler {
+	return s.handler
+}
+
+// NotifySession queues a notification for a Streamable HTTP session. It is
+// delivered on the session's next event-stream response by whichever
+// instance sharing the SessionStore serves it.
+func (s *Server) NotifySession(id, method string, params map[string]interface{}) error {
+	return s.streamable.notify(id, method, params)
+}
+
+// mountHTTPTransports registers the standard MCP HTTP transports.
+func (s *Server) mountHTTPTransports(mux *http.ServeMux) {
+	mux.Handle("/mcp", s.authenticate(s.trackRequests(s.streamable)))
+	mux.Handle(legacySSEPath, s.shedUpgrades(s.authenticate(http.HandlerFunc(s.legacySSE.handleStream))))
+	mux.Handle(legacyMessagesPath, s.authenticate(s.trackRequests(http.HandlerFunc(s.legacySSE.handleMessage))))
+}
+
 // Run starts the server and blocks until shutdown.
 func (s *Server) Run(ctx context.Context) error {
 	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
@@ -432,13 +1884,34 @@ func (s *Server) Run(ctx context.Context) error {
 		return fmt.Errorf("load TLS cert: %w", err)
 	}
 
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+	}
+	if s.cfg.PostQuantum {
+		if len(hybridKeyExchanges) == 0 {
+			return errors.New("post-quantum key exchange needs a build with Go 1.24 or later")
+		}
+		tlsConfig.CurvePreferences = hybridKeyExchanges
+	}
+	if len(s.cfg.ECHKeys) > 0 {
+		if err := setECHKeys(tlsConfig, s.cfg.ECHKeys); err != nil {
+			return err
+		}
+		s.logger.Info("encrypted client hello enabled",
+			"config_list", base64.StdEncoding.EncodeToString(mcpflow.ECHConfigList(s.cfg.ECHKeys)))
+	}
+	if err := s.applyCryptoPolicy(tlsConfig); err != nil {
+		return err
+	}
+	s.reportTLS(tlsConfig)
+
 	wtServer := &webtransport.Server{
 		H3: http3.Server{
-			Addr: s.addr,
-			TLSConfig: &tls.Config{
-				Certificates: []tls.Certificate{cert},
-				MinVersion:   tls.VersionTLS13,
-			},
+			Addr:        s.addr,
+			TLSConfig:   tlsConfig,
+			QuicConfig:  &quic.Config{Allow0RTT: s.cfg.EarlyData, HandshakeIdleTimeout: s.cfg.HandshakeTimeout},
+			ConnContext: withQUICConn,
 		},
 		CheckOrigin: func(r *http.Request) bool {
 			origin := r.Header.Get("Origin")
@@ -448,7 +1921,7 @@ func (s *Server) Run(ctx context.Context) error {
 	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/mcp-flow", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/mcp-flow", s.shedUpgrades(s.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		session, err := wtServer.Upgrade(w, r)
 		if err != nil {
 			s.logger.Error("upgrade failed", "error", err)
@@ -459,26 +1932,60 @@ func (s *Server) Run(ctx context.Context) error {
 		sessionLogger := s.logger.With("remote", r.RemoteAddr)
 		sessionLogger.Info("session established")
 
-		sess := NewSession(sessionLogger)
+		sess := NewSession(routeFrom(r.Context(), s.handler).handler, sessionLogger)
+		sess.setPeer("webtransport", r.RemoteAddr)
+		sess.setEarlyData(usedEarlyData(r))
 		go func() {
 			if err := sess.Run(ctx, session); err != nil && !errors.Is(err, context.Canceled) {
 				sessionLogger.Error("session error", "error", err)
 			}
 			sessionLogger.Info("session closed")
 		}()
-	})
+	}))))
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"name":     serverName,
-			"version":  serverVersion,
-			"protocol": "mcp-flow/" + mcpFlowVersion,
-			"status":   "ready",
-		})
-	})
+	s.mountHTTPTransports(mux)
+
+	info, err := s.infoHandler()
+	if err != nil {
+		return err
+	}
+	if info != nil {
+		mux.Handle("/", info)
+	}
+
+	s.mountTenants(mux)
+	wtServer.H3.Handler = s.requestArrived(securityHeaders(mux))
+
+	go s.handler.load.watch(ctx, s.logger)
+	go s.streamable.sweep(ctx)
 
-	wtServer.H3.Handler = mux
+	if s.cfg.AdminAddr != "" {
+		admin := &http.Server{Addr: s.cfg.AdminAddr, Handler: securityHeaders(s.adminMux())}
+		go func() {
+			s.logger.Info("admin listener starting", "addr", s.cfg.AdminAddr)
+			if s.cfg.AuthToken == "" {
+				s.logger.Warn("admin /drain and /usage not served without an auth token")
+			}
+			if err := admin.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.Error("admin listener failed", "error", err)
+			}
+		}()
+		defer admin.Close()
+	}
+
+	if s.cfg.Registrar != nil {
+		registered := make(chan struct{})
+		go func() {
+			defer close(registered)
+			s.runRegistration(ctx)
+		}()
+		// Deregister before returning, so the process does not exit first.
+		defer func() { <-registered }()
+	}
+
+	if s.handler.cluster != nil {
+		go s.runCluster(ctx)
+	}
 
 	s.logger.Info("server starting",
 		"addr", s.addr,
@@ -495,14 +2002,56 @@ func (s *Server) Run(ctx context.Context) error {
 ┗━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━┛
 `, s.addr, mcpFlowVersion)
 
-	errCh := make(chan error, 1)
+	errCh := make(chan error, 3)
 	go func() {
-		errCh <- wtServer.ListenAndServe()
+		ln, err := listenQUIC(s.addr, tlsConfig, wtServer.H3.QuicConfig)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer ln.Close()
+		for {
+			conn, err := ln.Accept(ctx)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			go s.serveQUICConn(wtServer, conn)
+		}
 	}()
 
+	if s.cfg.HTTPAddr != "" {
+		httpMux := http.NewServeMux()
+		s.mountHTTPTransports(httpMux)
+		httpMux.Handle(webSocketPath, s.shedUpgrades(s.authenticate(s.webSocketHandler(ctx))))
+		s.mountTenants(httpMux)
+		httpServer := &http.Server{
+			Addr:              s.cfg.HTTPAddr,
+			Handler:           securityHeaders(httpMux),
+			TLSConfig:         tlsConfig.Clone(),
+			ReadHeaderTimeout: s.cfg.UpgradeTimeout,
+		}
+		go func() {
+			s.logger.Info("streamable http listening", "addr", s.cfg.HTTPAddr)
+			if err := httpServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("streamable http: %w", err)
+			}
+		}()
+		defer httpServer.Close()
+	}
+
+	if s.cfg.TCPAddr != "" {
+		go func() {
+			if err := s.serveTCP(ctx, tlsConfig); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+
 	select {
 	case <-ctx.Done():
 		s.logger.Info("shutting down")
+		s.runShutdownHooks()
 		return wtServer.Close()
 	case err := <-errCh:
 		return err
@@ -518,6 +2067,98 @@ func main() {
 	certFile := flag.String("cert", "cert.pem", "TLS certificate file")
 	keyFile := flag.String("key", "key.pem", "TLS private key file")
 	verbose := flag.Bool("v", false, "Enable debug logging")
+	idempotencyWindow := flag.Duration("idempotency-window", defaultIdempotencyWindow, "How long to retain tools/call results for idempotency keys (0 disables)")
+	cacheTTL := flag.Duration("cache-ttl", 0, "Cache results of read-only methods for this long (0 disables)")
+	cacheSize := flag.Int("cache-size", defaultResponseCacheSize, "Maximum entries in the in-memory response cache")
+	writeBuffer := flag.Int("write-buffer", 0, "Coalesce outgoing frames of each framed session in a buffer of this many bytes (0 writes every frame immediately)")
+	flushDelay := flag.Duration("flush-delay", defaultFlushDelay, "Longest a frame waits in the -write-buffer before it is flushed")
+	toolWorkers := flag.Int("tool-workers", defaultToolWorkers, "Tool calls that may run at once (0 runs each on its own goroutine, unbounded)")
+	toolQueue := flag.Int("tool-queue", defaultToolQueue, "Tool calls that may wait for a -tool-workers slot before more are rejected as overloaded")
+	memoryLimit := flag.Int64("memory-limit", 0, "Process memory in bytes to stay under by refusing new tool calls and sessions near it (0 disables)")
+	ackNotifications := flag.Bool("ack-notifications", false, "Number Streamable HTTP notifications and redeliver them until clients that opt in acknowledge them")
+	pingInterval := flag.Duration("ping-interval", 0, "Ping framed clients idle this long and report the round-trip time in stats (0 disables)")
+	resumeWindow := flag.Duration("resume-window", 0, "Let clients that number their frames resume a dropped session within this long and replay what they missed (0 disables)")
+	outboxPath := flag.String("outbox", "", "Keep critical notifications to resumable sessions in this file until acknowledged, across restarts (empty disables)")
+	outboxTTL := flag.Duration("outbox-ttl", defaultOutboxTTL, "How long -outbox keeps a client's unacknowledged notifications")
+	lenient := flag.Bool("lenient", false, "Accept known quirks of other MCP implementations: no jsonrpc member, numeric IDs as strings, NDJSON on framed streams")
+	sessionMemory := flag.Int("session-memory", defaultSessionMemory, "Bytes of pending frames and queued notifications one client may hold before it is disconnected (0 disables)")
+	stateLimit := flag.Int("state-limit", defaultStateLimit, "Bytes of keys and values one session may keep in its tool state (0 disables)")
+	adminAddr := flag.String("admin-addr", "", "Plain-HTTP admin listener address for /metrics, /readyz, /drain, and /stats (empty disables)")
+	tcpAddr := flag.String("tcp-addr", "", "TCP+TLS fallback listener address for clients without UDP (empty disables)")
+	earlyData := flag.Bool("0rtt", false, "Accept QUIC 0-RTT resumption, checking tools/call nonces for replays")
+	replayWindow := flag.Duration("replay-window", defaultReplayWindow, "How far a tools/call's _meta.issuedAt may be from now, and how long its nonce is remembered, with -0rtt")
+	errorRate := flag.Float64("error-rate", 0, "Protocol error responses per second a session is sent before the rest are dropped (0 disables)")
+	errorBurst := flag.Int("error-burst", 0, "Protocol error responses a session may draw at once under -error-rate (0 means the rate)")
+	errorClose := flag.Int("error-close", defaultErrorClose, "Dropped error responses after which a session is closed, with -error-rate")
+	handshakeTimeout := flag.Duration("handshake-timeout", 10*time.Second, "How long a TLS or QUIC handshake may take (0 waits indefinitely)")
+	upgradeTimeout := flag.Duration("upgrade-timeout", 10*time.Second, "How long a new connection may take to send its first HTTP request, such as the WebTransport upgrade (0 waits indefinitely)")
+	streamTimeout := flag.Duration("stream-timeout", 10*time.Second, "How long a WebTransport session may take to open its control stream (0 waits indefinitely)")
+	initTimeout := flag.Duration("init-timeout", 30*time.Second, "How long a session may take to send initialize (0 waits indefinitely)")
+	httpAddr := flag.String("http-addr", "", "HTTPS listener address for the MCP Streamable HTTP (/mcp), legacy SSE (/sse), and WebSocket transports (empty disables)")
+	stdio := flag.String("stdio", "", "Also serve MCP on stdin/stdout with this framing: ndjson or length (empty disables)")
+	authToken := flag.String("auth-token", os.Getenv("MCPFLOW_AUTH_TOKEN"), "Bearer token clients must present (default $MCPFLOW_AUTH_TOKEN; empty disables auth)")
+	info := flag.String("info", infoPublic, "Who may read the server description at /: public, auth (the -auth-token), or off")
+	infoFieldList := flag.String("info-fields", "", "Comma-separated fields the server description at / shows, of name, version, protocol, status, and alternatives (empty shows all)")
+	postQuantum := flag.Bool("pq", false, "Allow only hybrid X25519+ML-KEM TLS key exchange, on listeners and upstream connections (needs Go 1.24)")
+	cryptoPolicy := flag.String("crypto-policy", "", "Limit TLS to an approved set of algorithms and refuse to start otherwise: fips (empty allows Go's defaults)")
+	echKey := flag.String("ech-key", "", "Accept Encrypted Client Hello with the keys in this PEM file, from mcpflow gen ech-key or openssl ech (empty disables)")
+	signingKey := flag.String("signing-key", "", "Sign every response with this Ed25519 private key, a PKCS #8 PEM file (empty disables)")
+	var upstreams upstreamFlags
+	flag.Var(&upstreams, "upstream", "Aggregate a backend MCP server as name=target (flow://, tcp://, wss://, https://, or stdio:command); repeatable")
+	var imports upstreamFlags
+	flag.Var(&imports, "import", "Import a remote MCP server's tools as name=target, refreshed on its list_changed notifications; repeatable")
+	upstreamToken := flag.String("upstream-token", os.Getenv("MCPFLOW_UPSTREAM_TOKEN"), "Bearer token presented to -upstream, -import, and -proxy servers (default $MCPFLOW_UPSTREAM_TOKEN)")
+	upstreamInsecure := flag.Bool("upstream-insecure", false, "Skip TLS verification for -upstream, -import, -proxy, and -grpc servers")
+	var proxyBackends proxyFlags
+	flag.Var(&proxyBackends, "proxy", "Reverse proxy sessions to this MCP-Flow backend (flow://, tcp://, or wss://, optionally ,weight=N); repeat to balance across a pool")
+	sessionStore := flag.String("session-store", "", "Share Streamable HTTP sessions across instances through this store: redis[s]://[[user]:password@]host:port[/db] (empty keeps them in memory)")
+	registry := flag.String("registry", "", "Register this server in a service registry: consul://host:port or etcd://host:port (empty disables)")
+	advertiseHost := flag.String("advertise-host", "", "Host name or IP published to -registry (default: the -addr host, else the machine's host name)")
+	var openAPIs openAPIFlags
+	flag.Var(&openAPIs, "openapi", "Serve each operation of an OpenAPI 3 document (file or URL, JSON or YAML) as a tool, as name=source[,base=URL]; repeatable")
+	openAPIHeader := headerFlags{}
+	flag.Var(openAPIHeader, "openapi-header", "Header sent with every -openapi call, as \"Name: value\"; repeatable")
+	var httpTools namedFileFlags
+	flag.Var(&httpTools, "http-tools", "Serve the HTTP request templates in a YAML or JSON file as tools, as name=file; repeatable")
+	var commandTools namedFileFlags
+	flag.Var(&commandTools, "command-tools", "Serve the allowlisted commands in a YAML or JSON file as sandboxed tools, as name=file; repeatable")
+	var starlarkDirs namedFileFlags
+	flag.Var(&starlarkDirs, "starlark", "Serve the Starlark tools (*.star) in a directory, reloaded when they change, as name=dir; repeatable")
+	var sqlDBs namedFileFlags
+	flag.Var(&sqlDBs, "sql", "Serve a database's configured read-only queries as tools and its tables as resources, as name=config.yaml; repeatable")
+	resourcesDir := flag.String("resources-dir", "", "Serve the files under this directory as file:// resources, with change notifications for subscribers (empty disables)")
+	resourcesMaxSize := flag.Int64("resources-max-size", defaultMaxResourceFile, "Largest file -resources-dir serves whole, in bytes; larger ones can be read in ranges")
+	resourceChunk := flag.Int("resource-chunk", defaultResourceChunk, "Most bytes one ranged resources/read returns (0 disables the cap)")
+	contentHashMin := flag.Int("content-hash-min", defaultContentHashMin, "Size in bytes from which tool and resource payloads are sent once, then by hash, to clients that ask (0 disables)")
+	var grpcs grpcFlags
+	flag.Var(&grpcs, "grpc", "Serve each unary method of a gRPC server as a tool, described by server reflection or a descriptor set, as name=host:port[,tls][,descriptors=FILE][,service=NAME]; repeatable")
+	grpcMetadata := headerFlags{}
+	flag.Var(grpcMetadata, "grpc-metadata", "Metadata sent with every -grpc call, as \"key: value\"; repeatable")
+	toolsDir := flag.String("tools-dir", "", "Load tools from the Go plugins (*.so) and WASM modules (*.wasm) in this directory, each under a namespace named after its file, and reload them as files are added, rebuilt, or removed (empty disables)")
+	wasmMemory := flag.Int64("wasm-memory", defaultWASMMaxMemory, "Memory limit in bytes of each WASM tool instance")
+	wasmTimeout := flag.Duration("wasm-timeout", defaultWASMTimeout, "Time limit of each WASM tool call")
+	var faults faultFlags
+	flag.Var(&faults, "fault", "Inject latency and errors for staging, as method[,latency=D][,jitter=D][,error-rate=F][,code=N][,tenant=NAME] (method * for all); repeatable")
+	faultSeed := flag.Int64("fault-seed", 1, "Seed for the random draws of -fault, so a run can be repeated")
+	usageBucket := flag.Duration("usage-bucket", 0, "Count tool calls by tool, tenant, and client in buckets this long, reported at the admin /usage/report (0 disables)")
+	usageRetention := flag.Duration("usage-retention", defaultUsageRetention, "How long -usage-bucket keeps usage in memory")
+	usageExport := flag.String("usage-export", "", "Append a JSON line per finished tool call, with tenant, client, tool, duration, and bytes, to this file for metering (empty disables)")
+	events := flag.String("events", "", "Publish session and tool-call events to a broker: nats://[user:password@]host:port or kafka://host:port of a Kafka REST Proxy (empty disables)")
+	eventTopic := flag.String("events-topic", defaultEventTopic, "Topic prefix -events publishes under, followed by . and the event type")
+	clusterURL := flag.String("cluster", "", "Share broadcasts and list_changed notifications with other instances over this pub/sub bus: redis://host:6379 or nats://host:4222 (empty disables)")
+	clusterChannel := flag.String("cluster-channel", defaultClusterChannel, "Channel or subject -cluster exchanges messages on")
+	var exclusive exclusiveFlags
+	flag.Var(&exclusive, "exclusive", "Run this tool one call at a time, across every instance sharing -locker; repeatable")
+	lockerURL := flag.String("locker", "", "Lock exclusive tools across instances through redis[s]://[[user]:password@]host:port[/db] or etcd://host:port (empty locks within this process)")
+	lockWait := flag.Duration("lock-wait", 0, "How long a call of an exclusive tool waits for a running one to finish before failing with busy")
+	var webhooks webhookFlags
+	flag.Var(&webhooks, "webhook", "POST server events to this URL, HMAC-signed with the secret (default $MCPFLOW_WEBHOOK_SECRET), as URL[,secret=S][,event=TYPE]...; repeatable")
+	toolRates := toolRateFlags{}
+	flag.Var(toolRates, "tool-rate", "Limit each session's calls to a tool, as name=calls-per-second[,burst=N]; repeatable")
+	var tenants tenantFlags
+	flag.Var(&tenants, "tenant", "Serve a separate tool registry to clients presenting this token, and under /tenants/<name>/, as name:token[,max-sessions=N][,requests=N][,tool-time=D][,bytes=N][,window=D]; repeatable")
+	mdns := flag.Bool("mdns", false, "Advertise this server on the local network over mDNS as _mcpflow._udp.local")
+	healthInterval := flag.Duration("health-interval", defaultHealthInterval, "How often to probe pooled -upstream and -proxy backends (0 disables)")
 	flag.Parse()
 
 	// Configure logging
@@ -530,15 +2171,21 @@ func main() {
 		Level: logLevel,
 	}))
 
-	// Validate certificate files exist
-	if _, err := os.Stat(*certFile); os.IsNotExist(err) {
-		logger.Error("certificate file not found", "path", *certFile)
-		fmt.Fprintln(os.Stderr, "\nGenerate certificates with:")
-		fmt.Fprintln(os.Stderr, "  openssl req -x509 -newkey rsa:4096 -keyout key.pem -out cert.pem -days 365 -nodes -subj \"/CN=localhost\"")
-		os.Exit(1)
-	}
-	if _, err := os.Stat(*keyFile); os.IsNotExist(err) {
-		logger.Error("key file not found", "path", *keyFile)
+	// Validate certificate files exist. Without -addr only stdio is served
+	// and no certificate is needed.
+	if *addr != "" {
+		if _, err := os.Stat(*certFile); os.IsNotExist(err) {
+			logger.Error("certificate file not found", "path", *certFile)
+			fmt.Fprintln(os.Stderr, "\nGenerate certificates with:")
+			fmt.Fprintln(os.Stderr, "  openssl req -x509 -newkey rsa:4096 -keyout key.pem -out cert.pem -days 365 -nodes -subj \"/CN=localhost\"")
+			os.Exit(1)
+		}
+		if _, err := os.Stat(*keyFile); os.IsNotExist(err) {
+			logger.Error("key file not found", "path", *keyFile)
+			os.Exit(1)
+		}
+	} else if *stdio == "" {
+		logger.Error("nothing to serve: set -addr and/or -stdio")
 		os.Exit(1)
 	}
 
@@ -546,9 +2193,402 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	server := NewServer(*addr, *certFile, *keyFile, logger)
+	cfg := Config{
+		IdempotencyWindow: *idempotencyWindow,
+		ResponseCacheTTL:  *cacheTTL,
+		ResponseCacheSize: *cacheSize,
+		WriteBuffer:       *writeBuffer,
+		FlushDelay:        *flushDelay,
+		MemoryLimit:       *memoryLimit,
+		ToolWorkers:       *toolWorkers,
+		ToolQueue:         *toolQueue,
+		SessionMemory:     *sessionMemory,
+		StateLimit:        *stateLimit,
+		ResourceChunk:     *resourceChunk,
+		ContentHashMin:    *contentHashMin,
+		Lenient:           *lenient,
+		AckNotifications:  *ackNotifications,
+		ResumeWindow:      *resumeWindow,
+		PingInterval:      *pingInterval,
+		OutboxTTL:         *outboxTTL,
+		TCPAddr:           *tcpAddr,
+		HTTPAddr:          *httpAddr,
+		EarlyData:         *earlyData,
+		ReplayWindow:      *replayWindow,
+		ErrorRate:         *errorRate,
+		ErrorBurst:        *errorBurst,
+		ErrorClose:        *errorClose,
+		ToolRates:         toolRates,
+		UsageBucket:       *usageBucket,
+		UsageRetention:    *usageRetention,
+		Webhooks:          webhooks,
+		EventTopic:        *eventTopic,
+		ClusterChannel:    *clusterChannel,
+		ExclusiveTools:    exclusive,
+		LockWait:          *lockWait,
+		HandshakeTimeout:  *handshakeTimeout,
+		UpgradeTimeout:    *upgradeTimeout,
+		StreamTimeout:     *streamTimeout,
+		InitTimeout:       *initTimeout,
+		AdminAddr:         *adminAddr,
+		AuthToken:         *authToken,
+		Info:              *info,
+		PostQuantum:       *postQuantum,
+		CryptoPolicy:      *cryptoPolicy,
+		AdvertiseHost:     *advertiseHost,
+		WASMMaxMemory:     *wasmMemory,
+		WASMTimeout:       *wasmTimeout,
+	}
+
+	if *memoryLimit > 0 && os.Getenv("GOMEMLIMIT") == "" {
+		// Have the GC work harder as memory nears the limit, before load
+		// has to be shed.
+		debug.SetMemoryLimit(*memoryLimit)
+	}
+
+	if *echKey != "" {
+		data, err := os.ReadFile(*echKey)
+		if err == nil {
+			cfg.ECHKeys, err = mcpflow.ParseECHKeys(data)
+		}
+		if err != nil {
+			logger.Error("invalid -ech-key", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *signingKey != "" {
+		key, err := loadSigningKey(*signingKey)
+		if err != nil {
+			logger.Error("invalid -signing-key", "error", err)
+			os.Exit(1)
+		}
+		cfg.SigningKey = key
+	}
+
+	if *infoFieldList != "" {
+		cfg.InfoFields = strings.Split(*infoFieldList, ",")
+	}
+
+	if len(tenants) > 0 {
+		if err := validateTenants(cfg, tenants); err != nil {
+			logger.Error("invalid -tenant", "error", err)
+			os.Exit(1)
+		}
+		cfg.Tenants = tenants
+	}
+
+	if len(faults) > 0 {
+		if err := validateFaults(faults, tenants); err != nil {
+			logger.Error("invalid -fault", "error", err)
+			os.Exit(1)
+		}
+		cfg.Faults, cfg.FaultSeed = faults, *faultSeed
+	}
+
+	if *registry != "" {
+		registrar, err := NewRegistrar(*registry, "/mcpflow/servers/")
+		if err != nil {
+			logger.Error("invalid -registry", "error", err)
+			os.Exit(1)
+		}
+		cfg.Registrar = registrar
+	}
+
+	upstreamOptions := func(u UpstreamConfig, component string) UpstreamConfig {
+		if len(u.Options.Command) == 0 {
+			u.Options.Token = *upstreamToken
+		}
+		u.Options.TLSConfig = &tls.Config{InsecureSkipVerify: *upstreamInsecure}
+		u.Options.PostQuantum = *postQuantum
+		u.Options.Logger = logger.With("component", component, "upstream", u.Name)
+		return u
+	}
+	for _, u := range upstreams {
+		cfg.Upstreams = append(cfg.Upstreams, upstreamOptions(u, "gateway"))
+	}
+
+	// Arguments after the flags name a stdio MCP server to wrap: each
+	// session gets its own instance of it instead of the local tools.
+	if flag.NArg() > 0 {
+		cfg.Passthrough = &mcpflowclient.Options{
+			Command:        flag.Args(),
+			Order:          []string{mcpflowclient.TransportStdio},
+			Stderr:         os.Stderr,
+			AttemptTimeout: passthroughConnectTimeout,
+			Logger:         logger.With("upstream", flag.Arg(0)),
+		}
+	}
+
+	// What main opens from here on is closed once the server's shutdown
+	// hooks, which may still write to it, have run. Failures exit through
+	// exit, since os.Exit would skip deferred closes.
+	var server *Server
+	var closers []io.Closer
+	shutdown := func() {
+		if server != nil {
+			server.runShutdownHooks()
+		}
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i].Close()
+		}
+	}
+	exit := func(code int) {
+		shutdown()
+		os.Exit(code)
+	}
+
+	if *outboxPath != "" {
+		outbox, err := OpenFileOutbox(*outboxPath)
+		if err != nil {
+			logger.Error("invalid -outbox", "error", err)
+			exit(1)
+		}
+		closers = append(closers, outbox)
+		cfg.Outbox = outbox
+	}
+
+	if *events != "" {
+		publisher, err := NewEventPublisher(*events)
+		if err != nil {
+			logger.Error("invalid -events", "error", err)
+			exit(1)
+		}
+		cfg.EventPublisher = publisher
+	}
+
+	if *clusterURL != "" {
+		bus, err := NewClusterBus(*clusterURL)
+		if err != nil {
+			logger.Error("invalid -cluster", "error", err)
+			exit(1)
+		}
+		cfg.ClusterBus = bus
+	}
+
+	if *lockerURL != "" {
+		locker, err := NewLocker(*lockerURL)
+		if err != nil {
+			logger.Error("invalid -locker", "error", err)
+			exit(1)
+		}
+		cfg.Locker = locker
+	}
+
+	if *usageExport != "" {
+		f, err := os.OpenFile(*usageExport, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			logger.Error("invalid -usage-export", "error", err)
+			exit(1)
+		}
+		closers = append(closers, f)
+		cfg.UsageSink = NewJSONUsageSink(f)
+	}
+
+	if *sessionStore != "" {
+		store, err := NewRedisSessionStore(*sessionStore, "mcpflow:")
+		if err != nil {
+			logger.Error("invalid -session-store", "error", err)
+			exit(1)
+		}
+		cfg.SessionStore = store
+		cfg.StateStore = store.StateStore()
+	}
+
+	if len(proxyBackends) > 0 {
+		if flag.NArg() > 0 || len(upstreams) > 0 || len(tenants) > 0 {
+			logger.Error("-proxy cannot be combined with -upstream, -tenant, or a wrapped command")
+			exit(1)
+		}
+		for _, b := range proxyBackends {
+			b.Options.Token = *upstreamToken
+			b.Options.TLSConfig = &tls.Config{InsecureSkipVerify: *upstreamInsecure}
+			b.Options.PostQuantum = *postQuantum
+			b.Options.Logger = logger.With("component", "proxy", "backend", b.Name)
+			cfg.ProxyBackends = append(cfg.ProxyBackends, b)
+		}
+	}
+
+	server = NewServer(*addr, *certFile, *keyFile, cfg, logger)
+
+	// SIGUSR1 drains ahead of a rollout; SIGTERM then stops the server.
+	drainSignal := make(chan os.Signal, 1)
+	signal.Notify(drainSignal, syscall.SIGUSR1)
+	go func() {
+		for range drainSignal {
+			server.Drain()
+		}
+	}()
+	if *healthInterval > 0 {
+		server.Handler().runHealthChecks(ctx, *healthInterval)
+	}
+
+	for _, imp := range imports {
+		// Local stdio servers are supervised and restarted if they exit.
+		var provider interface {
+			ToolProvider
+			Close() error
+		}
+		var err error
+		if len(imp.Options.Command) > 0 {
+			provider, err = NewSubprocessToolProvider(ctx, upstreamOptions(imp, "subprocess"), logger)
+		} else {
+			provider, err = NewRemoteToolProvider(ctx, upstreamOptions(imp, "remote"), logger)
+		}
+		if err != nil {
+			logger.Error("import failed", "name", imp.Name, "error", err)
+			exit(1)
+		}
+		closers = append(closers, provider)
+		if err := server.Handler().RegisterNamespace(imp.Name, provider); err != nil {
+			logger.Error("import failed", "name", imp.Name, "error", err)
+			exit(1)
+		}
+	}
+
+	for _, api := range openAPIs {
+		tools, err := LoadOpenAPITools(ctx, api.source, OpenAPIOptions{BaseURL: api.base, Header: http.Header(openAPIHeader)})
+		if err == nil {
+			err = server.Handler().RegisterNamespace(api.name, tools)
+		}
+		if err != nil {
+			logger.Error("invalid -openapi", "name", api.name, "error", err)
+			exit(1)
+		}
+		logger.Info("loaded openapi tools", "namespace", api.name, "tools", len(tools))
+	}
+
+	for _, src := range httpTools {
+		tools, err := LoadHTTPTools(src.file, nil)
+		if err == nil {
+			err = server.Handler().RegisterNamespace(src.name, tools)
+		}
+		if err != nil {
+			logger.Error("invalid -http-tools", "name", src.name, "error", err)
+			exit(1)
+		}
+		logger.Info("loaded http tools", "namespace", src.name, "tools", len(tools))
+	}
+
+	for _, src := range commandTools {
+		tools, err := LoadCommandTools(src.file)
+		if err == nil {
+			err = server.Handler().RegisterNamespace(src.name, tools)
+		}
+		if err != nil {
+			logger.Error("invalid -command-tools", "name", src.name, "error", err)
+			exit(1)
+		}
+		logger.Info("loaded command tools", "namespace", src.name, "tools", len(tools))
+	}
+
+	for _, src := range starlarkDirs {
+		provider, err := NewStarlarkToolProvider(src.file, logger)
+		if err == nil {
+			err = server.Handler().RegisterNamespace(src.name, provider)
+		}
+		if err != nil {
+			logger.Error("invalid -starlark", "name", src.name, "error", err)
+			exit(1)
+		}
+		go provider.Watch(ctx, server.Handler().NotifyToolsListChanged)
+		logger.Info("loaded starlark tools", "namespace", src.name, "tools", len(provider.Tools()))
+	}
+
+	for _, src := range sqlDBs {
+		sqlCfg, err := LoadSQLConfig(src.file)
+		var provider *SQLProvider
+		if err == nil {
+			provider, err = NewSQLProvider(ctx, src.name, sqlCfg, logger)
+		}
+		if err == nil {
+			err = server.Handler().RegisterNamespace(src.name, provider)
+		}
+		if err != nil {
+			logger.Error("invalid -sql", "name", src.name, "error", err)
+			exit(1)
+		}
+		closers = append(closers, provider)
+		server.Handler().RegisterResources(provider)
+		logger.Info("loaded sql tools", "namespace", src.name, "tools", len(provider.Tools()))
+	}
+
+	if *resourcesDir != "" {
+		provider, err := NewFileResourceProvider(*resourcesDir, FileResourceOptions{MaxFileSize: *resourcesMaxSize})
+		if err == nil {
+			err = provider.Watch(ctx, server.Handler(), logger)
+		}
+		if err != nil {
+			logger.Error("invalid -resources-dir", "error", err)
+			exit(1)
+		}
+		server.Handler().RegisterResources(provider)
+	}
+
+	for _, g := range grpcs {
+		opts := g.opts
+		if len(grpcMetadata) > 0 {
+			opts.Metadata = metadata.MD{}
+			for k, v := range grpcMetadata {
+				opts.Metadata.Append(k, v...)
+			}
+		}
+		if g.tls {
+			opts.TLSConfig = &tls.Config{InsecureSkipVerify: *upstreamInsecure}
+			if *postQuantum {
+				opts.TLSConfig.CurvePreferences = hybridKeyExchanges
+			}
+		}
+		provider, err := LoadGRPCTools(ctx, g.target, opts)
+		if err == nil {
+			err = server.Handler().RegisterNamespace(g.name, provider)
+		}
+		if err != nil {
+			logger.Error("invalid -grpc", "name", g.name, "error", err)
+			exit(1)
+		}
+		closers = append(closers, provider)
+		logger.Info("loaded grpc tools", "namespace", g.name, "tools", len(provider.Tools()))
+	}
+
+	if *toolsDir != "" {
+		if err := server.Handler().WatchToolsDir(ctx, *toolsDir, logger); err != nil {
+			logger.Error("invalid -tools-dir", "error", err)
+			exit(1)
+		}
+	}
+
+	if *stdio != "" {
+		codec, err := NewStdioCodec(*stdio)
+		if err != nil {
+			logger.Error("invalid -stdio", "error", err)
+			exit(1)
+		}
+		go func() {
+			// A stdio client owns the process: exit once it hangs up.
+			defer cancel()
+			if err := server.ServeStdio(ctx, codec, os.Stdin, os.Stdout); err != nil {
+				logger.Error("stdio session error", "error", err)
+			}
+		}()
+	}
+
+	if *addr == "" {
+		<-ctx.Done()
+		shutdown()
+		return
+	}
+
+	if *mdns {
+		if err := advertiseMDNS(ctx, *addr, *tcpAddr, logger.With("component", "mdns")); err != nil {
+			logger.Error("invalid -mdns", "error", err)
+			exit(1)
+		}
+	}
+
 	if err := server.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		logger.Error("server error", "error", err)
-		os.Exit(1)
+		exit(1)
 	}
+	shutdown()
 }
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Session Store
+// =============================================================================
+
+// ErrSessionNotFound is returned by SessionStore.Load for unknown or expired
+// sessions.
+var ErrSessionNotFound = errors.New("session not found")
+
+// ErrQueueFull is returned by SessionStore.Push when a session already has
+// as many queued notifications as the store holds for one session.
+var ErrQueueFull = errors.New("session notification queue full")
+
+// SessionState is the portable part of a session: enough for any server
+// instance to pick up a Streamable HTTP session that another one started.
+// Live resources such as a passthrough upstream stay with the instance
+// that opened them.
+type SessionState struct {
+	// Tenant is the tenant the session belongs to, "" for the default.
+	Tenant             string                 `json:"tenant,omitempty"`
+	ProtocolVersion    string                 `json:"protocolVersion,omitempty"`
+	Encoding           string                 `json:"encoding,omitempty"`
+	ClientCapabilities map[string]interface{} `json:"clientCapabilities,omitempty"`
+	ServerCapabilities map[string]interface{} `json:"serverCapabilities,omitempty"`
+	ClientInfo         ClientInfo             `json:"clientInfo"`
+}
+
+// SessionStore holds session state and queued notifications outside the
+// process, so several server instances behind a load balancer can serve the
+// same sessions. Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Load returns the state saved for id, or ErrSessionNotFound.
+	Load(id string) (*SessionState, error)
+	// Save stores state for id, replacing any previous state, and keeps it
+	// for ttl after the last save.
+	Save(id string, state *SessionState, ttl time.Duration) error
+	// Delete forgets id and its queued notifications.
+	Delete(id string) error
+
+	// Push queues a notification for delivery on the session's next
+	// response stream, whichever instance serves it.
+	Push(id string, msg []byte, ttl time.Duration) error
+	// Drain removes and returns the notifications queued for id, oldest
+	// first.
+	Drain(id string) ([][]byte, error)
+}
+
+// AckSessionStore is a SessionStore that can keep notifications until the
+// client acknowledges them, for Config.AckNotifications. Both built-in
+// stores implement it.
+type AckSessionStore interface {
+	SessionStore
+
+	// PushSeq queues the notification encode builds from the next sequence
+	// number of session id. Numbers start at 1 and grow by one per
+	// notification, across every instance sharing the store.
+	PushSeq(id string, encode func(seq uint64) ([]byte, error), ttl time.Duration) error
+	// Unacked returns the sequenced notifications queued for id, oldest
+	// first, leaving them queued until Ack.
+	Unacked(id string) ([][]byte, error)
+	// Ack drops the sequenced notifications for id numbered seq and lower.
+	Ack(id string, seq uint64) error
+}
+
+// =============================================================================
+// In-Memory Backend
+// =============================================================================
+
+// memorySweepInterval is how often Save drops expired sessions that were
+// never accessed again.
+const memorySweepInterval = time.Minute
+
+// MemorySessionStore is a SessionStore for a single instance. Expired
+// sessions are dropped on access and swept periodically.
+type MemorySessionStore struct {
+	// MaxPending caps the bytes of notifications queued for one session;
+	// Push fails with ErrQueueFull beyond it. Zero means no cap.
+	MaxPending int
+
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	state        []byte
+	pending      [][]byte
+	pendingBytes int
+	expires      time.Time
+
+	// seqs numbers the pending notifications pushed with PushSeq, in step
+	// with pending; lastSeq is the last number handed out.
+	seqs    []uint64
+	lastSeq uint64
+}
+
+// NewMemorySessionStore creates an empty store.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]memorySession)}
+}
+
+// Load implements SessionStore.
+func (s *MemorySessionStore) Load(id string) (*SessionState, error) {
+	s.mu.Lock()
+	entry, ok := s.live(id)
+	s.mu.Unlock()
+	if !ok || entry.state == nil {
+		return nil, ErrSessionNotFound
+	}
+
+	// Stored encoded, so callers never share maps with the store.
+	var state SessionState
+	if err := json.Unmarshal(entry.state, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Save implements SessionStore.
+func (s *MemorySessionStore) Save(id string, state *SessionState, ttl time.Duration) error {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > memorySweepInterval {
+		for key, entry := range s.sessions {
+			if now.After(entry.expires) {
+				delete(s.sessions, key)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	entry, _ := s.live(id)
+	entry.state = body
+	entry.expires = now.Add(ttl)
+	s.sessions[id] = entry
+	return nil
+}
+
+// Delete implements SessionStore.
+func (s *MemorySessionStore) Delete(id string) error {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// Push implements SessionStore.
+func (s *MemorySessionStore) Push(id string, msg []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, _ := s.live(id)
+	return s.pushLocked(id, entry, msg, 0, ttl)
+}
+
+// PushSeq implements AckSessionStore.
+func (s *MemorySessionStore) PushSeq(id string, encode func(seq uint64) ([]byte, error), ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, _ := s.live(id)
+	seq := entry.lastSeq + 1
+	msg, err := encode(seq)
+	if err != nil {
+		return err
+	}
+	entry.lastSeq = seq
+	return s.pushLocked(id, entry, msg, seq, ttl)
+}
+
+// pushLocked queues msg, numbered seq or 0 for none. The caller holds s.mu.
+func (s *MemorySessionStore) pushLocked(id string, entry memorySession, msg []byte, seq uint64, ttl time.Duration) error {
+	if s.MaxPending > 0 && entry.pendingBytes > 0 && entry.pendingBytes+len(msg) > s.MaxPending {
+		// A failed PushSeq still used its number, so the client sees the gap.
+		s.sessions[id] = entry
+		return ErrQueueFull
+	}
+	entry.pending = append(entry.pending, append([]byte(nil), msg...))
+	entry.seqs = append(entry.seqs, seq)
+	entry.pendingBytes += len(msg)
+	if expires := time.Now().Add(ttl); expires.After(entry.expires) {
+		entry.expires = expires
+	}
+	s.sessions[id] = entry
+	return nil
+}
+
+// Drain implements SessionStore.
+func (s *MemorySessionStore) Drain(id string) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.live(id)
+	if !ok {
+		return nil, nil
+	}
+	pending := entry.pending
+	entry.pending, entry.seqs = nil, nil
+	entry.pendingBytes = 0
+	s.sessions[id] = entry
+	return pending, nil
+}
+
+// Unacked implements AckSessionStore.
+func (s *MemorySessionStore) Unacked(id string) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, _ := s.live(id)
+	var unacked [][]byte
+	for i, msg := range entry.pending {
+		if entry.seqs[i] != 0 {
+			unacked = append(unacked, msg)
+		}
+	}
+	return unacked, nil
+}
+
+// Ack implements AckSessionStore.
+func (s *MemorySessionStore) Ack(id string, seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.live(id)
+	if !ok {
+		return nil
+	}
+	pending, seqs := entry.pending[:0:0], entry.seqs[:0:0]
+	entry.pendingBytes = 0
+	for i, msg := range entry.pending {
+		if n := entry.seqs[i]; n != 0 && n <= seq {
+			continue
+		}
+		pending, seqs = append(pending, msg), append(seqs, entry.seqs[i])
+		entry.pendingBytes += len(msg)
+	}
+	entry.pending, entry.seqs = pending, seqs
+	s.sessions[id] = entry
+	return nil
+}
+
+// live returns id's entry unless it has expired, dropping it if so. The
+// caller holds s.mu.
+func (s *MemorySessionStore) live(id string) (memorySession, bool) {
+	entry, ok := s.sessions[id]
+	if !ok {
+		return memorySession{}, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.sessions, id)
+		return memorySession{}, false
+	}
+	return entry, true
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/webtransport-go"
+)
+
+// =============================================================================
+// Session Output
+// =============================================================================
+
+// errSessionMemory ends a session whose client has fallen so far behind that
+// the data held for it exceeds Config.SessionMemory.
+var errSessionMemory = errors.New("session memory budget exceeded")
+
+// sessionBudget counts the bytes a session holds for its client, such as
+// frames waiting to be written and notifications queued for its event
+// stream, against Config.SessionMemory. It is safe for concurrent use; a
+// nil or zero-limit budget counts nothing.
+type sessionBudget struct {
+	limit int64
+	held  atomic.Int64
+}
+
+// reserve counts n more bytes, or reports false and counts nothing if that
+// would exceed the limit. A message larger than the limit on its own is let
+// through when nothing else is held, so the budget never rules out a large
+// response to a client that keeps up.
+func (b *sessionBudget) reserve(n int) bool {
+	if b == nil || b.limit <= 0 {
+		return true
+	}
+	held := b.held.Add(int64(n))
+	if held > b.limit && held != int64(n) {
+		b.held.Add(-int64(n))
+		return false
+	}
+	return true
+}
+
+// add counts n more bytes whatever the limit, for framing added to a
+// message that was already reserved.
+func (b *sessionBudget) add(n int) {
+	if b == nil || b.limit <= 0 {
+		return
+	}
+	b.held.Add(int64(n))
+}
+
+// release uncounts n bytes that have reached the client or been dropped.
+func (b *sessionBudget) release(n int) {
+	if b == nil || b.limit <= 0 {
+		return
+	}
+	b.held.Add(-int64(n))
+}
+
+// sessionWriter serializes writes to a session's output, which the serve
+// loop, the proxy, Notify, and goAway share. Each Write carries a whole
+// frame.
+//
+// With Config.WriteBuffer set, frames are collected in a buffer and reach
+// the stream together: when the buffer fills, when a timer started by the
+// first frame in it fires, or on Flush. Without it every Write goes
+// straight through and Flush does nothing.
+//
+// Frames waiting for the stream count against the session's budget. A
+// client that stops reading blocks writes once flow control runs out, and
+// frames from concurrent notifications pile up behind them; the Write that
+// would exceed the budget fails with errSessionMemory, as does every one
+// after it, and calls overflow to tear the session down.
+//
+// Once startSequencing is called, every frame is numbered as it is
+// written; see frameSequenced. Once startChecksums is, every frame ends
+// with a checksum; see frameChecksummed. With a replay log the numbered frames are
+// also kept, and a failed stream detaches the writer instead of failing
+// it: later frames are numbered and kept for the client to resume, and
+// once it has, they are passed to the successor that took over.
+type sessionWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	sequenced   bool
+	checksummed bool
+	sent        uint64
+	replay      *replayLog
+	detached    bool
+	successor   *sessionWriter
+
+	buf        *bufio.Writer
+	flushDelay time.Duration
+	timer      *time.Timer
+
+	budget       *sessionBudget
+	overflow     func()
+	overflowOnce sync.Once
+	failed       atomic.Bool
+}
+
+func newSessionWriter(w io.Writer, cfg Config, budget *sessionBudget) *sessionWriter {
+	sw := &sessionWriter{w: w, budget: budget}
+	if cfg.WriteBuffer > 0 {
+		sw.buf = bufio.NewWriterSize(w, cfg.WriteBuffer)
+		sw.flushDelay = cfg.FlushDelay
+		if sw.flushDelay <= 0 {
+			sw.flushDelay = defaultFlushDelay
+		}
+	}
+	return sw
+}
+
+func (w *sessionWriter) Write(p []byte) (int, error) {
+	if w.failed.Load() {
+		return 0, errSessionMemory
+	}
+	// Reserve before taking the lock: the frames that matter are the ones
+	// queued behind a write the client is not reading.
+	if !w.budget.reserve(len(p)) {
+		w.fail()
+		return 0, errSessionMemory
+	}
+
+	w.mu.Lock()
+	if next := w.successor; next != nil {
+		w.mu.Unlock()
+		w.budget.release(len(p))
+		return next.Write(p)
+	}
+	defer w.mu.Unlock()
+	frame := p
+	if w.sequenced {
+		// Numbered under the lock, so numbers go out in order.
+		w.sent++
+		frame = sequenceFrame(p, w.sent)
+		w.budget.add(frameSeqSize)
+	}
+	if w.checksummed {
+		frame = checksumFrame(frame)
+		w.budget.add(frameChecksumSize)
+	}
+	if w.sequenced && w.replay != nil {
+		w.replay.add(w.sent, frame)
+	}
+	if err := w.writeLocked(frame); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeLocked writes a frame already counted against the budget.
+func (w *sessionWriter) writeLocked(frame []byte) error {
+	if w.detached {
+		w.budget.release(len(frame))
+		return nil
+	}
+	if w.buf == nil {
+		_, err := w.w.Write(frame)
+		w.budget.release(len(frame))
+		return w.detachOnError(err)
+	}
+	before := w.buf.Buffered()
+	_, err := w.buf.Write(frame)
+	// Whatever left the buffer is no longer held; what is still in it is.
+	w.budget.release(before + len(frame) - w.buf.Buffered())
+	if err == nil && w.buf.Buffered() > 0 && w.timer == nil {
+		w.timer = time.AfterFunc(w.flushDelay, func() { w.Flush() })
+	}
+	return w.detachOnError(err)
+}
+
+// detachOnError detaches a writer with a replay log from a stream that
+// failed with err, and passes err on for the rest.
+func (w *sessionWriter) detachOnError(err error) error {
+	if err == nil || w.replay == nil {
+		return err
+	}
+	w.detached = true
+	if w.buf != nil {
+		w.budget.release(w.buf.Buffered())
+	}
+	return nil
+}
+
+// startSequencing numbers every frame written from now on, starting at 1,
+// and keeps them in replay if it is not nil.
+func (w *sessionWriter) startSequencing(replay *replayLog) {
+	w.mu.Lock()
+	w.sequenced = true
+	w.replay = replay
+	w.mu.Unlock()
+}
+
+// startChecksums ends every frame written from now on with a checksum.
+func (w *sessionWriter) startChecksums() {
+	w.mu.Lock()
+	w.checksummed = true
+	w.mu.Unlock()
+}
+
+// resume takes over old's numbering and replay log for a client that
+// resumed on w's stream: it writes the frames numbered after lastSeq that
+// old kept, and passes everything old is given from now on to w.
+func (w *sessionWriter) resume(old *sessionWriter, lastSeq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	old.mu.Lock()
+	missed, err := old.replay.since(lastSeq, old.sent)
+	if err == nil {
+		w.sequenced, w.sent, w.replay = true, old.sent, old.replay
+		old.replay, old.successor = nil, w
+	}
+	old.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, frame := range missed {
+		w.budget.add(len(frame))
+		if err := w.writeLocked(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes out the buffered frames.
+func (w *sessionWriter) Flush() error {
+	w.mu.Lock()
+	if next := w.successor; next != nil {
+		w.mu.Unlock()
+		return next.Flush()
+	}
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.buf == nil || w.detached {
+		return nil
+	}
+	before := w.buf.Buffered()
+	err := w.buf.Flush()
+	w.budget.release(before - w.buf.Buffered())
+	return w.detachOnError(err)
+}
+
+// fail marks the writer failed and calls overflow once. It runs without
+// w.mu, which a write blocked on the client may be holding until overflow
+// tears the stream down.
+func (w *sessionWriter) fail() {
+	w.failed.Store(true)
+	w.overflowOnce.Do(func() {
+		if w.overflow != nil {
+			w.overflow()
+		}
+	})
+}
+
+// abortStreams tears down a session's input and output so that reads and
+// writes blocked on them return: WebTransport streams are reset, anything
+// else that can be closed is.
+func abortStreams(r io.Reader, w io.Writer) {
+	type resetter interface {
+		CancelRead(webtransport.StreamErrorCode)
+		CancelWrite(webtransport.StreamErrorCode)
+	}
+	for _, v := range []interface{}{r, w} {
+		switch c := v.(type) {
+		case resetter:
+			c.CancelRead(0)
+			c.CancelWrite(0)
+		case io.Closer:
+			c.Close()
+		}
+	}
+}
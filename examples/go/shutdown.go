@@ -0,0 +1,135 @@
+package main
+
+import (
+	"time"
+)
+
+// =============================================================================
+// Orderly Session Close
+// =============================================================================
+
+// shutdownGrace bounds how long a session closing on $/shutdown waits for
+// the requests it is still handling.
+const shutdownGrace = 5 * time.Second
+
+// A framed session's client ends it with the $/shutdown notification. The
+// session stops accepting requests, refusing any the client sent after
+// $/shutdown, waits up to shutdownGrace for the requests being handled,
+// flushes their responses, and closes the stream. A session closed this
+// way is not kept for resumption and its state is dropped. On the HTTP
+// transports, which end sessions with DELETE, $/shutdown is only logged.
+
+// enter counts a request as being handled until leave, or reports false
+// once the session is closing.
+func (s *Session) enter() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.active++
+	return true
+}
+
+func (s *Session) leave() {
+	s.mu.Lock()
+	s.active--
+	if s.active == 0 && s.idle != nil {
+		close(s.idle)
+		s.idle = nil
+	}
+	s.mu.Unlock()
+}
+
+// beginShutdown handles $/shutdown from the client.
+func (s *Session) beginShutdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out == nil {
+		s.logger.Info("shutdown requested")
+		return
+	}
+	if !s.closing {
+		s.logger.Info("shutdown requested, closing session")
+		s.closing = true
+	}
+}
+
+func (s *Session) isClosing() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.closing
+}
+
+// finishShutdown closes a session that received $/shutdown, once Serve has
+// handled it: pending is what the decoder read after it.
+func (s *Session) finishShutdown(pending <-chan decodedRequest, out *sessionWriter) error {
+	for refused := false; !refused; {
+		select {
+		case next := <-pending:
+			if next.err == nil && !next.req.ID.IsZero() {
+				s.writeResponse(out, s.handler.closingResponse(next.req))
+			}
+		default:
+			refused = true
+		}
+	}
+
+	if !s.waitIdle(shutdownGrace) {
+		s.logger.Warn("requests still running at shutdown", "grace", shutdownGrace)
+	}
+	s.forgetSession()
+	return out.Flush()
+}
+
+// waitIdle waits up to timeout for the requests being handled, and reports
+// whether they all finished.
+func (s *Session) waitIdle(timeout time.Duration) bool {
+	s.mu.Lock()
+	if s.active == 0 {
+		s.mu.Unlock()
+		return true
+	}
+	if s.idle == nil {
+		s.idle = make(chan struct{})
+	}
+	idle := s.idle
+	s.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// forgetSession drops what a session would leave behind for a client
+// coming back: its resumable output and its state.
+func (s *Session) forgetSession() {
+	scope := s.stateScope()
+	s.mu.Lock()
+	token := s.resumeToken
+	s.scope, s.clearState = scope, true
+	s.mu.Unlock()
+	if token != "" {
+		s.handler.takeResumable(token)
+	}
+}
+
+// writeResponse writes resp to out, logging what cannot be encoded.
+func (s *Session) writeResponse(out *sessionWriter, resp *RPCResponse) {
+	frame, err := s.codec.Encode(resp)
+	if err != nil {
+		s.logger.Error("encode failed", "error", err)
+		return
+	}
+	out.Write(frame)
+}
+
+// closingResponse refuses a request that reached a closing session.
+func (h *Handler) closingResponse(req *RPCRequest) *RPCResponse {
+	return h.errorResponse(req.ID, ErrCodeInvalidRequest, "Session is shutting down")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+)
+
+// =============================================================================
+// Response Signatures
+// =============================================================================
+
+// With Config.SigningKey set, every response a Handler produces is signed
+// with a detached JWS over its canonical JSON, and initialize advertises
+// the public key as transport.signingKey; see mcpflow.SignResponse. Frames a
+// -proxy copies through unchanged are the backend's, and are not signed.
+
+// loadSigningKey reads an Ed25519 private key from a PEM file in PKCS #8
+// form, as written by openssl genpkey -algorithm ed25519.
+func loadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signer, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T is not an Ed25519 key", path, key)
+	}
+	return signer, nil
+}
+
+// signingKey returns the JWK of the key responses are signed with.
+func (c Config) signingKey() mcpflow.SigningKey {
+	return mcpflow.NewSigningKey(c.SigningKey.Public().(ed25519.PublicKey))
+}
+
+// signResponse returns resp signed with the server's key, if it has one.
+// A response that cannot be signed, such as one whose result is not an
+// object, is sent as it is.
+func (h *Handler) signResponse(req *RPCRequest, resp *RPCResponse) *RPCResponse {
+	if resp == nil || h.cfg.SigningKey == nil {
+		return resp
+	}
+	raw, err := json.Marshal(resp)
+	if err == nil {
+		raw, err = mcpflow.SignResponse(raw, h.cfg.SigningKey)
+	}
+	var signed struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"error"`
+	}
+	if err == nil {
+		err = json.Unmarshal(raw, &signed)
+	}
+	if err != nil {
+		req.logger().Warn("response not signed", "error", err)
+		return resp
+	}
+
+	out := *resp
+	if resp.Error != nil {
+		rpcErr := *resp.Error
+		rpcErr.Data = signed.Error.Data
+		out.Error = &rpcErr
+	} else {
+		out.Result = signed.Result
+	}
+	return &out
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	// Drivers for -sql; embedding programs can register others.
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"gopkg.in/yaml.v3"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// SQL Tools and Resources
+// =============================================================================
+
+const (
+	// defaultSQLTimeout bounds each query when the config sets no timeout.
+	defaultSQLTimeout = 10 * time.Second
+	// defaultSQLMaxRows caps the rows a query returns when the config sets
+	// no limit.
+	defaultSQLMaxRows = 1000
+	// defaultSQLMaxOpenConns sizes the pool when the config does not.
+	defaultSQLMaxOpenConns = 4
+)
+
+// SQLConfig describes a database and the queries served from it.
+type SQLConfig struct {
+	// Driver is a registered database/sql driver: postgres and mysql are
+	// built in.
+	Driver string `yaml:"driver"`
+	// DSN is the driver's data source name. $VAR and ${VAR} are expanded
+	// from the environment, to keep passwords out of the file.
+	DSN string `yaml:"dsn"`
+
+	MaxOpenConns    int           `yaml:"maxOpenConns"`
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime"`
+
+	// Timeout bounds each query; zero means 10s.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxRows caps the rows returned by a query; zero means 1000.
+	MaxRows int `yaml:"maxRows"`
+
+	Queries []SQLQueryConfig `yaml:"queries"`
+}
+
+// SQLQueryConfig is a parameterized query served as a tool. Its arguments
+// bind to the query's placeholders ($1 or ?, per driver) in Params order.
+type SQLQueryConfig struct {
+	Name        string     `yaml:"name"`
+	Description string     `yaml:"description"`
+	SQL         string     `yaml:"sql"`
+	Params      []SQLParam `yaml:"params"`
+}
+
+// SQLParam is one argument of a query. Type is a JSON Schema type:
+// string (the default), integer, number, or boolean.
+type SQLParam struct {
+	Name        string `yaml:"name"`
+	Type        string `yaml:"type"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
+}
+
+// readOnlyStatements are the leading keywords a query may start with.
+var readOnlyStatements = []string{"SELECT", "WITH", "VALUES", "TABLE", "SHOW", "EXPLAIN"}
+
+// SQLProvider serves a database's configured queries as tools and its
+// tables as resources (sql://<name>/<schema>/<table>, describing the
+// columns). Queries run in read-only transactions, so a statement that
+// would write fails even if it slips past the load-time check.
+type SQLProvider struct {
+	name    string
+	db      *sql.DB
+	cfg     SQLConfig
+	dialect *sqlDialect
+	tools   StaticTools
+	logger  *slog.Logger
+}
+
+// LoadSQLConfig reads a SQLConfig in YAML or JSON.
+func LoadSQLConfig(path string) (SQLConfig, error) {
+	var cfg SQLConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("sql %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// NewSQLProvider opens the database, checks it is reachable, and builds
+// the query tools. name identifies the database in resource URIs.
+func NewSQLProvider(ctx context.Context, name string, cfg SQLConfig, logger *slog.Logger) (*SQLProvider, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.Timeout < 0 || cfg.MaxRows < 0 || cfg.MaxOpenConns < 0 || cfg.MaxIdleConns < 0 {
+		return nil, fmt.Errorf("sql %s: negative limit", name)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultSQLTimeout
+	}
+	if cfg.MaxRows == 0 {
+		cfg.MaxRows = defaultSQLMaxRows
+	}
+	if cfg.MaxOpenConns == 0 {
+		cfg.MaxOpenConns = defaultSQLMaxOpenConns
+	}
+
+	p := &SQLProvider{name: name, cfg: cfg, dialect: sqlDialects[cfg.Driver], logger: logger}
+	for _, q := range cfg.Queries {
+		t, err := p.queryTool(q)
+		if err != nil {
+			return nil, fmt.Errorf("sql %s: %w", name, err)
+		}
+		p.tools = append(p.tools, t)
+	}
+
+	db, err := sql.Open(cfg.Driver, os.ExpandEnv(cfg.DSN))
+	if err != nil {
+		return nil, fmt.Errorf("sql %s: %w", name, err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	pingCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	if err := db.PingContext(pingCtx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sql %s: %w", name, err)
+	}
+	p.db = db
+	return p, nil
+}
+
+// Tools returns one tool per configured query.
+func (p *SQLProvider) Tools() []Tool { return p.tools }
+
+// Close closes the connection pool.
+func (p *SQLProvider) Close() error { return p.db.Close() }
+
+func (p *SQLProvider) queryTool(q SQLQueryConfig) (*sqlQueryTool, error) {
+	if q.Name == "" {
+		return nil, errors.New("query without a name")
+	}
+	keyword := statementKeyword(q.SQL)
+	readOnly := false
+	for _, k := range readOnlyStatements {
+		readOnly = readOnly || keyword == k
+	}
+	if !readOnly {
+		return nil, fmt.Errorf("query %q: only read-only statements are allowed", q.Name)
+	}
+
+	properties := make(map[string]interface{}, len(q.Params))
+	required := []string{}
+	for _, param := range q.Params {
+		switch param.Type {
+		case "":
+			param.Type = "string"
+		case "string", "integer", "number", "boolean":
+		default:
+			return nil, fmt.Errorf("query %q: param %q has unsupported type %q", q.Name, param.Name, param.Type)
+		}
+		prop := map[string]interface{}{"type": param.Type}
+		if param.Description != "" {
+			prop["description"] = param.Description
+		}
+		properties[param.Name] = prop
+		if param.Required {
+			required = append(required, param.Name)
+		}
+	}
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return &sqlQueryTool{provider: p, cfg: q, schema: schema}, nil
+}
+
+// statementKeyword returns the keyword a statement starts with, in upper
+// case, looking past whitespace of any kind and the parentheses of a
+// query such as (SELECT ...) UNION (SELECT ...).
+func statementKeyword(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return r == '(' || unicode.IsSpace(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	return strings.ToUpper(words[0])
+}
+
+// sqlQueryTool runs one configured query.
+type sqlQueryTool struct {
+	provider *SQLProvider
+	cfg      SQLQueryConfig
+	schema   map[string]interface{}
+}
+
+func (t *sqlQueryTool) Name() string                        { return t.cfg.Name }
+func (t *sqlQueryTool) Description() string                 { return t.cfg.Description }
+func (t *sqlQueryTool) InputSchema() map[string]interface{} { return t.schema }
+func (t *sqlQueryTool) Annotations() ToolAnnotations {
+	return ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true}
+}
+
+func (t *sqlQueryTool) Execute(args map[string]interface{}) (interface{}, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+// ExecuteContext runs the query, abandoning it when ctx is done or the
+// provider's timeout passes.
+func (t *sqlQueryTool) ExecuteContext(parent context.Context, args map[string]interface{}) (interface{}, error) {
+	bind := make([]interface{}, len(t.cfg.Params))
+	for i, param := range t.cfg.Params {
+		v, ok := args[param.Name]
+		if !ok || v == nil {
+			if param.Required {
+				return nil, mcpflowerr.InvalidParams("missing required argument %q", param.Name).
+					WithOffender(param.Name, "required")
+			}
+			continue
+		}
+		if f, ok := v.(float64); ok && param.Type == "integer" {
+			if f != float64(int64(f)) {
+				return nil, mcpflowerr.InvalidParams("argument %q must be an integer", param.Name).
+					WithOffender(param.Name, "type")
+			}
+			v = int64(f)
+		}
+		bind[i] = v
+	}
+
+	p := t.provider
+	ctx, cancel := context.WithTimeout(parent, p.cfg.Timeout)
+	defer cancel()
+	result, err := p.query(ctx, t.cfg.SQL, bind...)
+	if err != nil {
+		if parent.Err() != nil {
+			return nil, parent.Err()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, mcpflowerr.Timeout("query %s did not finish within %s", t.cfg.Name, p.cfg.Timeout)
+		}
+		return nil, err
+	}
+
+	text, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"content": []map[string]interface{}{{"type": "text", "text": string(text)}},
+	}, nil
+}
+
+// sqlResult is a query's rows as JSON. Columns keeps their order, which
+// the row objects do not.
+type sqlResult struct {
+	Columns   []string                 `json:"columns"`
+	Rows      []map[string]interface{} `json:"rows"`
+	Truncated bool                     `json:"truncated,omitempty"`
+}
+
+// query runs a statement in a read-only transaction and collects up to
+// MaxRows rows.
+func (p *SQLProvider) query(ctx context.Context, query string, args ...interface{}) (*sqlResult, error) {
+	tx, err := p.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &sqlResult{Columns: columns, Rows: []map[string]interface{}{}}
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(result.Rows) == p.cfg.MaxRows {
+			result.Truncated = true
+			break
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+// =============================================================================
+// Schema Resources
+// =============================================================================
+
+// sqlDialect holds the catalog queries of a database family. tables
+// returns (schema, table) pairs; columns takes schema and table, in that
+// order, and returns (name, type, nullable) rows.
+type sqlDialect struct {
+	tables  string
+	columns string
+}
+
+var sqlDialects = map[string]*sqlDialect{
+	"postgres": {
+		tables: `SELECT table_schema, table_name FROM information_schema.tables
+			WHERE table_schema NOT IN ('pg_catalog', 'information_schema') ORDER BY 1, 2`,
+		columns: `SELECT column_name, data_type, is_nullable = 'YES' FROM information_schema.columns
+			WHERE table_schema = $1 AND table_name = $2 ORDER BY ordinal_position`,
+	},
+	"mysql": {
+		tables: `SELECT table_schema, table_name FROM information_schema.tables
+			WHERE table_schema = DATABASE() ORDER BY 1, 2`,
+		columns: `SELECT column_name, column_type, is_nullable = 'YES' FROM information_schema.columns
+			WHERE table_schema = ? AND table_name = ? ORDER BY ordinal_position`,
+	},
+	"sqlite3": {
+		tables: `SELECT 'main', name FROM sqlite_master
+			WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY 2`,
+		columns: `SELECT name, type, "notnull" = 0 FROM pragma_table_info(?2, ?1) ORDER BY cid`,
+	},
+}
+
+func init() {
+	sqlDialects["pgx"] = sqlDialects["postgres"]
+	sqlDialects["sqlite"] = sqlDialects["sqlite3"]
+}
+
+func (p *SQLProvider) tableURI(schema, table string) string {
+	return "sql://" + url.PathEscape(p.name) + "/" + url.PathEscape(schema) + "/" + url.PathEscape(table)
+}
+
+// Resources lists the database's tables and views. Drivers without a
+// known catalog serve none.
+func (p *SQLProvider) Resources() []Resource {
+	if p.dialect == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+	rows, err := p.db.QueryContext(ctx, p.dialect.tables)
+	if err != nil {
+		p.logger.Warn("listing tables failed", "database", p.name, "error", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var resources []Resource
+	for rows.Next() {
+		var schema, table string
+		if err := rows.Scan(&schema, &table); err != nil {
+			p.logger.Warn("listing tables failed", "database", p.name, "error", err)
+			return nil
+		}
+		resources = append(resources, Resource{
+			URI:         p.tableURI(schema, table),
+			Name:        table,
+			Description: fmt.Sprintf("Columns of %s.%s in the %s database", schema, table, p.name),
+			MimeType:    "application/json",
+		})
+	}
+	return resources
+}
+
+// ReadResource describes a table's columns.
+func (p *SQLProvider) ReadResource(uri string) ([]ResourceContents, error) {
+	rest, ok := strings.CutPrefix(uri, "sql://"+url.PathEscape(p.name)+"/")
+	if !ok || p.dialect == nil {
+		return nil, mcpflowerr.NotFound("Unknown resource: %s", uri)
+	}
+	rawSchema, rawTable, _ := strings.Cut(rest, "/")
+	schema, err1 := url.PathUnescape(rawSchema)
+	table, err2 := url.PathUnescape(rawTable)
+	if err1 != nil || err2 != nil || table == "" {
+		return nil, mcpflowerr.NotFound("Unknown resource: %s", uri)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.cfg.Timeout)
+	defer cancel()
+	rows, err := p.db.QueryContext(ctx, p.dialect.columns, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type column struct {
+		Name     string `json:"name"`
+		Type     string `json:"type"`
+		Nullable bool   `json:"nullable"`
+	}
+	var columns []column
+	for rows.Next() {
+		var c column
+		if err := rows.Scan(&c.Name, &c.Type, &c.Nullable); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, mcpflowerr.NotFound("Unknown resource: %s", uri)
+	}
+
+	text, err := json.Marshal(map[string]interface{}{"schema": schema, "table": table, "columns": columns})
+	if err != nil {
+		return nil, err
+	}
+	return []ResourceContents{{URI: uri, MimeType: "application/json", Text: string(text)}}, nil
+}
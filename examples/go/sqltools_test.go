@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestQueryToolReadOnly(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SELECT * FROM orders", true},
+		{"select id from orders", true},
+		{"  \n\tSELECT id FROM orders", true},
+		{"SELECT\n  id,\n  total\nFROM orders", true},
+		{"SELECT\tid FROM orders", true},
+		{"SELECT\r\n*\r\nFROM orders", true},
+		{"(SELECT id FROM a) UNION (SELECT id FROM b)", true},
+		{"( (select 1))", true},
+		{"WITH recent AS (SELECT 1) SELECT * FROM recent", true},
+		{"WITH\nrecent AS (SELECT 1)\nSELECT * FROM recent", true},
+		{"VALUES (1), (2)", true},
+		{"TABLE orders", true},
+		{"SHOW TABLES", true},
+		{"EXPLAIN SELECT 1", true},
+
+		{"DELETE FROM orders", false},
+		{"delete\nFROM orders", false},
+		{"(DELETE FROM orders)", false},
+		{"UPDATE orders SET total = 0", false},
+		{"INSERT INTO orders VALUES (1)", false},
+		{"DROP TABLE orders", false},
+		{"SELECTX FROM orders", false},
+		{"", false},
+		{"  \n ", false},
+	}
+	p := &SQLProvider{}
+	for _, tt := range tests {
+		_, err := p.queryTool(SQLQueryConfig{Name: "q", SQL: tt.sql})
+		if got := err == nil; got != tt.want {
+			t.Errorf("queryTool(%q) accepted = %v, want %v (error: %v)", tt.sql, got, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	starjson "go.starlark.net/lib/json"
+	"go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+)
+
+// =============================================================================
+// Starlark Tools
+// =============================================================================
+
+const (
+	// starlarkCallTimeout bounds each call of a Starlark tool.
+	starlarkCallTimeout = 30 * time.Second
+	// starlarkMaxSteps bounds the work of loading a file or running a call,
+	// so a runaway loop fails fast even before the timeout.
+	starlarkMaxSteps = 100_000_000
+	// starlarkPollInterval is how often Watch looks for changed files.
+	starlarkPollInterval = time.Second
+)
+
+// starlarkPredeclared is available to every script besides the built-ins.
+var starlarkPredeclared = starlark.StringDict{
+	"json": starjson.Module,
+	"math": math.Module,
+}
+
+// StarlarkToolProvider serves the tools defined by the .star files in a
+// directory, one tool per file. A file sets these globals:
+//
+//	name = "add"                  # optional, defaults to the file name
+//	description = "Adds two numbers"
+//	schema = {"type": "object", "properties": {"a": {"type": "number"}}}
+//	def execute(args):            # args is a dict of the call's arguments
+//	    return args["a"] + 1
+//
+// execute may return a string, returned as text; a dict with "content",
+// returned as the tool result; or any other JSON-encodable value, returned
+// as JSON text. fail("...") makes the call a tool error. Scripts cannot
+// load other files or reach the network or filesystem.
+//
+// Watch reloads changed files. A file that no longer loads keeps serving
+// its last good version until it is fixed or removed.
+type StarlarkToolProvider struct {
+	dir    string
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	files map[string]*starlarkFile
+	tools StaticTools
+}
+
+type starlarkFile struct {
+	modTime time.Time
+	size    int64
+	tool    *starlarkTool
+}
+
+// NewStarlarkToolProvider loads every .star file in dir. Unlike a reload,
+// the initial load fails if any file does not.
+func NewStarlarkToolProvider(dir string, logger *slog.Logger) (*StarlarkToolProvider, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	p := &StarlarkToolProvider{dir: dir, logger: logger, files: make(map[string]*starlarkFile)}
+	if _, err := p.reload(true); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Tools returns the loaded tools, by file name.
+func (p *StarlarkToolProvider) Tools() []Tool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.tools
+}
+
+// Watch polls the directory until ctx is done, reloading added, changed,
+// and removed files and calling onChange, if set, after each change.
+func (p *StarlarkToolProvider) Watch(ctx context.Context, onChange func()) {
+	ticker := time.NewTicker(starlarkPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := p.reload(false)
+		if err != nil {
+			p.logger.Warn("starlark tools reload failed", "dir", p.dir, "error", err)
+		}
+		if changed && onChange != nil {
+			onChange()
+		}
+	}
+}
+
+// reload brings the loaded files in line with the directory and reports
+// whether the tool set changed. With strict, any file that fails to load
+// fails the reload; otherwise it is logged and its old version kept.
+func (p *StarlarkToolProvider) reload(strict bool) (bool, error) {
+	paths, err := filepath.Glob(filepath.Join(p.dir, "*.star"))
+	if err != nil {
+		return false, err
+	}
+	if strict && len(paths) == 0 {
+		return false, fmt.Errorf("no .star files in %s", p.dir)
+	}
+
+	p.mu.RLock()
+	old := p.files
+	p.mu.RUnlock()
+
+	files := make(map[string]*starlarkFile, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		prev := old[path]
+		if prev != nil && prev.modTime.Equal(info.ModTime()) && prev.size == info.Size() {
+			files[path] = prev
+			continue
+		}
+
+		f := &starlarkFile{modTime: info.ModTime(), size: info.Size()}
+		tool, err := loadStarlarkTool(path, p.logger)
+		switch {
+		case err == nil:
+			f.tool = tool
+			p.logger.Info("starlark tool loaded", "file", path, "tool", tool.name)
+		case strict:
+			return false, err
+		default:
+			// Remember the failure so it is not retried until the file
+			// changes again.
+			p.logger.Warn("starlark tool not reloaded", "file", path, "error", err)
+			if prev != nil {
+				f.tool = prev.tool
+			}
+		}
+		files[path] = f
+	}
+
+	changed := len(files) != len(old)
+	for path, f := range files {
+		if prev := old[path]; prev == nil || prev.tool != f.tool {
+			changed = true
+		}
+	}
+	if !changed {
+		p.mu.Lock()
+		p.files = files
+		p.mu.Unlock()
+		return false, nil
+	}
+
+	names := make(map[string]string, len(files))
+	tools := make(StaticTools, 0, len(files))
+	for _, path := range paths {
+		f := files[path]
+		if f == nil || f.tool == nil {
+			continue
+		}
+		if other, ok := names[f.tool.name]; ok {
+			err := fmt.Errorf("tool %q is defined by both %s and %s", f.tool.name, other, path)
+			if strict {
+				return false, err
+			}
+			p.logger.Warn("starlark tool skipped", "file", path, "error", err)
+			continue
+		}
+		names[f.tool.name] = path
+		tools = append(tools, f.tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Name() < tools[j].Name() })
+
+	p.mu.Lock()
+	p.files, p.tools = files, tools
+	p.mu.Unlock()
+	return true, nil
+}
+
+// starlarkTool is one loaded .star file.
+type starlarkTool struct {
+	name        string
+	description string
+	schema      map[string]interface{}
+	execute     starlark.Callable
+	logger      *slog.Logger
+}
+
+func loadStarlarkTool(path string, logger *slog.Logger) (*starlarkTool, error) {
+	thread := newStarlarkThread(path, logger)
+	globals, err := starlark.ExecFile(thread, path, nil, starlarkPredeclared)
+	if err != nil {
+		return nil, starlarkError(err)
+	}
+	// Frozen globals are safe to share between concurrent calls.
+	globals.Freeze()
+
+	t := &starlarkTool{
+		name:   strings.TrimSuffix(filepath.Base(path), ".star"),
+		logger: logger,
+	}
+	if v, ok := globals["name"]; ok {
+		s, ok := starlark.AsString(v)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("%s: name must be a non-empty string", path)
+		}
+		t.name = s
+	}
+	if v, ok := globals["description"]; ok {
+		if t.description, ok = starlark.AsString(v); !ok {
+			return nil, fmt.Errorf("%s: description must be a string", path)
+		}
+	}
+
+	t.schema = map[string]interface{}{"type": "object"}
+	if v, ok := globals["schema"]; ok {
+		schema, err := fromStarlark(thread, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: schema: %w", path, err)
+		}
+		if t.schema, ok = schema.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("%s: schema must be a dict", path)
+		}
+	}
+
+	execute, ok := globals["execute"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: no execute function", path)
+	}
+	t.execute = execute
+	return t, nil
+}
+
+func (t *starlarkTool) Name() string                        { return t.name }
+func (t *starlarkTool) Description() string                 { return t.description }
+func (t *starlarkTool) InputSchema() map[string]interface{} { return t.schema }
+
+func (t *starlarkTool) Execute(args map[string]interface{}) (interface{}, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *starlarkTool) ExecuteContext(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	thread := newStarlarkThread(t.name, t.logger)
+	timer := time.AfterFunc(starlarkCallTimeout, func() { thread.Cancel("timeout") })
+	defer timer.Stop()
+	stop := context.AfterFunc(ctx, func() { thread.Cancel(ctx.Err().Error()) })
+	defer stop()
+
+	in, err := toStarlark(thread, args)
+	if err != nil {
+		return nil, err
+	}
+	v, err := starlark.Call(thread, t.execute, starlark.Tuple{in}, nil)
+	if err != nil {
+		return nil, starlarkError(err)
+	}
+
+	if s, ok := starlark.AsString(v); ok {
+		return map[string]interface{}{
+			"content": []map[string]interface{}{{"type": "text", "text": s}},
+		}, nil
+	}
+	out, err := fromStarlark(thread, v)
+	if err != nil {
+		return nil, fmt.Errorf("result: %w", err)
+	}
+	if m, ok := out.(map[string]interface{}); ok && m["content"] != nil {
+		return m, nil
+	}
+	text, _ := json.Marshal(out)
+	return map[string]interface{}{
+		"content": []map[string]interface{}{{"type": "text", "text": string(text)}},
+	}, nil
+}
+
+func newStarlarkThread(name string, logger *slog.Logger) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name:  name,
+		Print: func(_ *starlark.Thread, msg string) { logger.Info("starlark print", "tool", name, "msg", msg) },
+		Load: func(*starlark.Thread, string) (starlark.StringDict, error) {
+			return nil, errors.New("load is not available to tools")
+		},
+	}
+	thread.SetMaxExecutionSteps(starlarkMaxSteps)
+	return thread
+}
+
+// toStarlark and fromStarlark convert through the json module, so values
+// cross the boundary exactly as a script's own json.decode and
+// json.encode would see them.
+func toStarlark(thread *starlark.Thread, v interface{}) (starlark.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.Call(thread, starjson.Module.Members["decode"], starlark.Tuple{starlark.String(data)}, nil)
+}
+
+func fromStarlark(thread *starlark.Thread, v starlark.Value) (interface{}, error) {
+	encoded, err := starlark.Call(thread, starjson.Module.Members["encode"], starlark.Tuple{v}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	s, _ := starlark.AsString(encoded)
+	if err := json.Unmarshal([]byte(s), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// starlarkError keeps the script's backtrace, which names the file and
+// line, in the error.
+func starlarkError(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return errors.New(evalErr.Backtrace())
+	}
+	return err
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflow"
+)
+
+// =============================================================================
+// Session State
+// =============================================================================
+
+// defaultStateTTL is how long a session state value is kept when it is set
+// without a ttl.
+const defaultStateTTL = 24 * time.Hour
+
+// StateStore backs the mcpflow.SessionState of every session, each under
+// a scope of its own. A session's scope is its Streamable HTTP session ID,
+// or its resume token on a resumable framed session, so its state follows
+// it to another instance sharing the store or across a resumption; other
+// sessions get a scope that is cleared when they end. Implementations must
+// be safe for concurrent use.
+type StateStore interface {
+	Get(scope, key string) ([]byte, bool, error)
+	Set(scope, key string, value []byte, ttl time.Duration) error
+	Delete(scope, key string) error
+	// Clear removes every key in scope.
+	Clear(scope string) error
+	// Size returns the bytes of the keys and values kept in scope.
+	Size(scope string) (int, error)
+}
+
+// Values returns the session's mcpflow.SessionState, which tools that
+// implement mcpflow.ContextTool also find in their context. (State is the
+// portable part of the session itself, for a SessionStore.)
+func (s *Session) Values() mcpflow.SessionState {
+	return &sessionState{store: s.handler.stateStore(), scope: s.stateScope, limit: s.handler.cfg.StateLimit}
+}
+
+// toolContext is the context a tool call from the session runs with: the
+// session itself, as an mcpflow.Session, and its state.
+func (s *Session) toolContext() context.Context {
+	ctx := mcpflow.WithSession(context.Background(), s)
+	return mcpflow.WithSessionState(ctx, s.Values())
+}
+
+// stateScope returns the scope of the session's state, choosing one the
+// first time it is needed.
+func (s *Session) stateScope() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.resumeToken != "":
+		return "resume:" + s.resumeToken
+	case s.scope == "":
+		s.scope = "conn:" + newSessionID()
+		s.clearState = true
+	}
+	return s.scope
+}
+
+// setStateScope scopes the session's state to a Streamable HTTP session ID.
+func (s *Session) setStateScope(id string) {
+	s.mu.Lock()
+	s.scope = httpStateScope(id)
+	s.mu.Unlock()
+}
+
+func httpStateScope(id string) string { return "http:" + id }
+
+// dropState clears the state of a session whose scope ends with it.
+func (s *Session) dropState() {
+	s.mu.RLock()
+	scope, clear := s.scope, s.clearState
+	s.mu.RUnlock()
+	if !clear {
+		return
+	}
+	if err := s.handler.stateStore().Clear(scope); err != nil {
+		s.logger.Warn("clearing session state failed", "error", err)
+	}
+}
+
+func (h *Handler) stateStore() StateStore {
+	if h.cfg.StateStore != nil {
+		return h.cfg.StateStore
+	}
+	return h.state
+}
+
+// sessionState is the mcpflow.SessionState of one session. The scope is
+// looked up on each use, since a session gets its resume token only once
+// initialize has run.
+type sessionState struct {
+	store StateStore
+	scope func() string
+	limit int
+}
+
+func (st *sessionState) Get(key string) ([]byte, bool, error) {
+	return st.store.Get(st.scope(), key)
+}
+
+func (st *sessionState) Set(key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = defaultStateTTL
+	}
+	scope := st.scope()
+	if err := st.checkLimit(scope, key, value); err != nil {
+		return err
+	}
+	return st.store.Set(scope, key, value, ttl)
+}
+
+// checkLimit fails with mcpflow.ErrStateFull if setting key to value would
+// take scope past the limit, counting the value it replaces as freed. Two
+// calls racing each other can overshoot it by one value.
+func (st *sessionState) checkLimit(scope, key string, value []byte) error {
+	if st.limit <= 0 {
+		return nil
+	}
+	need := len(key) + len(value)
+	if need > st.limit {
+		return mcpflow.ErrStateFull
+	}
+	size, err := st.store.Size(scope)
+	if err != nil {
+		return err
+	}
+	if size+need <= st.limit {
+		return nil
+	}
+	old, ok, err := st.store.Get(scope, key)
+	if err != nil {
+		return err
+	}
+	if ok {
+		size -= len(key) + len(old)
+	}
+	if size+need > st.limit {
+		return mcpflow.ErrStateFull
+	}
+	return nil
+}
+
+func (st *sessionState) Delete(key string) error {
+	return st.store.Delete(st.scope(), key)
+}
+
+// runTool executes tool with ctx if it takes one.
+func runTool(ctx context.Context, tool Tool, args map[string]interface{}) (interface{}, error) {
+	if ct, ok := tool.(mcpflow.ContextTool); ok {
+		return ct.ExecuteContext(ctx, args)
+	}
+	return tool.Execute(args)
+}
+
+// =============================================================================
+// In-Memory Backend
+// =============================================================================
+
+// MemoryStateStore is a StateStore for a single instance. Expired values
+// are dropped on access and swept periodically.
+type MemoryStateStore struct {
+	mu        sync.Mutex
+	scopes    map[string]map[string]memoryValue
+	lastSweep time.Time
+}
+
+type memoryValue struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemoryStateStore creates an empty store.
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{scopes: make(map[string]map[string]memoryValue)}
+}
+
+// Get implements StateStore.
+func (s *MemoryStateStore) Get(scope, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.scopes[scope][key]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(v.expires) {
+		delete(s.scopes[scope], key)
+		return nil, false, nil
+	}
+	return append([]byte(nil), v.value...), true, nil
+}
+
+// Set implements StateStore.
+func (s *MemoryStateStore) Set(scope, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > memorySweepInterval {
+		for name, values := range s.scopes {
+			for k, v := range values {
+				if now.After(v.expires) {
+					delete(values, k)
+				}
+			}
+			if len(values) == 0 {
+				delete(s.scopes, name)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	values := s.scopes[scope]
+	if values == nil {
+		values = make(map[string]memoryValue)
+		s.scopes[scope] = values
+	}
+	values[key] = memoryValue{value: append([]byte(nil), value...), expires: now.Add(ttl)}
+	return nil
+}
+
+// Delete implements StateStore.
+func (s *MemoryStateStore) Delete(scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scopes[scope], key)
+	return nil
+}
+
+// Clear implements StateStore.
+func (s *MemoryStateStore) Clear(scope string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scopes, scope)
+	return nil
+}
+
+// Size implements StateStore. Expired values are not counted.
+func (s *MemoryStateStore) Size(scope string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	size := 0
+	for k, v := range s.scopes[scope] {
+		if !now.After(v.expires) {
+			size += len(k) + len(v.value)
+		}
+	}
+	return size, nil
+}
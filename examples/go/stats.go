@@ -0,0 +1,148 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Stats
+// =============================================================================
+
+// ServerStats is a snapshot of the server for live dashboards such as
+// mcpflow top. Counters are cumulative since the server started, so rates
+// come from diffing two snapshots. Tenants are included.
+type ServerStats struct {
+	Time     time.Time `json:"time"`
+	Started  time.Time `json:"started"`
+	Draining bool      `json:"draining"`
+	// InFlight counts HTTP transport requests being handled.
+	InFlight int               `json:"inFlight"`
+	Sessions []SessionStats    `json:"sessions"`
+	Requests map[string]uint64 `json:"requests"`
+	Errors   []ErrorStats      `json:"errors"`
+	Tools    []ToolStats       `json:"tools"`
+	// LatencyBuckets are the upper bounds, in seconds, of ToolStats.Buckets.
+	LatencyBuckets []float64 `json:"latencyBuckets"`
+}
+
+// SessionStats describes one initialized session.
+type SessionStats struct {
+	ID              uint64    `json:"id"`
+	Transport       string    `json:"transport"`
+	Remote          string    `json:"remote,omitempty"`
+	Client          string    `json:"client,omitempty"`
+	ProtocolVersion string    `json:"protocolVersion"`
+	Tenant          string    `json:"tenant,omitempty"`
+	Started         time.Time `json:"started"`
+	LastActive      time.Time `json:"lastActive"`
+	Requests        uint64    `json:"requests"`
+	// RTT is the smoothed round-trip time, in seconds, of the server's
+	// pings to an idle client; zero until one is answered. See
+	// Config.PingInterval.
+	RTT float64 `json:"rtt,omitempty"`
+}
+
+// ErrorStats counts error responses with one JSON-RPC code.
+type ErrorStats struct {
+	Code  int    `json:"code"`
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+// ToolStats counts one tool's calls. Buckets holds the calls that fell in
+// each of LatencyBuckets, with one more for slower calls; it is not
+// cumulative.
+type ToolStats struct {
+	Name    string   `json:"name"`
+	Calls   uint64   `json:"calls"`
+	Errors  uint64   `json:"errors"`
+	Seconds float64  `json:"seconds"`
+	Buckets []uint64 `json:"buckets"`
+}
+
+// Stats returns a snapshot of sessions, request and error counts, and tool
+// latency.
+func (s *Server) Stats() ServerStats {
+	drain := s.DrainStatus()
+	stats := ServerStats{
+		Time:           time.Now(),
+		Started:        s.started,
+		Draining:       drain.Draining,
+		InFlight:       drain.InFlight,
+		Sessions:       []SessionStats{},
+		Requests:       make(map[string]uint64),
+		LatencyBuckets: toolLatencyBuckets,
+	}
+	codes := make(map[int]uint64)
+	tools := make(map[string]*ToolStats)
+
+	handlers := []*Handler{s.handler}
+	for _, h := range s.handler.tenants {
+		handlers = append(handlers, h)
+	}
+	for _, h := range handlers {
+		h.sessionsMu.Lock()
+		for sess := range h.sessions {
+			stats.Sessions = append(stats.Sessions, sess.stats(h.tenant.name))
+		}
+		h.sessionsMu.Unlock()
+
+		h.metrics.mu.Lock()
+		for method, n := range h.metrics.requests {
+			stats.Requests[method] += n
+		}
+		for code, n := range h.metrics.errors {
+			codes[code] += n
+		}
+		for name, m := range h.metrics.tools {
+			t := tools[name]
+			if t == nil {
+				t = &ToolStats{Name: name, Buckets: make([]uint64, len(m.buckets))}
+				tools[name] = t
+			}
+			t.Calls += m.calls
+			t.Errors += m.errors
+			t.Seconds += m.seconds
+			for i, n := range m.buckets {
+				t.Buckets[i] += n
+			}
+		}
+		h.metrics.mu.Unlock()
+	}
+
+	sort.Slice(stats.Sessions, func(i, j int) bool { return stats.Sessions[i].ID < stats.Sessions[j].ID })
+	stats.Errors = make([]ErrorStats, 0, len(codes))
+	for code, n := range codes {
+		stats.Errors = append(stats.Errors, ErrorStats{Code: code, Name: mcpflowerr.NameOf(code), Count: n})
+	}
+	sort.Slice(stats.Errors, func(i, j int) bool { return stats.Errors[i].Code < stats.Errors[j].Code })
+	stats.Tools = make([]ToolStats, 0, len(tools))
+	for _, t := range tools {
+		stats.Tools = append(stats.Tools, *t)
+	}
+	sort.Slice(stats.Tools, func(i, j int) bool { return stats.Tools[i].Name < stats.Tools[j].Name })
+	return stats
+}
+
+func (s *Session) stats(tenant string) SessionStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	st := SessionStats{
+		ID:              s.id,
+		Transport:       s.transport,
+		Remote:          s.remote,
+		Client:          s.client,
+		ProtocolVersion: s.protocolVersion,
+		Tenant:          tenant,
+		Started:         s.started,
+		Requests:        s.requests.Load(),
+		RTT:             s.rtt.Seconds(),
+	}
+	if last := s.lastActive.Load(); last != 0 {
+		st.LastActive = time.Unix(0, last)
+	}
+	return st
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// =============================================================================
+// stdio Transport
+// =============================================================================
+
+// LineCodec handles newline-delimited JSON, the framing used by classic MCP
+// stdio clients. Messages must not contain embedded newlines, which
+// encoding/json never produces.
+type LineCodec struct {
+	maxSize int
+	json    JSONEngine
+}
+
+// NewLineCodec creates a newline-delimited codec with the specified maximum
+// message size.
+func NewLineCodec(maxSize int) *LineCodec {
+	return &LineCodec{maxSize: maxSize, json: StdJSON{}}
+}
+
+// Encode serializes a value as a single JSON line.
+func (c *LineCodec) Encode(v interface{}) ([]byte, error) {
+	// The encoder ends the value with the newline that frames it.
+	var buf bytes.Buffer
+	if err := c.json.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	if size := buf.Len() - 1; size > c.maxSize {
+		return nil, fmt.Errorf("message size %d exceeds maximum %d", size, c.maxSize)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode reads the next non-empty line from the reader. Callers should pass
+// the same *bufio.Reader on every call; any other reader is wrapped and its
+// read-ahead is lost.
+func (c *LineCodec) Decode(r io.Reader) (*RPCRequest, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	for {
+		line, err := c.readLine(br)
+		if err != nil {
+			return nil, err
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var req RPCRequest
+		if err := c.json.Unmarshal(line, &req); err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+		return &req, nil
+	}
+}
+
+// readLine returns one line without its terminator, enforcing maxSize.
+func (c *LineCodec) readLine(br *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > c.maxSize+1 {
+			return nil, fmt.Errorf("message size exceeds maximum %d", c.maxSize)
+		}
+
+		switch {
+		case err == nil:
+			return line[:len(line)-1], nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF) && len(line) > 0:
+			return line, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// NewStdioCodec returns the codec for a -stdio framing name: "ndjson" for
+// classic MCP clients or "length" for MCP-Flow's length-prefixed frames.
+func NewStdioCodec(framing string) (Codec, error) {
+	switch framing {
+	case "ndjson":
+		return NewLineCodec(maxFrameSize), nil
+	case "length":
+		return NewFrameCodec(maxFrameSize), nil
+	default:
+		return nil, fmt.Errorf("unknown stdio framing %q (want ndjson or length)", framing)
+	}
+}
+
+// ServeStdio runs a single session over in and out, typically the process's
+// stdin and stdout, sharing the handler used for WebTransport sessions. It
+// returns when in reaches EOF.
+func (s *Server) ServeStdio(ctx context.Context, codec Codec, in io.Reader, out io.Writer) error {
+	logger := s.logger.With("transport", "stdio")
+	logger.Info("stdio session started")
+
+	sess := NewSession(s.handler, logger)
+	sess.codec = withJSON(codec, s.handler.jsonEngine())
+	sess.setPeer("stdio", "")
+
+	err := sess.Serve(ctx, in, out)
+	logger.Info("stdio session closed")
+	return err
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Streamable HTTP Transport
+// =============================================================================
+
+// streamableSessionHeader carries the session ID assigned at initialize.
+const streamableSessionHeader = "Mcp-Session-Id"
+
+// streamableSessionIdle is how long an HTTP session may go unused before it
+// is forgotten.
+const streamableSessionIdle = 30 * time.Minute
+
+// maxStreamableSessions bounds the HTTP sessions an instance holds; past
+// it, new ones are refused with 503 until idle ones are swept.
+const maxStreamableSessions = 10000
+
+// streamableSweepInterval is how often idle HTTP sessions are forgotten.
+const streamableSweepInterval = time.Minute
+
+// streamableHTTP implements the MCP Streamable HTTP transport: clients POST
+// JSON-RPC messages to a single endpoint and receive responses either as a
+// JSON body or as a short-lived SSE stream. Sessions are keyed by the
+// Mcp-Session-Id header and share the server's Handler with MCP-Flow.
+// Session state is written through to the store after every request, so a
+// session unknown here is picked up from the store if another instance
+// started it.
+type streamableHTTP struct {
+	handler     *Handler
+	store       SessionStore
+	logger      *slog.Logger
+	maxSessions int
+
+	mu       sync.Mutex
+	sessions map[string]*streamableSession
+}
+
+type streamableSession struct {
+	sess     *Session
+	lastUsed time.Time
+}
+
+func newStreamableHTTP(handler *Handler, store SessionStore, logger *slog.Logger) *streamableHTTP {
+	if store == nil {
+		memory := NewMemorySessionStore()
+		memory.MaxPending = handler.cfg.SessionMemory
+		store = memory
+	}
+	return &streamableHTTP{
+		handler:     handler,
+		store:       store,
+		logger:      logger.With("transport", "streamable-http"),
+		maxSessions: maxStreamableSessions,
+		sessions:    make(map[string]*streamableSession),
+	}
+}
+
+func (t *streamableHTTP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		t.handlePost(w, r)
+	case http.MethodDelete:
+		t.handleDelete(w, r)
+	default:
+		// No server-initiated messages yet, so there is no standalone
+		// GET stream to offer.
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (t *streamableHTTP) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxFrameSize+1))
+	if err != nil {
+		http.Error(w, "read body failed", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxFrameSize {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	engine := t.handler.jsonEngine()
+	reqs, batch, err := decodeHTTPMessages(engine, body)
+	if err != nil {
+		writeJSON(w, engine, http.StatusBadRequest, &RPCResponse{
+			JSONRPC: "2.0",
+			ID:      NullID,
+			Error:   &RPCError{Code: ErrCodeParseError, Message: "Parse error: " + err.Error()},
+		})
+		return
+	}
+
+	id, entry, created, status := t.lookup(r, reqs)
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	var resps []*RPCResponse
+	for _, req := range reqs {
+		if resp := entry.sess.handler.Handle(entry.sess, req); resp != nil {
+			resps = append(resps, resp)
+		}
+	}
+
+	if created {
+		// Only a session whose initialize succeeded is kept; the client
+		// of a failed one gets its error and no session ID.
+		if !entry.sess.isInitialized() {
+			entry.sess.Close()
+			id = ""
+		} else {
+			t.mu.Lock()
+			t.sessions[id] = entry
+			t.mu.Unlock()
+			entry.sess.logger.Info("session established")
+		}
+	}
+
+	if id != "" {
+		if err := t.store.Save(id, entry.sess.State(), streamableSessionIdle); err != nil {
+			entry.sess.logger.Error("session store save failed", "error", err)
+		}
+		w.Header().Set(streamableSessionHeader, id)
+	}
+
+	if len(resps) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if acceptsSSE(r) {
+		// Queued notifications ride along on the next event stream.
+		pending, err := t.pending(id, entry.sess)
+		if err != nil {
+			entry.sess.logger.Error("session store drain failed", "error", err)
+		}
+		writeSSE(w, engine, pending, resps)
+		return
+	}
+
+	if batch {
+		writeJSON(w, engine, http.StatusOK, resps)
+	} else {
+		writeJSON(w, engine, http.StatusOK, resps[0])
+	}
+}
+
+// lookup resolves the session for a POST. An initialize request creates a
+// new session, which the caller keeps only if initialize succeeds, as
+// created reports; anything else must present a session ID that is still
+// in the store, which is the source of truth when instances share it. A
+// session started elsewhere is adopted from its stored state. A non-zero
+// status reports a rejected request, 503 once maxSessions are held.
+// Sessions are bound to the tenant that created them and are not found
+// from any other.
+func (t *streamableHTTP) lookup(r *http.Request, reqs []*RPCRequest) (id string, entry *streamableSession, created bool, status int) {
+	handler := routeFrom(r.Context(), t.handler).handler
+	for _, req := range reqs {
+		if req.Method == "initialize" {
+			if t.full() {
+				return "", nil, false, http.StatusServiceUnavailable
+			}
+			id := newSessionID()
+			entry := &streamableSession{
+				sess:     NewSession(handler, t.logger.With("session", id, "remote", r.RemoteAddr)),
+				lastUsed: time.Now(),
+			}
+			entry.sess.push = t.pusher(id)
+			entry.sess.ack = t.acker(id)
+			entry.sess.setPeer("http", r.RemoteAddr)
+			entry.sess.setStateScope(id)
+			return id, entry, true, 0
+		}
+	}
+
+	id = r.Header.Get(streamableSessionHeader)
+	if id == "" {
+		return "", nil, false, http.StatusBadRequest
+	}
+
+	state, err := t.store.Load(id)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		t.logger.Error("session store load failed", "session", id, "error", err)
+		return "", nil, false, http.StatusServiceUnavailable
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.sessions[id]
+	if err != nil {
+		// Deleted or expired, possibly by another instance.
+		if ok {
+			delete(t.sessions, id)
+			go entry.sess.Close()
+		}
+		return "", nil, false, http.StatusNotFound
+	}
+	if state.Tenant != handler.tenant.name || ok && entry.sess.handler != handler {
+		return "", nil, false, http.StatusNotFound
+	}
+	if !ok {
+		if len(t.sessions) >= t.maxSessions {
+			return "", nil, false, http.StatusServiceUnavailable
+		}
+		entry = &streamableSession{
+			sess: NewSession(handler, t.logger.With("session", id, "remote", r.RemoteAddr)),
+		}
+		entry.sess.restore(state)
+		entry.sess.push = t.pusher(id)
+		entry.sess.ack = t.acker(id)
+		entry.sess.setPeer("http", r.RemoteAddr)
+		entry.sess.setStateScope(id)
+		t.sessions[id] = entry
+		entry.sess.logger.Info("session resumed from store")
+	}
+	entry.lastUsed = time.Now()
+	return id, entry, false, 0
+}
+
+// full reports whether maxSessions are held.
+func (t *streamableHTTP) full() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.sessions) >= t.maxSessions
+}
+
+// sweep forgets sessions idle past streamableSessionIdle every
+// streamableSweepInterval until ctx is done. Their stored state expires on
+// its own.
+func (t *streamableHTTP) sweep(ctx context.Context) {
+	ticker := time.NewTicker(streamableSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		now := time.Now()
+		var idle []*streamableSession
+		t.mu.Lock()
+		for id, s := range t.sessions {
+			if now.Sub(s.lastUsed) > streamableSessionIdle {
+				delete(t.sessions, id)
+				idle = append(idle, s)
+			}
+		}
+		t.mu.Unlock()
+		for _, s := range idle {
+			s.sess.Close()
+		}
+	}
+}
+
+func (t *streamableHTTP) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(streamableSessionHeader)
+	tenant := routeFrom(r.Context(), t.handler).handler.tenant.name
+
+	// It may belong to another instance, so the store decides.
+	state, err := t.store.Load(id)
+	if err != nil || state.Tenant != tenant {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	t.mu.Lock()
+	entry, ok := t.sessions[id]
+	delete(t.sessions, id)
+	t.mu.Unlock()
+
+	if err := t.store.Delete(id); err != nil {
+		t.logger.Error("session store delete failed", "session", id, "error", err)
+	}
+	handler := routeFrom(r.Context(), t.handler).handler
+	if err := handler.stateStore().Clear(httpStateScope(id)); err != nil {
+		t.logger.Error("session state clear failed", "session", id, "error", err)
+	}
+	if ok {
+		entry.sess.Close()
+		entry.sess.logger.Info("session closed")
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// notify queues a notification for session id, to be delivered on its next
+// event stream by whichever instance serves it. Once the store holds as
+// much for the session as it allows, further notifications are dropped:
+// a client that only ever asks for JSON responses never collects them.
+func (t *streamableHTTP) notify(id, method string, params map[string]interface{}) error {
+	msg, err := newNotification(method, params)
+	if err != nil {
+		return err
+	}
+	return t.push(id, msg)
+}
+
+// push queues an encoded notification for session id, numbered if
+// notifications are acknowledged.
+func (t *streamableHTTP) push(id string, msg *RPCRequest) error {
+	if store := t.ackStore(); store != nil {
+		return store.PushSeq(id, func(seq uint64) ([]byte, error) { return withSeq(msg, seq) }, streamableSessionIdle)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return t.store.Push(id, data, streamableSessionIdle)
+}
+
+// pusher returns the Session.push for session id, which queues through
+// the store like NotifySession.
+func (t *streamableHTTP) pusher(id string) func(*RPCRequest) error {
+	return func(msg *RPCRequest) error { return t.push(id, msg) }
+}
+
+// ackStore returns the store as an AckSessionStore if notifications are
+// acknowledged, or nil.
+func (t *streamableHTTP) ackStore() AckSessionStore {
+	store, ok := t.store.(AckSessionStore)
+	if !ok || !t.handler.cfg.AckNotifications {
+		return nil
+	}
+	return store
+}
+
+// acker returns the Session.ack for session id, or nil if notifications
+// are not acknowledged.
+func (t *streamableHTTP) acker(id string) func(uint64) error {
+	store := t.ackStore()
+	if store == nil {
+		return nil
+	}
+	return func(seq uint64) error { return store.Ack(id, seq) }
+}
+
+// pending returns the notifications to send on sess's next event stream:
+// every unacknowledged one for a client that acknowledges them, and
+// otherwise those queued since the last stream, which are then forgotten.
+func (t *streamableHTTP) pending(id string, sess *Session) ([][]byte, error) {
+	if store := t.ackStore(); store != nil && sess.acksNotifications() {
+		return store.Unacked(id)
+	}
+	return t.store.Drain(id)
+}
+
+// decodeHTTPMessages parses a POST body holding a single JSON-RPC message or
+// a batch array. The boolean reports whether the body was a batch.
+func decodeHTTPMessages(engine JSONEngine, body []byte) ([]*RPCRequest, bool, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var reqs []*RPCRequest
+		if err := engine.Unmarshal(trimmed, &reqs); err != nil {
+			return nil, true, err
+		}
+		if len(reqs) == 0 {
+			return nil, true, fmt.Errorf("empty batch")
+		}
+		return reqs, true, nil
+	}
+
+	var req RPCRequest
+	if err := engine.Unmarshal(trimmed, &req); err != nil {
+		return nil, false, err
+	}
+	return []*RPCRequest{&req}, false, nil
+}
+
+// acceptsSSE reports whether the client listed text/event-stream in Accept.
+func acceptsSSE(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// writeSSE streams pending (already encoded notifications) followed by
+// resps as message events.
+func writeSSE(w http.ResponseWriter, engine JSONEngine, pending [][]byte, resps []*RPCResponse) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	for _, msg := range pending {
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+	}
+	for _, resp := range resps {
+		data, err := engine.Marshal(resp)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, engine JSONEngine, status int, v interface{}) {
+	data, err := engine.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// =============================================================================
+// Subprocess Tool Provider (supervised stdio servers)
+// =============================================================================
+
+const (
+	// subprocessRestartMin and subprocessRestartMax bound the backoff
+	// between restarts of a crashed tool server.
+	subprocessRestartMin = time.Second
+	subprocessRestartMax = time.Minute
+	// subprocessStableAfter is how long a tool server must stay up for the
+	// backoff to start over.
+	subprocessStableAfter = time.Minute
+)
+
+// SubprocessToolProvider runs a stdio MCP server as a child process and
+// serves its tools as a RemoteToolProvider does. It also supervises the
+// process: when it exits, it is restarted with exponential backoff and its
+// catalog is imported again. Calls that arrive while it is down start it
+// on demand and are never retried, so a tool never runs twice.
+type SubprocessToolProvider struct {
+	*RemoteToolProvider
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewSubprocessToolProvider starts the server in cfg.Options.Command,
+// imports its tools, and supervises it until Close.
+func NewSubprocessToolProvider(ctx context.Context, cfg UpstreamConfig, logger *slog.Logger) (*SubprocessToolProvider, error) {
+	if len(cfg.Options.Command) == 0 {
+		return nil, errors.New("subprocess tool provider needs a command")
+	}
+	remote, err := NewRemoteToolProvider(ctx, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	sctx, cancel := context.WithCancel(context.Background())
+	p := &SubprocessToolProvider{
+		RemoteToolProvider: remote,
+		cancel:             cancel,
+		done:               make(chan struct{}),
+	}
+	go p.supervise(sctx)
+	return p, nil
+}
+
+// Close stops supervising and shuts the process down.
+func (p *SubprocessToolProvider) Close() error {
+	p.cancel()
+	<-p.done
+	return p.RemoteToolProvider.Close()
+}
+
+func (p *SubprocessToolProvider) supervise(ctx context.Context) {
+	defer close(p.done)
+
+	u := p.upstream
+	backoff := subprocessRestartMin
+	for {
+		// A failed on-demand restart leaves no process to wait for.
+		if exited := u.exited(); exited != nil {
+			started := time.Now()
+			select {
+			case <-ctx.Done():
+				return
+			case <-exited:
+			}
+			if time.Since(started) >= subprocessStableAfter {
+				backoff = subprocessRestartMin
+			}
+		}
+
+		for {
+			u.logger.Warn("tool server exited, restarting", "in", backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, subprocessRestartMax)
+
+			if err := p.restart(ctx); err != nil {
+				u.logger.Warn("tool server restart failed", "error", err)
+				continue
+			}
+			u.logger.Info("tool server restarted")
+			break
+		}
+	}
+}
+
+func (p *SubprocessToolProvider) restart(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, gatewayListTimeout)
+	defer cancel()
+
+	if err := p.upstream.restart(ctx); err != nil {
+		return err
+	}
+	return p.Refresh(ctx)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// =============================================================================
+// TCP+TLS Fallback Transport
+// =============================================================================
+
+// tcpALPN identifies MCP-Flow length-prefixed frames carried directly over
+// TLS, for networks where UDP (and therefore QUIC) is blocked.
+const tcpALPN = "mcp-flow"
+
+// transportAlternatives lists fallback endpoints advertised to clients in the
+// initialize result and the info endpoint, so a client that later finds UDP
+// blocked knows where else to connect. Hosts are omitted: clients reuse the
+// hostname they originally dialed.
+func (c Config) transportAlternatives() []map[string]interface{} {
+	var alts []map[string]interface{}
+
+	if port, ok := listenPort(c.TCPAddr); ok {
+		alts = append(alts, map[string]interface{}{
+			"type": "tcp+tls",
+			"port": port,
+			"alpn": tcpALPN,
+		})
+	}
+
+	if port, ok := listenPort(c.HTTPAddr); ok {
+		alts = append(alts,
+			map[string]interface{}{"type": "websocket", "port": port, "path": webSocketPath},
+			map[string]interface{}{"type": "streamable-http", "port": port, "path": "/mcp"},
+		)
+	}
+
+	return alts
+}
+
+// listenPort extracts the port from a listen address such as ":4434".
+func listenPort(addr string) (int, bool) {
+	if addr == "" {
+		return 0, false
+	}
+	_, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, false
+	}
+	port, err := strconv.Atoi(portStr)
+	return port, err == nil
+}
+
+// serveTCP accepts TLS 1.3 connections on the fallback address and runs one
+// session per connection with the same codec and handler as WebTransport.
+func (s *Server) serveTCP(ctx context.Context, tlsConfig *tls.Config) error {
+	cfg := tlsConfig.Clone()
+	cfg.NextProtos = []string{tcpALPN}
+
+	ln, err := tls.Listen("tcp", s.cfg.TCPAddr, cfg)
+	if err != nil {
+		return fmt.Errorf("tcp listen: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	s.logger.Info("tcp+tls fallback listening", "addr", ln.Addr().String())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("tcp accept: %w", err)
+		}
+
+		go s.serveTCPConn(ctx, conn)
+	}
+}
+
+func (s *Server) serveTCPConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	sessionLogger := s.logger.With("remote", conn.RemoteAddr().String(), "transport", "tcp+tls")
+	if err := s.handshakeTCP(ctx, conn); err != nil {
+		sessionLogger.Warn("tls handshake failed", "error", err)
+		return
+	}
+	sessionLogger.Info("session established")
+
+	// Close the connection on shutdown to unblock the read loop.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	sess := NewSession(s.handler, sessionLogger)
+	sess.setPeer("tcp", conn.RemoteAddr().String())
+	if s.cfg.AuthToken != "" || len(s.handler.tenants) > 0 {
+		sess.requireInitializeAuth()
+	}
+	if err := sess.Serve(ctx, conn, conn); err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, net.ErrClosed) {
+		sessionLogger.Error("session error", "error", err)
+	}
+	sessionLogger.Info("session closed")
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Tenants
+// =============================================================================
+
+// tenantPathPrefix selects a tenant by URL path: the HTTP-based transports
+// are also served under /tenants/<name>/, e.g. /tenants/acme/mcp.
+const tenantPathPrefix = "/tenants/"
+
+// TenantConfig describes one tenant of a multi-tenant server. Each tenant
+// gets its own Handler, so its tools, namespaces, experimental
+// capabilities, gateway upstreams, and caches are separate from every other
+// tenant's and from the default registry.
+type TenantConfig struct {
+	// Name identifies the tenant in paths, logs, and the session store.
+	Name string
+	// Token authenticates the tenant's clients in place of AuthToken, and
+	// selects the tenant when presented on the shared endpoints.
+	Token string
+	// Upstreams are aggregated into this tenant's catalog only.
+	Upstreams []UpstreamConfig
+	// MaxSessions caps the tenant's concurrent sessions; zero is unlimited.
+	MaxSessions int
+	// Quota caps the tenant's requests, tool time, and traffic per window.
+	Quota TenantQuota
+}
+
+// tenantState is the per-tenant part of a Handler. The default registry
+// has an empty name.
+type tenantState struct {
+	name        string
+	maxSessions int
+	quota       TenantQuota
+
+	mu       sync.Mutex
+	sessions int
+	usage    tenantUsage
+}
+
+// validateTenants rejects tenant sets that cannot be routed unambiguously.
+func validateTenants(base Config, tenants []TenantConfig) error {
+	names := make(map[string]bool)
+	tokens := make(map[string]string)
+	for _, t := range tenants {
+		if t.Name == "" || strings.ContainsAny(t.Name, "/?#") {
+			return fmt.Errorf("invalid tenant name %q", t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicate tenant %q", t.Name)
+		}
+		names[t.Name] = true
+		if t.MaxSessions < 0 || t.Quota.Window < 0 || t.Quota.Requests < 0 || t.Quota.ToolTime < 0 || t.Quota.Bytes < 0 {
+			return fmt.Errorf("tenant %q has a negative limit", t.Name)
+		}
+		if t.Token == "" {
+			continue
+		}
+		if other, ok := tokens[t.Token]; ok {
+			return fmt.Errorf("tenants %q and %q share a token", other, t.Name)
+		}
+		if t.Token == base.AuthToken {
+			return fmt.Errorf("tenant %q reuses the server's auth token", t.Name)
+		}
+		tokens[t.Token] = t.Name
+	}
+	return nil
+}
+
+// newTenantHandlers builds a Handler per tenant from the server's config,
+// sharing the root's drain state, load shedder, tool workers, usage
+// recorder, webhooks, event bridge, and cluster bus so draining, shedding,
+// the tool concurrency bound, usage reports, events, and broadcasts cover
+// every tenant.
+func newTenantHandlers(root *Handler, cfg Config) map[string]*Handler {
+	handlers := make(map[string]*Handler, len(cfg.Tenants))
+	for _, t := range cfg.Tenants {
+		tcfg := cfg
+		tcfg.AuthToken = t.Token
+		tcfg.Upstreams = t.Upstreams
+		tcfg.Tenants = nil
+		tcfg.Passthrough = nil
+		tcfg.ProxyBackends = nil
+		tcfg.ToolWorkers = 0
+		tcfg.Faults = nil
+		tcfg.UsageBucket = 0
+		tcfg.UsageSink = nil
+		tcfg.Webhooks = nil
+		tcfg.EventPublisher = nil
+		tcfg.ClusterBus = nil
+
+		h := NewHandler(tcfg)
+		h.tenant = &tenantState{name: t.Name, maxSessions: t.MaxSessions, quota: t.Quota}
+		h.drain = root.drain
+		h.load = root.load
+		h.toolPool = root.toolPool
+		h.usage = root.usage
+		h.webhooks = root.webhooks
+		h.events = root.events
+		h.cluster = root.cluster
+		h.faults = newFaultInjector(cfg, t.Name)
+		handlers[t.Name] = h
+	}
+	return handlers
+}
+
+// Tenant returns the Handler serving the named tenant, for registering its
+// namespaces and capabilities, or nil if there is no such tenant.
+func (s *Server) Tenant(name string) *Handler {
+	return s.handler.tenants[name]
+}
+
+// TenantName returns the name of the tenant h serves, or "" for the
+// default registry.
+func (h *Handler) TenantName() string {
+	return h.tenant.name
+}
+
+// tenantByToken returns the tenant whose token authorization
+// ("Bearer <token>") carries, if any.
+func (h *Handler) tenantByToken(authorization string) *Handler {
+	for _, th := range h.tenants {
+		if th.cfg.AuthToken != "" && th.cfg.tokenValid(authorization) {
+			return th
+		}
+	}
+	return nil
+}
+
+// admitSession counts sess against the tenant's session cap the first time
+// it initializes, refusing it while the server sheds load; Session.Close
+// gives the slot back.
+func (h *Handler) admitSession(sess *Session) error {
+	t := h.tenant
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.admittedBy == h {
+		return nil
+	}
+	if err := h.load.admit(); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.maxSessions > 0 && t.sessions >= t.maxSessions {
+		return mcpflowerr.RateLimited("tenant %q is at its limit of %d sessions", t.name, t.maxSessions)
+	}
+	t.sessions++
+	sess.admittedBy = h
+	return nil
+}
+
+func (h *Handler) releaseSession() {
+	h.tenant.mu.Lock()
+	h.tenant.sessions--
+	h.tenant.mu.Unlock()
+}
+
+// =============================================================================
+// Tenant Resolution (HTTP)
+// =============================================================================
+
+type tenantContextKey struct{}
+
+// tenantRoute is what authenticate resolved for a request.
+type tenantRoute struct {
+	handler *Handler
+	// basePath prefixes URLs handed back to the client, such as the
+	// legacy SSE message endpoint.
+	basePath string
+}
+
+// routeFrom returns the route authenticate stored in ctx, defaulting to
+// root for callers outside it.
+func routeFrom(ctx context.Context, root *Handler) tenantRoute {
+	if route, ok := ctx.Value(tenantContextKey{}).(tenantRoute); ok {
+		return route
+	}
+	return tenantRoute{handler: root}
+}
+
+// tenantPaths serves next under /tenants/<name>/, pinning requests to that
+// tenant before authenticate checks its token.
+func (s *Server) tenantPaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, tenantPathPrefix), "/")
+		h := s.Tenant(name)
+		if h == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		base := tenantPathPrefix + name
+		r2 := r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenantRoute{handler: h, basePath: base}))
+		r2.URL.Path = "/" + rest
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// mountTenants serves everything already on mux under /tenants/<name>/ as
+// well. Call it after the other routes are registered.
+func (s *Server) mountTenants(mux *http.ServeMux) {
+	if len(s.handler.tenants) > 0 {
+		mux.Handle(tenantPathPrefix, s.tenantPaths(mux))
+	}
+}
+
+// authenticate resolves the request's tenant and checks its bearer token:
+// a tenant pinned by path requires that tenant's token; otherwise a
+// tenant token selects its tenant, and anything else is the default
+// registry, guarded by AuthToken.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		route, pinned := r.Context().Value(tenantContextKey{}).(tenantRoute)
+
+		ok := true
+		tenant := s.handler.tenantByToken(authorization)
+		switch {
+		case pinned:
+			ok = route.handler.cfg.AuthToken == "" || route.handler.cfg.tokenValid(authorization)
+		case tenant != nil:
+			route = tenantRoute{handler: tenant}
+		default:
+			route = tenantRoute{handler: s.handler}
+			ok = s.cfg.AuthToken == "" || s.cfg.tokenValid(authorization)
+		}
+		if !ok {
+			s.httpAuthFailed(r)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-flow"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, route)))
+	})
+}
+
+// tenantFlags collects repeated -tenant name:token[,option=value...] flags.
+// The options are max-sessions, requests, tool-time, bytes, and window.
+type tenantFlags []TenantConfig
+
+func (f *tenantFlags) String() string {
+	names := make([]string, len(*f))
+	for i, t := range *f {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func (f *tenantFlags) Set(value string) error {
+	opts := strings.Split(value, ",")
+	name, token, ok := strings.Cut(opts[0], ":")
+	if !ok || name == "" || token == "" {
+		return fmt.Errorf("want name:token[,option=value...], got %q", value)
+	}
+	t := TenantConfig{Name: name, Token: token}
+	for _, opt := range opts[1:] {
+		key, val, _ := strings.Cut(opt, "=")
+		var err error
+		switch key {
+		case "max-sessions":
+			t.MaxSessions, err = strconv.Atoi(val)
+		case "requests":
+			t.Quota.Requests, err = strconv.ParseInt(val, 10, 64)
+		case "tool-time":
+			t.Quota.ToolTime, err = time.ParseDuration(val)
+		case "bytes":
+			t.Quota.Bytes, err = strconv.ParseInt(val, 10, 64)
+		case "window":
+			t.Quota.Window, err = time.ParseDuration(val)
+		default:
+			return fmt.Errorf("unknown tenant option %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tenant option %q: %w", opt, err)
+		}
+	}
+	*f = append(*f, t)
+	return nil
+}
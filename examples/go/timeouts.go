@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+// =============================================================================
+// Connection Timeouts
+// =============================================================================
+
+// A peer that opens a connection and then stalls holds a socket, a few
+// goroutines, and the memory of a handshake in progress for as long as the
+// server waits. Each stage a new client goes through has a deadline of its
+// own, after which the connection is closed and counted in
+// mcpflow_sessions_closed_total by the stage it stalled at:
+//
+//	handshake_timeout  the TLS or QUIC handshake (HandshakeTimeout)
+//	upgrade_timeout    a QUIC connection's first HTTP/3 request, such as
+//	                   the WebTransport CONNECT (UpgradeTimeout)
+//	stream_timeout     a WebTransport session's control stream (StreamTimeout)
+//	init_timeout       a framed session's initialize request (InitTimeout)
+//
+// The HTTPS listener leaves both its handshake and the request headers to
+// net/http's ReadHeaderTimeout, set to UpgradeTimeout, and does not count
+// them. stdio is local and waits as long as it takes.
+
+var (
+	// errStreamTimeout ends a WebTransport session that opened no control
+	// stream within Config.StreamTimeout.
+	errStreamTimeout = errors.New("no control stream in time")
+	// errInitTimeout ends a session that sent no initialize within
+	// Config.InitTimeout.
+	errInitTimeout = errors.New("no initialize in time")
+)
+
+// listenQUIC opens the QUIC listener of the main address, configured as
+// http3 would configure its own.
+func listenQUIC(addr string, cfg *tls.Config, quicConf *quic.Config) (*quic.EarlyListener, error) {
+	outer := http3.ConfigureTLSConfig(cfg)
+	copyECHKeys(outer, cfg)
+	quicConf = quicConf.Clone()
+	quicConf.EnableDatagrams = true
+	return quic.ListenAddrEarly(addr, outer, quicConf)
+}
+
+// serveQUICConn serves the HTTP/3 requests of conn, a connection accepted
+// before its handshake completed, closing it if the handshake or its first
+// request does not arrive in time.
+func (s *Server) serveQUICConn(wt *webtransport.Server, conn quic.EarlyConnection) {
+	if d := s.cfg.HandshakeTimeout; d > 0 {
+		go func() {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case <-conn.HandshakeComplete():
+			case <-conn.Context().Done():
+			case <-timer.C:
+				s.logger.Warn("quic handshake timed out", "remote", conn.RemoteAddr().String(), "timeout", d)
+				s.handler.metrics.ObserveSessionClosed(closedHandshakeTimeout)
+				conn.CloseWithError(quic.ApplicationErrorCode(http3.ErrCodeNoError), "handshake timeout")
+			}
+		}()
+	}
+	if d := s.cfg.UpgradeTimeout; d > 0 {
+		timer := time.AfterFunc(d, func() {
+			if _, waiting := s.awaiting.LoadAndDelete(conn); waiting {
+				s.logger.Warn("no request in time, closing connection", "remote", conn.RemoteAddr().String(), "timeout", d)
+				s.handler.metrics.ObserveSessionClosed(closedUpgradeTimeout)
+				conn.CloseWithError(quic.ApplicationErrorCode(http3.ErrCodeNoError), "no request in time")
+			}
+		})
+		s.awaiting.Store(conn, timer)
+		defer func() {
+			if _, waiting := s.awaiting.LoadAndDelete(conn); waiting {
+				timer.Stop()
+			}
+		}()
+	}
+	wt.ServeQUICConn(conn)
+}
+
+// requestArrived stops the upgrade deadline of the QUIC connection each
+// request arrives on.
+func (s *Server) requestArrived(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, ok := r.Context().Value(quicConnKey{}).(quic.Connection); ok {
+			if timer, waiting := s.awaiting.LoadAndDelete(conn); waiting {
+				timer.(*time.Timer).Stop()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// acceptControlStream waits for a WebTransport session's control stream,
+// closing the session if it does not open within Config.StreamTimeout.
+func (s *Session) acceptControlStream(ctx context.Context, wt *webtransport.Session) (webtransport.Stream, error) {
+	d := s.handler.cfg.StreamTimeout
+	if d <= 0 {
+		return wt.AcceptStream(ctx)
+	}
+	actx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	stream, err := wt.AcceptStream(actx)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		s.logger.Warn("no control stream in time, closing session", "timeout", d)
+		s.handler.metrics.ObserveSessionClosed(closedStreamTimeout)
+		wt.CloseWithError(0, errStreamTimeout.Error())
+		return nil, errStreamTimeout
+	}
+	return stream, err
+}
+
+// initDeadline returns a channel that fires when the session has had
+// Config.InitTimeout to send initialize, and a function that stops it. The
+// channel is nil, and never fires, on stdio or without a timeout.
+func (s *Session) initDeadline() (<-chan time.Time, func() bool) {
+	d := s.handler.cfg.InitTimeout
+	s.mu.RLock()
+	stdio := s.transport == "stdio"
+	s.mu.RUnlock()
+	if d <= 0 || stdio {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+// handshakeTCP completes the TLS handshake of a TCP+TLS connection within
+// Config.HandshakeTimeout.
+func (s *Server) handshakeTCP(ctx context.Context, conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	d := s.cfg.HandshakeTimeout
+	if !ok || d <= 0 {
+		return nil
+	}
+	conn.SetDeadline(time.Now().Add(d))
+	err := tlsConn.HandshakeContext(ctx)
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		s.handler.metrics.ObserveSessionClosed(closedHandshakeTimeout)
+	}
+	conn.SetDeadline(time.Time{})
+	return err
+}
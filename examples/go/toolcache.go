@@ -0,0 +1,189 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Per-Tool Result Cache
+// =============================================================================
+
+// CachingTool is implemented by expensive, deterministic tools that opt into
+// result caching. CachePolicy returns how long the result for args stays
+// valid and the invalidation keys (typically resource URIs) it depends on.
+// A zero TTL skips caching for that call.
+type CachingTool interface {
+	Tool
+	CachePolicy(args map[string]interface{}) (ttl time.Duration, deps []string)
+}
+
+// maxToolCacheEntries bounds the tool result cache; past it, the least
+// recently used results are dropped.
+const maxToolCacheEntries = 4096
+
+// toolResultCache holds CachingTool results keyed by tool name and argument
+// hash. Every entry is indexed under its tool name and declared dependency
+// keys so Invalidate can drop everything derived from a changed input.
+// Entries are kept in least recently used order, bounded by capacity.
+type toolResultCache struct {
+	capacity int
+
+	mu      sync.Mutex
+	entries map[string]*toolCacheEntry
+	deps    map[string]map[string]struct{}
+	order   *list.List // keys, most recently used first
+}
+
+type toolCacheEntry struct {
+	result  json.RawMessage
+	expires time.Time
+	deps    []string
+	elem    *list.Element
+}
+
+func newToolResultCache() *toolResultCache {
+	return &toolResultCache{
+		capacity: maxToolCacheEntries,
+		entries:  make(map[string]*toolCacheEntry),
+		deps:     make(map[string]map[string]struct{}),
+		order:    list.New(),
+	}
+}
+
+// entryKey derives the cache key for a call. encoding/json sorts map keys,
+// so equal arguments produce equal keys.
+func (c *toolResultCache) entryKey(tool string, args map[string]interface{}) (string, bool) {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return "", false
+	}
+	return tool + "\x00" + string(body), true
+}
+
+func (c *toolResultCache) get(key string) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		c.removeLocked(key)
+		return nil, false
+	}
+	c.order.MoveToFront(e.elem)
+	return e.result, true
+}
+
+func (c *toolResultCache) set(key string, result interface{}, ttl time.Duration, deps []string) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeLocked(key)
+	c.entries[key] = &toolCacheEntry{result: body, expires: time.Now().Add(ttl), deps: deps, elem: c.order.PushFront(key)}
+	for c.order.Len() > c.capacity {
+		c.removeLocked(c.order.Back().Value.(string))
+	}
+	for _, dep := range deps {
+		if c.deps[dep] == nil {
+			c.deps[dep] = make(map[string]struct{})
+		}
+		c.deps[dep][key] = struct{}{}
+	}
+}
+
+// Invalidate drops every cached result that depends on key. Tool names are
+// implicit dependencies of their own results.
+func (c *toolResultCache) Invalidate(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// removeLocked empties c.deps[key] as it goes, so count first.
+	keys := c.deps[key]
+	n := len(keys)
+	for entry := range keys {
+		c.removeLocked(entry)
+	}
+	return n
+}
+
+// InvalidateAll empties the cache.
+func (c *toolResultCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*toolCacheEntry)
+	c.deps = make(map[string]map[string]struct{})
+	c.order.Init()
+}
+
+func (c *toolResultCache) removeLocked(key string) {
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+	c.order.Remove(e.elem)
+	for _, dep := range e.deps {
+		delete(c.deps[dep], key)
+		if len(c.deps[dep]) == 0 {
+			delete(c.deps, dep)
+		}
+	}
+}
+
+// =============================================================================
+// Invalidation Hooks
+// =============================================================================
+
+// InvalidateToolResults drops cached tool results that depend on key, which
+// is either a tool name or a dependency key declared by CachePolicy.
+func (h *Handler) InvalidateToolResults(key string) {
+	if n := h.toolCache.Invalidate(key); n > 0 {
+		slog.Debug("tool results invalidated", "key", key, "entries", n)
+	}
+}
+
+// NotifyResourceUpdated records that the resource at uri changed, dropping
+// cached tool results derived from it and telling the sessions subscribed
+// to it.
+func (h *Handler) NotifyResourceUpdated(uri string) {
+	h.InvalidateToolResults(uri)
+	h.notifySubscribers(uri)
+}
+
+// NotifyToolsListChanged records that the tool registry changed and sends
+// notifications/tools/list_changed to every session. Cached results may
+// have come from a tool that was replaced, so all are dropped, along with
+// the cached tools/list.
+func (h *Handler) NotifyToolsListChanged() {
+	h.toolCache.InvalidateAll()
+	h.cache.invalidate("tools")
+	h.broadcastListChanged("tools")
+}
+
+// NotifyResourcesListChanged drops the cached resources/list and sends
+// notifications/resources/list_changed to every session told at initialize
+// that the resource list may change.
+func (h *Handler) NotifyResourcesListChanged() {
+	h.cache.invalidate("resources")
+	h.broadcastListChanged("resources")
+}
+
+// NotifyPromptsListChanged drops the cached prompts/list and sends
+// notifications/prompts/list_changed to every session told at initialize
+// that the prompt list may change.
+func (h *Handler) NotifyPromptsListChanged() {
+	h.cache.invalidate("prompts")
+	h.broadcastListChanged("prompts")
+}
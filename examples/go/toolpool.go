@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Tool Worker Pool
+// =============================================================================
+
+const (
+	defaultToolWorkers = 256
+	defaultToolQueue   = 1024
+	// toolPoolRetryAfter is the retry hint sent when the queue is full.
+	toolPoolRetryAfter = time.Second
+)
+
+// toolPool runs tool executions on a fixed set of workers fed by a bounded
+// queue, so a flood of tools/call over many sessions and HTTP requests
+// queues up instead of running everything at once. A call that finds the
+// queue full is rejected straight away with a retryable overloaded error
+// rather than waiting behind work that may take minutes. Tenants share the
+// server's pool.
+type toolPool struct {
+	workers int
+	jobs    chan func()
+
+	busy     atomic.Int64
+	rejected atomic.Uint64
+}
+
+// newToolPool starts workers goroutines serving a queue of the given depth.
+// It returns nil, which runs tools inline, if workers is not positive.
+func newToolPool(workers, queue int) *toolPool {
+	if workers <= 0 {
+		return nil
+	}
+	if queue < 0 {
+		queue = 0
+	}
+	p := &toolPool{workers: workers, jobs: make(chan func(), queue)}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *toolPool) work() {
+	for job := range p.jobs {
+		p.busy.Add(1)
+		job()
+		p.busy.Add(-1)
+	}
+}
+
+// do runs fn on a worker and waits for it to return, or fails with an
+// overloaded error if every worker is busy and the queue is full. A panic
+// in fn is raised again on the caller's goroutine, where it would have
+// happened without the pool, rather than killing the worker.
+func (p *toolPool) do(fn func()) error {
+	if p == nil {
+		fn()
+		return nil
+	}
+	done := make(chan struct{})
+	var panicked interface{}
+	job := func() {
+		defer close(done)
+		defer func() { panicked = recover() }()
+		fn()
+	}
+	select {
+	case p.jobs <- job:
+	default:
+		p.rejected.Add(1)
+		return mcpflowerr.Overloaded("all %d tool workers are busy and %d calls are queued", p.workers, cap(p.jobs)).
+			WithRetryAfter(toolPoolRetryAfter)
+	}
+	<-done
+	if panicked != nil {
+		panic(panicked)
+	}
+	return nil
+}
+
+// writePrometheus renders the pool's gauges and rejection counter.
+func (p *toolPool) writePrometheus(w io.Writer) {
+	if p == nil {
+		return
+	}
+	fmt.Fprintln(w, "# HELP mcpflow_tool_workers Workers available to run tool calls.")
+	fmt.Fprintln(w, "# TYPE mcpflow_tool_workers gauge")
+	fmt.Fprintf(w, "mcpflow_tool_workers %d\n", p.workers)
+	fmt.Fprintln(w, "# HELP mcpflow_tool_workers_busy Workers running a tool call.")
+	fmt.Fprintln(w, "# TYPE mcpflow_tool_workers_busy gauge")
+	fmt.Fprintf(w, "mcpflow_tool_workers_busy %d\n", p.busy.Load())
+	fmt.Fprintln(w, "# HELP mcpflow_tool_queue_depth Tool calls waiting for a worker.")
+	fmt.Fprintln(w, "# TYPE mcpflow_tool_queue_depth gauge")
+	fmt.Fprintf(w, "mcpflow_tool_queue_depth %d\n", len(p.jobs))
+	fmt.Fprintln(w, "# HELP mcpflow_tool_queue_capacity Tool calls that can wait for a worker.")
+	fmt.Fprintln(w, "# TYPE mcpflow_tool_queue_capacity gauge")
+	fmt.Fprintf(w, "mcpflow_tool_queue_capacity %d\n", cap(p.jobs))
+	fmt.Fprintln(w, "# HELP mcpflow_tool_rejected_total Tool calls rejected because the queue was full.")
+	fmt.Fprintln(w, "# TYPE mcpflow_tool_rejected_total counter")
+	fmt.Fprintf(w, "mcpflow_tool_rejected_total %d\n", p.rejected.Load())
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// Tool Rate Limits
+// =============================================================================
+
+// Config.ToolRates gives expensive tools a token bucket of their own in
+// every session, so one client cannot call, say, a search tool faster
+// than its backend can answer, however fast it may call the others. A
+// call with no token left fails with a rate_limited (-32012) error whose
+// data carries the limit and when to retry:
+//
+//	{"retryAfter": 0.73, "details": {"tool": "search", "rate": 1, "burst": 1}}
+//
+// A call replayed from the idempotency window takes no token, and a refused
+// call is not remembered there, so a retry with the same key runs.
+
+// ToolRate limits the calls one session makes to a tool.
+type ToolRate struct {
+	// Rate is the calls allowed per second, on average.
+	Rate float64
+	// Burst is how many calls may be made at once; zero means Rate,
+	// rounded up.
+	Burst int
+}
+
+// takeToolToken takes a token from the session's bucket for tool, or
+// returns a rate_limited error if it has none. Tools without a rate are
+// not limited.
+func (h *Handler) takeToolToken(sess *Session, tool string) error {
+	rate, ok := h.cfg.ToolRates[tool]
+	if !ok || rate.Rate <= 0 {
+		return nil
+	}
+
+	sess.mu.Lock()
+	bucket := sess.toolBuckets[tool]
+	if bucket == nil {
+		if sess.toolBuckets == nil {
+			sess.toolBuckets = make(map[string]*tokenBucket)
+		}
+		bucket = newTokenBucket(rate.Rate, rate.Burst)
+		sess.toolBuckets[tool] = bucket
+	}
+	allowed := bucket.allow(time.Now())
+	wait := bucket.wait()
+	sess.mu.Unlock()
+	if allowed {
+		return nil
+	}
+
+	h.metrics.ObserveToolRateLimited(tool)
+	return mcpflowerr.RateLimited("tool %q is limited to %g calls per second", tool, rate.Rate).
+		WithRetryAfter(wait).
+		WithDetail("tool", tool).
+		WithDetail("rate", rate.Rate).
+		WithDetail("burst", int(bucket.burst))
+}
+
+// toolRateFlags collects repeated -tool-rate name=rate[,burst=N] flags.
+type toolRateFlags map[string]ToolRate
+
+func (f toolRateFlags) String() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (f toolRateFlags) Set(value string) error {
+	opts := strings.Split(value, ",")
+	name, rateStr, ok := strings.Cut(opts[0], "=")
+	if !ok || name == "" {
+		return fmt.Errorf("want name=rate[,burst=N], got %q", value)
+	}
+	rate, err := strconv.ParseFloat(rateStr, 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return fmt.Errorf("invalid rate %q: want calls per second above zero", rateStr)
+	}
+	r := ToolRate{Rate: rate}
+	for _, opt := range opts[1:] {
+		key, val, _ := strings.Cut(opt, "=")
+		switch key {
+		case "burst":
+			if r.Burst, err = strconv.Atoi(val); err != nil {
+				return fmt.Errorf("invalid tool rate option %q: %w", opt, err)
+			}
+		default:
+			return fmt.Errorf("unknown tool rate option %q", key)
+		}
+	}
+	f[name] = r
+	return nil
+}
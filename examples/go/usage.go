@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Usage Reporting
+// =============================================================================
+
+// With Config.UsageBucket set, every tools/call is counted in a usage
+// bucket of that length, keyed by tool, tenant, and client: the calls, how
+// many failed, the bytes in and out, and the time spent. Buckets are kept
+// in a UsageStore, in memory for Config.UsageRetention unless another is
+// configured, and rolled up at query time into longer steps and coarser
+// groups by Server.UsageReport, served on the admin listener at
+// /usage/report.
+//
+// The tenant is the one whose token the session presented, "" for the
+// default registry; the client is the name the session gave in its
+// clientInfo, which the client chooses.
+
+const (
+	defaultUsageRetention = 24 * time.Hour
+
+	// maxUsageKeys bounds the keys one bucket of the in-memory store
+	// holds, so clients sending arbitrary tool and client names cannot grow
+	// it without limit. Calls past it are counted under usageOther.
+	maxUsageKeys = 4096
+	usageOther   = "other"
+)
+
+// UsageKey is who used what: a tool, called by a client of a tenant.
+type UsageKey struct {
+	Tool   string `json:"tool,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	Client string `json:"client,omitempty"`
+}
+
+// UsageCounts is what the calls under one UsageKey used.
+type UsageCounts struct {
+	Calls int64 `json:"calls"`
+	// Errors counts the calls answered with an error or an isError result.
+	Errors   int64 `json:"errors"`
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+	// Seconds is the time spent handling the calls, and MaxSeconds the
+	// longest one.
+	Seconds    float64 `json:"seconds"`
+	MaxSeconds float64 `json:"maxSeconds"`
+}
+
+func (c *UsageCounts) add(o UsageCounts) {
+	c.Calls += o.Calls
+	c.Errors += o.Errors
+	c.BytesIn += o.BytesIn
+	c.BytesOut += o.BytesOut
+	c.Seconds += o.Seconds
+	if o.MaxSeconds > c.MaxSeconds {
+		c.MaxSeconds = o.MaxSeconds
+	}
+}
+
+// UsageBucket is the usage of one key in the bucket starting at Start.
+type UsageBucket struct {
+	Start time.Time
+	Key   UsageKey
+	UsageCounts
+}
+
+// UsageStore keeps usage buckets. A store shared between instances, such
+// as a time-series database, gives a report covering all of them.
+// Implementations must be safe for concurrent use.
+type UsageStore interface {
+	// Add adds counts to key's bucket starting at start.
+	Add(start time.Time, key UsageKey, counts UsageCounts) error
+	// Buckets returns the buckets starting at or after from and before
+	// to, in any order.
+	Buckets(from, to time.Time) ([]UsageBucket, error)
+}
+
+// usageRecorder counts tool calls into a UsageStore, when
+// Config.UsageBucket is set, and hands them to Config.UsageSink, when one
+// is. Every tenant's Handler shares the root's.
+type usageRecorder struct {
+	store    UsageStore
+	bucket   time.Duration
+	exporter *usageExporter
+	logger   *slog.Logger
+}
+
+// newUsageRecorder returns nil when cfg neither buckets nor exports usage.
+func newUsageRecorder(cfg Config, metrics *Metrics) *usageRecorder {
+	if cfg.UsageBucket <= 0 && cfg.UsageSink == nil {
+		return nil
+	}
+	u := &usageRecorder{bucket: cfg.UsageBucket, logger: slog.Default().With("component", "usage")}
+	if cfg.UsageBucket > 0 {
+		u.store = cfg.UsageStore
+		if u.store == nil {
+			retention := cfg.UsageRetention
+			if retention <= 0 {
+				retention = defaultUsageRetention
+			}
+			u.store = NewMemoryUsageStore(retention)
+		}
+	}
+	if cfg.UsageSink != nil {
+		u.exporter = newUsageExporter(cfg.UsageSink, metrics, u.logger)
+	}
+	return u
+}
+
+// recordUsage counts a tools/call of tool that took elapsed and was
+// answered with resp.
+func (h *Handler) recordUsage(sess *Session, req *RPCRequest, resp *RPCResponse, tool string, elapsed time.Duration, failed bool) {
+	u := h.usage
+	if u == nil {
+		return
+	}
+	now := time.Now()
+	rec := UsageRecord{
+		Time:          now.Add(-elapsed).UTC(),
+		Tenant:        h.tenant.name,
+		Client:        sess.ClientInfo().Name,
+		Tool:          tool,
+		CorrelationID: req.correlation,
+		Duration:      elapsed,
+		BytesIn:       int64(jsonSize(req)),
+		BytesOut:      int64(jsonSize(resp)),
+		Failed:        failed,
+		Replayed:      req.replayed,
+	}
+	if resp.Error != nil {
+		rec.ErrorCode = resp.Error.Code
+	}
+
+	if u.store != nil {
+		key := UsageKey{Tool: rec.Tool, Tenant: rec.Tenant, Client: rec.Client}
+		counts := UsageCounts{
+			Calls:      1,
+			BytesIn:    rec.BytesIn,
+			BytesOut:   rec.BytesOut,
+			Seconds:    elapsed.Seconds(),
+			MaxSeconds: elapsed.Seconds(),
+		}
+		if failed {
+			counts.Errors = 1
+		}
+		if err := u.store.Add(now.Truncate(u.bucket).UTC(), key, counts); err != nil {
+			u.logger.Warn("recording usage failed", "tool", tool, "error", err)
+		}
+	}
+	if u.exporter != nil {
+		u.exporter.export(rec)
+	}
+}
+
+// UsageQuery selects and rolls up usage buckets for Server.UsageReport.
+type UsageQuery struct {
+	// From and To bound the buckets reported by their start.
+	From, To time.Time
+	// Step is the length of each reported period, a multiple of
+	// Config.UsageBucket; zero reports the whole range as one.
+	Step time.Duration
+	// By lists the key fields rows are grouped by, of tool, tenant, and
+	// client; the others are summed over. Empty means all three.
+	By []string
+	// Tool, Tenant, and Client, when set, report only matching usage.
+	Tool, Tenant, Client string
+}
+
+// UsageRow is the usage of one group in one period of a report.
+type UsageRow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	UsageKey
+	UsageCounts
+}
+
+// UsageReport is the answer to a UsageQuery. Rows are ordered by period,
+// then by calls, most first.
+type UsageReport struct {
+	From   time.Time  `json:"from"`
+	To     time.Time  `json:"to"`
+	Bucket string     `json:"bucket"`
+	Step   string     `json:"step,omitempty"`
+	By     []string   `json:"by"`
+	Rows   []UsageRow `json:"rows"`
+}
+
+var usageFields = map[string]func(*UsageKey) *string{
+	"tool":   func(k *UsageKey) *string { return &k.Tool },
+	"tenant": func(k *UsageKey) *string { return &k.Tenant },
+	"client": func(k *UsageKey) *string { return &k.Client },
+}
+
+// UsageReport rolls up the usage recorded between q.From and q.To. It
+// fails if usage reporting is off or the query is invalid.
+func (s *Server) UsageReport(q UsageQuery) (*UsageReport, error) {
+	u := s.handler.usage
+	if u == nil || u.store == nil {
+		return nil, fmt.Errorf("usage reporting is off")
+	}
+	if q.Step < 0 || q.Step%u.bucket != 0 {
+		return nil, fmt.Errorf("step %s is not a multiple of the %s usage bucket", q.Step, u.bucket)
+	}
+	if len(q.By) == 0 {
+		q.By = []string{"tool", "tenant", "client"}
+	}
+	for _, field := range q.By {
+		if usageFields[field] == nil {
+			return nil, fmt.Errorf("unknown usage field %q: want tool, tenant, or client", field)
+		}
+	}
+	from, to := q.From.Truncate(u.bucket).UTC(), q.To.UTC()
+	if !from.Before(to) {
+		return nil, fmt.Errorf("empty range from %s to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	buckets, err := u.store.Buckets(from, to)
+	if err != nil {
+		return nil, err
+	}
+	type group struct {
+		start time.Time
+		key   UsageKey
+	}
+	rows := make(map[group]*UsageRow)
+	for _, b := range buckets {
+		if (q.Tool != "" && b.Key.Tool != q.Tool) ||
+			(q.Tenant != "" && b.Key.Tenant != q.Tenant) ||
+			(q.Client != "" && b.Key.Client != q.Client) {
+			continue
+		}
+		var g group
+		for _, field := range q.By {
+			*usageFields[field](&g.key) = *usageFields[field](&b.Key)
+		}
+		g.start = from
+		end := to
+		if q.Step > 0 {
+			g.start = b.Start.Truncate(q.Step).UTC()
+			end = g.start.Add(q.Step)
+		}
+		row := rows[g]
+		if row == nil {
+			row = &UsageRow{Start: g.start, End: end, UsageKey: g.key}
+			rows[g] = row
+		}
+		row.add(b.UsageCounts)
+	}
+
+	report := &UsageReport{From: from, To: to, Bucket: u.bucket.String(), By: q.By, Rows: make([]UsageRow, 0, len(rows))}
+	if q.Step > 0 {
+		report.Step = q.Step.String()
+	}
+	for _, row := range rows {
+		report.Rows = append(report.Rows, *row)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		switch {
+		case !a.Start.Equal(b.Start):
+			return a.Start.Before(b.Start)
+		case a.Calls != b.Calls:
+			return a.Calls > b.Calls
+		case a.Tool != b.Tool:
+			return a.Tool < b.Tool
+		case a.Tenant != b.Tenant:
+			return a.Tenant < b.Tenant
+		}
+		return a.Client < b.Client
+	})
+	return report, nil
+}
+
+// parseUsageQuery reads a UsageQuery from the parameters of /usage/report:
+// since (a duration back from now, default the retention) or from and to
+// (RFC 3339), step, by (comma-separated), tool, tenant, and client.
+func parseUsageQuery(v url.Values, retention time.Duration) (UsageQuery, error) {
+	now := time.Now()
+	q := UsageQuery{From: now.Add(-retention), To: now, Tool: v.Get("tool"), Tenant: v.Get("tenant"), Client: v.Get("client")}
+	if since := v.Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil {
+			return q, fmt.Errorf("invalid since: %w", err)
+		}
+		q.From = now.Add(-d)
+	}
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if value := v.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return q, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*t = parsed
+		}
+	}
+	if step := v.Get("step"); step != "" {
+		d, err := time.ParseDuration(step)
+		if err != nil {
+			return q, fmt.Errorf("invalid step: %w", err)
+		}
+		q.Step = d
+	}
+	if by := v.Get("by"); by != "" {
+		q.By = strings.Split(by, ",")
+	}
+	return q, nil
+}
+
+// usageReportHandler serves Server.UsageReport as JSON.
+func (s *Server) usageReportHandler(w http.ResponseWriter, r *http.Request) {
+	if u := s.handler.usage; u == nil || u.store == nil {
+		http.Error(w, "usage reporting is off", http.StatusNotFound)
+		return
+	}
+	retention := s.cfg.UsageRetention
+	if retention <= 0 {
+		retention = defaultUsageRetention
+	}
+	q, err := parseUsageQuery(r.URL.Query(), retention)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := s.UsageReport(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// =============================================================================
+// In-Memory Usage Store
+// =============================================================================
+
+// MemoryUsageStore is a UsageStore for a single instance. Buckets older
+// than its retention are swept as new usage is added.
+type MemoryUsageStore struct {
+	retention time.Duration
+
+	mu        sync.Mutex
+	buckets   map[time.Time]map[UsageKey]*UsageCounts
+	lastSweep time.Time
+}
+
+// NewMemoryUsageStore creates an empty store keeping buckets for
+// retention.
+func NewMemoryUsageStore(retention time.Duration) *MemoryUsageStore {
+	return &MemoryUsageStore{retention: retention, buckets: make(map[time.Time]map[UsageKey]*UsageCounts)}
+}
+
+// Add implements UsageStore.
+func (s *MemoryUsageStore) Add(start time.Time, key UsageKey, counts UsageCounts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > memorySweepInterval {
+		cutoff := now.Add(-s.retention)
+		for t := range s.buckets {
+			if t.Before(cutoff) {
+				delete(s.buckets, t)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	start = start.UTC()
+	keys := s.buckets[start]
+	if keys == nil {
+		keys = make(map[UsageKey]*UsageCounts)
+		s.buckets[start] = keys
+	}
+	c := keys[key]
+	if c == nil {
+		if len(keys) >= maxUsageKeys {
+			key = UsageKey{Tool: usageOther, Tenant: usageOther, Client: usageOther}
+		}
+		if c = keys[key]; c == nil {
+			c = &UsageCounts{}
+			keys[key] = c
+		}
+	}
+	c.add(counts)
+	return nil
+}
+
+// Buckets implements UsageStore.
+func (s *MemoryUsageStore) Buckets(from, to time.Time) ([]UsageBucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []UsageBucket
+	for t, keys := range s.buckets {
+		if t.Before(from) || !t.Before(to) {
+			continue
+		}
+		for key, c := range keys {
+			out = append(out, UsageBucket{Start: t, Key: key, UsageCounts: *c})
+		}
+	}
+	return out, nil
+}
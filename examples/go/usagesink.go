@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Usage Export
+// =============================================================================
+
+// Config.UsageSink streams usage out call by call, for operators who meter
+// or bill in a pipeline of their own. Records are queued and handed to the
+// sink in order on one goroutine, so a slow sink never holds up a tool
+// call; if usageQueueSize records are waiting, newer ones are dropped and
+// counted in mcpflow_usage_records_total{outcome="dropped"}. The queue is
+// flushed when the server shuts down, after the hooks registered with
+// OnShutdown.
+
+// usageQueueSize is how many records may wait for a slow UsageSink.
+const usageQueueSize = 4096
+
+// UsageRecord is the usage of one finished tools/call.
+type UsageRecord struct {
+	// Time is when the call arrived.
+	Time time.Time `json:"time"`
+	// Tenant is the tenant whose token the session presented, "" for the
+	// default registry, and Client the session's clientInfo name.
+	Tenant string `json:"tenant,omitempty"`
+	Client string `json:"client,omitempty"`
+	Tool   string `json:"tool"`
+	// CorrelationID identifies the call in logs and in its response's
+	// _meta, and can deduplicate records.
+	CorrelationID string        `json:"correlationId,omitempty"`
+	Duration      time.Duration `json:"durationNs"`
+	// BytesIn and BytesOut are the JSON-encoded sizes of the request and
+	// its response.
+	BytesIn  int64 `json:"bytesIn"`
+	BytesOut int64 `json:"bytesOut"`
+	// Failed is set for error responses and isError results, and
+	// ErrorCode holds the JSON-RPC code of an error response.
+	Failed    bool `json:"failed,omitempty"`
+	ErrorCode int  `json:"errorCode,omitempty"`
+	// Replayed is set when the response came from the idempotency window
+	// or the response cache and the tool did not run.
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+// UsageSink receives the UsageRecord of every finished tools/call. It is
+// called from a single goroutine, in the order calls finished. An error is
+// logged and the record counted as failed; it is not retried.
+type UsageSink interface {
+	RecordUsage(rec UsageRecord) error
+}
+
+// UsageSinkFunc adapts a function to UsageSink.
+type UsageSinkFunc func(rec UsageRecord) error
+
+// RecordUsage implements UsageSink.
+func (f UsageSinkFunc) RecordUsage(rec UsageRecord) error { return f(rec) }
+
+// Outcomes of a usage record, for ObserveUsageRecord.
+const (
+	usageExported = "exported"
+	usageDropped  = "dropped"
+	usageFailed   = "failed"
+)
+
+// usageExporter queues records for a UsageSink.
+type usageExporter struct {
+	sink    UsageSink
+	metrics *Metrics
+	logger  *slog.Logger
+
+	mu     sync.RWMutex
+	queue  chan UsageRecord
+	closed bool
+	done   chan struct{}
+}
+
+func newUsageExporter(sink UsageSink, metrics *Metrics, logger *slog.Logger) *usageExporter {
+	e := &usageExporter{
+		sink:    sink,
+		metrics: metrics,
+		logger:  logger,
+		queue:   make(chan UsageRecord, usageQueueSize),
+		done:    make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// export queues rec, or drops it if the queue is full or closed.
+func (e *usageExporter) export(rec UsageRecord) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if !e.closed {
+		select {
+		case e.queue <- rec:
+			return
+		default:
+		}
+	}
+	e.metrics.ObserveUsageRecord(usageDropped)
+}
+
+func (e *usageExporter) run() {
+	defer close(e.done)
+	for rec := range e.queue {
+		if err := e.sink.RecordUsage(rec); err != nil {
+			e.logger.Warn("usage sink failed", "tool", rec.Tool, "correlation_id", rec.CorrelationID, "error", err)
+			e.metrics.ObserveUsageRecord(usageFailed)
+			continue
+		}
+		e.metrics.ObserveUsageRecord(usageExported)
+	}
+}
+
+// close stops queueing records and waits until the queued ones have been
+// handed to the sink, or ctx expires. It is a ShutdownHook.
+func (e *usageExporter) close(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// =============================================================================
+// JSON Lines Sink
+// =============================================================================
+
+// JSONUsageSink writes each record as a line of JSON, for a billing
+// pipeline that tails a file.
+type JSONUsageSink struct {
+	enc *json.Encoder
+}
+
+// NewJSONUsageSink returns a sink writing to w.
+func NewJSONUsageSink(w io.Writer) *JSONUsageSink {
+	return &JSONUsageSink{enc: json.NewEncoder(w)}
+}
+
+// RecordUsage implements UsageSink.
+func (s *JSONUsageSink) RecordUsage(rec UsageRecord) error {
+	return s.enc.Encode(rec)
+}
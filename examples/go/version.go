@@ -0,0 +1,53 @@
+package main
+
+// =============================================================================
+// Protocol Version Negotiation
+// =============================================================================
+
+// supportedProtocolVersions lists the MCP revisions this server speaks,
+// oldest first. Revisions are dates, so they order lexically.
+var supportedProtocolVersions = []string{
+	"2024-11-05",
+	"2025-03-26",
+	"2025-06-18",
+}
+
+var latestProtocolVersion = supportedProtocolVersions[len(supportedProtocolVersions)-1]
+
+// Protocol features introduced after the base revision.
+const (
+	FeatureToolAnnotations  = "toolAnnotations"
+	FeatureStructuredOutput = "structuredOutput"
+	FeatureElicitation      = "elicitation"
+)
+
+// featureVersions maps each gated feature to the first revision carrying it.
+var featureVersions = map[string]string{
+	FeatureToolAnnotations:  "2025-03-26",
+	FeatureStructuredOutput: "2025-06-18",
+	FeatureElicitation:      "2025-06-18",
+}
+
+// negotiateProtocolVersion picks the revision to use for a session. A
+// supported request is echoed back; otherwise the highest supported revision
+// not newer than the request is chosen, falling back to the latest when the
+// client is older than everything we know.
+func negotiateProtocolVersion(requested string) string {
+	chosen := ""
+	for _, v := range supportedProtocolVersions {
+		if v <= requested {
+			chosen = v
+		}
+	}
+	if chosen == "" {
+		return latestProtocolVersion
+	}
+	return chosen
+}
+
+// versionSupports reports whether a negotiated revision includes feature.
+// Unknown features are treated as unsupported.
+func versionSupports(version, feature string) bool {
+	since, ok := featureVersions[feature]
+	return ok && version >= since
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// Tool Versions
+// =============================================================================
+
+// versionSep separates a tool's name from the major version it is pinned
+// to, as in search@v2.
+const versionSep = "@v"
+
+// toolVersion is a parsed semantic version. A leading "v" is optional and
+// minor and patch default to zero, so "v2" is 2.0.0.
+type toolVersion struct {
+	major, minor, patch int
+	pre                 string
+}
+
+func parseToolVersion(s string) (toolVersion, error) {
+	var v toolVersion
+	core := strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(core, '+'); i >= 0 {
+		core = core[:i]
+	}
+	core, v.pre, _ = strings.Cut(core, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("version %q: want MAJOR.MINOR.PATCH", s)
+	}
+	nums := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("version %q: want MAJOR.MINOR.PATCH", s)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// less orders versions by precedence; a pre-release precedes its release.
+func (v toolVersion) less(o toolVersion) bool {
+	if v.major != o.major {
+		return v.major < o.major
+	}
+	if v.minor != o.minor {
+		return v.minor < o.minor
+	}
+	if v.patch != o.patch {
+		return v.patch < o.patch
+	}
+	if v.pre == "" || o.pre == "" {
+		return v.pre != "" && o.pre == ""
+	}
+	return v.pre < o.pre
+}
+
+// servedTool is a tool under the name it is listed by. alias, when set, is
+// the name@vN it can also be called by.
+type servedTool struct {
+	name  string
+	alias string
+	tool  Tool
+}
+
+// serveVersions resolves one registry's tools into the names they are
+// served under. A name shared by several versions is listed for the newest
+// one, and each older version is listed as name@vN for its major version
+// N; the newest is also callable as name@vN, so clients can pin a major
+// version before the next one ships. checkToolVersions rejects the sets
+// this cannot resolve.
+func serveVersions(tools []Tool) []servedTool {
+	type candidate struct {
+		tool    Tool
+		version toolVersion
+	}
+	var names []string
+	byName := make(map[string][]candidate)
+	for _, t := range tools {
+		c := candidate{tool: t}
+		if vt, ok := t.(VersionedTool); ok {
+			c.version, _ = parseToolVersion(vt.Version())
+		}
+		if byName[t.Name()] == nil {
+			names = append(names, t.Name())
+		}
+		byName[t.Name()] = append(byName[t.Name()], c)
+	}
+
+	served := make([]servedTool, 0, len(tools))
+	for _, name := range names {
+		versions := byName[name]
+		sort.SliceStable(versions, func(i, j int) bool { return versions[j].version.less(versions[i].version) })
+		for i, c := range versions {
+			st := servedTool{name: name, tool: c.tool}
+			if _, ok := c.tool.(VersionedTool); ok {
+				st.alias = fmt.Sprintf("%s%s%d", name, versionSep, c.version.major)
+			}
+			if i > 0 {
+				st.name, st.alias = st.alias, ""
+			}
+			served = append(served, st)
+		}
+	}
+	return served
+}
+
+// checkToolVersions reports tools that cannot be served side by side:
+// versions that do not parse, and names shared by tools that are not all
+// versioned or that share a major version.
+func checkToolVersions(tools []Tool) error {
+	majors := make(map[string]map[int]bool)
+	unversioned := make(map[string]bool)
+	for _, t := range tools {
+		vt, ok := t.(VersionedTool)
+		if !ok {
+			if unversioned[t.Name()] || majors[t.Name()] != nil {
+				return fmt.Errorf("duplicate tool %q", t.Name())
+			}
+			unversioned[t.Name()] = true
+			continue
+		}
+		v, err := parseToolVersion(vt.Version())
+		if err != nil {
+			return fmt.Errorf("tool %q: %w", t.Name(), err)
+		}
+		if unversioned[t.Name()] || majors[t.Name()][v.major] {
+			return fmt.Errorf("duplicate tool %q at major version %d", t.Name(), v.major)
+		}
+		if majors[t.Name()] == nil {
+			majors[t.Name()] = make(map[int]bool)
+		}
+		majors[t.Name()][v.major] = true
+	}
+	return nil
+}
+
+// toolEntry describes a tool in tools/list. A versioned tool's version and
+// deprecation notice are listed under _meta.
+func toolEntry(name string, t Tool, withAnnotations bool) map[string]interface{} {
+	entry := map[string]interface{}{
+		"name":        name,
+		"description": t.Description(),
+		"inputSchema": t.InputSchema(),
+	}
+	if at, ok := t.(AnnotatedTool); ok && withAnnotations {
+		entry["annotations"] = at.Annotations()
+	}
+	if vt, ok := t.(VersionedTool); ok {
+		meta := map[string]interface{}{"version": vt.Version()}
+		if notice := vt.Deprecation(); notice != "" {
+			meta["deprecated"] = notice
+		}
+		entry["_meta"] = meta
+	}
+	return entry
+}
+
+// deprecationWarning adds a warning to the _meta of a successful call to a
+// deprecated tool, leaving the result it was handed untouched.
+func deprecationWarning(logger *slog.Logger, name string, tool Tool, result interface{}) interface{} {
+	vt, ok := tool.(VersionedTool)
+	if !ok || vt.Deprecation() == "" {
+		return result
+	}
+	warning := fmt.Sprintf("%s (version %s) is deprecated: %s", name, vt.Version(), vt.Deprecation())
+	logger.Warn("deprecated tool called", "tool", name, "version", vt.Version())
+
+	m, ok := result.(map[string]interface{})
+	if !ok {
+		return result
+	}
+	out := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	meta := make(map[string]interface{})
+	if old, ok := m["_meta"].(map[string]interface{}); ok {
+		for k, v := range old {
+			meta[k] = v
+		}
+	}
+	warnings, _ := meta["warnings"].([]interface{})
+	meta["warnings"] = append(append([]interface{}(nil), warnings...), warning)
+	out["_meta"] = meta
+	return out
+}
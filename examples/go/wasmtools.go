@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/mcp-flow/examples/go/mcpflowerr"
+)
+
+// =============================================================================
+// WASM Tools
+// =============================================================================
+
+// A WASM tool module is a WebAssembly module that serves tools through a
+// JSON ABI, so tools can be written in any language that compiles to WASM
+// and run sandboxed, without cgo or native plugins. Besides its memory, the
+// module exports:
+//
+//	alloc(size i32) i32       reserves size bytes for the host to write to
+//	tools() i64               returns the module's tools
+//	call(ptr i32, len i32) i64
+//	                          runs the tool named in the JSON at ptr
+//
+// tools and call return where their JSON output is in memory, the pointer
+// in the high 32 bits and the length in the low 32. tools returns an array
+// of {"name", "description", "inputSchema", "annotations"}. call is given
+// {"name": ..., "arguments": {...}} and returns a tool result with
+// "content", {"error": "message"} for a failure, or any other JSON value,
+// which is returned as text.
+//
+// Each call runs in a fresh instance of the module, so calls share no state
+// and a trap cannot leave a broken instance behind. Modules may import WASI
+// (wasi_snapshot_preview1) but get no files, environment, or network, and
+// their output is discarded; a reactor's _initialize runs before each call.
+// An instance's memory is capped at Config.WASMMaxMemory. wazero does not
+// meter instructions, so Config.WASMTimeout is the fuel: a call still
+// running when it expires is stopped and fails with -32013.
+
+const (
+	// defaultWASMMaxMemory caps a WASM tool's memory when Config sets no
+	// cap.
+	defaultWASMMaxMemory = 16 << 20
+	// defaultWASMTimeout bounds a WASM tool call when Config sets no
+	// timeout.
+	defaultWASMTimeout = 10 * time.Second
+	// wasmPageSize is the unit WASM memory grows in.
+	wasmPageSize = 64 << 10
+)
+
+// wasmModule is a compiled tool module, instantiated anew for each call.
+type wasmModule struct {
+	path     string
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	timeout  time.Duration
+}
+
+// wasmToolDef is one entry of a module's tools output.
+type wasmToolDef struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations *ToolAnnotations       `json:"annotations"`
+}
+
+// loadWASMTools compiles the WASM tool module at path and returns its
+// tools, with each instance's memory capped at maxMemory bytes and each
+// call bounded by timeout; zero means the defaults.
+func loadWASMTools(path string, maxMemory int64, timeout time.Duration) (StaticTools, error) {
+	if maxMemory <= 0 {
+		maxMemory = defaultWASMMaxMemory
+	}
+	if timeout <= 0 {
+		timeout = defaultWASMTimeout
+	}
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	pages := uint32(min(max(maxMemory/wasmPageSize, 1), 1<<16))
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(pages).
+		WithCloseOnContextDone(true))
+	m := &wasmModule{path: path, runtime: r, timeout: timeout}
+	tools, err := m.load(ctx, code)
+	if err != nil {
+		r.Close(ctx)
+		return nil, err
+	}
+	return tools, nil
+}
+
+func (m *wasmModule) load(ctx context.Context, code []byte) (StaticTools, error) {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, m.runtime); err != nil {
+		return nil, err
+	}
+	compiled, err := m.runtime.CompileModule(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := compiled.ExportedMemories()["memory"]; !ok {
+		return nil, errors.New("module does not export its memory")
+	}
+	exports := compiled.ExportedFunctions()
+	for name, sig := range map[string]string{"alloc": "i32->i32", "tools": "->i64", "call": "i32,i32->i64"} {
+		fn, ok := exports[name]
+		if !ok {
+			return nil, fmt.Errorf("module does not export %s", name)
+		}
+		if got := wasmSignature(fn); got != sig {
+			return nil, fmt.Errorf("module exports %s as %s, want %s", name, got, sig)
+		}
+	}
+	m.compiled = compiled
+
+	out, err := m.invoke(ctx, "tools", nil)
+	if err != nil {
+		return nil, fmt.Errorf("tools: %w", err)
+	}
+	var defs []wasmToolDef
+	if err := json.Unmarshal(out, &defs); err != nil {
+		return nil, fmt.Errorf("tools: %w", err)
+	}
+	tools := make(StaticTools, 0, len(defs))
+	for _, def := range defs {
+		if def.Name == "" {
+			return nil, errors.New("tools: tool without a name")
+		}
+		if def.InputSchema == nil {
+			def.InputSchema = map[string]interface{}{"type": "object"}
+		}
+		t := &wasmTool{module: m, def: def}
+		if def.Annotations != nil {
+			tools = append(tools, &annotatedWASMTool{t})
+		} else {
+			tools = append(tools, t)
+		}
+	}
+	return tools, nil
+}
+
+// wasmSignature writes a function's type as params->results.
+func wasmSignature(fn api.FunctionDefinition) string {
+	sig := ""
+	for i, t := range fn.ParamTypes() {
+		if i > 0 {
+			sig += ","
+		}
+		sig += api.ValueTypeName(t)
+	}
+	sig += "->"
+	for i, t := range fn.ResultTypes() {
+		if i > 0 {
+			sig += ","
+		}
+		sig += api.ValueTypeName(t)
+	}
+	return sig
+}
+
+// invoke calls the export fn on a fresh instance, passing input through
+// alloc when it is not nil, and returns the output fn locates. The call is
+// stopped when parent ends or the timeout runs out.
+func (m *wasmModule) invoke(parent context.Context, fn string, input []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(parent, m.timeout)
+	defer cancel()
+
+	mod, err := m.runtime.InstantiateModule(ctx, m.compiled,
+		wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, m.callError(parent, ctx, err)
+	}
+	defer mod.Close(context.Background())
+
+	var params []uint64
+	if input != nil {
+		res, err := mod.ExportedFunction("alloc").Call(ctx, uint64(len(input)))
+		if err != nil {
+			return nil, m.callError(parent, ctx, err)
+		}
+		ptr := uint32(res[0])
+		if !mod.Memory().Write(ptr, input) {
+			return nil, fmt.Errorf("alloc returned %d bytes at %d, outside memory", len(input), ptr)
+		}
+		params = []uint64{uint64(ptr), uint64(len(input))}
+	}
+
+	res, err := mod.ExportedFunction(fn).Call(ctx, params...)
+	if err != nil {
+		return nil, m.callError(parent, ctx, err)
+	}
+	ptr, size := uint32(res[0]>>32), uint32(res[0])
+	out, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		return nil, fmt.Errorf("%s returned %d bytes at %d, outside memory", fn, size, ptr)
+	}
+	// The view dies with the instance.
+	return append([]byte(nil), out...), nil
+}
+
+// callError reports a call stopped by its caller or its timeout as such;
+// anything else is a trap in the module, which wazero already labels.
+func (m *wasmModule) callError(parent, ctx context.Context, err error) error {
+	if parent.Err() != nil {
+		return parent.Err()
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return mcpflowerr.Timeout("WASM call did not finish within %s", m.timeout)
+	}
+	return err
+}
+
+// wasmTool is one tool of a WASM module.
+type wasmTool struct {
+	module *wasmModule
+	def    wasmToolDef
+}
+
+func (t *wasmTool) Name() string                        { return t.def.Name }
+func (t *wasmTool) Description() string                 { return t.def.Description }
+func (t *wasmTool) InputSchema() map[string]interface{} { return t.def.InputSchema }
+
+// annotatedWASMTool is a WASM tool that came with annotations.
+type annotatedWASMTool struct{ *wasmTool }
+
+func (t *annotatedWASMTool) Annotations() ToolAnnotations { return *t.def.Annotations }
+
+func (t *wasmTool) Execute(args map[string]interface{}) (interface{}, error) {
+	return t.ExecuteContext(context.Background(), args)
+}
+
+func (t *wasmTool) ExecuteContext(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+	input, err := json.Marshal(struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}{t.def.Name, args})
+	if err != nil {
+		return nil, mcpflowerr.InvalidParams("arguments: %v", err)
+	}
+	out, err := t.module.invoke(ctx, "call", input)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if json.Unmarshal(out, &result) == nil {
+		if msg, ok := result["error"].(string); ok && len(result) == 1 {
+			return nil, errors.New(msg)
+		}
+		if result["content"] != nil {
+			return result, nil
+		}
+	}
+	return map[string]interface{}{
+		"content": []map[string]interface{}{{"type": "text", "text": string(out)}},
+	}, nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Webhooks
+// =============================================================================
+
+// Each of Config.Webhooks is sent the events it subscribes to as a JSON
+// ServerEvent in a POST, one event per request, in the order they
+// happened. A webhook with a secret signs every request:
+//
+//	X-MCPFlow-Event:     session.started
+//	X-MCPFlow-Delivery:  <the event's ID>
+//	X-MCPFlow-Timestamp: <Unix seconds when sent>
+//	X-MCPFlow-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// so receivers can check that the server sent it, and recently. A request
+// that fails, or is answered 429 or 5xx, is retried with exponential
+// backoff, after Retry-After if the receiver sends one, up to
+// webhookAttempts times. Events wait in a queue per webhook while earlier
+// ones are delivered; once webhookQueueSize are waiting, newer ones are
+// dropped. mcpflow_webhook_events_total counts events by outcome.
+
+const (
+	webhookQueueSize = 1024
+	webhookAttempts  = 5
+	// webhookTimeout bounds each attempt.
+	webhookTimeout = 10 * time.Second
+	// webhookBackoff is the wait before the first retry; it doubles with
+	// each further attempt, up to webhookMaxBackoff, which also caps
+	// Retry-After.
+	webhookBackoff    = time.Second
+	webhookMaxBackoff = 30 * time.Second
+)
+
+// Outcomes of a webhook event, for ObserveWebhookEvent.
+const (
+	webhookDelivered = "delivered"
+	webhookFailed    = "failed"
+	webhookDropped   = "dropped"
+)
+
+// WebhookConfig is a receiver of server events.
+type WebhookConfig struct {
+	// URL is the http or https endpoint events are POSTed to.
+	URL string
+	// Secret is the HMAC key requests are signed with; empty sends them
+	// unsigned.
+	Secret string
+	// Events are the event types sent, such as EventAuthFailed; empty
+	// means all of them but the high-volume EventToolCalled.
+	Events []string
+}
+
+// webhookEmitter fans events out to the configured webhooks. Every
+// tenant's Handler shares the root's.
+type webhookEmitter struct {
+	hooks []*webhook
+}
+
+func newWebhookEmitter(cfgs []WebhookConfig, metrics *Metrics) *webhookEmitter {
+	if len(cfgs) == 0 {
+		return nil
+	}
+	e := &webhookEmitter{}
+	for _, cfg := range cfgs {
+		e.hooks = append(e.hooks, newWebhook(cfg, metrics))
+	}
+	return e
+}
+
+func (e *webhookEmitter) send(ev ServerEvent) {
+	for _, w := range e.hooks {
+		w.send(ev)
+	}
+}
+
+// close stops queueing events and waits until the queued ones have been
+// delivered or given up on, abandoning them when ctx expires. It is a
+// ShutdownHook.
+func (e *webhookEmitter) close(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(e.hooks))
+	for i, w := range e.hooks {
+		wg.Add(1)
+		go func(i int, w *webhook) {
+			defer wg.Done()
+			errs[i] = w.close(ctx)
+		}(i, w)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// webhook delivers events to one receiver.
+type webhook struct {
+	cfg     WebhookConfig
+	events  map[string]bool
+	client  *http.Client
+	metrics *Metrics
+	logger  *slog.Logger
+
+	mu     sync.RWMutex
+	queue  chan ServerEvent
+	closed bool
+	done   chan struct{}
+	// stop abandons delivery, cancel being called once close runs out of
+	// time.
+	stop   context.Context
+	cancel context.CancelFunc
+}
+
+func newWebhook(cfg WebhookConfig, metrics *Metrics) *webhook {
+	w := &webhook{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: webhookTimeout},
+		metrics: metrics,
+		logger:  slog.Default().With("component", "webhook", "url", redactURL(cfg.URL)),
+		queue:   make(chan ServerEvent, webhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	if len(cfg.Events) > 0 {
+		w.events = make(map[string]bool, len(cfg.Events))
+		for _, typ := range cfg.Events {
+			w.events[typ] = true
+		}
+	}
+	w.stop, w.cancel = context.WithCancel(context.Background())
+	go w.run()
+	return w
+}
+
+// send queues ev if the webhook subscribes to its type.
+func (w *webhook) send(ev ServerEvent) {
+	if w.events != nil && !w.events[ev.Type] || w.events == nil && ev.Type == EventToolCalled {
+		return
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if !w.closed {
+		select {
+		case w.queue <- ev:
+			return
+		default:
+		}
+	}
+	w.metrics.ObserveWebhookEvent(webhookDropped)
+	w.logger.Debug("webhook queue full, dropping event", "type", ev.Type)
+}
+
+func (w *webhook) run() {
+	defer close(w.done)
+	for ev := range w.queue {
+		if err := w.deliver(ev); err != nil {
+			w.logger.Warn("webhook delivery failed", "type", ev.Type, "id", ev.ID, "error", err)
+			w.metrics.ObserveWebhookEvent(webhookFailed)
+			continue
+		}
+		w.metrics.ObserveWebhookEvent(webhookDelivered)
+	}
+}
+
+// deliver POSTs ev, retrying as the Webhooks section describes.
+func (w *webhook) deliver(ev ServerEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		wait, err := w.attempt(ev, body)
+		if wait < 0 {
+			return err
+		}
+		if attempt == webhookAttempts {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+		if wait == 0 {
+			wait = backoff
+		}
+		select {
+		case <-time.After(wait):
+		case <-w.stop.Done():
+			return fmt.Errorf("abandoned at shutdown: %w", err)
+		}
+		backoff = min(2*backoff, webhookMaxBackoff)
+	}
+}
+
+// attempt sends the request once. A non-negative wait asks for a retry,
+// after that long if it is positive.
+func (w *webhook) attempt(ev ServerEvent, body []byte) (wait time.Duration, err error) {
+	req, err := http.NewRequestWithContext(w.stop, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", serverName+"/"+serverVersion)
+	req.Header.Set("X-MCPFlow-Event", ev.Type)
+	req.Header.Set("X-MCPFlow-Delivery", ev.ID)
+	req.Header.Set("X-MCPFlow-Timestamp", timestamp)
+	if w.cfg.Secret != "" {
+		req.Header.Set("X-MCPFlow-Signature", "sha256="+signWebhook(w.cfg.Secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return -1, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			wait = min(time.Duration(secs)*time.Second, webhookMaxBackoff)
+		}
+		return wait, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return -1, fmt.Errorf("receiver answered %s", resp.Status)
+}
+
+// close stops queueing events and waits for the queue to be delivered, or
+// for ctx to expire.
+func (w *webhook) close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		return ctx.Err()
+	}
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>" under
+// secret.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// redactURL returns rawURL without its password, for logs.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+// webhookFlags collects repeated -webhook URL[,secret=S][,event=TYPE]...
+// flags. The secret defaults to $MCPFLOW_WEBHOOK_SECRET.
+type webhookFlags []WebhookConfig
+
+func (f *webhookFlags) String() string {
+	urls := make([]string, len(*f))
+	for i, w := range *f {
+		urls[i] = redactURL(w.URL)
+	}
+	return strings.Join(urls, ",")
+}
+
+func (f *webhookFlags) Set(value string) error {
+	opts := strings.Split(value, ",")
+	u, err := url.Parse(opts[0])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("want an http or https URL, got %q", opts[0])
+	}
+	w := WebhookConfig{URL: opts[0], Secret: os.Getenv("MCPFLOW_WEBHOOK_SECRET")}
+	for _, opt := range opts[1:] {
+		key, val, _ := strings.Cut(opt, "=")
+		switch key {
+		case "secret":
+			w.Secret = val
+		case "event":
+			if !eventTypes[val] {
+				return fmt.Errorf("unknown event %q", val)
+			}
+			w.Events = append(w.Events, val)
+		default:
+			return fmt.Errorf("unknown webhook option %q", key)
+		}
+	}
+	*f = append(*f, w)
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"golang.org/x/net/websocket"
+)
+
+// =============================================================================
+// WebSocket Transport
+// =============================================================================
+
+// webSocketPath serves MCP-Flow length-prefixed frames over a WebSocket byte
+// stream, for clients behind proxies that pass HTTPS but not UDP or raw TLS.
+const webSocketPath = "/mcp-flow-ws"
+
+// webSocketHandler returns the WebSocket endpoint. Like the WebTransport
+// endpoint it accepts any Origin; deployments exposed to browsers should
+// restrict it.
+func (s *Server) webSocketHandler(ctx context.Context) http.Handler {
+	return websocket.Server{
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+
+			sessionLogger := s.logger.With("remote", ws.Request().RemoteAddr, "transport", "websocket")
+			sessionLogger.Info("session established")
+
+			stop := context.AfterFunc(ctx, func() { ws.Close() })
+			defer stop()
+
+			sess := NewSession(routeFrom(ws.Request().Context(), s.handler).handler, sessionLogger)
+			sess.setPeer("websocket", ws.Request().RemoteAddr)
+			if err := sess.Serve(ctx, ws, ws); err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, net.ErrClosed) {
+				sessionLogger.Error("session error", "error", err)
+			}
+			sessionLogger.Info("session closed")
+		},
+	}
+}